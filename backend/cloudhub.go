@@ -44,8 +44,13 @@ const (
 	ErrInvalidCellOptionsSort          = Error("cell options sortby cannot be empty'")
 	ErrInvalidCellOptionsColumns       = Error("cell options columns cannot be empty'")
 	ErrOrganizationConfigNotFound      = Error("could not find organization config")
-	ErrInvalidCellQueryType            = Error("invalid cell query type: must be 'flux' or 'influxql'")
+	ErrInvalidCellQueryType            = Error("invalid cell query type: must be 'flux', 'influxql' or 'promql'")
 	ErrVsphereNotFound                 = Error("vsphere not found")
+	ErrAlertTemplateNotFound           = Error("alert template not found")
+	ErrAPITokenNotFound                = Error("API token not found")
+	ErrPolicyNotFound                  = Error("policy not found")
+	ErrGroupNotFound                   = Error("group not found")
+	ErrSessionNotFound                 = Error("session not found")
 )
 
 // Error is a domain error encountered while processing CloudHub requests
@@ -96,6 +101,10 @@ const (
 	InfluxEnterprise = "influx-enterprise"
 	// InfluxRelay is the basic HA layer over InfluxDB
 	InfluxRelay = "influx-relay"
+	// InfluxDBv2 is InfluxDB 2.x, which stores buckets of organizations
+	InfluxDBv2 = "influx-v2"
+	// Prometheus is the Prometheus HTTP API queried with PromQL
+	Prometheus = "prometheus"
 )
 
 // TSDBStatus represents the current status of a time series database
@@ -142,6 +151,9 @@ type Role struct {
 	Permissions  Permissions `json:"permissions,omitempty"`
 	Users        []User      `json:"users,omitempty"`
 	Organization string      `json:"organization,omitempty"`
+	// Mapped is whether the role was derived from a mapping of the groups of
+	// the user, and is re-evaluated on every login
+	Mapped bool `json:"mapped,omitempty"`
 }
 
 // RolesStore is the Storage and retrieval of authentication information
@@ -212,7 +224,7 @@ type DashboardQuery struct {
 	QueryConfig QueryConfig `json:"queryConfig,omitempty"` // QueryConfig represents the query state that is understood by the data explorer
 	Source      string      `json:"source"`                // Source is the optional URI to the data source for this queryConfig
 	Shifts      []TimeShift `json:"-"`                     // Shifts represents shifts to apply to an influxql query's time range.  Clients expect the shift to be in the generated QueryConfig
-	Type        string      `json:"type"`                  // Type represents the language the query is in (flux or influxql)
+	Type        string      `json:"type"`                  // Type represents the language the query is in (flux, influxql or promql)
 }
 
 // TemplateQuery is used to retrieve choices for template replacement
@@ -247,6 +259,8 @@ type Source struct {
 	Role               string `json:"role,omitempty"`               // Not Currently Used. Role is the name of the minimum role that a user must possess to access the resource.
 	DefaultRP          string `json:"defaultRP"`                    // DefaultRP is the default retention policy used in database queries to this source
 	Version            string `json:"version,omitempty"`            // Version of influxdb
+	InfluxOrg          string `json:"influxOrg,omitempty"`          // InfluxOrg is the InfluxDB 2.x organization of the buckets of the source
+	Token              string `json:"token,omitempty"`              // Token is the InfluxDB 2.x API token or Prometheus bearer token in CLEARTEXT
 }
 
 // SourcesStore stores connection information for a `TimeSeries`
@@ -289,11 +303,64 @@ type AlertRule struct {
 	Created       time.Time     `json:"created"`                // Date the task was first created
 	Modified      time.Time     `json:"modified"`               // Date the task was last modified
 	LastEnabled   time.Time     `json:"last-enabled,omitempty"` // Date the task was last set to status enabled
+	Queries       []AlertQuery  `json:"queries,omitempty"`      // Queries are the named queries joined together by a composite alert
+	Condition     string        `json:"condition,omitempty"`    // Condition is the boolean expression over the named queries that triggers a composite alert
+	Duration      string        `json:"duration,omitempty"`     // Duration is how long the Condition of a composite alert must be true before it triggers
+}
+
+// AlertQuery is a named query of a composite alert rule. The value of the
+// query is referenced within the rule's Condition as "<Name>.value".
+type AlertQuery struct {
+	Name  string       `json:"name"`  // Name is the alias of the query within the composite alert
+	Query *QueryConfig `json:"query"` // Query is the filter of data for this part of the alert.
 }
 
 // TICKScript task to be used by kapacitor
 type TICKScript string
 
+// AlertTemplateVar is a variable of an AlertTemplate that is substituted
+// when the template is applied to a kapacitor.
+type AlertTemplateVar struct {
+	Name        string `json:"name"`                  // Name is referenced within the template rule as :name:
+	Default     string `json:"default,omitempty"`     // Default is used if the variable is not given a value
+	Description string `json:"description,omitempty"` // Description is a user-facing description of the variable
+}
+
+// AlertTemplateTask is a kapacitor task created from an AlertTemplate
+type AlertTemplateTask struct {
+	SrcID  int               `json:"srcId,string"`  // SrcID is the ID of the source the kapacitor belongs to
+	KapaID int               `json:"kapaId,string"` // KapaID is the ID of the kapacitor running the task
+	TaskID string            `json:"taskId"`        // TaskID is the kapacitor ID of the task
+	Vars   map[string]string `json:"vars"`          // Vars are the values the template was applied with
+}
+
+// AlertTemplate is a reusable AlertRule with variables for thresholds, tag filters
+// and handlers. Tasks remembers every kapacitor task created from the template so
+// they can be updated together.
+type AlertTemplate struct {
+	ID           string              `json:"id"`
+	Name         string              `json:"name"`
+	Description  string              `json:"description"`
+	Rule         AlertRule           `json:"rule"`
+	Vars         []AlertTemplateVar  `json:"vars"`
+	Tasks        []AlertTemplateTask `json:"tasks"`
+	Organization string              `json:"organization"` // Organization is the organization ID that resource belongs to
+}
+
+// AlertTemplatesStore is the storage and retrieval of alert rule templates
+type AlertTemplatesStore interface {
+	// All lists all alert templates in the store
+	All(context.Context) ([]AlertTemplate, error)
+	// Add creates a new alert template in the store and returns it with ID
+	Add(context.Context, AlertTemplate) (AlertTemplate, error)
+	// Delete the alert template from the store
+	Delete(context.Context, AlertTemplate) error
+	// Get retrieves an alert template if `ID` exists
+	Get(ctx context.Context, ID string) (AlertTemplate, error)
+	// Update replaces the alert template in the store
+	Update(context.Context, AlertTemplate) error
+}
+
 // Ticker generates tickscript tasks for kapacitor
 type Ticker interface {
 	// Generate will create the tickscript to be used as a kapacitor task
@@ -436,6 +503,158 @@ type User struct {
 	Provider    string      `json:"provider,omitempty"`
 	Scheme      string      `json:"scheme,omitempty"`
 	SuperAdmin  bool        `json:"superAdmin,omitempty"`
+	// PasswordHash is the bcrypt hash of the password of a user of the local provider
+	PasswordHash string `json:"-"`
+	// FailedLogins is the number of consecutive failed logins of a local user
+	FailedLogins int `json:"-"`
+	// LockedUntil is when a local user locked out by failed logins may log in again
+	LockedUntil time.Time `json:"-"`
+	// ServiceAccount is whether the user is a non-human user of an organization,
+	// which cannot log in and only authenticates with API tokens
+	ServiceAccount bool `json:"serviceAccount,omitempty"`
+	// Owner is the ID of the user responsible for a service account
+	Owner uint64 `json:"owner,string,omitempty"`
+	// TOTPSecret is the base32 secret of the TOTP second factor of a user,
+	// which is pending until TOTPEnabled
+	TOTPSecret  string `json:"-"`
+	TOTPEnabled bool   `json:"-"`
+	// TOTPCounter is the time step of the last TOTP code used, which cannot
+	// be used again
+	TOTPCounter int64 `json:"-"`
+	// BackupCodes are the SHA-256 hashes of the unused backup codes of a user
+	BackupCodes []string `json:"-"`
+	// FailedCodes is the number of consecutive wrong second factor codes
+	FailedCodes int `json:"-"`
+	// Deactivated is whether the user was deactivated by provisioning, and
+	// may not log in nor use API tokens until it is activated again
+	Deactivated bool `json:"deactivated,omitempty"`
+}
+
+// APIToken is a personal API token of a user for automation. Requests with
+// the token act as the user in Organization with at most Role. Only the hash
+// of its secret is stored.
+type APIToken struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	UserID       uint64    `json:"userID,string"`
+	Organization string    `json:"organization"`
+	Role         string    `json:"role"`
+	Hash         string    `json:"-"` // Hash is the hex SHA-256 of the secret of the token
+	CreatedAt    time.Time `json:"createdAt"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
+
+// APITokensStore is the storage and retrieval of API tokens
+type APITokensStore interface {
+	// All lists all API tokens in the store
+	All(context.Context) ([]APIToken, error)
+	// Add creates a new API token in the store and returns it with ID
+	Add(context.Context, APIToken) (APIToken, error)
+	// Delete the API token from the store
+	Delete(context.Context, APIToken) error
+	// Get retrieves an API token if `ID` exists
+	Get(ctx context.Context, ID string) (APIToken, error)
+}
+
+// Kinds of the resources of policies
+const (
+	PolicyDashboard  = "dashboard"
+	PolicySource     = "source"
+	PolicyCapability = "capability"
+)
+
+// Permissions granted by policies on dashboards and sources. Each permission
+// includes the ones before it.
+const (
+	PermissionRead  = "read"
+	PermissionWrite = "write"
+	PermissionAdmin = "admin"
+)
+
+// Capabilities granted by policies
+const (
+	CapabilityTerminal      = "terminal"       // CapabilityTerminal opens terminals on hosts
+	CapabilitySalt          = "salt"           // CapabilitySalt runs salt commands on minions
+	CapabilityDatabaseAdmin = "database-admin" // CapabilityDatabaseAdmin creates and drops databases and retention policies
+)
+
+// Policy grants a permission on a dashboard or a source of an organization,
+// or a capability in it, to a user or to the users with at least a role.
+// Once a resource or capability has policies, only the users they grant and
+// the admins of the organization may use it; otherwise the roles decide.
+type Policy struct {
+	ID           string `json:"id"`
+	Organization string `json:"organization"`            // Organization is the organization ID that resource belongs to
+	Resource     string `json:"resource"`                // Resource is the kind of the resource: dashboard, source or capability
+	ResourceID   string `json:"resourceId"`              // ResourceID is the ID of the dashboard or source, or the name of the capability
+	UserID       uint64 `json:"userId,string,omitempty"` // UserID is the user granted, unless Role is set
+	Role         string `json:"role,omitempty"`          // Role grants the users with at least the role
+	Permission   string `json:"permission,omitempty"`    // Permission is granted on dashboards and sources; capabilities have none
+}
+
+// PoliciesStore is the storage and retrieval of policies
+type PoliciesStore interface {
+	// All lists all policies in the store
+	All(context.Context) ([]Policy, error)
+	// Add creates a new policy in the store and returns it with ID
+	Add(context.Context, Policy) (Policy, error)
+	// Delete the policy from the store
+	Delete(context.Context, Policy) error
+	// Get retrieves a policy if `ID` exists
+	Get(ctx context.Context, ID string) (Policy, error)
+	// Update replaces the policy in the store
+	Update(context.Context, Policy) error
+}
+
+// Group is a group of users provisioned by an identity provider through
+// SCIM. The mappings of the group name grant roles to its members.
+type Group struct {
+	ID          string   `json:"id"`
+	DisplayName string   `json:"displayName"`          // DisplayName is the name of the group matched by mappings
+	ExternalID  string   `json:"externalId,omitempty"` // ExternalID is the ID of the group at the identity provider
+	Members     []uint64 `json:"members,omitempty"`    // Members are the IDs of the users of the group
+}
+
+// GroupsStore is the storage and retrieval of provisioned groups
+type GroupsStore interface {
+	// All lists all groups in the store
+	All(context.Context) ([]Group, error)
+	// Add creates a new group in the store and returns it with ID
+	Add(context.Context, Group) (Group, error)
+	// Delete the group from the store
+	Delete(context.Context, Group) error
+	// Get retrieves a group if `ID` exists
+	Get(ctx context.Context, ID string) (Group, error)
+	// Update replaces the group in the store
+	Update(context.Context, Group) error
+}
+
+// Session is a login of a user to CloudHub. The tokens of the login carry
+// the ID of its session, and are rejected once the session is revoked.
+type Session struct {
+	ID           string    `json:"id"`
+	Subject      string    `json:"subject"`      // Subject is the name of the user of the session
+	Provider     string    `json:"provider"`     // Provider is the provider that authenticated the user
+	Organization string    `json:"organization"` // Organization is the ID of the organization the user is logged into
+	UserAgent    string    `json:"userAgent"`    // UserAgent is the user agent of the browser that logged in
+	RemoteAddr   string    `json:"remoteAddr"`   // RemoteAddr is the address of the client that logged in
+	CreatedAt    time.Time `json:"createdAt"`
+	LastSeenAt   time.Time `json:"lastSeenAt"`
+	ExpiresAt    time.Time `json:"expiresAt"` // ExpiresAt is the end of the lifespan of the session; zero if unbounded
+}
+
+// SessionsStore is the storage and retrieval of the sessions of users
+type SessionsStore interface {
+	// All lists all sessions in the store
+	All(context.Context) ([]Session, error)
+	// Add creates a new session in the store and returns it with ID
+	Add(context.Context, Session) (Session, error)
+	// Delete the session from the store
+	Delete(context.Context, Session) error
+	// Get retrieves a session if `ID` exists
+	Get(ctx context.Context, ID string) (Session, error)
+	// Update replaces the session in the store
+	Update(context.Context, Session) error
 }
 
 // UserQuery represents the attributes that a user may be retrieved by.
@@ -493,6 +712,45 @@ type Measurement struct {
 	Name string `json:"name"` // a unique string identifier for the measurement
 }
 
+// SchemaQuery limits the schema of a database returned by a time series source
+type SchemaQuery struct {
+	RetentionPolicy string // RetentionPolicy of the measurement
+	Measurement     string // Measurement limits the schema to one measurement; all measurements when empty
+	Prefix          string // Prefix of the tag values returned
+	Limit           int    // Limit of the tag values returned; no limit when 0
+}
+
+// TagKey represents a tag key of a measurement in a time series source
+type TagKey struct {
+	Measurement string `json:"measurement"` // the measurement of the tag
+	Key         string `json:"key"`         // the tag key
+}
+
+// FieldKey represents a field key of a measurement in a time series source
+type FieldKey struct {
+	Measurement string `json:"measurement"` // the measurement of the field
+	Key         string `json:"key"`         // the field key
+	Type        string `json:"type"`        // the type of the field: float, integer, string or boolean
+}
+
+// MeasurementCardinality is the number of series of a measurement
+type MeasurementCardinality struct {
+	Measurement string `json:"measurement"` // the measurement of the series
+	Series      int64  `json:"series"`      // the number of series
+}
+
+// Cardinality is the number of series of a database, and of its measurements
+type Cardinality struct {
+	Series       int64                    `json:"series"`       // the number of series of the database or measurement
+	Measurements []MeasurementCardinality `json:"measurements"` // the number of series of each measurement
+}
+
+// ContinuousQuery represents a continuous query of a database in a time series source
+type ContinuousQuery struct {
+	Name  string `json:"name"`  // a unique string identifier for the continuous query within its database
+	Query string `json:"query"` // the CREATE CONTINUOUS QUERY statement
+}
+
 // Databases represents a databases in a time series source
 type Databases interface {
 	// AllDB lists all databases in the current data source
@@ -513,8 +771,25 @@ type Databases interface {
 	// DropRP drops a retention policy in the current data source
 	DropRP(context.Context, string, string) error
 
+	// AllCQ lists all continuous queries of a database in the current data source
+	AllCQ(context.Context, string) ([]ContinuousQuery, error)
+	// CreateCQ creates a continuous query in the current data source
+	CreateCQ(context.Context, string, *ContinuousQuery) (*ContinuousQuery, error)
+	// UpdateCQ replaces a continuous query in the current data source
+	UpdateCQ(context.Context, string, string, *ContinuousQuery) (*ContinuousQuery, error)
+	// DropCQ drops a continuous query in the current data source
+	DropCQ(context.Context, string, string) error
+
 	// GetMeasurements lists measurements in the current data source
 	GetMeasurements(ctx context.Context, db string, limit, offset int) ([]Measurement, error)
+	// GetTagKeys lists the tag keys of measurements in the current data source
+	GetTagKeys(ctx context.Context, db string, q SchemaQuery) ([]TagKey, error)
+	// GetTagValues lists the values of a tag key in the current data source
+	GetTagValues(ctx context.Context, db, key string, q SchemaQuery) ([]string, error)
+	// GetFieldKeys lists the field keys and types of measurements in the current data source
+	GetFieldKeys(ctx context.Context, db string, q SchemaQuery) ([]FieldKey, error)
+	// GetCardinality counts the series of a database, or of a measurement, in the current data source
+	GetCardinality(ctx context.Context, db string, q SchemaQuery) (*Cardinality, error)
 }
 
 // AnnotationTags describes a set of user-defined tags associated with an Annotation
@@ -819,12 +1094,16 @@ const MappingWildcard string = "*"
 // Any of Provider, Scheme, or Group may be provided as a wildcard *
 //     github:oauth2:* -> MyOrg
 //     *:*:* -> AllOrg
+//
+// A mapping grants the Role, or the DefaultRole of the organization
+// when the Role is empty.
 type Mapping struct {
 	ID                   string `json:"id"`
 	Organization         string `json:"organizationId"`
 	Provider             string `json:"provider"`
 	Scheme               string `json:"scheme"`
 	ProviderOrganization string `json:"providerOrganization"`
+	Role                 string `json:"role,omitempty"`
 }
 
 // MappingsStore is the storage and retrieval of Mappings
@@ -849,6 +1128,8 @@ type Organization struct {
 	Name string `json:"name"`
 	// DefaultRole is the name of the role that is the default for any users added to the organization
 	DefaultRole string `json:"defaultRole,omitempty"`
+	// RequireTwoFactor requires admins and SuperAdmins of the organization to log in with a second factor
+	RequireTwoFactor bool `json:"requireTwoFactor,omitempty"`
 }
 
 // OrganizationQuery represents the attributes that a organization may be retrieved by.
@@ -990,6 +1271,10 @@ type Environment struct {
 
 // KVClient defines what each kv store should be capable of.
 type KVClient interface {
+	// AlertTemplatesStore returns the kv's AlertTemplatesStore type.
+	AlertTemplatesStore() AlertTemplatesStore
+	// APITokensStore returns the kv's APITokensStore type.
+	APITokensStore() APITokensStore
 	// ConfigStore returns the kv's ConfigStore type.
 	ConfigStore() ConfigStore
 	// DashboardsStore returns the kv's DashboardsStore type.
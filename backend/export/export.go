@@ -0,0 +1,178 @@
+// Package export writes the results of InfluxQL and Flux queries as CSV,
+// JSON lines or Parquet, one table at a time, so that large results are
+// never held in memory at once.
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/snetsystems/cloudhub/backend/influx"
+)
+
+// Formats of exported results
+const (
+	CSV       = "csv"
+	JSONLines = "jsonl"
+	Parquet   = "parquet"
+)
+
+// Table is a part of the results of a query. Values are nil, string, bool,
+// float64, int64, uint64 or time.Time.
+type Table struct {
+	Columns []string
+	Rows    [][]interface{}
+}
+
+// Writer writes the tables of the results of a query in a format
+type Writer interface {
+	// Write writes the rows of a table
+	Write(Table) error
+	// Close writes the end of the results; it does not close the io.Writer
+	Close() error
+}
+
+// NewWriter creates a Writer of format to w
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case CSV:
+		return newCSVWriter(w), nil
+	case JSONLines:
+		return newJSONLinesWriter(w), nil
+	case Parquet:
+		return newParquetWriter(w), nil
+	}
+	return nil, fmt.Errorf("unknown export format %q; must be csv, jsonl or parquet", format)
+}
+
+// ContentType is the media type of a format
+func ContentType(format string) string {
+	switch format {
+	case CSV:
+		return "text/csv; charset=utf-8"
+	case JSONLines:
+		return "application/x-ndjson"
+	case Parquet:
+		return "application/vnd.apache.parquet"
+	}
+	return "application/octet-stream"
+}
+
+// SeriesTable converts a part of an InfluxQL series into a table of the
+// measurement, the tags and the columns of the series. Times are epoch
+// milliseconds or RFC3339 strings; numbers are doubles.
+func SeriesTable(s influx.Series) Table {
+	tagKeys := make([]string, 0, len(s.Tags))
+	for k := range s.Tags {
+		tagKeys = append(tagKeys, k)
+	}
+	sort.Strings(tagKeys)
+
+	t := Table{
+		Columns: append(append([]string{"name"}, tagKeys...), s.Columns...),
+		Rows:    make([][]interface{}, len(s.Values)),
+	}
+	for i, values := range s.Values {
+		row := make([]interface{}, 0, len(t.Columns))
+		row = append(row, s.Name)
+		for _, k := range tagKeys {
+			row = append(row, s.Tags[k])
+		}
+		for j, v := range values {
+			isTime := j < len(s.Columns) && s.Columns[j] == "time"
+			row = append(row, seriesValue(v, isTime))
+		}
+		t.Rows[i] = row
+	}
+	return t
+}
+
+func seriesValue(v interface{}, isTime bool) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if isTime {
+			if ms, err := v.Int64(); err == nil {
+				return time.Unix(0, ms*int64(time.Millisecond)).UTC()
+			}
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return v.String()
+		}
+		return f
+	case string:
+		if isTime {
+			if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+				return t
+			}
+		}
+		return v
+	case float64:
+		if isTime {
+			return time.Unix(0, int64(v)*int64(time.Millisecond)).UTC()
+		}
+		return v
+	case bool, nil:
+		return v
+	}
+	return fmt.Sprint(v)
+}
+
+// formatValue is the text of a value in CSV
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(v)
+}
+
+func sameColumns(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// fluxValue parses a value of an annotated CSV of its datatype; empty values
+// of types other than string are null
+func fluxValue(value, datatype string) (interface{}, error) {
+	if value == "" && datatype != "string" {
+		return nil, nil
+	}
+	switch {
+	case datatype == "long":
+		return strconv.ParseInt(value, 10, 64)
+	case datatype == "unsignedLong":
+		return strconv.ParseUint(value, 10, 64)
+	case datatype == "double":
+		return strconv.ParseFloat(value, 64)
+	case datatype == "boolean":
+		return strconv.ParseBool(value)
+	case strings.HasPrefix(datatype, "dateTime"):
+		return time.Parse(time.RFC3339Nano, value)
+	}
+	return value, nil
+}
@@ -0,0 +1,213 @@
+package export_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/snetsystems/cloudhub/backend/export"
+	"github.com/snetsystems/cloudhub/backend/influx"
+)
+
+func cpuSeries() influx.Series {
+	return influx.Series{
+		Name:    "cpu",
+		Tags:    map[string]string{"host": "a", "cpu": "cpu0"},
+		Columns: []string{"time", "usage"},
+		Values: [][]interface{}{
+			{json.Number("1000"), json.Number("1.5")},
+			{json.Number("2000"), nil},
+		},
+	}
+}
+
+func TestSeriesTable(t *testing.T) {
+	table := export.SeriesTable(cpuSeries())
+
+	wantColumns := []string{"name", "cpu", "host", "time", "usage"}
+	if strings.Join(table.Columns, ",") != strings.Join(wantColumns, ",") {
+		t.Fatalf("SeriesTable() columns = %v, want %v", table.Columns, wantColumns)
+	}
+	if len(table.Rows) != 2 {
+		t.Fatalf("SeriesTable() rows = %d, want 2", len(table.Rows))
+	}
+	row := table.Rows[0]
+	if tm, ok := row[3].(time.Time); !ok || !tm.Equal(time.Unix(1, 0)) {
+		t.Errorf("SeriesTable() time = %v, want %v", row[3], time.Unix(1, 0).UTC())
+	}
+	if f, ok := row[4].(float64); !ok || f != 1.5 {
+		t.Errorf("SeriesTable() usage = %v, want 1.5", row[4])
+	}
+}
+
+func TestCSVWriter(t *testing.T) {
+	var b bytes.Buffer
+	w, err := export.NewWriter(export.CSV, &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(export.SeriesTable(cpuSeries())); err != nil {
+		t.Fatal(err)
+	}
+	mem := influx.Series{
+		Name:    "mem",
+		Columns: []string{"time", "used"},
+		Values:  [][]interface{}{{json.Number("1000"), json.Number("42")}},
+	}
+	if err := w.Write(export.SeriesTable(mem)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `name,cpu,host,time,usage
+cpu,cpu0,a,1970-01-01T00:00:01Z,1.5
+cpu,cpu0,a,1970-01-01T00:00:02Z,
+
+name,time,used
+mem,1970-01-01T00:00:01Z,42
+`
+	if got := b.String(); got != want {
+		t.Errorf("CSV export = %q, want %q", got, want)
+	}
+}
+
+func TestJSONLinesWriter(t *testing.T) {
+	var b bytes.Buffer
+	w, err := export.NewWriter(export.JSONLines, &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(export.SeriesTable(cpuSeries())); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"name":"cpu","cpu":"cpu0","host":"a","time":"1970-01-01T00:00:01Z","usage":1.5}
+{"name":"cpu","cpu":"cpu0","host":"a","time":"1970-01-01T00:00:02Z","usage":null}
+`
+	if got := b.String(); got != want {
+		t.Errorf("JSON lines export = %q, want %q", got, want)
+	}
+}
+
+func TestNewWriter_UnknownFormat(t *testing.T) {
+	if _, err := export.NewWriter("xlsx", &bytes.Buffer{}); err == nil {
+		t.Error("NewWriter() of an unknown format expected error")
+	}
+}
+
+func TestFluxTables(t *testing.T) {
+	results := `#datatype,string,long,dateTime:RFC3339,double,string
+#group,false,false,false,false,true
+#default,_result,,,,
+,result,table,_time,_value,host
+,,0,2019-01-01T00:00:00Z,1.5,a
+,,0,2019-01-01T00:00:10Z,,a
+,,1,2019-01-01T00:00:00Z,3,b
+
+#datatype,string,long,boolean
+#group,false,false,false
+#default,_result,,
+,result,table,ok
+,,2,true
+`
+	var tables []export.Table
+	err := export.FluxTables(strings.NewReader(results), 2, func(table export.Table) error {
+		tables = append(tables, table)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("FluxTables() error = %v", err)
+	}
+	if len(tables) != 3 {
+		t.Fatalf("FluxTables() tables = %d, want 3", len(tables))
+	}
+	if got := strings.Join(tables[0].Columns, ","); got != "result,table,_time,_value,host" {
+		t.Errorf("FluxTables() columns = %s", got)
+	}
+	if len(tables[0].Rows) != 2 || len(tables[1].Rows) != 1 {
+		t.Errorf("FluxTables() batches = %d and %d rows, want 2 and 1", len(tables[0].Rows), len(tables[1].Rows))
+	}
+	row := tables[0].Rows[0]
+	if row[1] != int64(0) || row[3] != 1.5 || row[4] != "a" {
+		t.Errorf("FluxTables() row = %v", row)
+	}
+	if _, ok := row[2].(time.Time); !ok {
+		t.Errorf("FluxTables() _time = %T, want time.Time", row[2])
+	}
+	if tables[0].Rows[1][3] != nil {
+		t.Errorf("FluxTables() empty double = %v, want nil", tables[0].Rows[1][3])
+	}
+	if tables[2].Rows[0][2] != true {
+		t.Errorf("FluxTables() boolean = %v, want true", tables[2].Rows[0][2])
+	}
+}
+
+func TestFluxTables_Error(t *testing.T) {
+	results := `#datatype,string,string
+#group,true,true
+#default,,
+,error,reference
+,failed to parse query,
+`
+	err := export.FluxTables(strings.NewReader(results), 10, func(export.Table) error {
+		return nil
+	})
+	if err == nil || err.Error() != "failed to parse query" {
+		t.Errorf("FluxTables() error = %v, want failed to parse query", err)
+	}
+}
+
+func TestParquetWriter(t *testing.T) {
+	var b bytes.Buffer
+	w, err := export.NewWriter(export.Parquet, &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(export.SeriesTable(cpuSeries())); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	octets := b.Bytes()
+	if !bytes.HasPrefix(octets, []byte("PAR1")) || !bytes.HasSuffix(octets, []byte("PAR1")) {
+		t.Fatalf("Parquet export does not start and end with the magic number")
+	}
+	size := int(binary.LittleEndian.Uint32(octets[len(octets)-8:]))
+	if size <= 0 || size > len(octets)-12 {
+		t.Fatalf("Parquet export footer size = %d of a file of %d bytes", size, len(octets))
+	}
+	footer := octets[len(octets)-8-size : len(octets)-8]
+	for _, column := range []string{"name", "host", "time", "usage", "cloudhub"} {
+		if !bytes.Contains(footer, []byte(column)) {
+			t.Errorf("Parquet export footer does not contain %q", column)
+		}
+	}
+}
+
+func TestParquetWriter_DifferentColumns(t *testing.T) {
+	w, err := export.NewWriter(export.Parquet, &bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(export.SeriesTable(cpuSeries())); err != nil {
+		t.Fatal(err)
+	}
+	mem := influx.Series{
+		Name:    "mem",
+		Columns: []string{"time", "used"},
+		Values:  [][]interface{}{{json.Number("1000"), json.Number("42")}},
+	}
+	if err := w.Write(export.SeriesTable(mem)); err == nil {
+		t.Error("Write() of different columns to Parquet expected error")
+	}
+}
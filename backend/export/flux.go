@@ -0,0 +1,115 @@
+package export
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// FluxTables reads the annotated CSV of the results of a Flux query and
+// calls fn with its tables, batch rows at most at a time. Values are typed
+// after the #datatype annotation and empty values take the #default
+// annotation; the leading annotation column is dropped.
+func FluxTables(r io.Reader, batch int, fn func(Table) error) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	var (
+		datatypes []string
+		defaults  []string
+		columns   []string
+		rows      [][]interface{}
+	)
+	flush := func() error {
+		if len(rows) == 0 {
+			return nil
+		}
+		t := Table{Columns: columns, Rows: rows}
+		rows = nil
+		return fn(t)
+	}
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return flush()
+		}
+		if err != nil {
+			return err
+		}
+		if len(record) == 0 {
+			continue
+		}
+
+		// Annotations start a table of a new schema
+		if strings.HasPrefix(record[0], "#") {
+			if err := flush(); err != nil {
+				return err
+			}
+			switch record[0] {
+			case "#datatype":
+				datatypes = record
+			case "#default":
+				defaults = record
+			}
+			columns = nil
+			continue
+		}
+
+		if len(record) > 2 && record[1] == "result" && record[2] == "table" {
+			if err := flush(); err != nil {
+				return err
+			}
+			columns = record[1:]
+			if len(datatypes) != len(record) {
+				datatypes = nil
+			}
+			if len(defaults) != len(record) {
+				defaults = nil
+			}
+			continue
+		}
+		if len(record) >= 2 && record[0] == "" && record[1] == "error" {
+			// Errors of a query are a table of an error and a reference
+			errRecord, err := cr.Read()
+			if err != nil {
+				return errors.New("flux query failed")
+			}
+			if len(errRecord) > 1 && errRecord[1] != "" {
+				return errors.New(errRecord[1])
+			}
+			return errors.New("flux query failed")
+		}
+		if columns == nil {
+			return fmt.Errorf("row without a header in the results of the flux query")
+		}
+
+		row := make([]interface{}, len(columns))
+		for i := range columns {
+			if i+1 >= len(record) {
+				break
+			}
+			datatype := "string"
+			if datatypes != nil {
+				datatype = datatypes[i+1]
+			}
+			value := record[i+1]
+			if value == "" && defaults != nil {
+				value = defaults[i+1]
+			}
+			v, err := fluxValue(value, datatype)
+			if err != nil {
+				return fmt.Errorf("invalid %s %q of column %s: %v", datatype, value, columns[i], err)
+			}
+			row[i] = v
+		}
+		rows = append(rows, row)
+		if len(rows) >= batch {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,412 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Parquet files are written uncompressed, one data page of PLAIN values per
+// column of a row group. Every column is optional; its type is the type of
+// the values of the first row group.
+
+const parquetMagic = "PAR1"
+
+// parquetRowGroupRows is the number of rows buffered before a row group is
+// written
+const parquetRowGroupRows = 10000
+
+// Physical types, converted types, encodings and repetitions of Parquet
+const (
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetUTF8            = 0
+	parquetTimestampMicros = 10
+	parquetUint64          = 14
+
+	parquetPlain = 0
+	parquetRLE   = 3
+
+	parquetOptional = 1
+	parquetDataPage = 0
+)
+
+// parquetKind is the type of the values of a column
+type parquetKind int
+
+const (
+	kindString parquetKind = iota
+	kindDouble
+	kindInt64
+	kindUint64
+	kindBool
+	kindTime
+)
+
+func kindOf(v interface{}) (parquetKind, bool) {
+	switch v.(type) {
+	case string:
+		return kindString, true
+	case float64:
+		return kindDouble, true
+	case int64:
+		return kindInt64, true
+	case uint64:
+		return kindUint64, true
+	case bool:
+		return kindBool, true
+	case time.Time:
+		return kindTime, true
+	}
+	return kindString, false
+}
+
+type parquetWriter struct {
+	w         io.Writer
+	offset    int64
+	columns   []string
+	kinds     []parquetKind
+	rows      [][]interface{}
+	rowGroups []thriftStructValue
+	numRows   int64
+	err       error
+}
+
+func newParquetWriter(w io.Writer) *parquetWriter {
+	return &parquetWriter{w: w}
+}
+
+func (p *parquetWriter) Write(t Table) error {
+	if p.err != nil {
+		return p.err
+	}
+	if len(t.Rows) == 0 {
+		return nil
+	}
+	if p.columns == nil {
+		p.columns = t.Columns
+	} else if !sameColumns(p.columns, t.Columns) {
+		return fmt.Errorf("Parquet exports need the same columns in all results; export one statement or table schema at a time")
+	}
+
+	for _, row := range t.Rows {
+		p.rows = append(p.rows, row)
+		if len(p.rows) >= parquetRowGroupRows {
+			if err := p.flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *parquetWriter) Close() error {
+	if p.err != nil {
+		return p.err
+	}
+	if err := p.flush(); err != nil {
+		return err
+	}
+	if p.offset == 0 {
+		if err := p.write([]byte(parquetMagic)); err != nil {
+			return err
+		}
+	}
+
+	schema := []interface{}{
+		thriftStructValue{
+			stringField(4, "schema"),
+			i32Field(5, int32(len(p.columns))),
+		},
+	}
+	for i, name := range p.columns {
+		kind := kindString
+		if i < len(p.kinds) {
+			kind = p.kinds[i]
+		}
+		schema = append(schema, schemaElement(name, kind))
+	}
+	rowGroups := make([]interface{}, len(p.rowGroups))
+	for i, rg := range p.rowGroups {
+		rowGroups[i] = rg
+	}
+
+	var footer bytes.Buffer
+	encodeStruct(&footer, thriftStructValue{
+		i32Field(1, 1),
+		listField(2, thriftStruct, schema...),
+		i64Field(3, p.numRows),
+		listField(4, thriftStruct, rowGroups...),
+		stringField(6, "cloudhub"),
+	})
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(footer.Len()))
+	footer.Write(size[:])
+	footer.WriteString(parquetMagic)
+	return p.write(footer.Bytes())
+}
+
+func (p *parquetWriter) write(b []byte) error {
+	n, err := p.w.Write(b)
+	p.offset += int64(n)
+	if err != nil {
+		p.err = err
+	}
+	return err
+}
+
+func schemaElement(name string, kind parquetKind) thriftStructValue {
+	var typ, converted int32 = parquetByteArray, -1
+	switch kind {
+	case kindString:
+		converted = parquetUTF8
+	case kindDouble:
+		typ = parquetDouble
+	case kindInt64:
+		typ = parquetInt64
+	case kindUint64:
+		typ, converted = parquetInt64, parquetUint64
+	case kindBool:
+		typ = parquetBoolean
+	case kindTime:
+		typ, converted = parquetInt64, parquetTimestampMicros
+	}
+	el := thriftStructValue{
+		i32Field(1, typ),
+		i32Field(3, parquetOptional),
+		stringField(4, name),
+	}
+	if converted >= 0 {
+		el = append(el, i32Field(6, converted))
+	}
+	return el
+}
+
+func physicalType(kind parquetKind) int32 {
+	return schemaElement("", kind)[0].v.(int32)
+}
+
+// detectKinds decides the types of the columns from the buffered rows.
+// Columns of numbers of several types are doubles; of values of several
+// other types, strings.
+func (p *parquetWriter) detectKinds() {
+	p.kinds = make([]parquetKind, len(p.columns))
+	for i := range p.columns {
+		seen := map[parquetKind]bool{}
+		for _, row := range p.rows {
+			if i < len(row) {
+				if kind, ok := kindOf(row[i]); ok {
+					seen[kind] = true
+				}
+			}
+		}
+		switch {
+		case len(seen) == 1:
+			for kind := range seen {
+				p.kinds[i] = kind
+			}
+		case len(seen) > 1 && !seen[kindString] && !seen[kindBool] && !seen[kindTime]:
+			p.kinds[i] = kindDouble
+		default:
+			p.kinds[i] = kindString
+		}
+	}
+}
+
+// flush writes the buffered rows as a row group
+func (p *parquetWriter) flush() error {
+	if len(p.rows) == 0 {
+		return nil
+	}
+	if p.offset == 0 {
+		if err := p.write([]byte(parquetMagic)); err != nil {
+			return err
+		}
+	}
+	if p.kinds == nil {
+		p.detectKinds()
+	}
+
+	var columns []interface{}
+	var groupSize int64
+	for i, name := range p.columns {
+		page, err := p.page(i)
+		if err != nil {
+			return err
+		}
+
+		var header bytes.Buffer
+		encodeStruct(&header, thriftStructValue{
+			i32Field(1, parquetDataPage),
+			i32Field(2, int32(len(page))),
+			i32Field(3, int32(len(page))),
+			structField(5, thriftStructValue{
+				i32Field(1, int32(len(p.rows))),
+				i32Field(2, parquetPlain),
+				i32Field(3, parquetRLE),
+				i32Field(4, parquetRLE),
+			}),
+		})
+
+		offset := p.offset
+		if err := p.write(header.Bytes()); err != nil {
+			return err
+		}
+		if err := p.write(page); err != nil {
+			return err
+		}
+		size := int64(header.Len() + len(page))
+		groupSize += size
+
+		columns = append(columns, thriftStructValue{
+			i64Field(2, offset),
+			structField(3, thriftStructValue{
+				i32Field(1, physicalType(p.kinds[i])),
+				listField(2, thriftI32, int32(parquetPlain), int32(parquetRLE)),
+				listField(3, thriftBinary, name),
+				i32Field(4, 0),
+				i64Field(5, int64(len(p.rows))),
+				i64Field(6, size),
+				i64Field(7, size),
+				i64Field(9, offset),
+			}),
+		})
+	}
+
+	p.rowGroups = append(p.rowGroups, thriftStructValue{
+		listField(1, thriftStruct, columns...),
+		i64Field(2, groupSize),
+		i64Field(3, int64(len(p.rows))),
+	})
+	p.numRows += int64(len(p.rows))
+	p.rows = p.rows[:0]
+	return nil
+}
+
+// page encodes the definition levels and the values of a column of the
+// buffered rows
+func (p *parquetWriter) page(col int) ([]byte, error) {
+	kind := p.kinds[col]
+	defined := make([]bool, len(p.rows))
+	var values bytes.Buffer
+	var bits []bool
+
+	for r, row := range p.rows {
+		var v interface{}
+		if col < len(row) {
+			v = row[col]
+		}
+		if v == nil {
+			continue
+		}
+		defined[r] = true
+
+		var buf [8]byte
+		switch kind {
+		case kindString:
+			s := formatValue(v)
+			binary.LittleEndian.PutUint32(buf[:4], uint32(len(s)))
+			values.Write(buf[:4])
+			values.WriteString(s)
+		case kindDouble:
+			f, ok := toFloat(v)
+			if !ok {
+				return nil, p.typeError(col, v)
+			}
+			binary.LittleEndian.PutUint64(buf[:], math.Float64bits(f))
+			values.Write(buf[:])
+		case kindInt64, kindUint64:
+			n, ok := toInt(v)
+			if !ok {
+				return nil, p.typeError(col, v)
+			}
+			binary.LittleEndian.PutUint64(buf[:], n)
+			values.Write(buf[:])
+		case kindBool:
+			b, ok := v.(bool)
+			if !ok {
+				return nil, p.typeError(col, v)
+			}
+			bits = append(bits, b)
+		case kindTime:
+			t, ok := v.(time.Time)
+			if !ok {
+				return nil, p.typeError(col, v)
+			}
+			binary.LittleEndian.PutUint64(buf[:], uint64(t.UnixNano()/int64(time.Microsecond)))
+			values.Write(buf[:])
+		}
+	}
+	// Booleans are bit-packed, least significant bit first
+	for i := 0; i < len(bits); i += 8 {
+		var b byte
+		for j := 0; j < 8 && i+j < len(bits); j++ {
+			if bits[i+j] {
+				b |= 1 << uint(j)
+			}
+		}
+		values.WriteByte(b)
+	}
+
+	levels := rleLevels(defined)
+	page := make([]byte, 4, 4+len(levels)+values.Len())
+	binary.LittleEndian.PutUint32(page, uint32(len(levels)))
+	page = append(page, levels...)
+	return append(page, values.Bytes()...), nil
+}
+
+func (p *parquetWriter) typeError(col int, v interface{}) error {
+	return fmt.Errorf("column %s has values of several types; %T values cannot be exported to Parquet after other values", p.columns[col], v)
+}
+
+// rleLevels encodes definition levels of bit width 1 as runs of the RLE
+// hybrid encoding
+func rleLevels(defined []bool) []byte {
+	var b bytes.Buffer
+	for i := 0; i < len(defined); {
+		j := i
+		for j < len(defined) && defined[j] == defined[i] {
+			j++
+		}
+		writeUvarint(&b, uint64(j-i)<<1)
+		if defined[i] {
+			b.WriteByte(1)
+		} else {
+			b.WriteByte(0)
+		}
+		i = j
+	}
+	return b.Bytes()
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func toInt(v interface{}) (uint64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return uint64(v), true
+	case uint64:
+		return v, true
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<63 {
+			return uint64(int64(v)), true
+		}
+	}
+	return 0, false
+}
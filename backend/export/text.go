@@ -0,0 +1,111 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// csvWriter writes a header before the rows of every table of new columns,
+// separated from the previous table by an empty line
+type csvWriter struct {
+	out     io.Writer
+	w       *csv.Writer
+	columns []string
+	started bool
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{out: w, w: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) Write(t Table) error {
+	if len(t.Rows) == 0 {
+		return nil
+	}
+	if !c.started || !sameColumns(c.columns, t.Columns) {
+		if c.started {
+			// csv.Writer has no empty records
+			if _, err := io.WriteString(c.out, "\n"); err != nil {
+				return err
+			}
+		}
+		if err := c.w.Write(t.Columns); err != nil {
+			return err
+		}
+		c.columns = t.Columns
+		c.started = true
+	}
+
+	record := make([]string, len(t.Columns))
+	for _, row := range t.Rows {
+		for i := range record {
+			record[i] = ""
+			if i < len(row) {
+				record[i] = formatValue(row[i])
+			}
+		}
+		if err := c.w.Write(record); err != nil {
+			return err
+		}
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// jsonLinesWriter writes every row as a JSON object of its columns
+type jsonLinesWriter struct {
+	w *bufio.Writer
+}
+
+func newJSONLinesWriter(w io.Writer) *jsonLinesWriter {
+	return &jsonLinesWriter{w: bufio.NewWriter(w)}
+}
+
+func (j *jsonLinesWriter) Write(t Table) error {
+	keys := make([][]byte, len(t.Columns))
+	for i, c := range t.Columns {
+		key, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		keys[i] = key
+	}
+
+	for _, row := range t.Rows {
+		j.w.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				j.w.WriteByte(',')
+			}
+			j.w.Write(key)
+			j.w.WriteByte(':')
+
+			var v interface{}
+			if i < len(row) {
+				v = row[i]
+			}
+			if tm, ok := v.(time.Time); ok {
+				v = tm.UTC().Format(time.RFC3339Nano)
+			}
+			octets, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			j.w.Write(octets)
+		}
+		j.w.WriteString("}\n")
+	}
+	return j.w.Flush()
+}
+
+func (j *jsonLinesWriter) Close() error {
+	return j.w.Flush()
+}
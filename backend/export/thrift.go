@@ -0,0 +1,118 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// The metadata of Parquet files is encoded with the Thrift compact protocol.
+// Only the types the metadata uses are encoded.
+
+// Types of the Thrift compact protocol
+const (
+	thriftBoolTrue  = 1
+	thriftBoolFalse = 2
+	thriftI32       = 5
+	thriftI64       = 6
+	thriftBinary    = 8
+	thriftList      = 9
+	thriftStruct    = 12
+)
+
+// thriftField is a field of a struct. Values are int32, int64, string, bool,
+// thriftStructValue or thriftListValue after the type of the field.
+type thriftField struct {
+	id  int16
+	typ byte
+	v   interface{}
+}
+
+type thriftStructValue []thriftField
+
+type thriftListValue struct {
+	elem  byte
+	items []interface{}
+}
+
+func i32Field(id int16, v int32) thriftField {
+	return thriftField{id: id, typ: thriftI32, v: v}
+}
+
+func i64Field(id int16, v int64) thriftField {
+	return thriftField{id: id, typ: thriftI64, v: v}
+}
+
+func stringField(id int16, v string) thriftField {
+	return thriftField{id: id, typ: thriftBinary, v: v}
+}
+
+func structField(id int16, v thriftStructValue) thriftField {
+	return thriftField{id: id, typ: thriftStruct, v: v}
+}
+
+func listField(id int16, elem byte, items ...interface{}) thriftField {
+	return thriftField{id: id, typ: thriftList, v: thriftListValue{elem: elem, items: items}}
+}
+
+// encodeStruct appends the compact encoding of a struct of fields in
+// increasing order of id
+func encodeStruct(b *bytes.Buffer, fields thriftStructValue) {
+	var last int16
+	for _, f := range fields {
+		typ := f.typ
+		if typ == thriftBoolTrue || typ == thriftBoolFalse {
+			typ = thriftBoolFalse
+			if f.v.(bool) {
+				typ = thriftBoolTrue
+			}
+		}
+		if delta := f.id - last; delta > 0 && delta <= 15 {
+			b.WriteByte(byte(delta)<<4 | typ)
+		} else {
+			b.WriteByte(typ)
+			writeVarint(b, int64(f.id))
+		}
+		last = f.id
+		if typ != thriftBoolTrue && typ != thriftBoolFalse {
+			encodeValue(b, f.typ, f.v)
+		}
+	}
+	b.WriteByte(0)
+}
+
+func encodeValue(b *bytes.Buffer, typ byte, v interface{}) {
+	switch typ {
+	case thriftI32:
+		writeVarint(b, int64(v.(int32)))
+	case thriftI64:
+		writeVarint(b, v.(int64))
+	case thriftBinary:
+		s := v.(string)
+		writeUvarint(b, uint64(len(s)))
+		b.WriteString(s)
+	case thriftStruct:
+		encodeStruct(b, v.(thriftStructValue))
+	case thriftList:
+		l := v.(thriftListValue)
+		if len(l.items) < 15 {
+			b.WriteByte(byte(len(l.items))<<4 | l.elem)
+		} else {
+			b.WriteByte(0xf0 | l.elem)
+			writeUvarint(b, uint64(len(l.items)))
+		}
+		for _, item := range l.items {
+			encodeValue(b, l.elem, item)
+		}
+	}
+}
+
+// writeVarint writes a zigzag varint, as binary.PutVarint does
+func writeVarint(b *bytes.Buffer, v int64) {
+	var buf [binary.MaxVarintLen64]byte
+	b.Write(buf[:binary.PutVarint(buf[:], v)])
+}
+
+func writeUvarint(b *bytes.Buffer, v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	b.Write(buf[:binary.PutUvarint(buf[:], v)])
+}
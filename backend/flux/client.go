@@ -3,10 +3,13 @@ package flux
 import (
 	"context"
 	"crypto/tls"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	cloudhub "github.com/snetsystems/cloudhub/backend"
@@ -20,11 +23,19 @@ var (
 	defaultTransport = &http.Transport{}
 )
 
+// Authorizer adds credentials to the requests of a Client
+type Authorizer interface {
+	Set(req *http.Request) error
+}
+
 // Client is how we interact with Flux.
 type Client struct {
 	URL                *url.URL
 	InsecureSkipVerify bool
 	Timeout            time.Duration
+	Authorizer         Authorizer
+	// Org is the organization queried on InfluxDB 2.x
+	Org string
 }
 
 // Ping checks the connection of a Flux.
@@ -84,6 +95,61 @@ func (c *Client) FluxEnabled() (bool, error) {
 	return contentType == "application/json", nil
 }
 
+// Query runs a Flux script and returns its results as annotated CSV
+func (c *Client) Query(ctx context.Context, script string) ([]byte, error) {
+	u := *c.URL
+	u.Path = "/api/v2/query"
+	if c.Org != "" {
+		u.RawQuery = url.Values{"org": {c.Org}}.Encode()
+	}
+
+	req, err := http.NewRequest("POST", u.String(), strings.NewReader(script))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/vnd.flux")
+	req.Header.Set("Accept", "application/csv")
+	if c.Authorizer != nil {
+		if err := c.Authorizer.Set(req); err != nil {
+			return nil, err
+		}
+	}
+
+	hc := &http.Client{
+		Timeout: c.Timeout,
+	}
+	if c.InsecureSkipVerify {
+		hc.Transport = skipVerifyTransport
+	} else {
+		hc.Transport = defaultTransport
+	}
+
+	resp, err := hc.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, cloudhub.ErrUpstreamTimeout
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var fluxErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(body, &fluxErr) == nil && fluxErr.Error != "" {
+			return nil, errors.New(fluxErr.Error)
+		}
+		return nil, fmt.Errorf("received status code %d from flux: %s", resp.StatusCode, body)
+	}
+	return body, nil
+}
+
 func (c *Client) ping(u *url.URL) error {
 	u.Path = "ping"
 
@@ -21,8 +21,14 @@ type NoAuthorization struct{}
 // Set does not add authorization
 func (n *NoAuthorization) Set(req *http.Request) error { return nil }
 
-// DefaultAuthorization creates either a shared JWT builder, basic auth or Noop
+// DefaultAuthorization creates either an InfluxDB 2.x token, a shared JWT
+// builder, basic auth or Noop
 func DefaultAuthorization(src *cloudhub.Source) Authorizer {
+	if src.Type == cloudhub.InfluxDBv2 && src.Token != "" {
+		return &TokenAuth{
+			Token: src.Token,
+		}
+	}
 	// Optionally, add the shared secret JWT token creation
 	if src.Username != "" && src.SharedSecret != "" {
 		return &BearerJWT{
@@ -50,6 +56,18 @@ func (b *BasicAuth) Set(r *http.Request) error {
 	return nil
 }
 
+// TokenAuth adds the Authorization: Token of an InfluxDB 2.x API token to the
+// request header
+type TokenAuth struct {
+	Token string
+}
+
+// Set adds the token header to the request
+func (t *TokenAuth) Set(r *http.Request) error {
+	r.Header.Set("Authorization", "Token "+t.Token)
+	return nil
+}
+
 // BearerJWT is the default Bearer for InfluxDB
 type BearerJWT struct {
 	Username     string
@@ -0,0 +1,330 @@
+package influx
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb/influxql"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+const (
+	// DefaultCacheMaxBytes is the size of the cached results of one source
+	DefaultCacheMaxBytes = 64 << 20
+	// DefaultCacheMinTTL is the shortest time results are cached; queries of
+	// shorter time ranges are not cached
+	DefaultCacheMinTTL = time.Second
+	// DefaultCacheMaxTTL is the longest time results are cached
+	DefaultCacheMaxTTL = 5 * time.Minute
+	// DefaultCacheSchemaTTL is the time results of schema queries, such as
+	// SHOW TAG VALUES, are cached
+	DefaultCacheSchemaTTL = 30 * time.Second
+	// cacheRangeRatio is the part of the time range of a query its results
+	// are cached for, e.g. 18s for a query of the last hour
+	cacheRangeRatio = 200
+)
+
+// Cache results of a query
+const (
+	CacheHit    = "hit"
+	CacheMiss   = "miss"
+	CacheShared = "shared" // Shared results come from an identical query in flight
+	CacheBypass = "bypass" // Bypass queries are never cached
+)
+
+// CacheStats counts the use of the cache of one source
+type CacheStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Shared    uint64 `json:"shared"`
+	Bypassed  uint64 `json:"bypassed"`
+	Evictions uint64 `json:"evictions"`
+	Entries   int    `json:"entries"`
+	Bytes     int64  `json:"bytes"`
+	MaxBytes  int64  `json:"maxBytes"`
+}
+
+// QueryCache keeps the results of InfluxQL SELECT queries for a part of
+// their time range, so that many users refreshing the same dashboard query
+// InfluxDB once. Results are keyed on the source, database, retention
+// policy, epoch, normalized query and a time bucket as long as the TTL;
+// identical queries in flight are sent to InfluxDB once. Every source has its
+// own size limit and evicts the least recently used results first.
+//
+// A nil QueryCache runs every query.
+type QueryCache struct {
+	MaxBytes  int64 // MaxBytes limits the size of the cached results of each source
+	MinTTL    time.Duration
+	MaxTTL    time.Duration
+	SchemaTTL time.Duration // SchemaTTL is the time results of QuerySchema are cached
+	Now       func() time.Time
+
+	mu      sync.Mutex
+	sources map[int]*sourceCache
+	calls   map[string]*call
+}
+
+// NewQueryCache creates a cache of maxBytes of results per source
+func NewQueryCache(maxBytes int64) *QueryCache {
+	return &QueryCache{
+		MaxBytes:  maxBytes,
+		MinTTL:    DefaultCacheMinTTL,
+		MaxTTL:    DefaultCacheMaxTTL,
+		SchemaTTL: DefaultCacheSchemaTTL,
+		Now:       time.Now,
+		sources:   map[int]*sourceCache{},
+		calls:     map[string]*call{},
+	}
+}
+
+type sourceCache struct {
+	entries   map[string]*list.Element
+	lru       *list.List // front is the most recently used
+	stats     CacheStats
+	nextSweep time.Time
+}
+
+type cacheEntry struct {
+	key     string
+	value   json.RawMessage
+	expires time.Time
+}
+
+// call is a query in flight shared by identical queries
+type call struct {
+	done  chan struct{}
+	value json.RawMessage
+	err   error
+}
+
+// Query returns the results of q on the source srcID from the cache, or runs
+// query and caches its results. Errors are never cached.
+func (c *QueryCache) Query(ctx context.Context, srcID int, q cloudhub.Query, query func() (cloudhub.Response, error)) (json.RawMessage, string, error) {
+	if c == nil {
+		value, err := run(query)
+		return value, CacheBypass, err
+	}
+
+	now := c.Now()
+	key, ttl, ok := c.key(srcID, q, now)
+	if !ok {
+		c.count(srcID, func(s *CacheStats) { s.Bypassed++ })
+		value, err := run(query)
+		return value, CacheBypass, err
+	}
+	return c.cached(ctx, srcID, key, ttl, now, query)
+}
+
+// QuerySchema returns the results of the schema query q, such as SHOW TAG
+// KEYS, on the source srcID from the cache, or runs query and caches its
+// results for SchemaTTL. Schema queries have no time range; their results
+// are cached briefly so that schema browsing and the template variables of
+// many users query InfluxDB once.
+func (c *QueryCache) QuerySchema(ctx context.Context, srcID int, q cloudhub.Query, query func() (cloudhub.Response, error)) (json.RawMessage, string, error) {
+	if c == nil || c.MaxBytes <= 0 || c.SchemaTTL <= 0 {
+		if c != nil {
+			c.count(srcID, func(s *CacheStats) { s.Bypassed++ })
+		}
+		value, err := run(query)
+		return value, CacheBypass, err
+	}
+
+	now := c.Now()
+	bucket := now.Truncate(c.SchemaTTL).UnixNano()
+	key := fmt.Sprintf("%d\x00%s\x00%s\x00schema\x00%d\x00%s", srcID, q.DB, q.RP, bucket, q.Command)
+	return c.cached(ctx, srcID, key, c.SchemaTTL, now, query)
+}
+
+// cached returns the results of key from the cache, waits for the identical
+// query in flight, or runs query and caches its results until the end of
+// the time bucket of ttl
+func (c *QueryCache) cached(ctx context.Context, srcID int, key string, ttl time.Duration, now time.Time, query func() (cloudhub.Response, error)) (json.RawMessage, string, error) {
+	c.mu.Lock()
+	src := c.source(srcID)
+	if value, ok := src.get(key, now); ok {
+		src.stats.Hits++
+		c.mu.Unlock()
+		return value, CacheHit, nil
+	}
+	if cl, ok := c.calls[key]; ok {
+		src.stats.Shared++
+		c.mu.Unlock()
+		select {
+		case <-cl.done:
+			return cl.value, CacheShared, cl.err
+		case <-ctx.Done():
+			return nil, CacheShared, ctx.Err()
+		}
+	}
+	cl := &call{done: make(chan struct{})}
+	c.calls[key] = cl
+	src.stats.Misses++
+	c.mu.Unlock()
+
+	cl.value, cl.err = run(query)
+
+	c.mu.Lock()
+	delete(c.calls, key)
+	if cl.err == nil {
+		// The time bucket of the key ends the life of the entry
+		expires := now.Truncate(ttl).Add(ttl)
+		src = c.source(srcID)
+		src.sweep(now, c.MinTTL)
+		src.put(key, cl.value, expires, c.MaxBytes)
+	}
+	c.mu.Unlock()
+	close(cl.done)
+
+	return cl.value, CacheMiss, cl.err
+}
+
+func run(query func() (cloudhub.Response, error)) (json.RawMessage, error) {
+	res, err := query()
+	if err != nil {
+		return nil, err
+	}
+	return res.MarshalJSON()
+}
+
+// key normalizes the query and decides how long its results are cached.
+// Only SELECT statements without INTO and with a time range are cached.
+func (c *QueryCache) key(srcID int, q cloudhub.Query, now time.Time) (string, time.Duration, bool) {
+	if c.MaxBytes <= 0 {
+		return "", 0, false
+	}
+
+	parsed, err := influxql.ParseQuery(q.Command)
+	if err != nil || len(parsed.Statements) == 0 {
+		return "", 0, false
+	}
+	for _, stmt := range parsed.Statements {
+		sel, ok := stmt.(*influxql.SelectStatement)
+		if !ok || sel.Target != nil {
+			return "", 0, false
+		}
+	}
+
+	dur, err := ParseTime(q.Command, now)
+	if err != nil {
+		return "", 0, false
+	}
+	// Whole seconds keep the time buckets of close time ranges aligned
+	ttl := (dur / cacheRangeRatio).Round(time.Second)
+	if ttl < c.MinTTL {
+		return "", 0, false
+	}
+	if ttl > c.MaxTTL {
+		ttl = c.MaxTTL
+	}
+
+	bucket := now.Truncate(ttl).UnixNano()
+	return fmt.Sprintf("%d\x00%s\x00%s\x00%s\x00%d\x00%s", srcID, q.DB, q.RP, q.Epoch, bucket, parsed.String()), ttl, true
+}
+
+// source returns the cache of a source; callers hold mu
+func (c *QueryCache) source(srcID int) *sourceCache {
+	if c.sources == nil {
+		c.sources = map[int]*sourceCache{}
+		c.calls = map[string]*call{}
+	}
+	src, ok := c.sources[srcID]
+	if !ok {
+		src = &sourceCache{
+			entries: map[string]*list.Element{},
+			lru:     list.New(),
+		}
+		c.sources[srcID] = src
+	}
+	return src
+}
+
+func (c *QueryCache) count(srcID int, f func(*CacheStats)) {
+	c.mu.Lock()
+	f(&c.source(srcID).stats)
+	c.mu.Unlock()
+}
+
+func (s *sourceCache) get(key string, now time.Time) (json.RawMessage, bool) {
+	el, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*cacheEntry)
+	if !now.Before(entry.expires) {
+		s.remove(el)
+		return nil, false
+	}
+	s.lru.MoveToFront(el)
+	return entry.value, true
+}
+
+// sweep drops expired results at most once every interval; results of past
+// time buckets are never read again
+func (s *sourceCache) sweep(now time.Time, interval time.Duration) {
+	if now.Before(s.nextSweep) {
+		return
+	}
+	s.nextSweep = now.Add(interval)
+	for _, el := range s.entries {
+		if !now.Before(el.Value.(*cacheEntry).expires) {
+			s.remove(el)
+		}
+	}
+}
+
+func (s *sourceCache) put(key string, value json.RawMessage, expires time.Time, maxBytes int64) {
+	size := int64(len(value))
+	if size > maxBytes {
+		return
+	}
+	if el, ok := s.entries[key]; ok {
+		s.remove(el)
+	}
+	for s.stats.Bytes+size > maxBytes {
+		s.remove(s.lru.Back())
+		s.stats.Evictions++
+	}
+	s.entries[key] = s.lru.PushFront(&cacheEntry{
+		key:     key,
+		value:   value,
+		expires: expires,
+	})
+	s.stats.Entries++
+	s.stats.Bytes += size
+}
+
+func (s *sourceCache) remove(el *list.Element) {
+	entry := s.lru.Remove(el).(*cacheEntry)
+	delete(s.entries, entry.key)
+	s.stats.Entries--
+	s.stats.Bytes -= int64(len(entry.value))
+}
+
+// Stats returns the use of the cache of a source
+func (c *QueryCache) Stats(srcID int) CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.source(srcID).stats
+	stats.MaxBytes = c.MaxBytes
+	return stats
+}
+
+// Purge drops the cached results of a source, e.g. when the source changes
+func (c *QueryCache) Purge(srcID int) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	src := c.source(srcID)
+	for _, el := range src.entries {
+		src.remove(el)
+	}
+}
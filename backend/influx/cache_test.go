@@ -0,0 +1,229 @@
+package influx_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/influx"
+)
+
+type rawResponse string
+
+func (r rawResponse) MarshalJSON() ([]byte, error) {
+	return []byte(r), nil
+}
+
+func newTestCache(maxBytes int64, now *time.Time) *influx.QueryCache {
+	c := influx.NewQueryCache(maxBytes)
+	c.Now = func() time.Time { return *now }
+	return c
+}
+
+func TestQueryCache_Query(t *testing.T) {
+	// Start at the beginning of the 18s time bucket of a query of the last hour
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC).Truncate(18 * time.Second)
+	c := newTestCache(1024, &now)
+
+	calls := 0
+	query := func() (cloudhub.Response, error) {
+		calls++
+		return rawResponse(`[{"series":[]}]`), nil
+	}
+	q := cloudhub.Query{
+		Command: `SELECT mean("usage_user") FROM "cpu" WHERE time > now() - 1h GROUP BY time(1m)`,
+		DB:      "telegraf",
+		RP:      "autogen",
+	}
+	ctx := context.Background()
+
+	if _, res, _ := c.Query(ctx, 1, q, query); res != influx.CacheMiss {
+		t.Errorf("QueryCache.Query() first = %s, want miss", res)
+	}
+
+	// Spacing and keyword case do not change the query
+	same := q
+	same.Command = `select mean("usage_user")  from "cpu" where time > now() - 1h group by time(1m)`
+	value, res, err := c.Query(ctx, 1, same, query)
+	if err != nil || res != influx.CacheHit || string(value) != `[{"series":[]}]` {
+		t.Errorf("QueryCache.Query() normalized = %s, %s, %v; want hit", value, res, err)
+	}
+
+	// Another source, database or retention policy is another query
+	if _, res, _ := c.Query(ctx, 2, q, query); res != influx.CacheMiss {
+		t.Errorf("QueryCache.Query() other source = %s, want miss", res)
+	}
+	other := q
+	other.RP = "weekly"
+	if _, res, _ := c.Query(ctx, 1, other, query); res != influx.CacheMiss {
+		t.Errorf("QueryCache.Query() other rp = %s, want miss", res)
+	}
+
+	// A query of the last hour is cached for 18s
+	now = now.Add(17 * time.Second)
+	if _, res, _ := c.Query(ctx, 1, q, query); res != influx.CacheHit {
+		t.Errorf("QueryCache.Query() within ttl = %s, want hit", res)
+	}
+	now = now.Add(2 * time.Second)
+	if _, res, _ := c.Query(ctx, 1, q, query); res != influx.CacheMiss {
+		t.Errorf("QueryCache.Query() after ttl = %s, want miss", res)
+	}
+
+	if calls != 4 {
+		t.Errorf("QueryCache.Query() queried InfluxDB %d times, want 4", calls)
+	}
+	// Caching the new time bucket drops the results of the expired one
+	stats := c.Stats(1)
+	if stats.Hits != 2 || stats.Misses != 3 || stats.Entries != 1 {
+		t.Errorf("QueryCache.Stats() = %+v", stats)
+	}
+}
+
+func TestQueryCache_Bypass(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := newTestCache(1024, &now)
+	query := func() (cloudhub.Response, error) {
+		return rawResponse(`[]`), nil
+	}
+
+	for _, cmd := range []string{
+		`SHOW DATABASES`,
+		`SELECT "usage_user" FROM "cpu"`,
+		`SELECT "usage_user" FROM "cpu" WHERE time > now() - 1m`,
+		`SELECT "usage_user" INTO "cpu_copy" FROM "cpu" WHERE time > now() - 1h`,
+	} {
+		if _, res, _ := c.Query(context.Background(), 1, cloudhub.Query{Command: cmd}, query); res != influx.CacheBypass {
+			t.Errorf("QueryCache.Query(%s) = %s, want bypass", cmd, res)
+		}
+	}
+	if stats := c.Stats(1); stats.Bypassed != 4 || stats.Entries != 0 {
+		t.Errorf("QueryCache.Stats() = %+v", stats)
+	}
+
+	var nilCache *influx.QueryCache
+	if _, res, _ := nilCache.Query(context.Background(), 1, cloudhub.Query{Command: `SHOW DATABASES`}, query); res != influx.CacheBypass {
+		t.Errorf("nil QueryCache.Query() = %s, want bypass", res)
+	}
+}
+
+func TestQueryCache_Shared(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := newTestCache(1024, &now)
+
+	release := make(chan struct{})
+	var mu sync.Mutex
+	calls := 0
+	query := func() (cloudhub.Response, error) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		<-release
+		return rawResponse(`[]`), nil
+	}
+	q := cloudhub.Query{Command: `SELECT "usage_user" FROM "cpu" WHERE time > now() - 1h`}
+
+	var wg sync.WaitGroup
+	results := make([]string, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, results[i], _ = c.Query(context.Background(), 1, q, query)
+		}(i)
+	}
+	// Wait for every query to reach the cache before InfluxDB answers
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if stats := c.Stats(1); stats.Misses+stats.Shared == 5 {
+			break
+		}
+	}
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("QueryCache.Query() queried InfluxDB %d times, want 1", calls)
+	}
+	if stats := c.Stats(1); stats.Misses != 1 || stats.Shared != 4 {
+		t.Errorf("QueryCache.Stats() = %+v; results %v", stats, results)
+	}
+}
+
+func TestQueryCache_Evicts(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := newTestCache(14, &now)
+	value := func(v string) func() (cloudhub.Response, error) {
+		return func() (cloudhub.Response, error) {
+			return rawResponse(v), nil
+		}
+	}
+	q := func(m string) cloudhub.Query {
+		return cloudhub.Query{Command: `SELECT "v" FROM "` + m + `" WHERE time > now() - 1h`}
+	}
+	ctx := context.Background()
+
+	c.Query(ctx, 1, q("a"), value(`"aaaa"`))
+	c.Query(ctx, 1, q("b"), value(`"bbbb"`))
+	// Reading a keeps it in front of b
+	if _, res, _ := c.Query(ctx, 1, q("a"), value(`"aaaa"`)); res != influx.CacheHit {
+		t.Fatalf("QueryCache.Query() = %s, want hit", res)
+	}
+	c.Query(ctx, 1, q("c"), value(`"cccc"`))
+	if _, res, _ := c.Query(ctx, 1, q("b"), value(`"bbbb"`)); res != influx.CacheMiss {
+		t.Errorf("QueryCache.Query() least recently used = %s, want miss", res)
+	}
+
+	// Results larger than the cache are not kept
+	c.Query(ctx, 1, q("d"), value(`"`+strings.Repeat("d", 20)+`"`))
+	stats := c.Stats(1)
+	if stats.Bytes != 12 || stats.Evictions != 2 {
+		t.Errorf("QueryCache.Stats() = %+v", stats)
+	}
+
+	c.Purge(1)
+	if stats := c.Stats(1); stats.Entries != 0 || stats.Bytes != 0 {
+		t.Errorf("QueryCache.Purge() left %+v", stats)
+	}
+}
+
+func TestQueryCache_QuerySchema(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := newTestCache(1024, &now)
+
+	calls := 0
+	query := func() (cloudhub.Response, error) {
+		calls++
+		return rawResponse(`[{"series":[]}]`), nil
+	}
+	q := cloudhub.Query{
+		Command: `SHOW TAG VALUES ON "telegraf" WITH KEY = host`,
+		DB:      "telegraf",
+	}
+	ctx := context.Background()
+
+	if _, res, _ := c.QuerySchema(ctx, 1, q, query); res != influx.CacheMiss {
+		t.Errorf("QueryCache.QuerySchema() first = %s, want miss", res)
+	}
+	now = now.Add(influx.DefaultCacheSchemaTTL - time.Second)
+	if _, res, _ := c.QuerySchema(ctx, 1, q, query); res != influx.CacheHit {
+		t.Errorf("QueryCache.QuerySchema() within ttl = %s, want hit", res)
+	}
+	// Schema queries are not cached by Query, which needs a time range
+	if _, res, _ := c.Query(ctx, 1, q, query); res != influx.CacheBypass {
+		t.Errorf("QueryCache.Query() of a schema query = %s, want bypass", res)
+	}
+	now = now.Add(time.Second)
+	if _, res, _ := c.QuerySchema(ctx, 1, q, query); res != influx.CacheMiss {
+		t.Errorf("QueryCache.QuerySchema() after ttl = %s, want miss", res)
+	}
+
+	c.SchemaTTL = 0
+	if _, res, _ := c.QuerySchema(ctx, 1, q, query); res != influx.CacheBypass {
+		t.Errorf("QueryCache.QuerySchema() without ttl = %s, want bypass", res)
+	}
+	if calls != 4 {
+		t.Errorf("QueryCache.QuerySchema() queried InfluxDB %d times, want 4", calls)
+	}
+}
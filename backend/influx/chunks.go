@@ -0,0 +1,178 @@
+package influx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// Series is a part of a series of the results of an InfluxQL query
+type Series struct {
+	Name    string            `json:"name"`
+	Tags    map[string]string `json:"tags"`
+	Columns []string          `json:"columns"`
+	Values  [][]interface{}   `json:"values"`
+}
+
+// Chunks reads the results of an InfluxQL query InfluxDB sends in chunks,
+// one part of a series at a time
+type Chunks struct {
+	body    io.ReadCloser
+	dec     *json.Decoder
+	pending []Series
+}
+
+// QueryChunks sends an InfluxQL query asking InfluxDB to stream its results
+// in chunks of chunkSize points. Numbers of the results are json.Number.
+// The Chunks must be closed.
+func (c *Client) QueryChunks(ctx context.Context, q cloudhub.Query, chunkSize int) (*Chunks, error) {
+	u := *c.URL
+	u.Path = "query"
+
+	params := url.Values{}
+	params.Set("q", q.Command)
+	params.Set("db", q.DB)
+	params.Set("rp", q.RP)
+	params.Set("epoch", "ms")
+	if q.Epoch != "" {
+		params.Set("epoch", q.Epoch)
+	}
+	params.Set("chunked", "true")
+	params.Set("chunk_size", strconv.Itoa(chunkSize))
+	u.RawQuery = params.Encode()
+
+	req, err := http.NewRequest("POST", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if c.Authorizer != nil {
+		if err := c.Authorizer.Set(req); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, cloudhub.ErrUpstreamTimeout
+		}
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var response Response
+		json.NewDecoder(resp.Body).Decode(&response)
+		return nil, fmt.Errorf("received status code %d from server: err: %s", resp.StatusCode, response.Err)
+	}
+
+	dec := json.NewDecoder(resp.Body)
+	dec.UseNumber()
+	return &Chunks{
+		body: resp.Body,
+		dec:  dec,
+	}, nil
+}
+
+// Next returns the next part of a series, or io.EOF after the last one.
+// Errors of statements end the results.
+func (ch *Chunks) Next() (Series, error) {
+	for len(ch.pending) == 0 {
+		var chunk struct {
+			Results []struct {
+				Series []Series `json:"series"`
+				Err    string   `json:"error"`
+			} `json:"results"`
+			Err string `json:"error"`
+		}
+		if err := ch.dec.Decode(&chunk); err != nil {
+			return Series{}, err
+		}
+		if chunk.Err != "" {
+			return Series{}, errors.New(chunk.Err)
+		}
+		for _, r := range chunk.Results {
+			if r.Err != "" {
+				return Series{}, errors.New(r.Err)
+			}
+			ch.pending = append(ch.pending, r.Series...)
+		}
+	}
+	s := ch.pending[0]
+	ch.pending = ch.pending[1:]
+	return s, nil
+}
+
+// Close ends the response of InfluxDB
+func (ch *Chunks) Close() error {
+	return ch.body.Close()
+}
+
+// QueryFlux sends a Flux script to the /api/v2/query endpoint and returns
+// the annotated CSV of its results as InfluxDB streams it. The body must be
+// closed.
+func (c *Client) QueryFlux(ctx context.Context, script string) (io.ReadCloser, error) {
+	u := *c.URL
+	u.Path = "/api/v2/query"
+	if c.Org != "" {
+		u.RawQuery = url.Values{"org": {c.Org}}.Encode()
+	}
+
+	req, err := http.NewRequest("POST", u.String(), strings.NewReader(script))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/vnd.flux")
+	req.Header.Set("Accept", "application/csv")
+	if c.Authorizer != nil {
+		if err := c.Authorizer.Set(req); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, cloudhub.ErrUpstreamTimeout
+		}
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		var fluxErr struct {
+			Message string `json:"message"`
+			Error   string `json:"error"`
+		}
+		if json.Unmarshal(body, &fluxErr) == nil {
+			if fluxErr.Message != "" {
+				return nil, errors.New(fluxErr.Message)
+			}
+			if fluxErr.Error != "" {
+				return nil, errors.New(fluxErr.Error)
+			}
+		}
+		return nil, fmt.Errorf("received status code %d from server: err: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return resp.Body, nil
+}
+
+func (c *Client) httpClient() *http.Client {
+	hc := &http.Client{}
+	if c.InsecureSkipVerify {
+		hc.Transport = skipVerifyTransport
+	} else {
+		hc.Transport = defaultTransport
+	}
+	return hc
+}
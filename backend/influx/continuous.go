@@ -0,0 +1,236 @@
+package influx
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/influxdata/influxdb/influxql"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// ParseContinuousQuery parses a CREATE CONTINUOUS QUERY statement. The
+// InfluxQL parser already requires a target and a GROUP BY time interval
+// for aggregates.
+func ParseContinuousQuery(query string) (*influxql.CreateContinuousQueryStatement, error) {
+	stmt, err := influxql.ParseStatement(query)
+	if err != nil {
+		return nil, err
+	}
+	cq, ok := stmt.(*influxql.CreateContinuousQueryStatement)
+	if !ok {
+		return nil, fmt.Errorf("query is not a CREATE CONTINUOUS QUERY statement")
+	}
+	return cq, nil
+}
+
+// ContinuousQueryTarget is where a continuous query built from a query
+// config writes its results, and how often it resamples.
+type ContinuousQueryTarget struct {
+	RetentionPolicy string `json:"rp"`                      // RetentionPolicy the results are written to
+	Measurement     string `json:"measurement,omitempty"`   // Measurement the results are written to; defaults to the queried measurement
+	ResampleEvery   string `json:"resampleEvery,omitempty"` // ResampleEvery is how often the query runs; defaults to the GROUP BY time interval
+	ResampleFor     string `json:"resampleFor,omitempty"`   // ResampleFor is how far back every run recomputes
+}
+
+// BuildContinuousQuery creates a CREATE CONTINUOUS QUERY statement named
+// name on db that downsamples the query config into the target. Every
+// field of the query config must be an aggregate function; fields without
+// an alias are named after their function and field, as mean_usage, so
+// that several aggregates of a field do not overwrite each other.
+func BuildContinuousQuery(name, db string, qc *cloudhub.QueryConfig, target ContinuousQueryTarget) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("name is required")
+	}
+	if qc.RawText != nil {
+		return "", fmt.Errorf("continuous queries cannot be built from raw queries")
+	}
+	if qc.Measurement == "" {
+		return "", fmt.Errorf("measurement is required")
+	}
+	if len(qc.Fields) == 0 {
+		return "", fmt.Errorf("at least one field is required")
+	}
+	if target.RetentionPolicy == "" {
+		return "", fmt.Errorf("target retention policy is required")
+	}
+	if qc.GroupBy.Time == "" || qc.GroupBy.Time == "auto" {
+		return "", fmt.Errorf("a GROUP BY time interval is required")
+	}
+	interval, err := influxql.ParseDuration(qc.GroupBy.Time)
+	if err != nil {
+		return "", fmt.Errorf("invalid GROUP BY time %s: %v", qc.GroupBy.Time, err)
+	}
+
+	srcDB := qc.Database
+	if srcDB == "" {
+		srcDB = db
+	}
+	measurement := target.Measurement
+	if measurement == "" {
+		measurement = qc.Measurement
+	}
+
+	sel := &influxql.SelectStatement{
+		Target: &influxql.Target{
+			Measurement: &influxql.Measurement{
+				Database:        db,
+				RetentionPolicy: target.RetentionPolicy,
+				Name:            measurement,
+			},
+		},
+		Sources: influxql.Sources{
+			&influxql.Measurement{
+				Database:        srcDB,
+				RetentionPolicy: qc.RetentionPolicy,
+				Name:            qc.Measurement,
+			},
+		},
+		Dimensions: influxql.Dimensions{
+			{Expr: &influxql.Call{Name: "time", Args: []influxql.Expr{&influxql.DurationLiteral{Val: interval}}}},
+		},
+		Condition: cqCondition(qc),
+	}
+	for _, tag := range qc.GroupBy.Tags {
+		sel.Dimensions = append(sel.Dimensions, &influxql.Dimension{Expr: &influxql.VarRef{Val: tag}})
+	}
+	for _, f := range qc.Fields {
+		fld, err := cqField(f)
+		if err != nil {
+			return "", err
+		}
+		sel.Fields = append(sel.Fields, fld)
+	}
+	if sel.Fill, sel.FillValue, err = cqFill(qc.Fill); err != nil {
+		return "", err
+	}
+
+	stmt := &influxql.CreateContinuousQueryStatement{
+		Name:     name,
+		Database: db,
+		Source:   sel,
+	}
+	if target.ResampleEvery != "" {
+		if stmt.ResampleEvery, err = influxql.ParseDuration(target.ResampleEvery); err != nil {
+			return "", fmt.Errorf("invalid resample every %s: %v", target.ResampleEvery, err)
+		}
+	}
+	if target.ResampleFor != "" {
+		if stmt.ResampleFor, err = influxql.ParseDuration(target.ResampleFor); err != nil {
+			return "", fmt.Errorf("invalid resample for %s: %v", target.ResampleFor, err)
+		}
+	}
+
+	// Parsing the statement back validates it as InfluxDB will
+	query := stmt.String()
+	if _, err := ParseContinuousQuery(query); err != nil {
+		return "", err
+	}
+	return query, nil
+}
+
+func cqField(f cloudhub.Field) (*influxql.Field, error) {
+	fn, ok := f.Value.(string)
+	if f.Type != "func" || !ok {
+		return nil, fmt.Errorf("field %v is not an aggregate function; continuous queries only store aggregates", f.Value)
+	}
+	call := &influxql.Call{Name: fn}
+	alias := f.Alias
+	for _, arg := range f.Args {
+		expr, err := cqArg(arg)
+		if err != nil {
+			return nil, err
+		}
+		if ref, ok := expr.(*influxql.VarRef); ok && alias == "" {
+			alias = fn + "_" + ref.Val
+		}
+		call.Args = append(call.Args, expr)
+	}
+	return &influxql.Field{Expr: call, Alias: alias}, nil
+}
+
+func cqArg(arg cloudhub.Field) (influxql.Expr, error) {
+	v := fmt.Sprint(arg.Value)
+	switch arg.Type {
+	case "field":
+		return &influxql.VarRef{Val: v}, nil
+	case "wildcard":
+		return &influxql.Wildcard{}, nil
+	case "integer":
+		i, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer argument %s", v)
+		}
+		return &influxql.IntegerLiteral{Val: i}, nil
+	case "number":
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number argument %s", v)
+		}
+		return &influxql.NumberLiteral{Val: n}, nil
+	}
+	return nil, fmt.Errorf("unsupported argument type %s", arg.Type)
+}
+
+// cqCondition filters the tags of a query config the way the data explorer
+// does: accepted values of a tag are ORed, rejected ones are ANDed.
+func cqCondition(qc *cloudhub.QueryConfig) influxql.Expr {
+	tags := make([]string, 0, len(qc.Tags))
+	for tag := range qc.Tags {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	op, join := influxql.NEQ, influxql.AND
+	if qc.AreTagsAccepted {
+		op, join = influxql.EQ, influxql.OR
+	}
+
+	var cond influxql.Expr
+	for _, tag := range tags {
+		var values influxql.Expr
+		for _, v := range qc.Tags[tag] {
+			expr := &influxql.BinaryExpr{
+				Op:  op,
+				LHS: &influxql.VarRef{Val: tag},
+				RHS: &influxql.StringLiteral{Val: v},
+			}
+			if values == nil {
+				values = expr
+			} else {
+				values = &influxql.BinaryExpr{Op: join, LHS: values, RHS: expr}
+			}
+		}
+		if values == nil {
+			continue
+		}
+		values = &influxql.ParenExpr{Expr: values}
+		if cond == nil {
+			cond = values
+		} else {
+			cond = &influxql.BinaryExpr{Op: influxql.AND, LHS: cond, RHS: values}
+		}
+	}
+	return cond
+}
+
+func cqFill(fill string) (influxql.FillOption, interface{}, error) {
+	switch strings.ToLower(fill) {
+	case "", "null":
+		return influxql.NullFill, nil, nil
+	case "none":
+		return influxql.NoFill, nil, nil
+	case "previous":
+		return influxql.PreviousFill, nil, nil
+	case "linear":
+		return influxql.LinearFill, nil, nil
+	}
+	if i, err := strconv.ParseInt(fill, 10, 64); err == nil {
+		return influxql.NumberFill, i, nil
+	}
+	if n, err := strconv.ParseFloat(fill, 64); err == nil {
+		return influxql.NumberFill, n, nil
+	}
+	return influxql.NullFill, nil, fmt.Errorf("invalid fill %s", fill)
+}
@@ -0,0 +1,251 @@
+package influx_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/influxdata/influxdb/influxql"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/influx"
+	"github.com/snetsystems/cloudhub/backend/log"
+)
+
+func TestBuildContinuousQuery(t *testing.T) {
+	raw := "SELECT mean(usage) FROM cpu"
+	tests := []struct {
+		name    string
+		qc      cloudhub.QueryConfig
+		target  influx.ContinuousQueryTarget
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "Aggregates of tags",
+			qc: cloudhub.QueryConfig{
+				Database:        "telegraf",
+				RetentionPolicy: "autogen",
+				Measurement:     "cpu",
+				Fields: []cloudhub.Field{
+					{Value: "mean", Type: "func", Args: []cloudhub.Field{{Value: "usage_user", Type: "field"}}},
+					{Value: "percentile", Type: "func", Alias: "p95", Args: []cloudhub.Field{{Value: "usage_user", Type: "field"}, {Value: "95", Type: "integer"}}},
+				},
+				Tags:            map[string][]string{"host": {"a", "b"}, "cpu": {"cpu-total"}},
+				AreTagsAccepted: true,
+				GroupBy:         cloudhub.GroupBy{Time: "1h", Tags: []string{"host"}},
+				Fill:            "none",
+			},
+			target: influx.ContinuousQueryTarget{RetentionPolicy: "rp_1y", Measurement: "cpu_1h", ResampleFor: "2h"},
+			want:   `CREATE CONTINUOUS QUERY cpu_1h ON telegraf RESAMPLE FOR 2h BEGIN SELECT mean(usage_user) AS mean_usage_user, percentile(usage_user, 95) AS p95 INTO telegraf.rp_1y.cpu_1h FROM telegraf.autogen.cpu WHERE (cpu = 'cpu-total') AND (host = 'a' OR host = 'b') GROUP BY time(1h), host fill(none) END`,
+		},
+		{
+			name: "Rejected tags and the default retention policy",
+			qc: cloudhub.QueryConfig{
+				Measurement: "disk",
+				Fields:      []cloudhub.Field{{Value: "max", Type: "func", Args: []cloudhub.Field{{Value: "used", Type: "field"}}}},
+				Tags:        map[string][]string{"path": {"/boot", "/run"}},
+				GroupBy:     cloudhub.GroupBy{Time: "5m"},
+				Fill:        "0",
+			},
+			target: influx.ContinuousQueryTarget{RetentionPolicy: "rp_5m"},
+			want:   `CREATE CONTINUOUS QUERY cpu_1h ON telegraf BEGIN SELECT max(used) AS max_used INTO telegraf.rp_5m.disk FROM telegraf..disk WHERE (path != '/boot' AND path != '/run') GROUP BY time(5m) fill(0) END`,
+		},
+		{
+			name: "Raw fields",
+			qc: cloudhub.QueryConfig{
+				Measurement: "cpu",
+				Fields:      []cloudhub.Field{{Value: "usage_user", Type: "field"}},
+				GroupBy:     cloudhub.GroupBy{Time: "1h"},
+			},
+			target:  influx.ContinuousQueryTarget{RetentionPolicy: "rp_1y"},
+			wantErr: true,
+		},
+		{
+			name: "No GROUP BY time",
+			qc: cloudhub.QueryConfig{
+				Measurement: "cpu",
+				Fields:      []cloudhub.Field{{Value: "mean", Type: "func", Args: []cloudhub.Field{{Value: "usage_user", Type: "field"}}}},
+				GroupBy:     cloudhub.GroupBy{Time: "auto"},
+			},
+			target:  influx.ContinuousQueryTarget{RetentionPolicy: "rp_1y"},
+			wantErr: true,
+		},
+		{
+			name: "No target retention policy",
+			qc: cloudhub.QueryConfig{
+				Measurement: "cpu",
+				Fields:      []cloudhub.Field{{Value: "mean", Type: "func", Args: []cloudhub.Field{{Value: "usage_user", Type: "field"}}}},
+				GroupBy:     cloudhub.GroupBy{Time: "1h"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Resample for shorter than the interval",
+			qc: cloudhub.QueryConfig{
+				Measurement: "cpu",
+				Fields:      []cloudhub.Field{{Value: "mean", Type: "func", Args: []cloudhub.Field{{Value: "usage_user", Type: "field"}}}},
+				GroupBy:     cloudhub.GroupBy{Time: "1h"},
+			},
+			target:  influx.ContinuousQueryTarget{RetentionPolicy: "rp_1y", ResampleFor: "30m"},
+			wantErr: true,
+		},
+		{
+			name:    "Raw query",
+			qc:      cloudhub.QueryConfig{RawText: &raw},
+			target:  influx.ContinuousQueryTarget{RetentionPolicy: "rp_1y"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := influx.BuildContinuousQuery("cpu_1h", "telegraf", &tt.qc, tt.target)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("BuildContinuousQuery() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("BuildContinuousQuery() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseContinuousQuery(t *testing.T) {
+	tests := []struct {
+		query   string
+		wantErr bool
+	}{
+		{query: `CREATE CONTINUOUS QUERY "cq" ON "telegraf" BEGIN SELECT mean(usage) INTO "rp_1h"."cpu" FROM "cpu" GROUP BY time(1h), * END`},
+		{query: `CREATE CONTINUOUS QUERY cq ON telegraf BEGIN SELECT mean(usage) INTO cpu_1h FROM cpu END`, wantErr: true},
+		{query: `CREATE CONTINUOUS QUERY cq ON telegraf BEGIN SELECT mean(usage) FROM cpu GROUP BY time(1h) END`, wantErr: true},
+		{query: `SELECT mean(usage) INTO cpu_1h FROM cpu GROUP BY time(1h)`, wantErr: true},
+	}
+	for _, tt := range tests {
+		if _, err := influx.ParseContinuousQuery(tt.query); (err != nil) != tt.wantErr {
+			t.Errorf("ParseContinuousQuery(%q) error = %v, wantErr %v", tt.query, err, tt.wantErr)
+		}
+	}
+}
+
+// cqServer is an InfluxDB that keeps the continuous queries of telegraf
+func cqServer(t *testing.T) (*httptest.Server, map[string]string) {
+	var mu sync.Mutex
+	cqs := map[string]string{}
+	result := func(w http.ResponseWriter, res interface{}) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"results": []interface{}{res}})
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		stmt, err := influxql.ParseStatement(r.FormValue("q"))
+		if err != nil {
+			t.Errorf("invalid query %q: %v", r.FormValue("q"), err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch s := stmt.(type) {
+		case *influxql.ShowContinuousQueriesStatement:
+			names := []string{}
+			for name := range cqs {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			values := [][]string{}
+			for _, name := range names {
+				values = append(values, []string{name, cqs[name]})
+			}
+			result(w, map[string]interface{}{"series": []interface{}{
+				map[string]interface{}{"name": "_internal", "columns": []string{"name", "query"}, "values": [][]string{{"cq_internal", "CREATE CONTINUOUS QUERY cq_internal ON _internal BEGIN SELECT count(n) INTO m FROM n GROUP BY time(1h) END"}}},
+				map[string]interface{}{"name": "telegraf", "columns": []string{"name", "query"}, "values": values},
+			}})
+		case *influxql.CreateContinuousQueryStatement:
+			if _, ok := cqs[s.Name]; ok {
+				result(w, map[string]string{"error": "continuous query already exists"})
+			} else if s.Source.Target.Measurement.RetentionPolicy == "missing" {
+				result(w, map[string]string{"error": "retention policy not found: missing"})
+			} else {
+				cqs[s.Name] = s.String()
+				result(w, map[string]interface{}{})
+			}
+		case *influxql.DropContinuousQueryStatement:
+			if _, ok := cqs[s.Name]; !ok {
+				result(w, map[string]string{"error": "continuous query not found"})
+			} else {
+				delete(cqs, s.Name)
+				result(w, map[string]interface{}{})
+			}
+		default:
+			t.Errorf("unexpected query %q", r.FormValue("q"))
+		}
+	})), cqs
+}
+
+func TestClient_ContinuousQueries(t *testing.T) {
+	ts, cqs := cqServer(t)
+	defer ts.Close()
+
+	client, err := NewClient(ts.URL, log.New(log.DebugLevel))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	query := `CREATE CONTINUOUS QUERY cq_1h ON telegraf BEGIN SELECT mean(usage) AS mean_usage INTO telegraf.rp_1y.cpu FROM telegraf.autogen.cpu GROUP BY time(1h) END`
+	cq, err := client.CreateCQ(ctx, "telegraf", &cloudhub.ContinuousQuery{Name: "cq_1h", Query: query})
+	if err != nil {
+		t.Fatalf("CreateCQ() error = %v", err)
+	}
+	if cq.Name != "cq_1h" || cq.Query != query {
+		t.Errorf("CreateCQ() = %+v", cq)
+	}
+	if _, err := client.CreateCQ(ctx, "telegraf", &cloudhub.ContinuousQuery{Name: "cq_1h", Query: query}); err == nil {
+		t.Error("CreateCQ() of an existing continuous query expected error")
+	}
+
+	all, err := client.AllCQ(ctx, "telegraf")
+	if err != nil {
+		t.Fatalf("AllCQ() error = %v", err)
+	}
+	if len(all) != 1 || all[0].Name != "cq_1h" {
+		t.Errorf("AllCQ() = %+v, want only cq_1h", all)
+	}
+
+	// A failed update leaves the continuous query as it was
+	bad := `CREATE CONTINUOUS QUERY cq_1h ON telegraf BEGIN SELECT mean(usage) AS mean_usage INTO telegraf.missing.cpu FROM telegraf.autogen.cpu GROUP BY time(1h) END`
+	if _, err := client.UpdateCQ(ctx, "telegraf", "cq_1h", &cloudhub.ContinuousQuery{Name: "cq_1h", Query: bad}); err == nil {
+		t.Error("UpdateCQ() into a missing retention policy expected error")
+	}
+	if cqs["cq_1h"] != query {
+		t.Errorf("UpdateCQ() failure left %q, want %q", cqs["cq_1h"], query)
+	}
+
+	renamed := `CREATE CONTINUOUS QUERY cq_2h ON telegraf BEGIN SELECT mean(usage) AS mean_usage INTO telegraf.rp_1y.cpu FROM telegraf.autogen.cpu GROUP BY time(2h) END`
+	cq, err = client.UpdateCQ(ctx, "telegraf", "cq_1h", &cloudhub.ContinuousQuery{Name: "cq_2h", Query: renamed})
+	if err != nil {
+		t.Fatalf("UpdateCQ() error = %v", err)
+	}
+	if cq.Name != "cq_2h" || len(cqs) != 1 {
+		t.Errorf("UpdateCQ() = %+v, stored %v", cq, cqs)
+	}
+
+	if err := client.DropCQ(ctx, "telegraf", "cq_2h"); err != nil {
+		t.Fatalf("DropCQ() error = %v", err)
+	}
+	if err := client.DropCQ(ctx, "telegraf", "cq_2h"); err == nil {
+		t.Error("DropCQ() of a missing continuous query expected error")
+	}
+	if len(cqs) != 0 {
+		t.Errorf("DropCQ() left %v", cqs)
+	}
+}
+
+func TestClient_ContinuousQueriesV2(t *testing.T) {
+	client := &influx.Client{Org: "cloudhub"}
+	if _, err := client.AllCQ(context.Background(), "telegraf"); err == nil {
+		t.Error("AllCQ() of InfluxDB 2.x expected error")
+	}
+}
@@ -9,13 +9,20 @@ import (
 	cloudhub "github.com/snetsystems/cloudhub/backend"
 )
 
-// AllDB returns all databases from within Influx
+// AllDB returns all databases from within Influx, or the databases mapped to
+// the buckets of InfluxDB 2.x
 func (c *Client) AllDB(ctx context.Context) ([]cloudhub.Database, error) {
+	if c.Org != "" {
+		return c.allBucketDBs(ctx)
+	}
 	return c.showDatabases(ctx)
 }
 
 // CreateDB creates a database within Influx
 func (c *Client) CreateDB(ctx context.Context, db *cloudhub.Database) (*cloudhub.Database, error) {
+	if c.Org != "" {
+		return c.createBucketDB(ctx, db)
+	}
 	_, err := c.Query(ctx, cloudhub.Query{
 		Command: fmt.Sprintf(`CREATE DATABASE "%s"`, db.Name),
 	})
@@ -30,6 +37,9 @@ func (c *Client) CreateDB(ctx context.Context, db *cloudhub.Database) (*cloudhub
 
 // DropDB drops a database within Influx
 func (c *Client) DropDB(ctx context.Context, db string) error {
+	if c.Org != "" {
+		return c.dropBucketDB(ctx, db)
+	}
 	_, err := c.Query(ctx, cloudhub.Query{
 		Command: fmt.Sprintf(`DROP DATABASE "%s"`, db),
 		DB:      db,
@@ -42,6 +52,9 @@ func (c *Client) DropDB(ctx context.Context, db string) error {
 
 // AllRP returns all the retention policies for a specific database
 func (c *Client) AllRP(ctx context.Context, db string) ([]cloudhub.RetentionPolicy, error) {
+	if c.Org != "" {
+		return c.allBucketRPs(ctx, db)
+	}
 	return c.showRetentionPolicies(ctx, db)
 }
 
@@ -61,6 +74,9 @@ func (c *Client) getRP(ctx context.Context, db, rp string) (cloudhub.RetentionPo
 
 // CreateRP creates a retention policy for a specific database
 func (c *Client) CreateRP(ctx context.Context, db string, rp *cloudhub.RetentionPolicy) (*cloudhub.RetentionPolicy, error) {
+	if c.Org != "" {
+		return c.createBucketRP(ctx, db, rp)
+	}
 	query := fmt.Sprintf(`CREATE RETENTION POLICY "%s" ON "%s" DURATION %s REPLICATION %d`, rp.Name, db, rp.Duration, rp.Replication)
 	if len(rp.ShardDuration) != 0 {
 		query = fmt.Sprintf(`%s SHARD DURATION %s`, query, rp.ShardDuration)
@@ -88,6 +104,9 @@ func (c *Client) CreateRP(ctx context.Context, db string, rp *cloudhub.Retention
 
 // UpdateRP updates a specific retention policy for a specific database
 func (c *Client) UpdateRP(ctx context.Context, db string, rp string, upd *cloudhub.RetentionPolicy) (*cloudhub.RetentionPolicy, error) {
+	if c.Org != "" {
+		return c.updateBucketRP(ctx, db, rp, upd)
+	}
 	var buffer bytes.Buffer
 	buffer.WriteString(fmt.Sprintf(`ALTER RETENTION POLICY "%s" ON "%s"`, rp, db))
 	if len(upd.Duration) > 0 {
@@ -112,24 +131,10 @@ func (c *Client) UpdateRP(ctx context.Context, db string, rp string, upd *cloudh
 	}
 
 	// The ALTER RETENTION POLICIES statements puts the error within the results itself
-	// So, we have to crack open the results to see what happens
-	octets, err := queryRes.MarshalJSON()
-	if err != nil {
-		return nil, err
-	}
-
-	results := make([]struct{ Error string }, 0)
-	if err := json.Unmarshal(octets, &results); err != nil {
+	if err := resultsError(queryRes); err != nil {
 		return nil, err
 	}
 
-	// At last, we can check if there are any error strings
-	for _, r := range results {
-		if r.Error != "" {
-			return nil, fmt.Errorf(r.Error)
-		}
-	}
-
 	res, err := c.getRP(ctx, db, upd.Name)
 	if err != nil {
 		return nil, err
@@ -140,6 +145,9 @@ func (c *Client) UpdateRP(ctx context.Context, db string, rp string, upd *cloudh
 
 // DropRP removes a specific retention policy for a specific database
 func (c *Client) DropRP(ctx context.Context, db string, rp string) error {
+	if c.Org != "" {
+		return c.dropBucketRP(ctx, db, rp)
+	}
 	_, err := c.Query(ctx, cloudhub.Query{
 		Command: fmt.Sprintf(`DROP RETENTION POLICY "%s" ON "%s"`, rp, db),
 		DB:      db,
@@ -151,6 +159,94 @@ func (c *Client) DropRP(ctx context.Context, db string, rp string) error {
 	return nil
 }
 
+// errContinuousQueriesV2 is returned for continuous queries of InfluxDB 2.x
+// sources, which downsample with tasks instead.
+var errContinuousQueriesV2 = fmt.Errorf("continuous queries are not supported by InfluxDB 2.x; use tasks to downsample")
+
+// AllCQ returns all the continuous queries of a specific database
+func (c *Client) AllCQ(ctx context.Context, db string) ([]cloudhub.ContinuousQuery, error) {
+	if c.Org != "" {
+		return nil, errContinuousQueriesV2
+	}
+	return c.showContinuousQueries(ctx, db)
+}
+
+func (c *Client) getCQ(ctx context.Context, db, name string) (cloudhub.ContinuousQuery, error) {
+	cqs, err := c.AllCQ(ctx, db)
+	if err != nil {
+		return cloudhub.ContinuousQuery{}, err
+	}
+
+	for _, cq := range cqs {
+		if cq.Name == name {
+			return cq, nil
+		}
+	}
+	return cloudhub.ContinuousQuery{}, fmt.Errorf("unknown continuous query")
+}
+
+// CreateCQ creates a continuous query for a specific database. The query is
+// the CREATE CONTINUOUS QUERY statement; the continuous query returned has
+// the statement as InfluxDB stored it.
+func (c *Client) CreateCQ(ctx context.Context, db string, cq *cloudhub.ContinuousQuery) (*cloudhub.ContinuousQuery, error) {
+	if c.Org != "" {
+		return nil, errContinuousQueriesV2
+	}
+	res, err := c.Query(ctx, cloudhub.Query{
+		Command: cq.Query,
+		DB:      db,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := resultsError(res); err != nil {
+		return nil, err
+	}
+
+	created, err := c.getCQ(ctx, db, cq.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// UpdateCQ replaces a continuous query of a specific database. InfluxDB
+// cannot alter continuous queries, so the old one is dropped and the new one
+// created; if the creation fails the old one is created again.
+func (c *Client) UpdateCQ(ctx context.Context, db string, name string, upd *cloudhub.ContinuousQuery) (*cloudhub.ContinuousQuery, error) {
+	old, err := c.getCQ(ctx, db, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.DropCQ(ctx, db, name); err != nil {
+		return nil, err
+	}
+
+	res, err := c.CreateCQ(ctx, db, upd)
+	if err != nil {
+		if _, restoreErr := c.CreateCQ(ctx, db, &old); restoreErr != nil {
+			return nil, fmt.Errorf("%v; restoring continuous query %s: %v", err, name, restoreErr)
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+// DropCQ removes a continuous query of a specific database
+func (c *Client) DropCQ(ctx context.Context, db string, name string) error {
+	if c.Org != "" {
+		return errContinuousQueriesV2
+	}
+	res, err := c.Query(ctx, cloudhub.Query{
+		Command: fmt.Sprintf(`DROP CONTINUOUS QUERY "%s" ON "%s"`, name, db),
+		DB:      db,
+	})
+	if err != nil {
+		return err
+	}
+	return resultsError(res)
+}
+
 // GetMeasurements returns measurements in a specified database, paginated by
 // optional limit and offset. If no limit or offset is provided, it defaults to
 // a limit of 100 measurements with no offset.
@@ -210,15 +306,26 @@ func (c *Client) showMeasurements(ctx context.Context, db string, limit, offset
 		show += fmt.Sprintf(" OFFSET %d", offset)
 	}
 
-	measurements, err := c.Query(ctx, cloudhub.Query{
+	results, err := c.schemaQuery(ctx, cloudhub.Query{
 		Command: show,
 		DB:      db,
 	})
+	if err != nil {
+		return nil, err
+	}
 
+	return results.Measurements(), nil
+}
+
+func (c *Client) showContinuousQueries(ctx context.Context, db string) ([]cloudhub.ContinuousQuery, error) {
+	cqs, err := c.Query(ctx, cloudhub.Query{
+		Command: `SHOW CONTINUOUS QUERIES`,
+		DB:      db,
+	})
 	if err != nil {
 		return nil, err
 	}
-	octets, err := measurements.MarshalJSON()
+	octets, err := cqs.MarshalJSON()
 	if err != nil {
 		return nil, err
 	}
@@ -228,5 +335,26 @@ func (c *Client) showMeasurements(ctx context.Context, db string, limit, offset
 		return nil, err
 	}
 
-	return results.Measurements(), nil
+	return results.ContinuousQueries(db), nil
+}
+
+// resultsError returns the first error InfluxDB put within the results of
+// statements; it answers them with a 200 status code.
+func resultsError(res cloudhub.Response) error {
+	octets, err := res.MarshalJSON()
+	if err != nil {
+		return err
+	}
+
+	results := make([]struct{ Error string }, 0)
+	if err := json.Unmarshal(octets, &results); err != nil {
+		return err
+	}
+
+	for _, r := range results {
+		if r.Error != "" {
+			return fmt.Errorf(r.Error)
+		}
+	}
+	return nil
 }
@@ -0,0 +1,136 @@
+package influx
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/influxdata/influxdb/influxql"
+)
+
+// QueryLimits bound the cost of the SELECT statements of an InfluxQL query.
+// Zero values do not limit.
+type QueryLimits struct {
+	MaxDuration       time.Duration // MaxDuration is the longest time range of a statement
+	RequireTimeBounds bool          // RequireTimeBounds rejects statements without a lower time bound
+	MaxWildcardSeries int           // MaxWildcardSeries is the largest SLIMIT of a GROUP BY * statement, which must set one
+	MaxPoints         int64         // MaxPoints is the largest estimate of the points of a statement
+	RawInterval       time.Duration // RawInterval is the expected interval of stored points used to estimate raw queries
+}
+
+// QueryRejectedError explains why a query is too costly to be sent to InfluxDB
+type QueryRejectedError struct {
+	Statement string
+	Reason    string
+}
+
+func (e *QueryRejectedError) Error() string {
+	return fmt.Sprintf("query rejected: %s: %s", e.Reason, e.Statement)
+}
+
+// Check returns a QueryRejectedError when a statement of the query is beyond
+// the limits. As their cost cannot be told, queries that do not parse are
+// rejected unless there are no limits.
+func (l QueryLimits) Check(influxQL string, now time.Time) error {
+	q, err := influxql.ParseQuery(influxQL)
+	if err != nil {
+		if !l.limited() {
+			return nil
+		}
+		return &QueryRejectedError{
+			Statement: influxQL,
+			Reason:    fmt.Sprintf("unable to parse the query to check its cost: %v", err),
+		}
+	}
+	for _, stmt := range q.Statements {
+		sel, ok := stmt.(*influxql.SelectStatement)
+		if !ok {
+			continue
+		}
+		if reason := l.check(sel, now); reason != "" {
+			return &QueryRejectedError{
+				Statement: sel.String(),
+				Reason:    reason,
+			}
+		}
+	}
+	return nil
+}
+
+// limited reports whether any limit is set
+func (l QueryLimits) limited() bool {
+	return l.MaxDuration > 0 || l.RequireTimeBounds || l.MaxWildcardSeries > 0 || l.MaxPoints > 0
+}
+
+func (l QueryLimits) check(sel *influxql.SelectStatement, now time.Time) string {
+	var cond influxql.Expr
+	if sel.Condition != nil {
+		cond = influxql.Reduce(sel.Condition, &influxql.NowValuer{Now: now})
+	}
+	tmin, tmax, err := influxql.TimeRange(cond)
+	if err != nil {
+		return err.Error()
+	}
+
+	if tmin.IsZero() {
+		if l.RequireTimeBounds {
+			return "a lower time bound is required, e.g. WHERE time > now() - 1h"
+		}
+		// Without a lower bound every point since the first one is read
+		if l.MaxDuration > 0 {
+			return fmt.Sprintf("time range must be at most %s; add a lower time bound, e.g. WHERE time > now() - 1h", shortDur(l.MaxDuration))
+		}
+	}
+	if tmax.IsZero() {
+		tmax = now
+	}
+	dur := tmax.Sub(tmin)
+	if tmin.IsZero() || dur < 0 {
+		dur = 0
+	}
+	if l.MaxDuration > 0 && dur > l.MaxDuration {
+		return fmt.Sprintf("time range of %s is longer than %s", shortDur(dur.Round(time.Second)), shortDur(l.MaxDuration))
+	}
+
+	series := int64(1)
+	if sel.HasDimensionWildcard() && l.MaxWildcardSeries > 0 {
+		if sel.SLimit == 0 || sel.SLimit > l.MaxWildcardSeries {
+			return fmt.Sprintf("GROUP BY * must limit its series with SLIMIT %d or less", l.MaxWildcardSeries)
+		}
+	}
+	if sel.SLimit > 0 {
+		series = int64(sel.SLimit)
+	}
+
+	if l.MaxPoints > 0 && dur > 0 {
+		if points := l.points(sel, dur) * series; points > l.MaxPoints {
+			return fmt.Sprintf("about %d points would be returned, more than %d; use a shorter time range or a longer GROUP BY time interval", points, l.MaxPoints)
+		}
+	}
+	return ""
+}
+
+// points estimates the points of each series of a statement over dur
+func (l QueryLimits) points(sel *influxql.SelectStatement, dur time.Duration) int64 {
+	fields := int64(len(sel.Fields))
+
+	interval, err := sel.GroupByInterval()
+	switch {
+	case err != nil:
+		return 0
+	case interval > 0:
+		return windows(dur, interval) * fields
+	case !sel.IsRawQuery:
+		// Aggregates without GROUP BY time return a point per series
+		return fields
+	case sel.Limit > 0:
+		return int64(sel.Limit) * fields
+	case l.RawInterval > 0:
+		return windows(dur, l.RawInterval) * fields
+	}
+	return 0
+}
+
+// windows counts the intervals touched by dur
+func windows(dur, interval time.Duration) int64 {
+	return int64((dur + interval - 1) / interval)
+}
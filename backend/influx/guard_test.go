@@ -0,0 +1,138 @@
+package influx
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueryLimits_Check(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		limits QueryLimits
+		query  string
+		reason string // reason is part of the rejection; empty when accepted
+	}{
+		{
+			name:   "No limits",
+			query:  `SELECT * FROM "cpu"`,
+			reason: "",
+		},
+		{
+			name:   "Unparsable without limits",
+			query:  `SELECT FROM WHERE`,
+			reason: "",
+		},
+		{
+			name:   "Unparsable with limits",
+			limits: QueryLimits{MaxPoints: 10000},
+			query:  `SELECT FROM WHERE`,
+			reason: "unable to parse the query",
+		},
+		{
+			name:   "Time bounds required",
+			limits: QueryLimits{RequireTimeBounds: true},
+			query:  `SELECT "usage_user" FROM "cpu" WHERE "host" = 'a'`,
+			reason: "a lower time bound is required",
+		},
+		{
+			name:   "Upper bound only",
+			limits: QueryLimits{RequireTimeBounds: true},
+			query:  `SELECT "usage_user" FROM "cpu" WHERE time < now()`,
+			reason: "a lower time bound is required",
+		},
+		{
+			name:   "Bounded",
+			limits: QueryLimits{RequireTimeBounds: true, MaxDuration: 24 * time.Hour},
+			query:  `SELECT "usage_user" FROM "cpu" WHERE time > now() - 1h`,
+			reason: "",
+		},
+		{
+			name:   "Time range too long",
+			limits: QueryLimits{MaxDuration: 24 * time.Hour},
+			query:  `SELECT mean("usage_user") FROM "cpu" WHERE time > now() - 30d GROUP BY time(1h)`,
+			reason: "time range of 720h is longer than 24h",
+		},
+		{
+			name:   "Absolute time range too long",
+			limits: QueryLimits{MaxDuration: 24 * time.Hour},
+			query:  `SELECT mean("usage_user") FROM "cpu" WHERE time > '2019-12-01T00:00:00Z' AND time < '2019-12-03T00:00:00Z' GROUP BY time(1h)`,
+			reason: "time range of 48h is longer than 24h",
+		},
+		{
+			name:   "Unbounded with max duration",
+			limits: QueryLimits{MaxDuration: 24 * time.Hour},
+			query:  `SELECT "usage_user" FROM "cpu"`,
+			reason: "time range must be at most 24h",
+		},
+		{
+			name:   "Only statements beyond the limits are rejected",
+			limits: QueryLimits{MaxDuration: 24 * time.Hour},
+			query:  `SHOW DATABASES; SELECT "usage_user" FROM "cpu" WHERE time > now() - 1h`,
+			reason: "",
+		},
+		{
+			name:   "GROUP BY * without SLIMIT",
+			limits: QueryLimits{MaxWildcardSeries: 100},
+			query:  `SELECT last("usage_user") FROM "cpu" WHERE time > now() - 1h GROUP BY *`,
+			reason: "GROUP BY * must limit its series with SLIMIT 100 or less",
+		},
+		{
+			name:   "GROUP BY * over SLIMIT",
+			limits: QueryLimits{MaxWildcardSeries: 100},
+			query:  `SELECT last("usage_user") FROM "cpu" WHERE time > now() - 1h GROUP BY * SLIMIT 1000`,
+			reason: "GROUP BY * must limit its series",
+		},
+		{
+			name:   "GROUP BY * within SLIMIT",
+			limits: QueryLimits{MaxWildcardSeries: 100},
+			query:  `SELECT last("usage_user") FROM "cpu" WHERE time > now() - 1h GROUP BY * SLIMIT 50`,
+			reason: "",
+		},
+		{
+			name:   "Too many points",
+			limits: QueryLimits{MaxPoints: 10000},
+			query:  `SELECT mean("usage_user"), mean("usage_system") FROM "cpu" WHERE time > now() - 7d GROUP BY time(1m)`,
+			reason: "about 20160 points would be returned, more than 10000",
+		},
+		{
+			name:   "Points of SLIMIT series",
+			limits: QueryLimits{MaxPoints: 10000},
+			query:  `SELECT mean("usage_user") FROM "cpu" WHERE time > now() - 1d GROUP BY time(1m), "host" SLIMIT 10`,
+			reason: "about 14400 points would be returned",
+		},
+		{
+			name:   "Aggregate without GROUP BY time",
+			limits: QueryLimits{MaxPoints: 10},
+			query:  `SELECT max("usage_user") FROM "cpu" WHERE time > now() - 30d`,
+			reason: "",
+		},
+		{
+			name:   "Raw points",
+			limits: QueryLimits{MaxPoints: 10000, RawInterval: 10 * time.Second},
+			query:  `SELECT "usage_user" FROM "cpu" WHERE time > now() - 2d`,
+			reason: "about 17280 points would be returned",
+		},
+		{
+			name:   "Raw points with LIMIT",
+			limits: QueryLimits{MaxPoints: 10000, RawInterval: 10 * time.Second},
+			query:  `SELECT "usage_user" FROM "cpu" WHERE time > now() - 7d LIMIT 100`,
+			reason: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.limits.Check(tt.query, now)
+			if tt.reason == "" {
+				if err != nil {
+					t.Errorf("QueryLimits.Check() = %v, want nil", err)
+				}
+				return
+			}
+			if _, ok := err.(*QueryRejectedError); !ok || !strings.Contains(err.Error(), tt.reason) {
+				t.Errorf("QueryLimits.Check() = %v, want rejection %q", err, tt.reason)
+			}
+		})
+	}
+}
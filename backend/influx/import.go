@@ -0,0 +1,307 @@
+package influx
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb/models"
+)
+
+// maxImportLine is the longest line of line protocol of an import
+const maxImportLine = 1 << 20
+
+// ImportLine is a line of line protocol of an import. Err is the reason the
+// input of the line cannot be converted to line protocol.
+type ImportLine struct {
+	Number int
+	Text   string
+	Err    error
+}
+
+// LineReader reads the lines of an import one at a time
+type LineReader interface {
+	// Read returns the next line, or io.EOF after the last one
+	Read() (ImportLine, error)
+}
+
+// ImportPrecision is the precision InfluxDB 1.x knows of the precision of
+// the times of an import
+func ImportPrecision(precision string) (string, error) {
+	switch precision {
+	case "", "n", "ns":
+		return "n", nil
+	case "u", "us":
+		return "u", nil
+	case "ms", "s", "m", "h":
+		return precision, nil
+	}
+	return "", fmt.Errorf("invalid precision %s; must be ns, us, ms, s, m or h", precision)
+}
+
+// ValidateLine checks a line of line protocol is a single valid point with a
+// time of precision, as InfluxDB parses writes
+func ValidateLine(text, precision string) error {
+	text = strings.TrimSpace(text)
+	points, err := models.ParsePointsWithPrecision([]byte(text), time.Now().UTC(), precision)
+	if err != nil {
+		return fmt.Errorf("%s", strings.TrimPrefix(err.Error(), "unable to parse '"+text+"': "))
+	}
+	if len(points) != 1 {
+		return fmt.Errorf("a line must have exactly one point")
+	}
+	return nil
+}
+
+type lineProtocolReader struct {
+	r      *bufio.Reader
+	number int
+}
+
+// NewLineProtocolReader reads the lines of line protocol of r. Empty lines
+// and comments are skipped.
+func NewLineProtocolReader(r io.Reader) LineReader {
+	return &lineProtocolReader{r: bufio.NewReaderSize(r, 64*1024)}
+}
+
+func (l *lineProtocolReader) Read() (ImportLine, error) {
+	for {
+		text, tooLong, err := l.readLine()
+		if err != nil {
+			return ImportLine{}, err
+		}
+		l.number++
+		if tooLong {
+			return ImportLine{
+				Number: l.number,
+				Err:    fmt.Errorf("line is longer than %d bytes", maxImportLine),
+			}, nil
+		}
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		return ImportLine{Number: l.number, Text: trimmed}, nil
+	}
+}
+
+// readLine reads a line without holding more than maxImportLine bytes of it
+func (l *lineProtocolReader) readLine() (string, bool, error) {
+	var line bytes.Buffer
+	tooLong := false
+	for {
+		chunk, err := l.r.ReadSlice('\n')
+		if !tooLong {
+			if line.Len()+len(chunk) > maxImportLine {
+				tooLong = true
+				line.Reset()
+			} else {
+				line.Write(chunk)
+			}
+		}
+		switch {
+		case err == bufio.ErrBufferFull:
+			continue
+		case err == io.EOF && (line.Len() > 0 || tooLong):
+			return line.String(), tooLong, nil
+		case err != nil:
+			return "", false, err
+		}
+		return line.String(), tooLong, nil
+	}
+}
+
+// CSVOptions are the meanings of the columns of an import of CSV
+type CSVOptions struct {
+	Measurement string   // Measurement of rows without a measurement column
+	Tags        []string // Tags are the columns of tags; other columns are fields
+	Precision   string   // Precision of the times of the rows as ImportPrecision has it
+}
+
+// Columns of CSV of the measurement and time of a row
+var (
+	csvMeasurementColumns = []string{"measurement", "_measurement", "name"}
+	csvTimeColumns        = []string{"time", "_time"}
+)
+
+type csvReader struct {
+	r           *csv.Reader
+	opts        CSVOptions
+	columns     []string
+	tags        map[int]bool
+	measurement int
+	time        int
+	number      int
+}
+
+// NewCSVReader converts the rows of CSV of r to lines of line protocol.
+// The first row has the names of the columns: the measurement, the time, the
+// tags of opts and fields. Times are integers of the precision of opts or
+// RFC3339. Fields are floats, integers and unsigned integers with an i or u
+// suffix, booleans or strings.
+func NewCSVReader(r io.Reader, opts CSVOptions) (LineReader, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("CSV has no header")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &csvReader{
+		r:           cr,
+		opts:        opts,
+		columns:     append([]string{}, header...),
+		tags:        map[int]bool{},
+		measurement: -1,
+		time:        -1,
+		number:      1,
+	}
+	tags := map[string]bool{}
+	for _, t := range opts.Tags {
+		tags[t] = true
+	}
+	for i, name := range c.columns {
+		switch {
+		case c.measurement < 0 && contains(csvMeasurementColumns, name):
+			c.measurement = i
+		case c.time < 0 && contains(csvTimeColumns, name):
+			c.time = i
+		case tags[name]:
+			c.tags[i] = true
+			delete(tags, name)
+		}
+	}
+	if c.measurement < 0 && opts.Measurement == "" {
+		return nil, fmt.Errorf("CSV has no measurement column and no measurement was given")
+	}
+	for t := range tags {
+		return nil, fmt.Errorf("CSV has no tag column %s", t)
+	}
+	if len(c.columns)-len(c.tags) <= boolInt(c.measurement >= 0)+boolInt(c.time >= 0) {
+		return nil, fmt.Errorf("CSV has no field columns")
+	}
+	return c, nil
+}
+
+func (c *csvReader) Read() (ImportLine, error) {
+	record, err := c.r.Read()
+	if err == io.EOF {
+		return ImportLine{}, err
+	}
+	c.number++
+	if perr, ok := err.(*csv.ParseError); ok {
+		return ImportLine{Number: c.number, Err: perr.Err}, nil
+	}
+	if err != nil {
+		return ImportLine{}, err
+	}
+	if len(record) != len(c.columns) {
+		return ImportLine{
+			Number: c.number,
+			Err:    fmt.Errorf("row has %d columns; the header has %d", len(record), len(c.columns)),
+		}, nil
+	}
+	text, err := c.line(record)
+	return ImportLine{Number: c.number, Text: text, Err: err}, nil
+}
+
+// line converts a row to line protocol
+func (c *csvReader) line(record []string) (string, error) {
+	measurement := c.opts.Measurement
+	if c.measurement >= 0 && record[c.measurement] != "" {
+		measurement = record[c.measurement]
+	}
+	if measurement == "" {
+		return "", fmt.Errorf("row has no measurement")
+	}
+
+	var b strings.Builder
+	b.WriteString(escapeMeasurement.Replace(measurement))
+	for i, name := range c.columns {
+		if c.tags[i] && record[i] != "" {
+			fmt.Fprintf(&b, ",%s=%s", escapeKeys.Replace(name), escapeTagValues.Replace(record[i]))
+		}
+	}
+
+	sep := " "
+	for i, name := range c.columns {
+		if c.tags[i] || i == c.measurement || i == c.time || record[i] == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "%s%s=%s", sep, escapeKeys.Replace(name), csvField(record[i]))
+		sep = ","
+	}
+	if sep == " " {
+		return "", fmt.Errorf("row has no fields")
+	}
+
+	if c.time >= 0 && record[c.time] != "" {
+		ts, err := csvTime(record[c.time], c.opts.Precision)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, " %d", ts)
+	}
+	return b.String(), nil
+}
+
+// csvField is the line protocol of the value of a field of CSV
+func csvField(value string) string {
+	switch value {
+	case "t", "T", "true", "True", "TRUE", "f", "F", "false", "False", "FALSE":
+		return value
+	}
+	if strings.HasSuffix(value, "i") {
+		if _, err := strconv.ParseInt(value[:len(value)-1], 10, 64); err == nil {
+			return value
+		}
+	}
+	if strings.HasSuffix(value, "u") {
+		if _, err := strconv.ParseUint(value[:len(value)-1], 10, 64); err == nil {
+			return value
+		}
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+		return value
+	}
+	return `"` + escapeFieldStrings.Replace(value) + `"`
+}
+
+// csvTime is the time of a row in units of precision
+func csvTime(value, precision string) (int64, error) {
+	if ts, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return ts, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q; must be an integer or RFC3339", value)
+	}
+	return t.UnixNano() / models.GetPrecisionMultiplier(precision), nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,136 @@
+package influx_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/snetsystems/cloudhub/backend/influx"
+)
+
+func readLines(t *testing.T, r influx.LineReader) []influx.ImportLine {
+	t.Helper()
+	var lines []influx.ImportLine
+	for {
+		line, err := r.Read()
+		if err == io.EOF {
+			return lines
+		}
+		if err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+		lines = append(lines, line)
+	}
+}
+
+func TestLineProtocolReader(t *testing.T) {
+	input := "# comment\ncpu,host=a usage=1 1000\r\n\n  mem used=2i\ncpu usage=3"
+	lines := readLines(t, influx.NewLineProtocolReader(strings.NewReader(input)))
+
+	want := []influx.ImportLine{
+		{Number: 2, Text: "cpu,host=a usage=1 1000"},
+		{Number: 4, Text: "mem used=2i"},
+		{Number: 5, Text: "cpu usage=3"},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("Read() lines = %v, want %v", lines, want)
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("Read() line %d = %v, want %v", i, lines[i], want[i])
+		}
+	}
+}
+
+func TestValidateLine(t *testing.T) {
+	tests := []struct {
+		line      string
+		precision string
+		wantErr   bool
+	}{
+		{line: "cpu,host=a usage=1,idle=2i 1000", precision: "n"},
+		{line: `cpu msg="hello world"`, precision: "n"},
+		{line: "cpu usage=1 1546300800", precision: "s"},
+		{line: "cpu", precision: "n", wantErr: true},
+		{line: "cpu usage=", precision: "n", wantErr: true},
+		{line: "cpu usage=1 notatime", precision: "n", wantErr: true},
+		{line: "cpu usage=1 9223372036854775807", precision: "s", wantErr: true},
+	}
+	for _, tt := range tests {
+		err := influx.ValidateLine(tt.line, tt.precision)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ValidateLine(%q) error = %v, wantErr %v", tt.line, err, tt.wantErr)
+		}
+	}
+}
+
+func TestImportPrecision(t *testing.T) {
+	for in, want := range map[string]string{"": "n", "ns": "n", "us": "u", "ms": "ms", "h": "h"} {
+		if got, err := influx.ImportPrecision(in); err != nil || got != want {
+			t.Errorf("ImportPrecision(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+	if _, err := influx.ImportPrecision("d"); err == nil {
+		t.Error("ImportPrecision(d) expected error")
+	}
+}
+
+func TestCSVReader(t *testing.T) {
+	input := `name,host,time,usage,state
+cpu,a,2019-01-01T00:00:00Z,1.5,ok
+cpu,b c,1546300810,2i,
+,a,,true,"say ""hi"""
+cpu,a,yesterday,1,ok
+cpu,a
+`
+	r, err := influx.NewCSVReader(strings.NewReader(input), influx.CSVOptions{
+		Measurement: "default",
+		Tags:        []string{"host"},
+		Precision:   "s",
+	})
+	if err != nil {
+		t.Fatalf("NewCSVReader() error = %v", err)
+	}
+	lines := readLines(t, r)
+	if len(lines) != 5 {
+		t.Fatalf("Read() lines = %d, want 5", len(lines))
+	}
+
+	want := []string{
+		`cpu,host=a usage=1.5,state="ok" 1546300800`,
+		`cpu,host=b\ c usage=2i 1546300810`,
+		`default,host=a usage=true,state="say \"hi\""`,
+	}
+	for i, text := range want {
+		if lines[i].Err != nil || lines[i].Text != text {
+			t.Errorf("Read() row %d = %q, %v, want %q", lines[i].Number, lines[i].Text, lines[i].Err, text)
+		}
+	}
+	if lines[0].Number != 2 {
+		t.Errorf("Read() first row number = %d, want 2", lines[0].Number)
+	}
+	if lines[3].Err == nil {
+		t.Error("Read() of an invalid time expected error")
+	}
+	if lines[4].Err == nil {
+		t.Error("Read() of a short row expected error")
+	}
+}
+
+func TestNewCSVReader_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		opts  influx.CSVOptions
+	}{
+		{name: "empty", input: ""},
+		{name: "no measurement", input: "time,usage\n1,2\n"},
+		{name: "unknown tag", input: "name,usage\ncpu,1\n", opts: influx.CSVOptions{Tags: []string{"host"}}},
+		{name: "no fields", input: "name,host,time\ncpu,a,1\n", opts: influx.CSVOptions{Tags: []string{"host"}}},
+	}
+	for _, tt := range tests {
+		if _, err := influx.NewCSVReader(strings.NewReader(tt.input), tt.opts); err == nil {
+			t.Errorf("%s: NewCSVReader() expected error", tt.name)
+		}
+	}
+}
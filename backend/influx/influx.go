@@ -32,6 +32,14 @@ type Client struct {
 	Authorizer         Authorizer
 	InsecureSkipVerify bool
 	Logger             cloudhub.Logger
+	// Org is the organization of the buckets of an InfluxDB 2.x source; it
+	// is empty for InfluxDB 1.x
+	Org string
+	// Cache keeps the results of schema queries of the source; schema
+	// queries are not cached when it is nil
+	Cache *QueryCache
+
+	srcID int
 }
 
 // Response is a partial JSON decoded InfluxQL response used
@@ -155,12 +163,17 @@ func (c *Client) Connect(ctx context.Context, src *cloudhub.Source) error {
 		return err
 	}
 	c.Authorizer = DefaultAuthorization(src)
+	c.Org = ""
+	if src.Type == cloudhub.InfluxDBv2 {
+		c.Org = src.InfluxOrg
+	}
 	// Only allow acceptance of all certs if the scheme is https AND the user opted into to the setting.
 	if u.Scheme == "https" && src.InsecureSkipVerify {
 		c.InsecureSkipVerify = src.InsecureSkipVerify
 	}
 
 	c.URL = u
+	c.srcID = src.ID
 	return nil
 }
 
@@ -251,6 +264,10 @@ func (c *Client) ping(u *url.URL) (string, string, error) {
 		return "", "", err
 	}
 
+	if c.Org != "" {
+		return resp.Header.Get("X-Influxdb-Version"), cloudhub.InfluxDBv2, nil
+	}
+
 	version := resp.Header.Get("X-Influxdb-Build")
 	if version == "ENT" {
 		return version, cloudhub.InfluxEnterprise, nil
@@ -260,6 +277,8 @@ func (c *Client) ping(u *url.URL) (string, string, error) {
 		return version, cloudhub.InfluxEnterprise, nil
 	} else if strings.Contains(version, "relay") {
 		return version, cloudhub.InfluxRelay, nil
+	} else if strings.HasPrefix(strings.TrimPrefix(version, "v"), "2.") {
+		return version, cloudhub.InfluxDBv2, nil
 	}
 
 	return version, cloudhub.InfluxDB, nil
@@ -281,7 +300,7 @@ func (c *Client) writePoint(ctx context.Context, point *cloudhub.Point) error {
 		return err
 	}
 
-	err = c.write(ctx, c.URL, point.Database, point.RetentionPolicy, lp)
+	err = c.write(ctx, c.URL, point.Database, point.RetentionPolicy, "", lp)
 	if err == nil {
 		return nil
 	}
@@ -301,13 +320,29 @@ func (c *Client) writePoint(ctx context.Context, point *cloudhub.Point) error {
 			return err
 		}
 		// retry the write
-		return c.write(ctx, c.URL, point.Database, point.RetentionPolicy, lp)
+		return c.write(ctx, c.URL, point.Database, point.RetentionPolicy, "", lp)
 	}
 
 	return err
 }
 
-func (c *Client) write(ctx context.Context, u *url.URL, db, rp, lp string) error {
+// WriteLines writes lines of line protocol with times of precision to a
+// database and retention policy in one request
+func (c *Client) WriteLines(ctx context.Context, db, rp, precision, lines string) error {
+	u := *c.URL
+	err := c.write(ctx, &u, db, rp, precision, lines)
+	if err != nil && strings.Contains(err.Error(), "hinted handoff queue not empty") {
+		// This is an informational message
+		return nil
+	}
+	return err
+}
+
+func (c *Client) write(ctx context.Context, u *url.URL, db, rp, precision, lp string) error {
+	if c.Org != "" {
+		return c.writeBucket(ctx, db, rp, precision, lp)
+	}
+
 	u.Path = "write"
 	req, err := http.NewRequest("POST", u.String(), strings.NewReader(lp))
 	if err != nil {
@@ -324,6 +359,9 @@ func (c *Client) write(ctx context.Context, u *url.URL, db, rp, lp string) error
 	params := req.URL.Query()
 	params.Set("db", db)
 	params.Set("rp", rp)
+	if precision != "" {
+		params.Set("precision", precision)
+	}
 	req.URL.RawQuery = params.Encode()
 
 	hc := &http.Client{}
@@ -45,6 +45,7 @@ func (c *Client) Permissions(context.Context) cloudhub.Permissions {
 // showResults is used to deserialize InfluxQL SHOW commands
 type showResults []struct {
 	Series []struct {
+		Name   string          `json:"name"`
 		Values [][]interface{} `json:"values"`
 	} `json:"series"`
 }
@@ -142,6 +143,29 @@ func (r *showResults) Measurements() []cloudhub.Measurement {
 	return res
 }
 
+// ContinuousQueries converts SHOW CONTINUOUS QUERIES to the cloudhub
+// ContinuousQuery of db; the series of every database is named after it.
+func (r *showResults) ContinuousQueries(db string) []cloudhub.ContinuousQuery {
+	res := []cloudhub.ContinuousQuery{}
+	for _, u := range *r {
+		for _, s := range u.Series {
+			if s.Name != db {
+				continue
+			}
+			for _, v := range s.Values {
+				if name, ok := v[0].(string); !ok {
+					continue
+				} else if query, ok := v[1].(string); !ok {
+					continue
+				} else {
+					res = append(res, cloudhub.ContinuousQuery{Name: name, Query: query})
+				}
+			}
+		}
+	}
+	return res
+}
+
 // Permissions converts SHOW GRANTS to cloudhub.Permissions
 func (r *showResults) Permissions() cloudhub.Permissions {
 	res := []cloudhub.Permission{}
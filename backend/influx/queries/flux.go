@@ -0,0 +1,921 @@
+package queries
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb/influxql"
+)
+
+// FluxOptions are the defaults of the translation of a SELECT statement to
+// Flux
+type FluxOptions struct {
+	DB string // DB of measurements without a database
+	RP string // RP of measurements without a retention policy
+	// From returns the parameters of the from() of a database and retention
+	// policy; the bucket db/rp by default
+	From func(db, rp string) (string, error)
+	// Shift is an InfluxQL duration by which the time range of the statement
+	// is moved back; results are moved forward by it to compare periods
+	Shift string
+}
+
+// FluxTranslation is the Flux of a SELECT statement. Approximate
+// translations have results that differ from the results of the statement;
+// Notes say how.
+type FluxTranslation struct {
+	Flux        string   `json:"flux"`
+	Approximate bool     `json:"approximate"`
+	Notes       []string `json:"notes,omitempty"`
+}
+
+// fluxPipe is the Flux of a field of a SELECT statement; stages follow the
+// filter of the field. Grouped pipes have the grouping of the statement.
+type fluxPipe struct {
+	name      string
+	field     string
+	stages    []string
+	aggregate bool
+	grouped   bool
+}
+
+type fluxTranslator struct {
+	stmt     *influxql.SelectStatement
+	opts     FluxOptions
+	res      FluxTranslation
+	interval time.Duration
+	offset   time.Duration
+	groupBy  []string
+	groupAll bool
+	fields   map[string]bool
+}
+
+// ToFlux translates the statement to a Flux script. Statements Flux cannot
+// express are errors.
+func (s *SelectStatement) ToFlux(opts FluxOptions) (*FluxTranslation, error) {
+	t := &fluxTranslator{
+		stmt:   s.SelectStatement,
+		opts:   opts,
+		fields: map[string]bool{},
+	}
+	if t.opts.From == nil {
+		t.opts.From = fluxBucket
+	}
+	if err := t.translate(); err != nil {
+		return nil, err
+	}
+	return &t.res, nil
+}
+
+func fluxBucket(db, rp string) (string, error) {
+	if rp == "" {
+		return "bucket: " + fluxString(db), nil
+	}
+	return "bucket: " + fluxString(db+"/"+rp), nil
+}
+
+func (t *fluxTranslator) note(format string, args ...interface{}) {
+	t.res.Approximate = true
+	t.res.Notes = append(t.res.Notes, fmt.Sprintf(format, args...))
+}
+
+func (t *fluxTranslator) translate() error {
+	stmt := t.stmt
+	if stmt.Target != nil {
+		return fmt.Errorf("SELECT INTO cannot be translated to Flux")
+	}
+
+	from, measurements, err := t.sources()
+	if err != nil {
+		return err
+	}
+	if err := t.dimensions(); err != nil {
+		return err
+	}
+
+	var shift time.Duration
+	if t.opts.Shift != "" {
+		if shift, err = influxql.ParseDuration(t.opts.Shift); err != nil {
+			return fmt.Errorf("invalid shift %s: %v", t.opts.Shift, err)
+		}
+	}
+
+	var conditions []influxql.Expr
+	lower, upper := &fluxTime{}, (*fluxTime)(nil)
+	if stmt.Condition != nil {
+		if lower, upper, conditions, err = t.splitCondition(stmt.Condition); err != nil {
+			return err
+		}
+	}
+	if shift != 0 {
+		lower = lower.sub(shift)
+		if upper == nil {
+			upper = &fluxTime{relative: true}
+		}
+		upper = upper.sub(shift)
+	}
+
+	pipes := make([]fluxPipe, 0, len(stmt.Fields))
+	names := map[string]int{}
+	for _, f := range stmt.Fields {
+		pipe, err := t.pipe(f.Expr)
+		if err != nil {
+			return err
+		}
+		if !pipe.grouped {
+			if t.interval > 0 {
+				return fmt.Errorf("GROUP BY time needs an aggregate of %s", f)
+			}
+			pipe = t.raw(pipe)
+		}
+		pipe.name = f.Name()
+		if f.Alias != "" {
+			pipe.stages = append(pipe.stages, "set(key: \"_field\", value: "+fluxString(f.Alias)+")")
+		}
+		// Columns of the same name are numbered as InfluxQL numbers them
+		if n := names[pipe.name]; n > 0 {
+			names[pipe.name]++
+			pipe.name = fmt.Sprintf("%s_%d", pipe.name, n)
+		} else {
+			names[pipe.name] = 1
+		}
+		pipes = append(pipes, pipe)
+	}
+
+	base := []string{
+		"from(" + from + ")",
+		"range(" + lower.rangeArg("start") + upper.rangeArg(", stop") + ")",
+		"filter(fn: (r) => " + measurements + ")",
+	}
+	if len(conditions) > 0 {
+		predicates := make([]string, len(conditions))
+		for i, c := range conditions {
+			if predicates[i], err = t.predicate(c); err != nil {
+				return err
+			}
+		}
+		base = append(base, "filter(fn: (r) => "+strings.Join(predicates, " and ")+")")
+	}
+	for _, field := range sortedFields(t.fields) {
+		if len(pipes) != 1 || pipes[0].field != "r._field == "+fluxString(field) {
+			t.note("Conditions on the values of field %s filter the values of that field only, not the values of other fields", field)
+		}
+	}
+
+	post := t.post(shift)
+	if len(pipes) == 1 {
+		t.res.Flux = fluxChain(append(append(base, pipes[0].chain()...), post...)) + "\n"
+		return nil
+	}
+
+	var b strings.Builder
+	b.WriteString("data = " + fluxChain(base) + "\n")
+	vars := make([]string, len(pipes))
+	used := map[string]bool{"data": true}
+	for i, pipe := range pipes {
+		vars[i] = fluxIdentifier(pipe.name, used)
+		b.WriteString("\n" + vars[i] + " = " + fluxChain(append(append([]string{"data"}, pipe.chain()...), post...)) + "\n")
+	}
+	b.WriteString("\nunion(tables: [" + strings.Join(vars, ", ") + "])\n")
+	t.res.Flux = b.String()
+	return nil
+}
+
+// chain is the filter of the field of a pipe followed by its stages
+func (p fluxPipe) chain() []string {
+	if p.field == "" {
+		return p.stages
+	}
+	return append([]string{"filter(fn: (r) => " + p.field + ")"}, p.stages...)
+}
+
+func fluxChain(stages []string) string {
+	return strings.Join(stages, "\n  |> ")
+}
+
+// sources is the from() parameters and the filter of the measurements of
+// the statement
+func (t *fluxTranslator) sources() (string, string, error) {
+	var db, rp string
+	var predicates []string
+	for i, src := range t.stmt.Sources {
+		m, ok := src.(*influxql.Measurement)
+		if !ok {
+			return "", "", fmt.Errorf("subqueries cannot be translated to Flux")
+		}
+		mdb, mrp := m.Database, m.RetentionPolicy
+		if mdb == "" {
+			mdb = t.opts.DB
+		}
+		if mrp == "" {
+			mrp = t.opts.RP
+		}
+		if i > 0 && (mdb != db || mrp != rp) {
+			return "", "", fmt.Errorf("measurements of several databases or retention policies cannot be translated to Flux")
+		}
+		db, rp = mdb, mrp
+
+		if m.Regex != nil {
+			predicates = append(predicates, "r._measurement =~ "+fluxRegex(m.Regex.Val))
+		} else {
+			predicates = append(predicates, "r._measurement == "+fluxString(m.Name))
+		}
+	}
+	if len(predicates) == 0 {
+		return "", "", fmt.Errorf("statement has no measurement")
+	}
+	if db == "" {
+		return "", "", fmt.Errorf("database required to translate to Flux")
+	}
+	from, err := t.opts.From(db, rp)
+	if err != nil {
+		return "", "", err
+	}
+	return from, strings.Join(predicates, " or "), nil
+}
+
+// dimensions reads the time interval and tags of the GROUP BY
+func (t *fluxTranslator) dimensions() error {
+	for _, d := range t.stmt.Dimensions {
+		switch expr := d.Expr.(type) {
+		case *influxql.Call:
+			if expr.Name != "time" || len(expr.Args) == 0 {
+				return fmt.Errorf("GROUP BY %s cannot be translated to Flux", expr)
+			}
+			interval, ok := expr.Args[0].(*influxql.DurationLiteral)
+			if !ok {
+				return fmt.Errorf("GROUP BY time must have a duration")
+			}
+			t.interval = interval.Val
+			if len(expr.Args) > 1 {
+				offset, ok := expr.Args[1].(*influxql.DurationLiteral)
+				if !ok {
+					return fmt.Errorf("GROUP BY time offsets other than durations cannot be translated to Flux")
+				}
+				t.offset = offset.Val
+			}
+		case *influxql.VarRef:
+			t.groupBy = append(t.groupBy, expr.Val)
+		case *influxql.Wildcard:
+			t.groupAll = true
+		case *influxql.RegexLiteral:
+			t.groupAll = true
+			t.note("GROUP BY %s groups by all tags", expr)
+		default:
+			return fmt.Errorf("GROUP BY %s cannot be translated to Flux", expr)
+		}
+	}
+	return nil
+}
+
+// fluxTime is a bound of the time range; relative bounds are offsets from
+// now()
+type fluxTime struct {
+	relative bool
+	offset   time.Duration
+	abs      time.Time
+	set      bool
+}
+
+func (f *fluxTime) sub(d time.Duration) *fluxTime {
+	if f.relative {
+		return &fluxTime{relative: true, offset: f.offset - d, set: true}
+	}
+	if !f.set {
+		return f
+	}
+	return &fluxTime{abs: f.abs.Add(-d), set: true}
+}
+
+func (f *fluxTime) rangeArg(name string) string {
+	if f == nil {
+		return ""
+	}
+	name = name + ": "
+	switch {
+	case f.relative && f.offset == 0:
+		return name + "now()"
+	case f.relative:
+		return name + fluxDuration(f.offset)
+	case f.set:
+		return name + f.abs.UTC().Format(time.RFC3339Nano)
+	}
+	// Queries without a lower time bound start at the epoch
+	return name + "1970-01-01T00:00:00Z"
+}
+
+// splitCondition separates the time range of a condition from its other
+// conditions, which are ANDed
+func (t *fluxTranslator) splitCondition(cond influxql.Expr) (*fluxTime, *fluxTime, []influxql.Expr, error) {
+	lower, upper := &fluxTime{}, (*fluxTime)(nil)
+	var conditions []influxql.Expr
+
+	var walk func(expr influxql.Expr) error
+	walk = func(expr influxql.Expr) error {
+		switch e := expr.(type) {
+		case *influxql.ParenExpr:
+			if hasTime(e.Expr) {
+				return walk(e.Expr)
+			}
+		case *influxql.BinaryExpr:
+			if e.Op == influxql.AND {
+				if err := walk(e.LHS); err != nil {
+					return err
+				}
+				return walk(e.RHS)
+			}
+			op, value, isTime := timeComparison(e)
+			if !isTime {
+				if hasTime(e) {
+					return fmt.Errorf("time conditions other than ANDed comparisons cannot be translated to Flux")
+				}
+				break
+			}
+			bound, err := evalTime(value)
+			if err != nil {
+				return err
+			}
+			switch op {
+			case influxql.GT, influxql.GTE:
+				if lower.set {
+					t.note("The last of several lower time bounds is the start of the range")
+				}
+				lower = bound
+			case influxql.LT, influxql.LTE:
+				if upper != nil {
+					t.note("The last of several upper time bounds is the stop of the range")
+				}
+				upper = bound
+			default:
+				return fmt.Errorf("time conditions other than <, <=, > and >= cannot be translated to Flux")
+			}
+			return nil
+		}
+		conditions = append(conditions, expr)
+		return nil
+	}
+	if err := walk(cond); err != nil {
+		return nil, nil, nil, err
+	}
+	return lower, upper, conditions, nil
+}
+
+// timeComparison is the operator and the value of a comparison of the time,
+// with the time on the left
+func timeComparison(e *influxql.BinaryExpr) (influxql.Token, influxql.Expr, bool) {
+	if ref, ok := e.LHS.(*influxql.VarRef); ok && strings.EqualFold(ref.Val, "time") {
+		return e.Op, e.RHS, true
+	}
+	if ref, ok := e.RHS.(*influxql.VarRef); ok && strings.EqualFold(ref.Val, "time") {
+		return reverseOp(e.Op), e.LHS, true
+	}
+	return e.Op, nil, false
+}
+
+func reverseOp(op influxql.Token) influxql.Token {
+	switch op {
+	case influxql.GT:
+		return influxql.LT
+	case influxql.GTE:
+		return influxql.LTE
+	case influxql.LT:
+		return influxql.GT
+	case influxql.LTE:
+		return influxql.GTE
+	}
+	return op
+}
+
+func hasTime(expr influxql.Expr) bool {
+	found := false
+	influxql.WalkFunc(expr, func(n influxql.Node) {
+		if ref, ok := n.(*influxql.VarRef); ok && strings.EqualFold(ref.Val, "time") {
+			found = true
+		}
+	})
+	return found
+}
+
+// evalTime evaluates now() or times plus or minus durations
+func evalTime(expr influxql.Expr) (*fluxTime, error) {
+	switch e := expr.(type) {
+	case *influxql.ParenExpr:
+		return evalTime(e.Expr)
+	case *influxql.Call:
+		if e.Name == "now" && len(e.Args) == 0 {
+			return &fluxTime{relative: true, set: true}, nil
+		}
+	case *influxql.StringLiteral:
+		lit, err := e.ToTimeLiteral()
+		if err != nil {
+			return nil, err
+		}
+		return &fluxTime{abs: lit.Val, set: true}, nil
+	case *influxql.TimeLiteral:
+		return &fluxTime{abs: e.Val, set: true}, nil
+	case *influxql.IntegerLiteral:
+		return &fluxTime{abs: time.Unix(0, e.Val), set: true}, nil
+	case *influxql.NumberLiteral:
+		return &fluxTime{abs: time.Unix(0, int64(e.Val)), set: true}, nil
+	case *influxql.DurationLiteral:
+		return &fluxTime{abs: time.Unix(0, int64(e.Val)), set: true}, nil
+	case *influxql.BinaryExpr:
+		d, ok := e.RHS.(*influxql.DurationLiteral)
+		if !ok || (e.Op != influxql.ADD && e.Op != influxql.SUB) {
+			break
+		}
+		bound, err := evalTime(e.LHS)
+		if err != nil {
+			return nil, err
+		}
+		if e.Op == influxql.ADD {
+			return bound.sub(-d.Val), nil
+		}
+		return bound.sub(d.Val), nil
+	}
+	return nil, fmt.Errorf("time %s cannot be translated to Flux", expr)
+}
+
+// predicate is the Flux of a condition other than a time range
+func (t *fluxTranslator) predicate(expr influxql.Expr) (string, error) {
+	switch e := expr.(type) {
+	case *influxql.ParenExpr:
+		p, err := t.predicate(e.Expr)
+		return "(" + p + ")", err
+	case *influxql.BooleanLiteral:
+		return strconv.FormatBool(e.Val), nil
+	case *influxql.BinaryExpr:
+		switch e.Op {
+		case influxql.AND, influxql.OR:
+			lhs, err := t.predicate(e.LHS)
+			if err != nil {
+				return "", err
+			}
+			rhs, err := t.predicate(e.RHS)
+			if err != nil {
+				return "", err
+			}
+			return lhs + " " + strings.ToLower(e.Op.String()) + " " + rhs, nil
+		}
+
+		ref, lit, op := e.LHS, e.RHS, e.Op
+		if _, ok := ref.(*influxql.VarRef); !ok {
+			ref, lit, op = e.RHS, e.LHS, reverseOp(e.Op)
+		}
+		v, ok := ref.(*influxql.VarRef)
+		if !ok {
+			break
+		}
+		fop, ok := fluxOps[op]
+		if !ok {
+			break
+		}
+		value, isField, err := fluxLiteral(lit)
+		if err != nil {
+			return "", err
+		}
+		switch v.Type {
+		case influxql.Tag:
+			isField = false
+		case influxql.Unknown:
+		default:
+			isField = true
+		}
+		if isField {
+			// Rows of fields are filtered by the values of their own field only
+			t.fields[v.Val] = true
+			return "(r._field != " + fluxString(v.Val) + " or r._value " + fop + " " + value + ")", nil
+		}
+		if value == `""` {
+			t.note("Conditions on empty tag values compare values; rows without the tag %s do not match", v.Val)
+		}
+		return "r[" + fluxString(v.Val) + "] " + fop + " " + value, nil
+	}
+	return "", fmt.Errorf("condition %s cannot be translated to Flux", expr)
+}
+
+var fluxOps = map[influxql.Token]string{
+	influxql.EQ:       "==",
+	influxql.NEQ:      "!=",
+	influxql.LT:       "<",
+	influxql.LTE:      "<=",
+	influxql.GT:       ">",
+	influxql.GTE:      ">=",
+	influxql.EQREGEX:  "=~",
+	influxql.NEQREGEX: "!~",
+}
+
+// fluxLiteral is the Flux of a literal, and whether it is compared to field
+// values rather than tags
+func fluxLiteral(expr influxql.Expr) (string, bool, error) {
+	switch e := expr.(type) {
+	case *influxql.StringLiteral:
+		return fluxString(e.Val), false, nil
+	case *influxql.RegexLiteral:
+		return fluxRegex(e.Val), false, nil
+	case *influxql.IntegerLiteral:
+		return strconv.FormatInt(e.Val, 10), true, nil
+	case *influxql.NumberLiteral:
+		return fluxFloat(e.Val), true, nil
+	case *influxql.BooleanLiteral:
+		return strconv.FormatBool(e.Val), true, nil
+	}
+	return "", false, fmt.Errorf("%s cannot be translated to Flux", expr)
+}
+
+// fluxAggregate is the Flux function of an InfluxQL aggregate or selector,
+// and its parameters
+type fluxAggregate struct {
+	name   string
+	params string
+}
+
+var fluxAggregates = map[string]fluxAggregate{
+	"count":  {name: "count"},
+	"sum":    {name: "sum"},
+	"mean":   {name: "mean"},
+	"median": {name: "median", params: `method: "exact_mean"`},
+	"mode":   {name: "mode"},
+	"spread": {name: "spread"},
+	"stddev": {name: "stddev"},
+	"min":    {name: "min"},
+	"max":    {name: "max"},
+	"first":  {name: "first"},
+	"last":   {name: "last"},
+}
+
+// pipe translates a field of the statement
+func (t *fluxTranslator) pipe(expr influxql.Expr) (fluxPipe, error) {
+	switch e := expr.(type) {
+	case *influxql.ParenExpr:
+		return t.pipe(e.Expr)
+	case *influxql.VarRef:
+		return fluxPipe{field: "r._field == " + fluxString(e.Val)}, nil
+	case *influxql.Wildcard:
+		return fluxPipe{}, nil
+	case *influxql.RegexLiteral:
+		return fluxPipe{field: "r._field =~ " + fluxRegex(e.Val)}, nil
+	case *influxql.Distinct:
+		return t.call(&influxql.Call{Name: "distinct", Args: []influxql.Expr{&influxql.VarRef{Val: e.Val}}})
+	case *influxql.Call:
+		return t.call(e)
+	}
+	return fluxPipe{}, fmt.Errorf("field %s cannot be translated to Flux; math and literals are not translated", expr)
+}
+
+func (t *fluxTranslator) call(c *influxql.Call) (fluxPipe, error) {
+	if len(c.Args) == 0 {
+		return fluxPipe{}, fmt.Errorf("%s() needs a field", c.Name)
+	}
+	arg := c.Args[0]
+
+	// Transformations of raw values or of aggregates
+	switch c.Name {
+	case "derivative", "non_negative_derivative", "difference", "non_negative_difference",
+		"cumulative_sum", "moving_average", "elapsed":
+		pipe, err := t.pipe(arg)
+		if err != nil {
+			return pipe, err
+		}
+		if !pipe.aggregate {
+			if t.interval > 0 {
+				return pipe, fmt.Errorf("%s() of raw values cannot have GROUP BY time", c.Name)
+			}
+			pipe = t.raw(pipe)
+		}
+		nonNegative := strings.HasPrefix(c.Name, "non_negative_")
+		switch strings.TrimPrefix(c.Name, "non_negative_") {
+		case "derivative":
+			unit, err := durationArg(c, 1, time.Second)
+			if err != nil {
+				return pipe, err
+			}
+			pipe.stages = append(pipe.stages, fmt.Sprintf("derivative(unit: %s, nonNegative: %t)", fluxDuration(unit), nonNegative))
+		case "difference":
+			pipe.stages = append(pipe.stages, fmt.Sprintf("difference(nonNegative: %t)", nonNegative))
+		case "cumulative_sum":
+			pipe.stages = append(pipe.stages, "cumulativeSum()")
+		case "moving_average":
+			n, err := intArg(c, 1)
+			if err != nil {
+				return pipe, err
+			}
+			pipe.stages = append(pipe.stages, fmt.Sprintf("movingAverage(n: %d)", n))
+		case "elapsed":
+			unit, err := durationArg(c, 1, time.Nanosecond)
+			if err != nil {
+				return pipe, err
+			}
+			pipe.stages = append(pipe.stages, fmt.Sprintf("elapsed(unit: %s)", fluxDuration(unit)))
+			t.note("elapsed() writes the elapsed time to the elapsed column, not to _value")
+		}
+		return pipe, nil
+	}
+
+	// count(distinct(field)) counts distinct values
+	if inner, ok := arg.(*influxql.Distinct); ok {
+		arg = &influxql.Call{Name: "distinct", Args: []influxql.Expr{&influxql.VarRef{Val: inner.Val}}}
+	}
+	if inner, ok := arg.(*influxql.Call); ok {
+		if c.Name != "count" || inner.Name != "distinct" || len(inner.Args) == 0 {
+			return fluxPipe{}, fmt.Errorf("%s() of %s() cannot be translated to Flux", c.Name, inner.Name)
+		}
+		pipe, err := t.pipe(inner.Args[0])
+		if err != nil {
+			return pipe, err
+		}
+		return t.aggregate(pipe, fluxAggregate{name: "distinct"}, fluxAggregate{name: "count"}), nil
+	}
+
+	pipe, err := t.pipe(arg)
+	if err != nil {
+		return pipe, err
+	}
+	if agg, ok := fluxAggregates[c.Name]; ok {
+		return t.aggregate(pipe, agg), nil
+	}
+
+	switch c.Name {
+	case "percentile":
+		p, err := numberArg(c, 1)
+		if err != nil {
+			return pipe, err
+		}
+		return t.aggregate(pipe, fluxAggregate{
+			name:   "quantile",
+			params: fmt.Sprintf(`q: %s, method: "exact_selector"`, fluxFloat(p/100)),
+		}), nil
+	case "integral":
+		unit, err := durationArg(c, 1, time.Second)
+		if err != nil {
+			return pipe, err
+		}
+		return t.aggregate(pipe, fluxAggregate{name: "integral", params: "unit: " + fluxDuration(unit)}), nil
+	case "top", "bottom", "sample", "distinct":
+		var stage string
+		if c.Name == "distinct" {
+			stage = "distinct()"
+		} else {
+			if len(c.Args) > 2 {
+				t.note("%s() of tags selects the values of every series, not of distinct tag values", c.Name)
+			}
+			n, err := intArg(c, len(c.Args)-1)
+			if err != nil {
+				return pipe, err
+			}
+			stage = fmt.Sprintf("%s(n: %d)", c.Name, n)
+			if c.Name == "sample" {
+				t.note("sample() selects every nth value rather than random values")
+			}
+		}
+		pipe = t.grouped(pipe)
+		if t.interval > 0 {
+			pipe.stages = append(pipe.stages, "window(every: "+fluxDuration(t.interval)+t.offsetArg()+")", stage, "window(every: inf)")
+		} else {
+			pipe.stages = append(pipe.stages, stage)
+		}
+		pipe.aggregate = true
+		return pipe, nil
+	}
+	return pipe, fmt.Errorf("%s() cannot be translated to Flux", c.Name)
+}
+
+// aggregate appends the grouping of the statement and aggregates, by
+// windows of the GROUP BY time interval
+func (t *fluxTranslator) aggregate(pipe fluxPipe, aggs ...fluxAggregate) fluxPipe {
+	pipe = t.grouped(pipe)
+	pipe.aggregate = true
+	if t.interval == 0 {
+		for _, agg := range aggs {
+			pipe.stages = append(pipe.stages, agg.name+"("+agg.params+")")
+		}
+		return pipe
+	}
+
+	fn := aggs[0].name
+	if len(aggs) > 1 || aggs[0].params != "" {
+		calls := make([]string, len(aggs))
+		for i, agg := range aggs {
+			params := "column: column"
+			if agg.params != "" {
+				params += ", " + agg.params
+			}
+			calls[i] = agg.name + "(" + params + ")"
+		}
+		fn = "(column, tables=<-) => tables |> " + strings.Join(calls, " |> ")
+	}
+
+	createEmpty := t.stmt.Fill != influxql.NoFill
+	pipe.stages = append(pipe.stages, fmt.Sprintf("aggregateWindow(every: %s%s, fn: %s, createEmpty: %t)",
+		fluxDuration(t.interval), t.offsetArg(), fn, createEmpty))
+
+	switch t.stmt.Fill {
+	case influxql.PreviousFill:
+		pipe.stages = append(pipe.stages, "fill(usePrevious: true)")
+	case influxql.NumberFill:
+		value := fmt.Sprint(t.stmt.FillValue)
+		switch v := t.stmt.FillValue.(type) {
+		case float64:
+			value = fluxFloat(v)
+		case int64:
+			if aggs[len(aggs)-1].name != "count" {
+				value = fluxFloat(float64(v))
+			}
+		}
+		pipe.stages = append(pipe.stages, "fill(value: "+value+")")
+	case influxql.LinearFill:
+		t.note("fill(linear) leaves empty windows null")
+	}
+	return pipe
+}
+
+// grouped appends the grouping of the statement to a pipe; series are
+// merged unless the statement groups by all tags
+func (t *fluxTranslator) grouped(pipe fluxPipe) fluxPipe {
+	if pipe.grouped {
+		return pipe
+	}
+	pipe.grouped = true
+	if t.groupAll {
+		return pipe
+	}
+	columns := append([]string{"_measurement", "_field"}, t.groupBy...)
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = fluxString(c)
+	}
+	pipe.stages = append(pipe.stages, "group(columns: ["+strings.Join(quoted, ", ")+"])")
+	return pipe
+}
+
+// raw groups the raw values of a pipe in order of time, as InfluxQL merges
+// series
+func (t *fluxTranslator) raw(pipe fluxPipe) fluxPipe {
+	if pipe.grouped {
+		return pipe
+	}
+	pipe = t.grouped(pipe)
+	if !t.groupAll {
+		pipe.stages = append(pipe.stages, `sort(columns: ["_time"])`)
+	}
+	return pipe
+}
+
+func (t *fluxTranslator) offsetArg() string {
+	if t.offset == 0 {
+		return ""
+	}
+	return ", offset: " + fluxDuration(t.offset)
+}
+
+// post are the stages of every field after its values: order, limits and
+// the time shift
+func (t *fluxTranslator) post(shift time.Duration) []string {
+	var stages []string
+	if len(t.stmt.SortFields) > 0 && !t.stmt.SortFields[0].Ascending {
+		stages = append(stages, `sort(columns: ["_time"], desc: true)`)
+	}
+	switch {
+	case t.stmt.Limit > 0 && t.stmt.Offset > 0:
+		stages = append(stages, fmt.Sprintf("limit(n: %d, offset: %d)", t.stmt.Limit, t.stmt.Offset))
+	case t.stmt.Limit > 0:
+		stages = append(stages, fmt.Sprintf("limit(n: %d)", t.stmt.Limit))
+	case t.stmt.Offset > 0:
+		t.note("OFFSET without LIMIT is not translated")
+	}
+	if t.stmt.SLimit > 0 || t.stmt.SOffset > 0 {
+		t.note("SLIMIT and SOFFSET are not translated")
+	}
+	if shift != 0 {
+		stages = append(stages, "timeShift(duration: "+fluxDuration(shift)+")")
+	}
+	return stages
+}
+
+func durationArg(c *influxql.Call, i int, def time.Duration) (time.Duration, error) {
+	if len(c.Args) <= i {
+		return def, nil
+	}
+	d, ok := c.Args[i].(*influxql.DurationLiteral)
+	if !ok {
+		return 0, fmt.Errorf("argument %d of %s() must be a duration", i+1, c.Name)
+	}
+	return d.Val, nil
+}
+
+func intArg(c *influxql.Call, i int) (int64, error) {
+	if len(c.Args) > i {
+		if n, ok := c.Args[i].(*influxql.IntegerLiteral); ok {
+			return n.Val, nil
+		}
+	}
+	return 0, fmt.Errorf("argument %d of %s() must be an integer", i+1, c.Name)
+}
+
+func numberArg(c *influxql.Call, i int) (float64, error) {
+	if len(c.Args) > i {
+		switch n := c.Args[i].(type) {
+		case *influxql.IntegerLiteral:
+			return float64(n.Val), nil
+		case *influxql.NumberLiteral:
+			return n.Val, nil
+		}
+	}
+	return 0, fmt.Errorf("argument %d of %s() must be a number", i+1, c.Name)
+}
+
+var fluxStringEscapes = strings.NewReplacer(
+	`\` /* to */, `\\`,
+	`"` /* to */, `\"`,
+	`${` /* to */, `\${`,
+)
+
+func fluxString(s string) string {
+	return `"` + fluxStringEscapes.Replace(s) + `"`
+}
+
+// fluxRegex is a Flux regular expression literal; slashes are escaped
+func fluxRegex(re *regexp.Regexp) string {
+	var b strings.Builder
+	b.WriteByte('/')
+	escaped := false
+	for _, r := range re.String() {
+		if r == '/' && !escaped {
+			b.WriteByte('\\')
+		}
+		escaped = r == '\\' && !escaped
+		b.WriteRune(r)
+	}
+	b.WriteByte('/')
+	return b.String()
+}
+
+func fluxFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s
+}
+
+// fluxDuration is the Flux literal of a duration in its largest whole unit
+func fluxDuration(d time.Duration) string {
+	if d < 0 {
+		return "-" + fluxDuration(-d)
+	}
+	units := []struct {
+		unit string
+		d    time.Duration
+	}{
+		{"w", 7 * 24 * time.Hour},
+		{"d", 24 * time.Hour},
+		{"h", time.Hour},
+		{"m", time.Minute},
+		{"s", time.Second},
+		{"ms", time.Millisecond},
+		{"us", time.Microsecond},
+	}
+	for _, u := range units {
+		if d%u.d == 0 && d >= u.d {
+			return strconv.FormatInt(int64(d/u.d), 10) + u.unit
+		}
+	}
+	return strconv.FormatInt(int64(d), 10) + "ns"
+}
+
+// fluxKeywords cannot be names of variables
+var fluxKeywords = map[string]bool{
+	"and": true, "or": true, "not": true, "empty": true, "in": true, "import": true,
+	"package": true, "return": true, "option": true, "builtin": true, "test": true,
+	"if": true, "then": true, "else": true, "exists": true,
+}
+
+var nonIdentifier = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// fluxIdentifier is a variable name of a column that is not used yet
+func fluxIdentifier(name string, used map[string]bool) string {
+	id := strings.Trim(nonIdentifier.ReplaceAllString(name, "_"), "_")
+	if id == "" || fluxKeywords[id] || (id[0] >= '0' && id[0] <= '9') {
+		id = "field_" + id
+	}
+	candidate := id
+	for i := 1; used[candidate]; i++ {
+		candidate = id + "_" + strconv.Itoa(i)
+	}
+	used[candidate] = true
+	return candidate
+}
+
+// sortedFields are the fields of conditions in order
+func sortedFields(fields map[string]bool) []string {
+	names := make([]string, 0, len(fields))
+	for f := range fields {
+		names = append(names, f)
+	}
+	sort.Strings(names)
+	return names
+}
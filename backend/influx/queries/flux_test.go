@@ -0,0 +1,178 @@
+package queries
+
+import (
+	"testing"
+
+	"github.com/influxdata/flux"
+	"github.com/influxdata/flux/ast"
+)
+
+func TestSelectStatement_ToFlux(t *testing.T) {
+	tests := []struct {
+		name        string
+		q           string
+		opts        FluxOptions
+		want        string
+		approximate bool
+		wantErr     bool
+	}{
+		{
+			name: "Aggregate by time and tag",
+			q:    `SELECT mean("usage_user") FROM "telegraf"."autogen"."cpu" WHERE time > now() - 1h AND "cpu" = 'cpu-total' GROUP BY time(10s), "host" fill(null)`,
+			want: `from(bucket: "telegraf/autogen")
+  |> range(start: -1h)
+  |> filter(fn: (r) => r._measurement == "cpu")
+  |> filter(fn: (r) => r["cpu"] == "cpu-total")
+  |> filter(fn: (r) => r._field == "usage_user")
+  |> group(columns: ["_measurement", "_field", "host"])
+  |> aggregateWindow(every: 10s, fn: mean, createEmpty: true)
+`,
+		},
+		{
+			name: "Raw fields",
+			q:    `SELECT usage_user, usage_system FROM cpu WHERE time > now() - 15m`,
+			opts: FluxOptions{DB: "telegraf"},
+			want: `data = from(bucket: "telegraf")
+  |> range(start: -15m)
+  |> filter(fn: (r) => r._measurement == "cpu")
+
+usage_user = data
+  |> filter(fn: (r) => r._field == "usage_user")
+  |> group(columns: ["_measurement", "_field"])
+  |> sort(columns: ["_time"])
+
+usage_system = data
+  |> filter(fn: (r) => r._field == "usage_system")
+  |> group(columns: ["_measurement", "_field"])
+  |> sort(columns: ["_time"])
+
+union(tables: [usage_user, usage_system])
+`,
+		},
+		{
+			name: "Transformations, selectors, offsets and fill",
+			q:    `SELECT non_negative_derivative(max(bytes_recv), 1s) AS rx, percentile(bytes_sent, 95) FROM net WHERE time >= '2019-01-01T00:00:00Z' AND time < '2019-01-02T00:00:00Z' AND (interface =~ /eth.*/ OR interface = 'lo') GROUP BY time(1m, 30s) fill(previous)`,
+			opts: FluxOptions{DB: "telegraf", RP: "autogen"},
+			want: `data = from(bucket: "telegraf/autogen")
+  |> range(start: 2019-01-01T00:00:00Z, stop: 2019-01-02T00:00:00Z)
+  |> filter(fn: (r) => r._measurement == "net")
+  |> filter(fn: (r) => (r["interface"] =~ /eth.*/ or r["interface"] == "lo"))
+
+rx = data
+  |> filter(fn: (r) => r._field == "bytes_recv")
+  |> group(columns: ["_measurement", "_field"])
+  |> aggregateWindow(every: 1m, offset: 30s, fn: max, createEmpty: true)
+  |> fill(usePrevious: true)
+  |> derivative(unit: 1s, nonNegative: true)
+  |> set(key: "_field", value: "rx")
+
+percentile = data
+  |> filter(fn: (r) => r._field == "bytes_sent")
+  |> group(columns: ["_measurement", "_field"])
+  |> aggregateWindow(every: 1m, offset: 30s, fn: (column, tables=<-) => tables |> quantile(column: column, q: 0.95, method: "exact_selector"), createEmpty: true)
+  |> fill(usePrevious: true)
+
+union(tables: [rx, percentile])
+`,
+		},
+		{
+			name: "Time shift and conditions on field values",
+			q:    `SELECT count(distinct(status)) FROM http WHERE time > now() - 1h AND code > 400 GROUP BY time(5m) fill(0)`,
+			opts: FluxOptions{DB: "web", Shift: "1d"},
+			want: `from(bucket: "web")
+  |> range(start: -25h, stop: -1d)
+  |> filter(fn: (r) => r._measurement == "http")
+  |> filter(fn: (r) => (r._field != "code" or r._value > 400))
+  |> filter(fn: (r) => r._field == "status")
+  |> group(columns: ["_measurement", "_field"])
+  |> aggregateWindow(every: 5m, fn: (column, tables=<-) => tables |> distinct(column: column) |> count(column: column), createEmpty: true)
+  |> fill(value: 0)
+  |> timeShift(duration: 1d)
+`,
+			approximate: true,
+		},
+		{
+			name: "Selectors of all series with order and limits",
+			q:    `SELECT top(value, 3) FROM /disk.*/ WHERE time > now() - 1h GROUP BY * ORDER BY time DESC LIMIT 10 SLIMIT 2`,
+			opts: FluxOptions{DB: "telegraf"},
+			want: `from(bucket: "telegraf")
+  |> range(start: -1h)
+  |> filter(fn: (r) => r._measurement =~ /disk.*/)
+  |> filter(fn: (r) => r._field == "value")
+  |> top(n: 3)
+  |> sort(columns: ["_time"], desc: true)
+  |> limit(n: 10)
+`,
+			approximate: true,
+		},
+		{
+			name: "Custom from",
+			q:    `SELECT last(free) FROM disk`,
+			opts: FluxOptions{
+				DB: "telegraf",
+				From: func(db, rp string) (string, error) {
+					return `bucketID: "0123"`, nil
+				},
+			},
+			want: `from(bucketID: "0123")
+  |> range(start: 1970-01-01T00:00:00Z)
+  |> filter(fn: (r) => r._measurement == "disk")
+  |> filter(fn: (r) => r._field == "free")
+  |> group(columns: ["_measurement", "_field"])
+  |> last()
+`,
+		},
+		{
+			name:    "No database",
+			q:       `SELECT free FROM disk`,
+			wantErr: true,
+		},
+		{
+			name:    "Math",
+			q:       `SELECT used / total FROM disk`,
+			opts:    FluxOptions{DB: "telegraf"},
+			wantErr: true,
+		},
+		{
+			name:    "Time conditions in OR",
+			q:       `SELECT free FROM disk WHERE time > now() - 1h OR host = 'a'`,
+			opts:    FluxOptions{DB: "telegraf"},
+			wantErr: true,
+		},
+		{
+			name:    "SELECT INTO",
+			q:       `SELECT mean(free) INTO disk_1h FROM disk WHERE time > now() - 1d GROUP BY time(1h)`,
+			opts:    FluxOptions{DB: "telegraf"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, err := ParseSelect(tt.q)
+			if err != nil {
+				t.Fatalf("ParseSelect() error = %v", err)
+			}
+			got, err := stmt.ToFlux(tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ToFlux() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Flux != tt.want {
+				t.Errorf("ToFlux() =\n%s\nwant\n%s", got.Flux, tt.want)
+			}
+			if got.Approximate != tt.approximate || got.Approximate != (len(got.Notes) > 0) {
+				t.Errorf("ToFlux() approximate = %v, notes %q, want approximate %v", got.Approximate, got.Notes, tt.approximate)
+			}
+
+			pkg, err := flux.Parse(got.Flux)
+			if err != nil {
+				t.Fatalf("flux.Parse() error = %v", err)
+			}
+			if n := ast.Check(pkg); n > 0 {
+				t.Errorf("ToFlux() is invalid Flux: %v", ast.GetError(pkg))
+			}
+		})
+	}
+}
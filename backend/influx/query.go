@@ -59,6 +59,25 @@ func ParseTime(influxQL string, now time.Time) (time.Duration, error) {
 	return dur, nil
 }
 
+// ReadOnly returns an error unless every statement of the query only reads,
+// which are SELECT statements without INTO and SHOW statements
+func ReadOnly(influxQL string) error {
+	q, err := influxql.ParseQuery(influxQL)
+	if err != nil {
+		return err
+	}
+	for _, stmt := range q.Statements {
+		if sel, ok := stmt.(*influxql.SelectStatement); ok && sel.Target == nil {
+			continue
+		}
+		if strings.HasPrefix(stmt.String(), "SHOW ") {
+			continue
+		}
+		return fmt.Errorf("statement is not a SELECT or SHOW: %s", stmt)
+	}
+	return nil
+}
+
 // Convert changes an InfluxQL query to a QueryConfig
 func Convert(influxQL string) (cloudhub.QueryConfig, error) {
 	itsDashboardTime := false
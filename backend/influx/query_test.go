@@ -839,3 +839,42 @@ func TestParseTime(t *testing.T) {
 		})
 	}
 }
+
+func TestReadOnly(t *testing.T) {
+	tests := []struct {
+		name     string
+		influxQL string
+		wantErr  bool
+	}{
+		{
+			name:     "select",
+			influxQL: `SELECT mean("usage_user") FROM "telegraf"."autogen"."cpu" WHERE time > now() - 1h`,
+		},
+		{
+			name:     "show",
+			influxQL: `SHOW DATABASES; SHOW MEASUREMENTS ON "telegraf"`,
+		},
+		{
+			name:     "select into",
+			influxQL: `SELECT * INTO "copy" FROM "cpu"`,
+			wantErr:  true,
+		},
+		{
+			name:     "drop after a select",
+			influxQL: `SELECT * FROM "cpu"; DROP DATABASE "telegraf"`,
+			wantErr:  true,
+		},
+		{
+			name:     "unparsable",
+			influxQL: `SELEC * FROM "cpu"`,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ReadOnly(tt.influxQL); (err != nil) != tt.wantErr {
+				t.Errorf("ReadOnly() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package influx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/influxdata/influxdb/influxql"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// GetTagKeys returns the tag keys of the measurements of a database, or of
+// the measurement of q
+func (c *Client) GetTagKeys(ctx context.Context, db string, q cloudhub.SchemaQuery) ([]cloudhub.TagKey, error) {
+	results, err := c.schemaQuery(ctx, cloudhub.Query{
+		Command: fmt.Sprintf(`SHOW TAG KEYS ON "%s"%s`, db, schemaFrom(q)),
+		DB:      db,
+		RP:      q.RetentionPolicy,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results.TagKeys(), nil
+}
+
+// GetTagValues returns the sorted values of a tag key, starting with the
+// prefix of q. Values are merged across measurements; at most q.Limit are
+// returned.
+func (c *Client) GetTagValues(ctx context.Context, db, key string, q cloudhub.SchemaQuery) ([]string, error) {
+	show := fmt.Sprintf(`SHOW TAG VALUES ON "%s"%s WITH KEY = %s`, db, schemaFrom(q), influxql.QuoteIdent(key))
+	if q.Prefix != "" {
+		prefix := &influxql.RegexLiteral{Val: regexp.MustCompile("^" + regexp.QuoteMeta(q.Prefix))}
+		show += fmt.Sprintf(" WHERE %s =~ %s", influxql.QuoteIdent(key), prefix.String())
+	}
+	if q.Limit > 0 {
+		show += fmt.Sprintf(" LIMIT %d", q.Limit)
+	}
+
+	results, err := c.schemaQuery(ctx, cloudhub.Query{
+		Command: show,
+		DB:      db,
+		RP:      q.RetentionPolicy,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	values := results.TagValues()
+	if q.Limit > 0 && len(values) > q.Limit {
+		values = values[:q.Limit]
+	}
+	return values, nil
+}
+
+// GetFieldKeys returns the field keys and types of the measurements of a
+// database, or of the measurement of q
+func (c *Client) GetFieldKeys(ctx context.Context, db string, q cloudhub.SchemaQuery) ([]cloudhub.FieldKey, error) {
+	results, err := c.schemaQuery(ctx, cloudhub.Query{
+		Command: fmt.Sprintf(`SHOW FIELD KEYS ON "%s"%s`, db, schemaFrom(q)),
+		DB:      db,
+		RP:      q.RetentionPolicy,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results.FieldKeys(), nil
+}
+
+// GetCardinality counts the series of every measurement of a database, or of
+// the measurement of q. The counts are exact; InfluxDB 1.4 or later is
+// required.
+func (c *Client) GetCardinality(ctx context.Context, db string, q cloudhub.SchemaQuery) (*cloudhub.Cardinality, error) {
+	results, err := c.schemaQuery(ctx, cloudhub.Query{
+		Command: fmt.Sprintf(`SHOW SERIES EXACT CARDINALITY ON "%s"%s`, db, schemaFrom(q)),
+		DB:      db,
+		RP:      q.RetentionPolicy,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results.Cardinality(), nil
+}
+
+// schemaFrom is the FROM clause of the measurement of a schema query
+func schemaFrom(q cloudhub.SchemaQuery) string {
+	if q.Measurement == "" {
+		return ""
+	}
+	m := &influxql.Measurement{
+		RetentionPolicy: q.RetentionPolicy,
+		Name:            q.Measurement,
+	}
+	return " FROM " + m.String()
+}
+
+// schemaQuery runs a SHOW query through the cache of the source. Errors
+// InfluxDB puts within the results are returned, and never cached.
+func (c *Client) schemaQuery(ctx context.Context, q cloudhub.Query) (showResults, error) {
+	octets, _, err := c.Cache.QuerySchema(ctx, c.srcID, q, func() (cloudhub.Response, error) {
+		res, err := c.Query(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		if err := resultsError(res); err != nil {
+			return nil, err
+		}
+		return res, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	results := showResults{}
+	if err := json.Unmarshal(octets, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// TagKeys converts SHOW TAG KEYS to cloudhub TagKeys; the series of every
+// measurement is named after it
+func (r *showResults) TagKeys() []cloudhub.TagKey {
+	res := []cloudhub.TagKey{}
+	for _, u := range *r {
+		for _, s := range u.Series {
+			for _, v := range s.Values {
+				if key, ok := v[0].(string); ok {
+					res = append(res, cloudhub.TagKey{Measurement: s.Name, Key: key})
+				}
+			}
+		}
+	}
+	return res
+}
+
+// TagValues converts SHOW TAG VALUES to the sorted values of all
+// measurements
+func (r *showResults) TagValues() []string {
+	seen := map[string]bool{}
+	res := []string{}
+	for _, u := range *r {
+		for _, s := range u.Series {
+			for _, v := range s.Values {
+				if len(v) < 2 {
+					continue
+				}
+				if value, ok := v[1].(string); ok && !seen[value] {
+					seen[value] = true
+					res = append(res, value)
+				}
+			}
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// FieldKeys converts SHOW FIELD KEYS to cloudhub FieldKeys
+func (r *showResults) FieldKeys() []cloudhub.FieldKey {
+	res := []cloudhub.FieldKey{}
+	for _, u := range *r {
+		for _, s := range u.Series {
+			for _, v := range s.Values {
+				if len(v) < 2 {
+					continue
+				}
+				if key, ok := v[0].(string); !ok {
+					continue
+				} else if typ, ok := v[1].(string); !ok {
+					continue
+				} else {
+					res = append(res, cloudhub.FieldKey{Measurement: s.Name, Key: key, Type: typ})
+				}
+			}
+		}
+	}
+	return res
+}
+
+// Cardinality converts SHOW SERIES EXACT CARDINALITY to the cloudhub
+// Cardinality of the measurements and their sum
+func (r *showResults) Cardinality() *cloudhub.Cardinality {
+	res := &cloudhub.Cardinality{
+		Measurements: []cloudhub.MeasurementCardinality{},
+	}
+	for _, u := range *r {
+		for _, s := range u.Series {
+			for _, v := range s.Values {
+				if count, ok := v[0].(float64); ok {
+					res.Series += int64(count)
+					res.Measurements = append(res.Measurements, cloudhub.MeasurementCardinality{
+						Measurement: s.Name,
+						Series:      int64(count),
+					})
+				}
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,108 @@
+package influx_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/influx"
+	"github.com/snetsystems/cloudhub/backend/log"
+)
+
+func TestClient_Schema(t *testing.T) {
+	var queries []string
+	responses := map[string]string{
+		`SHOW TAG KEYS ON "telegraf"`: `{"results":[{"series":[{"name":"cpu","columns":["tagKey"],"values":[["cpu"],["host"]]},{"name":"mem","columns":["tagKey"],"values":[["host"]]}]}]}`,
+		`SHOW TAG VALUES ON "telegraf" FROM autogen.cpu WITH KEY = host WHERE host =~ /^web\.\// LIMIT 2`: `{"results":[{"series":[{"name":"cpu","columns":["key","value"],"values":[["host","web./b"],["host","web./a"]]}]}]}`,
+		`SHOW TAG VALUES ON "telegraf" WITH KEY = "my host" LIMIT 2`:                                      `{"results":[{"series":[{"name":"cpu","columns":["key","value"],"values":[["my host","b"],["my host","c"]]},{"name":"mem","columns":["key","value"],"values":[["my host","a"],["my host","b"]]}]}]}`,
+		`SHOW FIELD KEYS ON "telegraf" FROM "disk io"`:                                                    `{"results":[{"series":[{"name":"disk io","columns":["fieldKey","fieldType"],"values":[["reads","integer"],["util","float"]]}]}]}`,
+		`SHOW SERIES EXACT CARDINALITY ON "telegraf"`:                                                     `{"results":[{"series":[{"name":"cpu","columns":["count"],"values":[[12]]},{"name":"mem","columns":["count"],"values":[[3]]}]}]}`,
+		`SHOW SERIES EXACT CARDINALITY ON "missing"`:                                                      `{"results":[{"error":"database not found: missing"}]}`,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.FormValue("q")
+		queries = append(queries, q)
+		res, ok := responses[q]
+		if !ok {
+			t.Errorf("unexpected query %q", q)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(res))
+	}))
+	defer ts.Close()
+
+	client := &influx.Client{
+		Logger: log.New(log.DebugLevel),
+		Cache:  influx.NewQueryCache(1 << 20),
+	}
+	ctx := context.Background()
+	if err := client.Connect(ctx, &cloudhub.Source{ID: 1, URL: ts.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	tagKeys, err := client.GetTagKeys(ctx, "telegraf", cloudhub.SchemaQuery{})
+	if err != nil {
+		t.Fatalf("GetTagKeys() error = %v", err)
+	}
+	wantKeys := []cloudhub.TagKey{{Measurement: "cpu", Key: "cpu"}, {Measurement: "cpu", Key: "host"}, {Measurement: "mem", Key: "host"}}
+	if !reflect.DeepEqual(tagKeys, wantKeys) {
+		t.Errorf("GetTagKeys() = %v, want %v", tagKeys, wantKeys)
+	}
+
+	values, err := client.GetTagValues(ctx, "telegraf", "host", cloudhub.SchemaQuery{RetentionPolicy: "autogen", Measurement: "cpu", Prefix: "web./", Limit: 2})
+	if err != nil {
+		t.Fatalf("GetTagValues() error = %v", err)
+	}
+	if want := []string{"web./a", "web./b"}; !reflect.DeepEqual(values, want) {
+		t.Errorf("GetTagValues() = %v, want %v", values, want)
+	}
+	// Values of all measurements are merged before the limit
+	values, err = client.GetTagValues(ctx, "telegraf", "my host", cloudhub.SchemaQuery{Limit: 2})
+	if err != nil {
+		t.Fatalf("GetTagValues() error = %v", err)
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(values, want) {
+		t.Errorf("GetTagValues() of all measurements = %v, want %v", values, want)
+	}
+
+	fields, err := client.GetFieldKeys(ctx, "telegraf", cloudhub.SchemaQuery{Measurement: "disk io"})
+	if err != nil {
+		t.Fatalf("GetFieldKeys() error = %v", err)
+	}
+	wantFields := []cloudhub.FieldKey{{Measurement: "disk io", Key: "reads", Type: "integer"}, {Measurement: "disk io", Key: "util", Type: "float"}}
+	if !reflect.DeepEqual(fields, wantFields) {
+		t.Errorf("GetFieldKeys() = %v, want %v", fields, wantFields)
+	}
+
+	card, err := client.GetCardinality(ctx, "telegraf", cloudhub.SchemaQuery{})
+	if err != nil {
+		t.Fatalf("GetCardinality() error = %v", err)
+	}
+	wantCard := &cloudhub.Cardinality{
+		Series:       15,
+		Measurements: []cloudhub.MeasurementCardinality{{Measurement: "cpu", Series: 12}, {Measurement: "mem", Series: 3}},
+	}
+	if !reflect.DeepEqual(card, wantCard) {
+		t.Errorf("GetCardinality() = %+v, want %+v", card, wantCard)
+	}
+
+	// Results are cached; errors are not
+	if _, err := client.GetTagKeys(ctx, "telegraf", cloudhub.SchemaQuery{}); err != nil {
+		t.Fatalf("GetTagKeys() error = %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetCardinality(ctx, "missing", cloudhub.SchemaQuery{}); err == nil {
+			t.Error("GetCardinality() of a missing database expected error")
+		}
+	}
+	if len(queries) != 7 {
+		t.Errorf("InfluxDB queried %d times, want 7: %q", len(queries), queries)
+	}
+	if stats := client.Cache.Stats(1); stats.Hits != 1 {
+		t.Errorf("cache hits = %d, want 1", stats.Hits)
+	}
+}
@@ -0,0 +1,294 @@
+package influx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb/influxql"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// Template variables set from the time range of a dashboard
+const (
+	TemplateDashboardTime      = ":dashboardTime:"
+	TemplateUpperDashboardTime = ":upperDashboardTime:"
+	TemplateInterval           = ":interval:"
+)
+
+// Template variables of the Flux scripts of a dashboard
+const (
+	FluxDashboardTime      = "dashboardTime"
+	FluxUpperDashboardTime = "upperDashboardTime"
+	FluxInterval           = "autoInterval"
+)
+
+// pointsPerGraph is the number of points the :interval: of a dashboard query
+// aims at, as in the browser
+const pointsPerGraph = 360
+
+// TimeRangeTemplates creates the template variables of the time range of a
+// dashboard. Bounds are InfluxQL time expressions (e.g. 'now() - 1h') or
+// RFC3339 timestamps; upper defaults to now().
+func TimeRangeTemplates(lower, upper string) []cloudhub.TemplateVar {
+	if upper == "" {
+		upper = "now()"
+	}
+	bound := func(tempVar, value string) cloudhub.TemplateVar {
+		typ := "constant"
+		if strings.Contains(value, ":") {
+			typ = "timeStamp"
+		}
+		return cloudhub.TemplateVar{
+			Var: tempVar,
+			Values: []cloudhub.TemplateValue{
+				{
+					Value:    value,
+					Type:     typ,
+					Selected: true,
+				},
+			},
+		}
+	}
+	return []cloudhub.TemplateVar{
+		bound(TemplateDashboardTime, lower),
+		bound(TemplateUpperDashboardTime, upper),
+	}
+}
+
+// TemplateReplace renders the selected values of templates in an InfluxQL
+// query. The :interval: of the query is computed from its time range once
+// every other template is rendered.
+func TemplateReplace(query string, templates []cloudhub.TemplateVar, now time.Time) (string, error) {
+	for _, t := range templates {
+		query = RenderTemplate(query, t)
+	}
+
+	if !strings.Contains(query, TemplateInterval) {
+		return query, nil
+	}
+
+	// Any interval parses; it is replaced once the time range is known
+	dur, err := ParseTime(strings.Replace(query, TemplateInterval, "1ms", -1), now)
+	if err != nil {
+		return "", fmt.Errorf("unable to compute %s: %v", TemplateInterval, err)
+	}
+	return strings.Replace(query, TemplateInterval, Interval(dur), -1), nil
+}
+
+// Interval is the GROUP BY time interval of a dashboard query of dur
+func Interval(dur time.Duration) string {
+	ms := int64((dur.Seconds()*1000)/pointsPerGraph + 0.5)
+	if ms < 1 {
+		ms = 1
+	}
+	return fmt.Sprintf("%dms", ms)
+}
+
+// RenderTemplate renders the selected value of a template in an InfluxQL
+// query the same way the browser does. Identifiers are double quoted and tag
+// values and timestamps single quoted, except within regular expressions.
+func RenderTemplate(query string, t cloudhub.TemplateVar) string {
+	if !strings.Contains(query, t.Var) {
+		return query
+	}
+	value, ok := selectedValue(t)
+	if !ok {
+		return query
+	}
+
+	switch value.Type {
+	case "tagKey", "fieldKey", "measurement", "database":
+		query = replaceInRegex(query, t.Var, value.Value)
+		return strings.Replace(query, t.Var, `"`+value.Value+`"`, -1)
+	case "tagValue", "timeStamp":
+		query = replaceInRegex(query, t.Var, value.Value)
+		return strings.Replace(query, t.Var, `'`+value.Value+`'`, -1)
+	case "csv", "constant", "influxql", "map":
+		return strings.Replace(query, t.Var, value.Value, -1)
+	}
+	return query
+}
+
+func selectedValue(t cloudhub.TemplateVar) (cloudhub.TemplateValue, bool) {
+	for _, v := range t.Values {
+		if v.Selected {
+			return v, true
+		}
+	}
+	return cloudhub.TemplateValue{}, false
+}
+
+// replaceInRegex replaces tempVar unquoted within the regular expressions
+// following =~ and !~
+func replaceInRegex(query, tempVar, value string) string {
+	var b strings.Builder
+	for {
+		i := strings.Index(query, "=~")
+		if j := strings.Index(query, "!~"); j != -1 && (i == -1 || j < i) {
+			i = j
+		}
+		if i == -1 {
+			break
+		}
+		start := strings.Index(query[i:], "/")
+		if start == -1 {
+			break
+		}
+		start += i + 1
+		end := strings.Index(query[start:], "/")
+		if end == -1 {
+			break
+		}
+		end += start
+
+		b.WriteString(query[:start])
+		b.WriteString(strings.Replace(query[start:end], tempVar, value, -1))
+		b.WriteString("/")
+		query = query[end+1:]
+	}
+	b.WriteString(query)
+	return b.String()
+}
+
+// RenderFlux declares the time range variables of a dashboard at the top of
+// a Flux script, after its imports
+func RenderFlux(script, lower, upper string, now time.Time) (string, error) {
+	start, err := fluxTime(lower, now)
+	if err != nil {
+		return "", err
+	}
+	if upper == "" {
+		upper = "now()"
+	}
+	stop, err := fluxTime(upper, now)
+	if err != nil {
+		return "", err
+	}
+
+	vars := []string{
+		fmt.Sprintf("%s = %s", FluxDashboardTime, start),
+		fmt.Sprintf("%s = %s", FluxUpperDashboardTime, stop),
+	}
+	if strings.Contains(script, FluxInterval) {
+		dur, err := ParseTime(fmt.Sprintf("SELECT v FROM m WHERE time > %s AND time < %s", influxQLTime(lower), influxQLTime(upper)), now)
+		if err != nil {
+			return "", err
+		}
+		vars = append(vars, fmt.Sprintf("%s = %s", FluxInterval, Interval(dur)))
+	}
+
+	// Imports must stay the first statements of the script
+	lines := strings.Split(script, "\n")
+	i := 0
+	for ; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line != "" && !strings.HasPrefix(line, "import ") && !strings.HasPrefix(line, "//") {
+			break
+		}
+	}
+	imports := strings.Join(lines[:i], "\n")
+	body := strings.Join(lines[i:], "\n")
+	if imports != "" {
+		imports += "\n"
+	}
+	return imports + strings.Join(vars, "\n") + "\n\n" + body, nil
+}
+
+// fluxTime converts an InfluxQL time bound into a Flux time expression
+func fluxTime(bound string, now time.Time) (string, error) {
+	bound = strings.TrimSpace(bound)
+	if bound == "now()" {
+		return "now()", nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, strings.Trim(bound, `'`)); err == nil {
+		return t.UTC().Format(time.RFC3339Nano), nil
+	}
+	rest := strings.TrimSpace(strings.TrimPrefix(bound, "now()"))
+	if rest != bound && strings.HasPrefix(rest, "-") {
+		dur := strings.TrimSpace(strings.TrimPrefix(rest, "-"))
+		if _, err := ParseTime(fmt.Sprintf("SELECT v FROM m WHERE time > now() - %s", dur), now); err == nil {
+			return "-" + dur, nil
+		}
+	}
+	return "", fmt.Errorf("unknown time bound %q", bound)
+}
+
+// TimeBounds evaluates the InfluxQL time bounds of a dashboard at now; upper
+// defaults to now()
+func TimeBounds(lower, upper string, now time.Time) (time.Time, time.Time, error) {
+	if upper == "" {
+		upper = "now()"
+	}
+	expr, err := influxql.ParseExpr(fmt.Sprintf("time >= %s AND time <= %s", influxQLTime(lower), influxQLTime(upper)))
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid time range: %v", err)
+	}
+	start, end, err := influxql.TimeRange(influxql.Reduce(expr, &influxql.NowValuer{Now: now}))
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if start.IsZero() || end.IsZero() || end.Before(start) {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid time range %s to %s", lower, upper)
+	}
+	return start, end, nil
+}
+
+// influxQLTime quotes timestamps of time bounds
+func influxQLTime(bound string) string {
+	if strings.Contains(bound, ":") && !strings.HasPrefix(bound, "'") {
+		return "'" + bound + "'"
+	}
+	return bound
+}
+
+// MetaQueryValues extracts the choices of a template from the response to
+// its SHOW query: the value column of SHOW TAG VALUES, the first column of
+// any other.
+func MetaQueryValues(res cloudhub.Response) ([]string, error) {
+	octets, err := res.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	var results []struct {
+		Err    string `json:"error"`
+		Series []struct {
+			Columns []string        `json:"columns"`
+			Values  [][]interface{} `json:"values"`
+		} `json:"series"`
+	}
+	if err := json.Unmarshal(octets, &results); err != nil {
+		return nil, err
+	}
+
+	values := []string{}
+	seen := map[string]bool{}
+	for _, r := range results {
+		if r.Err != "" {
+			return nil, errors.New(r.Err)
+		}
+		for _, s := range r.Series {
+			col := 0
+			for i, c := range s.Columns {
+				if c == "value" {
+					col = i
+				}
+			}
+			for _, row := range s.Values {
+				if col >= len(row) {
+					continue
+				}
+				v, ok := row[col].(string)
+				if !ok || seen[v] {
+					continue
+				}
+				seen[v] = true
+				values = append(values, v)
+			}
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,150 @@
+package influx
+
+import (
+	"testing"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+)
+
+func tempVar(name, typ, value string) cloudhub.TemplateVar {
+	return cloudhub.TemplateVar{
+		Var: name,
+		Values: []cloudhub.TemplateValue{
+			{
+				Value: "unselected",
+				Type:  typ,
+			},
+			{
+				Value:    value,
+				Type:     typ,
+				Selected: true,
+			},
+		},
+	}
+}
+
+func TestTemplateReplace(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		query     string
+		templates []cloudhub.TemplateVar
+		want      string
+	}{
+		{
+			name:  "Identifiers and tag values",
+			query: `SELECT :field: FROM :db:."autogen".:measurement: WHERE :tag: = :host:`,
+			templates: []cloudhub.TemplateVar{
+				tempVar(":field:", "fieldKey", "usage_user"),
+				tempVar(":db:", "database", "telegraf"),
+				tempVar(":measurement:", "measurement", "cpu"),
+				tempVar(":tag:", "tagKey", "host"),
+				tempVar(":host:", "tagValue", "server01"),
+			},
+			want: `SELECT "usage_user" FROM "telegraf"."autogen"."cpu" WHERE "host" = 'server01'`,
+		},
+		{
+			name:  "Values within regular expressions are not quoted",
+			query: `SELECT "v" FROM "cpu" WHERE "host" =~ /^:host:$/ AND "cpu" !~ /:cpu:/ AND "dc" = :host:`,
+			templates: []cloudhub.TemplateVar{
+				tempVar(":host:", "tagValue", "server01"),
+				tempVar(":cpu:", "tagValue", "cpu-total"),
+			},
+			want: `SELECT "v" FROM "cpu" WHERE "host" =~ /^server01$/ AND "cpu" !~ /cpu-total/ AND "dc" = 'server01'`,
+		},
+		{
+			name:  "Constants, csv and map values are not quoted",
+			query: `SELECT mean(:field:) FROM "cpu" WHERE "region" = :region: LIMIT :limit:`,
+			templates: []cloudhub.TemplateVar{
+				tempVar(":field:", "csv", `"usage_idle"`),
+				tempVar(":region:", "map", `'us-west'`),
+				tempVar(":limit:", "constant", "10"),
+			},
+			want: `SELECT mean("usage_idle") FROM "cpu" WHERE "region" = 'us-west' LIMIT 10`,
+		},
+		{
+			name:      "Relative time range and interval",
+			query:     `SELECT mean("v") FROM "cpu" WHERE time > :dashboardTime: AND time < :upperDashboardTime: GROUP BY time(:interval:)`,
+			templates: TimeRangeTemplates("now() - 1h", ""),
+			want:      `SELECT mean("v") FROM "cpu" WHERE time > now() - 1h AND time < now() GROUP BY time(10000ms)`,
+		},
+		{
+			name:      "Absolute time range",
+			query:     `SELECT mean("v") FROM "cpu" WHERE time > :dashboardTime: AND time < :upperDashboardTime: GROUP BY time(:interval:)`,
+			templates: TimeRangeTemplates("2020-01-01T00:00:00Z", "2020-01-01T06:00:00Z"),
+			want:      `SELECT mean("v") FROM "cpu" WHERE time > '2020-01-01T00:00:00Z' AND time < '2020-01-01T06:00:00Z' GROUP BY time(60000ms)`,
+		},
+		{
+			name:  "Templates without a selected value are left",
+			query: `SELECT "v" FROM "cpu" WHERE "host" = :host:`,
+			templates: []cloudhub.TemplateVar{
+				{
+					Var:    ":host:",
+					Values: []cloudhub.TemplateValue{{Value: "a", Type: "tagValue"}},
+				},
+			},
+			want: `SELECT "v" FROM "cpu" WHERE "host" = :host:`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := TemplateReplace(tt.query, tt.templates, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("TemplateReplace() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderFlux(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	script := "import \"strings\"\n\nfrom(bucket: \"telegraf\")\n  |> range(start: dashboardTime, stop: upperDashboardTime)\n  |> aggregateWindow(every: autoInterval, fn: mean)"
+
+	got, err := RenderFlux(script, "now() - 1h", "", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "import \"strings\"\n\ndashboardTime = -1h\nupperDashboardTime = now()\nautoInterval = 10000ms\n\nfrom(bucket: \"telegraf\")\n  |> range(start: dashboardTime, stop: upperDashboardTime)\n  |> aggregateWindow(every: autoInterval, fn: mean)"
+	if got != want {
+		t.Errorf("RenderFlux() =\n%s\nwant\n%s", got, want)
+	}
+
+	got, err = RenderFlux(`from(bucket: "telegraf")`, "2020-01-01T00:00:00Z", "2020-01-01T06:00:00Z", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "dashboardTime = 2020-01-01T00:00:00Z\nupperDashboardTime = 2020-01-01T06:00:00Z\n\nfrom(bucket: \"telegraf\")"
+	if got != want {
+		t.Errorf("RenderFlux() absolute =\n%s\nwant\n%s", got, want)
+	}
+
+	if _, err := RenderFlux(script, "yesterday", "", now); err == nil {
+		t.Errorf("RenderFlux() with an unknown time bound did not fail")
+	}
+}
+
+func TestMetaQueryValues(t *testing.T) {
+	res := mocks.NewResponse(`[{"statement_id":0,"series":[{"name":"cpu","columns":["key","value"],"values":[["host","a"],["host","b"]]},{"name":"mem","columns":["key","value"],"values":[["host","a"],["host","c"]]}]}]`, nil)
+	got, err := MetaQueryValues(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0] != "a" || got[1] != "b" || got[2] != "c" {
+		t.Errorf("MetaQueryValues() = %v, want [a b c]", got)
+	}
+
+	res = mocks.NewResponse(`[{"statement_id":0,"series":[{"name":"databases","columns":["name"],"values":[["telegraf"],["_internal"]]}]}]`, nil)
+	if got, err := MetaQueryValues(res); err != nil || len(got) != 2 || got[0] != "telegraf" {
+		t.Errorf("MetaQueryValues() databases = %v, %v", got, err)
+	}
+
+	res = mocks.NewResponse(`[{"statement_id":0,"error":"database not found: nope"}]`, nil)
+	if _, err := MetaQueryValues(res); err == nil {
+		t.Errorf("MetaQueryValues() did not return the error of the statement")
+	}
+}
@@ -0,0 +1,533 @@
+package influx
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb/influxql"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// InfluxDB 2.x keeps points in buckets instead of retention policies of
+// databases. InfluxQL reads a bucket through a DBRP mapping of a database and
+// retention policy to the bucket; buckets without a mapping are read as the
+// database and retention policy of their name, e.g. "telegraf/autogen", or
+// the autogen retention policy of the database of their name.
+
+// autogenRP is the retention policy of buckets named after a database
+const autogenRP = "autogen"
+
+// bucketsPageSize is the number of buckets listed per request
+const bucketsPageSize = 100
+
+type bucket struct {
+	ID             string          `json:"id,omitempty"`
+	OrgID          string          `json:"orgID,omitempty"`
+	Name           string          `json:"name,omitempty"`
+	Type           string          `json:"type,omitempty"`
+	RetentionRules []retentionRule `json:"retentionRules"`
+}
+
+type retentionRule struct {
+	Type                      string `json:"type"`
+	EverySeconds              int64  `json:"everySeconds"`
+	ShardGroupDurationSeconds int64  `json:"shardGroupDurationSeconds,omitempty"`
+}
+
+// dbrp maps a database and retention policy to a bucket. Virtual mappings
+// are not stored by InfluxDB; they come from the name of the bucket.
+type dbrp struct {
+	ID              string `json:"id,omitempty"`
+	OrgID           string `json:"orgID,omitempty"`
+	Org             string `json:"org,omitempty"`
+	Database        string `json:"database"`
+	RetentionPolicy string `json:"retention_policy"`
+	Default         bool   `json:"default"`
+	BucketID        string `json:"bucketID"`
+
+	virtual bool
+	bucket  bucket
+}
+
+// v2Error is the body of the errors of the InfluxDB 2.x API
+type v2Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// v2 sends a request to the InfluxDB 2.x API and decodes the JSON response
+// into out, when given. A body other than an io.Reader is sent as JSON.
+func (c *Client) v2(ctx context.Context, method, path string, params url.Values, body interface{}, out interface{}) error {
+	u := *c.URL
+	u.Path = path
+	u.RawQuery = params.Encode()
+
+	var r io.Reader
+	contentType := "text/plain; charset=utf-8"
+	switch b := body.(type) {
+	case nil:
+	case io.Reader:
+		r = b
+	default:
+		octets, err := json.Marshal(b)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(octets)
+		contentType = "application/json"
+	}
+
+	req, err := http.NewRequest(method, u.String(), r)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if r != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.Authorizer != nil {
+		if err := c.Authorizer.Set(req); err != nil {
+			return err
+		}
+	}
+
+	hc := &http.Client{}
+	if c.InsecureSkipVerify {
+		hc.Transport = skipVerifyTransport
+	} else {
+		hc.Transport = defaultTransport
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return cloudhub.ErrUpstreamTimeout
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	octets, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		var e v2Error
+		if json.Unmarshal(octets, &e) == nil && e.Message != "" {
+			return fmt.Errorf("received status code %d from server: err: %s", resp.StatusCode, e.Message)
+		}
+		return fmt.Errorf("received status code %d from server: err: %s", resp.StatusCode, strings.TrimSpace(string(octets)))
+	}
+	if out == nil || len(octets) == 0 {
+		return nil
+	}
+	return json.Unmarshal(octets, out)
+}
+
+// orgID looks up the ID of the organization of the client
+func (c *Client) orgID(ctx context.Context) (string, error) {
+	var res struct {
+		Orgs []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"orgs"`
+	}
+	if err := c.v2(ctx, "GET", "/api/v2/orgs", url.Values{"org": {c.Org}}, nil, &res); err != nil {
+		return "", err
+	}
+	for _, o := range res.Orgs {
+		if o.Name == c.Org {
+			return o.ID, nil
+		}
+	}
+	return "", fmt.Errorf("organization %s not found", c.Org)
+}
+
+// buckets lists the buckets of the organization, except system buckets
+func (c *Client) buckets(ctx context.Context) ([]bucket, error) {
+	buckets := []bucket{}
+	for offset := 0; ; offset += bucketsPageSize {
+		var res struct {
+			Buckets []bucket `json:"buckets"`
+		}
+		params := url.Values{
+			"org":    {c.Org},
+			"limit":  {fmt.Sprint(bucketsPageSize)},
+			"offset": {fmt.Sprint(offset)},
+		}
+		if err := c.v2(ctx, "GET", "/api/v2/buckets", params, nil, &res); err != nil {
+			return nil, err
+		}
+		for _, b := range res.Buckets {
+			if b.Type != "system" && !strings.HasPrefix(b.Name, "_") {
+				buckets = append(buckets, b)
+			}
+		}
+		if len(res.Buckets) < bucketsPageSize {
+			return buckets, nil
+		}
+	}
+}
+
+// mappings lists the DBRP mappings of the organization, including the
+// virtual mappings of the buckets without one
+func (c *Client) mappings(ctx context.Context) ([]dbrp, error) {
+	buckets, err := c.buckets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var res struct {
+		Content []dbrp `json:"content"`
+	}
+	if err := c.v2(ctx, "GET", "/api/v2/dbrps", url.Values{"org": {c.Org}}, nil, &res); err != nil {
+		return nil, err
+	}
+
+	byID := map[string]bucket{}
+	for _, b := range buckets {
+		byID[b.ID] = b
+	}
+
+	mappings := []dbrp{}
+	mapped := map[string]bool{}
+	for _, m := range res.Content {
+		b, ok := byID[m.BucketID]
+		if !ok {
+			continue
+		}
+		m.bucket = b
+		mapped[b.ID] = true
+		mapped[m.Database+"/"+m.RetentionPolicy] = true
+		mappings = append(mappings, m)
+	}
+	for _, b := range buckets {
+		if mapped[b.ID] {
+			continue
+		}
+		db, rp := b.Name, autogenRP
+		if i := strings.LastIndex(b.Name, "/"); i > 0 {
+			db, rp = b.Name[:i], b.Name[i+1:]
+		}
+		if mapped[db+"/"+rp] {
+			continue
+		}
+		mappings = append(mappings, dbrp{
+			Database:        db,
+			RetentionPolicy: rp,
+			Default:         rp == autogenRP,
+			BucketID:        b.ID,
+			virtual:         true,
+			bucket:          b,
+		})
+	}
+	return mappings, nil
+}
+
+// mapping finds the mapping of a retention policy of a database; an empty
+// rp finds the default one
+func (c *Client) mapping(ctx context.Context, db, rp string) (dbrp, error) {
+	mappings, err := c.mappings(ctx)
+	if err != nil {
+		return dbrp{}, err
+	}
+	var found []dbrp
+	for _, m := range mappings {
+		if m.Database == db {
+			found = append(found, m)
+		}
+	}
+	if len(found) == 0 {
+		return dbrp{}, fmt.Errorf("database not found: %s", db)
+	}
+	for _, m := range found {
+		if (rp == "" && m.Default) || (rp != "" && m.RetentionPolicy == rp) {
+			return m, nil
+		}
+	}
+	if rp == "" && len(found) == 1 {
+		return found[0], nil
+	}
+	return dbrp{}, fmt.Errorf("retention policy not found: %s.%s", db, rp)
+}
+
+// Bucket returns the ID of the InfluxDB 2.x bucket of a retention policy of
+// a database; an empty rp is the default retention policy
+func (c *Client) Bucket(ctx context.Context, db, rp string) (string, error) {
+	m, err := c.mapping(ctx, db, rp)
+	if err != nil {
+		return "", err
+	}
+	return m.BucketID, nil
+}
+
+func (c *Client) allBucketDBs(ctx context.Context) ([]cloudhub.Database, error) {
+	mappings, err := c.mappings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	names := []string{}
+	for _, m := range mappings {
+		if !seen[m.Database] {
+			seen[m.Database] = true
+			names = append(names, m.Database)
+		}
+	}
+	sort.Strings(names)
+
+	dbs := make([]cloudhub.Database, len(names))
+	for i, name := range names {
+		dbs[i] = cloudhub.Database{Name: name}
+	}
+	return dbs, nil
+}
+
+func (c *Client) allBucketRPs(ctx context.Context, db string) ([]cloudhub.RetentionPolicy, error) {
+	mappings, err := c.mappings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rps := []cloudhub.RetentionPolicy{}
+	for _, m := range mappings {
+		if m.Database == db {
+			rps = append(rps, bucketRP(m))
+		}
+	}
+	sort.Slice(rps, func(i, j int) bool { return rps[i].Name < rps[j].Name })
+	return rps, nil
+}
+
+// bucketRP describes a bucket as a retention policy; an infinite retention
+// is 0s like in InfluxDB 1.x
+func bucketRP(m dbrp) cloudhub.RetentionPolicy {
+	rp := cloudhub.RetentionPolicy{
+		Name:        m.RetentionPolicy,
+		Duration:    "0s",
+		Replication: 1,
+		Default:     m.Default,
+	}
+	for _, r := range m.bucket.RetentionRules {
+		if r.Type != "expire" {
+			continue
+		}
+		rp.Duration = (time.Duration(r.EverySeconds) * time.Second).String()
+		if r.ShardGroupDurationSeconds > 0 {
+			rp.ShardDuration = (time.Duration(r.ShardGroupDurationSeconds) * time.Second).String()
+		}
+	}
+	return rp
+}
+
+// retentionRules parses the InfluxQL durations of a retention policy; an
+// empty or INF duration keeps points forever
+func retentionRules(duration, shardDuration string) ([]retentionRule, error) {
+	rule := retentionRule{Type: "expire"}
+	if duration != "" && !strings.EqualFold(duration, "INF") {
+		d, err := influxql.ParseDuration(duration)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration %s: %v", duration, err)
+		}
+		rule.EverySeconds = int64(d / time.Second)
+	}
+	if shardDuration != "" {
+		d, err := influxql.ParseDuration(shardDuration)
+		if err != nil {
+			return nil, fmt.Errorf("invalid shard duration %s: %v", shardDuration, err)
+		}
+		rule.ShardGroupDurationSeconds = int64(d / time.Second)
+	}
+	if rule.EverySeconds == 0 && rule.ShardGroupDurationSeconds == 0 {
+		return []retentionRule{}, nil
+	}
+	return []retentionRule{rule}, nil
+}
+
+// createBucket creates a bucket and maps a retention policy of a database
+// to it
+func (c *Client) createBucket(ctx context.Context, name, db, rp string, rules []retentionRule, isDefault bool) error {
+	orgID, err := c.orgID(ctx)
+	if err != nil {
+		return err
+	}
+	var b bucket
+	err = c.v2(ctx, "POST", "/api/v2/buckets", nil, bucket{
+		OrgID:          orgID,
+		Name:           name,
+		RetentionRules: rules,
+	}, &b)
+	if err != nil {
+		return err
+	}
+	return c.v2(ctx, "POST", "/api/v2/dbrps", nil, dbrp{
+		OrgID:           orgID,
+		Database:        db,
+		RetentionPolicy: rp,
+		Default:         isDefault,
+		BucketID:        b.ID,
+	}, nil)
+}
+
+// dropBucket removes the mapping and the bucket of a retention policy
+func (c *Client) dropBucket(ctx context.Context, m dbrp) error {
+	if !m.virtual {
+		if err := c.v2(ctx, "DELETE", "/api/v2/dbrps/"+m.ID, url.Values{"org": {c.Org}}, nil, nil); err != nil {
+			return err
+		}
+	}
+	return c.v2(ctx, "DELETE", "/api/v2/buckets/"+m.BucketID, nil, nil, nil)
+}
+
+func (c *Client) createBucketDB(ctx context.Context, db *cloudhub.Database) (*cloudhub.Database, error) {
+	rules, err := retentionRules(db.Duration, db.ShardDuration)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.createBucket(ctx, db.Name, db.Name, autogenRP, rules, true); err != nil {
+		return nil, err
+	}
+	return &cloudhub.Database{Name: db.Name}, nil
+}
+
+func (c *Client) dropBucketDB(ctx context.Context, db string) error {
+	mappings, err := c.mappings(ctx)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, m := range mappings {
+		if m.Database != db {
+			continue
+		}
+		found = true
+		if err := c.dropBucket(ctx, m); err != nil {
+			return err
+		}
+	}
+	if !found {
+		return fmt.Errorf("database not found: %s", db)
+	}
+	return nil
+}
+
+func (c *Client) createBucketRP(ctx context.Context, db string, rp *cloudhub.RetentionPolicy) (*cloudhub.RetentionPolicy, error) {
+	rules, err := retentionRules(rp.Duration, rp.ShardDuration)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.createBucket(ctx, db+"/"+rp.Name, db, rp.Name, rules, rp.Default); err != nil {
+		return nil, err
+	}
+	m, err := c.mapping(ctx, db, rp.Name)
+	if err != nil {
+		return nil, err
+	}
+	res := bucketRP(m)
+	return &res, nil
+}
+
+func (c *Client) updateBucketRP(ctx context.Context, db, rp string, upd *cloudhub.RetentionPolicy) (*cloudhub.RetentionPolicy, error) {
+	if upd.Name != "" && upd.Name != rp {
+		return nil, fmt.Errorf("retention policies of InfluxDB 2.x cannot be renamed")
+	}
+	m, err := c.mapping(ctx, db, rp)
+	if err != nil {
+		return nil, err
+	}
+
+	if upd.Duration != "" || upd.ShardDuration != "" {
+		current := bucketRP(m)
+		duration, shardDuration := upd.Duration, upd.ShardDuration
+		if duration == "" {
+			duration = current.Duration
+		}
+		if shardDuration == "" {
+			shardDuration = current.ShardDuration
+		}
+		rules, err := retentionRules(duration, shardDuration)
+		if err != nil {
+			return nil, err
+		}
+		err = c.v2(ctx, "PATCH", "/api/v2/buckets/"+m.BucketID, nil, bucket{RetentionRules: rules}, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if upd.Default && !m.Default {
+		if m.virtual {
+			err = c.createMapping(ctx, m)
+		} else {
+			err = c.v2(ctx, "PATCH", "/api/v2/dbrps/"+m.ID, url.Values{"org": {c.Org}}, map[string]bool{"default": true}, nil)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if m, err = c.mapping(ctx, db, rp); err != nil {
+		return nil, err
+	}
+	res := bucketRP(m)
+	return &res, nil
+}
+
+// createMapping stores a virtual mapping as the default of its database
+func (c *Client) createMapping(ctx context.Context, m dbrp) error {
+	return c.v2(ctx, "POST", "/api/v2/dbrps", nil, dbrp{
+		OrgID:           m.bucket.OrgID,
+		Org:             c.Org,
+		Database:        m.Database,
+		RetentionPolicy: m.RetentionPolicy,
+		Default:         true,
+		BucketID:        m.BucketID,
+	}, nil)
+}
+
+func (c *Client) dropBucketRP(ctx context.Context, db, rp string) error {
+	m, err := c.mapping(ctx, db, rp)
+	if err != nil {
+		return err
+	}
+	return c.dropBucket(ctx, m)
+}
+
+// writeBucket writes line protocol to the bucket of a retention policy of a
+// database through the InfluxDB 2.x API
+func (c *Client) writeBucket(ctx context.Context, db, rp, precision, lp string) error {
+	v2Precision, err := V2Precision(precision)
+	if err != nil {
+		return err
+	}
+	bucketID, err := c.Bucket(ctx, db, rp)
+	if err != nil {
+		return err
+	}
+	params := url.Values{
+		"org":       {c.Org},
+		"bucket":    {bucketID},
+		"precision": {v2Precision},
+	}
+	return c.v2(ctx, "POST", "/api/v2/write", params, strings.NewReader(lp), nil)
+}
+
+// V2Precision is the InfluxDB 2.x name of the precision of a write to
+// InfluxDB 1.x. InfluxDB 2.x knows the precisions ns, us, ms and s only.
+func V2Precision(precision string) (string, error) {
+	switch precision {
+	case "", "n", "ns":
+		return "ns", nil
+	case "u", "us":
+		return "us", nil
+	case "ms", "s":
+		return precision, nil
+	}
+	return "", fmt.Errorf("precision %s is not supported by InfluxDB 2.x", precision)
+}
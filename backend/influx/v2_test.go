@@ -0,0 +1,281 @@
+package influx_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/influx"
+	"github.com/snetsystems/cloudhub/backend/log"
+)
+
+// influxV2 is an in-memory stand-in of the InfluxDB 2.x API of one org
+type influxV2 struct {
+	mu      sync.Mutex
+	token   string
+	buckets []map[string]interface{}
+	dbrps   []map[string]interface{}
+	writes  []string
+	nextID  int
+}
+
+func (v *influxV2) id() string {
+	v.nextID++
+	return fmt.Sprintf("%016d", v.nextID)
+}
+
+func (v *influxV2) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if r.URL.Path == "/ping" {
+		w.Header().Set("X-Influxdb-Version", "v2.7.1")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Header.Get("Authorization") != "Token "+v.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"code":"unauthorized","message":"unauthorized access"}`))
+		return
+	}
+	if r.URL.Path != "/api/v2/orgs" && r.URL.Path != "/api/v2/buckets" && !strings.HasPrefix(r.URL.Path, "/api/v2/buckets/") {
+		if r.URL.Query().Get("org") != "snet" && r.Method != "POST" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code":"invalid","message":"org required"}`))
+			return
+		}
+	}
+
+	var body map[string]interface{}
+	octets, _ := ioutil.ReadAll(r.Body)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		json.Unmarshal(octets, &body)
+	}
+
+	reply := func(code int, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(v)
+	}
+	remove := func(items []map[string]interface{}, id string) []map[string]interface{} {
+		kept := []map[string]interface{}{}
+		for _, item := range items {
+			if item["id"] != id {
+				kept = append(kept, item)
+			}
+		}
+		return kept
+	}
+
+	switch {
+	case r.URL.Path == "/api/v2/orgs":
+		reply(http.StatusOK, map[string]interface{}{
+			"orgs": []map[string]string{{"id": "0000000000000org", "name": "snet"}},
+		})
+	case r.URL.Path == "/api/v2/buckets" && r.Method == "GET":
+		buckets := v.buckets
+		if r.URL.Query().Get("offset") != "0" {
+			buckets = nil
+		}
+		reply(http.StatusOK, map[string]interface{}{"buckets": buckets})
+	case r.URL.Path == "/api/v2/buckets" && r.Method == "POST":
+		body["id"] = v.id()
+		body["type"] = "user"
+		v.buckets = append(v.buckets, body)
+		reply(http.StatusCreated, body)
+	case strings.HasPrefix(r.URL.Path, "/api/v2/buckets/") && r.Method == "PATCH":
+		id := strings.TrimPrefix(r.URL.Path, "/api/v2/buckets/")
+		for _, b := range v.buckets {
+			if b["id"] == id {
+				b["retentionRules"] = body["retentionRules"]
+			}
+		}
+		reply(http.StatusOK, body)
+	case strings.HasPrefix(r.URL.Path, "/api/v2/buckets/") && r.Method == "DELETE":
+		v.buckets = remove(v.buckets, strings.TrimPrefix(r.URL.Path, "/api/v2/buckets/"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.URL.Path == "/api/v2/dbrps" && r.Method == "GET":
+		reply(http.StatusOK, map[string]interface{}{"content": v.dbrps})
+	case r.URL.Path == "/api/v2/dbrps" && r.Method == "POST":
+		body["id"] = v.id()
+		if body["default"] == true {
+			for _, m := range v.dbrps {
+				if m["database"] == body["database"] {
+					m["default"] = false
+				}
+			}
+		}
+		v.dbrps = append(v.dbrps, body)
+		reply(http.StatusCreated, body)
+	case strings.HasPrefix(r.URL.Path, "/api/v2/dbrps/") && r.Method == "DELETE":
+		v.dbrps = remove(v.dbrps, strings.TrimPrefix(r.URL.Path, "/api/v2/dbrps/"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.URL.Path == "/api/v2/write":
+		v.writes = append(v.writes, r.URL.Query().Get("bucket")+" "+string(octets))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		reply(http.StatusNotFound, map[string]string{"code": "not found", "message": "path not found"})
+	}
+}
+
+func newInfluxV2(t *testing.T) (*influxV2, *influx.Client, func()) {
+	t.Helper()
+	v2 := &influxV2{
+		token: "secret",
+		buckets: []map[string]interface{}{
+			{"id": "00000000000sys01", "name": "_monitoring", "type": "system"},
+			{"id": "000000000telegraf", "name": "telegraf", "type": "user", "retentionRules": []map[string]interface{}{{"type": "expire", "everySeconds": 604800}}},
+			{"id": "0000000000metrics", "name": "metrics-bucket", "type": "user"},
+		},
+		dbrps: []map[string]interface{}{
+			{"id": "00000000000dbrp01", "database": "metrics", "retention_policy": "forever", "default": true, "bucketID": "0000000000metrics"},
+		},
+	}
+	ts := httptest.NewServer(v2)
+
+	cli := &influx.Client{
+		Logger: log.New(log.DebugLevel),
+	}
+	err := cli.Connect(context.Background(), &cloudhub.Source{
+		URL:       ts.URL,
+		Type:      cloudhub.InfluxDBv2,
+		InfluxOrg: "snet",
+		Token:     "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v2, cli, ts.Close
+}
+
+func TestClient_V2Databases(t *testing.T) {
+	v2, cli, done := newInfluxV2(t)
+	defer done()
+	ctx := context.Background()
+
+	typ, err := cli.Type(ctx)
+	if err != nil || typ != cloudhub.InfluxDBv2 {
+		t.Fatalf("Type() = %q, %v; want %q", typ, err, cloudhub.InfluxDBv2)
+	}
+
+	dbs, err := cli.AllDB(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []cloudhub.Database{{Name: "metrics"}, {Name: "telegraf"}}
+	if !reflect.DeepEqual(dbs, want) {
+		t.Errorf("AllDB() = %v, want %v", dbs, want)
+	}
+
+	rps, err := cli.AllRP(ctx, "telegraf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRPs := []cloudhub.RetentionPolicy{{Name: "autogen", Duration: "168h0m0s", Replication: 1, Default: true}}
+	if !reflect.DeepEqual(rps, wantRPs) {
+		t.Errorf("AllRP(telegraf) = %v, want %v", rps, wantRPs)
+	}
+
+	rp, err := cli.CreateRP(ctx, "telegraf", &cloudhub.RetentionPolicy{Name: "short", Duration: "1d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (cloudhub.RetentionPolicy{Name: "short", Duration: "24h0m0s", Replication: 1}); *rp != want {
+		t.Errorf("CreateRP() = %v, want %v", *rp, want)
+	}
+	if name := v2.buckets[len(v2.buckets)-1]["name"]; name != "telegraf/short" {
+		t.Errorf("CreateRP() created bucket %v, want telegraf/short", name)
+	}
+
+	rp, err = cli.UpdateRP(ctx, "telegraf", "short", &cloudhub.RetentionPolicy{Name: "short", Duration: "2h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rp.Duration != "2h0m0s" {
+		t.Errorf("UpdateRP() duration = %s, want 2h0m0s", rp.Duration)
+	}
+	if _, err := cli.UpdateRP(ctx, "telegraf", "short", &cloudhub.RetentionPolicy{Name: "long"}); err == nil {
+		t.Error("UpdateRP() renamed a retention policy")
+	}
+
+	if _, err := cli.CreateDB(ctx, &cloudhub.Database{Name: "logs"}); err != nil {
+		t.Fatal(err)
+	}
+	if rps, err := cli.AllRP(ctx, "logs"); err != nil || len(rps) != 1 || rps[0].Name != "autogen" || rps[0].Duration != "0s" {
+		t.Errorf("AllRP(logs) = %v, %v", rps, err)
+	}
+
+	if err := cli.DropRP(ctx, "telegraf", "short"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.DropDB(ctx, "metrics"); err != nil {
+		t.Fatal(err)
+	}
+	dbs, err = cli.AllDB(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []cloudhub.Database{{Name: "logs"}, {Name: "telegraf"}}
+	if !reflect.DeepEqual(dbs, want) {
+		t.Errorf("AllDB() = %v, want %v", dbs, want)
+	}
+	if len(v2.dbrps) != 1 {
+		t.Errorf("DBRP mappings = %v, want the mapping of logs only", v2.dbrps)
+	}
+}
+
+func TestClient_V2Write(t *testing.T) {
+	v2, cli, done := newInfluxV2(t)
+	defer done()
+	ctx := context.Background()
+
+	err := cli.Write(ctx, []cloudhub.Point{
+		{
+			Database:        "metrics",
+			RetentionPolicy: "forever",
+			Measurement:     "cpu",
+			Fields:          map[string]interface{}{"value": int64(1)},
+			Time:            1,
+		},
+		{
+			Database:    "telegraf",
+			Measurement: "mem",
+			Fields:      map[string]interface{}{"used": int64(2)},
+			Time:        2,
+		},
+		{
+			Database:    "created",
+			Measurement: "disk",
+			Fields:      map[string]interface{}{"free": int64(3)},
+			Time:        3,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created, err := cli.Bucket(ctx, "created", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"0000000000metrics cpu value=1i 1",
+		"000000000telegraf mem used=2i 2",
+		created + " disk free=3i 3",
+	}
+	if !reflect.DeepEqual(v2.writes, want) {
+		t.Errorf("writes = %q, want %q", v2.writes, want)
+	}
+
+	if _, err := cli.Bucket(ctx, "telegraf", "missing"); err == nil {
+		t.Error("Bucket() found a missing retention policy")
+	}
+}
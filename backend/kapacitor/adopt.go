@@ -0,0 +1,409 @@
+package kapacitor
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	client "github.com/influxdata/kapacitor/client/v1"
+	"github.com/influxdata/kapacitor/pipeline"
+	"github.com/influxdata/kapacitor/tick/ast"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// Analysis describes how much of a TICKscript not written by CloudHub could
+// be mapped into an AlertRule
+type Analysis struct {
+	Rule       cloudhub.AlertRule `json:"rule"`       // Rule is everything that could be extracted from the script
+	Confidence float64            `json:"confidence"` // Confidence ranges from 0, nothing mapped, to 1, fully mapped
+	Adoptable  bool               `json:"adoptable"`  // Adoptable is true if Rule is complete enough to generate a TICKscript
+	Unmapped   []string           `json:"unmapped"`   // Unmapped lists the parts of the script that would be lost by the rule
+}
+
+// defaultMessage and defaultDetails are set by kapacitor on alert nodes
+// without a message or details
+const (
+	defaultMessage = "{{ .ID }} is {{ .Level }}"
+	defaultDetails = "{{ json . }}"
+)
+
+// required are the parts of a rule needed to generate a TICKscript. Each one
+// found raises the confidence of the analysis.
+var required = []string{"database", "retention policy", "measurement", "field", "trigger"}
+
+// Analyze extracts an AlertRule from a TICKscript of any origin. Scripts
+// generated by CloudHub are mapped fully; others are walked node by node and
+// each node or property that has no AlertRule equivalent lowers the
+// confidence of the analysis and is reported as unmapped.
+func Analyze(id string, script cloudhub.TICKScript) Analysis {
+	if rule, err := Reverse(script); err == nil {
+		rule.ID = id
+		rule.TICKScript = script
+		return Analysis{
+			Rule:       rule,
+			Confidence: 1,
+			Adoptable:  true,
+			Unmapped:   []string{},
+		}
+	}
+
+	a := &analyzer{
+		rule: cloudhub.AlertRule{
+			ID:         id,
+			Name:       id,
+			TICKScript: script,
+			Query: &cloudhub.QueryConfig{
+				Tags: map[string][]string{},
+			},
+		},
+		found:    map[string]bool{},
+		unmapped: []string{},
+	}
+
+	p, err := newPipeline(script)
+	if err != nil {
+		return Analysis{
+			Rule: cloudhub.AlertRule{
+				ID:         id,
+				Name:       id,
+				TICKScript: script,
+			},
+			Unmapped: []string{fmt.Sprintf("invalid TICKscript: %v", err)},
+		}
+	}
+
+	_ = p.Walk(a.walk)
+	a.resolveField()
+	return a.analysis()
+}
+
+type analyzer struct {
+	rule     cloudhub.AlertRule
+	found    map[string]bool
+	unmapped []string
+
+	froms     int
+	alerts    int
+	field     string // field selected by eval or directly referenced by the alert
+	aggregate *pipeline.InfluxQLNode
+	valueRef  string // reference used within the crit lambda
+	period    string
+}
+
+func (a *analyzer) unmap(format string, args ...interface{}) {
+	a.unmapped = append(a.unmapped, fmt.Sprintf(format, args...))
+}
+
+func (a *analyzer) walk(n pipeline.Node) error {
+	switch node := n.(type) {
+	case *pipeline.StreamNode:
+	case *pipeline.FromNode:
+		a.from(node)
+	case *pipeline.WindowNode:
+		a.period = node.Period.String()
+		a.rule.Every = node.Every.String()
+		if node.PeriodCount > 0 || node.EveryCount > 0 {
+			a.unmap("window by point count")
+		}
+	case *pipeline.InfluxQLNode:
+		if a.aggregate != nil {
+			a.unmap("%s aggregate", node.Method)
+			return nil
+		}
+		a.aggregate = node
+	case *pipeline.EvalNode:
+		a.eval(node)
+	case *pipeline.AlertNode:
+		a.alert(node)
+	case *pipeline.HTTPOutNode, *pipeline.InfluxDBOutNode:
+		// Outputs are generated by CloudHub for every rule
+	default:
+		a.unmap("%s node", n.Desc())
+	}
+	return nil
+}
+
+func (a *analyzer) from(node *pipeline.FromNode) {
+	a.froms++
+	if a.froms > 1 {
+		a.unmap("additional from node of measurement %q", node.Measurement)
+		return
+	}
+
+	q := a.rule.Query
+	q.Database = node.Database
+	q.RetentionPolicy = node.RetentionPolicy
+	q.Measurement = node.Measurement
+	a.found["database"] = q.Database != ""
+	a.found["retention policy"] = q.RetentionPolicy != ""
+	a.found["measurement"] = q.Measurement != ""
+
+	for _, dim := range node.Dimensions {
+		if tag, ok := dim.(string); ok {
+			q.GroupBy.Tags = append(q.GroupBy.Tags, tag)
+		} else {
+			a.unmap("group by %v", dim)
+		}
+	}
+	if node.GroupByMeasurementFlag {
+		a.unmap("group by measurement")
+	}
+	if node.Round != 0 || node.Truncate != 0 {
+		a.unmap("time rounding")
+	}
+
+	if node.Lambda != nil {
+		filter, ok := lambdaWhereFilter(node.Lambda)
+		if !ok {
+			a.unmap("where %s", node.Lambda.ExpressionString())
+			return
+		}
+		q.Tags = filter.TagValues
+		q.AreTagsAccepted = filter.Operator == "=="
+	}
+}
+
+func (a *analyzer) eval(node *pipeline.EvalNode) {
+	// A single reference renamed to another field is how CloudHub selects a
+	// field without an aggregate.
+	if len(node.Lambdas) == 1 {
+		if ref, ok := node.Lambdas[0].Expression.(*ast.ReferenceNode); ok {
+			a.field = ref.Reference
+			return
+		}
+	}
+	for _, l := range node.Lambdas {
+		a.unmap("eval %s", l.ExpressionString())
+	}
+}
+
+func (a *analyzer) alert(node *pipeline.AlertNode) {
+	a.alerts++
+	if a.alerts > 1 {
+		a.unmap("additional alert node")
+		return
+	}
+
+	if node.Message != defaultMessage {
+		a.rule.Message = node.Message
+	}
+	if node.Details != defaultDetails {
+		a.rule.Details = node.Details
+	}
+
+	if node.Info != nil {
+		a.unmap("info level %s", node.Info.ExpressionString())
+	}
+	if node.Warn != nil {
+		a.unmap("warn level %s", node.Warn.ExpressionString())
+	}
+	if node.InfoReset != nil || node.WarnReset != nil || node.CritReset != nil {
+		a.unmap("level resets")
+	}
+	if node.UseFlapping {
+		a.unmap("flapping detection")
+	}
+	if node.Topic != "" {
+		a.unmap("topic %s", node.Topic)
+	}
+	if len(node.Inhibitors) > 0 {
+		a.unmap("inhibitors")
+	}
+
+	if node.Crit == nil {
+		a.unmap("alert without a crit level")
+	} else if !a.crit(node.Crit.Expression) {
+		a.unmap("crit %s", node.Crit.ExpressionString())
+	}
+
+	if err := alertNodes(node, &a.rule); err != nil {
+		a.unmap("alert handlers")
+	}
+}
+
+// crit maps "ref" op value and range comparisons into trigger values
+func (a *analyzer) crit(expr ast.Node) bool {
+	bin, ok := expr.(*ast.BinaryNode)
+	if !ok {
+		return false
+	}
+
+	if ref, value, ok := comparison(bin); ok {
+		op, err := chronoOperator(bin.Operator.String())
+		if err != nil {
+			return false
+		}
+		a.valueRef = ref
+		a.rule.Trigger = Threshold
+		a.rule.TriggerValues.Operator = op
+		a.rule.TriggerValues.Value = value
+		a.found["trigger"] = true
+		return true
+	}
+
+	left, lok := bin.Left.(*ast.BinaryNode)
+	right, rok := bin.Right.(*ast.BinaryNode)
+	if !lok || !rok {
+		return false
+	}
+	lref, lower, lok := comparison(left)
+	rref, upper, rok := comparison(right)
+	if !lok || !rok || lref != rref {
+		return false
+	}
+	op, err := chronoRangeOperators([]string{left.Operator.String(), bin.Operator.String(), right.Operator.String()})
+	if err != nil {
+		return false
+	}
+	a.valueRef = lref
+	a.rule.Trigger = ThresholdRange
+	a.rule.TriggerValues.Operator = op
+	a.rule.TriggerValues.Value = lower
+	a.rule.TriggerValues.RangeValue = upper
+	a.found["trigger"] = true
+	return true
+}
+
+// comparison returns the reference and literal of a "ref" op literal expression
+func comparison(bin *ast.BinaryNode) (string, string, bool) {
+	ref, ok := bin.Left.(*ast.ReferenceNode)
+	if !ok {
+		return "", "", false
+	}
+	switch v := bin.Right.(type) {
+	case *ast.NumberNode:
+		if v.IsInt {
+			return ref.Reference, strconv.FormatInt(v.Int64, 10), true
+		}
+		return ref.Reference, strconv.FormatFloat(v.Float64, 'f', -1, 64), true
+	case *ast.StringNode:
+		return ref.Reference, v.Literal, true
+	}
+	return "", "", false
+}
+
+// resolveField decides which field the crit level compares once all nodes are known
+func (a *analyzer) resolveField() {
+	q := a.rule.Query
+	switch {
+	case a.aggregate != nil:
+		if a.valueRef != "" && a.valueRef != a.aggregate.As {
+			a.unmap("crit on %q instead of the %s aggregate", a.valueRef, a.aggregate.Method)
+		}
+		if len(a.aggregate.Args) > 0 {
+			a.unmap("%s aggregate arguments", a.aggregate.Method)
+		}
+		q.Fields = []cloudhub.Field{
+			{
+				Value: a.aggregate.Method,
+				Type:  "func",
+				Args: []cloudhub.Field{
+					{
+						Value: a.aggregate.Field,
+						Type:  "field",
+					},
+				},
+			},
+		}
+		q.GroupBy.Time = a.period
+		if a.period == "" {
+			a.unmap("%s aggregate without a window", a.aggregate.Method)
+		}
+	case a.field != "":
+		q.Fields = []cloudhub.Field{
+			{
+				Value: a.field,
+				Type:  "field",
+			},
+		}
+	case a.valueRef != "":
+		q.Fields = []cloudhub.Field{
+			{
+				Value: a.valueRef,
+				Type:  "field",
+			},
+		}
+	}
+	a.found["field"] = len(q.Fields) > 0
+}
+
+func (a *analyzer) analysis() Analysis {
+	found := 0
+	for _, part := range required {
+		if a.found[part] {
+			found++
+			continue
+		}
+		a.unmap("no %s found", part)
+	}
+
+	// Every unmapped node or property costs a tenth of the confidence
+	confidence := float64(found) / float64(len(required))
+	confidence -= 0.1 * float64(len(a.unmapped)-(len(required)-found))
+	confidence = math.Max(0, math.Round(confidence*100)/100)
+
+	return Analysis{
+		Rule:       a.rule,
+		Confidence: confidence,
+		Adoptable:  found == len(required),
+		Unmapped:   a.unmapped,
+	}
+}
+
+// Adopt re-owns a task not created by CloudHub under the CloudHub prefix.
+// Kapacitor cannot rename tasks, so a task is created with a generated ID and
+// the original is deleted afterwards. A rule with a query is generated as a
+// CloudHub TICKscript; otherwise the original TICKscript is kept unchanged.
+// The original status of the task is preserved.
+func (c *Client) Adopt(ctx context.Context, id string, rule cloudhub.AlertRule) (*Task, error) {
+	if strings.HasPrefix(id, Prefix) {
+		return nil, fmt.Errorf("task %s is already managed by CloudHub", id)
+	}
+
+	kapa, err := c.kapaClient(c.URL, c.Username, c.Password, c.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	orig, err := kapa.Task(client.Link{Href: c.Href(id)}, nil)
+	if err != nil {
+		return nil, cloudhub.ErrAlertNotFound
+	}
+
+	var opt *client.CreateTaskOptions
+	if rule.Query != nil || IsComposite(rule) {
+		if rule.Name == "" {
+			rule.Name = id
+		}
+		if opt, err = c.createFromQueryConfig(rule); err != nil {
+			return nil, err
+		}
+	} else {
+		gen, err := c.ID.Generate()
+		if err != nil {
+			return nil, err
+		}
+		opt = &client.CreateTaskOptions{
+			ID:         Prefix + gen,
+			Type:       orig.Type,
+			DBRPs:      orig.DBRPs,
+			TICKscript: orig.TICKscript,
+		}
+	}
+	opt.Status = orig.Status
+
+	task, err := kapa.CreateTask(*opt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := kapa.DeleteTask(orig.Link); err != nil {
+		// Leave the original task in place rather than running both
+		_ = kapa.DeleteTask(task.Link)
+		return nil, err
+	}
+
+	return NewTask(&task), nil
+}
@@ -0,0 +1,293 @@
+package kapacitor
+
+import (
+	"context"
+	"testing"
+
+	gocmp "github.com/google/go-cmp/cmp"
+	client "github.com/influxdata/kapacitor/client/v1"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+const foreignTick = `
+stream
+	|from()
+		.database('telegraf')
+		.retentionPolicy('autogen')
+		.measurement('cpu')
+		.groupBy('host')
+		.where(lambda: "cpu" == 'cpu-total')
+	|window()
+		.period(5m)
+		.every(1m)
+	|mean('usage_user')
+	|alert()
+		.crit(lambda: "mean" > 90)
+		.message('cpu is high')
+		.stateChangesOnly()
+		.slack()
+			.channel('#alerts')
+`
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		name       string
+		script     string
+		rule       func(*cloudhub.AlertRule)
+		confidence float64
+		adoptable  bool
+		unmapped   []string
+	}{
+		{
+			name:       "fully mapped",
+			script:     foreignTick,
+			confidence: 1,
+			adoptable:  true,
+			unmapped:   []string{},
+		},
+		{
+			name: "warn level",
+			script: `
+stream
+	|from()
+		.database('telegraf')
+		.retentionPolicy('autogen')
+		.measurement('cpu')
+		.groupBy('host')
+		.where(lambda: "cpu" == 'cpu-total')
+	|window()
+		.period(5m)
+		.every(1m)
+	|mean('usage_user')
+	|alert()
+		.warn(lambda: "mean" > 80)
+		.crit(lambda: "mean" > 90)
+		.message('cpu is high')
+		.stateChangesOnly()
+		.slack()
+			.channel('#alerts')
+`,
+			confidence: 0.9,
+			adoptable:  true,
+			unmapped:   []string{`warn level "mean" > 80`},
+		},
+		{
+			name: "range without aggregate",
+			script: `
+stream
+	|from()
+		.database('telegraf')
+		.retentionPolicy('autogen')
+		.measurement('cpu')
+	|alert()
+		.crit(lambda: "usage_idle" < 10 OR "usage_idle" > 90)
+`,
+			rule: func(r *cloudhub.AlertRule) {
+				r.Trigger = ThresholdRange
+				r.Every = ""
+				r.Message = ""
+				r.TriggerValues = cloudhub.TriggerValues{
+					Operator:   "outside range",
+					Value:      "10",
+					RangeValue: "90",
+				}
+				r.AlertNodes = cloudhub.AlertNodes{}
+				r.Query.Tags = map[string][]string{}
+				r.Query.AreTagsAccepted = false
+				r.Query.GroupBy = cloudhub.GroupBy{}
+				r.Query.Fields = []cloudhub.Field{
+					{
+						Value: "usage_idle",
+						Type:  "field",
+					},
+				}
+			},
+			confidence: 1,
+			adoptable:  true,
+			unmapped:   []string{},
+		},
+		{
+			name: "unmappable",
+			script: `
+var cpu = stream
+	|from()
+		.measurement('cpu')
+var mem = stream
+	|from()
+		.measurement('mem')
+cpu
+	|join(mem)
+		.as('cpu', 'mem')
+	|alert()
+		.crit(lambda: "cpu.usage" > "mem.used")
+`,
+			confidence: 0,
+			adoptable:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Analyze("cpu_alert", cloudhub.TICKScript(tt.script))
+			if got.Confidence != tt.confidence {
+				t.Errorf("Analyze() confidence = %v, want %v; unmapped %v", got.Confidence, tt.confidence, got.Unmapped)
+			}
+			if got.Adoptable != tt.adoptable {
+				t.Errorf("Analyze() adoptable = %v, want %v", got.Adoptable, tt.adoptable)
+			}
+			if tt.unmapped != nil && !gocmp.Equal(got.Unmapped, tt.unmapped) {
+				t.Errorf("Analyze() unmapped = %v, want %v", got.Unmapped, tt.unmapped)
+			}
+			if !tt.adoptable {
+				return
+			}
+
+			want := cloudhub.AlertRule{
+				ID:         "cpu_alert",
+				Name:       "cpu_alert",
+				Trigger:    Threshold,
+				Every:      "1m0s",
+				Message:    "cpu is high",
+				TICKScript: cloudhub.TICKScript(tt.script),
+				TriggerValues: cloudhub.TriggerValues{
+					Operator: "greater than",
+					Value:    "90",
+				},
+				AlertNodes: cloudhub.AlertNodes{
+					IsStateChangesOnly: true,
+					Slack: []*cloudhub.Slack{
+						{
+							Channel: "#alerts",
+						},
+					},
+				},
+				Query: &cloudhub.QueryConfig{
+					Database:        "telegraf",
+					RetentionPolicy: "autogen",
+					Measurement:     "cpu",
+					Fields: []cloudhub.Field{
+						{
+							Value: "mean",
+							Type:  "func",
+							Args: []cloudhub.Field{
+								{
+									Value: "usage_user",
+									Type:  "field",
+								},
+							},
+						},
+					},
+					Tags: map[string][]string{
+						"cpu": {"cpu-total"},
+					},
+					AreTagsAccepted: true,
+					GroupBy: cloudhub.GroupBy{
+						Time: "5m0s",
+						Tags: []string{"host"},
+					},
+				},
+			}
+			if tt.rule != nil {
+				tt.rule(&want)
+			}
+			if !gocmp.Equal(got.Rule, want) {
+				t.Errorf("Analyze() rule = %s", gocmp.Diff(got.Rule, want))
+			}
+		})
+	}
+}
+
+func TestAnalyze_CloudHubScript(t *testing.T) {
+	rule := compositeRule()
+	tick, err := (&Alert{}).Generate(rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := Analyze("cloudhub-v1-abc", tick)
+	if got.Confidence != 1 || !got.Adoptable || len(got.Unmapped) != 0 {
+		t.Errorf("Analyze() = %v, %v, %v; want fully mapped", got.Confidence, got.Adoptable, got.Unmapped)
+	}
+}
+
+func TestClient_Adopt(t *testing.T) {
+	orig := client.Task{
+		ID:         "cpu_alert",
+		Link:       client.Link{Href: "/kapacitor/v1/tasks/cpu_alert"},
+		Type:       client.StreamTask,
+		Status:     client.Disabled,
+		TICKscript: foreignTick,
+		DBRPs: []client.DBRP{
+			{
+				Database:        "telegraf",
+				RetentionPolicy: "autogen",
+			},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		id      string
+		rule    cloudhub.AlertRule
+		script  bool
+		wantErr string
+	}{
+		{
+			name:   "keep the original script",
+			id:     "cpu_alert",
+			script: true,
+		},
+		{
+			name: "generate from rule",
+			id:   "cpu_alert",
+			rule: Analyze("cpu_alert", foreignTick).Rule,
+		},
+		{
+			name:    "already managed",
+			id:      "cloudhub-v1-abc",
+			wantErr: "task cloudhub-v1-abc is already managed by CloudHub",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kapa := &MockKapa{
+				ResTask: orig,
+			}
+			c := &Client{
+				URL:    "http://kapacitor",
+				ID:     &MockID{ID: "abc"},
+				Ticker: &Alert{},
+				kapaClient: func(url, username, password string, insecureSkipVerify bool) (KapaClient, error) {
+					return kapa, nil
+				},
+			}
+
+			_, err := c.Adopt(context.Background(), tt.id, tt.rule)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("Client.Adopt() error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Client.Adopt() error = %v", err)
+			}
+
+			opt := kapa.CreateTaskOptions
+			if opt.ID != "cloudhub-v1-abc" {
+				t.Errorf("Client.Adopt() created task %s, want cloudhub-v1-abc", opt.ID)
+			}
+			if opt.Status != client.Disabled {
+				t.Errorf("Client.Adopt() did not keep the task status")
+			}
+			if tt.script && opt.TICKscript != foreignTick {
+				t.Errorf("Client.Adopt() changed the TICKscript:\n%s", opt.TICKscript)
+			}
+			if !tt.script && opt.TICKscript == foreignTick {
+				t.Errorf("Client.Adopt() did not generate a TICKscript")
+			}
+			if kapa.Link.Href != orig.Link.Href {
+				t.Errorf("Client.Adopt() deleted %s, want %s", kapa.Link.Href, orig.Link.Href)
+			}
+		})
+	}
+}
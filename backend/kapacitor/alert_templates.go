@@ -0,0 +1,65 @@
+package kapacitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// TemplateVars resolves the values of all variables of an alert template.
+// Values that are not given fall back to the variable default; a variable
+// without either is an error.
+func TemplateVars(tmpl cloudhub.AlertTemplate, values map[string]string) (map[string]string, error) {
+	vars := map[string]string{}
+	for _, v := range tmpl.Vars {
+		if val, ok := values[v.Name]; ok {
+			vars[v.Name] = val
+			continue
+		}
+		if v.Default == "" {
+			return nil, fmt.Errorf("alert template variable %q requires a value", v.Name)
+		}
+		vars[v.Name] = v.Default
+	}
+
+	for name := range values {
+		if _, ok := vars[name]; !ok {
+			return nil, fmt.Errorf("unknown alert template variable %q", name)
+		}
+	}
+	return vars, nil
+}
+
+// RenderTemplate replaces every :name: variable within the rule of the alert
+// template with its value. Variables may appear in any string of the rule,
+// e.g. thresholds, tag values, messages or handler settings.
+func RenderTemplate(tmpl cloudhub.AlertTemplate, values map[string]string) (cloudhub.AlertRule, error) {
+	vars, err := TemplateVars(tmpl, values)
+	if err != nil {
+		return cloudhub.AlertRule{}, err
+	}
+
+	octets, err := json.Marshal(tmpl.Rule)
+	if err != nil {
+		return cloudhub.AlertRule{}, err
+	}
+
+	// Values are escaped so they are always substituted within a JSON string.
+	replacements := make([]string, 0, 2*len(vars))
+	for name, val := range vars {
+		escaped, err := json.Marshal(val)
+		if err != nil {
+			return cloudhub.AlertRule{}, err
+		}
+		replacements = append(replacements, ":"+name+":", string(escaped[1:len(escaped)-1]))
+	}
+	rendered := strings.NewReplacer(replacements...).Replace(string(octets))
+
+	var rule cloudhub.AlertRule
+	if err := json.Unmarshal([]byte(rendered), &rule); err != nil {
+		return cloudhub.AlertRule{}, err
+	}
+	return rule, nil
+}
@@ -0,0 +1,128 @@
+package kapacitor
+
+import (
+	"testing"
+
+	gocmp "github.com/google/go-cmp/cmp"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+func cpuTemplate() cloudhub.AlertTemplate {
+	return cloudhub.AlertTemplate{
+		Name: "cpu high",
+		Rule: cloudhub.AlertRule{
+			Name:    "cpu high on :host:",
+			Trigger: "threshold",
+			Every:   "1m",
+			Message: `{{ .ID }} is "high" on :host:`,
+			Query: &cloudhub.QueryConfig{
+				Database:        "telegraf",
+				RetentionPolicy: "autogen",
+				Measurement:     "cpu",
+				Tags: map[string][]string{
+					"host": {":host:"},
+				},
+				AreTagsAccepted: true,
+			},
+			TriggerValues: cloudhub.TriggerValues{
+				Operator: "greater than",
+				Value:    ":threshold:",
+			},
+			AlertNodes: cloudhub.AlertNodes{
+				Slack: []*cloudhub.Slack{
+					{
+						Channel: ":channel:",
+					},
+				},
+			},
+		},
+		Vars: []cloudhub.AlertTemplateVar{
+			{
+				Name: "host",
+			},
+			{
+				Name:    "threshold",
+				Default: "90",
+			},
+			{
+				Name:    "channel",
+				Default: "#alerts",
+			},
+		},
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	tests := []struct {
+		name   string
+		values map[string]string
+		want   func(*cloudhub.AlertRule)
+		err    string
+	}{
+		{
+			name: "defaults",
+			values: map[string]string{
+				"host": "server01",
+			},
+			want: func(r *cloudhub.AlertRule) {
+				r.Name = "cpu high on server01"
+				r.Message = `{{ .ID }} is "high" on server01`
+				r.Query.Tags["host"] = []string{"server01"}
+				r.TriggerValues.Value = "90"
+				r.AlertNodes.Slack[0].Channel = "#alerts"
+			},
+		},
+		{
+			name: "escaped values",
+			values: map[string]string{
+				"host":      `server "01"`,
+				"threshold": "80",
+				"channel":   "#ops",
+			},
+			want: func(r *cloudhub.AlertRule) {
+				r.Name = `cpu high on server "01"`
+				r.Message = `{{ .ID }} is "high" on server "01"`
+				r.Query.Tags["host"] = []string{`server "01"`}
+				r.TriggerValues.Value = "80"
+				r.AlertNodes.Slack[0].Channel = "#ops"
+			},
+		},
+		{
+			name:   "missing value",
+			values: map[string]string{},
+			err:    `alert template variable "host" requires a value`,
+		},
+		{
+			name: "unknown variable",
+			values: map[string]string{
+				"host":   "server01",
+				"region": "eu",
+			},
+			err: `unknown alert template variable "region"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl := cpuTemplate()
+			got, err := RenderTemplate(tmpl, tt.values)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("RenderTemplate() error = %v, want %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RenderTemplate() error = %v", err)
+			}
+
+			want := cpuTemplate().Rule
+			tt.want(&want)
+			if !gocmp.Equal(got, want) {
+				t.Errorf("RenderTemplate() = %s", gocmp.Diff(got, want))
+			}
+			if tmpl.Rule.Name != "cpu high on :host:" {
+				t.Errorf("RenderTemplate() modified the template rule")
+			}
+		})
+	}
+}
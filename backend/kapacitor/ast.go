@@ -90,20 +90,25 @@ type WhereFilter struct {
 
 var re = regexp.MustCompile(`(?U)"(.*)"\s+(==|!=)\s+'(.*)'`)
 
-func varWhereFilter(vars map[string]tick.Var) (WhereFilter, bool) {
+func varWhereFilter(kapaVar string, vars map[string]tick.Var) (WhereFilter, bool) {
 	// All cloudhub TICKScripts have whereFilters.
-	v, ok := vars["whereFilter"]
+	v, ok := vars[kapaVar]
 	if !ok {
 		return WhereFilter{}, ok
 	}
-	filter := WhereFilter{}
-	filter.TagValues = make(map[string][]string)
-
 	// All cloudhub TICKScript's whereFilter use a lambda function.
 	value, ok := v.Value.(*ast.LambdaNode)
 	if !ok {
 		return WhereFilter{}, ok
 	}
+	return lambdaWhereFilter(value)
+}
+
+// lambdaWhereFilter converts a where lambda of "tag" op 'value' expressions
+// into a WhereFilter
+func lambdaWhereFilter(value *ast.LambdaNode) (WhereFilter, bool) {
+	filter := WhereFilter{}
+	filter.TagValues = make(map[string][]string)
 
 	lambda := value.ExpressionString()
 	// CloudHub TICKScripts use lambda: TRUE as a pass-throug where clause
@@ -213,7 +218,7 @@ func extractCommonVars(vars map[string]tick.Var) (CommonVars, error) {
 	res.GroupBy = groups
 
 	// All cloudhub TICKScripts must have a whereFitler.  Could be empty.
-	res.Filter, ok = varWhereFilter(vars)
+	res.Filter, ok = varWhereFilter("whereFilter", vars)
 	if !ok {
 		return CommonVars{}, ErrNotChronoTickscript
 	}
@@ -369,6 +374,8 @@ func alertType(script cloudhub.TICKScript) (string, error) {
 		return "", ErrNotChronoTickscript
 	} else if strings.Contains(t, `var triggerType = 'deadman'`) {
 		return Deadman, nil
+	} else if strings.Contains(t, `var triggerType = 'composite'`) {
+		return Composite, nil
 	}
 	return "", ErrNotChronoTickscript
 }
@@ -390,6 +397,10 @@ func Reverse(script cloudhub.TICKScript) (cloudhub.AlertRule, error) {
 	}
 	vars := template.Vars()
 
+	if t == Composite {
+		return reverseComposite(script, vars)
+	}
+
 	commonVars, err := extractCommonVars(vars)
 	if err != nil {
 		return rule, err
@@ -499,12 +510,17 @@ func extractAlertNodes(p *pipeline.Pipeline, rule *cloudhub.AlertRule) error {
 	return p.Walk(func(n pipeline.Node) error {
 		switch node := n.(type) {
 		case *pipeline.AlertNode:
-			octets, err := json.MarshalIndent(node, "", "    ")
-			if err != nil {
-				return err
-			}
-			return json.Unmarshal(octets, &rule.AlertNodes)
+			return alertNodes(node, rule)
 		}
 		return nil
 	})
 }
+
+// alertNodes sets the handlers and alert properties of the rule from an alert node
+func alertNodes(node *pipeline.AlertNode, rule *cloudhub.AlertRule) error {
+	octets, err := json.MarshalIndent(node, "", "    ")
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(octets, &rule.AlertNodes)
+}
@@ -35,6 +35,7 @@ type Client struct {
 	ID                 cloudhub.ID
 	Ticker             cloudhub.Ticker
 	kapaClient         func(url, username, password string, insecureSkipVerify bool) (KapaClient, error)
+	configClient       func(url, username, password string, insecureSkipVerify bool) (ConfigClient, error)
 }
 
 // KapaClient represents a connection to a kapacitor instance
@@ -56,6 +57,7 @@ func NewClient(url, username, password string, insecureSkipVerify bool) *Client
 		ID:                 &id.UUID{},
 		Ticker:             &Alert{},
 		kapaClient:         NewKapaClient,
+		configClient:       NewConfigClient,
 	}
 }
 
@@ -122,7 +124,7 @@ func (c *Client) HrefOutput(ID string) string {
 func (c *Client) Create(ctx context.Context, rule cloudhub.AlertRule) (*Task, error) {
 	var opt *client.CreateTaskOptions
 	var err error
-	if rule.Query != nil {
+	if rule.Query != nil || IsComposite(rule) {
 		opt, err = c.createFromQueryConfig(rule)
 	} else {
 		opt, err = c.createFromTick(rule)
@@ -192,7 +194,7 @@ func (c *Client) createFromQueryConfig(rule cloudhub.AlertRule) (*client.CreateT
 	return &client.CreateTaskOptions{
 		ID:         kapaID,
 		Type:       toTask(rule.Query),
-		DBRPs:      []client.DBRP{{Database: rule.Query.Database, RetentionPolicy: rule.Query.RetentionPolicy}},
+		DBRPs:      queryDBRPs(rule),
 		TICKscript: string(script),
 		Status:     client.Enabled,
 	}, nil
@@ -304,7 +306,12 @@ func (c *Client) Get(ctx context.Context, id string) (*Task, error) {
 	href := c.Href(id)
 	task, err := kapa.Task(client.Link{Href: href}, nil)
 	if err != nil {
-		return nil, cloudhub.ErrAlertNotFound
+		// Other errors, such as an unreachable kapacitor, say nothing of
+		// whether the task exists
+		if err.Error() == noTaskExists {
+			return nil, cloudhub.ErrAlertNotFound
+		}
+		return nil, err
 	}
 
 	return NewTask(&task), nil
@@ -323,7 +330,7 @@ func (c *Client) Update(ctx context.Context, href string, rule cloudhub.AlertRul
 	}
 
 	var opt *client.UpdateTaskOptions
-	if rule.Query != nil {
+	if rule.Query != nil || IsComposite(rule) {
 		opt, err = c.updateFromQueryConfig(rule)
 	} else {
 		opt, err = c.updateFromTick(rule)
@@ -358,12 +365,7 @@ func (c *Client) updateFromQueryConfig(rule cloudhub.AlertRule) (*client.UpdateT
 		TICKscript: string(script),
 		Status:     client.Disabled,
 		Type:       toTask(rule.Query),
-		DBRPs: []client.DBRP{
-			{
-				Database:        rule.Query.Database,
-				RetentionPolicy: rule.Query.RetentionPolicy,
-			},
-		},
+		DBRPs:      queryDBRPs(rule),
 	}, nil
 }
 
@@ -392,6 +394,35 @@ func (c *Client) updateFromTick(rule cloudhub.AlertRule) (*client.UpdateTaskOpti
 	}, nil
 }
 
+// queryDBRPs returns the database retention policy pairs read by the queries of the rule
+func queryDBRPs(rule cloudhub.AlertRule) []client.DBRP {
+	if !IsComposite(rule) {
+		return []client.DBRP{
+			{
+				Database:        rule.Query.Database,
+				RetentionPolicy: rule.Query.RetentionPolicy,
+			},
+		}
+	}
+
+	dbrps := []client.DBRP{}
+	seen := map[client.DBRP]bool{}
+	for _, q := range rule.Queries {
+		if q.Query == nil {
+			continue
+		}
+		dbrp := client.DBRP{
+			Database:        q.Query.Database,
+			RetentionPolicy: q.Query.RetentionPolicy,
+		}
+		if !seen[dbrp] {
+			seen[dbrp] = true
+			dbrps = append(dbrps, dbrp)
+		}
+	}
+	return dbrps
+}
+
 func toTask(q *cloudhub.QueryConfig) client.TaskType {
 	if q == nil || q.RawText == nil || *q.RawText == "" {
 		return client.StreamTask
@@ -401,6 +432,20 @@ func toTask(q *cloudhub.QueryConfig) client.TaskType {
 
 // NewKapaClient creates a Kapacitor client connection
 func NewKapaClient(url, username, password string, insecureSkipVerify bool) (KapaClient, error) {
+	clnt, err := newKapacitorClient(url, username, password, insecureSkipVerify)
+	if err != nil {
+		return clnt, err
+	}
+
+	return &PaginatingKapaClient{clnt, FetchRate}, nil
+}
+
+// NewConfigClient creates a client for the configuration and topics of a kapacitor instance
+func NewConfigClient(url, username, password string, insecureSkipVerify bool) (ConfigClient, error) {
+	return newKapacitorClient(url, username, password, insecureSkipVerify)
+}
+
+func newKapacitorClient(url, username, password string, insecureSkipVerify bool) (*client.Client, error) {
 	var creds *client.Credentials
 	if username != "" {
 		creds = &client.Credentials{
@@ -418,16 +463,10 @@ func NewKapaClient(url, username, password string, insecureSkipVerify bool) (Kap
 		transport = defaultTransport
 	}
 
-	clnt, err := client.New(client.Config{
+	return client.New(client.Config{
 		URL:                url,
 		Credentials:        creds,
 		InsecureSkipVerify: insecureSkipVerify,
 		Transport:          transport,
 	})
-
-	if err != nil {
-		return clnt, err
-	}
-
-	return &PaginatingKapaClient{clnt, FetchRate}, nil
 }
@@ -424,7 +424,7 @@ func TestClient_Get(t *testing.T) {
 			},
 			taskOptions: nil,
 			wantErr:     true,
-			resError:    fmt.Errorf("No such task"),
+			resError:    fmt.Errorf("no task exists"),
 			link: client.Link{
 				Href: "/kapacitor/v1/tasks/myid",
 			},
@@ -0,0 +1,365 @@
+package kapacitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb/influxql"
+
+	"github.com/influxdata/kapacitor/pipeline"
+	"github.com/influxdata/kapacitor/tick"
+	"github.com/influxdata/kapacitor/tick/ast"
+	"github.com/influxdata/kapacitor/tick/stateful"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// Composite triggers when a boolean condition across several joined queries is true
+const Composite = "composite"
+
+// queryNameRe restricts composite query names to valid TICKscript identifiers
+var queryNameRe = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*$`)
+
+// CompositeTrigger alerts when the condition across all joined queries is true
+var CompositeTrigger = `
+  var trigger = data
+  |alert()
+    .crit(condition)
+`
+
+// CompositeDurationTrigger alerts when the condition across all joined
+// queries has been true for the duration
+var CompositeDurationTrigger = `
+  var trigger = data
+  |stateDuration(condition)
+    .unit(duration)
+    .as('conditionDuration')
+  |alert()
+    .crit(lambda: "conditionDuration" >= 1)
+`
+
+// compositeDefinition is stored in the definition var of a composite
+// TICKscript, from which Reverse reads the rule back
+type compositeDefinition struct {
+	Queries   []cloudhub.AlertQuery `json:"queries"`
+	Condition string                `json:"condition"`
+	Duration  string                `json:"duration,omitempty"`
+}
+
+func compositeTrigger(rule cloudhub.AlertRule) string {
+	if rule.Duration != "" {
+		return CompositeDurationTrigger
+	}
+	return CompositeTrigger
+}
+
+// IsComposite returns true if the rule joins several named queries
+func IsComposite(rule cloudhub.AlertRule) bool {
+	return rule.Trigger == Composite || len(rule.Queries) > 0
+}
+
+// ValidComposite checks the named queries and condition of a composite rule
+func ValidComposite(rule cloudhub.AlertRule) error {
+	if len(rule.Queries) < 2 {
+		return fmt.Errorf("composite alert requires at least two queries but found %d", len(rule.Queries))
+	}
+
+	n := new(NotEmpty)
+	n.Valid("alert name", rule.Name)
+	n.Valid("condition", rule.Condition)
+	n.Valid("every", rule.Every)
+	if n.Err != nil {
+		return n.Err
+	}
+	if rule.Duration != "" {
+		if d, err := time.ParseDuration(rule.Duration); err != nil || d <= 0 {
+			return fmt.Errorf("invalid composite duration %q", rule.Duration)
+		}
+	}
+
+	names := map[string]bool{}
+	var tags []string
+	for i, q := range rule.Queries {
+		if !queryNameRe.MatchString(q.Name) {
+			return fmt.Errorf("invalid composite query name %q", q.Name)
+		}
+		if names[q.Name] {
+			return fmt.Errorf("duplicate composite query name %q", q.Name)
+		}
+		names[q.Name] = true
+
+		if q.Query == nil {
+			return fmt.Errorf("composite query %q has no query defined", q.Name)
+		}
+		if q.Query.RawText != nil && *q.Query.RawText != "" {
+			return fmt.Errorf("composite query %q cannot use raw InfluxQL", q.Name)
+		}
+		n.Valid(q.Name+" database", q.Query.Database)
+		n.Valid(q.Name+" retention policy", q.Query.RetentionPolicy)
+		n.Valid(q.Name+" measurement", q.Query.Measurement)
+		if n.Err != nil {
+			return n.Err
+		}
+
+		// Joined streams are matched on their groups, so every query must
+		// be grouped by the same tags.
+		groups := append([]string{}, q.Query.GroupBy.Tags...)
+		sort.Strings(groups)
+		if i == 0 {
+			tags = groups
+		} else if strings.Join(tags, ",") != strings.Join(groups, ",") {
+			return fmt.Errorf("composite queries must share the same group by tags")
+		}
+	}
+
+	_, err := compositeCondition(rule)
+	return err
+}
+
+// compositeCondition parses the condition of a composite rule, which must
+// be a single boolean expression over the values of its named queries, and
+// returns it formatted as TICKscript
+func compositeCondition(rule cloudhub.AlertRule) (string, error) {
+	condition, err := ast.ParseLambda(rule.Condition)
+	if err != nil {
+		return "", fmt.Errorf("invalid composite condition: %v", err)
+	}
+	if !boolExpression(condition.Expression) {
+		return "", fmt.Errorf("composite condition %q is not a boolean expression", rule.Condition)
+	}
+
+	values := map[string]bool{}
+	for _, q := range rule.Queries {
+		values[q.Name+".value"] = true
+	}
+	_, err = ast.Walk(condition.Expression, func(n ast.Node) (ast.Node, error) {
+		if ref, ok := n.(*ast.ReferenceNode); ok && !values[ref.Reference] {
+			return nil, fmt.Errorf("composite condition references %q, which is not the value of a query", ref.Reference)
+		}
+		return n, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return condition.ExpressionString(), nil
+}
+
+// boolExpression reports whether a lambda expression evaluates to a boolean
+func boolExpression(n ast.Node) bool {
+	switch n := n.(type) {
+	case *ast.BoolNode:
+		return true
+	case *ast.UnaryNode:
+		return n.Operator == ast.TokenNot && boolExpression(n.Node)
+	case *ast.BinaryNode:
+		if ast.IsLogicalOperator(n.Operator) {
+			return boolExpression(n.Left) && boolExpression(n.Right)
+		}
+		return ast.IsCompOperator(n.Operator)
+	}
+	return false
+}
+
+func compositeVars(rule cloudhub.AlertRule) (string, error) {
+	if err := ValidComposite(rule); err != nil {
+		return "", err
+	}
+	condition, err := compositeCondition(rule)
+	if err != nil {
+		return "", err
+	}
+	definition, err := json.Marshal(compositeDefinition{
+		Queries:   rule.Queries,
+		Condition: condition,
+		Duration:  rule.Duration,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	first := rule.Queries[0].Query
+	names := make([]string, len(rule.Queries))
+	for i, q := range rule.Queries {
+		names[i] = fmt.Sprintf("'%s'", q.Name)
+	}
+
+	common := `
+        var queries = [%s]
+        var groupBy = %s
+        var every = %s
+        var condition = lambda: %s
+
+		var name = '%s'
+		var idVar = %s
+		var message = '%s'
+		var idTag = '%s'
+		var levelTag = '%s'
+		var messageField = '%s'
+		var durationField = '%s'
+
+        var outputDB = '%s'
+        var outputRP = '%s'
+        var outputMeasurement = '%s'
+        var triggerType = '%s'
+        var definition = '%s'
+    `
+	res := fmt.Sprintf(common,
+		strings.Join(names, ","),
+		groupBy(first),
+		rule.Every,
+		condition,
+		Escape(rule.Name),
+		idVar(first),
+		Escape(rule.Message),
+		IDTag,
+		LevelTag,
+		MessageField,
+		DurationField,
+		Escape(first.Database),
+		RP,
+		Measurement,
+		Composite,
+		// Quotes are escaped by JSON so that the definition is a plain string
+		strings.Replace(string(definition), "'", `\u0027`, -1),
+	)
+
+	if rule.Duration != "" {
+		duration, err := time.ParseDuration(rule.Duration)
+		if err != nil {
+			return "", err
+		}
+		res += fmt.Sprintf(`
+        var duration = %s
+    `, influxql.FormatDuration(duration))
+	}
+
+	if rule.Details != "" {
+		res += fmt.Sprintf(`
+        var details = '%s'
+    `, rule.Details)
+	}
+
+	for _, q := range rule.Queries {
+		query := `
+        var %[1]sDB = '%[2]s'
+        var %[1]sRP = '%[3]s'
+        var %[1]sMeasurement = '%[4]s'
+        var %[1]sWhereFilter = %[5]s
+    `
+		res += fmt.Sprintf(query,
+			q.Name,
+			Escape(q.Query.Database),
+			Escape(q.Query.RetentionPolicy),
+			Escape(q.Query.Measurement),
+			whereFilter(q.Query),
+		)
+		if hasFunc(q.Query) {
+			if q.Query.GroupBy.Time == "" {
+				return "", fmt.Errorf("%s group by time cannot be an empty string", q.Name)
+			}
+			res += fmt.Sprintf("var %sPeriod = %s\n", q.Name, q.Query.GroupBy.Time)
+		}
+	}
+	return res, nil
+}
+
+func hasFunc(q *cloudhub.QueryConfig) bool {
+	for _, field := range q.Fields {
+		if field.Type == "func" {
+			return true
+		}
+	}
+	return false
+}
+
+// compositeData streams every named query and joins them into the data var.
+// The value of the first query is kept as the value of the alert.
+func compositeData(rule cloudhub.AlertRule) (string, error) {
+	var data string
+	aliases := make([]string, len(rule.Queries))
+	others := []string{}
+	for i, q := range rule.Queries {
+		fld, err := field(q.Query)
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", q.Name, err)
+		}
+
+		stream := fmt.Sprintf(`var %[1]sData = stream
+    |from()
+        .database(%[1]sDB)
+        .retentionPolicy(%[1]sRP)
+        .measurement(%[1]sMeasurement)
+        .groupBy(groupBy)
+        .where(%[1]sWhereFilter)
+  `, q.Name)
+
+		f := q.Query.Fields[0]
+		if f.Type == "func" {
+			stream += fmt.Sprintf("|window().period(%sPeriod).every(every).align()\n", q.Name)
+			stream += fmt.Sprintf(`|%s('%s').as('value')`, f.Value, fld)
+		} else {
+			stream += fmt.Sprintf(`|eval(lambda: "%s").as('value')`, fld)
+		}
+		data += stream + "\n"
+
+		aliases[i] = fmt.Sprintf("'%s'", q.Name)
+		if i > 0 {
+			others = append(others, q.Name+"Data")
+		}
+	}
+
+	data += fmt.Sprintf(`
+    var data = %sData
+    |join(%s)
+        .as(%s)
+        .tolerance(every)
+    |eval(lambda: "%s.value")
+        .as('value')
+        .keep()
+    `, rule.Queries[0].Name, strings.Join(others, ", "), strings.Join(aliases, ", "), rule.Queries[0].Name)
+	return data, nil
+}
+
+// reverseComposite converts a composite tickscript into an AlertRule
+func reverseComposite(script cloudhub.TICKScript, vars map[string]tick.Var) (cloudhub.AlertRule, error) {
+	rule := cloudhub.AlertRule{
+		Trigger: Composite,
+	}
+
+	var ok bool
+	if rule.Name, ok = varString("name", vars); !ok {
+		return rule, ErrNotChronoTickscript
+	}
+	if rule.Message, ok = varString("message", vars); !ok {
+		return rule, ErrNotChronoTickscript
+	}
+	if rule.Every, ok = varDuration("every", vars); !ok {
+		return rule, ErrNotChronoTickscript
+	}
+	if detail, ok := varString("details", vars); ok {
+		rule.Details = detail
+	}
+
+	v, ok := varString("definition", vars)
+	if !ok {
+		return rule, ErrNotChronoTickscript
+	}
+	var definition compositeDefinition
+	if err := json.Unmarshal([]byte(v), &definition); err != nil {
+		return rule, ErrNotChronoTickscript
+	}
+	rule.Queries = definition.Queries
+	rule.Condition = definition.Condition
+	rule.Duration = definition.Duration
+
+	p, err := pipeline.CreatePipeline(string(script), pipeline.StreamEdge, stateful.NewScope(), &deadman{}, vars)
+	if err != nil {
+		return cloudhub.AlertRule{}, err
+	}
+
+	err = extractAlertNodes(p, &rule)
+	return rule, err
+}
@@ -0,0 +1,253 @@
+package kapacitor
+
+import (
+	"strings"
+	"testing"
+
+	gocmp "github.com/google/go-cmp/cmp"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+func compositeRule() cloudhub.AlertRule {
+	return cloudhub.AlertRule{
+		Name:      "cpu and load",
+		Trigger:   Composite,
+		Every:     "1m0s",
+		Message:   "cpu and load are high",
+		Condition: `"cpu.value" > 90 AND "load.value" > "cores.value" * 2`,
+		AlertNodes: cloudhub.AlertNodes{
+			IsStateChangesOnly: true,
+			Slack: []*cloudhub.Slack{
+				{
+					Channel: "#alerts",
+				},
+			},
+		},
+		Queries: []cloudhub.AlertQuery{
+			{
+				Name: "cpu",
+				Query: &cloudhub.QueryConfig{
+					Database:        "telegraf",
+					RetentionPolicy: "autogen",
+					Measurement:     "cpu",
+					Fields: []cloudhub.Field{
+						{
+							Value: "mean",
+							Type:  "func",
+							Args: []cloudhub.Field{
+								{
+									Value: "usage_user",
+									Type:  "field",
+								},
+							},
+						},
+					},
+					Tags: map[string][]string{
+						"cpu": {"cpu-total"},
+					},
+					AreTagsAccepted: true,
+					GroupBy: cloudhub.GroupBy{
+						Time: "5m0s",
+						Tags: []string{"host"},
+					},
+				},
+			},
+			{
+				Name: "load",
+				Query: &cloudhub.QueryConfig{
+					Database:        "telegraf",
+					RetentionPolicy: "autogen",
+					Measurement:     "system",
+					Fields: []cloudhub.Field{
+						{
+							Value: "load5",
+							Type:  "field",
+						},
+					},
+					Tags: map[string][]string{},
+					GroupBy: cloudhub.GroupBy{
+						Tags: []string{"host"},
+					},
+				},
+			},
+			{
+				Name: "cores",
+				Query: &cloudhub.QueryConfig{
+					Database:        "telegraf",
+					RetentionPolicy: "autogen",
+					Measurement:     "system",
+					Fields: []cloudhub.Field{
+						{
+							Value: "n_cpus",
+							Type:  "field",
+						},
+					},
+					Tags: map[string][]string{},
+					GroupBy: cloudhub.GroupBy{
+						Tags: []string{"host"},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestCompositeGenerate(t *testing.T) {
+	gen := Alert{}
+	tick, err := gen.Generate(compositeRule())
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	for _, want := range []string{
+		`var condition = lambda: "cpu.value" > 90 AND "load.value" > "cores.value" * 2`,
+		`var triggerType = 'composite'`,
+		`var cpuPeriod = 5m`,
+		"|join(loadData, coresData)",
+		".as('cpu', 'load', 'cores')",
+		".crit(condition)",
+	} {
+		if !strings.Contains(string(tick), want) {
+			t.Errorf("Generate() missing %q in:\n%s", want, tick)
+		}
+	}
+}
+
+func TestCompositeReverse(t *testing.T) {
+	want := compositeRule()
+	gen := Alert{}
+	tick, err := gen.Generate(want)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	got, err := Reverse(tick)
+	if err != nil {
+		t.Fatalf("Reverse() error = %v", err)
+	}
+	if !gocmp.Equal(got, want) {
+		t.Errorf("Reverse() = %s", gocmp.Diff(got, want))
+	}
+}
+
+func TestCompositeDuration(t *testing.T) {
+	want := compositeRule()
+	want.Duration = "5m0s"
+	gen := Alert{}
+	tick, err := gen.Generate(want)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	for _, want := range []string{
+		`var duration = 5m`,
+		"|stateDuration(condition)",
+		".unit(duration)",
+		`.crit(lambda: "conditionDuration" >= 1)`,
+	} {
+		if !strings.Contains(string(tick), want) {
+			t.Errorf("Generate() missing %q in:\n%s", want, tick)
+		}
+	}
+
+	got, err := Reverse(tick)
+	if err != nil {
+		t.Fatalf("Reverse() error = %v", err)
+	}
+	if !gocmp.Equal(got, want) {
+		t.Errorf("Reverse() = %s", gocmp.Diff(got, want))
+	}
+}
+
+func TestValidComposite(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*cloudhub.AlertRule)
+		err    string
+	}{
+		{
+			name:   "valid",
+			modify: func(r *cloudhub.AlertRule) {},
+		},
+		{
+			name: "single query",
+			modify: func(r *cloudhub.AlertRule) {
+				r.Queries = r.Queries[:1]
+			},
+			err: "composite alert requires at least two queries but found 1",
+		},
+		{
+			name: "duplicate names",
+			modify: func(r *cloudhub.AlertRule) {
+				r.Queries[1].Name = "cpu"
+			},
+			err: `duplicate composite query name "cpu"`,
+		},
+		{
+			name: "invalid name",
+			modify: func(r *cloudhub.AlertRule) {
+				r.Queries[1].Name = "load-5"
+			},
+			err: `invalid composite query name "load-5"`,
+		},
+		{
+			name: "different group by",
+			modify: func(r *cloudhub.AlertRule) {
+				r.Queries[1].Query.GroupBy.Tags = []string{"cluster"}
+			},
+			err: "composite queries must share the same group by tags",
+		},
+		{
+			name: "no every",
+			modify: func(r *cloudhub.AlertRule) {
+				r.Every = ""
+			},
+			err: "every cannot be an empty string",
+		},
+		{
+			name: "condition with statements",
+			modify: func(r *cloudhub.AlertRule) {
+				r.Condition = `"cpu.value" > 90
+var trigger = stream`
+			},
+			err: `invalid composite condition: parser: unexpected var line 2 char 1 in "var trigge". expected: "EOF"`,
+		},
+		{
+			name: "not a boolean condition",
+			modify: func(r *cloudhub.AlertRule) {
+				r.Condition = `"cpu.value" * 2`
+			},
+			err: `composite condition "\"cpu.value\" * 2" is not a boolean expression`,
+		},
+		{
+			name: "unknown query in condition",
+			modify: func(r *cloudhub.AlertRule) {
+				r.Condition = `"cpu.value" > 90 AND "disk.value" > 80`
+			},
+			err: `composite condition references "disk.value", which is not the value of a query`,
+		},
+		{
+			name: "invalid duration",
+			modify: func(r *cloudhub.AlertRule) {
+				r.Duration = "5m\nvar x = 1"
+			},
+			err: `invalid composite duration "5m\nvar x = 1"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := compositeRule()
+			tt.modify(&rule)
+			err := ValidComposite(rule)
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("ValidComposite() error = %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("ValidComposite() error = %v, want %s", err, tt.err)
+			}
+		})
+	}
+}
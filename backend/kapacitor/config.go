@@ -0,0 +1,570 @@
+package kapacitor
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	client "github.com/influxdata/kapacitor/client/v1"
+)
+
+const (
+	configPath       = "/kapacitor/v1/config"
+	serviceTestsPath = "/kapacitor/v1/service-tests"
+	topicsPath       = "/kapacitor/v1/alerts/topics"
+)
+
+// ConfigClient represents a connection to the configuration, service tests
+// and alert topics of a kapacitor instance
+type ConfigClient interface {
+	ConfigSections() (client.ConfigSections, error)
+	ConfigSection(link client.Link) (client.ConfigSection, error)
+	ConfigElement(link client.Link) (client.ConfigElement, error)
+	ConfigUpdate(link client.Link, action client.ConfigUpdateAction) error
+	ServiceTest(link client.Link) (client.ServiceTest, error)
+	DoServiceTest(link client.Link, sto client.ServiceTestOptions) (client.ServiceTestResult, error)
+	ListTopics(opt *client.ListTopicsOptions) (client.Topics, error)
+	ListTopicHandlers(link client.Link, opt *client.ListTopicHandlersOptions) (client.TopicHandlers, error)
+	TopicHandler(link client.Link) (client.TopicHandler, error)
+	CreateTopicHandler(link client.Link, opt client.TopicHandlerOptions) (client.TopicHandler, error)
+	ReplaceTopicHandler(link client.Link, opt client.TopicHandlerOptions) (client.TopicHandler, error)
+	DeleteTopicHandler(link client.Link) error
+}
+
+// HandlerKinds are the kinds of topic handlers kapacitor supports
+var HandlerKinds = []string{
+	"aggregate", "alerta", "exec", "hipchat", "kafka", "log", "mqtt",
+	"opsgenie", "opsgenie2", "pagerduty", "pagerduty2", "post", "publish",
+	"pushover", "sensu", "slack", "smtp", "snmptrap", "talk", "tcp",
+	"telegram", "victorops",
+}
+
+// secretSuffixes mark options holding credentials. Kapacitor redacts these
+// in its configuration but not in topic handlers.
+var secretSuffixes = []string{"password", "token", "secret", "key"}
+
+func isSecret(option string) bool {
+	option = strings.ToLower(option)
+	for _, suffix := range secretSuffixes {
+		if strings.HasSuffix(option, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// handlerSecrets are the options of topic handlers holding credentials
+// without a secret name, by kind: webhook URLs embed their token, and the
+// headers of posts carry their authorization.
+var handlerSecrets = map[string][]string{
+	"discord": {"url"},
+	"post":    {"headers"},
+	"slack":   {"url"},
+	"teams":   {"url"},
+}
+
+// isHandlerSecret reports whether an option of a topic handler holds
+// credentials. Options of nested maps are named by their path, as
+// headers.Authorization.
+func isHandlerSecret(kind, option string) bool {
+	for _, secret := range handlerSecrets[kind] {
+		if option == secret {
+			return true
+		}
+	}
+	if i := strings.LastIndex(option, "."); i >= 0 {
+		option = option[i+1:]
+	}
+	return isSecret(option)
+}
+
+// redactHandlerOptions replaces the credentials of the options of a topic
+// handler with whether they are set, and appends their names to redacted
+func redactHandlerOptions(kind, prefix string, options map[string]interface{}, redacted *[]string) map[string]interface{} {
+	res := make(map[string]interface{}, len(options))
+	for k, v := range options {
+		name := prefix + k
+		switch o := v.(type) {
+		case string:
+			if isHandlerSecret(kind, name) {
+				v = o != ""
+				*redacted = append(*redacted, name)
+			}
+		case map[string]interface{}:
+			if isHandlerSecret(kind, name) {
+				v = len(o) > 0
+				*redacted = append(*redacted, name)
+			} else {
+				v = redactHandlerOptions(kind, name+".", o, redacted)
+			}
+		}
+		res[k] = v
+	}
+	return res
+}
+
+// restoreHandlerOptions replaces the redacted options given as true with
+// their current value
+func restoreHandlerOptions(kind, prefix string, options, current map[string]interface{}) {
+	for k, v := range options {
+		name := prefix + k
+		switch o := v.(type) {
+		case bool:
+			if prev, ok := current[k]; ok && o && isHandlerSecret(kind, name) {
+				options[k] = prev
+			}
+		case map[string]interface{}:
+			if prev, ok := current[k].(map[string]interface{}); ok {
+				restoreHandlerOptions(kind, name+".", o, prev)
+			}
+		}
+	}
+}
+
+// unsetHandlerSecret returns the name of a credential of the options of a
+// topic handler given as whether it is set, or "" if there is none
+func unsetHandlerSecret(kind, prefix string, options map[string]interface{}) string {
+	for k, v := range options {
+		name := prefix + k
+		switch o := v.(type) {
+		case bool:
+			if isHandlerSecret(kind, name) {
+				return name
+			}
+		case map[string]interface{}:
+			if unset := unsetHandlerSecret(kind, name+".", o); unset != "" {
+				return unset
+			}
+		}
+	}
+	return ""
+}
+
+// ServiceConfig is one element of a kapacitor service configuration section
+type ServiceConfig struct {
+	Section  string                 `json:"section"`
+	Element  string                 `json:"element"`  // Element names an entry of list sections such as slack workspaces
+	Options  map[string]interface{} `json:"options"`  // Options are the current values; redacted options are true if set
+	Redacted []string               `json:"redacted"` // Redacted are the options never returned by value
+}
+
+func newServiceConfig(section string, e client.ConfigElement) ServiceConfig {
+	element := strings.TrimPrefix(e.Link.Href, path.Join(configPath, section))
+	cfg := ServiceConfig{
+		Section:  section,
+		Element:  strings.Trim(element, "/"),
+		Options:  map[string]interface{}{},
+		Redacted: []string{},
+	}
+
+	redacted := map[string]bool{}
+	for _, k := range e.Redacted {
+		redacted[k] = true
+	}
+	for k, v := range e.Options {
+		if !redacted[k] && isSecret(k) {
+			if s, ok := v.(string); ok {
+				v = s != ""
+				redacted[k] = true
+			}
+		}
+		cfg.Options[k] = v
+	}
+	for k := range redacted {
+		cfg.Redacted = append(cfg.Redacted, k)
+	}
+	sort.Strings(cfg.Redacted)
+	return cfg
+}
+
+func configElementLink(section, element string) client.Link {
+	href := path.Join(configPath, section, element)
+	if element == "" {
+		href += "/"
+	}
+	return client.Link{Href: href}
+}
+
+// Config returns every service configuration of kapacitor by section
+func (c *Client) Config(ctx context.Context) (map[string][]ServiceConfig, error) {
+	kapa, err := c.configClient(c.URL, c.Username, c.Password, c.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	sections, err := kapa.ConfigSections()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string][]ServiceConfig, len(sections.Sections))
+	for name, section := range sections.Sections {
+		res[name] = serviceConfigs(name, section)
+	}
+	return res, nil
+}
+
+// ConfigSection returns the elements of one service configuration section
+func (c *Client) ConfigSection(ctx context.Context, section string) ([]ServiceConfig, error) {
+	kapa, err := c.configClient(c.URL, c.Username, c.Password, c.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := kapa.ConfigSection(client.Link{Href: path.Join(configPath, section)})
+	if err != nil {
+		return nil, ErrConfigNotFound
+	}
+	return serviceConfigs(section, s), nil
+}
+
+func serviceConfigs(name string, section client.ConfigSection) []ServiceConfig {
+	cfgs := make([]ServiceConfig, len(section.Elements))
+	for i, e := range section.Elements {
+		cfgs[i] = newServiceConfig(name, e)
+	}
+	return cfgs
+}
+
+// ConfigUpdate changes the options of one element of a configuration section
+type ConfigUpdate struct {
+	Element string                 `json:"element"`
+	Set     map[string]interface{} `json:"set"`
+	Delete  []string               `json:"delete"` // Delete reverts options to the value of the kapacitor configuration file
+}
+
+// UpdateConfig validates the update against the current options of the
+// element and applies it. Options keep their type; redacted options are set
+// by string.
+func (c *Client) UpdateConfig(ctx context.Context, section string, upd ConfigUpdate) (*ServiceConfig, error) {
+	kapa, err := c.configClient(c.URL, c.Username, c.Password, c.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	link := configElementLink(section, upd.Element)
+	elem, err := kapa.ConfigElement(link)
+	if err != nil {
+		return nil, ErrConfigNotFound
+	}
+
+	if err := validConfigUpdate(newServiceConfig(section, elem), upd); err != nil {
+		return nil, err
+	}
+
+	if err := kapa.ConfigUpdate(link, client.ConfigUpdateAction{
+		Set:    upd.Set,
+		Delete: upd.Delete,
+	}); err != nil {
+		return nil, err
+	}
+
+	if elem, err = kapa.ConfigElement(link); err != nil {
+		return nil, err
+	}
+	cfg := newServiceConfig(section, elem)
+	return &cfg, nil
+}
+
+func validConfigUpdate(cfg ServiceConfig, upd ConfigUpdate) error {
+	if len(upd.Set) == 0 && len(upd.Delete) == 0 {
+		return invalidf("no options to set or delete")
+	}
+
+	redacted := map[string]bool{}
+	for _, k := range cfg.Redacted {
+		redacted[k] = true
+	}
+	for k, v := range upd.Set {
+		current, ok := cfg.Options[k]
+		if !ok {
+			return invalidf("unknown option %q of %s", k, cfg.Section)
+		}
+		if redacted[k] {
+			if _, ok := v.(string); !ok {
+				return invalidf("option %q of %s must be a string", k, cfg.Section)
+			}
+		} else if !sameType(current, v) {
+			return invalidf("option %q of %s must be of type %s", k, cfg.Section, typeName(current))
+		}
+		if err := validURLOption(k, v); err != nil {
+			return err
+		}
+	}
+	for _, k := range upd.Delete {
+		if _, ok := cfg.Options[k]; !ok {
+			return invalidf("unknown option %q of %s", k, cfg.Section)
+		}
+	}
+	return nil
+}
+
+// sameType compares the JSON types of two option values
+func sameType(current, value interface{}) bool {
+	if current == nil {
+		return true
+	}
+	return typeName(current) == typeName(value)
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// validURLOption checks that options named url hold absolute URLs
+func validURLOption(option string, v interface{}) error {
+	s, ok := v.(string)
+	if !ok || s == "" || !strings.HasSuffix(strings.ToLower(option), "url") {
+		return nil
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return invalidf("option %q must be an absolute URL", option)
+	}
+	return nil
+}
+
+// ServiceTestResult reports whether kapacitor could reach a service
+type ServiceTestResult struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+}
+
+// TestService runs the kapacitor test of a service. Options not given keep
+// the defaults of the service test.
+func (c *Client) TestService(ctx context.Context, service string, options map[string]interface{}) (*ServiceTestResult, error) {
+	kapa, err := c.configClient(c.URL, c.Username, c.Password, c.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	link := client.Link{Href: path.Join(serviceTestsPath, service)}
+	test, err := kapa.ServiceTest(link)
+	if err != nil {
+		return nil, ErrConfigNotFound
+	}
+
+	opts := client.ServiceTestOptions{}
+	for k, v := range test.Options {
+		opts[k] = v
+	}
+	for k, v := range options {
+		if _, ok := test.Options[k]; !ok {
+			return nil, invalidf("unknown test option %q of %s", k, service)
+		}
+		opts[k] = v
+	}
+
+	res, err := kapa.DoServiceTest(link, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &ServiceTestResult{
+		Success: res.Success,
+		Message: res.Message,
+	}, nil
+}
+
+// Topic is an alert topic of kapacitor
+type Topic struct {
+	ID        string `json:"id"`
+	Level     string `json:"level"`     // Level is the highest level of the events of the topic
+	Collected int64  `json:"collected"` // Collected is the number of events collected by the topic
+}
+
+// Topics lists every alert topic of kapacitor
+func (c *Client) Topics(ctx context.Context) ([]Topic, error) {
+	kapa, err := c.configClient(c.URL, c.Username, c.Password, c.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	topics, err := kapa.ListTopics(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Topic, len(topics.Topics))
+	for i, t := range topics.Topics {
+		res[i] = Topic{
+			ID:        t.ID,
+			Level:     t.Level,
+			Collected: t.Collected,
+		}
+	}
+	return res, nil
+}
+
+// TopicHandler is a handler of the events of an alert topic
+type TopicHandler struct {
+	ID       string                 `json:"id"`
+	Kind     string                 `json:"kind"`
+	Options  map[string]interface{} `json:"options"`
+	Match    string                 `json:"match,omitempty"`    // Match is a lambda expression filtering the events handled
+	Redacted []string               `json:"redacted,omitempty"` // Redacted options are reported as true if set
+}
+
+// Valid checks the handler before it is sent to kapacitor
+func (h *TopicHandler) Valid() error {
+	if h.ID == "" {
+		return invalidf("handler id required")
+	}
+	if strings.Contains(h.ID, "/") {
+		return invalidf("handler id %q must not contain /", h.ID)
+	}
+	known := false
+	for _, kind := range HandlerKinds {
+		known = known || kind == h.Kind
+	}
+	if !known {
+		return invalidf("unknown handler kind %q", h.Kind)
+	}
+	if unset := unsetHandlerSecret(h.Kind, "", h.Options); unset != "" {
+		return invalidf("option %q of handler %s requires a value", unset, h.ID)
+	}
+	for k, v := range h.Options {
+		if err := validURLOption(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newTopicHandler(h client.TopicHandler) TopicHandler {
+	res := TopicHandler{
+		ID:    h.ID,
+		Kind:  h.Kind,
+		Match: h.Match,
+	}
+	res.Options = redactHandlerOptions(h.Kind, "", h.Options, &res.Redacted)
+	sort.Strings(res.Redacted)
+	return res
+}
+
+func topicHandlerLink(topic, id string) client.Link {
+	return client.Link{Href: path.Join(topicsPath, topic, "handlers", id)}
+}
+
+// TopicHandlers lists the handlers of an alert topic
+func (c *Client) TopicHandlers(ctx context.Context, topic string) ([]TopicHandler, error) {
+	kapa, err := c.configClient(c.URL, c.Username, c.Password, c.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	handlers, err := kapa.ListTopicHandlers(client.Link{Href: path.Join(topicsPath, topic, "handlers")}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]TopicHandler, len(handlers.Handlers))
+	for i, h := range handlers.Handlers {
+		res[i] = newTopicHandler(h)
+	}
+	return res, nil
+}
+
+// TopicHandler returns one handler of an alert topic
+func (c *Client) TopicHandler(ctx context.Context, topic, id string) (*TopicHandler, error) {
+	kapa, err := c.configClient(c.URL, c.Username, c.Password, c.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := kapa.TopicHandler(topicHandlerLink(topic, id))
+	if err != nil {
+		return nil, ErrTopicHandlerNotFound
+	}
+	res := newTopicHandler(h)
+	return &res, nil
+}
+
+// CreateTopicHandler adds a handler to an alert topic
+func (c *Client) CreateTopicHandler(ctx context.Context, topic string, h TopicHandler) (*TopicHandler, error) {
+	if err := h.Valid(); err != nil {
+		return nil, err
+	}
+
+	kapa, err := c.configClient(c.URL, c.Username, c.Password, c.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := kapa.CreateTopicHandler(client.Link{Href: path.Join(topicsPath, topic, "handlers")}, client.TopicHandlerOptions{
+		Topic:   topic,
+		ID:      h.ID,
+		Kind:    h.Kind,
+		Options: h.Options,
+		Match:   h.Match,
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := newTopicHandler(created)
+	return &res, nil
+}
+
+// ReplaceTopicHandler replaces a handler of an alert topic. Redacted options
+// given as true keep their current value.
+func (c *Client) ReplaceTopicHandler(ctx context.Context, topic, id string, h TopicHandler) (*TopicHandler, error) {
+	kapa, err := c.configClient(c.URL, c.Username, c.Password, c.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	link := topicHandlerLink(topic, id)
+	current, err := kapa.TopicHandler(link)
+	if err != nil {
+		return nil, ErrTopicHandlerNotFound
+	}
+
+	h.ID = id
+	restoreHandlerOptions(h.Kind, "", h.Options, current.Options)
+	if err := h.Valid(); err != nil {
+		return nil, err
+	}
+
+	replaced, err := kapa.ReplaceTopicHandler(link, client.TopicHandlerOptions{
+		Topic:   topic,
+		ID:      h.ID,
+		Kind:    h.Kind,
+		Options: h.Options,
+		Match:   h.Match,
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := newTopicHandler(replaced)
+	return &res, nil
+}
+
+// DeleteTopicHandler removes a handler from an alert topic
+func (c *Client) DeleteTopicHandler(ctx context.Context, topic, id string) error {
+	kapa, err := c.configClient(c.URL, c.Username, c.Password, c.InsecureSkipVerify)
+	if err != nil {
+		return err
+	}
+
+	link := topicHandlerLink(topic, id)
+	if _, err := kapa.TopicHandler(link); err != nil {
+		return ErrTopicHandlerNotFound
+	}
+	return kapa.DeleteTopicHandler(link)
+}
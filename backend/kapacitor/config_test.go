@@ -0,0 +1,341 @@
+package kapacitor
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	gocmp "github.com/google/go-cmp/cmp"
+	client "github.com/influxdata/kapacitor/client/v1"
+)
+
+type MockConfig struct {
+	ConfigClient
+	Element client.ConfigElement
+	Handler client.TopicHandler
+	Test    client.ServiceTest
+
+	Action      *client.ConfigUpdateAction
+	TestOptions client.ServiceTestOptions
+	Replaced    *client.TopicHandlerOptions
+}
+
+func (m *MockConfig) ConfigElement(link client.Link) (client.ConfigElement, error) {
+	if link.Href != m.Element.Link.Href {
+		return client.ConfigElement{}, fmt.Errorf("no element %s", link.Href)
+	}
+	return m.Element, nil
+}
+
+func (m *MockConfig) ConfigUpdate(link client.Link, action client.ConfigUpdateAction) error {
+	m.Action = &action
+	return nil
+}
+
+func (m *MockConfig) ServiceTest(link client.Link) (client.ServiceTest, error) {
+	return m.Test, nil
+}
+
+func (m *MockConfig) DoServiceTest(link client.Link, sto client.ServiceTestOptions) (client.ServiceTestResult, error) {
+	m.TestOptions = sto
+	return client.ServiceTestResult{Success: true}, nil
+}
+
+func (m *MockConfig) TopicHandler(link client.Link) (client.TopicHandler, error) {
+	return m.Handler, nil
+}
+
+func (m *MockConfig) ReplaceTopicHandler(link client.Link, opt client.TopicHandlerOptions) (client.TopicHandler, error) {
+	m.Replaced = &opt
+	return client.TopicHandler{
+		ID:      opt.ID,
+		Kind:    opt.Kind,
+		Options: opt.Options,
+		Match:   opt.Match,
+	}, nil
+}
+
+func newConfigClient(m *MockConfig) *Client {
+	return &Client{
+		URL: "http://kapacitor",
+		configClient: func(url, username, password string, insecureSkipVerify bool) (ConfigClient, error) {
+			return m, nil
+		},
+	}
+}
+
+func TestClient_UpdateConfig(t *testing.T) {
+	elem := client.ConfigElement{
+		Link: client.Link{Href: "/kapacitor/v1/config/smtp/"},
+		Options: map[string]interface{}{
+			"enabled":  false,
+			"host":     "localhost",
+			"port":     float64(25),
+			"password": false,
+			"to":       []interface{}{},
+		},
+		Redacted: []string{"password"},
+	}
+
+	tests := []struct {
+		name    string
+		upd     ConfigUpdate
+		wantErr string
+	}{
+		{
+			name: "set options",
+			upd: ConfigUpdate{
+				Set: map[string]interface{}{
+					"enabled":  true,
+					"port":     float64(587),
+					"password": "hunter2",
+					"to":       []interface{}{"ops@example.com"},
+				},
+			},
+		},
+		{
+			name: "unknown option",
+			upd: ConfigUpdate{
+				Set: map[string]interface{}{"hostname": "mail"},
+			},
+			wantErr: `unknown option "hostname" of smtp`,
+		},
+		{
+			name: "wrong type",
+			upd: ConfigUpdate{
+				Set: map[string]interface{}{"port": "587"},
+			},
+			wantErr: `option "port" of smtp must be of type number`,
+		},
+		{
+			name: "redacted option sent back",
+			upd: ConfigUpdate{
+				Set: map[string]interface{}{"password": true},
+			},
+			wantErr: `option "password" of smtp must be a string`,
+		},
+		{
+			name:    "nothing to update",
+			upd:     ConfigUpdate{},
+			wantErr: "no options to set or delete",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &MockConfig{Element: elem}
+			cfg, err := newConfigClient(m).UpdateConfig(context.Background(), "smtp", tt.upd)
+			if tt.wantErr != "" {
+				if _, ok := err.(InvalidError); !ok || err.Error() != tt.wantErr {
+					t.Fatalf("Client.UpdateConfig() error = %v, want %s", err, tt.wantErr)
+				}
+				if m.Action != nil {
+					t.Errorf("Client.UpdateConfig() sent an invalid update to kapacitor")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Client.UpdateConfig() error = %v", err)
+			}
+			if !gocmp.Equal(m.Action.Set, tt.upd.Set) {
+				t.Errorf("Client.UpdateConfig() sent %v, want %v", m.Action.Set, tt.upd.Set)
+			}
+			if cfg.Section != "smtp" || cfg.Element != "" {
+				t.Errorf("Client.UpdateConfig() returned %s/%s", cfg.Section, cfg.Element)
+			}
+		})
+	}
+}
+
+func TestNewServiceConfig_Redacts(t *testing.T) {
+	cfg := newServiceConfig("slack", client.ConfigElement{
+		Link: client.Link{Href: "/kapacitor/v1/config/slack/ops"},
+		Options: map[string]interface{}{
+			"workspace": "ops",
+			"url":       true,
+			"token":     "xoxb-secret",
+		},
+		Redacted: []string{"url"},
+	})
+
+	want := ServiceConfig{
+		Section: "slack",
+		Element: "ops",
+		Options: map[string]interface{}{
+			"workspace": "ops",
+			"url":       true,
+			"token":     true,
+		},
+		Redacted: []string{"token", "url"},
+	}
+	if !gocmp.Equal(cfg, want) {
+		t.Errorf("newServiceConfig() = %s", gocmp.Diff(cfg, want))
+	}
+}
+
+func TestNewTopicHandler_Redacts(t *testing.T) {
+	tests := []struct {
+		name string
+		h    client.TopicHandler
+		want TopicHandler
+	}{
+		{
+			name: "Webhook URL of slack",
+			h: client.TopicHandler{
+				ID:   "ops",
+				Kind: "slack",
+				Options: map[string]interface{}{
+					"channel": "#ops",
+					"url":     "https://hooks.slack.com/services/T000/B000/XXXX",
+				},
+			},
+			want: TopicHandler{
+				ID:   "ops",
+				Kind: "slack",
+				Options: map[string]interface{}{
+					"channel": "#ops",
+					"url":     true,
+				},
+				Redacted: []string{"url"},
+			},
+		},
+		{
+			name: "Headers of post",
+			h: client.TopicHandler{
+				ID:   "hook",
+				Kind: "post",
+				Options: map[string]interface{}{
+					"url": "http://example.com/alerts",
+					"headers": map[string]interface{}{
+						"Authorization": "Bearer abc123",
+					},
+				},
+			},
+			want: TopicHandler{
+				ID:   "hook",
+				Kind: "post",
+				Options: map[string]interface{}{
+					"url":     "http://example.com/alerts",
+					"headers": true,
+				},
+				Redacted: []string{"headers"},
+			},
+		},
+		{
+			name: "Secrets of nested options",
+			h: client.TopicHandler{
+				ID:   "page",
+				Kind: "alerta",
+				Options: map[string]interface{}{
+					"details": map[string]interface{}{
+						"origin":  "cloudhub",
+						"api-key": "abc123",
+					},
+				},
+			},
+			want: TopicHandler{
+				ID:   "page",
+				Kind: "alerta",
+				Options: map[string]interface{}{
+					"details": map[string]interface{}{
+						"origin":  "cloudhub",
+						"api-key": true,
+					},
+				},
+				Redacted: []string{"details.api-key"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newTopicHandler(tt.h); !gocmp.Equal(got, tt.want) {
+				t.Errorf("newTopicHandler() = %s", gocmp.Diff(got, tt.want))
+			}
+		})
+	}
+}
+
+func TestClient_TestService(t *testing.T) {
+	m := &MockConfig{
+		Test: client.ServiceTest{
+			Name: "slack",
+			Options: client.ServiceTestOptions{
+				"channel": "",
+				"message": "test slack message",
+			},
+		},
+	}
+	c := newConfigClient(m)
+
+	if _, err := c.TestService(context.Background(), "slack", map[string]interface{}{"room": "#ops"}); err == nil {
+		t.Errorf("Client.TestService() accepted an unknown option")
+	}
+
+	res, err := c.TestService(context.Background(), "slack", map[string]interface{}{"channel": "#ops"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := client.ServiceTestOptions{
+		"channel": "#ops",
+		"message": "test slack message",
+	}
+	if !res.Success || !gocmp.Equal(m.TestOptions, want) {
+		t.Errorf("Client.TestService() sent %v, want %v", m.TestOptions, want)
+	}
+}
+
+func TestClient_ReplaceTopicHandler(t *testing.T) {
+	m := &MockConfig{
+		Handler: client.TopicHandler{
+			ID:   "pager",
+			Kind: "pagerduty2",
+			Options: map[string]interface{}{
+				"routing-key": "abc123",
+			},
+		},
+	}
+	c := newConfigClient(m)
+
+	h, err := c.ReplaceTopicHandler(context.Background(), "cpu", "pager", TopicHandler{
+		Kind: "pagerduty2",
+		Options: map[string]interface{}{
+			"routing-key": true,
+		},
+		Match: `"host" == 'server01'`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Replaced.Options["routing-key"]; got != "abc123" {
+		t.Errorf("Client.ReplaceTopicHandler() sent routing-key %v, want the current secret", got)
+	}
+	if h.Options["routing-key"] != true || !gocmp.Equal(h.Redacted, []string{"routing-key"}) {
+		t.Errorf("Client.ReplaceTopicHandler() did not redact the response: %+v", h)
+	}
+
+	m.Handler = client.TopicHandler{
+		ID:   "hook",
+		Kind: "post",
+		Options: map[string]interface{}{
+			"url": "http://example.com/alerts",
+			"headers": map[string]interface{}{
+				"Authorization": "Bearer abc123",
+			},
+		},
+	}
+	if _, err := c.ReplaceTopicHandler(context.Background(), "cpu", "hook", TopicHandler{
+		Kind: "post",
+		Options: map[string]interface{}{
+			"url":     "http://example.com/alerts",
+			"headers": true,
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Replaced.Options["headers"]; !gocmp.Equal(got, m.Handler.Options["headers"]) {
+		t.Errorf("Client.ReplaceTopicHandler() sent headers %v, want the current headers", got)
+	}
+
+	if _, err := c.ReplaceTopicHandler(context.Background(), "cpu", "pager", TopicHandler{Kind: "carrier-pigeon"}); err == nil {
+		t.Errorf("Client.ReplaceTopicHandler() accepted an unknown kind")
+	}
+}
@@ -8,6 +8,9 @@ import (
 
 // Data returns the tickscript data section for querying
 func Data(rule cloudhub.AlertRule) (string, error) {
+	if IsComposite(rule) {
+		return compositeData(rule)
+	}
 	if rule.Query.RawText != nil && *rule.Query.RawText != "" {
 		batch := `
      var data = batch
@@ -1,5 +1,7 @@
 package kapacitor
 
+import "fmt"
+
 // ErrNotChronoTickscript signals a TICKscript that cannot be parsed into
 // CloudHub data structure.
 const ErrNotChronoTickscript = Error("TICKscript not built with CloudHub builder")
@@ -10,3 +12,24 @@ type Error string
 func (e Error) Error() string {
 	return string(e)
 }
+
+// ErrConfigNotFound signals an unknown kapacitor configuration section,
+// element or service test.
+const ErrConfigNotFound = Error("kapacitor configuration not found")
+
+// ErrTopicHandlerNotFound signals an unknown handler of a kapacitor alert topic.
+const ErrTopicHandlerNotFound = Error("topic handler not found")
+
+// noTaskExists is the error kapacitor answers for a task it does not have
+const noTaskExists = "no task exists"
+
+// InvalidError signals a change rejected by CloudHub before it is sent to kapacitor
+type InvalidError string
+
+func (e InvalidError) Error() string {
+	return string(e)
+}
+
+func invalidf(format string, args ...interface{}) error {
+	return InvalidError(fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,205 @@
+package kapacitor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	client "github.com/influxdata/kapacitor/client/v1"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// Actions taken on a task by Import and Mirror
+const (
+	ImportCreated   = "created"
+	ImportUpdated   = "updated"
+	ImportUnchanged = "unchanged"
+	ImportSkipped   = "skipped" // Skipped tasks exist with a different TICKscript and were not overwritten
+	ImportDeleted   = "deleted"
+)
+
+// ImportResult reports what was done with one task
+type ImportResult struct {
+	ID     string `json:"id"`
+	Action string `json:"action,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Export returns every task managed by CloudHub as an alert rule including
+// its TICKscript, type, database retention policies and status
+func (c *Client) Export(ctx context.Context) ([]cloudhub.AlertRule, error) {
+	tasks, err := c.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := []cloudhub.AlertRule{}
+	for id, task := range tasks {
+		if strings.HasPrefix(id, Prefix) {
+			rules = append(rules, task.Rule)
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].ID < rules[j].ID
+	})
+	return rules, nil
+}
+
+// Import creates exported rules as tasks of kapacitor keeping their IDs, so
+// that a rule imported twice updates the same task. The TICKscript of a rule
+// is used as is; rules without one are generated from their query. Tasks
+// that already exist with a different definition are replaced only if
+// overwrite is set.
+func (c *Client) Import(ctx context.Context, rules []cloudhub.AlertRule, overwrite bool) ([]ImportResult, error) {
+	kapa, err := c.kapaClient(c.URL, c.Username, c.Password, c.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]ImportResult, len(rules))
+	for i, rule := range rules {
+		results[i] = ImportResult{
+			ID: rule.ID,
+		}
+		action, err := c.importRule(kapa, rule, overwrite)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		results[i].Action = action
+	}
+	return results, nil
+}
+
+func (c *Client) importRule(kapa KapaClient, rule cloudhub.AlertRule, overwrite bool) (string, error) {
+	if !strings.HasPrefix(rule.ID, Prefix) {
+		return "", fmt.Errorf("task %s is not managed by CloudHub", rule.ID)
+	}
+
+	opt, err := c.importOptions(rule)
+	if err != nil {
+		return "", err
+	}
+
+	link := client.Link{Href: c.Href(rule.ID)}
+	existing, err := kapa.Task(link, nil)
+	if err != nil {
+		if _, err := kapa.CreateTask(*opt); err != nil {
+			return "", err
+		}
+		return ImportCreated, nil
+	}
+
+	if sameTask(existing, opt) {
+		return ImportUnchanged, nil
+	}
+	if !overwrite {
+		return ImportSkipped, nil
+	}
+
+	// Kapacitor reloads a changed TICKscript only when the task is enabled again
+	if _, err := kapa.UpdateTask(link, client.UpdateTaskOptions{
+		Type:       opt.Type,
+		DBRPs:      opt.DBRPs,
+		TICKscript: opt.TICKscript,
+		Status:     client.Disabled,
+	}); err != nil {
+		return "", err
+	}
+	if opt.Status == client.Enabled {
+		if _, err := kapa.UpdateTask(link, client.UpdateTaskOptions{Status: client.Enabled}); err != nil {
+			return "", err
+		}
+	}
+	return ImportUpdated, nil
+}
+
+func (c *Client) importOptions(rule cloudhub.AlertRule) (*client.CreateTaskOptions, error) {
+	if rule.TICKScript != "" {
+		rule.Name = rule.ID
+		return c.createFromTick(rule)
+	}
+	if rule.Query == nil && !IsComposite(rule) {
+		return nil, fmt.Errorf("task %s has neither a TICKscript nor a query", rule.ID)
+	}
+
+	script, err := c.Ticker.Generate(rule)
+	if err != nil {
+		return nil, err
+	}
+	status := client.Enabled
+	if rule.Status != "" {
+		if err := status.UnmarshalText([]byte(rule.Status)); err != nil {
+			return nil, err
+		}
+	}
+	return &client.CreateTaskOptions{
+		ID:         rule.ID,
+		Type:       toTask(rule.Query),
+		DBRPs:      queryDBRPs(rule),
+		TICKscript: string(script),
+		Status:     status,
+	}, nil
+}
+
+// sameTask compares the definition of a task, ignoring its runtime state
+func sameTask(task client.Task, opt *client.CreateTaskOptions) bool {
+	if task.TICKscript != opt.TICKscript || task.Type != opt.Type || task.Status != opt.Status {
+		return false
+	}
+	if len(task.DBRPs) != len(opt.DBRPs) {
+		return false
+	}
+	for i := range task.DBRPs {
+		if task.DBRPs[i] != opt.DBRPs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Mirror makes the CloudHub tasks of standby the same as the CloudHub tasks
+// of c. Tasks are imported into standby overwriting any difference. With
+// prune, CloudHub tasks found only on standby are deleted, unless c has no
+// CloudHub task at all, as when it lost its tasks. Tasks not managed by
+// CloudHub are left alone on both.
+func (c *Client) Mirror(ctx context.Context, standby *Client, prune bool) ([]ImportResult, error) {
+	rules, err := c.Export(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := standby.Export(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := standby.Import(ctx, rules, true)
+	if err != nil {
+		return nil, err
+	}
+	if !prune || len(rules) == 0 {
+		return results, nil
+	}
+
+	primary := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		primary[rule.ID] = true
+	}
+	for _, rule := range current {
+		if primary[rule.ID] {
+			continue
+		}
+		res := ImportResult{
+			ID:     rule.ID,
+			Action: ImportDeleted,
+		}
+		if err := standby.Delete(ctx, standby.Href(rule.ID)); err != nil {
+			res.Action = ""
+			res.Error = err.Error()
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
@@ -0,0 +1,244 @@
+package kapacitor
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"testing"
+
+	gocmp "github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	client "github.com/influxdata/kapacitor/client/v1"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// memKapa keeps the tasks of a fake kapacitor in memory
+type memKapa struct {
+	tasks map[string]client.Task
+}
+
+func newMemKapa(tasks ...client.Task) *memKapa {
+	m := &memKapa{tasks: map[string]client.Task{}}
+	for _, t := range tasks {
+		t.Link = client.Link{Href: "/kapacitor/v1/tasks/" + t.ID}
+		m.tasks[t.ID] = t
+	}
+	return m
+}
+
+func (m *memKapa) CreateTask(opt client.CreateTaskOptions) (client.Task, error) {
+	if _, ok := m.tasks[opt.ID]; ok {
+		return client.Task{}, fmt.Errorf("task %s exists", opt.ID)
+	}
+	t := client.Task{
+		ID:         opt.ID,
+		Link:       client.Link{Href: "/kapacitor/v1/tasks/" + opt.ID},
+		Type:       opt.Type,
+		DBRPs:      opt.DBRPs,
+		TICKscript: opt.TICKscript,
+		Status:     opt.Status,
+	}
+	m.tasks[opt.ID] = t
+	return t, nil
+}
+
+func (m *memKapa) Task(link client.Link, opt *client.TaskOptions) (client.Task, error) {
+	t, ok := m.tasks[path.Base(link.Href)]
+	if !ok {
+		return client.Task{}, fmt.Errorf("no task %s", link.Href)
+	}
+	return t, nil
+}
+
+func (m *memKapa) ListTasks(opt *client.ListTasksOptions) ([]client.Task, error) {
+	tasks := []client.Task{}
+	for _, t := range m.tasks {
+		tasks = append(tasks, t)
+	}
+	return tasks, nil
+}
+
+func (m *memKapa) UpdateTask(link client.Link, opt client.UpdateTaskOptions) (client.Task, error) {
+	t, ok := m.tasks[path.Base(link.Href)]
+	if !ok {
+		return client.Task{}, fmt.Errorf("no task %s", link.Href)
+	}
+	if opt.TICKscript != "" {
+		t.TICKscript = opt.TICKscript
+		t.Type = opt.Type
+		t.DBRPs = opt.DBRPs
+	}
+	t.Status = opt.Status
+	m.tasks[t.ID] = t
+	return t, nil
+}
+
+func (m *memKapa) DeleteTask(link client.Link) error {
+	delete(m.tasks, path.Base(link.Href))
+	return nil
+}
+
+func newMemClient(m *memKapa) *Client {
+	return &Client{
+		URL:    "http://kapacitor",
+		ID:     &MockID{ID: "generated"},
+		Ticker: &Alert{},
+		kapaClient: func(url, username, password string, insecureSkipVerify bool) (KapaClient, error) {
+			return m, nil
+		},
+	}
+}
+
+func memTask(id, script string, status client.TaskStatus) client.Task {
+	return client.Task{
+		ID:         id,
+		Type:       client.StreamTask,
+		Status:     status,
+		TICKscript: script,
+		DBRPs: []client.DBRP{
+			{
+				Database:        "telegraf",
+				RetentionPolicy: "autogen",
+			},
+		},
+	}
+}
+
+func TestClient_Export(t *testing.T) {
+	c := newMemClient(newMemKapa(
+		memTask("cloudhub-v1-b", "stream", client.Enabled),
+		memTask("cloudhub-v1-a", "stream", client.Disabled),
+		memTask("cpu_alert", "stream", client.Enabled),
+	))
+
+	rules, err := c.Export(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 || rules[0].ID != "cloudhub-v1-a" || rules[1].ID != "cloudhub-v1-b" {
+		t.Fatalf("Client.Export() = %v, want the two CloudHub tasks", rules)
+	}
+	want := []cloudhub.DBRP{
+		{
+			DB: "telegraf",
+			RP: "autogen",
+		},
+	}
+	if rules[0].Status != "disabled" || rules[0].Type != "stream" || !gocmp.Equal(rules[0].DBRPs, want) {
+		t.Errorf("Client.Export() did not keep the task definition: %+v", rules[0])
+	}
+}
+
+func TestClient_Import(t *testing.T) {
+	kapa := newMemKapa(
+		memTask("cloudhub-v1-same", "stream|from()", client.Enabled),
+		memTask("cloudhub-v1-changed", "stream|from()", client.Enabled),
+	)
+	c := newMemClient(kapa)
+
+	rules := []cloudhub.AlertRule{
+		{ID: "cloudhub-v1-new", TICKScript: "stream|from().measurement('cpu')", Type: "stream", Status: "disabled"},
+		{ID: "cloudhub-v1-same", TICKScript: "stream|from()", Type: "stream", Status: "enabled", DBRPs: []cloudhub.DBRP{{DB: "telegraf", RP: "autogen"}}},
+		{ID: "cloudhub-v1-changed", TICKScript: "stream|from().measurement('mem')", Type: "stream", DBRPs: []cloudhub.DBRP{{DB: "telegraf", RP: "autogen"}}},
+		{ID: "cpu_alert", TICKScript: "stream|from()", Type: "stream"},
+	}
+
+	results, err := c.Import(context.Background(), rules, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ImportResult{
+		{ID: "cloudhub-v1-new", Action: ImportCreated},
+		{ID: "cloudhub-v1-same", Action: ImportUnchanged},
+		{ID: "cloudhub-v1-changed", Action: ImportSkipped},
+		{ID: "cpu_alert", Error: "task cpu_alert is not managed by CloudHub"},
+	}
+	if !gocmp.Equal(results, want) {
+		t.Errorf("Client.Import() = %s", gocmp.Diff(results, want))
+	}
+	if got := kapa.tasks["cloudhub-v1-new"]; got.Status != client.Disabled {
+		t.Errorf("Client.Import() created task with status %v, want disabled", got.Status)
+	}
+
+	results, err = c.Import(context.Background(), rules[2:3], true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Action != ImportUpdated {
+		t.Errorf("Client.Import() with overwrite = %+v, want updated", results[0])
+	}
+	if got := kapa.tasks["cloudhub-v1-changed"]; got.TICKscript != string(rules[2].TICKScript) || got.Status != client.Enabled {
+		t.Errorf("Client.Import() did not replace the task: %+v", got)
+	}
+}
+
+func TestClient_Mirror(t *testing.T) {
+	primary := newMemKapa(
+		memTask("cloudhub-v1-a", "stream|from().measurement('cpu')", client.Enabled),
+		memTask("cloudhub-v1-b", "stream|from().measurement('mem')", client.Disabled),
+	)
+	standby := newMemKapa(
+		memTask("cloudhub-v1-a", "stream|from().measurement('cpu')", client.Enabled),
+		memTask("cloudhub-v1-old", "stream|from()", client.Enabled),
+		memTask("cpu_alert", "stream|from()", client.Enabled),
+	)
+
+	results, err := newMemClient(primary).Mirror(context.Background(), newMemClient(standby), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ImportResult{
+		{ID: "cloudhub-v1-a", Action: ImportUnchanged},
+		{ID: "cloudhub-v1-b", Action: ImportCreated},
+		{ID: "cloudhub-v1-old", Action: ImportDeleted},
+	}
+	if !gocmp.Equal(results, want) {
+		t.Errorf("Client.Mirror() = %s", gocmp.Diff(results, want))
+	}
+
+	ids := map[string]bool{}
+	for id := range standby.tasks {
+		ids[id] = true
+	}
+	if !gocmp.Equal(ids, map[string]bool{"cloudhub-v1-a": true, "cloudhub-v1-b": true, "cpu_alert": true}) {
+		t.Errorf("Client.Mirror() left standby with tasks %v", ids)
+	}
+}
+
+func TestClient_Mirror_Keep(t *testing.T) {
+	tests := []struct {
+		name    string
+		primary *memKapa
+		prune   bool
+		want    []ImportResult
+	}{
+		{
+			name:    "Without prune",
+			primary: newMemKapa(memTask("cloudhub-v1-a", "stream|from().measurement('cpu')", client.Enabled)),
+			prune:   false,
+			want:    []ImportResult{{ID: "cloudhub-v1-a", Action: ImportUnchanged}},
+		},
+		{
+			name:    "Empty primary",
+			primary: newMemKapa(memTask("cpu_alert", "stream|from()", client.Enabled)),
+			prune:   true,
+			want:    []ImportResult{},
+		},
+	}
+	for _, tt := range tests {
+		standby := newMemKapa(
+			memTask("cloudhub-v1-a", "stream|from().measurement('cpu')", client.Enabled),
+			memTask("cloudhub-v1-old", "stream|from()", client.Enabled),
+		)
+		results, err := newMemClient(tt.primary).Mirror(context.Background(), newMemClient(standby), tt.prune)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !gocmp.Equal(results, tt.want, cmpopts.EquateEmpty()) {
+			t.Errorf("%q. Client.Mirror() = %s", tt.name, gocmp.Diff(results, tt.want))
+		}
+		if _, ok := standby.tasks["cloudhub-v1-old"]; !ok {
+			t.Errorf("%q. Client.Mirror() deleted the task only on standby", tt.name)
+		}
+	}
+}
@@ -13,6 +13,9 @@ type Alert struct{}
 
 // Generate creates a Tickscript from the alertrule
 func (a *Alert) Generate(rule cloudhub.AlertRule) (cloudhub.TICKScript, error) {
+	if IsComposite(rule) {
+		rule.Trigger = Composite
+	}
 	vars, err := Vars(rule)
 	if err != nil {
 		return "", err
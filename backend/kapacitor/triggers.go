@@ -97,6 +97,8 @@ func Trigger(rule cloudhub.AlertRule) (string, error) {
 	switch rule.Trigger {
 	case Deadman:
 		trigger, err = DeadmanTrigger, nil
+	case Composite:
+		trigger, err = compositeTrigger(rule), nil
 	case Relative:
 		trigger, err = relativeTrigger(rule)
 	case Threshold:
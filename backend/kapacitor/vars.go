@@ -26,6 +26,10 @@ var (
 
 // Vars builds the top level vars for a kapacitor alert script
 func Vars(rule cloudhub.AlertRule) (string, error) {
+	if IsComposite(rule) {
+		return compositeVars(rule)
+	}
+
 	common, err := commonVars(rule)
 	if err != nil {
 		return "", err
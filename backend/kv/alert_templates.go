@@ -0,0 +1,112 @@
+package kv
+
+import (
+	"context"
+	"strconv"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/kv/internal"
+)
+
+// Ensure alertTemplatesStore implements cloudhub.AlertTemplatesStore.
+var _ cloudhub.AlertTemplatesStore = &alertTemplatesStore{}
+
+// alertTemplatesStore uses bolt to store and retrieve alert templates
+type alertTemplatesStore struct {
+	client *Service
+}
+
+// All returns all known alert templates
+func (s *alertTemplatesStore) All(ctx context.Context) ([]cloudhub.AlertTemplate, error) {
+	var tmpls []cloudhub.AlertTemplate
+	if err := s.client.kv.View(ctx, func(tx Tx) error {
+		return tx.Bucket(alertTemplatesBucket).ForEach(func(k, v []byte) error {
+			var t cloudhub.AlertTemplate
+			if err := internal.UnmarshalAlertTemplate(v, &t); err != nil {
+				return err
+			}
+			tmpls = append(tmpls, t)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	return tmpls, nil
+}
+
+// Add creates a new alert template in the alertTemplatesStore.
+func (s *alertTemplatesStore) Add(ctx context.Context, t cloudhub.AlertTemplate) (cloudhub.AlertTemplate, error) {
+	if err := s.client.kv.Update(ctx, func(tx Tx) error {
+		b := tx.Bucket(alertTemplatesBucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		t.ID = strconv.FormatUint(seq, 10)
+
+		if v, err := internal.MarshalAlertTemplate(t); err != nil {
+			return err
+		} else if err := b.Put([]byte(t.ID), v); err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return cloudhub.AlertTemplate{}, err
+	}
+
+	return t, nil
+}
+
+// Delete removes the alert template from the alertTemplatesStore
+func (s *alertTemplatesStore) Delete(ctx context.Context, t cloudhub.AlertTemplate) error {
+	if err := s.client.kv.Update(ctx, func(tx Tx) error {
+		if err := tx.Bucket(alertTemplatesBucket).Delete([]byte(t.ID)); err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Get returns a alert template if the id exists.
+func (s *alertTemplatesStore) Get(ctx context.Context, id string) (cloudhub.AlertTemplate, error) {
+	var t cloudhub.AlertTemplate
+	if err := s.client.kv.View(ctx, func(tx Tx) error {
+		if v, err := tx.Bucket(alertTemplatesBucket).Get([]byte(id)); v == nil || err != nil {
+			return cloudhub.ErrAlertTemplateNotFound
+		} else if err := internal.UnmarshalAlertTemplate(v, &t); err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return cloudhub.AlertTemplate{}, err
+	}
+
+	return t, nil
+}
+
+// Update a alert template
+func (s *alertTemplatesStore) Update(ctx context.Context, t cloudhub.AlertTemplate) error {
+	if err := s.client.kv.Update(ctx, func(tx Tx) error {
+		// Get an existing alert template with the same ID.
+		b := tx.Bucket(alertTemplatesBucket)
+		if v, err := b.Get([]byte(t.ID)); v == nil || err != nil {
+			return cloudhub.ErrAlertTemplateNotFound
+		}
+
+		if v, err := internal.MarshalAlertTemplate(t); err != nil {
+			return err
+		} else if err := b.Put([]byte(t.ID), v); err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
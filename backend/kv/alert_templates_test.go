@@ -0,0 +1,111 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+
+	gocmp "github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// Ensure an AlertTemplatesStore can store, retrieve, update, and delete alert templates.
+func TestAlertTemplatesStore(t *testing.T) {
+	c, err := NewTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	s := c.AlertTemplatesStore()
+
+	tmpls := []cloudhub.AlertTemplate{
+		{
+			Name:        "cpu high",
+			Description: "cpu usage of a host is above the threshold",
+			Rule: cloudhub.AlertRule{
+				Name:    "cpu high on :host:",
+				Trigger: "threshold",
+				Query: &cloudhub.QueryConfig{
+					Database:        "telegraf",
+					RetentionPolicy: "autogen",
+					Measurement:     "cpu",
+					Tags: map[string][]string{
+						"host": {":host:"},
+					},
+				},
+				TriggerValues: cloudhub.TriggerValues{
+					Operator: "greater than",
+					Value:    ":threshold:",
+				},
+			},
+			Vars: []cloudhub.AlertTemplateVar{
+				{
+					Name: "host",
+				},
+				{
+					Name:        "threshold",
+					Default:     "90",
+					Description: "percent of cpu usage",
+				},
+			},
+			Organization: "133",
+		},
+		{
+			Name:         "disk full",
+			Organization: "133",
+		},
+	}
+
+	ctx := context.Background()
+	for i, tmpl := range tmpls {
+		if tmpls[i], err = s.Add(ctx, tmpl); err != nil {
+			t.Fatal(err)
+		}
+		if actual, err := s.Get(ctx, tmpls[i].ID); err != nil {
+			t.Fatal(err)
+		} else if diff := gocmp.Diff(actual, tmpls[i], cmpopts.EquateEmpty()); diff != "" {
+			t.Fatalf("alert template loaded is different then alert template saved; diff %s", diff)
+		}
+	}
+
+	// Track a task created from the first template.
+	tmpls[0].Tasks = []cloudhub.AlertTemplateTask{
+		{
+			SrcID:  1,
+			KapaID: 2,
+			TaskID: "cloudhub-v1-abc",
+			Vars: map[string]string{
+				"host":      "server01",
+				"threshold": "80",
+			},
+		},
+	}
+	if err := s.Update(ctx, tmpls[0]); err != nil {
+		t.Fatal(err)
+	}
+	if actual, err := s.Get(ctx, tmpls[0].ID); err != nil {
+		t.Fatal(err)
+	} else if diff := gocmp.Diff(actual, tmpls[0], cmpopts.EquateEmpty()); diff != "" {
+		t.Fatalf("alert template update error; diff %s", diff)
+	}
+
+	if err := s.Update(ctx, cloudhub.AlertTemplate{ID: "1337"}); err != cloudhub.ErrAlertTemplateNotFound {
+		t.Fatalf("alert template update error: got %v, expected %v", err, cloudhub.ErrAlertTemplateNotFound)
+	}
+
+	if err := s.Delete(ctx, tmpls[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, tmpls[0].ID); err != cloudhub.ErrAlertTemplateNotFound {
+		t.Fatalf("alert template delete error: got %v, expected %v", err, cloudhub.ErrAlertTemplateNotFound)
+	}
+
+	if all, err := s.All(ctx); err != nil {
+		t.Fatal(err)
+	} else if len(all) != 1 {
+		t.Fatalf("After delete All returned incorrect number of alert templates; got %d, expected %d", len(all), 1)
+	} else if diff := gocmp.Diff(all[0], tmpls[1], cmpopts.EquateEmpty()); diff != "" {
+		t.Fatalf("After delete All returned incorrect alert template; diff %s", diff)
+	}
+}
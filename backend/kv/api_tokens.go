@@ -0,0 +1,90 @@
+package kv
+
+import (
+	"context"
+	"strconv"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/kv/internal"
+)
+
+// Ensure apiTokensStore implements cloudhub.APITokensStore.
+var _ cloudhub.APITokensStore = &apiTokensStore{}
+
+// apiTokensStore uses bolt to store and retrieve API tokens
+type apiTokensStore struct {
+	client *Service
+}
+
+// All returns all known API tokens
+func (s *apiTokensStore) All(ctx context.Context) ([]cloudhub.APIToken, error) {
+	var tokens []cloudhub.APIToken
+	if err := s.client.kv.View(ctx, func(tx Tx) error {
+		return tx.Bucket(apiTokensBucket).ForEach(func(k, v []byte) error {
+			var t cloudhub.APIToken
+			if err := internal.UnmarshalAPIToken(v, &t); err != nil {
+				return err
+			}
+			tokens = append(tokens, t)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// Add creates a new API token in the apiTokensStore.
+func (s *apiTokensStore) Add(ctx context.Context, t cloudhub.APIToken) (cloudhub.APIToken, error) {
+	if err := s.client.kv.Update(ctx, func(tx Tx) error {
+		b := tx.Bucket(apiTokensBucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		t.ID = strconv.FormatUint(seq, 10)
+
+		if v, err := internal.MarshalAPIToken(t); err != nil {
+			return err
+		} else if err := b.Put([]byte(t.ID), v); err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return cloudhub.APIToken{}, err
+	}
+
+	return t, nil
+}
+
+// Delete removes the API token from the apiTokensStore
+func (s *apiTokensStore) Delete(ctx context.Context, t cloudhub.APIToken) error {
+	if err := s.client.kv.Update(ctx, func(tx Tx) error {
+		if err := tx.Bucket(apiTokensBucket).Delete([]byte(t.ID)); err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Get returns an API token if the id exists.
+func (s *apiTokensStore) Get(ctx context.Context, id string) (cloudhub.APIToken, error) {
+	var t cloudhub.APIToken
+	if err := s.client.kv.View(ctx, func(tx Tx) error {
+		if v, err := tx.Bucket(apiTokensBucket).Get([]byte(id)); v == nil || err != nil {
+			return cloudhub.ErrAPITokenNotFound
+		} else if err := internal.UnmarshalAPIToken(v, &t); err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return cloudhub.APIToken{}, err
+	}
+
+	return t, nil
+}
@@ -0,0 +1,70 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	gocmp "github.com/google/go-cmp/cmp"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// Ensure an APITokensStore can store, retrieve, and delete API tokens.
+func TestAPITokensStore(t *testing.T) {
+	c, err := NewTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	s := c.APITokensStore()
+
+	created := time.Date(2020, time.March, 1, 12, 0, 0, 0, time.UTC)
+	tokens := []cloudhub.APIToken{
+		{
+			Name:         "ci",
+			UserID:       1,
+			Organization: "133",
+			Role:         "editor",
+			Hash:         "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+			CreatedAt:    created,
+			ExpiresAt:    created.Add(30 * 24 * time.Hour),
+		},
+		{
+			Name:         "backup",
+			UserID:       2,
+			Organization: "133",
+			Role:         "viewer",
+			Hash:         "60303ae22b998861bce3b28f33eec1be758a213c86c93c076dbe9f558c11c752",
+			CreatedAt:    created,
+			ExpiresAt:    created.Add(time.Hour),
+		},
+	}
+
+	ctx := context.Background()
+	for i, token := range tokens {
+		if tokens[i], err = s.Add(ctx, token); err != nil {
+			t.Fatal(err)
+		}
+		if actual, err := s.Get(ctx, tokens[i].ID); err != nil {
+			t.Fatal(err)
+		} else if diff := gocmp.Diff(actual, tokens[i]); diff != "" {
+			t.Fatalf("API token loaded is different then API token saved; diff %s", diff)
+		}
+	}
+
+	if err := s.Delete(ctx, tokens[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, tokens[0].ID); err != cloudhub.ErrAPITokenNotFound {
+		t.Fatalf("API token delete error: got %v, expected %v", err, cloudhub.ErrAPITokenNotFound)
+	}
+
+	if all, err := s.All(ctx); err != nil {
+		t.Fatal(err)
+	} else if len(all) != 1 {
+		t.Fatalf("After delete All returned incorrect number of API tokens; got %d, expected %d", len(all), 1)
+	} else if diff := gocmp.Diff(all[0], tokens[1]); diff != "" {
+		t.Fatalf("After delete All returned incorrect API token; diff %s", diff)
+	}
+}
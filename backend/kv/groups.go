@@ -0,0 +1,112 @@
+package kv
+
+import (
+	"context"
+	"strconv"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/kv/internal"
+)
+
+// Ensure groupsStore implements cloudhub.GroupsStore.
+var _ cloudhub.GroupsStore = &groupsStore{}
+
+// groupsStore uses bolt to store and retrieve groups
+type groupsStore struct {
+	client *Service
+}
+
+// All returns all known groups
+func (s *groupsStore) All(ctx context.Context) ([]cloudhub.Group, error) {
+	var groups []cloudhub.Group
+	if err := s.client.kv.View(ctx, func(tx Tx) error {
+		return tx.Bucket(groupsBucket).ForEach(func(k, v []byte) error {
+			var g cloudhub.Group
+			if err := internal.UnmarshalGroup(v, &g); err != nil {
+				return err
+			}
+			groups = append(groups, g)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+// Add creates a new group in the groupsStore.
+func (s *groupsStore) Add(ctx context.Context, g cloudhub.Group) (cloudhub.Group, error) {
+	if err := s.client.kv.Update(ctx, func(tx Tx) error {
+		b := tx.Bucket(groupsBucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		g.ID = strconv.FormatUint(seq, 10)
+
+		if v, err := internal.MarshalGroup(g); err != nil {
+			return err
+		} else if err := b.Put([]byte(g.ID), v); err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return cloudhub.Group{}, err
+	}
+
+	return g, nil
+}
+
+// Delete removes the group from the groupsStore
+func (s *groupsStore) Delete(ctx context.Context, g cloudhub.Group) error {
+	if err := s.client.kv.Update(ctx, func(tx Tx) error {
+		if err := tx.Bucket(groupsBucket).Delete([]byte(g.ID)); err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Get returns a group if the id exists.
+func (s *groupsStore) Get(ctx context.Context, id string) (cloudhub.Group, error) {
+	var g cloudhub.Group
+	if err := s.client.kv.View(ctx, func(tx Tx) error {
+		if v, err := tx.Bucket(groupsBucket).Get([]byte(id)); v == nil || err != nil {
+			return cloudhub.ErrGroupNotFound
+		} else if err := internal.UnmarshalGroup(v, &g); err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return cloudhub.Group{}, err
+	}
+
+	return g, nil
+}
+
+// Update a group
+func (s *groupsStore) Update(ctx context.Context, g cloudhub.Group) error {
+	if err := s.client.kv.Update(ctx, func(tx Tx) error {
+		// Get an existing group with the same ID.
+		b := tx.Bucket(groupsBucket)
+		if v, err := b.Get([]byte(g.ID)); v == nil || err != nil {
+			return cloudhub.ErrGroupNotFound
+		}
+
+		if v, err := internal.MarshalGroup(g); err != nil {
+			return err
+		} else if err := b.Put([]byte(g.ID), v); err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+
+	gocmp "github.com/google/go-cmp/cmp"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// Ensure a GroupsStore can store, retrieve, update, and delete groups.
+func TestGroupsStore(t *testing.T) {
+	c, err := NewTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	s := c.GroupsStore()
+
+	groups := []cloudhub.Group{
+		{
+			DisplayName: "sre",
+			ExternalID:  "00g1emaKYZTWRYYRRTSK",
+			Members:     []uint64{1, 2},
+		},
+		{
+			DisplayName: "developers",
+		},
+	}
+
+	ctx := context.Background()
+	for i, group := range groups {
+		if groups[i], err = s.Add(ctx, group); err != nil {
+			t.Fatal(err)
+		}
+		if actual, err := s.Get(ctx, groups[i].ID); err != nil {
+			t.Fatal(err)
+		} else if diff := gocmp.Diff(actual, groups[i]); diff != "" {
+			t.Fatalf("Group loaded is different then group saved; diff %s", diff)
+		}
+	}
+
+	groups[1].Members = []uint64{3}
+	if err := s.Update(ctx, groups[1]); err != nil {
+		t.Fatal(err)
+	}
+	if actual, err := s.Get(ctx, groups[1].ID); err != nil {
+		t.Fatal(err)
+	} else if diff := gocmp.Diff(actual.Members, []uint64{3}); diff != "" {
+		t.Fatalf("Group update error: members diff %s", diff)
+	}
+	if err := s.Update(ctx, cloudhub.Group{ID: "1337"}); err != cloudhub.ErrGroupNotFound {
+		t.Fatalf("Group update of a missing group error: got %v, expected %v", err, cloudhub.ErrGroupNotFound)
+	}
+
+	if err := s.Delete(ctx, groups[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, groups[0].ID); err != cloudhub.ErrGroupNotFound {
+		t.Fatalf("Group delete error: got %v, expected %v", err, cloudhub.ErrGroupNotFound)
+	}
+
+	if all, err := s.All(ctx); err != nil {
+		t.Fatal(err)
+	} else if len(all) != 1 {
+		t.Fatalf("After delete All returned incorrect number of groups; got %d, expected %d", len(all), 1)
+	} else if diff := gocmp.Diff(all[0], groups[1]); diff != "" {
+		t.Fatalf("After delete All returned incorrect group; diff %s", diff)
+	}
+}
@@ -3,6 +3,7 @@ package internal
 import (
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/gogo/protobuf/proto"
 	cloudhub "github.com/snetsystems/cloudhub/backend"
@@ -48,6 +49,8 @@ func MarshalSource(s cloudhub.Source) ([]byte, error) {
 		Role:               s.Role,
 		DefaultRP:          s.DefaultRP,
 		Version:            s.Version,
+		InfluxOrg:          s.InfluxOrg,
+		Token:              s.Token,
 	})
 }
 
@@ -73,6 +76,8 @@ func UnmarshalSource(data []byte, s *cloudhub.Source) error {
 	s.Role = pb.Role
 	s.DefaultRP = pb.DefaultRP
 	s.Version = pb.Version
+	s.InfluxOrg = pb.InfluxOrg
+	s.Token = pb.Token
 	return nil
 }
 
@@ -614,15 +619,31 @@ func MarshalUser(u *cloudhub.User) ([]byte, error) {
 		roles[i] = &Role{
 			Organization: role.Organization,
 			Name:         role.Name,
+			Mapped:       role.Mapped,
 		}
 	}
+	var lockedUntil int64
+	if !u.LockedUntil.IsZero() {
+		lockedUntil = u.LockedUntil.UnixNano()
+	}
 	return MarshalUserPB(&User{
-		ID:         u.ID,
-		Name:       u.Name,
-		Provider:   u.Provider,
-		Scheme:     u.Scheme,
-		Roles:      roles,
-		SuperAdmin: u.SuperAdmin,
+		ID:             u.ID,
+		Name:           u.Name,
+		Provider:       u.Provider,
+		Scheme:         u.Scheme,
+		Roles:          roles,
+		SuperAdmin:     u.SuperAdmin,
+		PasswordHash:   u.PasswordHash,
+		FailedLogins:   int32(u.FailedLogins),
+		LockedUntil:    lockedUntil,
+		ServiceAccount: u.ServiceAccount,
+		Owner:          u.Owner,
+		TOTPSecret:     u.TOTPSecret,
+		TOTPEnabled:    u.TOTPEnabled,
+		TOTPCounter:    u.TOTPCounter,
+		BackupCodes:    u.BackupCodes,
+		FailedCodes:    int32(u.FailedCodes),
+		Deactivated:    u.Deactivated,
 	})
 }
 
@@ -644,6 +665,7 @@ func UnmarshalUser(data []byte, u *cloudhub.User) error {
 		roles[i] = cloudhub.Role{
 			Organization: role.Organization,
 			Name:         role.Name,
+			Mapped:       role.Mapped,
 		}
 	}
 	u.ID = pb.ID
@@ -652,6 +674,19 @@ func UnmarshalUser(data []byte, u *cloudhub.User) error {
 	u.Scheme = pb.Scheme
 	u.SuperAdmin = pb.SuperAdmin
 	u.Roles = roles
+	u.PasswordHash = pb.PasswordHash
+	u.FailedLogins = int(pb.FailedLogins)
+	if pb.LockedUntil != 0 {
+		u.LockedUntil = time.Unix(0, pb.LockedUntil).UTC()
+	}
+	u.ServiceAccount = pb.ServiceAccount
+	u.Owner = pb.Owner
+	u.TOTPSecret = pb.TOTPSecret
+	u.TOTPEnabled = pb.TOTPEnabled
+	u.TOTPCounter = pb.TOTPCounter
+	u.BackupCodes = pb.BackupCodes
+	u.FailedCodes = int(pb.FailedCodes)
+	u.Deactivated = pb.Deactivated
 
 	return nil
 }
@@ -662,6 +697,126 @@ func UnmarshalUserPB(data []byte, u *User) error {
 	return proto.Unmarshal(data, u)
 }
 
+// MarshalAPIToken encodes an API token to binary protobuf format.
+func MarshalAPIToken(t cloudhub.APIToken) ([]byte, error) {
+	return proto.Marshal(&APIToken{
+		ID:           t.ID,
+		Name:         t.Name,
+		UserID:       t.UserID,
+		Organization: t.Organization,
+		Role:         t.Role,
+		Hash:         t.Hash,
+		CreatedAt:    t.CreatedAt.UnixNano(),
+		ExpiresAt:    t.ExpiresAt.UnixNano(),
+	})
+}
+
+// UnmarshalAPIToken decodes an API token from binary protobuf data.
+func UnmarshalAPIToken(data []byte, t *cloudhub.APIToken) error {
+	var pb APIToken
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+
+	t.ID = pb.ID
+	t.Name = pb.Name
+	t.UserID = pb.UserID
+	t.Organization = pb.Organization
+	t.Role = pb.Role
+	t.Hash = pb.Hash
+	t.CreatedAt = time.Unix(0, pb.CreatedAt).UTC()
+	t.ExpiresAt = time.Unix(0, pb.ExpiresAt).UTC()
+	return nil
+}
+
+// MarshalPolicy encodes a policy to binary protobuf format.
+func MarshalPolicy(p cloudhub.Policy) ([]byte, error) {
+	return proto.Marshal(&Policy{
+		ID:           p.ID,
+		Organization: p.Organization,
+		Resource:     p.Resource,
+		ResourceID:   p.ResourceID,
+		UserID:       p.UserID,
+		Role:         p.Role,
+		Permission:   p.Permission,
+	})
+}
+
+// UnmarshalPolicy decodes a policy from binary protobuf data.
+func UnmarshalPolicy(data []byte, p *cloudhub.Policy) error {
+	var pb Policy
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+
+	p.ID = pb.ID
+	p.Organization = pb.Organization
+	p.Resource = pb.Resource
+	p.ResourceID = pb.ResourceID
+	p.UserID = pb.UserID
+	p.Role = pb.Role
+	p.Permission = pb.Permission
+	return nil
+}
+
+// MarshalGroup encodes a group to binary protobuf format.
+func MarshalGroup(g cloudhub.Group) ([]byte, error) {
+	return proto.Marshal(&Group{
+		ID:          g.ID,
+		DisplayName: g.DisplayName,
+		ExternalID:  g.ExternalID,
+		Members:     g.Members,
+	})
+}
+
+// UnmarshalGroup decodes a group from binary protobuf data.
+func UnmarshalGroup(data []byte, g *cloudhub.Group) error {
+	var pb Group
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+
+	g.ID = pb.ID
+	g.DisplayName = pb.DisplayName
+	g.ExternalID = pb.ExternalID
+	g.Members = pb.Members
+	return nil
+}
+
+// MarshalSession encodes a session to binary protobuf format.
+func MarshalSession(s cloudhub.Session) ([]byte, error) {
+	return proto.Marshal(&Session{
+		ID:           s.ID,
+		Subject:      s.Subject,
+		Provider:     s.Provider,
+		Organization: s.Organization,
+		UserAgent:    s.UserAgent,
+		RemoteAddr:   s.RemoteAddr,
+		CreatedAt:    s.CreatedAt.UnixNano(),
+		LastSeenAt:   s.LastSeenAt.UnixNano(),
+		ExpiresAt:    s.ExpiresAt.UnixNano(),
+	})
+}
+
+// UnmarshalSession decodes a session from binary protobuf data.
+func UnmarshalSession(data []byte, s *cloudhub.Session) error {
+	var pb Session
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+
+	s.ID = pb.ID
+	s.Subject = pb.Subject
+	s.Provider = pb.Provider
+	s.Organization = pb.Organization
+	s.UserAgent = pb.UserAgent
+	s.RemoteAddr = pb.RemoteAddr
+	s.CreatedAt = time.Unix(0, pb.CreatedAt).UTC()
+	s.LastSeenAt = time.Unix(0, pb.LastSeenAt).UTC()
+	s.ExpiresAt = time.Unix(0, pb.ExpiresAt).UTC()
+	return nil
+}
+
 // MarshalRole encodes a role to binary protobuf format.
 func MarshalRole(r *cloudhub.Role) ([]byte, error) {
 	return MarshalRolePB(&Role{
@@ -696,9 +851,10 @@ func UnmarshalRolePB(data []byte, r *Role) error {
 func MarshalOrganization(o *cloudhub.Organization) ([]byte, error) {
 
 	return MarshalOrganizationPB(&Organization{
-		ID:          o.ID,
-		Name:        o.Name,
-		DefaultRole: o.DefaultRole,
+		ID:               o.ID,
+		Name:             o.Name,
+		DefaultRole:      o.DefaultRole,
+		RequireTwoFactor: o.RequireTwoFactor,
 	})
 }
 
@@ -716,6 +872,7 @@ func UnmarshalOrganization(data []byte, o *cloudhub.Organization) error {
 	o.ID = pb.ID
 	o.Name = pb.Name
 	o.DefaultRole = pb.DefaultRole
+	o.RequireTwoFactor = pb.RequireTwoFactor
 
 	return nil
 }
@@ -874,6 +1031,7 @@ func MarshalMapping(m *cloudhub.Mapping) ([]byte, error) {
 		ProviderOrganization: m.ProviderOrganization,
 		ID:                   m.ID,
 		Organization:         m.Organization,
+		Role:                 m.Role,
 	})
 }
 
@@ -894,6 +1052,7 @@ func UnmarshalMapping(data []byte, m *cloudhub.Mapping) error {
 	m.ProviderOrganization = pb.ProviderOrganization
 	m.Organization = pb.Organization
 	m.ID = pb.ID
+	m.Role = pb.Role
 
 	return nil
 }
@@ -937,4 +1096,82 @@ func UnmarshalVsphere(data []byte, v *cloudhub.Vsphere) error {
 	v.Organization = pb.Organization
 
 	return nil
-}
\ No newline at end of file
+}
+// MarshalAlertTemplate encodes an alert template to binary protobuf format.
+func MarshalAlertTemplate(t cloudhub.AlertTemplate) ([]byte, error) {
+	rule, err := json.Marshal(t.Rule)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := make([]*AlertTemplateVar, len(t.Vars))
+	for i, v := range t.Vars {
+		vars[i] = &AlertTemplateVar{
+			Name:        v.Name,
+			Default:     v.Default,
+			Description: v.Description,
+		}
+	}
+
+	tasks := make([]*AlertTemplateTask, len(t.Tasks))
+	for i, task := range t.Tasks {
+		tasks[i] = &AlertTemplateTask{
+			SrcID:  int64(task.SrcID),
+			KapaID: int64(task.KapaID),
+			TaskID: task.TaskID,
+			Vars:   task.Vars,
+		}
+	}
+
+	return proto.Marshal(&AlertTemplate{
+		ID:           t.ID,
+		Name:         t.Name,
+		Description:  t.Description,
+		RuleJSON:     string(rule),
+		Vars:         vars,
+		Tasks:        tasks,
+		Organization: t.Organization,
+	})
+}
+
+// UnmarshalAlertTemplate decodes an alert template from binary protobuf data.
+func UnmarshalAlertTemplate(data []byte, t *cloudhub.AlertTemplate) error {
+	var pb AlertTemplate
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+
+	if pb.RuleJSON != "" {
+		if err := json.Unmarshal([]byte(pb.RuleJSON), &t.Rule); err != nil {
+			return err
+		}
+	}
+
+	vars := make([]cloudhub.AlertTemplateVar, len(pb.Vars))
+	for i, v := range pb.Vars {
+		vars[i] = cloudhub.AlertTemplateVar{
+			Name:        v.Name,
+			Default:     v.Default,
+			Description: v.Description,
+		}
+	}
+
+	tasks := make([]cloudhub.AlertTemplateTask, len(pb.Tasks))
+	for i, task := range pb.Tasks {
+		tasks[i] = cloudhub.AlertTemplateTask{
+			SrcID:  int(task.SrcID),
+			KapaID: int(task.KapaID),
+			TaskID: task.TaskID,
+			Vars:   task.Vars,
+		}
+	}
+
+	t.ID = pb.ID
+	t.Name = pb.Name
+	t.Description = pb.Description
+	t.Vars = vars
+	t.Tasks = tasks
+	t.Organization = pb.Organization
+
+	return nil
+}
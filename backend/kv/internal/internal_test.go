@@ -3,6 +3,7 @@ package internal_test
 import (
 	"reflect"
 	"testing"
+	"time"
 
 	gocmp "github.com/google/go-cmp/cmp"
 	cloudhub "github.com/snetsystems/cloudhub/backend"
@@ -511,4 +512,51 @@ func TestMarshalVsphere(t *testing.T) {
 	} else if !reflect.DeepEqual(v, vv) {
 		t.Fatalf("source protobuf copy error: got %#v, expected %#v", vv, v)
 	}
-}
\ No newline at end of file
+}
+
+func TestMarshalUser(t *testing.T) {
+	u := cloudhub.User{
+		ID:           1,
+		Name:         "admin",
+		Provider:     "local",
+		Scheme:       "oauth2",
+		Roles:        []cloudhub.Role{{Organization: "default", Name: "admin"}, {Organization: "2", Name: "editor", Mapped: true}},
+		SuperAdmin:   true,
+		PasswordHash: "$2a$10$bW1pMOxyT1zG1lWe6Q3wJ.8X0ZJ5m1h1ZtU1bX6M2dZ0r7Q2fQy7y",
+		FailedLogins: 2,
+		LockedUntil:  time.Date(2020, time.March, 1, 12, 0, 0, 0, time.UTC),
+		TOTPSecret:   "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+		TOTPEnabled:  true,
+		TOTPCounter:  52911,
+		BackupCodes:  []string{"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"},
+		FailedCodes:  1,
+		Deactivated:  true,
+	}
+
+	var uu cloudhub.User
+	if buf, err := internal.MarshalUser(&u); err != nil {
+		t.Fatal(err)
+	} else if err := internal.UnmarshalUser(buf, &uu); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(u, uu) {
+		t.Fatalf("user protobuf copy error: got %#v, expected %#v", uu, u)
+	}
+
+	sa := cloudhub.User{
+		ID:             2,
+		Name:           "provisioner",
+		Provider:       "serviceaccount",
+		Scheme:         "oauth2",
+		Roles:          []cloudhub.Role{{Organization: "default", Name: "editor"}},
+		ServiceAccount: true,
+		Owner:          1,
+	}
+	var sau cloudhub.User
+	if buf, err := internal.MarshalUser(&sa); err != nil {
+		t.Fatal(err)
+	} else if err := internal.UnmarshalUser(buf, &sau); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(sa, sau) {
+		t.Fatalf("service account protobuf copy error: got %#v, expected %#v", sau, sa)
+	}
+}
@@ -12,13 +12,18 @@ import (
 var _ cloudhub.KVClient = (*Service)(nil)
 
 var (
+	alertTemplatesBucket     = []byte("AlertTemplatesV1")
+	apiTokensBucket          = []byte("APITokensV1")
 	cellBucket               = []byte("cellsv2")
 	configBucket             = []byte("ConfigV1")
 	dashboardsBucket         = []byte("Dashoard") // keep spelling for backwards compat
+	groupsBucket             = []byte("GroupsV1")
 	mappingsBucket           = []byte("MappingsV1")
 	organizationConfigBucket = []byte("OrganizationConfigV1")
 	organizationsBucket      = []byte("OrganizationsV1")
+	policiesBucket           = []byte("PoliciesV1")
 	serversBucket            = []byte("Servers")
+	sessionsBucket           = []byte("SessionsV1")
 	sourcesBucket            = []byte("Sources")
 	usersBucket              = []byte("UsersV2")
 	vSpheresBucket           = []byte("vSpheres")
@@ -110,13 +115,18 @@ func (s *Service) Close() error {
 
 func (s *Service) initialize(ctx context.Context, tx Tx) error {
 	buckets := [][]byte{
+		alertTemplatesBucket,
+		apiTokensBucket,
 		cellBucket,
 		configBucket,
 		dashboardsBucket,
+		groupsBucket,
 		mappingsBucket,
 		organizationConfigBucket,
 		organizationsBucket,
+		policiesBucket,
 		serversBucket,
+		sessionsBucket,
 		sourcesBucket,
 		usersBucket,
 		vSpheresBucket,
@@ -145,6 +155,16 @@ func u64tob(v uint64) []byte {
 	return b
 }
 
+// AlertTemplatesStore returns a cloudhub.AlertTemplatesStore.
+func (s *Service) AlertTemplatesStore() cloudhub.AlertTemplatesStore {
+	return &alertTemplatesStore{client: s}
+}
+
+// APITokensStore returns a cloudhub.APITokensStore.
+func (s *Service) APITokensStore() cloudhub.APITokensStore {
+	return &apiTokensStore{client: s}
+}
+
 // ConfigStore returns a cloudhub.ConfigStore.
 func (s *Service) ConfigStore() cloudhub.ConfigStore {
 	return &configStore{client: s}
@@ -155,6 +175,11 @@ func (s *Service) DashboardsStore() cloudhub.DashboardsStore {
 	return &dashboardsStore{client: s, IDs: &id.UUID{}}
 }
 
+// GroupsStore returns a cloudhub.GroupsStore.
+func (s *Service) GroupsStore() cloudhub.GroupsStore {
+	return &groupsStore{client: s}
+}
+
 // MappingsStore returns a cloudhub.MappingsStore.
 func (s *Service) MappingsStore() cloudhub.MappingsStore {
 	return &mappingsStore{client: s}
@@ -170,11 +195,21 @@ func (s *Service) OrganizationsStore() cloudhub.OrganizationsStore {
 	return &organizationsStore{client: s}
 }
 
+// PoliciesStore returns a cloudhub.PoliciesStore.
+func (s *Service) PoliciesStore() cloudhub.PoliciesStore {
+	return &policiesStore{client: s}
+}
+
 // ServersStore returns a cloudhub.ServersStore.
 func (s *Service) ServersStore() cloudhub.ServersStore {
 	return &serversStore{client: s}
 }
 
+// SessionsStore returns a cloudhub.SessionsStore.
+func (s *Service) SessionsStore() cloudhub.SessionsStore {
+	return &sessionsStore{client: s}
+}
+
 // SourcesStore returns a cloudhub.SourcesStore.
 func (s *Service) SourcesStore() cloudhub.SourcesStore {
 	return &sourcesStore{client: s}
@@ -69,6 +69,27 @@ func TestMappingStore_Add(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "with a role",
+			args: args{
+				mapping: &cloudhub.Mapping{
+					Organization:         "default",
+					Provider:             "generic",
+					Scheme:               "oauth2",
+					ProviderOrganization: "cloudhub-editors",
+					Role:                 "editor",
+				},
+			},
+			wants: wants{
+				mapping: &cloudhub.Mapping{
+					Organization:         "default",
+					Provider:             "generic",
+					Scheme:               "oauth2",
+					ProviderOrganization: "cloudhub-editors",
+					Role:                 "editor",
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
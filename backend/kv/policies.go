@@ -0,0 +1,112 @@
+package kv
+
+import (
+	"context"
+	"strconv"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/kv/internal"
+)
+
+// Ensure policiesStore implements cloudhub.PoliciesStore.
+var _ cloudhub.PoliciesStore = &policiesStore{}
+
+// policiesStore uses bolt to store and retrieve policies
+type policiesStore struct {
+	client *Service
+}
+
+// All returns all known policies
+func (s *policiesStore) All(ctx context.Context) ([]cloudhub.Policy, error) {
+	var policies []cloudhub.Policy
+	if err := s.client.kv.View(ctx, func(tx Tx) error {
+		return tx.Bucket(policiesBucket).ForEach(func(k, v []byte) error {
+			var p cloudhub.Policy
+			if err := internal.UnmarshalPolicy(v, &p); err != nil {
+				return err
+			}
+			policies = append(policies, p)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	return policies, nil
+}
+
+// Add creates a new policy in the policiesStore.
+func (s *policiesStore) Add(ctx context.Context, p cloudhub.Policy) (cloudhub.Policy, error) {
+	if err := s.client.kv.Update(ctx, func(tx Tx) error {
+		b := tx.Bucket(policiesBucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		p.ID = strconv.FormatUint(seq, 10)
+
+		if v, err := internal.MarshalPolicy(p); err != nil {
+			return err
+		} else if err := b.Put([]byte(p.ID), v); err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return cloudhub.Policy{}, err
+	}
+
+	return p, nil
+}
+
+// Delete removes the policy from the policiesStore
+func (s *policiesStore) Delete(ctx context.Context, p cloudhub.Policy) error {
+	if err := s.client.kv.Update(ctx, func(tx Tx) error {
+		if err := tx.Bucket(policiesBucket).Delete([]byte(p.ID)); err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Get returns a policy if the id exists.
+func (s *policiesStore) Get(ctx context.Context, id string) (cloudhub.Policy, error) {
+	var p cloudhub.Policy
+	if err := s.client.kv.View(ctx, func(tx Tx) error {
+		if v, err := tx.Bucket(policiesBucket).Get([]byte(id)); v == nil || err != nil {
+			return cloudhub.ErrPolicyNotFound
+		} else if err := internal.UnmarshalPolicy(v, &p); err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return cloudhub.Policy{}, err
+	}
+
+	return p, nil
+}
+
+// Update a policy
+func (s *policiesStore) Update(ctx context.Context, p cloudhub.Policy) error {
+	if err := s.client.kv.Update(ctx, func(tx Tx) error {
+		// Get an existing policy with the same ID.
+		b := tx.Bucket(policiesBucket)
+		if v, err := b.Get([]byte(p.ID)); v == nil || err != nil {
+			return cloudhub.ErrPolicyNotFound
+		}
+
+		if v, err := internal.MarshalPolicy(p); err != nil {
+			return err
+		} else if err := b.Put([]byte(p.ID), v); err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+
+	gocmp "github.com/google/go-cmp/cmp"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// Ensure a PoliciesStore can store, retrieve, update, and delete policies.
+func TestPoliciesStore(t *testing.T) {
+	c, err := NewTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	s := c.PoliciesStore()
+
+	policies := []cloudhub.Policy{
+		{
+			Organization: "133",
+			Resource:     cloudhub.PolicyDashboard,
+			ResourceID:   "7",
+			UserID:       3,
+			Permission:   cloudhub.PermissionWrite,
+		},
+		{
+			Organization: "133",
+			Resource:     cloudhub.PolicyCapability,
+			ResourceID:   cloudhub.CapabilityTerminal,
+			Role:         "editor",
+		},
+	}
+
+	ctx := context.Background()
+	for i, policy := range policies {
+		if policies[i], err = s.Add(ctx, policy); err != nil {
+			t.Fatal(err)
+		}
+		if actual, err := s.Get(ctx, policies[i].ID); err != nil {
+			t.Fatal(err)
+		} else if diff := gocmp.Diff(actual, policies[i]); diff != "" {
+			t.Fatalf("Policy loaded is different then policy saved; diff %s", diff)
+		}
+	}
+
+	policies[1].Role = "viewer"
+	if err := s.Update(ctx, policies[1]); err != nil {
+		t.Fatal(err)
+	}
+	if actual, err := s.Get(ctx, policies[1].ID); err != nil {
+		t.Fatal(err)
+	} else if actual.Role != "viewer" {
+		t.Fatalf("Policy update error: got role %s, expected %s", actual.Role, "viewer")
+	}
+	if err := s.Update(ctx, cloudhub.Policy{ID: "1337"}); err != cloudhub.ErrPolicyNotFound {
+		t.Fatalf("Policy update of a missing policy error: got %v, expected %v", err, cloudhub.ErrPolicyNotFound)
+	}
+
+	if err := s.Delete(ctx, policies[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, policies[0].ID); err != cloudhub.ErrPolicyNotFound {
+		t.Fatalf("Policy delete error: got %v, expected %v", err, cloudhub.ErrPolicyNotFound)
+	}
+
+	if all, err := s.All(ctx); err != nil {
+		t.Fatal(err)
+	} else if len(all) != 1 {
+		t.Fatalf("After delete All returned incorrect number of policies; got %d, expected %d", len(all), 1)
+	} else if diff := gocmp.Diff(all[0], policies[1]); diff != "" {
+		t.Fatalf("After delete All returned incorrect policy; diff %s", diff)
+	}
+}
@@ -0,0 +1,112 @@
+package kv
+
+import (
+	"context"
+	"strconv"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/kv/internal"
+)
+
+// Ensure sessionsStore implements cloudhub.SessionsStore.
+var _ cloudhub.SessionsStore = &sessionsStore{}
+
+// sessionsStore uses bolt to store and retrieve sessions
+type sessionsStore struct {
+	client *Service
+}
+
+// All returns all known sessions
+func (s *sessionsStore) All(ctx context.Context) ([]cloudhub.Session, error) {
+	var sessions []cloudhub.Session
+	if err := s.client.kv.View(ctx, func(tx Tx) error {
+		return tx.Bucket(sessionsBucket).ForEach(func(k, v []byte) error {
+			var sess cloudhub.Session
+			if err := internal.UnmarshalSession(v, &sess); err != nil {
+				return err
+			}
+			sessions = append(sessions, sess)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// Add creates a new session in the sessionsStore.
+func (s *sessionsStore) Add(ctx context.Context, sess cloudhub.Session) (cloudhub.Session, error) {
+	if err := s.client.kv.Update(ctx, func(tx Tx) error {
+		b := tx.Bucket(sessionsBucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		sess.ID = strconv.FormatUint(seq, 10)
+
+		if v, err := internal.MarshalSession(sess); err != nil {
+			return err
+		} else if err := b.Put([]byte(sess.ID), v); err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return cloudhub.Session{}, err
+	}
+
+	return sess, nil
+}
+
+// Delete removes the session from the sessionsStore
+func (s *sessionsStore) Delete(ctx context.Context, sess cloudhub.Session) error {
+	if err := s.client.kv.Update(ctx, func(tx Tx) error {
+		if err := tx.Bucket(sessionsBucket).Delete([]byte(sess.ID)); err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Get returns a session if the id exists.
+func (s *sessionsStore) Get(ctx context.Context, id string) (cloudhub.Session, error) {
+	var sess cloudhub.Session
+	if err := s.client.kv.View(ctx, func(tx Tx) error {
+		if v, err := tx.Bucket(sessionsBucket).Get([]byte(id)); v == nil || err != nil {
+			return cloudhub.ErrSessionNotFound
+		} else if err := internal.UnmarshalSession(v, &sess); err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return cloudhub.Session{}, err
+	}
+
+	return sess, nil
+}
+
+// Update a session
+func (s *sessionsStore) Update(ctx context.Context, sess cloudhub.Session) error {
+	if err := s.client.kv.Update(ctx, func(tx Tx) error {
+		// Get an existing session with the same ID.
+		b := tx.Bucket(sessionsBucket)
+		if v, err := b.Get([]byte(sess.ID)); v == nil || err != nil {
+			return cloudhub.ErrSessionNotFound
+		}
+
+		if v, err := internal.MarshalSession(sess); err != nil {
+			return err
+		} else if err := b.Put([]byte(sess.ID), v); err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	gocmp "github.com/google/go-cmp/cmp"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// Ensure a SessionsStore can store, retrieve, update, and delete sessions.
+func TestSessionsStore(t *testing.T) {
+	c, err := NewTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	s := c.SessionsStore()
+
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	sessions := []cloudhub.Session{
+		{
+			Subject:      "marty@pinheads.rok",
+			Provider:     "github",
+			Organization: "default",
+			UserAgent:    "Mozilla/5.0",
+			RemoteAddr:   "10.0.0.1:51234",
+			CreatedAt:    now,
+			LastSeenAt:   now,
+			ExpiresAt:    now.Add(5 * time.Minute),
+		},
+		{
+			Subject:    "doc@pinheads.rok",
+			Provider:   "local",
+			CreatedAt:  now,
+			LastSeenAt: now,
+			ExpiresAt:  now.Add(5 * time.Minute),
+		},
+	}
+
+	ctx := context.Background()
+	for i, session := range sessions {
+		if sessions[i], err = s.Add(ctx, session); err != nil {
+			t.Fatal(err)
+		}
+		if actual, err := s.Get(ctx, sessions[i].ID); err != nil {
+			t.Fatal(err)
+		} else if diff := gocmp.Diff(actual, sessions[i]); diff != "" {
+			t.Fatalf("Session loaded is different then session saved; diff %s", diff)
+		}
+	}
+
+	sessions[1].LastSeenAt = now.Add(time.Minute)
+	if err := s.Update(ctx, sessions[1]); err != nil {
+		t.Fatal(err)
+	}
+	if actual, err := s.Get(ctx, sessions[1].ID); err != nil {
+		t.Fatal(err)
+	} else if !actual.LastSeenAt.Equal(sessions[1].LastSeenAt) {
+		t.Fatalf("Session update error: got last seen at %v, expected %v", actual.LastSeenAt, sessions[1].LastSeenAt)
+	}
+	if err := s.Update(ctx, cloudhub.Session{ID: "1337"}); err != cloudhub.ErrSessionNotFound {
+		t.Fatalf("Session update of a missing session error: got %v, expected %v", err, cloudhub.ErrSessionNotFound)
+	}
+
+	if err := s.Delete(ctx, sessions[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, sessions[0].ID); err != cloudhub.ErrSessionNotFound {
+		t.Fatalf("Session delete error: got %v, expected %v", err, cloudhub.ErrSessionNotFound)
+	}
+
+	if all, err := s.All(ctx); err != nil {
+		t.Fatal(err)
+	} else if len(all) != 1 {
+		t.Fatalf("After delete All returned incorrect number of sessions; got %d, expected %d", len(all), 1)
+	} else if diff := gocmp.Diff(all[0], sessions[1]); diff != "" {
+		t.Fatalf("After delete All returned incorrect session; diff %s", diff)
+	}
+}
@@ -0,0 +1,210 @@
+package ldap
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// BER identifier classes and the constructed bit (X.690 Section 8.1.2)
+const (
+	classUniversal   = 0x00
+	classApplication = 0x40
+	classContext     = 0x80
+
+	constructed = 0x20
+)
+
+// Universal tags used by LDAP (RFC 4511 Section 5.1)
+const (
+	tagBoolean     = 0x01
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagEnumerated  = 0x0a
+	tagSequence    = 0x10 | constructed
+	tagSet         = 0x11 | constructed
+)
+
+// maxPacketLength bounds the length of a message read from a server
+const maxPacketLength = 16 << 20
+
+var errPacket = errors.New("malformed LDAP packet")
+
+// packet is a BER encoded element with the one byte identifiers of LDAP.
+// Primitive elements have a value; constructed elements have children.
+type packet struct {
+	tag      byte
+	value    []byte
+	children []*packet
+}
+
+func newSequence(children ...*packet) *packet {
+	return &packet{tag: tagSequence, children: children}
+}
+
+func newString(tag byte, s string) *packet {
+	return &packet{tag: tag, value: []byte(s)}
+}
+
+func newInt(tag byte, i int64) *packet {
+	// Minimal two's complement, big-endian
+	b := []byte{}
+	for {
+		b = append([]byte{byte(i)}, b...)
+		if (i >= -128 && i < 128) || len(b) == 8 {
+			break
+		}
+		i >>= 8
+	}
+	return &packet{tag: tag, value: b}
+}
+
+func newBool(b bool) *packet {
+	if b {
+		return &packet{tag: tagBoolean, value: []byte{0xff}}
+	}
+	return &packet{tag: tagBoolean, value: []byte{0x00}}
+}
+
+func (p *packet) constructed() bool {
+	return p.tag&constructed != 0
+}
+
+// Int decodes the value of an INTEGER or ENUMERATED
+func (p *packet) Int() (int64, error) {
+	if len(p.value) == 0 || len(p.value) > 8 {
+		return 0, errPacket
+	}
+	i := int64(int8(p.value[0]))
+	for _, b := range p.value[1:] {
+		i = i<<8 | int64(b)
+	}
+	return i, nil
+}
+
+// String decodes the value of an OCTET STRING
+func (p *packet) String() string {
+	return string(p.value)
+}
+
+// child returns the i-th child of a constructed packet
+func (p *packet) child(i int) (*packet, error) {
+	if i >= len(p.children) {
+		return nil, errPacket
+	}
+	return p.children[i], nil
+}
+
+// Bytes encodes the packet with definite lengths
+func (p *packet) Bytes() []byte {
+	content := p.value
+	if p.constructed() {
+		content = []byte{}
+		for _, c := range p.children {
+			content = append(content, c.Bytes()...)
+		}
+	}
+	b := append([]byte{p.tag}, encodeLength(len(content))...)
+	return append(b, content...)
+}
+
+func encodeLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	b := []byte{}
+	for ; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
+
+// readPacket reads the next element of r
+func readPacket(r *bufio.Reader) (*packet, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if tag&0x1f == 0x1f {
+		return nil, fmt.Errorf("%v: multiple byte tags are not supported", errPacket)
+	}
+
+	n, err := readLength(r)
+	if err != nil {
+		return nil, err
+	}
+	content := make([]byte, n)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return nil, err
+	}
+	return decodePacket(tag, content)
+}
+
+func readLength(r *bufio.Reader) (int, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if b < 0x80 {
+		return int(b), nil
+	}
+	octets := int(b &^ 0x80)
+	if octets == 0 || octets > 4 {
+		// Indefinite lengths are forbidden by RFC 4511 Section 5.1
+		return 0, errPacket
+	}
+	n := 0
+	for i := 0; i < octets; i++ {
+		if b, err = r.ReadByte(); err != nil {
+			return 0, err
+		}
+		n = n<<8 | int(b)
+	}
+	if n > maxPacketLength {
+		return 0, fmt.Errorf("%v: length %d is too long", errPacket, n)
+	}
+	return n, nil
+}
+
+// decodePacket decodes the content of an element, and of its children
+func decodePacket(tag byte, content []byte) (*packet, error) {
+	p := &packet{tag: tag}
+	if !p.constructed() {
+		p.value = content
+		return p, nil
+	}
+
+	p.children = []*packet{}
+	for len(content) > 0 {
+		if len(content) < 2 || content[0]&0x1f == 0x1f {
+			return nil, errPacket
+		}
+		tag, rest := content[0], content[1:]
+
+		n := int(rest[0])
+		rest = rest[1:]
+		if n >= 0x80 {
+			octets := n &^ 0x80
+			if octets == 0 || octets > 4 || len(rest) < octets {
+				return nil, errPacket
+			}
+			n = 0
+			for _, b := range rest[:octets] {
+				n = n<<8 | int(b)
+			}
+			rest = rest[octets:]
+		}
+		if n < 0 || n > len(rest) {
+			return nil, errPacket
+		}
+
+		c, err := decodePacket(tag, rest[:n])
+		if err != nil {
+			return nil, err
+		}
+		p.children = append(p.children, c)
+		content = rest[n:]
+	}
+	return p, nil
+}
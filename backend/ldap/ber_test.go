@@ -0,0 +1,61 @@
+package ldap
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPacket_Int(t *testing.T) {
+	for _, i := range []int64{0, 1, 127, 128, 255, 256, 65535, -1, -128, -129, 1 << 40} {
+		p := newInt(tagInteger, i)
+		got, err := p.Int()
+		if err != nil {
+			t.Fatalf("Int() error = %v", err)
+		}
+		if got != i {
+			t.Errorf("Int() = %d, want %d", got, i)
+		}
+	}
+	if got := newInt(tagInteger, 128).Bytes(); !bytes.Equal(got, []byte{0x02, 0x02, 0x00, 0x80}) {
+		t.Errorf("Bytes() = % x, want 02 02 00 80", got)
+	}
+}
+
+func TestReadPacket(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	want := newSequence(
+		newInt(tagInteger, 7),
+		&packet{tag: opBindRequest, children: []*packet{
+			newInt(tagInteger, 3),
+			newString(tagOctetString, long),
+			newString(simpleAuth, ""),
+		}},
+	)
+
+	got, err := readPacket(bufio.NewReader(bytes.NewReader(want.Bytes())))
+	if err != nil {
+		t.Fatalf("readPacket() error = %v", err)
+	}
+	if !reflect.DeepEqual(got.Bytes(), want.Bytes()) {
+		t.Errorf("readPacket() = % x, want % x", got.Bytes(), want.Bytes())
+	}
+	if got.children[1].children[1].String() != long {
+		t.Errorf("readPacket() did not decode the long form length")
+	}
+}
+
+func TestReadPacket_Malformed(t *testing.T) {
+	for _, b := range [][]byte{
+		{0x30, 0x80},             // indefinite length
+		{0x30, 0x03, 0x02, 0x05}, // truncated content
+		{0x30, 0x02, 0x04, 0x05}, // child longer than its parent
+		{0x1f, 0x01, 0x00},       // multiple byte tag
+	} {
+		if _, err := readPacket(bufio.NewReader(bytes.NewReader(b))); err == nil {
+			t.Errorf("readPacket(% x) expected an error", b)
+		}
+	}
+}
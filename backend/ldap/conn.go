@@ -0,0 +1,344 @@
+package ldap
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Protocol operations of LDAPMessage (RFC 4511 Section 4.2)
+const (
+	opBindRequest       = classApplication | constructed | 0
+	opBindResponse      = classApplication | constructed | 1
+	opUnbindRequest     = classApplication | 2
+	opSearchRequest     = classApplication | constructed | 3
+	opSearchEntry       = classApplication | constructed | 4
+	opSearchDone        = classApplication | constructed | 5
+	opSearchReference   = classApplication | constructed | 19
+	opExtendedRequest   = classApplication | constructed | 23
+	opExtendedResponse  = classApplication | constructed | 24
+	extendedRequestName = classContext | 0
+	simpleAuth          = classContext | 0
+)
+
+// oidStartTLS is the name of the StartTLS extended operation (RFC 4511 Section 4.14)
+const oidStartTLS = "1.3.6.1.4.1.1466.20037"
+
+// Result codes of LDAPResult (RFC 4511 Appendix A)
+const (
+	ResultSuccess            = 0
+	ResultSizeLimitExceeded  = 4
+	ResultInvalidCredentials = 49
+)
+
+// Scope of a search (RFC 4511 Section 4.5.1.2)
+type Scope int
+
+// Scopes of a search
+const (
+	ScopeBaseObject Scope = iota
+	ScopeSingleLevel
+	ScopeWholeSubtree
+)
+
+// Error is a result of an operation other than success
+type Error struct {
+	ResultCode int64
+	Message    string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("LDAP result code %d", e.ResultCode)
+	}
+	return fmt.Sprintf("LDAP result code %d: %s", e.ResultCode, e.Message)
+}
+
+// Entry is an entry returned by a search
+type Entry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// Get returns the values of an attribute; attribute names are case
+// insensitive
+func (e *Entry) Get(attr string) []string {
+	for name, values := range e.Attributes {
+		if strings.EqualFold(name, attr) {
+			return values
+		}
+	}
+	return nil
+}
+
+// SearchRequest searches the entries below BaseDN matching Filter
+type SearchRequest struct {
+	BaseDN     string
+	Scope      Scope
+	SizeLimit  int
+	Filter     string   // Filter is a RFC 4515 filter, such as (uid=jdoe)
+	Attributes []string // Attributes returned for each entry; none returns all of them
+}
+
+// Conn is a connection to an LDAP server. Operations are synchronous; a
+// Conn must not be shared by goroutines.
+type Conn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	id   int64
+}
+
+// Dial connects to the server of an ldap:// or ldaps:// URL. The TLS
+// configuration of ldaps:// defaults to verifying the host of the URL.
+func Dial(ctx context.Context, rawurl string, config *tls.Config) (*Conn, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	host, port := u.Hostname(), u.Port()
+	switch u.Scheme {
+	case "ldap":
+		if port == "" {
+			port = "389"
+		}
+	case "ldaps":
+		if port == "" {
+			port = "636"
+		}
+	default:
+		return nil, fmt.Errorf("unsupported LDAP URL scheme %q", u.Scheme)
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "ldaps" {
+		tlsConn := tls.Client(conn, tlsConfigFor(host, config))
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	c := &Conn{conn: conn, r: bufio.NewReader(conn)}
+	if deadline, ok := ctx.Deadline(); ok {
+		c.SetDeadline(deadline)
+	}
+	return c, nil
+}
+
+func tlsConfigFor(host string, config *tls.Config) *tls.Config {
+	if config == nil {
+		config = &tls.Config{}
+	}
+	if config.ServerName == "" {
+		config = config.Clone()
+		config.ServerName = host
+	}
+	return config
+}
+
+// SetDeadline sets the deadline of the operations of the connection
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+// StartTLS upgrades the connection to TLS (RFC 4511 Section 4.14)
+func (c *Conn) StartTLS(config *tls.Config) error {
+	host, _, err := net.SplitHostPort(c.conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+
+	res, err := c.request(&packet{tag: opExtendedRequest, children: []*packet{
+		newString(extendedRequestName, oidStartTLS),
+	}})
+	if err != nil {
+		return err
+	}
+	if err := result(res, opExtendedResponse); err != nil {
+		return err
+	}
+
+	tlsConn := tls.Client(c.conn, tlsConfigFor(host, config))
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	c.conn = tlsConn
+	c.r = bufio.NewReader(tlsConn)
+	return nil
+}
+
+// Bind authenticates the connection with the password of dn (RFC 4511
+// Section 4.2). An empty dn and password bind anonymously; an empty
+// password of another dn is rejected rather than sent as an
+// unauthenticated bind.
+func (c *Conn) Bind(dn, password string) error {
+	if password == "" && dn != "" {
+		return &Error{ResultCode: ResultInvalidCredentials, Message: "empty password"}
+	}
+	res, err := c.request(&packet{tag: opBindRequest, children: []*packet{
+		newInt(tagInteger, 3),
+		newString(tagOctetString, dn),
+		newString(simpleAuth, password),
+	}})
+	if err != nil {
+		return err
+	}
+	return result(res, opBindResponse)
+}
+
+// Search returns the entries matching a request. When the size limit is
+// exceeded, the entries returned before are returned with an Error.
+func (c *Conn) Search(req *SearchRequest) ([]*Entry, error) {
+	filter, err := parseFilter(req.Filter)
+	if err != nil {
+		return nil, err
+	}
+	attrs := newSequence()
+	for _, a := range req.Attributes {
+		attrs.children = append(attrs.children, newString(tagOctetString, a))
+	}
+
+	id, err := c.send(&packet{tag: opSearchRequest, children: []*packet{
+		newString(tagOctetString, req.BaseDN),
+		newInt(tagEnumerated, int64(req.Scope)),
+		newInt(tagEnumerated, 0), // neverDerefAliases
+		newInt(tagInteger, int64(req.SizeLimit)),
+		newInt(tagInteger, 0),
+		newBool(false),
+		filter,
+		attrs,
+	}})
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []*Entry{}
+	for {
+		op, err := c.receive(id)
+		if err != nil {
+			return nil, err
+		}
+		switch op.tag {
+		case opSearchEntry:
+			e, err := decodeEntry(op)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, e)
+		case opSearchReference:
+			// Referrals to other servers are not followed
+		case opSearchDone:
+			return entries, result(op, opSearchDone)
+		default:
+			return nil, errPacket
+		}
+	}
+}
+
+// Close unbinds and closes the connection
+func (c *Conn) Close() error {
+	c.send(&packet{tag: opUnbindRequest})
+	return c.conn.Close()
+}
+
+// request sends an operation and receives its response
+func (c *Conn) request(op *packet) (*packet, error) {
+	id, err := c.send(op)
+	if err != nil {
+		return nil, err
+	}
+	return c.receive(id)
+}
+
+func (c *Conn) send(op *packet) (int64, error) {
+	c.id++
+	msg := newSequence(newInt(tagInteger, c.id), op)
+	if _, err := c.conn.Write(msg.Bytes()); err != nil {
+		return 0, err
+	}
+	return c.id, nil
+}
+
+// receive returns the next operation of the response to message id
+func (c *Conn) receive(id int64) (*packet, error) {
+	for {
+		msg, err := readPacket(c.r)
+		if err != nil {
+			return nil, err
+		}
+		if msg.tag != tagSequence || len(msg.children) < 2 {
+			return nil, errPacket
+		}
+		msgID, err := msg.children[0].Int()
+		if err != nil {
+			return nil, err
+		}
+		op := msg.children[1]
+		if msgID == 0 {
+			// Unsolicited notifications, such as notices of disconnection
+			if err := result(op, opExtendedResponse); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if msgID != id {
+			return nil, fmt.Errorf("%v: response to message %d, not %d", errPacket, msgID, id)
+		}
+		return op, nil
+	}
+}
+
+// result returns the LDAPResult of an operation as an error
+func result(op *packet, tag byte) error {
+	if op.tag != tag || len(op.children) < 3 {
+		return errPacket
+	}
+	code, err := op.children[0].Int()
+	if err != nil {
+		return err
+	}
+	if code != ResultSuccess {
+		return &Error{ResultCode: code, Message: op.children[2].String()}
+	}
+	return nil
+}
+
+func decodeEntry(op *packet) (*Entry, error) {
+	dn, err := op.child(0)
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := op.child(1)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Entry{DN: dn.String(), Attributes: map[string][]string{}}
+	for _, attr := range attrs.children {
+		name, err := attr.child(0)
+		if err != nil {
+			return nil, err
+		}
+		vals, err := attr.child(1)
+		if err != nil {
+			return nil, err
+		}
+		values := []string{}
+		for _, v := range vals.children {
+			values = append(values, v.String())
+		}
+		e.Attributes[name.String()] = values
+	}
+	return e, nil
+}
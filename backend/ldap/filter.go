@@ -0,0 +1,203 @@
+package ldap
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Filter choices of a SearchRequest (RFC 4511 Section 4.5.1)
+const (
+	filterAnd            = classContext | constructed | 0
+	filterOr             = classContext | constructed | 1
+	filterNot            = classContext | constructed | 2
+	filterEqualityMatch  = classContext | constructed | 3
+	filterSubstrings     = classContext | constructed | 4
+	filterGreaterOrEqual = classContext | constructed | 5
+	filterLessOrEqual    = classContext | constructed | 6
+	filterPresent        = classContext | 7
+	filterApproxMatch    = classContext | constructed | 8
+
+	substringInitial = classContext | 0
+	substringAny     = classContext | 1
+	substringFinal   = classContext | 2
+)
+
+// EscapeFilter escapes a value, such as a username, to be put within a
+// filter (RFC 4515 Section 3)
+func EscapeFilter(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '*', '(', ')', '\\', 0:
+			fmt.Fprintf(&b, `\%02x`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// parseFilter parses the string representation of a search filter
+// (RFC 4515), such as (&(objectClass=person)(uid=jdoe)). Extensible
+// matches are not supported.
+func parseFilter(filter string) (*packet, error) {
+	p, rest, err := compileFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %v", filter, err)
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("invalid filter %q: unexpected %q", filter, rest)
+	}
+	return p, nil
+}
+
+// compileFilter compiles the parenthesized filter at the start of s, and
+// returns what follows it
+func compileFilter(s string) (*packet, string, error) {
+	if !strings.HasPrefix(s, "(") {
+		return nil, "", fmt.Errorf("missing (")
+	}
+	s = s[1:]
+	if s == "" {
+		return nil, "", fmt.Errorf("missing )")
+	}
+
+	var p *packet
+	switch s[0] {
+	case '&', '|':
+		tag := byte(filterAnd)
+		if s[0] == '|' {
+			tag = filterOr
+		}
+		p = &packet{tag: tag, children: []*packet{}}
+		s = s[1:]
+		for strings.HasPrefix(s, "(") {
+			c, rest, err := compileFilter(s)
+			if err != nil {
+				return nil, "", err
+			}
+			p.children = append(p.children, c)
+			s = rest
+		}
+	case '!':
+		c, rest, err := compileFilter(s[1:])
+		if err != nil {
+			return nil, "", err
+		}
+		p = &packet{tag: filterNot, children: []*packet{c}}
+		s = rest
+	default:
+		end := strings.IndexByte(s, ')')
+		if end < 0 {
+			return nil, "", fmt.Errorf("missing )")
+		}
+		item, err := compileItem(s[:end])
+		if err != nil {
+			return nil, "", err
+		}
+		p = item
+		s = s[end:]
+	}
+
+	if !strings.HasPrefix(s, ")") {
+		return nil, "", fmt.Errorf("missing )")
+	}
+	return p, s[1:], nil
+}
+
+// compileItem compiles a simple, present or substrings filter
+func compileItem(item string) (*packet, error) {
+	eq := strings.IndexByte(item, '=')
+	if eq <= 0 {
+		return nil, fmt.Errorf("missing attribute or = in %q", item)
+	}
+	attr, value := item[:eq], item[eq+1:]
+
+	tag := byte(filterEqualityMatch)
+	switch attr[len(attr)-1] {
+	case '~':
+		tag = filterApproxMatch
+	case '>':
+		tag = filterGreaterOrEqual
+	case '<':
+		tag = filterLessOrEqual
+	case ':':
+		return nil, fmt.Errorf("extensible matches are not supported")
+	}
+	if tag != filterEqualityMatch {
+		attr = attr[:len(attr)-1]
+	}
+	if attr == "" {
+		return nil, fmt.Errorf("missing attribute in %q", item)
+	}
+
+	if tag == filterEqualityMatch && value == "*" {
+		return newString(filterPresent, attr), nil
+	}
+	if tag == filterEqualityMatch && strings.Contains(value, "*") {
+		return compileSubstrings(attr, value)
+	}
+
+	v, err := unescapeFilter(value)
+	if err != nil {
+		return nil, err
+	}
+	return &packet{tag: tag, children: []*packet{
+		newString(tagOctetString, attr),
+		newString(tagOctetString, v),
+	}}, nil
+}
+
+func compileSubstrings(attr, value string) (*packet, error) {
+	parts := strings.Split(value, "*")
+	subs := newSequence()
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		v, err := unescapeFilter(part)
+		if err != nil {
+			return nil, err
+		}
+		tag := byte(substringAny)
+		switch i {
+		case 0:
+			tag = substringInitial
+		case len(parts) - 1:
+			tag = substringFinal
+		}
+		subs.children = append(subs.children, newString(tag, v))
+	}
+	if len(subs.children) == 0 {
+		return nil, fmt.Errorf("empty substrings in %q", value)
+	}
+	return &packet{tag: filterSubstrings, children: []*packet{
+		newString(tagOctetString, attr),
+		subs,
+	}}, nil
+}
+
+// unescapeFilter decodes the \XX escapes of a value
+func unescapeFilter(value string) (string, error) {
+	if !strings.Contains(value, `\`) {
+		return value, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			b.WriteByte(value[i])
+			continue
+		}
+		if i+3 > len(value) {
+			return "", fmt.Errorf("invalid escape in %q", value)
+		}
+		c, err := hex.DecodeString(value[i+1 : i+3])
+		if err != nil {
+			return "", fmt.Errorf("invalid escape in %q", value)
+		}
+		b.Write(c)
+		i += 2
+	}
+	return b.String(), nil
+}
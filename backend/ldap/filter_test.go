@@ -0,0 +1,59 @@
+package ldap
+
+import "testing"
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   string
+	}{
+		{filter: "(uid=jdoe)", want: "(uid=jdoe)"},
+		{filter: "(objectClass=*)", want: "(objectClass=*)"},
+		{filter: "(&(objectClass=person)(|(uid=jdoe)(mail=jdoe@example.com)))", want: "(&(objectClass=person)(|(uid=jdoe)(mail=jdoe@example.com)))"},
+		{filter: "(!(accountStatus=disabled))", want: "(!(accountStatus=disabled))"},
+		{filter: "(cn=J*n*Doe)", want: "(cn=J*n*Doe)"},
+		{filter: "(cn=*Doe)", want: "(cn=*Doe)"},
+		{filter: "(uidNumber>=1000)", want: "(uidNumber>=1000)"},
+		{filter: "(sn~=doe)", want: "(sn~=doe)"},
+		{filter: `(cn=a\2ab\29)`, want: `(cn=a\2ab\29)`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			p, err := parseFilter(tt.filter)
+			if err != nil {
+				t.Fatalf("parseFilter() error = %v", err)
+			}
+			if got := filterString(p); got != tt.want {
+				t.Errorf("parseFilter() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFilter_Invalid(t *testing.T) {
+	filters := []string{
+		"",
+		"uid=jdoe",
+		"(uid=jdoe",
+		"(uid=jdoe))",
+		"(=jdoe)",
+		"(uid)",
+		`(uid=jd\o)`,
+		"(cn:caseExactMatch:=Doe)",
+		"(&(uid=jdoe)",
+	}
+	for _, f := range filters {
+		if _, err := parseFilter(f); err == nil {
+			t.Errorf("parseFilter(%q) expected an error", f)
+		}
+	}
+}
+
+func TestEscapeFilter(t *testing.T) {
+	if got, want := EscapeFilter(`*)(uid=*`), `\2a\29\28uid=\2a`; got != want {
+		t.Errorf("EscapeFilter() = %s, want %s", got, want)
+	}
+	if got, want := EscapeFilter(`cn=Doe\, John,dc=example`), `cn=Doe\5c, John,dc=example`; got != want {
+		t.Errorf("EscapeFilter() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,214 @@
+// Package ldap is a minimal LDAPv3 client (RFC 4511) authenticating users
+// of a directory, such as Active Directory, and looking up their groups.
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCredentials means that the username is unknown, ambiguous, or
+// that its password is wrong
+var ErrInvalidCredentials = errors.New("invalid LDAP credentials")
+
+// DefaultTimeout bounds the time of an authentication
+const DefaultTimeout = 10 * time.Second
+
+// Config locates the users and groups of a directory
+type Config struct {
+	URL       string      // URL of the server, ldap://host:389 or ldaps://host:636
+	StartTLS  bool        // StartTLS upgrades an ldap:// connection to TLS
+	TLSConfig *tls.Config // TLSConfig of ldaps:// and StartTLS
+	Timeout   time.Duration
+
+	BindDN       string // BindDN searches the directory; empty binds anonymously
+	BindPassword string
+
+	UserBaseDN string // UserBaseDN is the subtree of the users
+	// UserFilter finds the entry of a username, which replaces %s,
+	// e.g. (uid=%s) or (sAMAccountName=%s)
+	UserFilter string
+	// NameAttribute of the user entry is the name of the principal, e.g.
+	// mail; empty uses the username
+	NameAttribute string
+	// MemberOfAttribute of the user entry lists the DNs of its groups, e.g.
+	// memberOf of Active Directory
+	MemberOfAttribute string
+
+	GroupBaseDN string // GroupBaseDN is the subtree of the groups; empty does not search groups
+	// GroupFilter finds the groups of a user DN, which replaces %s, e.g.
+	// (member=%s) or (uniqueMember=%s)
+	GroupFilter    string
+	GroupAttribute string // GroupAttribute of the group entries is their name; empty is cn
+}
+
+// User is an authenticated user of a directory
+type User struct {
+	DN     string
+	Name   string
+	Groups []string
+}
+
+// Authenticate binds as the entry of a username with its password, and
+// looks up its groups. ErrInvalidCredentials is returned when the user is
+// not found, is found more than once, or the password is wrong.
+func (c *Config) Authenticate(ctx context.Context, username, password string) (*User, error) {
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	conn, err := Dial(ctx, c.URL, c.TLSConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if c.StartTLS {
+		if err := conn.StartTLS(c.TLSConfig); err != nil {
+			return nil, fmt.Errorf("unable to start TLS: %v", err)
+		}
+	}
+	if err := c.bind(conn); err != nil {
+		return nil, err
+	}
+
+	attrs := []string{}
+	for _, a := range []string{c.NameAttribute, c.MemberOfAttribute} {
+		if a != "" {
+			attrs = append(attrs, a)
+		}
+	}
+	if len(attrs) == 0 {
+		// Only the DN is needed; 1.1 requests no attributes (RFC 4511 Section 4.5.1.8)
+		attrs = append(attrs, "1.1")
+	}
+	entries, err := conn.Search(&SearchRequest{
+		BaseDN:     c.UserBaseDN,
+		Scope:      ScopeWholeSubtree,
+		SizeLimit:  2,
+		Filter:     strings.Replace(c.UserFilter, "%s", EscapeFilter(username), -1),
+		Attributes: attrs,
+	})
+	if e, ok := err.(*Error); ok && e.ResultCode == ResultSizeLimitExceeded {
+		return nil, ErrInvalidCredentials
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to search users: %v", err)
+	}
+	if len(entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	entry := entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if e, ok := err.(*Error); ok && e.ResultCode == ResultInvalidCredentials {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	user := &User{
+		DN:     entry.DN,
+		Name:   username,
+		Groups: []string{},
+	}
+	if c.NameAttribute != "" {
+		names := entry.Get(c.NameAttribute)
+		if len(names) == 0 || names[0] == "" {
+			return nil, fmt.Errorf("user %s has no %s", entry.DN, c.NameAttribute)
+		}
+		user.Name = names[0]
+	}
+	if c.MemberOfAttribute != "" {
+		for _, dn := range entry.Get(c.MemberOfAttribute) {
+			user.addGroup(firstRDNValue(dn))
+		}
+	}
+
+	if c.GroupBaseDN != "" {
+		// Groups are searched with the rights of BindDN rather than the user
+		if err := c.bind(conn); err != nil {
+			return nil, err
+		}
+		groupAttribute := c.GroupAttribute
+		if groupAttribute == "" {
+			groupAttribute = "cn"
+		}
+		groups, err := conn.Search(&SearchRequest{
+			BaseDN:     c.GroupBaseDN,
+			Scope:      ScopeWholeSubtree,
+			Filter:     strings.Replace(c.GroupFilter, "%s", EscapeFilter(entry.DN), -1),
+			Attributes: []string{groupAttribute},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to search groups: %v", err)
+		}
+		for _, g := range groups {
+			for _, name := range g.Get(groupAttribute) {
+				user.addGroup(name)
+			}
+		}
+	}
+	return user, nil
+}
+
+func (c *Config) bind(conn *Conn) error {
+	if err := conn.Bind(c.BindDN, c.BindPassword); err != nil {
+		return fmt.Errorf("unable to bind as %q: %v", c.BindDN, err)
+	}
+	return nil
+}
+
+func (u *User) addGroup(name string) {
+	if name == "" {
+		return
+	}
+	for _, g := range u.Groups {
+		if g == name {
+			return
+		}
+	}
+	u.Groups = append(u.Groups, name)
+}
+
+// firstRDNValue returns the value of the first RDN of a DN, such as
+// admins of cn=admins,ou=groups,dc=example,dc=com (RFC 4514)
+func firstRDNValue(dn string) string {
+	eq := strings.IndexByte(dn, '=')
+	if eq < 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	value := strings.TrimLeft(dn[eq+1:], " ")
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case c == ',' || c == '+':
+			return strings.TrimRight(b.String(), " ")
+		case c == '\\' && i+1 < len(value):
+			if i+2 < len(value) {
+				if h, err := hex.DecodeString(value[i+1 : i+3]); err == nil {
+					b.Write(h)
+					i += 2
+					continue
+				}
+			}
+			b.WriteByte(value[i+1])
+			i++
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return strings.TrimRight(b.String(), " ")
+}
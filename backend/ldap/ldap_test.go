@@ -0,0 +1,208 @@
+package ldap
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func directory(t *testing.T, anonymous bool) *testServer {
+	s := &testServer{Anonymous: anonymous, Entries: []*Entry{
+		&Entry{DN: "uid=jdoe,ou=people,dc=example,dc=com", Attributes: map[string][]string{
+			"objectClass": {"person"},
+			"uid":         {"jdoe"},
+			"mail":        {"jdoe@example.com"},
+			"memberOf":    {"CN=Domain Admins,CN=Users,DC=example,DC=com", `CN=Ops\, EU,OU=groups,DC=example,DC=com`},
+		}},
+		&Entry{DN: "uid=asmith,ou=people,dc=example,dc=com", Attributes: map[string][]string{
+			"objectClass": {"person"},
+			"uid":         {"asmith"},
+		}},
+		&Entry{DN: "uid=twin,ou=people,dc=example,dc=com", Attributes: map[string][]string{
+			"objectClass": {"person"},
+			"uid":         {"twin"},
+		}},
+		&Entry{DN: "uid=twin,ou=contractors,dc=example,dc=com", Attributes: map[string][]string{
+			"objectClass": {"person"},
+			"uid":         {"twin"},
+		}},
+		&Entry{DN: "cn=admins,ou=groups,dc=example,dc=com", Attributes: map[string][]string{
+			"cn":     {"admins"},
+			"member": {"uid=jdoe,ou=people,dc=example,dc=com", "uid=asmith,ou=people,dc=example,dc=com"},
+		}},
+		&Entry{DN: "cn=developers,ou=groups,dc=example,dc=com", Attributes: map[string][]string{
+			"cn":     {"developers"},
+			"member": {"uid=jdoe,ou=people,dc=example,dc=com"},
+		}},
+	}}
+	s.Passwords = map[string]string{
+		"cn=reader,dc=example,dc=com":               "reader-secret",
+		"uid=jdoe,ou=people,dc=example,dc=com":      "jdoe-secret",
+		"uid=asmith,ou=people,dc=example,dc=com":    "asmith-secret",
+		"uid=twin,ou=people,dc=example,dc=com":      "twin-secret",
+		"uid=twin,ou=contractors,dc=example,dc=com": "twin-secret",
+	}
+	return s.start(t)
+}
+
+func TestConfig_Authenticate(t *testing.T) {
+	s := directory(t, false)
+	defer s.Close()
+
+	config := Config{
+		URL:          s.URL,
+		BindDN:       "cn=reader,dc=example,dc=com",
+		BindPassword: "reader-secret",
+		UserBaseDN:   "dc=example,dc=com",
+		UserFilter:   "(&(objectClass=person)(uid=%s))",
+		GroupBaseDN:  "ou=groups,dc=example,dc=com",
+		GroupFilter:  "(member=%s)",
+	}
+
+	tests := []struct {
+		name     string
+		config   func(Config) Config
+		username string
+		password string
+		want     *User
+		wantErr  error
+	}{
+		{
+			name:     "Groups of a group search",
+			username: "jdoe",
+			password: "jdoe-secret",
+			want: &User{
+				DN:     "uid=jdoe,ou=people,dc=example,dc=com",
+				Name:   "jdoe",
+				Groups: []string{"admins", "developers"},
+			},
+		},
+		{
+			name: "Name attribute and memberOf groups of Active Directory",
+			config: func(c Config) Config {
+				c.NameAttribute = "mail"
+				c.MemberOfAttribute = "memberOf"
+				c.GroupBaseDN = ""
+				return c
+			},
+			username: "jdoe",
+			password: "jdoe-secret",
+			want: &User{
+				DN:     "uid=jdoe,ou=people,dc=example,dc=com",
+				Name:   "jdoe@example.com",
+				Groups: []string{"Domain Admins", "Ops, EU"},
+			},
+		},
+		{
+			name:     "Wrong password",
+			username: "jdoe",
+			password: "asmith-secret",
+			wantErr:  ErrInvalidCredentials,
+		},
+		{
+			name:     "Empty password is not an unauthenticated bind",
+			username: "jdoe",
+			password: "",
+			wantErr:  ErrInvalidCredentials,
+		},
+		{
+			name:     "Unknown user",
+			username: "nobody",
+			password: "jdoe-secret",
+			wantErr:  ErrInvalidCredentials,
+		},
+		{
+			name:     "Username matching more than one user",
+			username: "twin",
+			password: "twin-secret",
+			wantErr:  ErrInvalidCredentials,
+		},
+		{
+			name:     "Wildcard username is escaped",
+			username: "j*",
+			password: "jdoe-secret",
+			wantErr:  ErrInvalidCredentials,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := config
+			if tt.config != nil {
+				c = tt.config(c)
+			}
+			got, err := c.Authenticate(context.Background(), tt.username, tt.password)
+			if err != tt.wantErr {
+				t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Authenticate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	want := []string{
+		"(&(objectClass=person)(uid=jdoe))",
+		"(member=uid=jdoe,ou=people,dc=example,dc=com)",
+	}
+	if got := s.Searches()[:2]; !reflect.DeepEqual(got, want) {
+		t.Errorf("searches = %v, want %v", got, want)
+	}
+}
+
+func TestConfig_Authenticate_BindDN(t *testing.T) {
+	s := directory(t, false)
+	defer s.Close()
+
+	config := Config{
+		URL:          s.URL,
+		BindDN:       "cn=reader,dc=example,dc=com",
+		BindPassword: "wrong",
+		UserBaseDN:   "dc=example,dc=com",
+		UserFilter:   "(uid=%s)",
+	}
+	if _, err := config.Authenticate(context.Background(), "jdoe", "jdoe-secret"); err == nil || err == ErrInvalidCredentials {
+		t.Errorf("Authenticate() error = %v, want an error binding the search DN", err)
+	}
+
+	anonymous := directory(t, true)
+	defer anonymous.Close()
+
+	config.URL, config.BindDN, config.BindPassword = anonymous.URL, "", ""
+	got, err := config.Authenticate(context.Background(), "asmith", "asmith-secret")
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if got.Name != "asmith" {
+		t.Errorf("Authenticate() = %+v, want asmith", got)
+	}
+}
+
+func TestConfig_Authenticate_StartTLS(t *testing.T) {
+	s := directory(t, false)
+	defer s.Close()
+
+	config := Config{
+		URL:        s.URL,
+		StartTLS:   true,
+		UserBaseDN: "dc=example,dc=com",
+		UserFilter: "(uid=%s)",
+	}
+	_, err := config.Authenticate(context.Background(), "jdoe", "jdoe-secret")
+	if err == nil {
+		t.Fatal("Authenticate() expected an error of a server without StartTLS")
+	}
+}
+
+func TestFirstRDNValue(t *testing.T) {
+	tests := map[string]string{
+		"cn=admins,ou=groups,dc=example,dc=com": "admins",
+		`CN=Ops\, EU,OU=groups,DC=example`:      "Ops, EU",
+		`cn=caf\c3\a9+uid=1,dc=example`:         "café",
+		"not a dn":                              "",
+	}
+	for dn, want := range tests {
+		if got := firstRDNValue(dn); got != want {
+			t.Errorf("firstRDNValue(%q) = %q, want %q", dn, got, want)
+		}
+	}
+}
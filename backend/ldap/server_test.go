@@ -0,0 +1,251 @@
+package ldap
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testServer is an in-process LDAP server of a fixed directory. It
+// supports simple binds and searches of the whole subtree.
+type testServer struct {
+	URL       string
+	Entries   []*Entry
+	Passwords map[string]string // Passwords of the DNs that can bind
+	Anonymous bool              // Anonymous allows searches without a bind
+
+	mu       sync.Mutex
+	searches []string // searches are the filters of the searches received
+
+	ln net.Listener
+}
+
+// start listens on a local port and serves the directory until Close
+func (s *testServer) start(t *testing.T) *testServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.URL = "ldap://" + ln.Addr().String()
+	s.ln = ln
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *testServer) Close() {
+	s.ln.Close()
+}
+
+func (s *testServer) Searches() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.searches...)
+}
+
+func (s *testServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	bound := ""
+	for {
+		msg, err := readPacket(r)
+		if err != nil || len(msg.children) < 2 {
+			return
+		}
+		id := msg.children[0]
+		op := msg.children[1]
+
+		reply := func(ops ...*packet) {
+			for _, op := range ops {
+				conn.Write(newSequence(id, op).Bytes())
+			}
+		}
+		switch op.tag {
+		case opUnbindRequest:
+			return
+		case opBindRequest:
+			dn, password := op.children[1].String(), op.children[2].String()
+			if want, ok := s.Passwords[dn]; (dn != "" || password != "") && (!ok || want != password) {
+				reply(ldapResult(opBindResponse, ResultInvalidCredentials, "invalid credentials"))
+				continue
+			}
+			bound = dn
+			reply(ldapResult(opBindResponse, ResultSuccess, ""))
+		case opSearchRequest:
+			if bound == "" && !s.Anonymous {
+				reply(ldapResult(opSearchDone, 50, "insufficient access rights"))
+				continue
+			}
+			base := strings.ToLower(op.children[0].String())
+			limit, _ := op.children[3].Int()
+			filter := op.children[6]
+			attrs := op.children[7].children
+
+			s.mu.Lock()
+			s.searches = append(s.searches, filterString(filter))
+			s.mu.Unlock()
+
+			found := []*packet{}
+			for _, e := range s.Entries {
+				if !strings.HasSuffix(strings.ToLower(e.DN), base) || !matches(filter, e) {
+					continue
+				}
+				if limit > 0 && int64(len(found)) == limit {
+					reply(found...)
+					reply(ldapResult(opSearchDone, ResultSizeLimitExceeded, ""))
+					found = nil
+					break
+				}
+				found = append(found, searchEntry(e, attrs))
+			}
+			if found != nil {
+				reply(found...)
+				reply(ldapResult(opSearchDone, ResultSuccess, ""))
+			}
+		default:
+			reply(ldapResult(opExtendedResponse, 2, "unsupported operation"))
+		}
+	}
+}
+
+func ldapResult(tag byte, code int64, message string) *packet {
+	return &packet{tag: tag, children: []*packet{
+		newInt(tagEnumerated, code),
+		newString(tagOctetString, ""),
+		newString(tagOctetString, message),
+	}}
+}
+
+func searchEntry(e *Entry, attrs []*packet) *packet {
+	list := newSequence()
+	for name, values := range e.Attributes {
+		requested := len(attrs) == 0
+		for _, a := range attrs {
+			requested = requested || strings.EqualFold(a.String(), name)
+		}
+		if !requested {
+			continue
+		}
+		vals := &packet{tag: tagSet}
+		for _, v := range values {
+			vals.children = append(vals.children, newString(tagOctetString, v))
+		}
+		list.children = append(list.children, newSequence(newString(tagOctetString, name), vals))
+	}
+	return &packet{tag: opSearchEntry, children: []*packet{newString(tagOctetString, e.DN), list}}
+}
+
+// matches evaluates a filter with case insensitive string comparisons
+func matches(f *packet, e *Entry) bool {
+	switch f.tag {
+	case filterAnd:
+		for _, c := range f.children {
+			if !matches(c, e) {
+				return false
+			}
+		}
+		return true
+	case filterOr:
+		for _, c := range f.children {
+			if matches(c, e) {
+				return true
+			}
+		}
+		return false
+	case filterNot:
+		return !matches(f.children[0], e)
+	case filterPresent:
+		return len(e.Get(f.String())) > 0 || strings.EqualFold(f.String(), "objectClass")
+	case filterSubstrings:
+		for _, v := range e.Get(f.children[0].String()) {
+			v = strings.ToLower(v)
+			ok := true
+			for _, sub := range f.children[1].children {
+				s := strings.ToLower(sub.String())
+				switch sub.tag {
+				case substringInitial:
+					ok = ok && strings.HasPrefix(v, s)
+				case substringFinal:
+					ok = ok && strings.HasSuffix(v, s)
+				default:
+					ok = ok && strings.Contains(v, s)
+				}
+			}
+			if ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	want := strings.ToLower(f.children[1].String())
+	for _, v := range e.Get(f.children[0].String()) {
+		v = strings.ToLower(v)
+		switch f.tag {
+		case filterGreaterOrEqual:
+			if v >= want {
+				return true
+			}
+		case filterLessOrEqual:
+			if v <= want {
+				return true
+			}
+		default:
+			if v == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// filterString is the RFC 4515 representation of a filter, with escapes
+// of the values
+func filterString(f *packet) string {
+	list := func(op string) string {
+		s := "(" + op
+		for _, c := range f.children {
+			s += filterString(c)
+		}
+		return s + ")"
+	}
+	switch f.tag {
+	case filterAnd:
+		return list("&")
+	case filterOr:
+		return list("|")
+	case filterNot:
+		return list("!")
+	case filterPresent:
+		return "(" + f.String() + "=*)"
+	case filterSubstrings:
+		s := "(" + f.children[0].String() + "="
+		subs := f.children[1].children
+		if len(subs) == 0 || subs[0].tag != substringInitial {
+			s += "*"
+		}
+		for _, sub := range subs {
+			s += EscapeFilter(sub.String())
+			if sub.tag != substringFinal {
+				s += "*"
+			}
+		}
+		return s + ")"
+	}
+	op := map[byte]string{
+		filterEqualityMatch:  "=",
+		filterGreaterOrEqual: ">=",
+		filterLessOrEqual:    "<=",
+		filterApproxMatch:    "~=",
+	}[f.tag]
+	return "(" + f.children[0].String() + op + EscapeFilter(f.children[1].String()) + ")"
+}
@@ -0,0 +1,43 @@
+package mocks
+
+import (
+	"context"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+var _ cloudhub.AlertTemplatesStore = &AlertTemplatesStore{}
+
+// AlertTemplatesStore mock allows all functions to be set for testing
+type AlertTemplatesStore struct {
+	AllF    func(context.Context) ([]cloudhub.AlertTemplate, error)
+	AddF    func(context.Context, cloudhub.AlertTemplate) (cloudhub.AlertTemplate, error)
+	DeleteF func(context.Context, cloudhub.AlertTemplate) error
+	GetF    func(context.Context, string) (cloudhub.AlertTemplate, error)
+	UpdateF func(context.Context, cloudhub.AlertTemplate) error
+}
+
+// All ...
+func (s *AlertTemplatesStore) All(ctx context.Context) ([]cloudhub.AlertTemplate, error) {
+	return s.AllF(ctx)
+}
+
+// Add ...
+func (s *AlertTemplatesStore) Add(ctx context.Context, t cloudhub.AlertTemplate) (cloudhub.AlertTemplate, error) {
+	return s.AddF(ctx, t)
+}
+
+// Delete ...
+func (s *AlertTemplatesStore) Delete(ctx context.Context, t cloudhub.AlertTemplate) error {
+	return s.DeleteF(ctx, t)
+}
+
+// Get ...
+func (s *AlertTemplatesStore) Get(ctx context.Context, id string) (cloudhub.AlertTemplate, error) {
+	return s.GetF(ctx, id)
+}
+
+// Update ...
+func (s *AlertTemplatesStore) Update(ctx context.Context, t cloudhub.AlertTemplate) error {
+	return s.UpdateF(ctx, t)
+}
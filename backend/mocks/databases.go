@@ -20,7 +20,16 @@ type Databases struct {
 	UpdateRPF func(context.Context, string, string, *cloudhub.RetentionPolicy) (*cloudhub.RetentionPolicy, error)
 	DropRPF   func(context.Context, string, string) error
 
+	AllCQF    func(context.Context, string) ([]cloudhub.ContinuousQuery, error)
+	CreateCQF func(context.Context, string, *cloudhub.ContinuousQuery) (*cloudhub.ContinuousQuery, error)
+	UpdateCQF func(context.Context, string, string, *cloudhub.ContinuousQuery) (*cloudhub.ContinuousQuery, error)
+	DropCQF   func(context.Context, string, string) error
+
 	GetMeasurementsF func(ctx context.Context, db string, limit, offset int) ([]cloudhub.Measurement, error)
+	GetTagKeysF      func(ctx context.Context, db string, q cloudhub.SchemaQuery) ([]cloudhub.TagKey, error)
+	GetTagValuesF    func(ctx context.Context, db, key string, q cloudhub.SchemaQuery) ([]string, error)
+	GetFieldKeysF    func(ctx context.Context, db string, q cloudhub.SchemaQuery) ([]cloudhub.FieldKey, error)
+	GetCardinalityF  func(ctx context.Context, db string, q cloudhub.SchemaQuery) (*cloudhub.Cardinality, error)
 }
 
 // AllDB lists all databases in the current data source
@@ -63,7 +72,47 @@ func (d *Databases) DropRP(ctx context.Context, rpX string, rpY string) error {
 	return d.DropRPF(ctx, rpX, rpY)
 }
 
+// AllCQ lists all continuous queries of a database in the current data source
+func (d *Databases) AllCQ(ctx context.Context, db string) ([]cloudhub.ContinuousQuery, error) {
+	return d.AllCQF(ctx, db)
+}
+
+// CreateCQ creates a continuous query in the current data source
+func (d *Databases) CreateCQ(ctx context.Context, db string, cq *cloudhub.ContinuousQuery) (*cloudhub.ContinuousQuery, error) {
+	return d.CreateCQF(ctx, db, cq)
+}
+
+// UpdateCQ replaces a continuous query in the current data source
+func (d *Databases) UpdateCQ(ctx context.Context, db string, name string, cq *cloudhub.ContinuousQuery) (*cloudhub.ContinuousQuery, error) {
+	return d.UpdateCQF(ctx, db, name, cq)
+}
+
+// DropCQ drops a continuous query in the current data source
+func (d *Databases) DropCQ(ctx context.Context, db string, name string) error {
+	return d.DropCQF(ctx, db, name)
+}
+
 // GetMeasurements lists measurements in the current data source
 func (d *Databases) GetMeasurements(ctx context.Context, db string, limit, offset int) ([]cloudhub.Measurement, error) {
 	return d.GetMeasurementsF(ctx, db, limit, offset)
 }
+
+// GetTagKeys lists the tag keys of measurements in the current data source
+func (d *Databases) GetTagKeys(ctx context.Context, db string, q cloudhub.SchemaQuery) ([]cloudhub.TagKey, error) {
+	return d.GetTagKeysF(ctx, db, q)
+}
+
+// GetTagValues lists the values of a tag key in the current data source
+func (d *Databases) GetTagValues(ctx context.Context, db, key string, q cloudhub.SchemaQuery) ([]string, error) {
+	return d.GetTagValuesF(ctx, db, key, q)
+}
+
+// GetFieldKeys lists the field keys and types of measurements in the current data source
+func (d *Databases) GetFieldKeys(ctx context.Context, db string, q cloudhub.SchemaQuery) ([]cloudhub.FieldKey, error) {
+	return d.GetFieldKeysF(ctx, db, q)
+}
+
+// GetCardinality counts the series of a database, or of a measurement, in the current data source
+func (d *Databases) GetCardinality(ctx context.Context, db string, q cloudhub.SchemaQuery) (*cloudhub.Cardinality, error) {
+	return d.GetCardinalityF(ctx, db, q)
+}
@@ -0,0 +1,43 @@
+package mocks
+
+import (
+	"context"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+var _ cloudhub.GroupsStore = &GroupsStore{}
+
+// GroupsStore mock allows all functions to be set for testing
+type GroupsStore struct {
+	AllF    func(context.Context) ([]cloudhub.Group, error)
+	AddF    func(context.Context, cloudhub.Group) (cloudhub.Group, error)
+	DeleteF func(context.Context, cloudhub.Group) error
+	GetF    func(context.Context, string) (cloudhub.Group, error)
+	UpdateF func(context.Context, cloudhub.Group) error
+}
+
+// All ...
+func (s *GroupsStore) All(ctx context.Context) ([]cloudhub.Group, error) {
+	return s.AllF(ctx)
+}
+
+// Add ...
+func (s *GroupsStore) Add(ctx context.Context, t cloudhub.Group) (cloudhub.Group, error) {
+	return s.AddF(ctx, t)
+}
+
+// Delete ...
+func (s *GroupsStore) Delete(ctx context.Context, t cloudhub.Group) error {
+	return s.DeleteF(ctx, t)
+}
+
+// Get ...
+func (s *GroupsStore) Get(ctx context.Context, id string) (cloudhub.Group, error) {
+	return s.GetF(ctx, id)
+}
+
+// Update ...
+func (s *GroupsStore) Update(ctx context.Context, t cloudhub.Group) error {
+	return s.UpdateF(ctx, t)
+}
@@ -0,0 +1,43 @@
+package mocks
+
+import (
+	"context"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+var _ cloudhub.PoliciesStore = &PoliciesStore{}
+
+// PoliciesStore mock allows all functions to be set for testing
+type PoliciesStore struct {
+	AllF    func(context.Context) ([]cloudhub.Policy, error)
+	AddF    func(context.Context, cloudhub.Policy) (cloudhub.Policy, error)
+	DeleteF func(context.Context, cloudhub.Policy) error
+	GetF    func(context.Context, string) (cloudhub.Policy, error)
+	UpdateF func(context.Context, cloudhub.Policy) error
+}
+
+// All ...
+func (s *PoliciesStore) All(ctx context.Context) ([]cloudhub.Policy, error) {
+	return s.AllF(ctx)
+}
+
+// Add ...
+func (s *PoliciesStore) Add(ctx context.Context, t cloudhub.Policy) (cloudhub.Policy, error) {
+	return s.AddF(ctx, t)
+}
+
+// Delete ...
+func (s *PoliciesStore) Delete(ctx context.Context, t cloudhub.Policy) error {
+	return s.DeleteF(ctx, t)
+}
+
+// Get ...
+func (s *PoliciesStore) Get(ctx context.Context, id string) (cloudhub.Policy, error) {
+	return s.GetF(ctx, id)
+}
+
+// Update ...
+func (s *PoliciesStore) Update(ctx context.Context, t cloudhub.Policy) error {
+	return s.UpdateF(ctx, t)
+}
@@ -0,0 +1,43 @@
+package mocks
+
+import (
+	"context"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+var _ cloudhub.SessionsStore = &SessionsStore{}
+
+// SessionsStore mock allows all functions to be set for testing
+type SessionsStore struct {
+	AllF    func(context.Context) ([]cloudhub.Session, error)
+	AddF    func(context.Context, cloudhub.Session) (cloudhub.Session, error)
+	DeleteF func(context.Context, cloudhub.Session) error
+	GetF    func(context.Context, string) (cloudhub.Session, error)
+	UpdateF func(context.Context, cloudhub.Session) error
+}
+
+// All ...
+func (s *SessionsStore) All(ctx context.Context) ([]cloudhub.Session, error) {
+	return s.AllF(ctx)
+}
+
+// Add ...
+func (s *SessionsStore) Add(ctx context.Context, t cloudhub.Session) (cloudhub.Session, error) {
+	return s.AddF(ctx, t)
+}
+
+// Delete ...
+func (s *SessionsStore) Delete(ctx context.Context, t cloudhub.Session) error {
+	return s.DeleteF(ctx, t)
+}
+
+// Get ...
+func (s *SessionsStore) Get(ctx context.Context, id string) (cloudhub.Session, error) {
+	return s.GetF(ctx, id)
+}
+
+// Update ...
+func (s *SessionsStore) Update(ctx context.Context, t cloudhub.Session) error {
+	return s.UpdateF(ctx, t)
+}
@@ -19,6 +19,11 @@ type Store struct {
 	ConfigStore             cloudhub.ConfigStore
 	OrganizationConfigStore cloudhub.OrganizationConfigStore
 	VspheresStore           cloudhub.VspheresStore
+	AlertTemplatesStore     cloudhub.AlertTemplatesStore
+	APITokensStore          cloudhub.APITokensStore
+	PoliciesStore           cloudhub.PoliciesStore
+	GroupsStore             cloudhub.GroupsStore
+	SessionsStore           cloudhub.SessionsStore
 }
 
 // Sources ...
@@ -74,4 +79,29 @@ func (s *Store) OrganizationConfig(ctx context.Context) cloudhub.OrganizationCon
 // Vspheres ...
 func (s *Store) Vspheres(ctx context.Context) cloudhub.VspheresStore {
 	return s.VspheresStore
-}
\ No newline at end of file
+}
+
+// AlertTemplates ...
+func (s *Store) AlertTemplates(ctx context.Context) cloudhub.AlertTemplatesStore {
+	return s.AlertTemplatesStore
+}
+
+// APITokens ...
+func (s *Store) APITokens(ctx context.Context) cloudhub.APITokensStore {
+	return s.APITokensStore
+}
+
+// Policies ...
+func (s *Store) Policies(ctx context.Context) cloudhub.PoliciesStore {
+	return s.PoliciesStore
+}
+
+// Groups ...
+func (s *Store) Groups(ctx context.Context) cloudhub.GroupsStore {
+	return s.GroupsStore
+}
+
+// Sessions ...
+func (s *Store) Sessions(ctx context.Context) cloudhub.SessionsStore {
+	return s.SessionsStore
+}
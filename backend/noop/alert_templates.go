@@ -0,0 +1,39 @@
+package noop
+
+import (
+	"context"
+	"fmt"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// ensure AlertTemplatesStore implements cloudhub.AlertTemplatesStore
+var _ cloudhub.AlertTemplatesStore = &AlertTemplatesStore{}
+
+// AlertTemplatesStore ...
+type AlertTemplatesStore struct{}
+
+// All ...
+func (s *AlertTemplatesStore) All(context.Context) ([]cloudhub.AlertTemplate, error) {
+	return nil, fmt.Errorf("no alert templates found")
+}
+
+// Add ...
+func (s *AlertTemplatesStore) Add(context.Context, cloudhub.AlertTemplate) (cloudhub.AlertTemplate, error) {
+	return cloudhub.AlertTemplate{}, fmt.Errorf("failed to add alert template")
+}
+
+// Delete ...
+func (s *AlertTemplatesStore) Delete(context.Context, cloudhub.AlertTemplate) error {
+	return fmt.Errorf("failed to delete alert template")
+}
+
+// Get ...
+func (s *AlertTemplatesStore) Get(context.Context, string) (cloudhub.AlertTemplate, error) {
+	return cloudhub.AlertTemplate{}, cloudhub.ErrAlertTemplateNotFound
+}
+
+// Update ...
+func (s *AlertTemplatesStore) Update(context.Context, cloudhub.AlertTemplate) error {
+	return fmt.Errorf("failed to update alert template")
+}
@@ -0,0 +1,34 @@
+package noop
+
+import (
+	"context"
+	"fmt"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// ensure APITokensStore implements cloudhub.APITokensStore
+var _ cloudhub.APITokensStore = &APITokensStore{}
+
+// APITokensStore ...
+type APITokensStore struct{}
+
+// All ...
+func (s *APITokensStore) All(context.Context) ([]cloudhub.APIToken, error) {
+	return nil, fmt.Errorf("no API tokens found")
+}
+
+// Add ...
+func (s *APITokensStore) Add(context.Context, cloudhub.APIToken) (cloudhub.APIToken, error) {
+	return cloudhub.APIToken{}, fmt.Errorf("failed to add API token")
+}
+
+// Delete ...
+func (s *APITokensStore) Delete(context.Context, cloudhub.APIToken) error {
+	return fmt.Errorf("failed to delete API token")
+}
+
+// Get ...
+func (s *APITokensStore) Get(context.Context, string) (cloudhub.APIToken, error) {
+	return cloudhub.APIToken{}, cloudhub.ErrAPITokenNotFound
+}
@@ -0,0 +1,39 @@
+package noop
+
+import (
+	"context"
+	"fmt"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// ensure GroupsStore implements cloudhub.GroupsStore
+var _ cloudhub.GroupsStore = &GroupsStore{}
+
+// GroupsStore ...
+type GroupsStore struct{}
+
+// All ...
+func (s *GroupsStore) All(context.Context) ([]cloudhub.Group, error) {
+	return nil, fmt.Errorf("no groups found")
+}
+
+// Add ...
+func (s *GroupsStore) Add(context.Context, cloudhub.Group) (cloudhub.Group, error) {
+	return cloudhub.Group{}, fmt.Errorf("failed to add group")
+}
+
+// Delete ...
+func (s *GroupsStore) Delete(context.Context, cloudhub.Group) error {
+	return fmt.Errorf("failed to delete group")
+}
+
+// Get ...
+func (s *GroupsStore) Get(context.Context, string) (cloudhub.Group, error) {
+	return cloudhub.Group{}, cloudhub.ErrGroupNotFound
+}
+
+// Update ...
+func (s *GroupsStore) Update(context.Context, cloudhub.Group) error {
+	return fmt.Errorf("failed to update group")
+}
@@ -0,0 +1,39 @@
+package noop
+
+import (
+	"context"
+	"fmt"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// ensure PoliciesStore implements cloudhub.PoliciesStore
+var _ cloudhub.PoliciesStore = &PoliciesStore{}
+
+// PoliciesStore ...
+type PoliciesStore struct{}
+
+// All ...
+func (s *PoliciesStore) All(context.Context) ([]cloudhub.Policy, error) {
+	return nil, fmt.Errorf("no policies found")
+}
+
+// Add ...
+func (s *PoliciesStore) Add(context.Context, cloudhub.Policy) (cloudhub.Policy, error) {
+	return cloudhub.Policy{}, fmt.Errorf("failed to add policy")
+}
+
+// Delete ...
+func (s *PoliciesStore) Delete(context.Context, cloudhub.Policy) error {
+	return fmt.Errorf("failed to delete policy")
+}
+
+// Get ...
+func (s *PoliciesStore) Get(context.Context, string) (cloudhub.Policy, error) {
+	return cloudhub.Policy{}, cloudhub.ErrPolicyNotFound
+}
+
+// Update ...
+func (s *PoliciesStore) Update(context.Context, cloudhub.Policy) error {
+	return fmt.Errorf("failed to update policy")
+}
@@ -0,0 +1,39 @@
+package noop
+
+import (
+	"context"
+	"fmt"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// ensure SessionsStore implements cloudhub.SessionsStore
+var _ cloudhub.SessionsStore = &SessionsStore{}
+
+// SessionsStore ...
+type SessionsStore struct{}
+
+// All ...
+func (s *SessionsStore) All(context.Context) ([]cloudhub.Session, error) {
+	return nil, fmt.Errorf("no sessions found")
+}
+
+// Add ...
+func (s *SessionsStore) Add(context.Context, cloudhub.Session) (cloudhub.Session, error) {
+	return cloudhub.Session{}, fmt.Errorf("failed to add session")
+}
+
+// Delete ...
+func (s *SessionsStore) Delete(context.Context, cloudhub.Session) error {
+	return fmt.Errorf("failed to delete session")
+}
+
+// Get ...
+func (s *SessionsStore) Get(context.Context, string) (cloudhub.Session, error) {
+	return cloudhub.Session{}, cloudhub.ErrSessionNotFound
+}
+
+// Update ...
+func (s *SessionsStore) Update(context.Context, cloudhub.Session) error {
+	return fmt.Errorf("failed to update session")
+}
@@ -0,0 +1,168 @@
+package oauth2
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// Check to ensure CredentialsMux is an oauth2.Mux
+var _ Mux = &CredentialsMux{}
+
+// CredentialsProvider is a Provider authenticating the username and password
+// posted from the login form of a CredentialsMux, rather than redirecting to
+// an OAuth2 authorization server.
+type CredentialsProvider interface {
+	Provider
+	// Authenticate returns the Principal of a username and its password;
+	// ErrAuthentication means the credentials are wrong.
+	Authenticate(ctx context.Context, username, password string) (Principal, error)
+}
+
+// NewCredentialsMux constructs a Mux serving the login form of a
+// CredentialsProvider at /oauth/<name>/login, which posts to
+// /oauth/<name>/callback
+func NewCredentialsMux(p CredentialsProvider, a Authenticator, t Tokenizer, basepath string, l cloudhub.Logger) *CredentialsMux {
+	name := url.PathEscape(strings.ToLower(p.Name()))
+	return &CredentialsMux{
+		Provider:     p,
+		Auth:         a,
+		Tokens:       t,
+		LoginURL:     path.Join(basepath, "/oauth", name, "login"),
+		CallbackURL:  path.Join(basepath, "/oauth", name, "callback"),
+		SuccessURL:   path.Join(basepath, "/"),
+		TwoFactorURL: path.Join(basepath, "/oauth/2fa"),
+		Now:          DefaultNowTime,
+		Logger:       l,
+	}
+}
+
+// CredentialsMux services the login form of a CredentialsProvider and
+// stores the resultant token in the user's browser as a cookie, like
+// AuthMux.
+type CredentialsMux struct {
+	Provider     CredentialsProvider // Provider authenticates the posted credentials
+	Auth         Authenticator       // Auth is used to Authorize after successful authentication and Expire on Logout
+	Tokens       Tokenizer           // Tokens is used to create and validate the CSRF "state" of the form
+	Logger       cloudhub.Logger
+	LoginURL     string           // LoginURL serves the form; failures redirect to it
+	CallbackURL  string           // CallbackURL is where the form is posted
+	SuccessURL   string           // SuccessURL is redirect location after successful authorization
+	TwoFactorURL string           // TwoFactorURL is redirect location when the second factor of the principal is pending
+	Now          func() time.Time // Now returns the current time (for testing)
+}
+
+var loginForm = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>CloudHub - Sign in with {{.Name}}</title>
+</head>
+<body>
+<form method="post" action="{{.CallbackURL}}">
+<h2>Sign in with {{.Name}}</h2>
+{{if .Failed}}<p role="alert">Invalid username or password</p>{{end}}
+<input type="hidden" name="state" value="{{.State}}">
+<p><label>Username <input name="username" autocomplete="username" autofocus required></label></p>
+<p><label>Password <input name="password" type="password" autocomplete="current-password" required></label></p>
+<p><button type="submit">Sign in</button></p>
+</form>
+</body>
+</html>
+`))
+
+// Login returns a handler serving the login form. The form carries a state
+// token valid for ten minutes to prevent CSRF, like the state of AuthMux.
+func (j *CredentialsMux) Login() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := j.Now()
+		p := Principal{
+			Subject:   randomString(32),
+			IssuedAt:  now,
+			ExpiresAt: now.Add(TenMinutes),
+		}
+		token, err := j.Tokens.Create(r.Context(), p)
+		if err != nil {
+			j.Logger.
+				WithField("component", "auth").
+				WithField("remote_addr", r.RemoteAddr).
+				WithField("method", r.Method).
+				WithField("url", r.URL).
+				Error("Internal authentication error: ", err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-Frame-Options", "DENY")
+		_ = loginForm.Execute(w, struct {
+			Name        string
+			CallbackURL string
+			State       string
+			Failed      bool
+		}{
+			Name:        strings.ToUpper(j.Provider.Name()),
+			CallbackURL: j.CallbackURL,
+			State:       string(token),
+			Failed:      r.URL.Query().Get("failed") != "",
+		})
+	})
+}
+
+// Callback authenticates the credentials posted by the login form. If
+// authenticated, Callback sets the cookie of the principal and redirects to
+// SuccessURL; otherwise it redirects back to the form.
+func (j *CredentialsMux) Callback() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := j.Logger.
+			WithField("component", "auth").
+			WithField("remote_addr", r.RemoteAddr).
+			WithField("method", r.Method).
+			WithField("url", r.URL)
+
+		// Credentials are only read from the body, never from the URL
+		state := r.PostFormValue("state")
+		if _, err := j.Tokens.ValidPrincipal(r.Context(), Token(state), TenMinutes); err != nil {
+			log.Error("Invalid login form state received: ", err.Error())
+			http.Redirect(w, r, j.LoginURL, http.StatusSeeOther)
+			return
+		}
+
+		username := r.PostFormValue("username")
+		p, err := j.Provider.Authenticate(r.Context(), username, r.PostFormValue("password"))
+		if err != nil {
+			log.Error("Unable to authenticate ", username, ": ", err.Error())
+			http.Redirect(w, r, j.LoginURL+"?failed=true", http.StatusSeeOther)
+			return
+		}
+
+		err = j.Auth.Authorize(r.Context(), w, p)
+		if err == ErrSecondFactorPending {
+			log.Info("User ", p.Subject, " is authenticated pending the second factor")
+			http.Redirect(w, r, j.TwoFactorURL, http.StatusSeeOther)
+			return
+		}
+		if err != nil {
+			log.Error("Unable to get add session to response ", err.Error())
+			http.Redirect(w, r, j.LoginURL+"?failed=true", http.StatusSeeOther)
+			return
+		}
+		log.Info("User ", p.Subject, " is authenticated")
+		http.Redirect(w, r, j.SuccessURL, http.StatusSeeOther)
+	})
+}
+
+// Logout handler will expire our authentication cookie and redirect to the successURL
+func (j *CredentialsMux) Logout() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		j.Auth.Expire(w)
+		http.Redirect(w, r, j.SuccessURL, http.StatusTemporaryRedirect)
+	})
+}
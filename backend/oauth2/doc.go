@@ -138,4 +138,15 @@
 //   /oauth/{provider}/logout
 //
 // Simply expires the session cookie and redirects to `/`.
+//
+// A CredentialsProvider, such as LDAP or Local, authenticates a username and
+// password instead of redirecting to an authorization server. Its
+// CredentialsMux serves a login form at `/oauth/{provider}/login`, which posts to
+// `/oauth/{provider}/callback`; the callback issues the same cookie.
+//
+// SAML authenticates users of a SAML 2.0 identity provider. Its SAMLMux
+// redirects `/oauth/saml/login` to the identity provider, which posts the
+// signed response to `/oauth/saml/callback`; the callback issues the same
+// cookie. The metadata registering CloudHub at the identity provider is
+// served at `/oauth/saml/metadata`.
 package oauth2
@@ -37,6 +37,8 @@ type Generic struct {
 	TokenURL       string
 	APIURL         string // APIURL returns OpenID Userinfo
 	APIKey         string // APIKey is the JSON key to lookup email address in APIURL response
+	GroupsClaim    string // GroupsClaim is the dot separated path of the claim listing the groups of the user
+	RolesClaim     string // RolesClaim is the dot separated path of the claim listing the roles of the user
 	Logger         cloudhub.Logger
 }
 
@@ -135,6 +137,10 @@ func (g *Generic) Group(provider *http.Client) (string, error) {
 		return "", err
 	}
 
+	if groups, ok := g.claimGroups(res); ok {
+		return groups, nil
+	}
+
 	email := ""
 	value := res[g.APIKey]
 	if e, ok := value.(string); ok {
@@ -215,8 +221,13 @@ func (g *Generic) PrincipalIDFromClaims(claims gojwt.MapClaims) (string, error)
 	return "", fmt.Errorf("no claim for %s", g.APIKey)
 }
 
-// GroupFromClaims verifies an optional id_token, extracts the email address of the user and splits off the domain part
+// GroupFromClaims verifies an optional id_token and extracts the groups of the user.
+// Without GroupsClaim and RolesClaim, it extracts the email address of the user and splits off the domain part
 func (g *Generic) GroupFromClaims(claims gojwt.MapClaims) (string, error) {
+	if groups, ok := g.claimGroups(claims); ok {
+		return groups, nil
+	}
+
 	if id, ok := claims[g.APIKey].(string); ok {
 		email := strings.Split(id, "@")
 		if len(email) != 2 {
@@ -229,3 +240,57 @@ func (g *Generic) GroupFromClaims(claims gojwt.MapClaims) (string, error) {
 
 	return "", fmt.Errorf("no claim for %s", g.APIKey)
 }
+
+// claimGroups returns the comma separated values of the claims at GroupsClaim
+// and RolesClaim, and whether any of them is configured
+func (g *Generic) claimGroups(claims map[string]interface{}) (string, bool) {
+	if g.GroupsClaim == "" && g.RolesClaim == "" {
+		return "", false
+	}
+
+	groups := []string{}
+	seen := map[string]bool{}
+	for _, path := range []string{g.GroupsClaim, g.RolesClaim} {
+		if path == "" {
+			continue
+		}
+		for _, group := range claimValues(claims, path) {
+			// groups are joined with commas like the groups of LDAP users
+			if group == "" || strings.Contains(group, ",") || seen[group] {
+				continue
+			}
+			seen[group] = true
+			groups = append(groups, group)
+		}
+	}
+	return strings.Join(groups, ","), true
+}
+
+// claimValues returns the strings of the claim at a dot separated path,
+// such as realm_access.roles, which is either a string or a list of strings
+func claimValues(claims map[string]interface{}, path string) []string {
+	var value interface{} = claims
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := []string{}
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	case []string:
+		return v
+	}
+	return nil
+}
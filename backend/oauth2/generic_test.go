@@ -6,6 +6,7 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	gojwt "github.com/dgrijalva/jwt-go"
 	clog "github.com/snetsystems/cloudhub/backend/log"
 	"github.com/snetsystems/cloudhub/backend/oauth2"
 )
@@ -198,3 +199,66 @@ func TestGenericPrincipalIDDomain(t *testing.T) {
 		t.Fatal("Retrieved email was not as expected. Want:", want, "Got:", got)
 	}
 }
+
+func TestGenericGroupFromClaims(t *testing.T) {
+	t.Parallel()
+
+	claims := gojwt.MapClaims{
+		"email":  "martymcfly@pinheads.rok",
+		"groups": []interface{}{"sre", "developers"},
+		"realm_access": map[string]interface{}{
+			"roles": []interface{}{"admins", "sre"},
+		},
+		"department": "time-travel",
+	}
+
+	tests := []struct {
+		name        string
+		groupsClaim string
+		rolesClaim  string
+		want        string
+	}{
+		{
+			name: "Domain of the email without claim paths",
+			want: "pinheads.rok",
+		},
+		{
+			name:        "Groups claim",
+			groupsClaim: "groups",
+			want:        "sre,developers",
+		},
+		{
+			name:        "Groups and nested roles claims",
+			groupsClaim: "groups",
+			rolesClaim:  "realm_access.roles",
+			want:        "sre,developers,admins",
+		},
+		{
+			name:        "Single value claim",
+			groupsClaim: "department",
+			want:        "time-travel",
+		},
+		{
+			name:       "Missing claim",
+			rolesClaim: "resource_access.cloudhub.roles",
+			want:       "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prov := oauth2.Generic{
+				Logger:      clog.New(clog.ParseLevel("debug")),
+				APIKey:      "email",
+				GroupsClaim: tt.groupsClaim,
+				RolesClaim:  tt.rolesClaim,
+			}
+			got, err := prov.GroupFromClaims(claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("GroupFromClaims() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
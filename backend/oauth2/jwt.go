@@ -182,6 +182,7 @@ func (j *JWT) ValidClaims(jwtToken Token, lifespan time.Duration, alg gojwt.Keyf
 		Group:        claims.Group,
 		ExpiresAt:    exp,
 		IssuedAt:     iat,
+		SessionID:    claims.Id,
 	}, nil
 }
 
@@ -218,6 +219,7 @@ func (j *JWT) Create(ctx context.Context, user Principal) (Token, error) {
 			ExpiresAt: user.ExpiresAt.Unix(),
 			IssuedAt:  user.IssuedAt.Unix(),
 			NotBefore: user.IssuedAt.Unix(),
+			Id:        user.SessionID,
 		},
 		Organization: user.Organization,
 		Group:        user.Group,
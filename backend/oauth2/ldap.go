@@ -0,0 +1,87 @@
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/ldap"
+	"golang.org/x/oauth2"
+)
+
+// Ensure that LDAP is an oauth2.CredentialsProvider
+var _ CredentialsProvider = &LDAP{}
+
+var errPasswordProvider = errors.New("principals of the provider authenticate with a password")
+
+// LDAPDirectory authenticates the users of an LDAP directory
+type LDAPDirectory interface {
+	Authenticate(ctx context.Context, username, password string) (*ldap.User, error)
+}
+
+// LDAP is a CredentialsProvider allowing users of an LDAP directory, such as
+// Active Directory, to authenticate with their password. The groups of a
+// user are the Group of its Principal, which mappings of the ldap provider
+// match to organizations.
+type LDAP struct {
+	Directory LDAPDirectory
+	Logger    cloudhub.Logger
+}
+
+// Name returns the name of this provider (ldap)
+func (l *LDAP) Name() string {
+	return "ldap"
+}
+
+// ID is empty; LDAP has no OAuth2 client
+func (l *LDAP) ID() string {
+	return ""
+}
+
+// Secret is empty; LDAP has no OAuth2 client
+func (l *LDAP) Secret() string {
+	return ""
+}
+
+// Scopes are empty; LDAP has no OAuth2 client
+func (l *LDAP) Scopes() []string {
+	return []string{}
+}
+
+// Config is empty; LDAP has no OAuth2 client
+func (l *LDAP) Config() *oauth2.Config {
+	return &oauth2.Config{}
+}
+
+// PrincipalID is not supported; principals are returned by Authenticate
+func (l *LDAP) PrincipalID(provider *http.Client) (string, error) {
+	return "", errPasswordProvider
+}
+
+// Group is not supported; groups are returned by Authenticate
+func (l *LDAP) Group(provider *http.Client) (string, error) {
+	return "", errPasswordProvider
+}
+
+// Authenticate binds to the directory as the user, and returns a principal
+// of its name and comma separated groups
+func (l *LDAP) Authenticate(ctx context.Context, username, password string) (Principal, error) {
+	user, err := l.Directory.Authenticate(ctx, username, password)
+	if err == ldap.ErrInvalidCredentials {
+		return Principal{}, ErrAuthentication
+	} else if err != nil {
+		l.Logger.
+			WithField("component", "auth").
+			WithField("provider", l.Name()).
+			Error("Unable to authenticate with LDAP: ", err.Error())
+		return Principal{}, err
+	}
+
+	return Principal{
+		Subject: user.Name,
+		Issuer:  l.Name(),
+		Group:   strings.Join(user.Groups, ","),
+	}, nil
+}
@@ -0,0 +1,128 @@
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/snetsystems/cloudhub/backend/ldap"
+	clog "github.com/snetsystems/cloudhub/backend/log"
+)
+
+type mockDirectory map[string]string
+
+func (d mockDirectory) Authenticate(ctx context.Context, username, password string) (*ldap.User, error) {
+	if username == "down" {
+		return nil, errors.New("connection refused")
+	}
+	if want, ok := d[username]; !ok || want != password {
+		return nil, ldap.ErrInvalidCredentials
+	}
+	return &ldap.User{
+		DN:     "uid=" + username + ",dc=example,dc=com",
+		Name:   username + "@example.com",
+		Groups: []string{"admins", "developers"},
+	}, nil
+}
+
+func TestLDAP_Authenticate(t *testing.T) {
+	provider := &LDAP{
+		Directory: mockDirectory{"jdoe": "secret"},
+		Logger:    clog.New(clog.DebugLevel),
+	}
+
+	p, err := provider.Authenticate(context.Background(), "jdoe", "secret")
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	want := Principal{Subject: "jdoe@example.com", Issuer: "ldap", Group: "admins,developers"}
+	if p != want {
+		t.Errorf("Authenticate() = %+v, want %+v", p, want)
+	}
+
+	if _, err := provider.Authenticate(context.Background(), "jdoe", "wrong"); err != ErrAuthentication {
+		t.Errorf("Authenticate() error = %v, want %v", err, ErrAuthentication)
+	}
+	if _, err := provider.Authenticate(context.Background(), "down", "secret"); err == nil || err == ErrAuthentication {
+		t.Errorf("Authenticate() error = %v, want the error of the directory", err)
+	}
+}
+
+func TestCredentialsMux(t *testing.T) {
+	provider := &LDAP{
+		Directory: mockDirectory{"jdoe": "secret"},
+		Logger:    clog.New(clog.DebugLevel),
+	}
+	jwt := NewJWT("secret", "")
+	mux := NewCredentialsMux(provider, NewCookieJWT("secret", time.Hour), jwt, "/cloudhub", clog.New(clog.DebugLevel))
+
+	// The form posts its state token to the callback
+	w := httptest.NewRecorder()
+	mux.Login().ServeHTTP(w, httptest.NewRequest("GET", "/cloudhub/oauth/ldap/login", nil))
+	body, _ := ioutil.ReadAll(w.Result().Body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Login() status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if !strings.Contains(string(body), `action="/cloudhub/oauth/ldap/callback"`) {
+		t.Errorf("Login() form does not post to the callback:\n%s", body)
+	}
+	m := regexp.MustCompile(`name="state" value="([^"]+)"`).FindSubmatch(body)
+	if m == nil {
+		t.Fatalf("Login() form has no state:\n%s", body)
+	}
+	state := string(m[1])
+
+	tests := []struct {
+		name       string
+		form       url.Values
+		location   string
+		wantCookie bool
+	}{
+		{
+			name:       "Valid credentials",
+			form:       url.Values{"state": {state}, "username": {"jdoe"}, "password": {"secret"}},
+			location:   "/cloudhub",
+			wantCookie: true,
+		},
+		{
+			name:     "Wrong password",
+			form:     url.Values{"state": {state}, "username": {"jdoe"}, "password": {"wrong"}},
+			location: "/cloudhub/oauth/ldap/login?failed=true",
+		},
+		{
+			name:     "Invalid state",
+			form:     url.Values{"state": {"forged"}, "username": {"jdoe"}, "password": {"secret"}},
+			location: "/cloudhub/oauth/ldap/login",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "/cloudhub/oauth/ldap/callback", strings.NewReader(tt.form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			mux.Callback().ServeHTTP(w, r)
+
+			resp := w.Result()
+			if resp.StatusCode != http.StatusSeeOther {
+				t.Errorf("Callback() status = %d, want %d", resp.StatusCode, http.StatusSeeOther)
+			}
+			if loc := resp.Header.Get("Location"); loc != tt.location {
+				t.Errorf("Callback() location = %q, want %q", loc, tt.location)
+			}
+			cookie := false
+			for _, c := range resp.Cookies() {
+				cookie = cookie || (c.Name == DefaultCookieName && c.Value != "")
+			}
+			if cookie != tt.wantCookie {
+				t.Errorf("Callback() session cookie = %v, want %v", cookie, tt.wantCookie)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+	"unicode"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/oauth2"
+)
+
+// Ensure that Local is an oauth2.CredentialsProvider
+var _ CredentialsProvider = &Local{}
+
+// LocalProvider is the provider of local users, whose bcrypt password
+// hashes are stored on their cloudhub.User
+const LocalProvider = "local"
+
+// Defaults of the lockout of local users after failed logins
+const (
+	DefaultMaxLoginAttempts = 5
+	DefaultLockoutDuration  = 15 * time.Minute
+)
+
+// dummyHash is compared when a user does not exist, so that unknown users
+// take as long to reject as wrong passwords
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("cloudhub"), bcrypt.DefaultCost)
+
+// PasswordPolicy are the requirements of the passwords of local users
+type PasswordPolicy struct {
+	MinLength        int
+	RequireMixedCase bool // RequireMixedCase requires upper and lower case letters
+	RequireDigit     bool
+	RequireSymbol    bool
+}
+
+// Validate returns an error describing the requirements a password fails
+func (p PasswordPolicy) Validate(password string) error {
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			symbol = true
+		}
+	}
+
+	switch {
+	case len([]rune(password)) < p.MinLength:
+		return fmt.Errorf("password must be at least %d characters", p.MinLength)
+	case len(password) > 72:
+		// bcrypt ignores the bytes after the 72nd
+		return errors.New("password must be at most 72 bytes")
+	case p.RequireMixedCase && !(upper && lower):
+		return errors.New("password must contain upper and lower case letters")
+	case p.RequireDigit && !digit:
+		return errors.New("password must contain a digit")
+	case p.RequireSymbol && !symbol:
+		return errors.New("password must contain a symbol")
+	}
+	return nil
+}
+
+// SetPassword validates a password against the policy and stores its hash
+// on a local user, which unlocks the user
+func (p PasswordPolicy) SetPassword(u *cloudhub.User, password string) error {
+	if err := p.Validate(password); err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	u.PasswordHash = string(hash)
+	u.FailedLogins = 0
+	u.LockedUntil = time.Time{}
+	return nil
+}
+
+// CheckPassword reports whether a password matches the hash of a user
+func CheckPassword(u *cloudhub.User, password string) bool {
+	return u.PasswordHash != "" && bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
+}
+
+// Local is a CredentialsProvider of the users of CloudHub itself, which
+// authenticate with the password hashed on their cloudhub.User. After
+// MaxAttempts consecutive failed logins, a user is locked out for
+// LockoutDuration.
+type Local struct {
+	Users           cloudhub.UsersStore
+	MaxAttempts     int
+	LockoutDuration time.Duration
+	Logger          cloudhub.Logger
+	Now             func() time.Time
+
+	mu sync.Mutex // mu serializes the updates of the failed logins
+}
+
+// Name returns the name of this provider (local)
+func (l *Local) Name() string {
+	return LocalProvider
+}
+
+// ID is empty; Local has no OAuth2 client
+func (l *Local) ID() string {
+	return ""
+}
+
+// Secret is empty; Local has no OAuth2 client
+func (l *Local) Secret() string {
+	return ""
+}
+
+// Scopes are empty; Local has no OAuth2 client
+func (l *Local) Scopes() []string {
+	return []string{}
+}
+
+// Config is empty; Local has no OAuth2 client
+func (l *Local) Config() *oauth2.Config {
+	return &oauth2.Config{}
+}
+
+// PrincipalID is not supported; principals are returned by Authenticate
+func (l *Local) PrincipalID(provider *http.Client) (string, error) {
+	return "", errPasswordProvider
+}
+
+// Group is not supported; local users have no groups
+func (l *Local) Group(provider *http.Client) (string, error) {
+	return "", errPasswordProvider
+}
+
+// Authenticate checks the password of a local user, counting failed logins
+// toward its lockout
+func (l *Local) Authenticate(ctx context.Context, username, password string) (Principal, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	provider, scheme := LocalProvider, "oauth2"
+	u, err := l.Users.Get(ctx, cloudhub.UserQuery{
+		Name:     &username,
+		Provider: &provider,
+		Scheme:   &scheme,
+	})
+	if err == cloudhub.ErrUserNotFound {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return Principal{}, ErrAuthentication
+	} else if err != nil {
+		return Principal{}, err
+	}
+
+	if err := l.verify(ctx, u, password); err != nil {
+		return Principal{}, err
+	}
+
+	return Principal{
+		Subject: u.Name,
+		Issuer:  l.Name(),
+	}, nil
+}
+
+// Verify checks the password of a local user, such as the current password
+// of a password change, counting failures toward its lockout like logins
+func (l *Local) Verify(ctx context.Context, u *cloudhub.User, password string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.verify(ctx, u, password)
+}
+
+// verify checks the password of a local user; callers hold mu
+func (l *Local) verify(ctx context.Context, u *cloudhub.User, password string) error {
+	now := l.now()
+	if now.Before(u.LockedUntil) {
+		l.Logger.
+			WithField("component", "auth").
+			WithField("provider", l.Name()).
+			Info("Locked out user ", u.Name, " attempted to log in")
+		return ErrAuthentication
+	}
+
+	if !CheckPassword(u, password) {
+		u.FailedLogins++
+		if l.MaxAttempts > 0 && u.FailedLogins >= l.MaxAttempts {
+			u.FailedLogins = 0
+			u.LockedUntil = now.Add(l.LockoutDuration)
+			l.Logger.
+				WithField("component", "auth").
+				WithField("provider", l.Name()).
+				Info("User ", u.Name, " is locked out until ", u.LockedUntil.Format(time.RFC3339))
+		}
+		if err := l.Users.Update(ctx, u); err != nil {
+			return err
+		}
+		return ErrAuthentication
+	}
+
+	if u.FailedLogins != 0 || !u.LockedUntil.IsZero() {
+		u.FailedLogins = 0
+		u.LockedUntil = time.Time{}
+		if err := l.Users.Update(ctx, u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *Local) now() time.Time {
+	if l.Now != nil {
+		return l.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,126 @@
+package oauth2
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	clog "github.com/snetsystems/cloudhub/backend/log"
+)
+
+// localUsers is a UsersStore of users by name
+type localUsers map[string]*cloudhub.User
+
+func (s localUsers) All(ctx context.Context) ([]cloudhub.User, error) {
+	users := []cloudhub.User{}
+	for _, u := range s {
+		users = append(users, *u)
+	}
+	return users, nil
+}
+
+func (s localUsers) Add(ctx context.Context, u *cloudhub.User) (*cloudhub.User, error) {
+	s[u.Name] = u
+	return u, nil
+}
+
+func (s localUsers) Delete(ctx context.Context, u *cloudhub.User) error {
+	delete(s, u.Name)
+	return nil
+}
+
+func (s localUsers) Get(ctx context.Context, q cloudhub.UserQuery) (*cloudhub.User, error) {
+	u, ok := s[*q.Name]
+	if !ok || u.Provider != *q.Provider || u.Scheme != *q.Scheme {
+		return nil, cloudhub.ErrUserNotFound
+	}
+	cp := *u
+	return &cp, nil
+}
+
+func (s localUsers) Update(ctx context.Context, u *cloudhub.User) error {
+	cp := *u
+	s[u.Name] = &cp
+	return nil
+}
+
+func (s localUsers) Num(ctx context.Context) (int, error) {
+	return len(s), nil
+}
+
+func TestPasswordPolicy_Validate(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 8, RequireMixedCase: true, RequireDigit: true, RequireSymbol: true}
+	tests := []struct {
+		password string
+		wantErr  bool
+	}{
+		{password: "Secr3t!pass"},
+		{password: "S3t!a", wantErr: true},
+		{password: "secr3t!pass", wantErr: true},
+		{password: "Secret!pass", wantErr: true},
+		{password: "Secr3tpass", wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := policy.Validate(tt.password); (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%q) error = %v, wantErr %v", tt.password, err, tt.wantErr)
+		}
+	}
+
+	if err := (PasswordPolicy{}).Validate(string(make([]byte, 73))); err == nil {
+		t.Error("Validate() expected an error for a password longer than bcrypt supports")
+	}
+}
+
+func TestLocal_Authenticate(t *testing.T) {
+	now := time.Date(2020, time.March, 1, 12, 0, 0, 0, time.UTC)
+	admin := &cloudhub.User{Name: "admin", Provider: LocalProvider, Scheme: "oauth2"}
+	if err := (PasswordPolicy{MinLength: 8}).SetPassword(admin, "password"); err != nil {
+		t.Fatal(err)
+	}
+	users := localUsers{
+		"admin":  admin,
+		"github": &cloudhub.User{Name: "github", Provider: "github", Scheme: "oauth2"},
+	}
+	provider := &Local{
+		Users:           users,
+		MaxAttempts:     3,
+		LockoutDuration: time.Minute,
+		Logger:          clog.New(clog.DebugLevel),
+		Now:             func() time.Time { return now },
+	}
+	ctx := context.Background()
+
+	p, err := provider.Authenticate(ctx, "admin", "password")
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if want := (Principal{Subject: "admin", Issuer: "local"}); p != want {
+		t.Errorf("Authenticate() = %+v, want %+v", p, want)
+	}
+	if _, err := provider.Authenticate(ctx, "github", "password"); err != ErrAuthentication {
+		t.Errorf("Authenticate() of a user of another provider error = %v, want %v", err, ErrAuthentication)
+	}
+
+	// Failed logins lock the user out, even with the right password
+	for i := 0; i < 3; i++ {
+		if _, err := provider.Authenticate(ctx, "admin", "wrong"); err != ErrAuthentication {
+			t.Fatalf("Authenticate() error = %v, want %v", err, ErrAuthentication)
+		}
+	}
+	if !users["admin"].LockedUntil.Equal(now.Add(time.Minute)) {
+		t.Fatalf("LockedUntil = %v, want %v", users["admin"].LockedUntil, now.Add(time.Minute))
+	}
+	if _, err := provider.Authenticate(ctx, "admin", "password"); err != ErrAuthentication {
+		t.Errorf("Authenticate() of a locked out user error = %v, want %v", err, ErrAuthentication)
+	}
+
+	// The lockout expires, and a successful login resets it
+	now = now.Add(time.Minute)
+	if _, err := provider.Authenticate(ctx, "admin", "password"); err != nil {
+		t.Fatalf("Authenticate() after the lockout error = %v", err)
+	}
+	if u := users["admin"]; u.FailedLogins != 0 || !u.LockedUntil.IsZero() {
+		t.Errorf("Authenticate() did not reset the lockout: %+v", u)
+	}
+}
@@ -24,6 +24,7 @@ func NewAuthMux(p Provider, a Authenticator, t Tokenizer, basepath string, l clo
 		Tokens:     t,
 		SuccessURL: path.Join(basepath, "/"),
 		FailureURL: path.Join(basepath, "/login"),
+		TwoFactorURL: path.Join(basepath, "/oauth/2fa"),
 		Now:        DefaultNowTime,
 		Logger:     l,
 		UseIDToken: UseIDToken,
@@ -49,6 +50,7 @@ type AuthMux struct {
 	Logger     cloudhub.Logger       // Logger is used to give some more information about the OAuth2 process
 	SuccessURL string           // SuccessURL is redirect location after successful authorization
 	FailureURL string           // FailureURL is redirect location after authorization failure
+	TwoFactorURL string         // TwoFactorURL is redirect location when the second factor of the principal is pending
 	Now        func() time.Time // Now returns the current time (for testing)
 	UseIDToken bool             // UseIDToken enables OpenID id_token support
 	LoginHint  string            // LoginHint will be included as a parameter during authentication if non-nil
@@ -204,6 +206,11 @@ func (j *AuthMux) Callback() http.Handler {
 			Group:   group,
 		}
 		err = j.Auth.Authorize(r.Context(), w, p)
+		if err == ErrSecondFactorPending {
+			log.Info("User ", id, " is authenticated pending the second factor")
+			http.Redirect(w, r, j.TwoFactorURL, http.StatusTemporaryRedirect)
+			return
+		}
 		if err != nil {
 			log.Error("Unable to get add session to response ", err.Error())
 			http.Redirect(w, r, j.FailureURL, http.StatusTemporaryRedirect)
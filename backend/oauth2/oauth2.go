@@ -37,6 +37,7 @@ type Principal struct {
 	Group        string
 	ExpiresAt    time.Time
 	IssuedAt     time.Time
+	SessionID    string // SessionID is the ID of the session of the principal; tokens carry it in their jti claim
 }
 
 /* Interfaces */
@@ -0,0 +1,43 @@
+package oauth2
+
+import (
+	"context"
+	"net/http"
+)
+
+// Ensure RoleMapping is an Authenticator
+var _ Authenticator = &RoleMapping{}
+
+// RoleMapper updates the roles of the user of a principal from the groups
+// of the principal
+type RoleMapper interface {
+	MapRoles(ctx context.Context, p Principal) error
+}
+
+// NewRoleMapping maps the groups of the principals authorized by a to the
+// roles of their users with m
+func NewRoleMapping(a Authenticator, m RoleMapper) *RoleMapping {
+	return &RoleMapping{
+		Authenticator: a,
+		Mapper:        m,
+	}
+}
+
+// RoleMapping is an Authenticator that updates the roles of the user of a
+// principal from its groups on every login, before its session is issued.
+type RoleMapping struct {
+	Authenticator            // Authenticator authorizes principals once their roles are mapped
+	Mapper        RoleMapper // Mapper updates the roles of the users of principals
+}
+
+// Authorize maps the roles of a principal logging in, then authorizes it.
+// Principals that already have a session, such as ones changing their
+// organization, are not mapped again.
+func (m *RoleMapping) Authorize(ctx context.Context, w http.ResponseWriter, p Principal) error {
+	if p.SessionID == "" {
+		if err := m.Mapper.MapRoles(ctx, p); err != nil {
+			return err
+		}
+	}
+	return m.Authenticator.Authorize(ctx, w, p)
+}
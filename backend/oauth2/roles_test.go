@@ -0,0 +1,65 @@
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// mapperFunc is a RoleMapper of a function
+type mapperFunc func(ctx context.Context, p Principal) error
+
+func (f mapperFunc) MapRoles(ctx context.Context, p Principal) error {
+	return f(ctx, p)
+}
+
+// authorizedPrincipals is an Authenticator recording the principals it authorizes
+type authorizedPrincipals struct {
+	Authenticator
+	principals []Principal
+}
+
+func (a *authorizedPrincipals) Authorize(ctx context.Context, w http.ResponseWriter, p Principal) error {
+	a.principals = append(a.principals, p)
+	return nil
+}
+
+func TestRoleMapping(t *testing.T) {
+	var mapped []Principal
+	var mapErr error
+	auth := &authorizedPrincipals{}
+	m := NewRoleMapping(auth, mapperFunc(func(ctx context.Context, p Principal) error {
+		mapped = append(mapped, p)
+		return mapErr
+	}))
+
+	// A login is mapped before its session is issued
+	login := Principal{Subject: "marty", Issuer: "generic", Group: "sre"}
+	if err := m.Authorize(context.Background(), httptest.NewRecorder(), login); err != nil {
+		t.Fatal(err)
+	}
+	if len(mapped) != 1 || len(auth.principals) != 1 {
+		t.Errorf("Authorize() of a login mapped %d and authorized %d principals, want 1 and 1", len(mapped), len(auth.principals))
+	}
+
+	// Changing the organization of a session is not a login
+	login.SessionID = "1"
+	if err := m.Authorize(context.Background(), httptest.NewRecorder(), login); err != nil {
+		t.Fatal(err)
+	}
+	if len(mapped) != 1 || len(auth.principals) != 2 {
+		t.Errorf("Authorize() of a session mapped %d and authorized %d principals, want 1 and 2", len(mapped), len(auth.principals))
+	}
+
+	// Logins that cannot be mapped are not authorized
+	mapErr = errors.New("store is down")
+	login.SessionID = ""
+	if err := m.Authorize(context.Background(), httptest.NewRecorder(), login); err != mapErr {
+		t.Errorf("Authorize() error = %v, want %v", err, mapErr)
+	}
+	if len(auth.principals) != 2 {
+		t.Errorf("Authorize() authorized a login that failed its mapping")
+	}
+}
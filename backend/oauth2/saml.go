@@ -0,0 +1,245 @@
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/saml"
+	"golang.org/x/oauth2"
+)
+
+// Ensure that SAML is an oauth2.Provider and SAMLMux is an oauth2.MetadataMux
+var (
+	_ Provider    = &SAML{}
+	_ MetadataMux = &SAMLMux{}
+)
+
+var errSAMLProvider = errors.New("principals of the provider are asserted by a SAML identity provider")
+
+// MetadataMux is a Mux publishing the metadata by which it is registered at
+// its identity provider
+type MetadataMux interface {
+	Mux
+	Metadata() http.Handler
+}
+
+// SAML is a Provider of users asserted by a SAML 2.0 identity provider. The
+// email attribute of an assertion is the Subject of its Principal and the
+// values of the groups attribute are its Group, which mappings of the saml
+// provider match to organizations.
+type SAML struct {
+	SP              *saml.ServiceProvider
+	EmailAttribute  string // EmailAttribute is the attribute of the email; empty uses the NameID
+	GroupsAttribute string // GroupsAttribute is the attribute of the groups; empty ignores groups
+	Logger          cloudhub.Logger
+}
+
+// Name returns the name of this provider (saml)
+func (s *SAML) Name() string {
+	return "saml"
+}
+
+// ID is empty; SAML has no OAuth2 client
+func (s *SAML) ID() string {
+	return ""
+}
+
+// Secret is empty; SAML has no OAuth2 client
+func (s *SAML) Secret() string {
+	return ""
+}
+
+// Scopes are empty; SAML has no OAuth2 client
+func (s *SAML) Scopes() []string {
+	return []string{}
+}
+
+// Config is empty; SAML has no OAuth2 client
+func (s *SAML) Config() *oauth2.Config {
+	return &oauth2.Config{}
+}
+
+// PrincipalID is not supported; principals are returned by Principal
+func (s *SAML) PrincipalID(provider *http.Client) (string, error) {
+	return "", errSAMLProvider
+}
+
+// Group is not supported; groups are returned by Principal
+func (s *SAML) Group(provider *http.Client) (string, error) {
+	return "", errSAMLProvider
+}
+
+// Principal verifies a response of the identity provider to the request of
+// an ID, and returns a principal of the email and comma separated groups of
+// its assertion
+func (s *SAML) Principal(ctx context.Context, samlResponse, requestID string) (Principal, error) {
+	a, err := s.SP.ParseResponse(samlResponse, requestID)
+	if err != nil {
+		return Principal{}, err
+	}
+
+	email := a.NameID
+	if s.EmailAttribute != "" {
+		values := a.Attributes[s.EmailAttribute]
+		if len(values) == 0 || values[0] == "" {
+			return Principal{}, errors.New("assertion has no " + s.EmailAttribute + " attribute")
+		}
+		email = values[0]
+	}
+
+	groups := []string{}
+	if s.GroupsAttribute != "" {
+		for _, g := range a.Attributes[s.GroupsAttribute] {
+			if g != "" {
+				groups = append(groups, g)
+			}
+		}
+	}
+
+	return Principal{
+		Subject: email,
+		Issuer:  s.Name(),
+		Group:   strings.Join(groups, ","),
+	}, nil
+}
+
+// NewSAMLMux constructs a Mux of the SAML Web Browser SSO profile. Its
+// callback at /oauth/saml/callback is the assertion consumer service, and
+// its metadata is served at /oauth/saml/metadata.
+func NewSAMLMux(p *SAML, a Authenticator, t Tokenizer, basepath string, l cloudhub.Logger) *SAMLMux {
+	return &SAMLMux{
+		Provider:     p,
+		Auth:         a,
+		Tokens:       t,
+		SuccessURL:   path.Join(basepath, "/"),
+		FailureURL:   path.Join(basepath, "/login"),
+		TwoFactorURL: path.Join(basepath, "/oauth/2fa"),
+		Now:          DefaultNowTime,
+		Logger:       l,
+	}
+}
+
+// SAMLMux services the SAML interaction of a browser with an identity
+// provider, and stores the resultant token in the user's browser as a
+// cookie, like AuthMux.
+type SAMLMux struct {
+	Provider     *SAML         // Provider verifies the responses of the identity provider
+	Auth         Authenticator // Auth is used to Authorize after successful authentication and Expire on Logout
+	Tokens       Tokenizer     // Tokens is used to create and validate the RelayState binding responses to requests
+	Logger       cloudhub.Logger
+	SuccessURL   string           // SuccessURL is redirect location after successful authorization
+	FailureURL   string           // FailureURL is redirect location after authorization failure
+	TwoFactorURL string           // TwoFactorURL is redirect location when the second factor of the principal is pending
+	Now          func() time.Time // Now returns the current time (for testing)
+}
+
+// Login returns a handler redirecting to the identity provider with an
+// authentication request. The RelayState is a token of the request ID valid
+// for ten minutes, so that the callback only accepts the response to a
+// request of this SP, as the state of AuthMux prevents CSRF.
+func (j *SAMLMux) Login() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := j.Logger.
+			WithField("component", "auth").
+			WithField("remote_addr", r.RemoteAddr).
+			WithField("method", r.Method).
+			WithField("url", r.URL)
+
+		id := saml.NewRequestID()
+		now := j.Now()
+		p := Principal{
+			Subject:   id,
+			IssuedAt:  now,
+			ExpiresAt: now.Add(TenMinutes),
+		}
+		token, err := j.Tokens.Create(r.Context(), p)
+		if err != nil {
+			log.Error("Internal authentication error: ", err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		u, err := j.Provider.SP.AuthnRequestURL(id, string(token))
+		if err != nil {
+			log.Error("Unable to create SAML authentication request: ", err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, u, http.StatusTemporaryRedirect)
+	})
+}
+
+// Callback is the assertion consumer service of the HTTP-POST binding. If
+// the response authenticates a user, Callback sets the cookie of the
+// principal and redirects to SuccessURL.
+func (j *SAMLMux) Callback() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := j.Logger.
+			WithField("component", "auth").
+			WithField("remote_addr", r.RemoteAddr).
+			WithField("method", r.Method).
+			WithField("url", r.URL)
+
+		if r.Method != http.MethodPost {
+			log.Error("SAML response must be posted")
+			http.Redirect(w, r, j.FailureURL, http.StatusSeeOther)
+			return
+		}
+
+		state := r.PostFormValue("RelayState")
+		req, err := j.Tokens.ValidPrincipal(r.Context(), Token(state), TenMinutes)
+		if err != nil {
+			log.Error("Invalid SAML RelayState received: ", err.Error())
+			http.Redirect(w, r, j.FailureURL, http.StatusSeeOther)
+			return
+		}
+
+		p, err := j.Provider.Principal(r.Context(), r.PostFormValue("SAMLResponse"), req.Subject)
+		if err != nil {
+			log.Error("Unable to authenticate SAML response: ", err.Error())
+			http.Redirect(w, r, j.FailureURL, http.StatusSeeOther)
+			return
+		}
+
+		err = j.Auth.Authorize(r.Context(), w, p)
+		if err == ErrSecondFactorPending {
+			log.Info("User ", p.Subject, " is authenticated pending the second factor")
+			http.Redirect(w, r, j.TwoFactorURL, http.StatusSeeOther)
+			return
+		}
+		if err != nil {
+			log.Error("Unable to get add session to response ", err.Error())
+			http.Redirect(w, r, j.FailureURL, http.StatusSeeOther)
+			return
+		}
+		log.Info("User ", p.Subject, " is authenticated")
+		http.Redirect(w, r, j.SuccessURL, http.StatusSeeOther)
+	})
+}
+
+// Logout handler will expire our authentication cookie and redirect to the successURL
+func (j *SAMLMux) Logout() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		j.Auth.Expire(w)
+		http.Redirect(w, r, j.SuccessURL, http.StatusTemporaryRedirect)
+	})
+}
+
+// Metadata returns a handler serving the metadata of the SP, with which it
+// is registered at the identity provider
+func (j *SAMLMux) Metadata() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		md, err := j.Provider.SP.Metadata()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/samlmetadata+xml")
+		_, _ = w.Write(md)
+	})
+}
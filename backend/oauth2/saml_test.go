@@ -0,0 +1,226 @@
+package oauth2
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	clog "github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/saml"
+)
+
+var samlNow = time.Date(2020, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+// signedSAMLResponse returns a response with an assertion signed by key.
+// The assertion and SignedInfo are written in their canonical form, so
+// that they are digested and signed as they are.
+func signedSAMLResponse(t *testing.T, key *rsa.PrivateKey, requestID string) string {
+	assertion := fmt.Sprintf(`<saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="id-assertion" IssueInstant="2020-03-01T12:00:00Z" Version="2.0">`+
+		`<saml:Issuer>https://idp.example.com</saml:Issuer>`+
+		`<saml:Subject><saml:NameID>jdoe</saml:NameID><saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">`+
+		`<saml:SubjectConfirmationData InResponseTo="%s" NotOnOrAfter="2020-03-01T12:05:00Z" Recipient="https://cloudhub.example.com/oauth/saml/callback"></saml:SubjectConfirmationData>`+
+		`</saml:SubjectConfirmation></saml:Subject>`+
+		`<saml:Conditions NotBefore="2020-03-01T11:59:00Z" NotOnOrAfter="2020-03-01T12:05:00Z"><saml:AudienceRestriction><saml:Audience>https://cloudhub.example.com/oauth/saml/metadata</saml:Audience></saml:AudienceRestriction></saml:Conditions>`+
+		`<saml:AttributeStatement>`+
+		`<saml:Attribute Name="email"><saml:AttributeValue>jdoe@example.com</saml:AttributeValue></saml:Attribute>`+
+		`<saml:Attribute Name="groups"><saml:AttributeValue>admins</saml:AttributeValue><saml:AttributeValue>developers</saml:AttributeValue></saml:Attribute>`+
+		`</saml:AttributeStatement></saml:Assertion>`, requestID)
+	digest := sha256.Sum256([]byte(assertion))
+
+	signedInfo := `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#">` +
+		`<ds:CanonicalizationMethod Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"></ds:CanonicalizationMethod>` +
+		`<ds:SignatureMethod Algorithm="http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"></ds:SignatureMethod>` +
+		`<ds:Reference URI="#id-assertion"><ds:Transforms>` +
+		`<ds:Transform Algorithm="http://www.w3.org/2000/09/xmldsig#enveloped-signature"></ds:Transform>` +
+		`<ds:Transform Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"></ds:Transform>` +
+		`</ds:Transforms><ds:DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"></ds:DigestMethod>` +
+		`<ds:DigestValue>` + base64.StdEncoding.EncodeToString(digest[:]) + `</ds:DigestValue></ds:Reference></ds:SignedInfo>`
+	hashed := sha256.Sum256([]byte(signedInfo))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := `<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#">` + signedInfo +
+		`<ds:SignatureValue>` + base64.StdEncoding.EncodeToString(sig) + `</ds:SignatureValue></ds:Signature>`
+	assertion = strings.Replace(assertion, "</saml:Assertion>", signature+"</saml:Assertion>", 1)
+
+	res := `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ` +
+		`ID="id-response" Version="2.0" IssueInstant="2020-03-01T12:00:00Z" Destination="https://cloudhub.example.com/oauth/saml/callback" InResponseTo="` + requestID + `">` +
+		`<saml:Issuer>https://idp.example.com</saml:Issuer>` +
+		`<samlp:Status><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/></samlp:Status>` +
+		assertion + `</samlp:Response>`
+	return base64.StdEncoding.EncodeToString([]byte(res))
+}
+
+func newSAMLMux(t *testing.T) (*SAMLMux, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    samlNow.Add(-time.Hour),
+		NotAfter:     samlNow.Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider := &SAML{
+		SP: &saml.ServiceProvider{
+			EntityID:        "https://cloudhub.example.com/oauth/saml/metadata",
+			ACSURL:          "https://cloudhub.example.com/oauth/saml/callback",
+			IDPEntityID:     "https://idp.example.com",
+			IDPSSOURL:       "https://idp.example.com/sso",
+			IDPCertificates: []*x509.Certificate{cert},
+			Now:             func() time.Time { return samlNow },
+		},
+		EmailAttribute:  "email",
+		GroupsAttribute: "groups",
+		Logger:          clog.New(clog.DebugLevel),
+	}
+	return NewSAMLMux(provider, NewCookieJWT("secret", time.Hour), NewJWT("secret", ""), "/cloudhub", clog.New(clog.DebugLevel)), key
+}
+
+func TestSAML_Principal(t *testing.T) {
+	mux, key := newSAMLMux(t)
+
+	p, err := mux.Provider.Principal(context.Background(), signedSAMLResponse(t, key, "id-request"), "id-request")
+	if err != nil {
+		t.Fatalf("Principal() error = %v", err)
+	}
+	want := Principal{Subject: "jdoe@example.com", Issuer: "saml", Group: "admins,developers"}
+	if p != want {
+		t.Errorf("Principal() = %+v, want %+v", p, want)
+	}
+
+	mux.Provider.EmailAttribute = "mail"
+	if _, err := mux.Provider.Principal(context.Background(), signedSAMLResponse(t, key, "id-other"), "id-other"); err == nil {
+		t.Error("Principal() expected an error without the email attribute")
+	}
+}
+
+func TestSAMLMux_Login(t *testing.T) {
+	mux, _ := newSAMLMux(t)
+
+	w := httptest.NewRecorder()
+	mux.Login().ServeHTTP(w, httptest.NewRequest("GET", "/cloudhub/oauth/saml/login", nil))
+	if w.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("Login() status = %d, want %d", w.Code, http.StatusTemporaryRedirect)
+	}
+	loc, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.Host != "idp.example.com" || loc.Query().Get("SAMLRequest") == "" {
+		t.Errorf("Login() location = %s, want an authentication request of the IdP", loc)
+	}
+	p, err := mux.Tokens.ValidPrincipal(context.Background(), Token(loc.Query().Get("RelayState")), TenMinutes)
+	if err != nil {
+		t.Fatalf("Login() RelayState is invalid: %v", err)
+	}
+	if !strings.HasPrefix(p.Subject, "id-") {
+		t.Errorf("Login() RelayState subject = %q, want the request ID", p.Subject)
+	}
+}
+
+func TestSAMLMux_Callback(t *testing.T) {
+	mux, key := newSAMLMux(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	relayState := func(id string) string {
+		now := time.Now()
+		token, err := mux.Tokens.Create(context.Background(), Principal{Subject: id, IssuedAt: now, ExpiresAt: now.Add(TenMinutes)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(token)
+	}
+
+	tests := []struct {
+		name       string
+		form       url.Values
+		location   string
+		wantCookie bool
+	}{
+		{
+			name:       "Signed response to the request",
+			form:       url.Values{"RelayState": {relayState("id-1")}, "SAMLResponse": {signedSAMLResponse(t, key, "id-1")}},
+			location:   "/cloudhub",
+			wantCookie: true,
+		},
+		{
+			name:     "Response to another request",
+			form:     url.Values{"RelayState": {relayState("id-2")}, "SAMLResponse": {signedSAMLResponse(t, key, "id-3")}},
+			location: "/cloudhub/login",
+		},
+		{
+			name:     "Response signed by another key",
+			form:     url.Values{"RelayState": {relayState("id-4")}, "SAMLResponse": {signedSAMLResponse(t, otherKey, "id-4")}},
+			location: "/cloudhub/login",
+		},
+		{
+			name:     "Invalid RelayState",
+			form:     url.Values{"RelayState": {"forged"}, "SAMLResponse": {signedSAMLResponse(t, key, "id-5")}},
+			location: "/cloudhub/login",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "/cloudhub/oauth/saml/callback", strings.NewReader(tt.form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			mux.Callback().ServeHTTP(w, r)
+
+			resp := w.Result()
+			if resp.StatusCode != http.StatusSeeOther {
+				t.Errorf("Callback() status = %d, want %d", resp.StatusCode, http.StatusSeeOther)
+			}
+			if loc := resp.Header.Get("Location"); loc != tt.location {
+				t.Errorf("Callback() location = %q, want %q", loc, tt.location)
+			}
+			cookie := false
+			for _, c := range resp.Cookies() {
+				cookie = cookie || (c.Name == DefaultCookieName && c.Value != "")
+			}
+			if cookie != tt.wantCookie {
+				t.Errorf("Callback() session cookie = %v, want %v", cookie, tt.wantCookie)
+			}
+		})
+	}
+}
+
+func TestSAMLMux_Metadata(t *testing.T) {
+	mux, _ := newSAMLMux(t)
+
+	w := httptest.NewRecorder()
+	mux.Metadata().ServeHTTP(w, httptest.NewRequest("GET", "/cloudhub/oauth/saml/metadata", nil))
+	if ct := w.Header().Get("Content-Type"); ct != "application/samlmetadata+xml" {
+		t.Errorf("Metadata() content type = %q", ct)
+	}
+	if !strings.Contains(w.Body.String(), `entityID="https://cloudhub.example.com/oauth/saml/metadata"`) {
+		t.Errorf("Metadata() = %s", w.Body.String())
+	}
+}
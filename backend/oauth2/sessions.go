@@ -0,0 +1,193 @@
+package oauth2
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// Ensure Sessions is an Authenticator
+var _ Authenticator = &Sessions{}
+
+// SessionActivity is how often the activity of a session is recorded in
+// its store; requests of a session in between are not recorded.
+const SessionActivity = time.Minute
+
+type clientKey string
+
+// ClientKey is used to pass the user agent and address of the client of a
+// request to the sessions authorized with its context.
+var ClientKey = clientKey("client")
+
+type client struct {
+	UserAgent  string
+	RemoteAddr string
+}
+
+// WithClient returns a context with the user agent and address of the
+// client of a request, which are recorded on the sessions authorized with it
+func WithClient(ctx context.Context, r *http.Request) context.Context {
+	return context.WithValue(ctx, ClientKey, client{
+		UserAgent:  r.UserAgent(),
+		RemoteAddr: r.RemoteAddr,
+	})
+}
+
+// NewSessions tracks the sessions of the principals authorized by a in
+// store. lifespan is the maximum lifetime of a session, or 0 if unbounded.
+func NewSessions(a Authenticator, store cloudhub.SessionsStore, lifespan time.Duration, l cloudhub.Logger) *Sessions {
+	return &Sessions{
+		Authenticator: a,
+		Store:         store,
+		Lifespan:      lifespan,
+		Logger:        l,
+		Now:           DefaultNowTime,
+	}
+}
+
+// Sessions is an Authenticator that records every login in a store as a
+// session. The tokens of a session carry its ID, and are only valid while
+// the session is stored, so that a session is revoked by deleting it.
+type Sessions struct {
+	Authenticator                        // Authenticator creates and validates the tokens of sessions
+	Store         cloudhub.SessionsStore // Store is the storage of the sessions
+	Lifespan      time.Duration          // Lifespan is the maximum lifetime of a session; 0 means unbounded
+	Logger        cloudhub.Logger
+	Now           func() time.Time // Now returns the current time (for testing)
+}
+
+// Validate returns the Principal of a token of a stored session. Tokens
+// without a session, such as those issued before sessions were recorded, are
+// not valid.
+func (s *Sessions) Validate(ctx context.Context, r *http.Request) (Principal, error) {
+	p, err := s.Authenticator.Validate(ctx, r)
+	if err != nil {
+		return Principal{}, err
+	}
+	if _, err := s.session(ctx, p); err != nil {
+		return Principal{}, err
+	}
+	return p, nil
+}
+
+// Authorize creates the session of a new login. A principal that already
+// has a session, such as one changing its organization, keeps its session.
+func (s *Sessions) Authorize(ctx context.Context, w http.ResponseWriter, p Principal) error {
+	now := s.Now().UTC()
+	if p.SessionID != "" {
+		session, err := s.session(ctx, p)
+		if err != nil {
+			return err
+		}
+		// Like its token, the session lasts a lifespan from its authorization
+		session.Organization = p.Organization
+		session.LastSeenAt = now
+		if s.Lifespan > 0 {
+			session.ExpiresAt = now.Add(s.Lifespan)
+		}
+		if err := s.Store.Update(ctx, session); err != nil {
+			return err
+		}
+		return s.Authenticator.Authorize(ctx, w, p)
+	}
+
+	s.removeExpired(ctx, now)
+
+	session := cloudhub.Session{
+		Subject:      p.Subject,
+		Provider:     p.Issuer,
+		Organization: p.Organization,
+		CreatedAt:    now,
+		LastSeenAt:   now,
+	}
+	if c, ok := ctx.Value(ClientKey).(client); ok {
+		session.UserAgent = c.UserAgent
+		session.RemoteAddr = c.RemoteAddr
+	}
+	if s.Lifespan > 0 {
+		session.ExpiresAt = now.Add(s.Lifespan)
+	}
+	session, err := s.Store.Add(ctx, session)
+	if err != nil {
+		return err
+	}
+
+	p.SessionID = session.ID
+	if err := s.Authenticator.Authorize(ctx, w, p); err != nil {
+		_ = s.Store.Delete(ctx, session)
+		return err
+	}
+	return nil
+}
+
+// Extend extends the lifetime of the token of a valid principal, and records
+// the activity of its session at most every SessionActivity.
+func (s *Sessions) Extend(ctx context.Context, w http.ResponseWriter, p Principal) (Principal, error) {
+	p, err := s.Authenticator.Extend(ctx, w, p)
+	if err != nil {
+		return Principal{}, err
+	}
+
+	now := s.Now().UTC()
+	session, err := s.session(ctx, p)
+	if err != nil {
+		return Principal{}, err
+	}
+	if now.Sub(session.LastSeenAt) >= SessionActivity {
+		session.LastSeenAt = now
+		if err := s.Store.Update(ctx, session); err != nil {
+			s.Logger.
+				WithField("component", "auth").
+				Error("Unable to record the activity of session ", session.ID, ": ", err.Error())
+		}
+	}
+	return p, nil
+}
+
+// session returns the stored session of a principal
+func (s *Sessions) session(ctx context.Context, p Principal) (cloudhub.Session, error) {
+	if p.SessionID == "" {
+		return cloudhub.Session{}, ErrAuthentication
+	}
+	session, err := s.Store.Get(ctx, p.SessionID)
+	if err != nil {
+		return cloudhub.Session{}, ErrAuthentication
+	}
+	if session.Subject != p.Subject || session.Provider != p.Issuer {
+		return cloudhub.Session{}, ErrAuthentication
+	}
+	if SessionExpired(session, s.Now()) {
+		return cloudhub.Session{}, ErrAuthentication
+	}
+	return session, nil
+}
+
+// removeExpired removes the sessions that can no longer be used from the store
+func (s *Sessions) removeExpired(ctx context.Context, now time.Time) {
+	sessions, err := s.Store.All(ctx)
+	if err != nil {
+		return
+	}
+	for _, session := range sessions {
+		if !SessionExpired(session, now) {
+			continue
+		}
+		if err := s.Store.Delete(ctx, session); err != nil {
+			s.Logger.
+				WithField("component", "auth").
+				Error("Unable to remove expired session ", session.ID, ": ", err.Error())
+		}
+	}
+}
+
+// SessionExpired reports whether the tokens of a session can no longer be
+// valid, either at the end of its lifespan or after it was inactive for
+// longer than tokens last without activity.
+func SessionExpired(session cloudhub.Session, now time.Time) bool {
+	if !session.ExpiresAt.IsZero() && !now.Before(session.ExpiresAt) {
+		return true
+	}
+	return now.After(session.LastSeenAt.Add(DefaultInactivityDuration + SessionActivity))
+}
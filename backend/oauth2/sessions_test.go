@@ -0,0 +1,163 @@
+package oauth2
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	clog "github.com/snetsystems/cloudhub/backend/log"
+)
+
+// localSessions is an in-memory SessionsStore
+type localSessions map[string]cloudhub.Session
+
+func (s localSessions) All(context.Context) ([]cloudhub.Session, error) {
+	all := []cloudhub.Session{}
+	for _, session := range s {
+		all = append(all, session)
+	}
+	return all, nil
+}
+
+func (s localSessions) Add(ctx context.Context, session cloudhub.Session) (cloudhub.Session, error) {
+	session.ID = strconv.Itoa(len(s) + 1)
+	s[session.ID] = session
+	return session, nil
+}
+
+func (s localSessions) Delete(ctx context.Context, session cloudhub.Session) error {
+	delete(s, session.ID)
+	return nil
+}
+
+func (s localSessions) Get(ctx context.Context, id string) (cloudhub.Session, error) {
+	session, ok := s[id]
+	if !ok {
+		return cloudhub.Session{}, cloudhub.ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (s localSessions) Update(ctx context.Context, session cloudhub.Session) error {
+	if _, ok := s[session.ID]; !ok {
+		return cloudhub.ErrSessionNotFound
+	}
+	s[session.ID] = session
+	return nil
+}
+
+// sessionRequest returns a request with the session cookie written to w
+func sessionRequest(w *httptest.ResponseRecorder) *http.Request {
+	r := httptest.NewRequest("GET", "http://any.url/cloudhub/v1/me", nil)
+	for _, c := range w.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	return r
+}
+
+func TestSessions(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	store := localSessions{}
+	s := NewSessions(&cookie{
+		Name:       DefaultCookieName,
+		Lifespan:   time.Hour,
+		Inactivity: DefaultInactivityDuration,
+		Now:        clock,
+		Tokens:     &JWT{Secret: "secret", Now: clock},
+	}, store, time.Hour, clog.New(clog.DebugLevel))
+	s.Now = clock
+
+	// A token without a session is not valid
+	w := httptest.NewRecorder()
+	if err := s.Authenticator.Authorize(context.Background(), w, Principal{Subject: "marty", Issuer: "github"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Validate(context.Background(), sessionRequest(w)); err != ErrAuthentication {
+		t.Errorf("Validate() of a token without session error = %v, want %v", err, ErrAuthentication)
+	}
+
+	// A login records its client
+	r := httptest.NewRequest("GET", "http://any.url/oauth/github/callback", nil)
+	r.Header.Set("User-Agent", "Mozilla/5.0")
+	r.RemoteAddr = "10.0.0.1:51234"
+	ctx := WithClient(context.Background(), r)
+	w = httptest.NewRecorder()
+	if err := s.Authorize(ctx, w, Principal{Subject: "marty", Issuer: "github", Organization: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(store) != 1 {
+		t.Fatalf("Authorize() stored %d sessions, want 1", len(store))
+	}
+	session := store["1"]
+	if session.Subject != "marty" || session.UserAgent != "Mozilla/5.0" || session.RemoteAddr != "10.0.0.1:51234" || !session.ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("Authorize() stored %#v", session)
+	}
+
+	p, err := s.Validate(context.Background(), sessionRequest(w))
+	if err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if p.SessionID != session.ID {
+		t.Errorf("Validate() session ID = %q, want %q", p.SessionID, session.ID)
+	}
+
+	// The activity of a session is recorded once a SessionActivity
+	now = now.Add(2 * SessionActivity)
+	w = httptest.NewRecorder()
+	if p, err = s.Extend(context.Background(), w, p); err != nil {
+		t.Fatalf("Extend() error = %v", err)
+	}
+	if got := store[session.ID].LastSeenAt; !got.Equal(now) {
+		t.Errorf("Extend() recorded last seen at %v, want %v", got, now)
+	}
+
+	// Changing the organization keeps the session
+	p.Organization = "2"
+	if err := s.Authorize(context.Background(), httptest.NewRecorder(), p); err != nil {
+		t.Fatal(err)
+	}
+	if len(store) != 1 || store[session.ID].Organization != "2" {
+		t.Errorf("Authorize() of a principal with a session stored %v", store)
+	}
+
+	// Revoked sessions are not valid anymore, even with an unexpired token
+	delete(store, session.ID)
+	if _, err := s.Validate(context.Background(), sessionRequest(w)); err != ErrAuthentication {
+		t.Errorf("Validate() of a revoked session error = %v, want %v", err, ErrAuthentication)
+	}
+}
+
+func TestSessionExpired(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		session cloudhub.Session
+		want    bool
+	}{
+		{
+			name:    "Active session",
+			session: cloudhub.Session{LastSeenAt: now.Add(-time.Minute), ExpiresAt: now.Add(time.Hour)},
+			want:    false,
+		},
+		{
+			name:    "Session at the end of its lifespan",
+			session: cloudhub.Session{LastSeenAt: now.Add(-time.Minute), ExpiresAt: now},
+			want:    true,
+		},
+		{
+			name:    "Inactive session without lifespan",
+			session: cloudhub.Session{LastSeenAt: now.Add(-time.Hour)},
+			want:    true,
+		},
+	}
+	for _, tt := range tests {
+		if got := SessionExpired(tt.session, now); got != tt.want {
+			t.Errorf("%q. SessionExpired() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/totp"
+)
+
+// Ensure TwoFactor is an Authenticator and TOTP is a SecondFactor
+var (
+	_ Authenticator = &TwoFactor{}
+	_ SecondFactor  = &TOTP{}
+)
+
+const (
+	// TwoFactorCookie is the name of the cookie of a login pending its second factor
+	TwoFactorCookie = "session_2fa"
+	// TwoFactorDuration is how long a login waits for its second factor
+	TwoFactorDuration = 5 * time.Minute
+	// BackupCodeCount is the number of backup codes of a user
+	BackupCodeCount = 10
+)
+
+// ErrSecondFactorPending means that a principal was authenticated by its
+// provider, but must pass its second factor before it is authorized
+var ErrSecondFactorPending = errors.New("second factor of the principal is pending")
+
+// SecondFactor verifies a second factor of principals authenticated by a
+// provider
+type SecondFactor interface {
+	// Required reports whether a principal has a second factor
+	Required(ctx context.Context, p Principal) (bool, error)
+	// Verify checks a code of the second factor of a principal; ErrAuthentication
+	// means the code is wrong.
+	Verify(ctx context.Context, p Principal, code string) error
+}
+
+// NewTwoFactor constructs the second step of the logins authorized by a,
+// served at /oauth/2fa. The pending logins are signed with a key derived
+// from secret, so that they are never valid session tokens.
+func NewTwoFactor(secret string, a Authenticator, f SecondFactor, basepath string, l cloudhub.Logger) *TwoFactor {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("cloudhub second factor"))
+	return &TwoFactor{
+		Authenticator: a,
+		SecondFactor:  f,
+		Tokens:        NewJWT(hex.EncodeToString(mac.Sum(nil)), ""),
+		URL:           path.Join(basepath, "/oauth/2fa"),
+		SuccessURL:    path.Join(basepath, "/"),
+		FailureURL:    path.Join(basepath, "/login"),
+		Now:           DefaultNowTime,
+		Logger:        l,
+	}
+}
+
+// TwoFactor is an Authenticator that only authorizes principals with a
+// second factor once it is verified. Muxes redirect logins to URL when
+// Authorize returns ErrSecondFactorPending.
+type TwoFactor struct {
+	Authenticator              // Authenticator authorizes principals after their second factor
+	SecondFactor  SecondFactor // SecondFactor verifies the codes of principals
+	Tokens        Tokenizer    // Tokens is used to create and validate the cookies of pending logins
+	Logger        cloudhub.Logger
+	URL           string           // URL serves the form of the code and receives it
+	SuccessURL    string           // SuccessURL is redirect location after successful authorization
+	FailureURL    string           // FailureURL is redirect location when the pending login expired
+	Now           func() time.Time // Now returns the current time (for testing)
+}
+
+// Authorize authorizes a principal without a second factor. Otherwise it
+// stores the pending login in a short lived cookie and returns
+// ErrSecondFactorPending.
+func (t *TwoFactor) Authorize(ctx context.Context, w http.ResponseWriter, p Principal) error {
+	required, err := t.SecondFactor.Required(ctx, p)
+	if err != nil {
+		return err
+	}
+	if !required {
+		return t.Authenticator.Authorize(ctx, w, p)
+	}
+
+	now := t.Now()
+	p.IssuedAt = now
+	p.ExpiresAt = now.Add(TwoFactorDuration)
+	token, err := t.Tokens.Create(ctx, p)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     TwoFactorCookie,
+		Value:    string(token),
+		Path:     t.URL,
+		Expires:  p.ExpiresAt,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return ErrSecondFactorPending
+}
+
+// expirePending expires the cookie of a pending login
+func (t *TwoFactor) expirePending(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     TwoFactorCookie,
+		Value:    "none",
+		Path:     t.URL,
+		Expires:  t.Now().Add(-1 * time.Hour),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+var twoFactorForm = template.Must(template.New("2fa").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>CloudHub - Two-factor authentication</title>
+</head>
+<body>
+<form method="post" action="{{.URL}}">
+<h2>Two-factor authentication</h2>
+{{if .Failed}}<p role="alert">Invalid code</p>{{end}}
+<p><label>Code of your authenticator app, or a backup code <input name="code" autocomplete="one-time-code" inputmode="numeric" autofocus required></label></p>
+<p><button type="submit">Verify</button></p>
+</form>
+</body>
+</html>
+`))
+
+// Form returns a handler serving the form of the code of a pending login
+func (t *TwoFactor) Form() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-Frame-Options", "DENY")
+		_ = twoFactorForm.Execute(w, struct {
+			URL    string
+			Failed bool
+		}{
+			URL:    t.URL,
+			Failed: r.URL.Query().Get("failed") != "",
+		})
+	})
+}
+
+// Verify returns a handler checking the code posted for a pending login. If
+// the code is valid, Verify authorizes the principal and redirects to
+// SuccessURL; otherwise it redirects back to the form.
+func (t *TwoFactor) Verify() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := t.Logger.
+			WithField("component", "auth").
+			WithField("remote_addr", r.RemoteAddr).
+			WithField("method", r.Method).
+			WithField("url", r.URL)
+
+		c, err := r.Cookie(TwoFactorCookie)
+		if err != nil {
+			log.Error("No pending login to verify")
+			http.Redirect(w, r, t.FailureURL, http.StatusSeeOther)
+			return
+		}
+		p, err := t.Tokens.ValidPrincipal(r.Context(), Token(c.Value), TwoFactorDuration)
+		if err != nil {
+			log.Error("Invalid pending login: ", err.Error())
+			t.expirePending(w)
+			http.Redirect(w, r, t.FailureURL, http.StatusSeeOther)
+			return
+		}
+
+		if err := t.SecondFactor.Verify(r.Context(), p, r.PostFormValue("code")); err != nil {
+			log.Error("Unable to verify the second factor of ", p.Subject, ": ", err.Error())
+			http.Redirect(w, r, t.URL+"?failed=true", http.StatusSeeOther)
+			return
+		}
+
+		p.IssuedAt, p.ExpiresAt = time.Time{}, time.Time{}
+		if err := t.Authenticator.Authorize(r.Context(), w, p); err != nil {
+			log.Error("Unable to get add session to response ", err.Error())
+			http.Redirect(w, r, t.FailureURL, http.StatusSeeOther)
+			return
+		}
+		t.expirePending(w)
+		log.Info("User ", p.Subject, " passed the second factor")
+		http.Redirect(w, r, t.SuccessURL, http.StatusSeeOther)
+	})
+}
+
+// TOTP is the SecondFactor of the users of CloudHub that enrolled a TOTP
+// authenticator app. A user may also use each of its backup codes once.
+// After MaxAttempts consecutive wrong codes, a user is locked out for
+// LockoutDuration.
+type TOTP struct {
+	Users           cloudhub.UsersStore
+	MaxAttempts     int
+	LockoutDuration time.Duration
+	Logger          cloudhub.Logger
+	Now             func() time.Time
+
+	mu sync.Mutex // mu serializes the updates of the used codes
+}
+
+func (f *TOTP) user(ctx context.Context, p Principal) (*cloudhub.User, error) {
+	scheme := "oauth2"
+	return f.Users.Get(ctx, cloudhub.UserQuery{
+		Name:     &p.Subject,
+		Provider: &p.Issuer,
+		Scheme:   &scheme,
+	})
+}
+
+// Required reports whether the user of a principal enrolled TOTP
+func (f *TOTP) Required(ctx context.Context, p Principal) (bool, error) {
+	u, err := f.user(ctx, p)
+	if err == cloudhub.ErrUserNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return u.TOTPEnabled, nil
+}
+
+// Verify checks a TOTP or backup code of the user of a principal, counting
+// wrong codes toward its lockout
+func (f *TOTP) Verify(ctx context.Context, p Principal, code string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	u, err := f.user(ctx, p)
+	if err != nil {
+		return err
+	}
+
+	now := f.now()
+	if now.Before(u.LockedUntil) {
+		f.Logger.
+			WithField("component", "auth").
+			Info("Locked out user ", p.Subject, " attempted to verify a second factor")
+		return ErrAuthentication
+	}
+
+	if !CheckSecondFactor(u, code, now) {
+		u.FailedCodes++
+		if f.MaxAttempts > 0 && u.FailedCodes >= f.MaxAttempts {
+			u.FailedCodes = 0
+			u.LockedUntil = now.Add(f.LockoutDuration)
+			f.Logger.
+				WithField("component", "auth").
+				Info("User ", p.Subject, " is locked out until ", u.LockedUntil.Format(time.RFC3339))
+		}
+		if err := f.Users.Update(ctx, u); err != nil {
+			return err
+		}
+		return ErrAuthentication
+	}
+
+	u.FailedCodes = 0
+	return f.Users.Update(ctx, u)
+}
+
+func (f *TOTP) now() time.Time {
+	if f.Now != nil {
+		return f.Now()
+	}
+	return DefaultNowTime()
+}
+
+// CheckSecondFactor reports whether a code is a TOTP code or a backup code
+// of a user with an enrolled second factor. A valid code is consumed on the
+// user, which must be updated.
+func CheckSecondFactor(u *cloudhub.User, code string, now time.Time) bool {
+	if !u.TOTPEnabled || code == "" {
+		return false
+	}
+	if counter, ok := totp.Validate(u.TOTPSecret, code, now); ok {
+		// Codes of a time step cannot be used again
+		if counter <= u.TOTPCounter {
+			return false
+		}
+		u.TOTPCounter = counter
+		return true
+	}
+
+	hash := hashBackupCode(code)
+	for i, h := range u.BackupCodes {
+		if subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1 {
+			u.BackupCodes = append(u.BackupCodes[:i:i], u.BackupCodes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// NewBackupCodes generates the backup codes of a user and stores their
+// hashes on it. The codes are only returned here.
+func NewBackupCodes(u *cloudhub.User) ([]string, error) {
+	codes := make([]string, BackupCodeCount)
+	hashes := make([]string, BackupCodeCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		h := hex.EncodeToString(b)
+		codes[i] = fmt.Sprintf("%s-%s", h[:5], h[5:])
+		hashes[i] = hashBackupCode(codes[i])
+	}
+	u.BackupCodes = hashes
+	return codes, nil
+}
+
+func hashBackupCode(code string) string {
+	code = strings.ToLower(strings.Replace(strings.TrimSpace(code), "-", "", -1))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
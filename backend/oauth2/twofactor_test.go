@@ -0,0 +1,214 @@
+package oauth2
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	clog "github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/totp"
+)
+
+// totpSecret is the key of the test vectors of RFC 6238 in base32
+const totpSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// totpNow is the time of the code 050471 of totpSecret
+var totpNow = time.Unix(1111111111, 0)
+
+func newTOTPUsers(t *testing.T) (localUsers, []string) {
+	alice := &cloudhub.User{
+		Name:        "alice",
+		Provider:    "github",
+		Scheme:      "oauth2",
+		TOTPSecret:  totpSecret,
+		TOTPEnabled: true,
+	}
+	codes, err := NewBackupCodes(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return localUsers{
+		"alice": alice,
+		"bob":   &cloudhub.User{Name: "bob", Provider: "github", Scheme: "oauth2"},
+	}, codes
+}
+
+func TestTOTP_Verify(t *testing.T) {
+	users, codes := newTOTPUsers(t)
+	now := totpNow
+	f := &TOTP{
+		Users:           users,
+		MaxAttempts:     3,
+		LockoutDuration: time.Minute,
+		Logger:          clog.New(clog.DebugLevel),
+		Now:             func() time.Time { return now },
+	}
+	ctx := context.Background()
+	alice := Principal{Subject: "alice", Issuer: "github"}
+
+	if required, err := f.Required(ctx, alice); err != nil || !required {
+		t.Errorf("Required() of an enrolled user = %v, %v", required, err)
+	}
+	if required, err := f.Required(ctx, Principal{Subject: "bob", Issuer: "github"}); err != nil || required {
+		t.Errorf("Required() of a user without a second factor = %v, %v", required, err)
+	}
+	if required, err := f.Required(ctx, Principal{Subject: "carol", Issuer: "github"}); err != nil || required {
+		t.Errorf("Required() of an unknown user = %v, %v", required, err)
+	}
+
+	if err := f.Verify(ctx, alice, "050471"); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if err := f.Verify(ctx, alice, "050471"); err != ErrAuthentication {
+		t.Errorf("Verify() of a used code error = %v, want %v", err, ErrAuthentication)
+	}
+
+	// Backup codes are used once
+	if err := f.Verify(ctx, alice, strings.ToUpper(codes[0])); err != nil {
+		t.Fatalf("Verify() of a backup code error = %v", err)
+	}
+	if got := len(users["alice"].BackupCodes); got != BackupCodeCount-1 {
+		t.Errorf("Verify() left %d backup codes, want %d", got, BackupCodeCount-1)
+	}
+	if err := f.Verify(ctx, alice, codes[0]); err != ErrAuthentication {
+		t.Errorf("Verify() of a used backup code error = %v, want %v", err, ErrAuthentication)
+	}
+
+	// Wrong codes lock the user out, even with the right code
+	for i := 0; i < 2; i++ {
+		if err := f.Verify(ctx, alice, "000000"); err != ErrAuthentication {
+			t.Fatalf("Verify() error = %v, want %v", err, ErrAuthentication)
+		}
+	}
+	if !users["alice"].LockedUntil.Equal(now.Add(time.Minute)) {
+		t.Fatalf("LockedUntil = %v, want %v", users["alice"].LockedUntil, now.Add(time.Minute))
+	}
+	now = now.Add(totp.Period)
+	code, _ := totp.CodeAt(totpSecret, totp.Counter(now))
+	if err := f.Verify(ctx, alice, code); err != ErrAuthentication {
+		t.Errorf("Verify() of a locked out user error = %v, want %v", err, ErrAuthentication)
+	}
+}
+
+func TestTwoFactor(t *testing.T) {
+	users, _ := newTOTPUsers(t)
+	auth := NewCookieJWT("secret", time.Hour)
+	f := &TOTP{Users: users, Logger: clog.New(clog.DebugLevel), Now: func() time.Time { return totpNow }}
+	tf := NewTwoFactor("secret", auth, f, "/cloudhub", clog.New(clog.DebugLevel))
+	ctx := context.Background()
+
+	cookieOf := func(resp *http.Response, name string) *http.Cookie {
+		for _, c := range resp.Cookies() {
+			if c.Name == name {
+				return c
+			}
+		}
+		return nil
+	}
+
+	// Users without a second factor are authorized at once
+	w := httptest.NewRecorder()
+	if err := tf.Authorize(ctx, w, Principal{Subject: "bob", Issuer: "github"}); err != nil {
+		t.Fatalf("Authorize() error = %v", err)
+	}
+	if cookieOf(w.Result(), DefaultCookieName) == nil {
+		t.Errorf("Authorize() did not set the session of a user without a second factor")
+	}
+
+	// Users with a second factor are pending
+	w = httptest.NewRecorder()
+	if err := tf.Authorize(ctx, w, Principal{Subject: "alice", Issuer: "github"}); err != ErrSecondFactorPending {
+		t.Fatalf("Authorize() error = %v, want %v", err, ErrSecondFactorPending)
+	}
+	if cookieOf(w.Result(), DefaultCookieName) != nil {
+		t.Fatalf("Authorize() set the session of a pending login")
+	}
+	pending := cookieOf(w.Result(), TwoFactorCookie)
+	if pending == nil {
+		t.Fatalf("Authorize() did not set the cookie of the pending login")
+	}
+
+	// A pending login is not a session
+	r := httptest.NewRequest("GET", "/cloudhub/cloudhub/v1/me", nil)
+	r.AddCookie(&http.Cookie{Name: DefaultCookieName, Value: pending.Value})
+	if _, err := auth.Validate(ctx, r); err == nil {
+		t.Errorf("Validate() accepted a pending login as a session")
+	}
+
+	verify := func(code string) *http.Response {
+		r := httptest.NewRequest("POST", "/cloudhub/oauth/2fa", strings.NewReader(url.Values{"code": {code}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.AddCookie(&http.Cookie{Name: TwoFactorCookie, Value: pending.Value})
+		w := httptest.NewRecorder()
+		tf.Verify().ServeHTTP(w, r)
+		return w.Result()
+	}
+
+	resp := verify("123456")
+	if loc := resp.Header.Get("Location"); loc != "/cloudhub/oauth/2fa?failed=true" {
+		t.Errorf("Verify() of a wrong code location = %q", loc)
+	}
+	if cookieOf(resp, DefaultCookieName) != nil {
+		t.Errorf("Verify() of a wrong code set the session")
+	}
+
+	resp = verify("050471")
+	if loc := resp.Header.Get("Location"); loc != "/cloudhub" {
+		t.Errorf("Verify() location = %q, want %q", loc, "/cloudhub")
+	}
+	session := cookieOf(resp, DefaultCookieName)
+	if session == nil {
+		t.Fatalf("Verify() did not set the session")
+	}
+	r = httptest.NewRequest("GET", "/cloudhub/cloudhub/v1/me", nil)
+	r.AddCookie(session)
+	if p, err := auth.Validate(ctx, r); err != nil || p.Subject != "alice" || p.Issuer != "github" {
+		t.Errorf("Validate() of the session = %+v, %v", p, err)
+	}
+
+	// Without a pending login, Verify redirects to the login page
+	r = httptest.NewRequest("POST", "/cloudhub/oauth/2fa", strings.NewReader("code=050471"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	tf.Verify().ServeHTTP(w, r)
+	if loc := w.Result().Header.Get("Location"); loc != "/cloudhub/login" {
+		t.Errorf("Verify() without a pending login location = %q", loc)
+	}
+}
+
+func TestCredentialsMux_Callback_TwoFactor(t *testing.T) {
+	users, _ := newTOTPUsers(t)
+	users["alice"].Provider = LocalProvider
+	if err := (PasswordPolicy{}).SetPassword(users["alice"], "password"); err != nil {
+		t.Fatal(err)
+	}
+	provider := &Local{Users: users, Logger: clog.New(clog.DebugLevel)}
+	f := &TOTP{Users: users, Logger: clog.New(clog.DebugLevel)}
+	tf := NewTwoFactor("secret", NewCookieJWT("secret", time.Hour), f, "/cloudhub", clog.New(clog.DebugLevel))
+	mux := NewCredentialsMux(provider, tf, NewJWT("secret", ""), "/cloudhub", clog.New(clog.DebugLevel))
+
+	now := time.Now()
+	state, err := mux.Tokens.Create(context.Background(), Principal{Subject: "state", IssuedAt: now, ExpiresAt: now.Add(TenMinutes)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	form := url.Values{"state": {string(state)}, "username": {"alice"}, "password": {"password"}}
+	r := httptest.NewRequest("POST", "/cloudhub/oauth/local/callback", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	mux.Callback().ServeHTTP(w, r)
+
+	if loc := w.Result().Header.Get("Location"); loc != "/cloudhub/oauth/2fa" {
+		t.Errorf("Callback() location = %q, want %q", loc, "/cloudhub/oauth/2fa")
+	}
+	for _, c := range w.Result().Cookies() {
+		if c.Name == DefaultCookieName {
+			t.Errorf("Callback() set the session of a login pending its second factor")
+		}
+	}
+}
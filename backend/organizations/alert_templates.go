@@ -0,0 +1,110 @@
+package organizations
+
+import (
+	"context"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// ensure that AlertTemplatesStore implements cloudhub.AlertTemplatesStore
+var _ cloudhub.AlertTemplatesStore = &AlertTemplatesStore{}
+
+// AlertTemplatesStore facade on an AlertTemplatesStore that filters alert templates
+// by organization.
+type AlertTemplatesStore struct {
+	store        cloudhub.AlertTemplatesStore
+	organization string
+}
+
+// NewAlertTemplatesStore creates a new AlertTemplatesStore from an existing
+// cloudhub.AlertTemplatesStore and an organization string
+func NewAlertTemplatesStore(s cloudhub.AlertTemplatesStore, org string) *AlertTemplatesStore {
+	return &AlertTemplatesStore{
+		store:        s,
+		organization: org,
+	}
+}
+
+// All retrieves all alert templates from the underlying AlertTemplatesStore and filters them
+// by organization.
+func (s *AlertTemplatesStore) All(ctx context.Context) ([]cloudhub.AlertTemplate, error) {
+	err := validOrganization(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpls, err := s.store.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	templates := tmpls[:0]
+	for _, d := range tmpls {
+		if d.Organization == s.organization {
+			templates = append(templates, d)
+		}
+	}
+
+	return templates, nil
+}
+
+// Add creates a new AlertTemplate in the AlertTemplatesStore with AlertTemplate.Organization set to be the
+// organization from the alert template store.
+func (s *AlertTemplatesStore) Add(ctx context.Context, d cloudhub.AlertTemplate) (cloudhub.AlertTemplate, error) {
+	err := validOrganization(ctx)
+	if err != nil {
+		return cloudhub.AlertTemplate{}, err
+	}
+
+	d.Organization = s.organization
+	return s.store.Add(ctx, d)
+}
+
+// Delete the alert template from AlertTemplatesStore
+func (s *AlertTemplatesStore) Delete(ctx context.Context, d cloudhub.AlertTemplate) error {
+	err := validOrganization(ctx)
+	if err != nil {
+		return err
+	}
+
+	d, err = s.store.Get(ctx, d.ID)
+	if err != nil {
+		return err
+	}
+
+	return s.store.Delete(ctx, d)
+}
+
+// Get returns an AlertTemplate if the id exists and belongs to the organization that is set.
+func (s *AlertTemplatesStore) Get(ctx context.Context, id string) (cloudhub.AlertTemplate, error) {
+	err := validOrganization(ctx)
+	if err != nil {
+		return cloudhub.AlertTemplate{}, err
+	}
+
+	d, err := s.store.Get(ctx, id)
+	if err != nil {
+		return cloudhub.AlertTemplate{}, err
+	}
+
+	if d.Organization != s.organization {
+		return cloudhub.AlertTemplate{}, cloudhub.ErrAlertTemplateNotFound
+	}
+
+	return d, nil
+}
+
+// Update the alert template in AlertTemplatesStore.
+func (s *AlertTemplatesStore) Update(ctx context.Context, d cloudhub.AlertTemplate) error {
+	err := validOrganization(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.store.Get(ctx, d.ID)
+	if err != nil {
+		return err
+	}
+
+	return s.store.Update(ctx, d)
+}
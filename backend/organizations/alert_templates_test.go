@@ -0,0 +1,349 @@
+package organizations_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	gocmp "github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+	"github.com/snetsystems/cloudhub/backend/organizations"
+)
+
+// IgnoreFields is used because ID cannot be predicted reliably
+// EquateEmpty is used because we want nil slices, arrays, and maps to be equal to the empty map
+var alertTemplateCloudHubOptions = gocmp.Options{
+	cmpopts.EquateEmpty(),
+	cmpopts.IgnoreFields(cloudhub.AlertTemplate{}, "ID"),
+}
+
+func TestAlertTemplates_All(t *testing.T) {
+	type fields struct {
+		AlertTemplatesStore cloudhub.AlertTemplatesStore
+	}
+	type args struct {
+		organization string
+		ctx          context.Context
+	}
+	tests := []struct {
+		name    string
+		args    args
+		fields  fields
+		want    []cloudhub.AlertTemplate
+		wantRaw []cloudhub.AlertTemplate
+		wantErr bool
+	}{
+		{
+			name: "No Alert Templates",
+			fields: fields{
+				AlertTemplatesStore: &mocks.AlertTemplatesStore{
+					AllF: func(ctx context.Context) ([]cloudhub.AlertTemplate, error) {
+						return nil, fmt.Errorf("No Alert Templates")
+					},
+				},
+			},
+			args: args{
+				organization: "1337",
+				ctx:          context.Background(),
+			},
+			wantErr: true,
+		},
+		{
+			name: "All Alert Templates",
+			fields: fields{
+				AlertTemplatesStore: &mocks.AlertTemplatesStore{
+					AllF: func(ctx context.Context) ([]cloudhub.AlertTemplate, error) {
+						return []cloudhub.AlertTemplate{
+							{
+								Name:         "cpu high",
+								Organization: "1337",
+							},
+							{
+								Name:         "disk full",
+								Organization: "1338",
+							},
+						}, nil
+					},
+				},
+			},
+			args: args{
+				organization: "1337",
+				ctx:          context.Background(),
+			},
+			want: []cloudhub.AlertTemplate{
+				{
+					Name:         "cpu high",
+					Organization: "1337",
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		s := organizations.NewAlertTemplatesStore(tt.fields.AlertTemplatesStore, tt.args.organization)
+		tt.args.ctx = context.WithValue(tt.args.ctx, organizations.ContextKey, tt.args.organization)
+		gots, err := s.All(tt.args.ctx)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q. AlertTemplatesStore.All() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		for i, got := range gots {
+			if diff := gocmp.Diff(got, tt.want[i], alertTemplateCloudHubOptions...); diff != "" {
+				t.Errorf("%q. AlertTemplatesStore.All():\n-got/+want\ndiff %s", tt.name, diff)
+			}
+		}
+	}
+}
+
+func TestAlertTemplates_Add(t *testing.T) {
+	type fields struct {
+		AlertTemplatesStore cloudhub.AlertTemplatesStore
+	}
+	type args struct {
+		organization string
+		ctx          context.Context
+		template     cloudhub.AlertTemplate
+	}
+	tests := []struct {
+		name    string
+		args    args
+		fields  fields
+		want    cloudhub.AlertTemplate
+		wantErr bool
+	}{
+		{
+			name: "Add Alert Template",
+			fields: fields{
+				AlertTemplatesStore: &mocks.AlertTemplatesStore{
+					AddF: func(ctx context.Context, s cloudhub.AlertTemplate) (cloudhub.AlertTemplate, error) {
+						return s, nil
+					},
+					GetF: func(ctx context.Context, id string) (cloudhub.AlertTemplate, error) {
+						return cloudhub.AlertTemplate{
+							ID:           "1229",
+							Name:         "cpu high",
+							Organization: "1337",
+						}, nil
+					},
+					AllF: func(ctx context.Context) ([]cloudhub.AlertTemplate, error) {
+						return []cloudhub.AlertTemplate{}, nil
+					},
+				},
+			},
+			args: args{
+				organization: "1337",
+				ctx:          context.Background(),
+				template: cloudhub.AlertTemplate{
+					ID:   "1229",
+					Name: "cpu high",
+				},
+			},
+			want: cloudhub.AlertTemplate{
+				Name:         "cpu high",
+				Organization: "1337",
+			},
+		},
+	}
+	for _, tt := range tests {
+		s := organizations.NewAlertTemplatesStore(tt.fields.AlertTemplatesStore, tt.args.organization)
+		tt.args.ctx = context.WithValue(tt.args.ctx, organizations.ContextKey, tt.args.organization)
+		d, err := s.Add(tt.args.ctx, tt.args.template)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q. AlertTemplatesStore.Add() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		got, err := s.Get(tt.args.ctx, d.ID)
+		if diff := gocmp.Diff(got, tt.want, alertTemplateCloudHubOptions...); diff != "" {
+			t.Errorf("%q. AlertTemplatesStore.Add():\n-got/+want\ndiff %s", tt.name, diff)
+		}
+	}
+}
+
+func TestAlertTemplates_Delete(t *testing.T) {
+	type fields struct {
+		AlertTemplatesStore cloudhub.AlertTemplatesStore
+	}
+	type args struct {
+		organization string
+		ctx          context.Context
+		template     cloudhub.AlertTemplate
+	}
+	tests := []struct {
+		name     string
+		fields   fields
+		args     args
+		want     []cloudhub.AlertTemplate
+		addFirst bool
+		wantErr  bool
+	}{
+		{
+			name: "Delete alert template",
+			fields: fields{
+				AlertTemplatesStore: &mocks.AlertTemplatesStore{
+					DeleteF: func(ctx context.Context, s cloudhub.AlertTemplate) error {
+						return nil
+					},
+					GetF: func(ctx context.Context, id string) (cloudhub.AlertTemplate, error) {
+						return cloudhub.AlertTemplate{
+							ID:           "1229",
+							Name:         "cpu high",
+							Organization: "1337",
+						}, nil
+					},
+				},
+			},
+			args: args{
+				organization: "1337",
+				ctx:          context.Background(),
+				template: cloudhub.AlertTemplate{
+					ID:           "1229",
+					Name:         "cpu high",
+					Organization: "1337",
+				},
+			},
+			addFirst: true,
+		},
+	}
+	for _, tt := range tests {
+		s := organizations.NewAlertTemplatesStore(tt.fields.AlertTemplatesStore, tt.args.organization)
+		tt.args.ctx = context.WithValue(tt.args.ctx, organizations.ContextKey, tt.args.organization)
+		err := s.Delete(tt.args.ctx, tt.args.template)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q. AlertTemplatesStore.All() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+	}
+}
+
+func TestAlertTemplates_Get(t *testing.T) {
+	type fields struct {
+		AlertTemplatesStore cloudhub.AlertTemplatesStore
+	}
+	type args struct {
+		organization string
+		ctx          context.Context
+		template     cloudhub.AlertTemplate
+	}
+	tests := []struct {
+		name     string
+		fields   fields
+		args     args
+		want     cloudhub.AlertTemplate
+		addFirst bool
+		wantErr  bool
+	}{
+		{
+			name: "Get Server",
+			fields: fields{
+				AlertTemplatesStore: &mocks.AlertTemplatesStore{
+					GetF: func(ctx context.Context, id string) (cloudhub.AlertTemplate, error) {
+						return cloudhub.AlertTemplate{
+							ID:           "1229",
+							Name:         "cpu high",
+							Organization: "1337",
+						}, nil
+					},
+				},
+			},
+			args: args{
+				organization: "1337",
+				ctx:          context.Background(),
+				template: cloudhub.AlertTemplate{
+					ID:           "1229",
+					Name:         "cpu high",
+					Organization: "1337",
+				},
+			},
+			want: cloudhub.AlertTemplate{
+				ID:           "1229",
+				Name:         "cpu high",
+				Organization: "1337",
+			},
+		},
+	}
+	for _, tt := range tests {
+		s := organizations.NewAlertTemplatesStore(tt.fields.AlertTemplatesStore, tt.args.organization)
+		tt.args.ctx = context.WithValue(tt.args.ctx, organizations.ContextKey, tt.args.organization)
+		got, err := s.Get(tt.args.ctx, tt.args.template.ID)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q. AlertTemplatesStore.Get() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if diff := gocmp.Diff(got, tt.want, alertTemplateCloudHubOptions...); diff != "" {
+			t.Errorf("%q. AlertTemplatesStore.Get():\n-got/+want\ndiff %s", tt.name, diff)
+		}
+	}
+}
+
+func TestAlertTemplates_Update(t *testing.T) {
+	type fields struct {
+		AlertTemplatesStore cloudhub.AlertTemplatesStore
+	}
+	type args struct {
+		organization string
+		ctx          context.Context
+		template     cloudhub.AlertTemplate
+		name         string
+	}
+	tests := []struct {
+		name     string
+		fields   fields
+		args     args
+		want     cloudhub.AlertTemplate
+		addFirst bool
+		wantErr  bool
+	}{
+		{
+			name: "Update Alert Template Name",
+			fields: fields{
+				AlertTemplatesStore: &mocks.AlertTemplatesStore{
+					UpdateF: func(ctx context.Context, s cloudhub.AlertTemplate) error {
+						return nil
+					},
+					GetF: func(ctx context.Context, id string) (cloudhub.AlertTemplate, error) {
+						return cloudhub.AlertTemplate{
+							ID:           "1229",
+							Name:         "cpu high",
+							Organization: "1337",
+						}, nil
+					},
+					AllF: func(ctx context.Context) ([]cloudhub.AlertTemplate, error) {
+						return []cloudhub.AlertTemplate{}, nil
+					},
+				},
+			},
+			args: args{
+				organization: "1337",
+				ctx:          context.Background(),
+				template: cloudhub.AlertTemplate{
+					ID:           "1229",
+					Name:         "cpu high",
+					Organization: "1337",
+				},
+				name: "cpu high",
+			},
+			want: cloudhub.AlertTemplate{
+				Name:         "cpu high",
+				Organization: "1337",
+			},
+			addFirst: true,
+		},
+	}
+	for _, tt := range tests {
+		if tt.args.name != "" {
+			tt.args.template.Name = tt.args.name
+		}
+		s := organizations.NewAlertTemplatesStore(tt.fields.AlertTemplatesStore, tt.args.organization)
+		tt.args.ctx = context.WithValue(tt.args.ctx, organizations.ContextKey, tt.args.organization)
+		err := s.Update(tt.args.ctx, tt.args.template)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q. AlertTemplatesStore.Update() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		got, err := s.Get(tt.args.ctx, tt.args.template.ID)
+		if diff := gocmp.Diff(got, tt.want, alertTemplateCloudHubOptions...); diff != "" {
+			t.Errorf("%q. AlertTemplatesStore.Update():\n-got/+want\ndiff %s", tt.name, diff)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package organizations
+
+import (
+	"context"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// ensure that PoliciesStore implements cloudhub.PoliciesStore
+var _ cloudhub.PoliciesStore = &PoliciesStore{}
+
+// PoliciesStore facade on a PoliciesStore that filters policies
+// by organization.
+type PoliciesStore struct {
+	store        cloudhub.PoliciesStore
+	organization string
+}
+
+// NewPoliciesStore creates a new PoliciesStore from an existing
+// cloudhub.PoliciesStore and an organization string
+func NewPoliciesStore(s cloudhub.PoliciesStore, org string) *PoliciesStore {
+	return &PoliciesStore{
+		store:        s,
+		organization: org,
+	}
+}
+
+// All retrieves all policies from the underlying PoliciesStore and filters them
+// by organization.
+func (s *PoliciesStore) All(ctx context.Context) ([]cloudhub.Policy, error) {
+	err := validOrganization(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	all, err := s.store.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	policies := all[:0]
+	for _, p := range all {
+		if p.Organization == s.organization {
+			policies = append(policies, p)
+		}
+	}
+
+	return policies, nil
+}
+
+// Add creates a new Policy in the PoliciesStore with Policy.Organization set to be the
+// organization from the policy store.
+func (s *PoliciesStore) Add(ctx context.Context, p cloudhub.Policy) (cloudhub.Policy, error) {
+	err := validOrganization(ctx)
+	if err != nil {
+		return cloudhub.Policy{}, err
+	}
+
+	p.Organization = s.organization
+	return s.store.Add(ctx, p)
+}
+
+// Delete the policy from PoliciesStore
+func (s *PoliciesStore) Delete(ctx context.Context, p cloudhub.Policy) error {
+	err := validOrganization(ctx)
+	if err != nil {
+		return err
+	}
+
+	p, err = s.Get(ctx, p.ID)
+	if err != nil {
+		return err
+	}
+
+	return s.store.Delete(ctx, p)
+}
+
+// Get returns a Policy if the id exists and belongs to the organization that is set.
+func (s *PoliciesStore) Get(ctx context.Context, id string) (cloudhub.Policy, error) {
+	err := validOrganization(ctx)
+	if err != nil {
+		return cloudhub.Policy{}, err
+	}
+
+	p, err := s.store.Get(ctx, id)
+	if err != nil {
+		return cloudhub.Policy{}, err
+	}
+
+	if p.Organization != s.organization {
+		return cloudhub.Policy{}, cloudhub.ErrPolicyNotFound
+	}
+
+	return p, nil
+}
+
+// Update the policy in PoliciesStore if it belongs to the organization that is set.
+func (s *PoliciesStore) Update(ctx context.Context, p cloudhub.Policy) error {
+	err := validOrganization(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err = s.Get(ctx, p.ID); err != nil {
+		return err
+	}
+
+	p.Organization = s.organization
+	return s.store.Update(ctx, p)
+}
@@ -0,0 +1,90 @@
+package organizations_test
+
+import (
+	"context"
+	"testing"
+
+	gocmp "github.com/google/go-cmp/cmp"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+	"github.com/snetsystems/cloudhub/backend/organizations"
+)
+
+// policiesStore returns a PoliciesStore of two policies of the organizations
+// 1337 and 1338, keeping the policies updated and deleted
+func policiesStore(updated, deleted *[]cloudhub.Policy) *mocks.PoliciesStore {
+	policies := map[string]cloudhub.Policy{
+		"1": {ID: "1", Organization: "1337", Resource: cloudhub.PolicyDashboard, ResourceID: "7", Role: "viewer", Permission: cloudhub.PermissionRead},
+		"2": {ID: "2", Organization: "1338", Resource: cloudhub.PolicySource, ResourceID: "1", UserID: 3, Permission: cloudhub.PermissionAdmin},
+	}
+	return &mocks.PoliciesStore{
+		AllF: func(ctx context.Context) ([]cloudhub.Policy, error) {
+			return []cloudhub.Policy{policies["1"], policies["2"]}, nil
+		},
+		AddF: func(ctx context.Context, p cloudhub.Policy) (cloudhub.Policy, error) {
+			p.ID = "3"
+			return p, nil
+		},
+		GetF: func(ctx context.Context, id string) (cloudhub.Policy, error) {
+			p, ok := policies[id]
+			if !ok {
+				return cloudhub.Policy{}, cloudhub.ErrPolicyNotFound
+			}
+			return p, nil
+		},
+		UpdateF: func(ctx context.Context, p cloudhub.Policy) error {
+			*updated = append(*updated, p)
+			return nil
+		},
+		DeleteF: func(ctx context.Context, p cloudhub.Policy) error {
+			*deleted = append(*deleted, p)
+			return nil
+		},
+	}
+}
+
+func TestPolicies(t *testing.T) {
+	var updated, deleted []cloudhub.Policy
+	s := organizations.NewPoliciesStore(policiesStore(&updated, &deleted), "1337")
+	ctx := context.WithValue(context.Background(), organizations.ContextKey, "1337")
+
+	all, err := s.All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0].ID != "1" {
+		t.Errorf("PoliciesStore.All() = %v, want the policy 1", all)
+	}
+
+	added, err := s.Add(ctx, cloudhub.Policy{Organization: "1338", Resource: cloudhub.PolicyCapability, ResourceID: cloudhub.CapabilitySalt, Role: "editor"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added.Organization != "1337" {
+		t.Errorf("PoliciesStore.Add() organization = %s, want %s", added.Organization, "1337")
+	}
+
+	if _, err := s.Get(ctx, "2"); err != cloudhub.ErrPolicyNotFound {
+		t.Errorf("PoliciesStore.Get() of a policy of another organization error = %v, want %v", err, cloudhub.ErrPolicyNotFound)
+	}
+	if err := s.Update(ctx, cloudhub.Policy{ID: "2", Permission: cloudhub.PermissionRead}); err != cloudhub.ErrPolicyNotFound {
+		t.Errorf("PoliciesStore.Update() of a policy of another organization error = %v, want %v", err, cloudhub.ErrPolicyNotFound)
+	}
+	if err := s.Delete(ctx, cloudhub.Policy{ID: "2"}); err != cloudhub.ErrPolicyNotFound {
+		t.Errorf("PoliciesStore.Delete() of a policy of another organization error = %v, want %v", err, cloudhub.ErrPolicyNotFound)
+	}
+
+	if err := s.Update(ctx, cloudhub.Policy{ID: "1", Organization: "1338", Role: "editor", Permission: cloudhub.PermissionWrite}); err != nil {
+		t.Fatal(err)
+	}
+	want := []cloudhub.Policy{{ID: "1", Organization: "1337", Role: "editor", Permission: cloudhub.PermissionWrite}}
+	if diff := gocmp.Diff(updated, want); diff != "" {
+		t.Errorf("PoliciesStore.Update():\n-got/+want\ndiff %s", diff)
+	}
+	if err := s.Delete(ctx, cloudhub.Policy{ID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 || deleted[0].ID != "1" {
+		t.Errorf("PoliciesStore.Delete() deleted %v", deleted)
+	}
+}
@@ -0,0 +1,207 @@
+// Package prometheus reads time series of Prometheus, or of any server with
+// the same HTTP API, with PromQL.
+package prometheus
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/noop"
+)
+
+var _ cloudhub.TimeSeries = &Client{}
+
+// Shared transports for all clients to prevent leaking connections
+var (
+	skipVerifyTransport = &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	defaultTransport = &http.Transport{}
+)
+
+// Client queries a Prometheus server with PromQL
+type Client struct {
+	URL                *url.URL
+	Username           string
+	Password           string
+	Token              string // Token is sent as an Authorization: Bearer when set
+	InsecureSkipVerify bool
+	Logger             cloudhub.Logger
+	Now                func() time.Time
+}
+
+// Response is the data of a successful response of the Prometheus API
+type Response struct {
+	Status    string          `json:"status"`
+	Data      json.RawMessage `json:"data"`
+	ErrorType string          `json:"errorType,omitempty"`
+	Err       string          `json:"error,omitempty"`
+}
+
+// MarshalJSON returns the raw data of the response, e.g. the resultType and
+// result of a query
+func (r Response) MarshalJSON() ([]byte, error) {
+	return r.Data, nil
+}
+
+// Connect caches the URL and credentials of the source
+func (c *Client) Connect(ctx context.Context, src *cloudhub.Source) error {
+	u, err := url.Parse(src.URL)
+	if err != nil {
+		return err
+	}
+	c.URL = u
+	c.Username = src.Username
+	c.Password = src.Password
+	c.Token = src.Token
+	// Only allow acceptance of all certs if the scheme is https AND the user opted into to the setting.
+	c.InsecureSkipVerify = u.Scheme == "https" && src.InsecureSkipVerify
+	return nil
+}
+
+// Query evaluates the PromQL of q at the current time
+func (c *Client) Query(ctx context.Context, q cloudhub.Query) (cloudhub.Response, error) {
+	params := url.Values{
+		"query": {q.Command},
+		"time":  {formatTime(c.now())},
+	}
+	return c.get(ctx, "/api/v1/query", params)
+}
+
+// QueryRange evaluates PromQL at every step between start and end
+func (c *Client) QueryRange(ctx context.Context, promQL string, start, end time.Time, step time.Duration) (cloudhub.Response, error) {
+	if step <= 0 {
+		return nil, fmt.Errorf("step must be positive")
+	}
+	params := url.Values{
+		"query": {promQL},
+		"start": {formatTime(start)},
+		"end":   {formatTime(end)},
+		"step":  {strconv.FormatFloat(step.Seconds(), 'f', -1, 64)},
+	}
+	return c.get(ctx, "/api/v1/query_range", params)
+}
+
+// Ping checks that the server answers the Prometheus API
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.Version(ctx)
+	return err
+}
+
+// Version returns the version of the Prometheus server
+func (c *Client) Version(ctx context.Context) (string, error) {
+	res, err := c.get(ctx, "/api/v1/status/buildinfo", nil)
+	if err != nil {
+		return "", err
+	}
+	var info struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(res.Data, &info); err != nil {
+		return "", err
+	}
+	return info.Version, nil
+}
+
+// Write is not supported; Prometheus scrapes its points
+func (c *Client) Write(context.Context, []cloudhub.Point) error {
+	return errors.New("writes are not supported by Prometheus sources")
+}
+
+// Users are not supported by Prometheus
+func (c *Client) Users(context.Context) cloudhub.UsersStore {
+	return &noop.UsersStore{}
+}
+
+// Permissions are not supported by Prometheus
+func (c *Client) Permissions(context.Context) cloudhub.Permissions {
+	return cloudhub.Permissions{}
+}
+
+// Roles are not supported by Prometheus
+func (c *Client) Roles(context.Context) (cloudhub.RolesStore, error) {
+	return nil, errors.New("roles are not supported by Prometheus sources")
+}
+
+func (c *Client) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
+
+func (c *Client) get(ctx context.Context, path string, params url.Values) (*Response, error) {
+	u := *c.URL
+	u.Path = singleJoiningSlash(u.Path, path)
+	u.RawQuery = params.Encode()
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	} else if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	hc := &http.Client{}
+	if c.InsecureSkipVerify {
+		hc.Transport = skipVerifyTransport
+	} else {
+		hc.Transport = defaultTransport
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, cloudhub.ErrUpstreamTimeout
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var res Response
+	if err := json.Unmarshal(body, &res); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("received status code %d from server: err: %s", resp.StatusCode, body)
+		}
+		return nil, err
+	}
+	if res.Status != "success" {
+		if res.Err == "" {
+			res.Err = fmt.Sprintf("received status code %d from server", resp.StatusCode)
+		}
+		return nil, errors.New(res.Err)
+	}
+	return &res, nil
+}
+
+// formatTime formats a time as the seconds since the epoch
+func formatTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixNano())/1e9, 'f', -1, 64)
+}
+
+func singleJoiningSlash(a, b string) string {
+	if a == "" || a == "/" {
+		return b
+	}
+	if a[len(a)-1] == '/' {
+		a = a[:len(a)-1]
+	}
+	return a + b
+}
@@ -0,0 +1,161 @@
+package prometheus_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/prometheus"
+)
+
+// newPrometheus is a stand-in of the Prometheus HTTP API that records the
+// parameters of the queries it answers
+func newPrometheus(t *testing.T, params *[]map[string]string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("Unauthorized"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+
+		got := map[string]string{"path": r.URL.Path}
+		for k := range r.URL.Query() {
+			got[k] = r.URL.Query().Get(k)
+		}
+		*params = append(*params, got)
+
+		switch r.URL.Path {
+		case "/api/v1/status/buildinfo":
+			w.Write([]byte(`{"status":"success","data":{"version":"2.45.0","revision":"8ef767e"}}`))
+		case "/api/v1/query":
+			w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{"job":"node"},"value":[1500000000,"1"]}]}}`))
+		case "/api/v1/query_range":
+			if got["query"] == "bad(" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"status":"error","errorType":"bad_data","error":"parse error: unclosed left parenthesis"}`))
+				return
+			}
+			w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"job":"node"},"values":[[1500000000,"1"],[1500000060,"2"]]}]}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func newClient(t *testing.T, url string) *prometheus.Client {
+	t.Helper()
+	cli := &prometheus.Client{
+		Now: func() time.Time { return time.Unix(1500000000, 0) },
+	}
+	err := cli.Connect(context.Background(), &cloudhub.Source{
+		URL:   url,
+		Type:  cloudhub.Prometheus,
+		Token: "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cli
+}
+
+func TestClient_Query(t *testing.T) {
+	var params []map[string]string
+	ts := newPrometheus(t, &params)
+	defer ts.Close()
+	cli := newClient(t, ts.URL)
+	ctx := context.Background()
+
+	version, err := cli.Version(ctx)
+	if err != nil || version != "2.45.0" {
+		t.Errorf("Version() = %q, %v; want 2.45.0", version, err)
+	}
+
+	res, err := cli.Query(ctx, cloudhub.Query{Command: `up{job="node"}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	octets, err := res.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data struct {
+		ResultType string `json:"resultType"`
+	}
+	if err := json.Unmarshal(octets, &data); err != nil || data.ResultType != "vector" {
+		t.Errorf("Query() = %s, %v; want the data of a vector", octets, err)
+	}
+	if got := params[len(params)-1]; got["query"] != `up{job="node"}` || got["time"] != "1500000000" {
+		t.Errorf("Query() sent %v", got)
+	}
+
+	start := time.Unix(1500000000, 0)
+	_, err = cli.QueryRange(ctx, "rate(node_cpu_seconds_total[5m])", start, start.Add(time.Hour), 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"path":  "/api/v1/query_range",
+		"query": "rate(node_cpu_seconds_total[5m])",
+		"start": "1500000000",
+		"end":   "1500003600",
+		"step":  "10",
+	}
+	if got := params[len(params)-1]; len(got) != len(want) || got["start"] != want["start"] || got["end"] != want["end"] || got["step"] != want["step"] || got["query"] != want["query"] {
+		t.Errorf("QueryRange() sent %v, want %v", got, want)
+	}
+
+	_, err = cli.QueryRange(ctx, "bad(", start, start.Add(time.Hour), 10*time.Second)
+	if err == nil || err.Error() != "parse error: unclosed left parenthesis" {
+		t.Errorf("QueryRange() error = %v, want the error of the server", err)
+	}
+
+	if err := cli.Write(ctx, []cloudhub.Point{{Measurement: "cpu"}}); err == nil {
+		t.Error("Write() wrote to Prometheus")
+	}
+}
+
+func TestClient_Unauthorized(t *testing.T) {
+	var params []map[string]string
+	ts := newPrometheus(t, &params)
+	defer ts.Close()
+
+	cli := &prometheus.Client{}
+	if err := cli.Connect(context.Background(), &cloudhub.Source{URL: ts.URL}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.Ping(context.Background()); err == nil {
+		t.Error("Ping() succeeded without the token")
+	}
+}
+
+func TestRenderTemplates(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	if step := prometheus.Step(start, start.Add(time.Hour)); step != 10*time.Second {
+		t.Errorf("Step(1h) = %s, want 10s", step)
+	}
+	if step := prometheus.Step(start, start.Add(time.Minute)); step != time.Second {
+		t.Errorf("Step(1m) = %s, want 1s", step)
+	}
+	if step := prometheus.Step(start, start.Add(61*time.Minute)); step != 11*time.Second {
+		t.Errorf("Step(61m) = %s, want 11s", step)
+	}
+
+	got := prometheus.RenderTemplates(`rate(node_cpu_seconds_total{instance=":host:"}[:interval:])`, []cloudhub.TemplateVar{
+		{
+			Var: ":host:",
+			Values: []cloudhub.TemplateValue{
+				{Value: "server01", Type: "tagValue"},
+				{Value: "server02", Type: "tagValue", Selected: true},
+			},
+		},
+	}, 30*time.Second)
+	if want := `rate(node_cpu_seconds_total{instance="server02"}[30s])`; got != want {
+		t.Errorf("RenderTemplates() = %s, want %s", got, want)
+	}
+}
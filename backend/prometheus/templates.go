@@ -0,0 +1,49 @@
+package prometheus
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// TemplateInterval is replaced by the step of a PromQL range query, e.g. in
+// rate(http_requests_total[:interval:])
+const TemplateInterval = ":interval:"
+
+// pointsPerGraph is the number of points the step of a dashboard query aims
+// at, as for InfluxQL
+const pointsPerGraph = 360
+
+// Step is the resolution of a range query from start to end, in whole
+// seconds
+func Step(start, end time.Time) time.Duration {
+	step := end.Sub(start) / pointsPerGraph
+	if rounded := step.Truncate(time.Second); rounded < step {
+		step = rounded + time.Second
+	}
+	if step < time.Second {
+		step = time.Second
+	}
+	return step
+}
+
+// RenderTemplates replaces the templates of a PromQL query with their
+// selected values as written, since PromQL quotes label values itself, and
+// :interval: with the step of the query
+func RenderTemplates(promQL string, templates []cloudhub.TemplateVar, step time.Duration) string {
+	for _, t := range templates {
+		if !strings.Contains(promQL, t.Var) {
+			continue
+		}
+		for _, v := range t.Values {
+			if v.Selected {
+				promQL = strings.Replace(promQL, t.Var, v.Value, -1)
+				break
+			}
+		}
+	}
+	interval := fmt.Sprintf("%ds", int64(step/time.Second))
+	return strings.Replace(promQL, TemplateInterval, interval, -1)
+}
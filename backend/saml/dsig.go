@@ -0,0 +1,167 @@
+package saml
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	// Hashes of the supported digest and signature methods
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// Namespaces and algorithms of XML signatures (https://www.w3.org/TR/xmldsig-core1/)
+const (
+	nsDSig       = "http://www.w3.org/2000/09/xmldsig#"
+	nsExcC14N    = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	algEnveloped = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+)
+
+// digestMethods and signatureMethods are the supported algorithms; SHA-1
+// is not supported
+var (
+	digestMethods = map[string]crypto.Hash{
+		"http://www.w3.org/2001/04/xmlenc#sha256": crypto.SHA256,
+		"http://www.w3.org/2001/04/xmlenc#sha512": crypto.SHA512,
+	}
+	signatureMethods = map[string]crypto.Hash{
+		"http://www.w3.org/2001/04/xmldsig-more#rsa-sha256": crypto.SHA256,
+		"http://www.w3.org/2001/04/xmldsig-more#rsa-sha512": crypto.SHA512,
+	}
+)
+
+// errNotSigned means that an element has no enveloped signature
+var errNotSigned = errors.New("element is not signed")
+
+// verifySignature verifies the enveloped signature of el with one of the
+// certificates. The signature must be a child of el referencing el by its
+// ID, so that the verified element is the one that is used.
+func verifySignature(el *node, certs []*x509.Certificate) error {
+	sig := el.element(nsDSig, "Signature")
+	if sig == nil {
+		if len(el.elements(nsDSig, "Signature")) > 1 {
+			return errors.New("more than one signature")
+		}
+		return errNotSigned
+	}
+
+	signedInfo := sig.element(nsDSig, "SignedInfo")
+	if signedInfo == nil {
+		return errors.New("missing SignedInfo")
+	}
+	c14n := signedInfo.element(nsDSig, "CanonicalizationMethod")
+	if c14n == nil || c14n.attr("Algorithm") != nsExcC14N {
+		return errors.New("unsupported canonicalization method")
+	}
+	method := signedInfo.element(nsDSig, "SignatureMethod")
+	if method == nil {
+		return errors.New("missing SignatureMethod")
+	}
+	sigHash, ok := signatureMethods[method.attr("Algorithm")]
+	if !ok {
+		return fmt.Errorf("unsupported signature method %s", method.attr("Algorithm"))
+	}
+
+	ref := signedInfo.element(nsDSig, "Reference")
+	if ref == nil {
+		return errors.New("signature must have one Reference")
+	}
+	if id := el.attr("ID"); id == "" || ref.attr("URI") != "#"+id {
+		return errors.New("signature does not reference its element")
+	}
+	if err := verifyDigest(el, sig, ref); err != nil {
+		return err
+	}
+
+	signed, err := canonicalize(signedInfo, inclusivePrefixes(c14n), nil)
+	if err != nil {
+		return err
+	}
+	value := sig.element(nsDSig, "SignatureValue")
+	if value == nil {
+		return errors.New("missing SignatureValue")
+	}
+	signature, err := decodeBase64(value.text())
+	if err != nil {
+		return fmt.Errorf("invalid SignatureValue: %v", err)
+	}
+
+	h := sigHash.New()
+	h.Write(signed)
+	hashed := h.Sum(nil)
+	for _, cert := range certs {
+		if key, ok := cert.PublicKey.(*rsa.PublicKey); ok {
+			if rsa.VerifyPKCS1v15(key, sigHash, hashed, signature) == nil {
+				return nil
+			}
+		}
+	}
+	return errors.New("signature does not match the certificates of the identity provider")
+}
+
+// verifyDigest checks the digest of the transforms of the referenced
+// element, which are the enveloped signature and exclusive canonicalization
+func verifyDigest(el, sig, ref *node) error {
+	var c14n *node
+	if transforms := ref.element(nsDSig, "Transforms"); transforms != nil {
+		for _, t := range transforms.elements(nsDSig, "Transform") {
+			switch t.attr("Algorithm") {
+			case algEnveloped:
+			case nsExcC14N:
+				c14n = t
+			default:
+				return fmt.Errorf("unsupported transform %s", t.attr("Algorithm"))
+			}
+		}
+	}
+	if c14n == nil {
+		return errors.New("reference must be canonicalized with exclusive canonicalization")
+	}
+
+	method := ref.element(nsDSig, "DigestMethod")
+	if method == nil {
+		return errors.New("missing DigestMethod")
+	}
+	digestHash, ok := digestMethods[method.attr("Algorithm")]
+	if !ok {
+		return fmt.Errorf("unsupported digest method %s", method.attr("Algorithm"))
+	}
+	value := ref.element(nsDSig, "DigestValue")
+	if value == nil {
+		return errors.New("missing DigestValue")
+	}
+	want, err := decodeBase64(value.text())
+	if err != nil {
+		return fmt.Errorf("invalid DigestValue: %v", err)
+	}
+
+	data, err := canonicalize(el, inclusivePrefixes(c14n), sig)
+	if err != nil {
+		return err
+	}
+	h := digestHash.New()
+	h.Write(data)
+	if subtle.ConstantTimeCompare(h.Sum(nil), want) != 1 {
+		return errors.New("digest of the signed element does not match")
+	}
+	return nil
+}
+
+// inclusivePrefixes returns the PrefixList of the InclusiveNamespaces of a
+// canonicalization method or transform
+func inclusivePrefixes(method *node) []string {
+	if ns := method.element(nsExcC14N, "InclusiveNamespaces"); ns != nil {
+		return strings.Fields(ns.attr("PrefixList"))
+	}
+	return nil
+}
+
+// decodeBase64 decodes base64 with line breaks
+func decodeBase64(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+}
@@ -0,0 +1,114 @@
+package saml
+
+import (
+	"crypto/x509"
+	"encoding/xml"
+	"errors"
+	"fmt"
+)
+
+type entityDescriptor struct {
+	XMLName         xml.Name         `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntityID        string           `xml:"entityID,attr"`
+	SPSSODescriptor *spSSODescriptor `xml:"SPSSODescriptor,omitempty"`
+}
+
+type spSSODescriptor struct {
+	AuthnRequestsSigned        bool                       `xml:",attr"`
+	WantAssertionsSigned       bool                       `xml:",attr"`
+	ProtocolSupportEnumeration string                     `xml:"protocolSupportEnumeration,attr"`
+	NameIDFormat               string                     `xml:"NameIDFormat"`
+	AssertionConsumerService   []assertionConsumerService `xml:"AssertionConsumerService"`
+}
+
+type assertionConsumerService struct {
+	Binding  string `xml:",attr"`
+	Location string `xml:",attr"`
+	Index    int    `xml:"index,attr"`
+}
+
+// Metadata returns the metadata of the SP, which registers it at the IdP
+func (sp *ServiceProvider) Metadata() ([]byte, error) {
+	md := entityDescriptor{
+		EntityID: sp.EntityID,
+		SPSSODescriptor: &spSSODescriptor{
+			WantAssertionsSigned:       true,
+			ProtocolSupportEnumeration: nsProtocol,
+			NameIDFormat:               nameIDUnspecified,
+			AssertionConsumerService: []assertionConsumerService{
+				{Binding: BindingHTTPPost, Location: sp.ACSURL, Index: 1},
+			},
+		},
+	}
+	octets, err := xml.MarshalIndent(md, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), octets...), nil
+}
+
+type idpEntityDescriptor struct {
+	XMLName          xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntityID         string   `xml:"entityID,attr"`
+	IDPSSODescriptor []struct {
+		KeyDescriptor []struct {
+			Use          string   `xml:"use,attr"`
+			Certificates []string `xml:"http://www.w3.org/2000/09/xmldsig# KeyInfo>X509Data>X509Certificate"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:metadata KeyDescriptor"`
+		SingleSignOnService []struct {
+			Binding  string `xml:",attr"`
+			Location string `xml:",attr"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:metadata SingleSignOnService"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:metadata IDPSSODescriptor"`
+}
+
+// IdentityProvider is the configuration of an IdP read from its metadata
+type IdentityProvider struct {
+	EntityID     string
+	SSOURL       string // SSOURL is the single sign-on service of the HTTP-Redirect binding
+	Certificates []*x509.Certificate
+}
+
+// ParseIDPMetadata reads the entity ID, the HTTP-Redirect single sign-on
+// service and the signing certificates of the EntityDescriptor of an IdP
+func ParseIDPMetadata(data []byte) (*IdentityProvider, error) {
+	var md idpEntityDescriptor
+	if err := xml.Unmarshal(data, &md); err != nil {
+		return nil, fmt.Errorf("invalid IdP metadata: %v", err)
+	}
+
+	idp := &IdentityProvider{EntityID: md.EntityID}
+	for _, desc := range md.IDPSSODescriptor {
+		for _, sso := range desc.SingleSignOnService {
+			if sso.Binding == BindingHTTPRedirect && idp.SSOURL == "" {
+				idp.SSOURL = sso.Location
+			}
+		}
+		for _, key := range desc.KeyDescriptor {
+			if key.Use != "" && key.Use != "signing" {
+				continue
+			}
+			for _, c := range key.Certificates {
+				der, err := decodeBase64(c)
+				if err != nil {
+					return nil, fmt.Errorf("invalid IdP certificate: %v", err)
+				}
+				cert, err := x509.ParseCertificate(der)
+				if err != nil {
+					return nil, fmt.Errorf("invalid IdP certificate: %v", err)
+				}
+				idp.Certificates = append(idp.Certificates, cert)
+			}
+		}
+	}
+
+	switch {
+	case idp.EntityID == "":
+		return nil, errors.New("IdP metadata has no entityID")
+	case idp.SSOURL == "":
+		return nil, errors.New("IdP metadata has no HTTP-Redirect SingleSignOnService")
+	case len(idp.Certificates) == 0:
+		return nil, errors.New("IdP metadata has no signing certificate")
+	}
+	return idp, nil
+}
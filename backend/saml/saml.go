@@ -0,0 +1,346 @@
+// Package saml is a SAML 2.0 service provider (SP) of the Web Browser SSO
+// profile. Authentication requests are sent with the HTTP-Redirect binding
+// and responses are received with the HTTP-POST binding; assertions must be
+// signed with RSA-SHA256 or RSA-SHA512.
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Namespaces, bindings and statuses of SAML 2.0 (https://docs.oasis-open.org/security/saml/v2.0/)
+const (
+	nsAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+	nsProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	nsMetadata  = "urn:oasis:names:tc:SAML:2.0:metadata"
+
+	BindingHTTPRedirect = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	BindingHTTPPost     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+
+	statusSuccess     = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	methodBearer      = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	nameIDUnspecified = "urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified"
+)
+
+// DefaultClockSkew is the difference tolerated between the clocks of the
+// SP and the IdP
+const DefaultClockSkew = 3 * time.Minute
+
+// ErrInvalidResponse means that a response does not authenticate a user
+var ErrInvalidResponse = errors.New("invalid SAML response")
+
+// ServiceProvider authenticates the users of an identity provider (IdP)
+type ServiceProvider struct {
+	EntityID string // EntityID of the SP, usually the URL of its metadata
+	ACSURL   string // ACSURL is the assertion consumer service posted responses
+
+	IDPEntityID     string              // IDPEntityID is the issuer of the responses
+	IDPSSOURL       string              // IDPSSOURL is the single sign-on service of the HTTP-Redirect binding
+	IDPCertificates []*x509.Certificate // IDPCertificates verify the signatures of the IdP
+
+	ClockSkew time.Duration
+	Now       func() time.Time
+
+	mu   sync.Mutex
+	seen map[string]time.Time // seen are the IDs of the consumed assertions until they expire
+}
+
+// Assertion is the authentication of a user by the IdP
+type Assertion struct {
+	ID         string
+	NameID     string
+	Attributes map[string][]string // Attributes by Name, and by FriendlyName
+}
+
+// NewRequestID returns a random ID of an authentication request
+func NewRequestID() string {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	// IDs must not start with a digit (xs:ID)
+	return "id-" + hex.EncodeToString(b)
+}
+
+type authnRequest struct {
+	XMLName                     xml.Name     `xml:"urn:oasis:names:tc:SAML:2.0:protocol AuthnRequest"`
+	ID                          string       `xml:",attr"`
+	Version                     string       `xml:",attr"`
+	IssueInstant                string       `xml:",attr"`
+	Destination                 string       `xml:",attr"`
+	ProtocolBinding             string       `xml:",attr"`
+	AssertionConsumerServiceURL string       `xml:",attr"`
+	Issuer                      issuer       `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	NameIDPolicy                nameIDPolicy `xml:"NameIDPolicy"`
+}
+
+type issuer struct {
+	Value string `xml:",chardata"`
+}
+
+type nameIDPolicy struct {
+	Format      string `xml:",attr"`
+	AllowCreate bool   `xml:",attr"`
+}
+
+// AuthnRequestURL returns the URL redirecting a browser to the IdP with an
+// authentication request of an ID; relayState is returned with the response
+// (HTTP-Redirect binding)
+func (sp *ServiceProvider) AuthnRequestURL(id, relayState string) (string, error) {
+	req := authnRequest{
+		ID:                          id,
+		Version:                     "2.0",
+		IssueInstant:                sp.now().Format(time.RFC3339),
+		Destination:                 sp.IDPSSOURL,
+		ProtocolBinding:             BindingHTTPPost,
+		AssertionConsumerServiceURL: sp.ACSURL,
+		Issuer:                      issuer{Value: sp.EntityID},
+		NameIDPolicy:                nameIDPolicy{Format: nameIDUnspecified, AllowCreate: true},
+	}
+	octets, err := xml.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+
+	var deflated bytes.Buffer
+	w, err := flate.NewWriter(&deflated, flate.DefaultCompression)
+	if err != nil {
+		return "", err
+	}
+	w.Write(octets)
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(sp.IDPSSOURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("SAMLRequest", base64.StdEncoding.EncodeToString(deflated.Bytes()))
+	if relayState != "" {
+		q.Set("RelayState", relayState)
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// ParseResponse verifies a base64 encoded response to the request of an ID
+// and returns its assertion. Either the response or the assertion must be
+// signed by the IdP; encrypted assertions are not supported. Assertions are
+// consumed only once.
+func (sp *ServiceProvider) ParseResponse(samlResponse, requestID string) (*Assertion, error) {
+	octets, err := decodeBase64(samlResponse)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", ErrInvalidResponse, err)
+	}
+	res, err := parseXML(octets)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", ErrInvalidResponse, err)
+	}
+
+	a, expires, err := sp.validate(res, requestID)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", ErrInvalidResponse, err)
+	}
+	if err := sp.consume(a.ID, expires); err != nil {
+		return nil, fmt.Errorf("%v: %v", ErrInvalidResponse, err)
+	}
+	return a, nil
+}
+
+// validate returns the assertion of a response and when it expires
+func (sp *ServiceProvider) validate(res *node, requestID string) (*Assertion, time.Time, error) {
+	now := sp.now()
+	skew := sp.ClockSkew
+	if skew == 0 {
+		skew = DefaultClockSkew
+	}
+
+	if !res.is(nsProtocol, "Response") {
+		return nil, time.Time{}, errors.New("not a Response")
+	}
+	if res.attr("Version") != "2.0" {
+		return nil, time.Time{}, errors.New("unsupported version")
+	}
+	if dest := res.attr("Destination"); dest != "" && dest != sp.ACSURL {
+		return nil, time.Time{}, fmt.Errorf("destination %s is not %s", dest, sp.ACSURL)
+	}
+	if res.attr("InResponseTo") != requestID {
+		return nil, time.Time{}, errors.New("response is not to the request")
+	}
+	if iss := res.element(nsAssertion, "Issuer"); iss != nil && iss.text() != sp.IDPEntityID {
+		return nil, time.Time{}, fmt.Errorf("issuer %s is not the identity provider", iss.text())
+	}
+	status := res.element(nsProtocol, "Status")
+	if status == nil {
+		return nil, time.Time{}, errors.New("missing Status")
+	}
+	if code := status.element(nsProtocol, "StatusCode"); code == nil || code.attr("Value") != statusSuccess {
+		msg := ""
+		if m := status.element(nsProtocol, "StatusMessage"); m != nil {
+			msg = m.text()
+		}
+		return nil, time.Time{}, fmt.Errorf("authentication failed: %s", msg)
+	}
+
+	signed := false
+	if err := verifySignature(res, sp.IDPCertificates); err == nil {
+		signed = true
+	} else if err != errNotSigned {
+		return nil, time.Time{}, fmt.Errorf("response signature: %v", err)
+	}
+
+	if len(res.elements(nsAssertion, "EncryptedAssertion")) > 0 {
+		return nil, time.Time{}, errors.New("encrypted assertions are not supported")
+	}
+	assertion := res.element(nsAssertion, "Assertion")
+	if assertion == nil {
+		return nil, time.Time{}, errors.New("response must have one Assertion")
+	}
+	if err := verifySignature(assertion, sp.IDPCertificates); err == nil {
+		signed = true
+	} else if err != errNotSigned {
+		return nil, time.Time{}, fmt.Errorf("assertion signature: %v", err)
+	}
+	if !signed {
+		return nil, time.Time{}, errors.New("neither the response nor the assertion is signed")
+	}
+
+	if iss := assertion.element(nsAssertion, "Issuer"); iss == nil || iss.text() != sp.IDPEntityID {
+		return nil, time.Time{}, errors.New("assertion is not issued by the identity provider")
+	}
+	a := &Assertion{
+		ID:         assertion.attr("ID"),
+		Attributes: map[string][]string{},
+	}
+	if a.ID == "" {
+		return nil, time.Time{}, errors.New("assertion has no ID")
+	}
+
+	subject := assertion.element(nsAssertion, "Subject")
+	if subject == nil {
+		return nil, time.Time{}, errors.New("missing Subject")
+	}
+	if nameID := subject.element(nsAssertion, "NameID"); nameID != nil {
+		a.NameID = nameID.text()
+	}
+	expires, err := sp.bearer(subject, requestID, now, skew)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	if conditions := assertion.element(nsAssertion, "Conditions"); conditions != nil {
+		if err := sp.conditions(conditions, now, skew); err != nil {
+			return nil, time.Time{}, err
+		}
+		if t, err := parseTime(conditions.attr("NotOnOrAfter")); err == nil && t.Before(expires) {
+			expires = t
+		}
+	}
+
+	for _, stmt := range assertion.elements(nsAssertion, "AttributeStatement") {
+		for _, attr := range stmt.elements(nsAssertion, "Attribute") {
+			values := []string{}
+			for _, v := range attr.elements(nsAssertion, "AttributeValue") {
+				values = append(values, v.text())
+			}
+			for _, name := range []string{attr.attr("Name"), attr.attr("FriendlyName")} {
+				if name != "" {
+					a.Attributes[name] = append(a.Attributes[name], values...)
+				}
+			}
+		}
+	}
+	return a, expires.Add(skew), nil
+}
+
+// bearer checks the bearer confirmation of a subject, and returns when it
+// expires
+func (sp *ServiceProvider) bearer(subject *node, requestID string, now time.Time, skew time.Duration) (time.Time, error) {
+	for _, c := range subject.elements(nsAssertion, "SubjectConfirmation") {
+		if c.attr("Method") != methodBearer {
+			continue
+		}
+		data := c.element(nsAssertion, "SubjectConfirmationData")
+		if data == nil {
+			continue
+		}
+		if data.attr("Recipient") != sp.ACSURL || data.attr("InResponseTo") != requestID {
+			continue
+		}
+		notOnOrAfter, err := parseTime(data.attr("NotOnOrAfter"))
+		if err != nil || !now.Add(-skew).Before(notOnOrAfter) {
+			continue
+		}
+		if notBefore, err := parseTime(data.attr("NotBefore")); err == nil && now.Add(skew).Before(notBefore) {
+			continue
+		}
+		return notOnOrAfter, nil
+	}
+	return time.Time{}, errors.New("no valid bearer subject confirmation")
+}
+
+// conditions checks the validity period and audience of an assertion
+func (sp *ServiceProvider) conditions(conditions *node, now time.Time, skew time.Duration) error {
+	if t, err := parseTime(conditions.attr("NotBefore")); err == nil && now.Add(skew).Before(t) {
+		return errors.New("assertion is not yet valid")
+	}
+	if t, err := parseTime(conditions.attr("NotOnOrAfter")); err == nil && !now.Add(-skew).Before(t) {
+		return errors.New("assertion has expired")
+	}
+	for _, r := range conditions.elements(nsAssertion, "AudienceRestriction") {
+		found := false
+		for _, audience := range r.elements(nsAssertion, "Audience") {
+			found = found || audience.text() == sp.EntityID
+		}
+		if !found {
+			return errors.New("assertion is not for this service provider")
+		}
+	}
+	return nil
+}
+
+// consume records an assertion ID until it expires, and fails when the ID
+// was already recorded
+func (sp *ServiceProvider) consume(id string, expires time.Time) error {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	now := sp.now()
+	if sp.seen == nil {
+		sp.seen = map[string]time.Time{}
+	}
+	for seen, t := range sp.seen {
+		if now.After(t) {
+			delete(sp.seen, seen)
+		}
+	}
+	if _, ok := sp.seen[id]; ok {
+		return fmt.Errorf("assertion %s was already used", id)
+	}
+	sp.seen[id] = expires
+	return nil
+}
+
+func (sp *ServiceProvider) now() time.Time {
+	if sp.Now != nil {
+		return sp.Now()
+	}
+	return time.Now().UTC()
+}
+
+func parseTime(s string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, s)
+}
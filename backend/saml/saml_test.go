@@ -0,0 +1,379 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var samlTime = time.Date(2020, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+func newIDPKey(t *testing.T) (*rsa.PrivateKey, *x509.Certificate) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    samlTime.Add(-time.Hour),
+		NotAfter:     samlTime.Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert
+}
+
+// sign inserts an enveloped signature of the element of an ID before its
+// end tag
+func sign(t *testing.T, doc, id, endTag string, key *rsa.PrivateKey) string {
+	root, err := parseXML([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	el := findID(root, id)
+	if el == nil {
+		t.Fatalf("no element %s", id)
+	}
+	data, err := canonicalize(el, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(data)
+
+	signedInfo := fmt.Sprintf(`<ds:SignedInfo><ds:CanonicalizationMethod Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/><ds:SignatureMethod Algorithm="http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"/><ds:Reference URI="#%s"><ds:Transforms><ds:Transform Algorithm="http://www.w3.org/2000/09/xmldsig#enveloped-signature"/><ds:Transform Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/></ds:Transforms><ds:DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"/><ds:DigestValue>%s</ds:DigestValue></ds:Reference></ds:SignedInfo>`,
+		id, base64.StdEncoding.EncodeToString(digest[:]))
+	si, err := parseXML([]byte(`<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#">` + signedInfo + `</ds:Signature>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := canonicalize(si.element(nsDSig, "SignedInfo"), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashed := sha256.Sum256(signed)
+	value, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sig := `<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#">` + signedInfo +
+		"<ds:SignatureValue>\n" + base64.StdEncoding.EncodeToString(value) + "\n</ds:SignatureValue></ds:Signature>"
+	return strings.Replace(doc, endTag, sig+endTag, 1)
+}
+
+func findID(n *node, id string) *node {
+	if n.attr("ID") == id {
+		return n
+	}
+	for _, c := range n.children {
+		if e, ok := c.(*node); ok {
+			if found := findID(e, id); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+// assertionOf cuts the assertion out of a response
+func assertionOf(doc string) string {
+	start := strings.Index(doc, "<saml:Assertion ")
+	end := strings.Index(doc, assertionEnd) + len(assertionEnd)
+	return doc[start:end]
+}
+
+type responseParams struct {
+	Audience     string
+	Recipient    string
+	InResponseTo string
+	NotOnOrAfter string
+	Assertion    string // Assertion replaces the assertion
+}
+
+func response(p responseParams) string {
+	if p.Audience == "" {
+		p.Audience = "https://cloudhub.example.com/oauth/saml/metadata"
+	}
+	if p.Recipient == "" {
+		p.Recipient = "https://cloudhub.example.com/oauth/saml/callback"
+	}
+	if p.InResponseTo == "" {
+		p.InResponseTo = "id-request"
+	}
+	if p.NotOnOrAfter == "" {
+		p.NotOnOrAfter = "2020-03-01T12:05:00Z"
+	}
+	if p.Assertion == "" {
+		p.Assertion = fmt.Sprintf(`<saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" ID="id-assertion" Version="2.0" IssueInstant="2020-03-01T12:00:00Z">
+    <saml:Issuer>https://idp.example.com</saml:Issuer>
+    <saml:Subject>
+      <saml:NameID Format="urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress">jdoe@example.com</saml:NameID>
+      <saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">
+        <saml:SubjectConfirmationData InResponseTo="%s" NotOnOrAfter="%s" Recipient="%s"/>
+      </saml:SubjectConfirmation>
+    </saml:Subject>
+    <saml:Conditions NotBefore="2020-03-01T11:59:00Z" NotOnOrAfter="%s">
+      <saml:AudienceRestriction><saml:Audience>%s</saml:Audience></saml:AudienceRestriction>
+    </saml:Conditions>
+    <saml:AttributeStatement>
+      <saml:Attribute Name="http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress" FriendlyName="email">
+        <saml:AttributeValue xsi:type="xs:string">John.Doe@example.com</saml:AttributeValue>
+      </saml:Attribute>
+      <saml:Attribute Name="groups">
+        <saml:AttributeValue xsi:type="xs:string">admins</saml:AttributeValue>
+        <saml:AttributeValue xsi:type="xs:string">developers</saml:AttributeValue>
+      </saml:Attribute>
+    </saml:AttributeStatement>
+  </saml:Assertion>`, p.InResponseTo, p.NotOnOrAfter, p.Recipient, p.NotOnOrAfter, p.Audience)
+	}
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="id-response" Version="2.0" IssueInstant="2020-03-01T12:00:00Z" Destination="https://cloudhub.example.com/oauth/saml/callback" InResponseTo="%s">
+  <saml:Issuer>https://idp.example.com</saml:Issuer>
+  <samlp:Status><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/></samlp:Status>
+  %s
+</samlp:Response>`, p.InResponseTo, p.Assertion)
+}
+
+const (
+	assertionEnd = "</saml:Assertion>"
+	responseEnd  = "</samlp:Response>"
+)
+
+func TestServiceProvider_ParseResponse(t *testing.T) {
+	key, cert := newIDPKey(t)
+	otherKey, _ := newIDPKey(t)
+
+	signedAssertion := func(p responseParams) string {
+		return sign(t, response(p), "id-assertion", assertionEnd, key)
+	}
+	want := &Assertion{
+		ID:     "id-assertion",
+		NameID: "jdoe@example.com",
+		Attributes: map[string][]string{
+			"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress": {"John.Doe@example.com"},
+			"email":  {"John.Doe@example.com"},
+			"groups": {"admins", "developers"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		doc     string
+		want    *Assertion
+		wantErr string
+	}{
+		{
+			name: "Signed assertion",
+			doc:  signedAssertion(responseParams{}),
+			want: want,
+		},
+		{
+			name: "Signed response",
+			doc:  sign(t, response(responseParams{}), "id-response", responseEnd, key),
+			want: want,
+		},
+		{
+			name:    "Unsigned",
+			doc:     response(responseParams{}),
+			wantErr: "neither the response nor the assertion is signed",
+		},
+		{
+			name:    "Signed by another key",
+			doc:     sign(t, response(responseParams{}), "id-assertion", assertionEnd, otherKey),
+			wantErr: "signature does not match",
+		},
+		{
+			name:    "Tampered after signing",
+			doc:     strings.Replace(signedAssertion(responseParams{}), "<saml:AttributeValue xsi:type=\"xs:string\">developers", "<saml:AttributeValue xsi:type=\"xs:string\">superadmins", 1),
+			wantErr: "digest of the signed element does not match",
+		},
+		{
+			name: "Signed assertion wrapped beside a forged one",
+			doc: response(responseParams{
+				Assertion: "<samlp:Extensions>" + assertionOf(signedAssertion(responseParams{})) + "</samlp:Extensions>" +
+					strings.Replace(assertionOf(response(responseParams{})), "jdoe@example.com", "admin@example.com", 1),
+			}),
+			wantErr: "neither the response nor the assertion is signed",
+		},
+		{
+			name:    "Another audience",
+			doc:     signedAssertion(responseParams{Audience: "https://other.example.com"}),
+			wantErr: "assertion is not for this service provider",
+		},
+		{
+			name:    "Another recipient",
+			doc:     signedAssertion(responseParams{Recipient: "https://other.example.com/acs"}),
+			wantErr: "no valid bearer subject confirmation",
+		},
+		{
+			name:    "Response to another request",
+			doc:     signedAssertion(responseParams{InResponseTo: "id-other"}),
+			wantErr: "response is not to the request",
+		},
+		{
+			name:    "Expired",
+			doc:     signedAssertion(responseParams{NotOnOrAfter: "2020-03-01T11:50:00Z"}),
+			wantErr: "no valid bearer subject confirmation",
+		},
+		{
+			name: "Encrypted assertion",
+			doc: response(responseParams{
+				Assertion: `<saml:EncryptedAssertion><xenc:EncryptedData xmlns:xenc="http://www.w3.org/2001/04/xmlenc#"/></saml:EncryptedAssertion>`,
+			}),
+			wantErr: "encrypted assertions are not supported",
+		},
+		{
+			name:    "SHA-1 signature",
+			doc:     strings.Replace(signedAssertion(responseParams{}), "xmldsig-more#rsa-sha256", "xmldsig#rsa-sha1", 1),
+			wantErr: "unsupported signature method",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sp := &ServiceProvider{
+				EntityID:        "https://cloudhub.example.com/oauth/saml/metadata",
+				ACSURL:          "https://cloudhub.example.com/oauth/saml/callback",
+				IDPEntityID:     "https://idp.example.com",
+				IDPSSOURL:       "https://idp.example.com/sso",
+				IDPCertificates: []*x509.Certificate{cert},
+				Now:             func() time.Time { return samlTime },
+			}
+			got, err := sp.ParseResponse(base64.StdEncoding.EncodeToString([]byte(tt.doc)), "id-request")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseResponse() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseResponse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseResponse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServiceProvider_ParseResponse_Replay(t *testing.T) {
+	key, cert := newIDPKey(t)
+	sp := &ServiceProvider{
+		EntityID:        "https://cloudhub.example.com/oauth/saml/metadata",
+		ACSURL:          "https://cloudhub.example.com/oauth/saml/callback",
+		IDPEntityID:     "https://idp.example.com",
+		IDPCertificates: []*x509.Certificate{cert},
+		Now:             func() time.Time { return samlTime },
+	}
+	res := base64.StdEncoding.EncodeToString([]byte(sign(t, response(responseParams{}), "id-assertion", assertionEnd, key)))
+
+	if _, err := sp.ParseResponse(res, "id-request"); err != nil {
+		t.Fatalf("ParseResponse() error = %v", err)
+	}
+	if _, err := sp.ParseResponse(res, "id-request"); err == nil || !strings.Contains(err.Error(), "already used") {
+		t.Errorf("ParseResponse() of a replayed assertion error = %v", err)
+	}
+}
+
+func TestServiceProvider_AuthnRequestURL(t *testing.T) {
+	sp := &ServiceProvider{
+		EntityID:  "https://cloudhub.example.com/oauth/saml/metadata",
+		ACSURL:    "https://cloudhub.example.com/oauth/saml/callback",
+		IDPSSOURL: "https://idp.example.com/sso?tenant=1",
+		Now:       func() time.Time { return samlTime },
+	}
+	raw, err := sp.AuthnRequestURL("id-request", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Host != "idp.example.com" || u.Query().Get("tenant") != "1" || u.Query().Get("RelayState") != "state" {
+		t.Errorf("AuthnRequestURL() = %s", raw)
+	}
+
+	deflated, err := base64.StdEncoding.DecodeString(u.Query().Get("SAMLRequest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(deflated)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<AuthnRequest xmlns="urn:oasis:names:tc:SAML:2.0:protocol" ID="id-request" Version="2.0" IssueInstant="2020-03-01T12:00:00Z" Destination="https://idp.example.com/sso?tenant=1" ProtocolBinding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST" AssertionConsumerServiceURL="https://cloudhub.example.com/oauth/saml/callback"><Issuer xmlns="urn:oasis:names:tc:SAML:2.0:assertion">https://cloudhub.example.com/oauth/saml/metadata</Issuer><NameIDPolicy Format="urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified" AllowCreate="true"></NameIDPolicy></AuthnRequest>`
+	if string(req) != want {
+		t.Errorf("AuthnRequestURL() request =\n%s\nwant\n%s", req, want)
+	}
+}
+
+func TestParseIDPMetadata(t *testing.T) {
+	_, cert := newIDPKey(t)
+	md := fmt.Sprintf(`<?xml version="1.0"?>
+<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" xmlns:ds="http://www.w3.org/2000/09/xmldsig#" entityID="https://idp.example.com">
+  <md:IDPSSODescriptor protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
+    <md:KeyDescriptor use="encryption"><ds:KeyInfo><ds:X509Data><ds:X509Certificate>bm90IGEgY2VydA==</ds:X509Certificate></ds:X509Data></ds:KeyInfo></md:KeyDescriptor>
+    <md:KeyDescriptor use="signing"><ds:KeyInfo><ds:X509Data><ds:X509Certificate>
+%s
+    </ds:X509Certificate></ds:X509Data></ds:KeyInfo></md:KeyDescriptor>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST" Location="https://idp.example.com/sso/post"/>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" Location="https://idp.example.com/sso/redirect"/>
+  </md:IDPSSODescriptor>
+</md:EntityDescriptor>`, base64.StdEncoding.EncodeToString(cert.Raw))
+
+	idp, err := ParseIDPMetadata([]byte(md))
+	if err != nil {
+		t.Fatalf("ParseIDPMetadata() error = %v", err)
+	}
+	if idp.EntityID != "https://idp.example.com" || idp.SSOURL != "https://idp.example.com/sso/redirect" {
+		t.Errorf("ParseIDPMetadata() = %+v", idp)
+	}
+	if len(idp.Certificates) != 1 || !idp.Certificates[0].Equal(cert) {
+		t.Errorf("ParseIDPMetadata() certificates = %v", idp.Certificates)
+	}
+
+	if _, err := ParseIDPMetadata([]byte(strings.Replace(md, "HTTP-Redirect", "SOAP", 1))); err == nil {
+		t.Error("ParseIDPMetadata() expected an error without an HTTP-Redirect SingleSignOnService")
+	}
+}
+
+func TestServiceProvider_Metadata(t *testing.T) {
+	sp := &ServiceProvider{
+		EntityID: "https://cloudhub.example.com/oauth/saml/metadata",
+		ACSURL:   "https://cloudhub.example.com/oauth/saml/callback",
+	}
+	md, err := sp.Metadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`entityID="https://cloudhub.example.com/oauth/saml/metadata"`,
+		`WantAssertionsSigned="true"`,
+		`<AssertionConsumerService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST" Location="https://cloudhub.example.com/oauth/saml/callback" index="1">`,
+	} {
+		if !strings.Contains(string(md), want) {
+			t.Errorf("Metadata() does not contain %s:\n%s", want, md)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package saml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const nsXML = "http://www.w3.org/XML/1998/namespace"
+
+// node is an element of a parsed document. Names keep their prefixes, as
+// canonicalization renders them; namespaces are resolved by lookup.
+type node struct {
+	parent   *node
+	prefix   string
+	local    string
+	attrs    []xml.Attr    // attrs are the raw attributes, including namespace declarations
+	children []interface{} // children are *node or string character data
+}
+
+// parseXML parses a document into nodes. Comments and processing
+// instructions are dropped; documents with a DTD are rejected.
+func parseXML(data []byte) (*node, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var root, cur *node
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &node{
+				parent: cur,
+				prefix: t.Name.Space,
+				local:  t.Name.Local,
+				attrs:  append([]xml.Attr{}, t.Attr...),
+			}
+			if cur != nil {
+				cur.children = append(cur.children, n)
+			} else if root != nil {
+				return nil, errors.New("more than one root element")
+			} else {
+				root = n
+			}
+			cur = n
+		case xml.EndElement:
+			if cur == nil || t.Name.Space != cur.prefix || t.Name.Local != cur.local {
+				return nil, fmt.Errorf("unexpected end element %s", t.Name.Local)
+			}
+			cur = cur.parent
+		case xml.CharData:
+			if cur != nil {
+				cur.children = append(cur.children, string(t))
+			}
+		case xml.Directive:
+			return nil, errors.New("DTDs are not supported")
+		}
+	}
+	if root == nil || cur != nil {
+		return nil, errors.New("incomplete document")
+	}
+	return root, nil
+}
+
+// namespace returns the URI bound to a prefix, "" being the default
+// namespace, in the scope of n
+func (n *node) namespace(prefix string) (string, bool) {
+	if prefix == "xml" {
+		return nsXML, true
+	}
+	for e := n; e != nil; e = e.parent {
+		for _, a := range e.attrs {
+			if (prefix == "" && a.Name.Space == "" && a.Name.Local == "xmlns") ||
+				(prefix != "" && a.Name.Space == "xmlns" && a.Name.Local == prefix) {
+				return a.Value, true
+			}
+		}
+	}
+	return "", prefix == ""
+}
+
+// is checks the namespace and local name of n
+func (n *node) is(ns, local string) bool {
+	uri, _ := n.namespace(n.prefix)
+	return n.local == local && uri == ns
+}
+
+// attr returns the value of an unprefixed attribute
+func (n *node) attr(name string) string {
+	for _, a := range n.attrs {
+		if a.Name.Space == "" && a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// elements returns the child elements of a name
+func (n *node) elements(ns, local string) []*node {
+	found := []*node{}
+	for _, c := range n.children {
+		if e, ok := c.(*node); ok && e.is(ns, local) {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+// element returns the only child element of a name, or nil
+func (n *node) element(ns, local string) *node {
+	if found := n.elements(ns, local); len(found) == 1 {
+		return found[0]
+	}
+	return nil
+}
+
+// text returns the character data of n, without surrounding whitespace
+func (n *node) text() string {
+	var b strings.Builder
+	for _, c := range n.children {
+		if s, ok := c.(string); ok {
+			b.WriteString(s)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func (n *node) qname() string {
+	if n.prefix == "" {
+		return n.local
+	}
+	return n.prefix + ":" + n.local
+}
+
+func isNamespaceDecl(a xml.Attr) bool {
+	return a.Name.Space == "xmlns" || (a.Name.Space == "" && a.Name.Local == "xmlns")
+}
+
+// canonicalize serializes n with Exclusive XML Canonicalization without
+// comments (https://www.w3.org/TR/xml-exc-c14n/). The prefixes of the
+// InclusiveNamespaces PrefixList are rendered wherever they are in scope;
+// exclude, such as an enveloped signature, is left out.
+func canonicalize(n *node, inclusive []string, exclude *node) ([]byte, error) {
+	var b bytes.Buffer
+	if err := writeCanonical(&b, n, map[string]string{}, inclusive, exclude); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// writeCanonical writes an element of the output; rendered are the
+// namespaces declared by its output ancestors
+func writeCanonical(b *bytes.Buffer, n *node, rendered map[string]string, inclusive []string, exclude *node) error {
+	// Visibly utilized prefixes
+	prefixes := map[string]bool{n.prefix: true}
+	for _, a := range n.attrs {
+		if !isNamespaceDecl(a) && a.Name.Space != "" {
+			prefixes[a.Name.Space] = true
+		}
+	}
+	for _, p := range inclusive {
+		if p == "#default" {
+			p = ""
+		}
+		if _, ok := n.namespace(p); ok {
+			prefixes[p] = true
+		}
+	}
+
+	type decl struct{ prefix, uri string }
+	decls := []decl{}
+	for p := range prefixes {
+		if p == "xml" {
+			continue
+		}
+		uri, ok := n.namespace(p)
+		if !ok {
+			return fmt.Errorf("prefix %s is not bound to a namespace", p)
+		}
+		if prev, ok := rendered[p]; ok && prev == uri {
+			continue
+		} else if !ok && p == "" && uri == "" {
+			continue
+		}
+		decls = append(decls, decl{p, uri})
+	}
+	sort.Slice(decls, func(i, j int) bool { return decls[i].prefix < decls[j].prefix })
+
+	type attr struct{ uri, local, qname, value string }
+	attrs := []attr{}
+	for _, a := range n.attrs {
+		if isNamespaceDecl(a) {
+			continue
+		}
+		at := attr{local: a.Name.Local, qname: a.Name.Local, value: a.Value}
+		if a.Name.Space != "" {
+			at.uri, _ = n.namespace(a.Name.Space)
+			at.qname = a.Name.Space + ":" + a.Name.Local
+		}
+		attrs = append(attrs, at)
+	}
+	sort.Slice(attrs, func(i, j int) bool {
+		if attrs[i].uri != attrs[j].uri {
+			return attrs[i].uri < attrs[j].uri
+		}
+		return attrs[i].local < attrs[j].local
+	})
+
+	b.WriteString("<" + n.qname())
+	if len(decls) > 0 {
+		inner := make(map[string]string, len(rendered)+len(decls))
+		for p, uri := range rendered {
+			inner[p] = uri
+		}
+		for _, d := range decls {
+			if d.prefix == "" {
+				b.WriteString(` xmlns="`)
+			} else {
+				b.WriteString(" xmlns:" + d.prefix + `="`)
+			}
+			b.WriteString(escapeAttr(d.uri) + `"`)
+			inner[d.prefix] = d.uri
+		}
+		rendered = inner
+	}
+	for _, a := range attrs {
+		b.WriteString(" " + a.qname + `="` + escapeAttr(a.value) + `"`)
+	}
+	b.WriteString(">")
+
+	for _, c := range n.children {
+		switch c := c.(type) {
+		case string:
+			b.WriteString(escapeText(c))
+		case *node:
+			if c == exclude {
+				continue
+			}
+			if err := writeCanonical(b, c, rendered, inclusive, exclude); err != nil {
+				return err
+			}
+		}
+	}
+	b.WriteString("</" + n.qname() + ">")
+	return nil
+}
+
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+func escapeAttr(s string) string {
+	return attrEscaper.Replace(s)
+}
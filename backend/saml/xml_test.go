@@ -0,0 +1,87 @@
+package saml
+
+import "testing"
+
+const c14nDocument = `<?xml version="1.0" encoding="UTF-8"?>
+<!-- comment -->
+<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" xmlns:unused="urn:unused" ID="_r1" Version="2.0" z="1" a="x&amp;y&lt;&quot;">
+  <saml:Issuer>https://idp.example.com</saml:Issuer>
+  <saml:Assertion xmlns="urn:default" ID="_a1" xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+    <saml:Subject><saml:NameID>jdoe@example.com</saml:NameID></saml:Subject>
+    <Plain b="2" xsi:type="xs:string" a="1">a &gt; b &amp; c<!-- c --></Plain>
+    <Empty/>
+    <inner xmlns=""><x xml:lang="en"/></inner>
+    <saml:AttributeValue xsi:type="xs:string"><![CDATA[<raw>]]></saml:AttributeValue>
+  </saml:Assertion>
+</samlp:Response>`
+
+func TestCanonicalize(t *testing.T) {
+	root, err := parseXML([]byte(c14nDocument))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertion := root.element(nsAssertion, "Assertion")
+
+	tests := []struct {
+		name      string
+		node      *node
+		inclusive []string
+		exclude   *node
+		want      string
+	}{
+		{
+			// As xmllint --exc-c14n, without comments
+			name: "Document",
+			node: root,
+			want: `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" ID="_r1" Version="2.0" a="x&amp;y&lt;&quot;" z="1">
+  <saml:Issuer xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion">https://idp.example.com</saml:Issuer>
+  <saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_a1">
+    <saml:Subject><saml:NameID>jdoe@example.com</saml:NameID></saml:Subject>
+    <Plain xmlns="urn:default" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" a="1" b="2" xsi:type="xs:string">a &gt; b &amp; c</Plain>
+    <Empty xmlns="urn:default"></Empty>
+    <inner><x xml:lang="en"></x></inner>
+    <saml:AttributeValue xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="xs:string">&lt;raw&gt;</saml:AttributeValue>
+  </saml:Assertion>
+</samlp:Response>`,
+		},
+		{
+			name:      "Element with inclusive namespaces and an excluded child",
+			node:      assertion,
+			inclusive: []string{"xs", "#default"},
+			exclude:   assertion.element(nsAssertion, "Subject"),
+			want: `<saml:Assertion xmlns="urn:default" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" xmlns:xs="http://www.w3.org/2001/XMLSchema" ID="_a1">
+    
+    <Plain xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" a="1" b="2" xsi:type="xs:string">a &gt; b &amp; c</Plain>
+    <Empty></Empty>
+    <inner xmlns=""><x xml:lang="en"></x></inner>
+    <saml:AttributeValue xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="xs:string">&lt;raw&gt;</saml:AttributeValue>
+  </saml:Assertion>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := canonicalize(tt.node, tt.inclusive, tt.exclude)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("canonicalize() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseXML_Invalid(t *testing.T) {
+	docs := []string{
+		`<!DOCTYPE r [<!ENTITY e "x">]><r>&e;</r>`,
+		`<a><b></a></b>`,
+		`<a></a><b></b>`,
+		`<a>`,
+		``,
+	}
+	for _, doc := range docs {
+		if _, err := parseXML([]byte(doc)); err == nil {
+			t.Errorf("parseXML(%q) expected an error", doc)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	kapa "github.com/snetsystems/cloudhub/backend/kapacitor"
+)
+
+type adoptionLinks struct {
+	Kapacitor string `json:"kapacitor"` // Kapacitor proxy link to the original task
+}
+
+type adoptionResponse struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Type   string `json:"type"`
+	kapa.Analysis
+	Links adoptionLinks `json:"links"`
+}
+
+type adoptionsResponse struct {
+	Tasks []adoptionResponse `json:"tasks"`
+}
+
+// KapacitorAdoptionsGet analyses every task of the kapacitor that is not
+// managed by CloudHub and reports how much of it maps into an alert rule
+func (s *Service) KapacitorAdoptionsGet(w http.ResponseWriter, r *http.Request) {
+	id, err := paramID("kid", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return
+	}
+
+	srcID, err := paramID("id", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	srv, err := s.Store.Servers(ctx).Get(ctx, id)
+	if err != nil || srv.SrcID != srcID {
+		notFound(w, id, s.Logger)
+		return
+	}
+
+	c := kapa.NewClient(srv.URL, srv.Username, srv.Password, srv.InsecureSkipVerify)
+	tasks, err := c.All(ctx)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, err.Error(), s.Logger)
+		return
+	}
+
+	res := adoptionsResponse{
+		Tasks: []adoptionResponse{},
+	}
+	for tid, task := range tasks {
+		if strings.HasPrefix(tid, kapa.Prefix) {
+			continue
+		}
+		res.Tasks = append(res.Tasks, adoptionResponse{
+			ID:       tid,
+			Status:   task.Rule.Status,
+			Type:     task.Rule.Type,
+			Analysis: kapa.Analyze(tid, task.Rule.TICKScript),
+			Links: adoptionLinks{
+				Kapacitor: fmt.Sprintf("/cloudhub/v1/sources/%d/kapacitors/%d/proxy?path=%s", srv.SrcID, srv.ID, url.QueryEscape(task.Href)),
+			},
+		})
+	}
+	sort.Slice(res.Tasks, func(i, j int) bool {
+		return res.Tasks[i].ID < res.Tasks[j].ID
+	})
+
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+type adoptionRequest struct {
+	ID         string              `json:"id"`
+	Rule       *cloudhub.AlertRule `json:"rule,omitempty"` // Rule replaces the analysed rule of the task
+	KeepScript bool                `json:"keepScript"`     // KeepScript re-owns the task without changing its TICKscript
+}
+
+type postAdoptionsRequest struct {
+	Tasks []adoptionRequest `json:"tasks"`
+}
+
+// Valid checks that every task to adopt is named
+func (p *postAdoptionsRequest) Valid() error {
+	if len(p.Tasks) == 0 {
+		return fmt.Errorf("at least one task is required")
+	}
+	for _, t := range p.Tasks {
+		if t.ID == "" {
+			return fmt.Errorf("task id required")
+		}
+	}
+	return nil
+}
+
+type adoptionResult struct {
+	ID     string      `json:"id"`               // ID of the original task
+	TaskID string      `json:"taskId,omitempty"` // TaskID is the new CloudHub ID of the task
+	Error  string      `json:"error,omitempty"`
+	Links  *alertLinks `json:"links,omitempty"`
+}
+
+type adoptionResultsResponse struct {
+	Results []adoptionResult `json:"results"`
+}
+
+// KapacitorAdoptionsPost renames tasks not created by CloudHub under the
+// CloudHub prefix. A task is either generated from its analysed rule, from a
+// rule given in the request, or keeps its TICKscript unchanged. Every task
+// reports its own result.
+func (s *Service) KapacitorAdoptionsPost(w http.ResponseWriter, r *http.Request) {
+	id, err := paramID("kid", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return
+	}
+
+	srcID, err := paramID("id", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	srv, err := s.Store.Servers(ctx).Get(ctx, id)
+	if err != nil || srv.SrcID != srcID {
+		notFound(w, id, s.Logger)
+		return
+	}
+
+	var req postAdoptionsRequest
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+	if err := req.Valid(); err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+
+	c := kapa.NewClient(srv.URL, srv.Username, srv.Password, srv.InsecureSkipVerify)
+	results := make([]adoptionResult, len(req.Tasks))
+	for i, t := range req.Tasks {
+		res := adoptionResult{
+			ID: t.ID,
+		}
+		task, err := s.adopt(r, c, t)
+		if err != nil {
+			res.Error = err.Error()
+		} else {
+			res.TaskID = task.ID
+			res.Links = &newAlertResponse(task, srv.SrcID, srv.ID).Links
+		}
+		results[i] = res
+	}
+
+	encodeJSON(w, http.StatusOK, adoptionResultsResponse{Results: results}, s.Logger)
+}
+
+func (s *Service) adopt(r *http.Request, c *kapa.Client, req adoptionRequest) (*kapa.Task, error) {
+	ctx := r.Context()
+	if req.KeepScript {
+		return c.Adopt(ctx, req.ID, cloudhub.AlertRule{})
+	}
+
+	if req.Rule != nil {
+		if err := ValidRuleRequest(*req.Rule); err != nil {
+			return nil, err
+		}
+		return c.Adopt(ctx, req.ID, *req.Rule)
+	}
+
+	task, err := c.Get(ctx, req.ID)
+	if err != nil {
+		return nil, err
+	}
+	analysis := kapa.Analyze(req.ID, task.Rule.TICKScript)
+	if !analysis.Adoptable {
+		return nil, fmt.Errorf("task %s cannot be mapped into an alert rule; adopt it keeping its TICKscript instead", req.ID)
+	}
+	return c.Adopt(ctx, req.ID, analysis.Rule)
+}
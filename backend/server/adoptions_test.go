@@ -0,0 +1,116 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+	"github.com/snetsystems/cloudhub/backend/server"
+)
+
+func TestService_KapacitorAdoptionsGet(t *testing.T) {
+	foreign := `
+stream
+	|from()
+		.database('telegraf')
+		.retentionPolicy('autogen')
+		.measurement('cpu')
+	|alert()
+		.crit(lambda: "usage_idle" < 10)
+`
+	// setup mock kapa API
+	kapaSrv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		tasks := []map[string]interface{}{}
+		for _, id := range []string{"cpu_alert", "cloudhub-v1-abc", "mem_alert"} {
+			tasks = append(tasks, map[string]interface{}{
+				"id":     id,
+				"script": foreign,
+				"status": "enabled",
+				"type":   "stream",
+				"link": map[string]interface{}{
+					"rel":  "self",
+					"href": "/kapacitor/v1/tasks/" + id,
+				},
+			})
+		}
+		if offset >= len(tasks) {
+			tasks = tasks[:0]
+		}
+		if err := json.NewEncoder(rw).Encode(map[string]interface{}{"tasks": tasks}); err != nil {
+			t.Error("Failed to encode JSON. err:", err)
+		}
+	}))
+	defer kapaSrv.Close()
+
+	svc := &server.Service{
+		Store: &mocks.Store{
+			ServersStore: &mocks.ServersStore{
+				GetF: func(ctx context.Context, ID int) (cloudhub.Server, error) {
+					return cloudhub.Server{
+						ID:    ID,
+						SrcID: 1,
+						URL:   kapaSrv.URL,
+					}, nil
+				},
+			},
+		},
+		Logger: &mocks.TestLogger{},
+	}
+
+	req := httptest.NewRequest("GET", "/cloudhub/v1/sources/1/kapacitors/1/adoptions", strings.NewReader(""))
+	req = req.WithContext(httprouter.WithParams(context.Background(), httprouter.Params{
+		{
+			Key:   "id",
+			Value: "1",
+		},
+		{
+			Key:   "kid",
+			Value: "1",
+		},
+	}))
+	rr := httptest.NewRecorder()
+
+	svc.KapacitorAdoptionsGet(rr, req)
+
+	resp := rr.Result()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("KapacitorAdoptionsGet() status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	var res struct {
+		Tasks []struct {
+			ID         string             `json:"id"`
+			Status     string             `json:"status"`
+			Confidence float64            `json:"confidence"`
+			Adoptable  bool               `json:"adoptable"`
+			Rule       cloudhub.AlertRule `json:"rule"`
+		} `json:"tasks"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Tasks) != 2 || res.Tasks[0].ID != "cpu_alert" || res.Tasks[1].ID != "mem_alert" {
+		t.Fatalf("KapacitorAdoptionsGet() returned %+v, want cpu_alert and mem_alert", res.Tasks)
+	}
+	task := res.Tasks[0]
+	if task.Status != "enabled" || task.Confidence != 1 || !task.Adoptable {
+		t.Errorf("KapacitorAdoptionsGet() task = %+v", task)
+	}
+	if task.Rule.Query == nil || task.Rule.Query.Measurement != "cpu" || task.Rule.TriggerValues.Value != "10" {
+		t.Errorf("KapacitorAdoptionsGet() rule = %+v", task.Rule)
+	}
+}
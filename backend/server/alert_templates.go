@@ -0,0 +1,463 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	kapa "github.com/snetsystems/cloudhub/backend/kapacitor"
+)
+
+// templateVarRe restricts alert template variable names so they can be
+// referenced as :name: within the rule
+var templateVarRe = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+type alertTemplateRequest struct {
+	Name        string                      `json:"name"`
+	Description string                      `json:"description"`
+	Rule        cloudhub.AlertRule          `json:"rule"`
+	Vars        []cloudhub.AlertTemplateVar `json:"vars"`
+}
+
+// Valid checks the variables of the template and that the rule can be
+// rendered once every variable has a value
+func (r *alertTemplateRequest) Valid() error {
+	if r.Name == "" {
+		return fmt.Errorf("alert template must have a name")
+	}
+
+	values := map[string]string{}
+	for _, v := range r.Vars {
+		if !templateVarRe.MatchString(v.Name) {
+			return fmt.Errorf("invalid alert template variable name %q", v.Name)
+		}
+		if _, ok := values[v.Name]; ok {
+			return fmt.Errorf("duplicate alert template variable %q", v.Name)
+		}
+		values[v.Name] = v.Name
+	}
+
+	tmpl := cloudhub.AlertTemplate{
+		Rule: r.Rule,
+		Vars: r.Vars,
+	}
+	if _, err := kapa.RenderTemplate(tmpl, values); err != nil {
+		return err
+	}
+	return nil
+}
+
+type alertTemplateLinks struct {
+	Self  string `json:"self"`
+	Apply string `json:"apply"`
+	Sync  string `json:"sync"`
+}
+
+type alertTemplateResponse struct {
+	cloudhub.AlertTemplate
+	Links alertTemplateLinks `json:"links"`
+}
+
+func newAlertTemplateResponse(t cloudhub.AlertTemplate) *alertTemplateResponse {
+	if t.Vars == nil {
+		t.Vars = []cloudhub.AlertTemplateVar{}
+	}
+	if t.Tasks == nil {
+		t.Tasks = []cloudhub.AlertTemplateTask{}
+	}
+
+	base := fmt.Sprintf("/cloudhub/v1/alert_templates/%s", t.ID)
+	return &alertTemplateResponse{
+		AlertTemplate: t,
+		Links: alertTemplateLinks{
+			Self:  base,
+			Apply: base + "/apply",
+			Sync:  base + "/sync",
+		},
+	}
+}
+
+type alertTemplatesResponse struct {
+	Links     selfLinks                `json:"links"`
+	Templates []*alertTemplateResponse `json:"templates"`
+}
+
+func newAlertTemplatesResponse(ts []cloudhub.AlertTemplate) *alertTemplatesResponse {
+	templates := make([]*alertTemplateResponse, len(ts))
+	for i, t := range ts {
+		templates[i] = newAlertTemplateResponse(t)
+	}
+
+	return &alertTemplatesResponse{
+		Links: selfLinks{
+			Self: "/cloudhub/v1/alert_templates",
+		},
+		Templates: templates,
+	}
+}
+
+// AlertTemplates returns all alert templates within the organization
+func (s *Service) AlertTemplates(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ts, err := s.Store.AlertTemplates(ctx).All(ctx)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, "Error loading alert templates", s.Logger)
+		return
+	}
+
+	res := newAlertTemplatesResponse(ts)
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+// AlertTemplateID returns a single alert template
+func (s *Service) AlertTemplateID(w http.ResponseWriter, r *http.Request) {
+	id, err := paramStr("id", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	t, err := s.Store.AlertTemplates(ctx).Get(ctx, id)
+	if err != nil {
+		notFound(w, id, s.Logger)
+		return
+	}
+
+	res := newAlertTemplateResponse(t)
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+// NewAlertTemplate adds a new alert template to the organization
+func (s *Service) NewAlertTemplate(w http.ResponseWriter, r *http.Request) {
+	var req alertTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+
+	if err := req.Valid(); err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	t, err := s.Store.AlertTemplates(ctx).Add(ctx, cloudhub.AlertTemplate{
+		Name:        req.Name,
+		Description: req.Description,
+		Rule:        req.Rule,
+		Vars:        req.Vars,
+	})
+	if err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+
+	res := newAlertTemplateResponse(t)
+	location(w, res.Links.Self)
+	encodeJSON(w, http.StatusCreated, res, s.Logger)
+}
+
+// ReplaceAlertTemplate replaces the rule and variables of an alert template.
+// Tasks already created from the template are left as is until synced.
+func (s *Service) ReplaceAlertTemplate(w http.ResponseWriter, r *http.Request) {
+	id, err := paramStr("id", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return
+	}
+
+	var req alertTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+
+	if err := req.Valid(); err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	t, err := s.Store.AlertTemplates(ctx).Get(ctx, id)
+	if err != nil {
+		notFound(w, id, s.Logger)
+		return
+	}
+
+	t.Name = req.Name
+	t.Description = req.Description
+	t.Rule = req.Rule
+	t.Vars = req.Vars
+	if err := s.Store.AlertTemplates(ctx).Update(ctx, t); err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+
+	res := newAlertTemplateResponse(t)
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+// RemoveAlertTemplate deletes an alert template. The kapacitor tasks created
+// from the template are kept.
+func (s *Service) RemoveAlertTemplate(w http.ResponseWriter, r *http.Request) {
+	id, err := paramStr("id", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	t, err := s.Store.AlertTemplates(ctx).Get(ctx, id)
+	if err != nil {
+		notFound(w, id, s.Logger)
+		return
+	}
+
+	if err := s.Store.AlertTemplates(ctx).Delete(ctx, t); err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type alertTemplateTarget struct {
+	SrcID  int               `json:"srcId,string"`
+	KapaID int               `json:"kapaId,string"`
+	Vars   map[string]string `json:"vars"` // Vars override the values given for all targets
+}
+
+type applyAlertTemplateRequest struct {
+	Vars    map[string]string     `json:"vars"`
+	Targets []alertTemplateTarget `json:"targets"`
+}
+
+// Valid checks that there are targets to apply the template to
+func (r *applyAlertTemplateRequest) Valid() error {
+	if len(r.Targets) == 0 {
+		return fmt.Errorf("at least one target is required")
+	}
+	return nil
+}
+
+// alertTemplateResult reports the outcome of a template against one kapacitor
+type alertTemplateResult struct {
+	SrcID  int               `json:"srcId,string"`
+	KapaID int               `json:"kapaId,string"`
+	TaskID string            `json:"taskId,omitempty"`
+	Vars   map[string]string `json:"vars"`
+	Error  string            `json:"error,omitempty"`
+	Links  *alertLinks       `json:"links,omitempty"`
+}
+
+type alertTemplateResultsResponse struct {
+	Results []alertTemplateResult `json:"results"`
+}
+
+// ApplyAlertTemplate creates a kapacitor task from the template for every
+// target and tracks the created tasks within the template. Targets the
+// template was already applied to have their task updated instead. A failing
+// target does not stop the others; its error is reported in its result.
+func (s *Service) ApplyAlertTemplate(w http.ResponseWriter, r *http.Request) {
+	id, err := paramStr("id", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return
+	}
+
+	var req applyAlertTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+
+	if err := req.Valid(); err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	t, err := s.Store.AlertTemplates(ctx).Get(ctx, id)
+	if err != nil {
+		notFound(w, id, s.Logger)
+		return
+	}
+
+	results := make([]alertTemplateResult, len(req.Targets))
+	for i, target := range req.Targets {
+		values := map[string]string{}
+		for k, v := range req.Vars {
+			values[k] = v
+		}
+		for k, v := range target.Vars {
+			values[k] = v
+		}
+
+		res := alertTemplateResult{
+			SrcID:  target.SrcID,
+			KapaID: target.KapaID,
+			Vars:   values,
+		}
+		applied := -1
+		var taskID string
+		for j, task := range t.Tasks {
+			if task.SrcID == target.SrcID && task.KapaID == target.KapaID {
+				applied, taskID = j, task.TaskID
+				break
+			}
+		}
+		task, err := s.applyAlertTemplate(r, t, target.SrcID, target.KapaID, taskID, values)
+		if err != nil {
+			res.Error = err.Error()
+			results[i] = res
+			continue
+		}
+
+		res.TaskID = task.ID
+		res.Links = &newAlertResponse(task, target.SrcID, target.KapaID).Links
+		results[i] = res
+
+		tracked := cloudhub.AlertTemplateTask{
+			SrcID:  target.SrcID,
+			KapaID: target.KapaID,
+			TaskID: task.ID,
+			Vars:   values,
+		}
+		if applied >= 0 {
+			t.Tasks[applied] = tracked
+		} else {
+			t.Tasks = append(t.Tasks, tracked)
+		}
+	}
+
+	if err := s.Store.AlertTemplates(ctx).Update(ctx, t); err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+
+	encodeJSON(w, http.StatusOK, alertTemplateResultsResponse{Results: results}, s.Logger)
+}
+
+// applyAlertTemplate updates the task taskID of a previous application of the
+// template, or creates a task when there is none or kapacitor no longer has
+// it
+func (s *Service) applyAlertTemplate(r *http.Request, t cloudhub.AlertTemplate, srcID, kapaID int, taskID string, values map[string]string) (*kapa.Task, error) {
+	ctx := r.Context()
+	if err := s.writableSource(ctx, srcID); err != nil {
+		return nil, err
+	}
+	srv, err := s.Store.Servers(ctx).Get(ctx, kapaID)
+	if err != nil || srv.SrcID != srcID {
+		return nil, fmt.Errorf("kapacitor %d not found for source %d", kapaID, srcID)
+	}
+
+	rule, err := kapa.RenderTemplate(t, values)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidRuleRequest(rule); err != nil {
+		return nil, err
+	}
+
+	c := kapa.NewClient(srv.URL, srv.Username, srv.Password, srv.InsecureSkipVerify)
+	if taskID != "" {
+		_, err := c.Get(ctx, taskID)
+		if err == nil {
+			rule.ID = taskID
+			return c.Update(ctx, c.Href(taskID), rule)
+		}
+		if err != cloudhub.ErrAlertNotFound {
+			return nil, err
+		}
+	}
+	rule.ID = ""
+	return c.Create(ctx, rule)
+}
+
+// writableSource returns an error unless the current user may write to a
+// source, which the tasks of its kapacitors alert on
+func (s *Service) writableSource(ctx context.Context, srcID int) error {
+	allowed, err := s.authorizer().SourceAllowed(ctx, srcID, cloudhub.PermissionWrite)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return fmt.Errorf("user is not authorized to write to source %d", srcID)
+	}
+	return nil
+}
+
+// SyncAlertTemplate re-renders every task created from the template with the
+// variables it was applied with and updates it in its kapacitor
+func (s *Service) SyncAlertTemplate(w http.ResponseWriter, r *http.Request) {
+	id, err := paramStr("id", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	t, err := s.Store.AlertTemplates(ctx).Get(ctx, id)
+	if err != nil {
+		notFound(w, id, s.Logger)
+		return
+	}
+
+	results := make([]alertTemplateResult, len(t.Tasks))
+	for i, task := range t.Tasks {
+		res := alertTemplateResult{
+			SrcID:  task.SrcID,
+			KapaID: task.KapaID,
+			TaskID: task.TaskID,
+			Vars:   task.Vars,
+		}
+		updated, err := s.syncAlertTemplateTask(r, t, task)
+		if err != nil {
+			res.Error = err.Error()
+		} else {
+			res.Links = &newAlertResponse(updated, task.SrcID, task.KapaID).Links
+		}
+		results[i] = res
+	}
+
+	encodeJSON(w, http.StatusOK, alertTemplateResultsResponse{Results: results}, s.Logger)
+}
+
+func (s *Service) syncAlertTemplateTask(r *http.Request, t cloudhub.AlertTemplate, task cloudhub.AlertTemplateTask) (*kapa.Task, error) {
+	ctx := r.Context()
+	if err := s.writableSource(ctx, task.SrcID); err != nil {
+		return nil, err
+	}
+	srv, err := s.Store.Servers(ctx).Get(ctx, task.KapaID)
+	if err != nil || srv.SrcID != task.SrcID {
+		return nil, fmt.Errorf("kapacitor %d not found for source %d", task.KapaID, task.SrcID)
+	}
+
+	// Variables removed from the template since the task was created are ignored
+	values := map[string]string{}
+	for _, v := range t.Vars {
+		if val, ok := task.Vars[v.Name]; ok {
+			values[v.Name] = val
+		}
+	}
+
+	rule, err := kapa.RenderTemplate(t, values)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidRuleRequest(rule); err != nil {
+		return nil, err
+	}
+
+	c := kapa.NewClient(srv.URL, srv.Username, srv.Password, srv.InsecureSkipVerify)
+	if _, err := c.Get(ctx, task.TaskID); err != nil {
+		return nil, err
+	}
+
+	rule.ID = task.TaskID
+	return c.Update(ctx, c.Href(task.TaskID), rule)
+}
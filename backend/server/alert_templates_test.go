@@ -0,0 +1,392 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+	"github.com/snetsystems/cloudhub/backend/organizations"
+	"github.com/snetsystems/cloudhub/backend/roles"
+	"github.com/snetsystems/cloudhub/backend/server"
+)
+
+func TestService_ApplyAlertTemplate(t *testing.T) {
+	// setup mock kapa API that records the created tasks
+	scripts := map[string]string{}
+	kapaSrv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/kapacitor/v1/tasks" {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var task map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&task); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		id := task["id"].(string)
+		scripts[id] = task["script"].(string)
+		task["link"] = map[string]interface{}{
+			"rel":  "self",
+			"href": "/kapacitor/v1/tasks/" + id,
+		}
+		if err := json.NewEncoder(rw).Encode(task); err != nil {
+			t.Error("Failed to encode JSON. err:", err)
+		}
+	}))
+	defer kapaSrv.Close()
+
+	var stored cloudhub.AlertTemplate
+	svc := &server.Service{
+		Store: &mocks.Store{
+			ServersStore: &mocks.ServersStore{
+				GetF: func(ctx context.Context, ID int) (cloudhub.Server, error) {
+					if ID != 2 {
+						return cloudhub.Server{}, cloudhub.ErrServerNotFound
+					}
+					return cloudhub.Server{
+						ID:    ID,
+						SrcID: 1,
+						URL:   kapaSrv.URL,
+					}, nil
+				},
+			},
+			AlertTemplatesStore: &mocks.AlertTemplatesStore{
+				GetF: func(ctx context.Context, ID string) (cloudhub.AlertTemplate, error) {
+					return cloudhub.AlertTemplate{
+						ID:   ID,
+						Name: "cpu high",
+						Rule: cloudhub.AlertRule{
+							Name:    "cpu high on :host:",
+							Trigger: "threshold",
+							Query: &cloudhub.QueryConfig{
+								Database:        "telegraf",
+								RetentionPolicy: "autogen",
+								Measurement:     "cpu",
+								Fields: []cloudhub.Field{
+									{
+										Value: "usage_user",
+										Type:  "field",
+									},
+								},
+								Tags: map[string][]string{
+									"host": {":host:"},
+								},
+								AreTagsAccepted: true,
+							},
+							TriggerValues: cloudhub.TriggerValues{
+								Operator: "greater than",
+								Value:    ":threshold:",
+							},
+						},
+						Vars: []cloudhub.AlertTemplateVar{
+							{
+								Name: "host",
+							},
+							{
+								Name:    "threshold",
+								Default: "90",
+							},
+						},
+					}, nil
+				},
+				UpdateF: func(ctx context.Context, tmpl cloudhub.AlertTemplate) error {
+					stored = tmpl
+					return nil
+				},
+			},
+		},
+		Logger: &mocks.TestLogger{},
+	}
+
+	body := `{
+		"vars": {"threshold": "80"},
+		"targets": [
+			{"srcId": "1", "kapaId": "2", "vars": {"host": "server01"}},
+			{"srcId": "1", "kapaId": "3", "vars": {"host": "server02"}},
+			{"srcId": "1", "kapaId": "2"}
+		]
+	}`
+	req := httptest.NewRequest("POST", "/cloudhub/v1/alert_templates/1/apply", strings.NewReader(body))
+	req = req.WithContext(httprouter.WithParams(context.Background(), httprouter.Params{
+		{
+			Key:   "id",
+			Value: "1",
+		},
+	}))
+	rr := httptest.NewRecorder()
+
+	svc.ApplyAlertTemplate(rr, req)
+
+	resp := rr.Result()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("ApplyAlertTemplate() status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	var res struct {
+		Results []struct {
+			SrcID  string `json:"srcId"`
+			KapaID string `json:"kapaId"`
+			TaskID string `json:"taskId"`
+			Error  string `json:"error"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Results) != 3 {
+		t.Fatalf("ApplyAlertTemplate() returned %d results, want 3", len(res.Results))
+	}
+
+	created := res.Results[0]
+	if created.Error != "" || created.TaskID == "" {
+		t.Fatalf("ApplyAlertTemplate() first target failed: %+v", created)
+	}
+	script := scripts[created.TaskID]
+	for _, want := range []string{"var crit = 80", "'server01'", "var name = 'cpu high on server01'"} {
+		if !strings.Contains(script, want) {
+			t.Errorf("ApplyAlertTemplate() script missing %q in:\n%s", want, script)
+		}
+	}
+
+	if want := "kapacitor 3 not found for source 1"; res.Results[1].Error != want {
+		t.Errorf("ApplyAlertTemplate() second target error = %q, want %q", res.Results[1].Error, want)
+	}
+	if want := `alert template variable "host" requires a value`; res.Results[2].Error != want {
+		t.Errorf("ApplyAlertTemplate() third target error = %q, want %q", res.Results[2].Error, want)
+	}
+
+	if len(stored.Tasks) != 1 {
+		t.Fatalf("ApplyAlertTemplate() tracked %d tasks, want 1", len(stored.Tasks))
+	}
+	if task := stored.Tasks[0]; task.TaskID != created.TaskID || task.KapaID != 2 || task.Vars["host"] != "server01" || task.Vars["threshold"] != "80" {
+		t.Errorf("ApplyAlertTemplate() tracked task = %+v", task)
+	}
+}
+
+func TestService_ApplyAlertTemplate_Reapply(t *testing.T) {
+	// setup mock kapa API with the task of a previous application, failing
+	// to answer for the task of another one
+	tasks := map[string]map[string]interface{}{
+		"cloudhub-v1-1": {"id": "cloudhub-v1-1", "type": "stream", "status": "disabled", "script": ""},
+	}
+	created := 0
+	kapaSrv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/kapacitor/v1/tasks/")
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/kapacitor/v1/tasks":
+			created++
+			var task map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&task); err != nil {
+				rw.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			id = task["id"].(string)
+			tasks[id] = task
+		case r.Method == http.MethodPatch && tasks[id] != nil:
+			var task map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&task); err != nil {
+				rw.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			tasks[id]["script"] = task["script"]
+		case r.Method == http.MethodGet && tasks[id] != nil:
+		case id == "cloudhub-v1-2":
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(`{"error":"task store unavailable"}`))
+			return
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+			rw.Write([]byte(`{"error":"no task exists"}`))
+			return
+		}
+
+		task := tasks[id]
+		task["link"] = map[string]interface{}{
+			"rel":  "self",
+			"href": "/kapacitor/v1/tasks/" + id,
+		}
+		if err := json.NewEncoder(rw).Encode(task); err != nil {
+			t.Error("Failed to encode JSON. err:", err)
+		}
+	}))
+	defer kapaSrv.Close()
+
+	var stored cloudhub.AlertTemplate
+	svc := &server.Service{
+		Store: &mocks.Store{
+			ServersStore: &mocks.ServersStore{
+				GetF: func(ctx context.Context, ID int) (cloudhub.Server, error) {
+					return cloudhub.Server{
+						ID:    ID,
+						SrcID: 1,
+						URL:   kapaSrv.URL,
+					}, nil
+				},
+			},
+			AlertTemplatesStore: &mocks.AlertTemplatesStore{
+				GetF: func(ctx context.Context, ID string) (cloudhub.AlertTemplate, error) {
+					return cloudhub.AlertTemplate{
+						ID:   ID,
+						Name: "cpu high",
+						Rule: cloudhub.AlertRule{
+							Name:    "cpu high on :host:",
+							Trigger: "threshold",
+							Query: &cloudhub.QueryConfig{
+								Database:        "telegraf",
+								RetentionPolicy: "autogen",
+								Measurement:     "cpu",
+								Fields: []cloudhub.Field{
+									{
+										Value: "usage_user",
+										Type:  "field",
+									},
+								},
+								Tags: map[string][]string{
+									"host": {":host:"},
+								},
+								AreTagsAccepted: true,
+							},
+							TriggerValues: cloudhub.TriggerValues{
+								Operator: "greater than",
+								Value:    "90",
+							},
+						},
+						Vars: []cloudhub.AlertTemplateVar{
+							{
+								Name: "host",
+							},
+						},
+						Tasks: []cloudhub.AlertTemplateTask{
+							{SrcID: 1, KapaID: 2, TaskID: "cloudhub-v1-1", Vars: map[string]string{"host": "server01"}},
+							{SrcID: 1, KapaID: 3, TaskID: "cloudhub-v1-2", Vars: map[string]string{"host": "server01"}},
+							{SrcID: 1, KapaID: 4, TaskID: "cloudhub-v1-3", Vars: map[string]string{"host": "server01"}},
+						},
+					}, nil
+				},
+				UpdateF: func(ctx context.Context, tmpl cloudhub.AlertTemplate) error {
+					stored = tmpl
+					return nil
+				},
+			},
+		},
+		Logger: &mocks.TestLogger{},
+	}
+
+	body := `{"vars": {"host": "server02"}, "targets": [{"srcId": "1", "kapaId": "2"}, {"srcId": "1", "kapaId": "3"}, {"srcId": "1", "kapaId": "4"}]}`
+	req := httptest.NewRequest("POST", "/cloudhub/v1/alert_templates/1/apply", strings.NewReader(body))
+	req = req.WithContext(httprouter.WithParams(context.Background(), httprouter.Params{
+		{
+			Key:   "id",
+			Value: "1",
+		},
+	}))
+	rr := httptest.NewRecorder()
+
+	svc.ApplyAlertTemplate(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("ApplyAlertTemplate() status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	var res struct {
+		Results []struct {
+			TaskID string `json:"taskId"`
+			Error  string `json:"error"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(rr.Result().Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Results) != 3 {
+		t.Fatalf("ApplyAlertTemplate() returned %d results, want 3", len(res.Results))
+	}
+
+	// The task kapacitor has is updated
+	if script, _ := tasks["cloudhub-v1-1"]["script"].(string); !strings.Contains(script, "var name = 'cpu high on server02'") {
+		t.Errorf("ApplyAlertTemplate() updated the task with:\n%s", script)
+	}
+	if task := stored.Tasks[0]; task.TaskID != "cloudhub-v1-1" || task.Vars["host"] != "server02" {
+		t.Errorf("ApplyAlertTemplate() tracked task = %+v", task)
+	}
+	// The task kapacitor fails to answer for is neither replaced nor untracked
+	if res.Results[1].Error == "" {
+		t.Errorf("ApplyAlertTemplate() result = %+v, want the error of kapacitor", res.Results[1])
+	}
+	if task := stored.Tasks[1]; task.TaskID != "cloudhub-v1-2" || task.Vars["host"] != "server01" {
+		t.Errorf("ApplyAlertTemplate() tracked task = %+v", task)
+	}
+	// The task kapacitor no longer has is created again
+	if created != 1 {
+		t.Errorf("ApplyAlertTemplate() created %d tasks, want 1", created)
+	}
+	if task := stored.Tasks[2]; task.TaskID == "cloudhub-v1-3" || task.TaskID != res.Results[2].TaskID {
+		t.Errorf("ApplyAlertTemplate() tracked task = %+v, want the created task", task)
+	}
+}
+
+func TestService_ApplyAlertTemplate_Policies(t *testing.T) {
+	tracked := false
+	svc := &server.Service{
+		Store: &mocks.Store{
+			// The source 1 is only written by the user 7
+			PoliciesStore: &mocks.PoliciesStore{
+				AllF: func(ctx context.Context) ([]cloudhub.Policy, error) {
+					return []cloudhub.Policy{
+						{Resource: cloudhub.PolicySource, ResourceID: "1", UserID: 7, Permission: cloudhub.PermissionWrite},
+					}, nil
+				},
+			},
+			AlertTemplatesStore: &mocks.AlertTemplatesStore{
+				GetF: func(ctx context.Context, ID string) (cloudhub.AlertTemplate, error) {
+					return cloudhub.AlertTemplate{
+						ID:    ID,
+						Name:  "cpu high",
+						Tasks: []cloudhub.AlertTemplateTask{{SrcID: 1, KapaID: 2, TaskID: "cloudhub-v1-1"}},
+					}, nil
+				},
+				UpdateF: func(ctx context.Context, tmpl cloudhub.AlertTemplate) error {
+					tracked = len(tmpl.Tasks) > 1
+					return nil
+				},
+			},
+		},
+		Logger: &mocks.TestLogger{},
+	}
+
+	editor := &cloudhub.User{ID: 8, Roles: []cloudhub.Role{{Organization: "1", Name: roles.EditorRoleName}}}
+	ctx := context.WithValue(context.Background(), organizations.ContextKey, "1")
+	ctx = context.WithValue(ctx, server.UserContextKey, editor)
+	ctx = context.WithValue(ctx, roles.ContextKey, roles.EditorRoleName)
+	ctx = httprouter.WithParams(ctx, httprouter.Params{{Key: "id", Value: "1"}})
+
+	want := "user is not authorized to write to source 1"
+	for name, h := range map[string]http.HandlerFunc{
+		"ApplyAlertTemplate": svc.ApplyAlertTemplate,
+		"SyncAlertTemplate":  svc.SyncAlertTemplate,
+	} {
+		req := httptest.NewRequest("POST", "/cloudhub/v1/alert_templates/1", strings.NewReader(`{"targets": [{"srcId": "1", "kapaId": "2"}]}`))
+		rr := httptest.NewRecorder()
+		h(rr, req.WithContext(ctx))
+
+		var res struct {
+			Results []struct {
+				Error string `json:"error"`
+			} `json:"results"`
+		}
+		if err := json.NewDecoder(rr.Result().Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Results) != 1 || res.Results[0].Error != want {
+			t.Errorf("%s() results = %+v, want the error %q", name, res.Results, want)
+		}
+	}
+	if tracked {
+		t.Error("ApplyAlertTemplate() tracked a task on a source the user may not write to")
+	}
+}
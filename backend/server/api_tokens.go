@@ -0,0 +1,331 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/oauth2"
+	"github.com/snetsystems/cloudhub/backend/roles"
+)
+
+const (
+	// apiTokenPrefix distinguishes API tokens from other bearer tokens
+	apiTokenPrefix = "chub_"
+	// maxAPITokenLifetime is the longest lifetime of an API token
+	maxAPITokenLifetime = 365 * 24 * time.Hour
+)
+
+type apiTokenContextKey string
+
+// APITokenContextKey is the context key of the API token authenticating a request
+const APITokenContextKey = apiTokenContextKey("apiToken")
+
+// hasAPITokenContext returns the API token authenticating a request, if any
+func hasAPITokenContext(ctx context.Context) (cloudhub.APIToken, bool) {
+	if ctx == nil {
+		return cloudhub.APIToken{}, false
+	}
+	t, ok := ctx.Value(APITokenContextKey).(cloudhub.APIToken)
+	return t, ok
+}
+
+// roleRanks orders the roles of an organization
+var roleRanks = map[string]int{
+	roles.MemberRoleName: 1,
+	roles.ViewerRoleName: 2,
+	roles.EditorRoleName: 3,
+	roles.AdminRoleName:  4,
+}
+
+// lowerRole returns the lower of two roles
+func lowerRole(a, b string) string {
+	if roleRanks[b] < roleRanks[a] {
+		return b
+	}
+	return a
+}
+
+// bearerToken returns the token of the Authorization header of a request
+func bearerToken(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	if len(h) < len("Bearer ") || !strings.EqualFold(h[:len("Bearer ")], "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(h[len("Bearer "):]), true
+}
+
+func hashAPITokenSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// validAPIToken returns the API token of a bearer token, and the principal
+// of its user in its organization
+func validAPIToken(ctx context.Context, store DataStore, bearer string, now time.Time) (cloudhub.APIToken, oauth2.Principal, error) {
+	errInvalid := errors.New("invalid API token")
+	if !strings.HasPrefix(bearer, apiTokenPrefix) {
+		return cloudhub.APIToken{}, oauth2.Principal{}, errInvalid
+	}
+	parts := strings.SplitN(strings.TrimPrefix(bearer, apiTokenPrefix), "_", 2)
+	if len(parts) != 2 {
+		return cloudhub.APIToken{}, oauth2.Principal{}, errInvalid
+	}
+
+	serverCtx := serverContext(ctx)
+	t, err := store.APITokens(serverCtx).Get(serverCtx, parts[0])
+	if err != nil {
+		return cloudhub.APIToken{}, oauth2.Principal{}, errInvalid
+	}
+	if subtle.ConstantTimeCompare([]byte(hashAPITokenSecret(parts[1])), []byte(t.Hash)) != 1 {
+		return cloudhub.APIToken{}, oauth2.Principal{}, errInvalid
+	}
+	if !now.Before(t.ExpiresAt) {
+		return cloudhub.APIToken{}, oauth2.Principal{}, errors.New("expired API token")
+	}
+
+	u, err := store.Users(serverCtx).Get(serverCtx, cloudhub.UserQuery{ID: &t.UserID})
+	if err != nil {
+		return cloudhub.APIToken{}, oauth2.Principal{}, fmt.Errorf("user of API token: %v", err)
+	}
+	if u.Deactivated {
+		return cloudhub.APIToken{}, oauth2.Principal{}, errors.New("user of API token is deactivated")
+	}
+	return t, oauth2.Principal{
+		Subject:      u.Name,
+		Issuer:       u.Provider,
+		Organization: t.Organization,
+		IssuedAt:     t.CreatedAt,
+		ExpiresAt:    t.ExpiresAt,
+	}, nil
+}
+
+type apiTokenRequest struct {
+	Name         string    `json:"name"`
+	Organization string    `json:"organization"`
+	Role         string    `json:"role"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
+
+func (r *apiTokenRequest) Valid(now time.Time) error {
+	if r.Name == "" {
+		return fmt.Errorf("name required on API token request body")
+	}
+	if _, ok := roleRanks[r.Role]; !ok {
+		return fmt.Errorf("Unknown role %s. Valid roles are 'member', 'viewer', 'editor' and 'admin'", r.Role)
+	}
+	if !r.ExpiresAt.After(now) {
+		return fmt.Errorf("expiresAt must be in the future")
+	}
+	if r.ExpiresAt.After(now.Add(maxAPITokenLifetime)) {
+		return fmt.Errorf("expiresAt must be within %v", maxAPITokenLifetime)
+	}
+	return nil
+}
+
+type apiTokenResponse struct {
+	cloudhub.APIToken
+	Token string    `json:"token,omitempty"` // Token is only returned on creation
+	Links selfLinks `json:"links"`
+}
+
+func newAPITokenResponse(t cloudhub.APIToken, base string) *apiTokenResponse {
+	return &apiTokenResponse{
+		APIToken: t,
+		Links: selfLinks{
+			Self: fmt.Sprintf("%s/%s", base, t.ID),
+		},
+	}
+}
+
+type apiTokensResponse struct {
+	Links  selfLinks           `json:"links"`
+	Tokens []*apiTokenResponse `json:"tokens"`
+}
+
+// currentUser returns the user of the principal of a request
+func (s *Service) currentUser(ctx context.Context) (*cloudhub.User, oauth2.Principal, error) {
+	p, err := getValidPrincipal(ctx)
+	if err != nil {
+		return nil, p, err
+	}
+	scheme, err := getScheme(ctx)
+	if err != nil {
+		return nil, p, err
+	}
+	serverCtx := serverContext(ctx)
+	u, err := s.Store.Users(serverCtx).Get(serverCtx, cloudhub.UserQuery{
+		Name:     &p.Subject,
+		Provider: &p.Issuer,
+		Scheme:   &scheme,
+	})
+	return u, p, err
+}
+
+// apiTokens responds with the API tokens of a user
+func (s *Service) apiTokens(w http.ResponseWriter, ctx context.Context, u *cloudhub.User, base string) {
+	serverCtx := serverContext(ctx)
+	tokens, err := s.Store.APITokens(serverCtx).All(serverCtx)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, err.Error(), s.Logger)
+		return
+	}
+
+	res := &apiTokensResponse{
+		Links:  selfLinks{Self: base},
+		Tokens: []*apiTokenResponse{},
+	}
+	for _, t := range tokens {
+		if t.UserID == u.ID {
+			res.Tokens = append(res.Tokens, newAPITokenResponse(t, base))
+		}
+	}
+	sort.Slice(res.Tokens, func(i, j int) bool {
+		return res.Tokens[i].CreatedAt.Before(res.Tokens[j].CreatedAt)
+	})
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+// newAPIToken creates an API token of a user in an organization with at
+// most the role of the user there, and responds with it. The token is only
+// returned in the response; just its hash is stored.
+func (s *Service) newAPIToken(w http.ResponseWriter, ctx context.Context, u *cloudhub.User, req apiTokenRequest, base string) {
+	if _, ok := hasAPITokenContext(ctx); ok {
+		Error(w, http.StatusForbidden, "API tokens cannot create API tokens", s.Logger)
+		return
+	}
+
+	now := time.Now().UTC()
+	if err := req.Valid(now); err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+
+	serverCtx := serverContext(ctx)
+	if req.Organization == "" {
+		org, err := s.Store.Organizations(serverCtx).DefaultOrganization(serverCtx)
+		if err != nil {
+			unknownErrorWithMessage(w, err, s.Logger)
+			return
+		}
+		req.Organization = org.ID
+	}
+	if _, err := s.Store.Organizations(serverCtx).Get(serverCtx, cloudhub.OrganizationQuery{ID: &req.Organization}); err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+
+	// The role of a token must not exceed the role of its user
+	if !u.SuperAdmin {
+		allowed := false
+		for _, role := range u.Roles {
+			if role.Organization == req.Organization && roleRanks[req.Role] <= roleRanks[role.Name] {
+				allowed = true
+			}
+		}
+		if !allowed {
+			Error(w, http.StatusForbidden, fmt.Sprintf("user does not have the role %s in organization %s", req.Role, req.Organization), s.Logger)
+			return
+		}
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+	secret := base64.RawURLEncoding.EncodeToString(b)
+
+	t, err := s.Store.APITokens(serverCtx).Add(serverCtx, cloudhub.APIToken{
+		Name:         req.Name,
+		UserID:       u.ID,
+		Organization: req.Organization,
+		Role:         req.Role,
+		Hash:         hashAPITokenSecret(secret),
+		CreatedAt:    now,
+		ExpiresAt:    req.ExpiresAt.UTC(),
+	})
+	if err != nil {
+		Error(w, http.StatusInternalServerError, err.Error(), s.Logger)
+		return
+	}
+
+	res := newAPITokenResponse(t, base)
+	res.Token = apiTokenPrefix + t.ID + "_" + secret
+	location(w, res.Links.Self)
+	encodeJSON(w, http.StatusCreated, res, s.Logger)
+}
+
+// removeAPIToken revokes an API token of a user
+func (s *Service) removeAPIToken(w http.ResponseWriter, ctx context.Context, u *cloudhub.User, id string) {
+	serverCtx := serverContext(ctx)
+	t, err := s.Store.APITokens(serverCtx).Get(serverCtx, id)
+	if err != nil || t.UserID != u.ID {
+		notFound(w, id, s.Logger)
+		return
+	}
+	if err := s.Store.APITokens(serverCtx).Delete(serverCtx, t); err != nil {
+		Error(w, http.StatusInternalServerError, err.Error(), s.Logger)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MeAPITokens lists the API tokens of the current user
+func (s *Service) MeAPITokens(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	u, _, err := s.currentUser(ctx)
+	if err != nil {
+		Error(w, http.StatusForbidden, err.Error(), s.Logger)
+		return
+	}
+
+	s.apiTokens(w, ctx, u, "/cloudhub/v1/me/tokens")
+}
+
+// NewMeAPIToken creates an API token of the current user, by default in the
+// organization the user is logged into
+func (s *Service) NewMeAPIToken(w http.ResponseWriter, r *http.Request) {
+	var req apiTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	u, p, err := s.currentUser(ctx)
+	if err != nil {
+		Error(w, http.StatusForbidden, err.Error(), s.Logger)
+		return
+	}
+	if req.Organization == "" {
+		req.Organization = p.Organization
+	}
+
+	s.newAPIToken(w, ctx, u, req, "/cloudhub/v1/me/tokens")
+}
+
+// RemoveMeAPIToken revokes an API token of the current user
+func (s *Service) RemoveMeAPIToken(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	u, _, err := s.currentUser(ctx)
+	if err != nil {
+		Error(w, http.StatusForbidden, err.Error(), s.Logger)
+		return
+	}
+
+	s.removeAPIToken(w, ctx, u, httprouter.GetParamFromContext(ctx, "id"))
+}
@@ -0,0 +1,355 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+	"github.com/snetsystems/cloudhub/backend/oauth2"
+	"github.com/snetsystems/cloudhub/backend/roles"
+)
+
+// apiTokensStore returns a DataStore of a user and of its API tokens
+func apiTokensStore(u *cloudhub.User, tokens map[string]cloudhub.APIToken) *mocks.Store {
+	return &mocks.Store{
+		UsersStore: &mocks.UsersStore{
+			GetF: func(ctx context.Context, q cloudhub.UserQuery) (*cloudhub.User, error) {
+				if (q.ID != nil && *q.ID == u.ID) || (q.Name != nil && *q.Name == u.Name) {
+					cp := *u
+					return &cp, nil
+				}
+				return nil, cloudhub.ErrUserNotFound
+			},
+		},
+		OrganizationsStore: &mocks.OrganizationsStore{
+			DefaultOrganizationF: func(ctx context.Context) (*cloudhub.Organization, error) {
+				return &cloudhub.Organization{ID: "0"}, nil
+			},
+			GetF: func(ctx context.Context, q cloudhub.OrganizationQuery) (*cloudhub.Organization, error) {
+				if *q.ID != "0" && *q.ID != "1" {
+					return nil, cloudhub.ErrOrganizationNotFound
+				}
+				return &cloudhub.Organization{ID: *q.ID}, nil
+			},
+		},
+		APITokensStore: &mocks.APITokensStore{
+			AllF: func(ctx context.Context) ([]cloudhub.APIToken, error) {
+				all := []cloudhub.APIToken{}
+				for _, t := range tokens {
+					all = append(all, t)
+				}
+				return all, nil
+			},
+			AddF: func(ctx context.Context, t cloudhub.APIToken) (cloudhub.APIToken, error) {
+				t.ID = fmt.Sprint(len(tokens) + 1)
+				tokens[t.ID] = t
+				return t, nil
+			},
+			DeleteF: func(ctx context.Context, t cloudhub.APIToken) error {
+				delete(tokens, t.ID)
+				return nil
+			},
+			GetF: func(ctx context.Context, id string) (cloudhub.APIToken, error) {
+				t, ok := tokens[id]
+				if !ok {
+					return cloudhub.APIToken{}, cloudhub.ErrAPITokenNotFound
+				}
+				return t, nil
+			},
+		},
+	}
+}
+
+func TestService_NewMeAPIToken(t *testing.T) {
+	editor := &cloudhub.User{
+		ID:       1,
+		Name:     "billietta",
+		Provider: "github",
+		Scheme:   "oauth2",
+		Roles:    []cloudhub.Role{{Organization: "1", Name: roles.EditorRoleName}},
+	}
+	expiresAt := time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339)
+
+	tests := []struct {
+		name       string
+		body       string
+		user       *cloudhub.User
+		viaToken   bool
+		wantStatus int
+	}{
+		{
+			name:       "Token with the role of the user",
+			body:       `{"name": "ci", "role": "editor", "expiresAt": "` + expiresAt + `"}`,
+			user:       editor,
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "Token with a lower role than the user",
+			body:       `{"name": "ci", "organization": "1", "role": "viewer", "expiresAt": "` + expiresAt + `"}`,
+			user:       editor,
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "Token with a higher role than the user",
+			body:       `{"name": "ci", "role": "admin", "expiresAt": "` + expiresAt + `"}`,
+			user:       editor,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Token in an organization of which the user is no member",
+			body:       `{"name": "ci", "organization": "0", "role": "viewer", "expiresAt": "` + expiresAt + `"}`,
+			user:       editor,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "SuperAdmin token in any organization",
+			body:       `{"name": "ci", "organization": "0", "role": "admin", "expiresAt": "` + expiresAt + `"}`,
+			user:       &cloudhub.User{ID: 1, Name: "billietta", Provider: "github", Scheme: "oauth2", SuperAdmin: true},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "Token without expiry",
+			body:       `{"name": "ci", "role": "viewer"}`,
+			user:       editor,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Token expiring too late",
+			body:       `{"name": "ci", "role": "viewer", "expiresAt": "2999-01-01T00:00:00Z"}`,
+			user:       editor,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Token created with a token",
+			body:       `{"name": "ci", "role": "viewer", "expiresAt": "` + expiresAt + `"}`,
+			user:       editor,
+			viaToken:   true,
+			wantStatus: http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := apiTokensStore(tt.user, map[string]cloudhub.APIToken{})
+			s := &Service{
+				Store:  store,
+				Logger: log.New(log.DebugLevel),
+			}
+
+			r := httptest.NewRequest("POST", "http://any.url", strings.NewReader(tt.body))
+			ctx := context.WithValue(context.Background(), oauth2.PrincipalKey, oauth2.Principal{
+				Subject:      "billietta",
+				Issuer:       "github",
+				Organization: "1",
+			})
+			if tt.viaToken {
+				ctx = context.WithValue(ctx, APITokenContextKey, cloudhub.APIToken{ID: "9"})
+			}
+			w := httptest.NewRecorder()
+			s.NewMeAPIToken(w, r.WithContext(ctx))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("NewMeAPIToken() = %v, want %v: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusCreated {
+				return
+			}
+
+			var res struct {
+				Token string `json:"token"`
+				Hash  string `json:"hash"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if res.Hash != "" {
+				t.Errorf("NewMeAPIToken() returned the hash of the token")
+			}
+			token, p, err := validAPIToken(context.Background(), store, res.Token, time.Now())
+			if err != nil {
+				t.Fatalf("validAPIToken() of the new token error = %v", err)
+			}
+			if token.UserID != 1 || p.Subject != "billietta" || p.Issuer != "github" {
+				t.Errorf("validAPIToken() = %+v, %+v", token, p)
+			}
+		})
+	}
+}
+
+func TestService_RemoveMeAPIToken(t *testing.T) {
+	me := &cloudhub.User{ID: 1, Name: "billietta", Provider: "github", Scheme: "oauth2"}
+	tokens := map[string]cloudhub.APIToken{
+		"1": {ID: "1", UserID: 1},
+		"2": {ID: "2", UserID: 2},
+	}
+	s := &Service{
+		Store:  apiTokensStore(me, tokens),
+		Logger: log.New(log.DebugLevel),
+	}
+
+	for _, tt := range []struct {
+		id         string
+		wantStatus int
+	}{
+		{id: "2", wantStatus: http.StatusNotFound},
+		{id: "1", wantStatus: http.StatusNoContent},
+		{id: "1", wantStatus: http.StatusNotFound},
+	} {
+		r := httptest.NewRequest("DELETE", "http://any.url", nil)
+		ctx := httprouter.WithParams(context.Background(), httprouter.Params{{Key: "id", Value: tt.id}})
+		ctx = context.WithValue(ctx, oauth2.PrincipalKey, oauth2.Principal{Subject: "billietta", Issuer: "github"})
+		w := httptest.NewRecorder()
+		s.RemoveMeAPIToken(w, r.WithContext(ctx))
+
+		if w.Code != tt.wantStatus {
+			t.Errorf("RemoveMeAPIToken(%s) = %v, want %v", tt.id, w.Code, tt.wantStatus)
+		}
+	}
+	if _, ok := tokens["2"]; !ok {
+		t.Errorf("RemoveMeAPIToken() removed a token of another user")
+	}
+}
+
+func TestAuthorizedToken_APIToken(t *testing.T) {
+	now := time.Now()
+	u := &cloudhub.User{ID: 1, Name: "billietta", Provider: "github", Scheme: "oauth2"}
+	store := apiTokensStore(u, map[string]cloudhub.APIToken{
+		"1": {ID: "1", UserID: 1, Organization: "1", Role: "viewer", Hash: hashAPITokenSecret("secret"), ExpiresAt: now.Add(time.Hour)},
+		"2": {ID: "2", UserID: 1, Organization: "1", Role: "viewer", Hash: hashAPITokenSecret("secret"), ExpiresAt: now.Add(-time.Hour)},
+	})
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+	}{
+		{name: "Valid token", authorization: "Bearer chub_1_secret", wantStatus: http.StatusOK},
+		{name: "Wrong secret", authorization: "Bearer chub_1_guess", wantStatus: http.StatusForbidden},
+		{name: "Expired token", authorization: "Bearer chub_2_secret", wantStatus: http.StatusForbidden},
+		{name: "Unknown token", authorization: "Bearer chub_3_secret", wantStatus: http.StatusForbidden},
+		{name: "Not an API token", authorization: "Bearer secret", wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var principal oauth2.Principal
+			var token cloudhub.APIToken
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				principal = r.Context().Value(oauth2.PrincipalKey).(oauth2.Principal)
+				token, _ = hasAPITokenContext(r.Context())
+				w.WriteHeader(http.StatusOK)
+			})
+			// The cookie authenticator rejects every request
+			a := &mocks.Authenticator{ValidateErr: fmt.Errorf("no cookie")}
+
+			r := httptest.NewRequest("GET", "http://any.url", nil)
+			r.Header.Set("Authorization", tt.authorization)
+			w := httptest.NewRecorder()
+			AuthorizedToken(a, store, log.New(log.DebugLevel), next).ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("AuthorizedToken() = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if principal.Subject != "billietta" || principal.Issuer != "github" || principal.Organization != "1" {
+				t.Errorf("AuthorizedToken() principal = %+v", principal)
+			}
+			if token.ID != "1" {
+				t.Errorf("AuthorizedToken() API token = %+v", token)
+			}
+		})
+	}
+}
+
+func TestAuthorizedUser_APIToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		user       *cloudhub.User
+		token      cloudhub.APIToken
+		role       string
+		wantStatus int
+		wantRole   string
+	}{
+		{
+			name:       "Token lowers the role of an editor",
+			user:       &cloudhub.User{ID: 1, Name: "billietta", Provider: "github", Scheme: "oauth2", Roles: []cloudhub.Role{{Organization: "1", Name: roles.EditorRoleName}}},
+			token:      cloudhub.APIToken{Organization: "1", Role: roles.ViewerRoleName},
+			role:       roles.ViewerRoleName,
+			wantStatus: http.StatusOK,
+			wantRole:   roles.ViewerRoleName,
+		},
+		{
+			name:       "Token does not authorize an editor beyond its role",
+			user:       &cloudhub.User{ID: 1, Name: "billietta", Provider: "github", Scheme: "oauth2", Roles: []cloudhub.Role{{Organization: "1", Name: roles.EditorRoleName}}},
+			token:      cloudhub.APIToken{Organization: "1", Role: roles.ViewerRoleName},
+			role:       roles.EditorRoleName,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Token does not raise the role of a user that was demoted",
+			user:       &cloudhub.User{ID: 1, Name: "billietta", Provider: "github", Scheme: "oauth2", Roles: []cloudhub.Role{{Organization: "1", Name: roles.ViewerRoleName}}},
+			token:      cloudhub.APIToken{Organization: "1", Role: roles.AdminRoleName},
+			role:       roles.AdminRoleName,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Token of a SuperAdmin has the role of the token",
+			user:       &cloudhub.User{ID: 1, Name: "billietta", Provider: "github", Scheme: "oauth2", SuperAdmin: true},
+			token:      cloudhub.APIToken{Organization: "1", Role: roles.EditorRoleName},
+			role:       roles.EditorRoleName,
+			wantStatus: http.StatusOK,
+			wantRole:   roles.EditorRoleName,
+		},
+		{
+			name:       "Token of a SuperAdmin does not authorize SuperAdmin routes",
+			user:       &cloudhub.User{ID: 1, Name: "billietta", Provider: "github", Scheme: "oauth2", SuperAdmin: true},
+			token:      cloudhub.APIToken{Organization: "1", Role: roles.AdminRoleName},
+			role:       roles.SuperAdminStatus,
+			wantStatus: http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var role interface{}
+			var superAdmin bool
+			next := func(w http.ResponseWriter, r *http.Request) {
+				role = r.Context().Value(roles.ContextKey)
+				superAdmin = hasSuperAdminContext(r.Context())
+				w.WriteHeader(http.StatusOK)
+			}
+
+			r := httptest.NewRequest("GET", "http://any.url", nil)
+			ctx := context.WithValue(r.Context(), oauth2.PrincipalKey, oauth2.Principal{
+				Subject:      "billietta",
+				Issuer:       "github",
+				Organization: "1",
+			})
+			ctx = context.WithValue(ctx, APITokenContextKey, tt.token)
+			w := httptest.NewRecorder()
+			store := apiTokensStore(tt.user, map[string]cloudhub.APIToken{})
+			AuthorizedUser(store, true, tt.role, log.New(log.DebugLevel), next)(w, r.WithContext(ctx))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("AuthorizedUser() = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if role != tt.wantRole {
+				t.Errorf("AuthorizedUser() role = %v, want %v", role, tt.wantRole)
+			}
+			if superAdmin {
+				t.Errorf("AuthorizedUser() authorized a token as a SuperAdmin")
+			}
+		})
+	}
+}
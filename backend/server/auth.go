@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"time"
 
 	cloudhub "github.com/snetsystems/cloudhub/backend"
 	"github.com/snetsystems/cloudhub/backend/oauth2"
@@ -21,8 +22,10 @@ func HasAuthorizedToken(auth oauth2.Authenticator, r *http.Request) (oauth2.Prin
 // AuthorizedToken extracts the token and validates; if valid the next handler
 // will be run.  The principal will be sent to the next handler via the request's
 // Context.  It is up to the next handler to determine if the principal has access.
+// A personal API token in an "Authorization: Bearer" header is validated against
+// the store instead, and is sent to the next handler via the Context as well.
 // On failure, will return http.StatusForbidden.
-func AuthorizedToken(auth oauth2.Authenticator, logger cloudhub.Logger, next http.Handler) http.HandlerFunc {
+func AuthorizedToken(auth oauth2.Authenticator, store DataStore, logger cloudhub.Logger, next http.Handler) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log := logger.
 			WithField("component", "token_auth").
@@ -31,6 +34,30 @@ func AuthorizedToken(auth oauth2.Authenticator, logger cloudhub.Logger, next htt
 			WithField("url", r.URL)
 
 		ctx := r.Context()
+		// API tokens are not extended; they expire when they were minted to
+		if bearer, ok := bearerToken(r); ok {
+			token, principal, err := validAPIToken(ctx, store, bearer, time.Now())
+			if err != nil {
+				log.Error(fmt.Sprintf("Invalid API token: %v", err))
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			// Requests of service accounts are logged apart from those of people
+			if principal.Issuer == ServiceAccountProvider {
+				log.
+					WithField("service_account", principal.Subject).
+					WithField("organization", principal.Organization).
+					WithField("token", token.ID).
+					Info("Request by service account")
+			}
+
+			ctx = context.WithValue(ctx, oauth2.PrincipalKey, principal)
+			ctx = context.WithValue(ctx, APITokenContextKey, token)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
 		// We do not check the authorization of the principal.  Those
 		// served further down the chain should do so.
 		principal, err := auth.Validate(ctx, r)
@@ -142,7 +169,7 @@ func AuthorizedUser(
 		}
 
 		// validate that the organization exists
-		_, err = store.Organizations(serverCtx).Get(serverCtx, cloudhub.OrganizationQuery{ID: &p.Organization})
+		org, err := store.Organizations(serverCtx).Get(serverCtx, cloudhub.OrganizationQuery{ID: &p.Organization})
 		if err != nil {
 			log.Error(fmt.Sprintf("Failed to retrieve organization %s from organizations store", p.Organization))
 			Error(w, http.StatusForbidden, "User is not authorized", logger)
@@ -161,11 +188,53 @@ func AuthorizedUser(
 			Error(w, http.StatusForbidden, "User is not authorized", logger)
 			return
 		}
-		// In particular this is used by sever/users.go so that we know when and when not to
-		// allow users to make someone a super admin
-		ctx = context.WithValue(ctx, UserContextKey, u)
+		if u.Deactivated {
+			log.Error("User is deactivated")
+			Error(w, http.StatusForbidden, "User is deactivated", logger)
+			return
+		}
+		// Admins and SuperAdmins of an organization requiring a second factor
+		// must enroll one before they act in the organization
+		missingTwoFactor := org.RequireTwoFactor && !u.TOTPEnabled && !u.ServiceAccount
+
+		token, withToken := hasAPITokenContext(ctx)
+		if withToken {
+			// A request with an API token has at most the role of the token,
+			// and never the status of a SuperAdmin
+			if token.Organization != p.Organization {
+				log.Error("API token does not belong to the organization of the principal")
+				Error(w, http.StatusForbidden, "User is not authorized", logger)
+				return
+			}
+			cp := *u
+			cp.SuperAdmin = false
+			ctx = context.WithValue(ctx, UserContextKey, &cp)
+
+			if u.SuperAdmin {
+				if !hasAuthorizedRole(&cloudhub.User{Roles: []cloudhub.Role{{Name: token.Role}}}, role) {
+					Error(w, http.StatusForbidden, "User is not authorized", logger)
+					return
+				}
+				if missingTwoFactor && token.Role == roles.AdminRoleName {
+					Error(w, http.StatusForbidden, errTwoFactorRequired, logger)
+					return
+				}
+				ctx = context.WithValue(ctx, roles.ContextKey, token.Role)
+				r = r.WithContext(ctx)
+				next(w, r)
+				return
+			}
+		} else {
+			// In particular this is used by sever/users.go so that we know when and when not to
+			// allow users to make someone a super admin
+			ctx = context.WithValue(ctx, UserContextKey, u)
+		}
 
 		if u.SuperAdmin {
+			if missingTwoFactor {
+				Error(w, http.StatusForbidden, errTwoFactorRequired, logger)
+				return
+			}
 			// To access resources (servers, sources, databases, layouts) within a DataStore,
 			// an organization and a role are required even if you are a super admin or are
 			// not using auth. Every user's current organization is set on context to filter
@@ -193,6 +262,15 @@ func AuthorizedUser(
 			return
 		}
 
+		if withToken && len(u.Roles) == 1 {
+			cp := *u
+			cp.Roles = []cloudhub.Role{{
+				Organization: u.Roles[0].Organization,
+				Name:         lowerRole(u.Roles[0].Name, token.Role),
+			}}
+			u = &cp
+		}
+
 		if hasAuthorizedRole(u, role) {
 			if len(u.Roles) != 1 {
 				msg := `User %d has too many role in organization. User: %#v.Please report this log at https://github.com/snetsystems/cloudhub/issues/new"`
@@ -200,6 +278,10 @@ func AuthorizedUser(
 				unknownErrorWithMessage(w, fmt.Errorf("please have administrator check logs and report error"), logger)
 				return
 			}
+			if missingTwoFactor && u.Roles[0].Name == roles.AdminRoleName {
+				Error(w, http.StatusForbidden, errTwoFactorRequired, logger)
+				return
+			}
 			// use the first role, since there should only ever be one
 			// for any particular organization and hasAuthorizedRole
 			// should ensure that at least one role for the org exists
@@ -54,7 +54,7 @@ func TestAuthorizedToken(t *testing.T) {
 		}
 
 		logger := clog.New(clog.DebugLevel)
-		handler := AuthorizedToken(a, logger, next)
+		handler := AuthorizedToken(a, &mocks.Store{}, logger, next)
 		handler.ServeHTTP(w, req)
 		if w.Code != test.Code {
 			t.Errorf("Status code expected: %d actual %d", test.Code, w.Code)
@@ -0,0 +1,247 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/roles"
+)
+
+// permissionRanks orders the permissions of policies
+var permissionRanks = map[string]int{
+	cloudhub.PermissionRead:  1,
+	cloudhub.PermissionWrite: 2,
+	cloudhub.PermissionAdmin: 3,
+}
+
+// rolePermissions are the permissions of the roles of an organization on
+// its dashboards and sources without policies
+var rolePermissions = map[string]string{
+	roles.ViewerRoleName: cloudhub.PermissionRead,
+	roles.EditorRoleName: cloudhub.PermissionWrite,
+	roles.AdminRoleName:  cloudhub.PermissionAdmin,
+}
+
+// capabilityRoles are the lowest roles with a capability without policies
+var capabilityRoles = map[string]string{
+	cloudhub.CapabilityTerminal:      roles.AdminRoleName,
+	cloudhub.CapabilitySalt:          roles.ViewerRoleName,
+	cloudhub.CapabilityDatabaseAdmin: roles.EditorRoleName,
+}
+
+// Authorizer decides the permissions of the current user on the dashboards
+// and sources of its organization, and its capabilities. Where there are no
+// policies, the role of the user decides as it always did; otherwise only
+// the policies do. Admins of the organization are always permitted, so that
+// they cannot lock themselves out.
+//
+// Authorizer expects the context of AuthorizedUser; without auth, everything
+// is permitted.
+type Authorizer struct {
+	Store  DataStore
+	Logger cloudhub.Logger
+}
+
+// authorizer returns the Authorizer of the policies of the DataStore of s
+func (s *Service) authorizer() *Authorizer {
+	return &Authorizer{Store: s.Store, Logger: s.Logger}
+}
+
+// requester returns the role of the current user, and whether it has one
+func requester(ctx context.Context) (string, bool) {
+	role, ok := ctx.Value(roles.ContextKey).(string)
+	return role, ok
+}
+
+// policies returns the policies of the organization of ctx on a resource
+func (a *Authorizer) policies(ctx context.Context, resource string) ([]cloudhub.Policy, error) {
+	all, err := a.Store.Policies(ctx).All(ctx)
+	if err != nil {
+		return nil, err
+	}
+	policies := []cloudhub.Policy{}
+	for _, p := range all {
+		if p.Resource == resource {
+			policies = append(policies, p)
+		}
+	}
+	return policies, nil
+}
+
+// grants reports whether a policy grants the current user with a role
+func grants(p cloudhub.Policy, u *cloudhub.User, role string) bool {
+	if p.Role != "" {
+		return roleRanks[role] >= roleRanks[p.Role]
+	}
+	return u != nil && u.ID == p.UserID
+}
+
+// loweredByToken reports whether the current user acts with an API token of
+// a lower role than its own. Such a token is never granted more than its
+// role would be without policies.
+func loweredByToken(ctx context.Context, role string) bool {
+	if _, ok := hasAPITokenContext(ctx); !ok {
+		return false
+	}
+	u, ok := hasUserContext(ctx)
+	if !ok {
+		return true
+	}
+	// AuthorizedUser only lets SuperAdmins without a role in the organization
+	// through, who are admins of it
+	own := roles.AdminRoleName
+	if org, ok := hasOrganizationContext(ctx); ok {
+		for _, r := range u.Roles {
+			if r.Organization == org {
+				own = r.Name
+			}
+		}
+	}
+	return roleRanks[role] < roleRanks[own]
+}
+
+// Permissions returns the permissions of the current user on the resources
+// of a kind by their ID. An empty permission means no access.
+func (a *Authorizer) Permissions(ctx context.Context, resource string) (func(id string) string, error) {
+	role, ok := requester(ctx)
+	if !ok || role == roles.AdminRoleName {
+		return func(string) string { return cloudhub.PermissionAdmin }, nil
+	}
+
+	policies, err := a.policies(ctx, resource)
+	if err != nil {
+		return nil, err
+	}
+	byID := map[string][]cloudhub.Policy{}
+	for _, p := range policies {
+		id := canonicalID(p.ResourceID)
+		byID[id] = append(byID[id], p)
+	}
+	u, _ := hasUserContext(ctx)
+	lowered := loweredByToken(ctx, role)
+
+	return func(id string) string {
+		policies, ok := byID[canonicalID(id)]
+		if !ok {
+			return rolePermissions[role]
+		}
+		permission := ""
+		for _, p := range policies {
+			if grants(p, u, role) && permissionRanks[p.Permission] > permissionRanks[permission] {
+				permission = p.Permission
+			}
+		}
+		if lowered && permissionRanks[permission] > permissionRanks[rolePermissions[role]] {
+			permission = rolePermissions[role]
+		}
+		return permission
+	}, nil
+}
+
+// canonicalID returns the ID of a dashboard or source as handlers parse it,
+// so that IDs such as 01 or +1 find the policies of 1
+func canonicalID(id string) string {
+	if n, err := strconv.Atoi(id); err == nil {
+		return strconv.Itoa(n)
+	}
+	return id
+}
+
+// Allowed reports whether the current user has at least a permission on a
+// resource
+func (a *Authorizer) Allowed(ctx context.Context, resource, id, permission string) (bool, error) {
+	permissions, err := a.Permissions(ctx, resource)
+	if err != nil {
+		return false, err
+	}
+	return permissionRanks[permissions(id)] >= permissionRanks[permission], nil
+}
+
+// SourceAllowed reports whether the current user has at least a permission
+// on a source, for handlers using sources other than the one of their route
+func (a *Authorizer) SourceAllowed(ctx context.Context, srcID int, permission string) (bool, error) {
+	return a.Allowed(ctx, cloudhub.PolicySource, strconv.Itoa(srcID), permission)
+}
+
+// DatabaseAdmin reports whether the current user may administer the
+// databases of a source, which needs both writing to it and the capability
+func (a *Authorizer) DatabaseAdmin(ctx context.Context, srcID int) (bool, error) {
+	allowed, err := a.SourceAllowed(ctx, srcID, cloudhub.PermissionWrite)
+	if err != nil || !allowed {
+		return false, err
+	}
+	return a.Capable(ctx, cloudhub.CapabilityDatabaseAdmin)
+}
+
+// Capable reports whether the current user has a capability
+func (a *Authorizer) Capable(ctx context.Context, capability string) (bool, error) {
+	role, ok := requester(ctx)
+	if !ok || role == roles.AdminRoleName {
+		return true, nil
+	}
+
+	minimum, ok := capabilityRoles[capability]
+	if !ok {
+		minimum = roles.AdminRoleName
+	}
+	byRole := roleRanks[role] >= roleRanks[minimum]
+
+	policies, err := a.policies(ctx, cloudhub.PolicyCapability)
+	if err != nil {
+		return false, err
+	}
+	u, _ := hasUserContext(ctx)
+	restricted, granted := false, false
+	for _, p := range policies {
+		if p.ResourceID != capability {
+			continue
+		}
+		restricted = true
+		granted = granted || grants(p, u, role)
+	}
+	if !restricted {
+		return byRole, nil
+	}
+	if loweredByToken(ctx, role) {
+		return granted && byRole, nil
+	}
+	return granted, nil
+}
+
+// EnsureResource ensures that the current user has at least a permission on
+// the resource whose ID is the route parameter param
+func (a *Authorizer) EnsureResource(resource, param, permission string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		id := httprouter.GetParamFromContext(ctx, param)
+		allowed, err := a.Allowed(ctx, resource, id, permission)
+		if err != nil {
+			unknownErrorWithMessage(w, err, a.Logger)
+			return
+		}
+		if !allowed {
+			Error(w, http.StatusForbidden, "User is not authorized", a.Logger)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// EnsureCapability ensures that the current user has a capability
+func (a *Authorizer) EnsureCapability(capability string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		capable, err := a.Capable(r.Context(), capability)
+		if err != nil {
+			unknownErrorWithMessage(w, err, a.Logger)
+			return
+		}
+		if !capable {
+			Error(w, http.StatusForbidden, "User is not authorized", a.Logger)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+	"github.com/snetsystems/cloudhub/backend/organizations"
+	"github.com/snetsystems/cloudhub/backend/roles"
+)
+
+// policiesDataStore returns a DataStore of policies
+func policiesDataStore(policies []cloudhub.Policy) *mocks.Store {
+	return &mocks.Store{
+		PoliciesStore: &mocks.PoliciesStore{
+			AllF: func(ctx context.Context) ([]cloudhub.Policy, error) {
+				return policies, nil
+			},
+		},
+	}
+}
+
+// authorizerContext returns the context of AuthorizedUser for a user with a
+// role in the organization 1
+func authorizerContext(u *cloudhub.User, role string, token *cloudhub.APIToken) context.Context {
+	ctx := context.WithValue(context.Background(), organizations.ContextKey, "1")
+	ctx = context.WithValue(ctx, UserContextKey, u)
+	ctx = context.WithValue(ctx, roles.ContextKey, role)
+	if token != nil {
+		ctx = context.WithValue(ctx, APITokenContextKey, *token)
+	}
+	return ctx
+}
+
+func TestAuthorizer_Permissions(t *testing.T) {
+	policies := []cloudhub.Policy{
+		// Dashboard 2 is restricted to the user 7 and to admins, and read by editors
+		{Resource: cloudhub.PolicyDashboard, ResourceID: "2", UserID: 7, Permission: cloudhub.PermissionWrite},
+		{Resource: cloudhub.PolicyDashboard, ResourceID: "2", Role: roles.EditorRoleName, Permission: cloudhub.PermissionRead},
+		// Dashboard 3 is administered by the user 7
+		{Resource: cloudhub.PolicyDashboard, ResourceID: "3", UserID: 7, Permission: cloudhub.PermissionAdmin},
+		// A grant on a source does not apply to a dashboard of the same ID
+		{Resource: cloudhub.PolicySource, ResourceID: "1", UserID: 7, Permission: cloudhub.PermissionAdmin},
+	}
+	member := &cloudhub.User{ID: 7, Roles: []cloudhub.Role{{Organization: "1", Name: roles.MemberRoleName}}}
+	editor := &cloudhub.User{ID: 8, Roles: []cloudhub.Role{{Organization: "1", Name: roles.EditorRoleName}}}
+	viewer := &cloudhub.User{ID: 7, Roles: []cloudhub.Role{{Organization: "1", Name: roles.ViewerRoleName}}}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		id   string
+		want string
+	}{
+		{
+			name: "Without auth",
+			ctx:  context.Background(),
+			id:   "2",
+			want: cloudhub.PermissionAdmin,
+		},
+		{
+			name: "Editor without policies",
+			ctx:  authorizerContext(editor, roles.EditorRoleName, nil),
+			id:   "1",
+			want: cloudhub.PermissionWrite,
+		},
+		{
+			name: "Member without policies",
+			ctx:  authorizerContext(member, roles.MemberRoleName, nil),
+			id:   "1",
+			want: "",
+		},
+		{
+			name: "Editor restricted by policies",
+			ctx:  authorizerContext(editor, roles.EditorRoleName, nil),
+			id:   "2",
+			want: cloudhub.PermissionRead,
+		},
+		{
+			name: "Editor not granted by policies",
+			ctx:  authorizerContext(editor, roles.EditorRoleName, nil),
+			id:   "3",
+			want: "",
+		},
+		{
+			name: "Editor not granted by policies on a non-canonical ID",
+			ctx:  authorizerContext(editor, roles.EditorRoleName, nil),
+			id:   "03",
+			want: "",
+		},
+		{
+			name: "Member granted by policies",
+			ctx:  authorizerContext(member, roles.MemberRoleName, nil),
+			id:   "2",
+			want: cloudhub.PermissionWrite,
+		},
+		{
+			name: "Admin is always permitted",
+			ctx:  authorizerContext(&cloudhub.User{ID: 9}, roles.AdminRoleName, nil),
+			id:   "3",
+			want: cloudhub.PermissionAdmin,
+		},
+		{
+			name: "API token with the role of its user",
+			ctx:  authorizerContext(viewer, roles.ViewerRoleName, &cloudhub.APIToken{Role: roles.ViewerRoleName}),
+			id:   "3",
+			want: cloudhub.PermissionAdmin,
+		},
+		{
+			name: "API token with a lower role than its user",
+			ctx:  authorizerContext(viewer, roles.MemberRoleName, &cloudhub.APIToken{Role: roles.MemberRoleName}),
+			id:   "3",
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Authorizer{Store: policiesDataStore(policies), Logger: log.New(log.DebugLevel)}
+			permissions, err := a.Permissions(tt.ctx, cloudhub.PolicyDashboard)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := permissions(tt.id); got != tt.want {
+				t.Errorf("Permissions()(%s) = %q, want %q", tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorizer_Capable(t *testing.T) {
+	member := &cloudhub.User{ID: 7, Roles: []cloudhub.Role{{Organization: "1", Name: roles.MemberRoleName}}}
+	editor := &cloudhub.User{ID: 8, Roles: []cloudhub.Role{{Organization: "1", Name: roles.EditorRoleName}}}
+
+	tests := []struct {
+		name       string
+		policies   []cloudhub.Policy
+		ctx        context.Context
+		capability string
+		want       bool
+	}{
+		{
+			name:       "Terminal is for admins without policies",
+			ctx:        authorizerContext(editor, roles.EditorRoleName, nil),
+			capability: cloudhub.CapabilityTerminal,
+			want:       false,
+		},
+		{
+			name:       "Databases are administered by editors without policies",
+			ctx:        authorizerContext(editor, roles.EditorRoleName, nil),
+			capability: cloudhub.CapabilityDatabaseAdmin,
+			want:       true,
+		},
+		{
+			name: "Terminal granted to a user",
+			policies: []cloudhub.Policy{
+				{Resource: cloudhub.PolicyCapability, ResourceID: cloudhub.CapabilityTerminal, UserID: 8},
+			},
+			ctx:        authorizerContext(editor, roles.EditorRoleName, nil),
+			capability: cloudhub.CapabilityTerminal,
+			want:       true,
+		},
+		{
+			name: "Database administration restricted to a user",
+			policies: []cloudhub.Policy{
+				{Resource: cloudhub.PolicyCapability, ResourceID: cloudhub.CapabilityDatabaseAdmin, UserID: 7},
+			},
+			ctx:        authorizerContext(editor, roles.EditorRoleName, nil),
+			capability: cloudhub.CapabilityDatabaseAdmin,
+			want:       false,
+		},
+		{
+			name: "Salt granted to viewers and above",
+			policies: []cloudhub.Policy{
+				{Resource: cloudhub.PolicyCapability, ResourceID: cloudhub.CapabilitySalt, Role: roles.ViewerRoleName},
+			},
+			ctx:        authorizerContext(member, roles.MemberRoleName, nil),
+			capability: cloudhub.CapabilitySalt,
+			want:       false,
+		},
+		{
+			name: "Capability of a user not used by its API token of a lower role",
+			policies: []cloudhub.Policy{
+				{Resource: cloudhub.PolicyCapability, ResourceID: cloudhub.CapabilityTerminal, UserID: 8},
+			},
+			ctx:        authorizerContext(editor, roles.ViewerRoleName, &cloudhub.APIToken{Role: roles.ViewerRoleName}),
+			capability: cloudhub.CapabilityTerminal,
+			want:       false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Authorizer{Store: policiesDataStore(tt.policies), Logger: log.New(log.DebugLevel)}
+			got, err := a.Capable(tt.ctx, tt.capability)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Capable(%s) = %v, want %v", tt.capability, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,556 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/flux"
+	"github.com/snetsystems/cloudhub/backend/influx"
+	"github.com/snetsystems/cloudhub/backend/prometheus"
+)
+
+// defaultDashboardTime is the time range of a dashboard when none is given
+const defaultDashboardTime = "now() - 1h"
+
+type cellQueriesRequest struct {
+	Source    string            `json:"source,omitempty"`    // Source is the ID of the source of queries and templates not naming one
+	Lower     string            `json:"lower,omitempty"`     // Lower bounds the time range (e.g. 'now() - 1h' or an RFC3339 time)
+	Upper     string            `json:"upper,omitempty"`     // Upper bounds the time range; now() if empty
+	Templates map[string]string `json:"templates,omitempty"` // Templates selects the values of template variables by name (e.g. {":host:": "server01"}); map templates are selected by key
+}
+
+type renderedQuery struct {
+	Query  string `json:"query"`           // Query is the InfluxQL, Flux or PromQL with every template rendered
+	Type   string `json:"type"`            // Type is the language of the query, influxql, flux or promql
+	Source string `json:"source"`          // Source is the ID of the source the query is sent to
+	DB     string `json:"db,omitempty"`    // DB is the database of an InfluxQL query
+	RP     string `json:"rp,omitempty"`    // RP is the retention policy of an InfluxQL query
+	Start  string `json:"start,omitempty"` // Start is the RFC3339 start of the range of a PromQL query
+	End    string `json:"end,omitempty"`   // End is the RFC3339 end of the range of a PromQL query
+	Step   string `json:"step,omitempty"`  // Step is the resolution of a PromQL query
+}
+
+type cellQueriesResponse struct {
+	Queries   []renderedQuery        `json:"queries"`
+	Templates []cloudhub.TemplateVar `json:"templates"` // Templates are the values the queries were rendered with
+}
+
+type cellResult struct {
+	renderedQuery
+	Results json.RawMessage `json:"results,omitempty"` // Results of an InfluxQL query, or data of a PromQL query
+	CSV     string          `json:"csv,omitempty"`     // CSV is the annotated CSV of a Flux query
+	Error   string          `json:"error,omitempty"`   // Error explains why the query failed
+}
+
+type cellResultsResponse struct {
+	Results []cellResult `json:"results"`
+}
+
+// templateError is a template that cannot be rendered as requested
+type templateError string
+
+func (e templateError) Error() string {
+	return string(e)
+}
+
+// sourceError is a source the current user may not query
+type sourceError string
+
+func (e sourceError) Error() string {
+	return string(e)
+}
+
+// readableSource returns a sourceError unless the current user may read
+// a source
+func (s *Service) readableSource(ctx context.Context, srcID string) error {
+	allowed, err := s.authorizer().Allowed(ctx, cloudhub.PolicySource, srcID, cloudhub.PermissionRead)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return sourceError(fmt.Sprintf("user is not authorized to read source %s", srcID))
+	}
+	return nil
+}
+
+// DashboardCellQueries renders the templates of the queries of a cell with
+// the requested time range and template values, as the browser would
+func (s *Service) DashboardCellQueries(w http.ResponseWriter, r *http.Request) {
+	res, ok := s.renderCell(w, r)
+	if !ok {
+		return
+	}
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+// ExecuteDashboardCell renders the queries of a cell and sends them to their
+// sources. Every query reports its own results or error.
+func (s *Service) ExecuteDashboardCell(w http.ResponseWriter, r *http.Request) {
+	res, ok := s.renderCell(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	user, org := queryGuardKeys(ctx)
+	results := make([]cellResult, len(res.Queries))
+	for i, q := range res.Queries {
+		results[i] = cellResult{renderedQuery: q}
+		if err := s.executeCellQuery(ctx, user, org, &results[i]); err != nil {
+			results[i].Error = err.Error()
+		}
+	}
+
+	encodeJSON(w, http.StatusOK, cellResultsResponse{Results: results}, s.Logger)
+}
+
+func (s *Service) executeCellQuery(ctx context.Context, user, org string, res *cellResult) error {
+	id, err := strconv.Atoi(res.Source)
+	if err != nil {
+		return err
+	}
+	src, err := s.Store.Sources(ctx).Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	// Only InfluxQL queries are checked against the cost limits
+	var release func()
+	switch res.Type {
+	case "flux", "promql":
+		release, err = s.QueryGuard.AcquireQuota(user, org)
+	default:
+		release, err = s.QueryGuard.Acquire(user, org, res.Query)
+	}
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	switch res.Type {
+	case "flux":
+		return s.executeFlux(ctx, src, res)
+	case "promql":
+		return s.executePromQL(ctx, src, res)
+	}
+
+	ts, err := s.TimeSeries(src)
+	if err != nil {
+		return err
+	}
+	if err := ts.Connect(ctx, &src); err != nil {
+		return err
+	}
+	q := cloudhub.Query{
+		Command: res.Query,
+		DB:      res.DB,
+		RP:      res.RP,
+	}
+	res.Results, _, err = s.QueryCache.Query(ctx, id, q, func() (cloudhub.Response, error) {
+		return ts.Query(ctx, q)
+	})
+	return err
+}
+
+// executeFlux sends a Flux query to an InfluxDB 2 source
+func (s *Service) executeFlux(ctx context.Context, src cloudhub.Source, res *cellResult) error {
+	u, err := url.ParseRequestURI(src.URL)
+	if err != nil {
+		return err
+	}
+	cli := &flux.Client{
+		URL:                u,
+		InsecureSkipVerify: src.InsecureSkipVerify,
+		Authorizer:         influx.DefaultAuthorization(&src),
+		Org:                src.InfluxOrg,
+	}
+	csv, err := cli.Query(ctx, res.Query)
+	if err != nil {
+		return err
+	}
+	res.CSV = string(csv)
+	return nil
+}
+
+// executePromQL sends a PromQL query over its range to a Prometheus source
+func (s *Service) executePromQL(ctx context.Context, src cloudhub.Source, res *cellResult) error {
+	if src.Type != cloudhub.Prometheus {
+		return fmt.Errorf("source %d is not a Prometheus source", src.ID)
+	}
+	start, err := time.Parse(time.RFC3339Nano, res.Start)
+	if err != nil {
+		return err
+	}
+	end, err := time.Parse(time.RFC3339Nano, res.End)
+	if err != nil {
+		return err
+	}
+	step, err := time.ParseDuration(res.Step)
+	if err != nil {
+		return err
+	}
+
+	cli := &prometheus.Client{
+		Logger: s.Logger,
+	}
+	if err := cli.Connect(ctx, &src); err != nil {
+		return err
+	}
+	data, err := cli.QueryRange(ctx, res.Query, start, end, step)
+	if err != nil {
+		return err
+	}
+	res.Results, err = data.MarshalJSON()
+	return err
+}
+
+// renderCell finds the cell of the request and renders its queries
+func (s *Service) renderCell(w http.ResponseWriter, r *http.Request) (cellQueriesResponse, bool) {
+	id, err := paramID("id", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return cellQueriesResponse{}, false
+	}
+
+	ctx := r.Context()
+	dash, err := s.Store.Dashboards(ctx).Get(ctx, cloudhub.DashboardID(id))
+	if err != nil {
+		notFound(w, id, s.Logger)
+		return cellQueriesResponse{}, false
+	}
+
+	cid := httprouter.GetParamFromContext(ctx, "cid")
+	var cell *cloudhub.DashboardCell
+	for i := range dash.Cells {
+		if dash.Cells[i].ID == cid {
+			cell = &dash.Cells[i]
+		}
+	}
+	if cell == nil {
+		notFound(w, id, s.Logger)
+		return cellQueriesResponse{}, false
+	}
+
+	var req cellQueriesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		invalidJSON(w, s.Logger)
+		return cellQueriesResponse{}, false
+	}
+	if req.Lower == "" {
+		req.Lower = defaultDashboardTime
+	}
+
+	res, err := s.renderCellQueries(ctx, dash.Templates, cell.Queries, req, time.Now())
+	if err != nil {
+		switch err.(type) {
+		case templateError:
+			invalidData(w, err, s.Logger)
+		case sourceError:
+			Error(w, http.StatusForbidden, err.Error(), s.Logger)
+		default:
+			Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+		}
+		return cellQueriesResponse{}, false
+	}
+	return res, true
+}
+
+func (s *Service) renderCellQueries(ctx context.Context, templates []cloudhub.Template, queries []cloudhub.DashboardQuery, req cellQueriesRequest, now time.Time) (cellQueriesResponse, error) {
+	res := cellQueriesResponse{
+		Queries:   make([]renderedQuery, 0, len(queries)),
+		Templates: []cloudhub.TemplateVar{},
+	}
+
+	// Templates are queried on the source of the request or of the first query
+	srcID := req.Source
+	for _, q := range queries {
+		if srcID != "" {
+			break
+		}
+		srcID = querySourceID(q.Source)
+	}
+
+	var commands []string
+	for _, q := range queries {
+		commands = append(commands, q.Command)
+	}
+	vars, err := s.resolveTemplates(ctx, templates, commands, req.Templates, srcID)
+	if err != nil {
+		return res, err
+	}
+	res.Templates = vars
+	dashVars := vars
+	vars = append(vars, influx.TimeRangeTemplates(req.Lower, req.Upper)...)
+
+	for _, q := range queries {
+		rq := renderedQuery{
+			Type:   q.Type,
+			Source: querySourceID(q.Source),
+			DB:     q.QueryConfig.Database,
+			RP:     q.QueryConfig.RetentionPolicy,
+		}
+		if rq.Source == "" {
+			rq.Source = req.Source
+		}
+		if rq.Source == "" {
+			return res, templateError("a source is required for queries not naming one")
+		}
+		// A dashboard does not grant its queries a source the user may not read
+		if err := s.readableSource(ctx, rq.Source); err != nil {
+			return res, err
+		}
+
+		switch q.Type {
+		case "promql":
+			rq.DB, rq.RP = "", ""
+			start, end, err := influx.TimeBounds(req.Lower, req.Upper, now)
+			if err != nil {
+				return res, templateError(err.Error())
+			}
+			step := prometheus.Step(start, end)
+			rq.Start = start.UTC().Format(time.RFC3339Nano)
+			rq.End = end.UTC().Format(time.RFC3339Nano)
+			rq.Step = step.String()
+			rq.Query = prometheus.RenderTemplates(q.Command, dashVars, step)
+		case "flux":
+			rq.DB, rq.RP = "", ""
+			if rq.Query, err = influx.RenderFlux(q.Command, req.Lower, req.Upper, now); err != nil {
+				return res, templateError(err.Error())
+			}
+		default:
+			rq.Type = "influxql"
+			if rq.Query, err = influx.TemplateReplace(q.Command, vars, now); err != nil {
+				return res, templateError(err.Error())
+			}
+		}
+		res.Queries = append(res.Queries, rq)
+	}
+	return res, nil
+}
+
+// querySourceID is the ID of a source link (e.g. /cloudhub/v1/sources/1)
+func querySourceID(link string) string {
+	id := path.Base(link)
+	if _, err := strconv.Atoi(id); err != nil {
+		return ""
+	}
+	return id
+}
+
+// templateValueTypes are the types of the values of each template type
+var templateValueTypes = map[string]string{
+	"csv":          "csv",
+	"map":          "map",
+	"constant":     "constant",
+	"text":         "constant",
+	"databases":    "database",
+	"measurements": "measurement",
+	"fieldKeys":    "fieldKey",
+	"tagKeys":      "tagKey",
+	"tagValues":    "tagValue",
+	"influxql":     "influxql",
+}
+
+// resolveTemplates selects a value of every template the queries use,
+// directly or through the queries of other templates. Templates are resolved
+// after the templates their queries use, querying srcID for their choices.
+func (s *Service) resolveTemplates(ctx context.Context, templates []cloudhub.Template, queries []string, selections map[string]string, srcID string) ([]cloudhub.TemplateVar, error) {
+	byVar := map[string]*cloudhub.Template{}
+	for i := range templates {
+		byVar[templates[i].Var] = &templates[i]
+	}
+	for tempVar := range selections {
+		if _, ok := byVar[tempVar]; !ok {
+			return nil, templateError(fmt.Sprintf("unknown template %s", tempVar))
+		}
+	}
+
+	// Order the templates used so that a template follows those it uses
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[string]int{}
+	var order []*cloudhub.Template
+	var visit func(text string) error
+	visit = func(text string) error {
+		for _, t := range templates {
+			if !strings.Contains(text, t.Var) {
+				continue
+			}
+			switch state[t.Var] {
+			case visited:
+				continue
+			case visiting:
+				return templateError(fmt.Sprintf("template %s uses itself", t.Var))
+			}
+			state[t.Var] = visiting
+			if t.Query != nil {
+				q := t.Query
+				if err := visit(q.Command + " " + q.DB + " " + q.Measurement + " " + q.TagKey); err != nil {
+					return err
+				}
+			}
+			state[t.Var] = visited
+			order = append(order, byVar[t.Var])
+		}
+		return nil
+	}
+	if err := visit(strings.Join(queries, "\n")); err != nil {
+		return nil, err
+	}
+
+	var ts cloudhub.TimeSeries
+	resolved := []cloudhub.TemplateVar{}
+	for _, t := range order {
+		choices := append([]cloudhub.TemplateValue{}, t.Values...)
+		if isQueryTemplate(*t) {
+			if ts == nil {
+				var err error
+				if ts, err = s.templateSource(ctx, srcID); err != nil {
+					return nil, err
+				}
+			}
+			values, err := s.queryTemplate(ctx, ts, *t, resolved)
+			if err != nil {
+				return nil, err
+			}
+			selected := ""
+			for _, v := range t.Values {
+				if v.Selected {
+					selected = v.Value
+				}
+			}
+			choices = choices[:0]
+			for _, v := range values {
+				choices = append(choices, cloudhub.TemplateValue{
+					Value:    v,
+					Type:     templateValueTypes[t.Type],
+					Selected: v == selected,
+				})
+			}
+		}
+
+		value, err := selectTemplateValue(*t, choices, selections)
+		if err != nil {
+			return nil, err
+		}
+		if value == nil {
+			continue
+		}
+		value.Selected = true
+		resolved = append(resolved, cloudhub.TemplateVar{
+			Var:    t.Var,
+			Values: []cloudhub.TemplateValue{*value},
+		})
+	}
+	return resolved, nil
+}
+
+// isQueryTemplate tells if the choices of a template come from its query
+func isQueryTemplate(t cloudhub.Template) bool {
+	if t.Query == nil || t.Query.Command == "" {
+		return false
+	}
+	switch t.Type {
+	case "databases", "measurements", "fieldKeys", "tagKeys", "tagValues", "influxql":
+		return true
+	}
+	return false
+}
+
+// selectTemplateValue picks the requested choice of a template, or the
+// selected one, or the first one. Text templates take any requested value.
+func selectTemplateValue(t cloudhub.Template, choices []cloudhub.TemplateValue, selections map[string]string) (*cloudhub.TemplateValue, error) {
+	want, requested := selections[t.Var]
+	if requested && t.Type == "text" {
+		return &cloudhub.TemplateValue{
+			Value: want,
+			Type:  "constant",
+		}, nil
+	}
+
+	var selected *cloudhub.TemplateValue
+	for i := range choices {
+		c := &choices[i]
+		if requested {
+			if (t.Type == "map" && c.Key == want) || (t.Type != "map" && c.Value == want) {
+				return c, nil
+			}
+			continue
+		}
+		if c.Selected && selected == nil {
+			selected = c
+		}
+	}
+	if requested {
+		return nil, templateError(fmt.Sprintf("%q is not a value of template %s", want, t.Var))
+	}
+	if selected == nil && len(choices) > 0 {
+		selected = &choices[0]
+	}
+	return selected, nil
+}
+
+// templateSource connects to the source template queries are sent to
+func (s *Service) templateSource(ctx context.Context, srcID string) (cloudhub.TimeSeries, error) {
+	id, err := strconv.Atoi(srcID)
+	if err != nil {
+		return nil, templateError("a source is required to query the values of templates")
+	}
+	if err := s.readableSource(ctx, srcID); err != nil {
+		return nil, err
+	}
+	src, err := s.Store.Sources(ctx).Get(ctx, id)
+	if err != nil {
+		return nil, templateError(fmt.Sprintf("source %d not found", id))
+	}
+	ts, err := s.TimeSeries(src)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to connect to source %d: %v", id, err)
+	}
+	if err := ts.Connect(ctx, &src); err != nil {
+		return nil, fmt.Errorf("Unable to connect to source %d: %v", id, err)
+	}
+	return ts, nil
+}
+
+// queryTemplate returns the choices of a template from its SHOW query
+func (s *Service) queryTemplate(ctx context.Context, ts cloudhub.TimeSeries, t cloudhub.Template, resolved []cloudhub.TemplateVar) ([]string, error) {
+	q := t.Query
+	command := q.Command
+	// Custom meta queries may use templates named like the fields of the query
+	if t.Type != "influxql" {
+		command = strings.Replace(command, ":database:", `"`+q.DB+`"`, 1)
+		command = strings.Replace(command, ":measurement:", `"`+q.Measurement+`"`, 1)
+		command = strings.Replace(command, ":tagKey:", `"`+q.TagKey+`"`, 1)
+	}
+	command, err := influx.TemplateReplace(command, resolved, time.Now())
+	if err != nil {
+		return nil, templateError(err.Error())
+	}
+
+	res, err := ts.Query(ctx, cloudhub.Query{
+		Command: command,
+		DB:      q.DB,
+		RP:      q.RP,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to query the values of template %s: %v", t.Var, err)
+	}
+	values, err := influx.MetaQueryValues(res)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to query the values of template %s: %v", t.Var, err)
+	}
+	return values, nil
+}
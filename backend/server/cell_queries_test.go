@@ -0,0 +1,297 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bouk/httprouter"
+	gocmp "github.com/google/go-cmp/cmp"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+	"github.com/snetsystems/cloudhub/backend/roles"
+)
+
+func newCellQueriesService(queries *[]cloudhub.Query) *Service {
+	dash := cloudhub.Dashboard{
+		ID: 1,
+		Templates: []cloudhub.Template{
+			{
+				TemplateVar: cloudhub.TemplateVar{
+					Var: ":host:",
+					Values: []cloudhub.TemplateValue{
+						{Value: "server02", Type: "tagValue", Selected: true},
+					},
+				},
+				ID:   "host",
+				Type: "tagValues",
+				Query: &cloudhub.TemplateQuery{
+					Command:     "SHOW TAG VALUES ON :database: FROM :measurement: WITH KEY=:tagKey:",
+					DB:          "telegraf",
+					Measurement: "cpu",
+					TagKey:      "host",
+				},
+			},
+			{
+				TemplateVar: cloudhub.TemplateVar{
+					Var: ":field:",
+					Values: []cloudhub.TemplateValue{
+						{Value: `"usage_user"`, Type: "csv", Selected: true},
+						{Value: `"usage_system"`, Type: "csv"},
+					},
+				},
+				ID:   "field",
+				Type: "csv",
+			},
+			{
+				TemplateVar: cloudhub.TemplateVar{
+					Var: ":region:",
+					Values: []cloudhub.TemplateValue{
+						{Key: "west", Value: "'us-west-1'", Type: "map", Selected: true},
+						{Key: "east", Value: "'us-east-1'", Type: "map"},
+					},
+				},
+				ID:   "region",
+				Type: "map",
+			},
+			{
+				TemplateVar: cloudhub.TemplateVar{
+					Var: ":unused:",
+				},
+				ID:    "unused",
+				Type:  "influxql",
+				Query: &cloudhub.TemplateQuery{Command: "SHOW DATABASES"},
+			},
+		},
+		Cells: []cloudhub.DashboardCell{
+			{
+				ID: "cell",
+				Queries: []cloudhub.DashboardQuery{
+					{
+						Command: `SELECT mean(:field:) FROM "cpu" WHERE time > :dashboardTime: AND "host" = :host: AND "region" = :region: GROUP BY time(:interval:)`,
+						Source:  "/cloudhub/v1/sources/1",
+						Type:    "influxql",
+						QueryConfig: cloudhub.QueryConfig{
+							Database:        "telegraf",
+							RetentionPolicy: "autogen",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	return &Service{
+		Store: &mocks.Store{
+			DashboardsStore: &mocks.DashboardsStore{
+				GetF: func(ctx context.Context, id cloudhub.DashboardID) (cloudhub.Dashboard, error) {
+					if id != dash.ID {
+						return cloudhub.Dashboard{}, cloudhub.ErrDashboardNotFound
+					}
+					return dash, nil
+				},
+			},
+			SourcesStore: &mocks.SourcesStore{
+				GetF: func(ctx context.Context, ID int) (cloudhub.Source, error) {
+					return cloudhub.Source{ID: ID}, nil
+				},
+			},
+		},
+		TimeSeriesClient: &mocks.TimeSeries{
+			ConnectF: func(ctx context.Context, src *cloudhub.Source) error {
+				return nil
+			},
+			QueryF: func(ctx context.Context, q cloudhub.Query) (cloudhub.Response, error) {
+				*queries = append(*queries, q)
+				if strings.HasPrefix(q.Command, "SHOW TAG VALUES") {
+					return mocks.NewResponse(`[{"statement_id":0,"series":[{"name":"cpu","columns":["key","value"],"values":[["host","server01"],["host","server02"]]}]}]`, nil), nil
+				}
+				return mocks.NewResponse(`[{"statement_id":0}]`, nil), nil
+			},
+		},
+		Logger: log.New(log.DebugLevel),
+	}
+}
+
+func postCell(h http.HandlerFunc, body string) *http.Response {
+	r := httptest.NewRequest("POST", "http://any.url", bytes.NewReader([]byte(body)))
+	r = r.WithContext(httprouter.WithParams(context.Background(), httprouter.Params{
+		{
+			Key:   "id",
+			Value: "1",
+		},
+		{
+			Key:   "cid",
+			Value: "cell",
+		},
+	}))
+	w := httptest.NewRecorder()
+	h(w, r)
+	return w.Result()
+}
+
+func TestService_DashboardCellQueries(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantQuery  string
+	}{
+		{
+			name:       "Selected values",
+			body:       `{"lower":"now() - 6h"}`,
+			wantStatus: http.StatusOK,
+			wantQuery:  `SELECT mean("usage_user") FROM "cpu" WHERE time > now() - 6h AND "host" = 'server02' AND "region" = 'us-west-1' GROUP BY time(60000ms)`,
+		},
+		{
+			name:       "Requested values",
+			body:       `{"templates":{":host:":"server01",":field:":"\"usage_system\"",":region:":"east"}}`,
+			wantStatus: http.StatusOK,
+			wantQuery:  `SELECT mean("usage_system") FROM "cpu" WHERE time > now() - 1h AND "host" = 'server01' AND "region" = 'us-east-1' GROUP BY time(10000ms)`,
+		},
+		{
+			name:       "Value not returned by the template query",
+			body:       `{"templates":{":host:":"server03"}}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Unknown template",
+			body:       `{"templates":{":nope:":"a"}}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var queries []cloudhub.Query
+			s := newCellQueriesService(&queries)
+
+			resp := postCell(s.DashboardCellQueries, tt.body)
+			body, _ := ioutil.ReadAll(resp.Body)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("DashboardCellQueries() = %d %s, want %d", resp.StatusCode, body, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var got cellQueriesResponse
+			if err := json.Unmarshal(body, &got); err != nil {
+				t.Fatal(err)
+			}
+			want := []renderedQuery{
+				{
+					Query:  tt.wantQuery,
+					Type:   "influxql",
+					Source: "1",
+					DB:     "telegraf",
+					RP:     "autogen",
+				},
+			}
+			if !gocmp.Equal(got.Queries, want) {
+				t.Errorf("DashboardCellQueries() = %s", gocmp.Diff(got.Queries, want))
+			}
+
+			// Only the templates of the cell are queried
+			if len(queries) != 1 || queries[0].Command != `SHOW TAG VALUES ON "telegraf" FROM "cpu" WITH KEY="host"` {
+				t.Errorf("DashboardCellQueries() queried %v", queries)
+			}
+		})
+	}
+}
+
+func TestService_ExecuteDashboardCell(t *testing.T) {
+	var queries []cloudhub.Query
+	s := newCellQueriesService(&queries)
+
+	resp := postCell(s.ExecuteDashboardCell, "")
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("ExecuteDashboardCell() = %d %s", resp.StatusCode, body)
+	}
+
+	var got cellResultsResponse
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Results) != 1 || string(got.Results[0].Results) != `[{"statement_id":0}]` || got.Results[0].Error != "" {
+		t.Errorf("ExecuteDashboardCell() = %s", body)
+	}
+	if len(queries) != 2 || queries[1].DB != "telegraf" || !strings.Contains(queries[1].Command, `"host" = 'server02'`) {
+		t.Errorf("ExecuteDashboardCell() queried %v", queries)
+	}
+}
+
+func TestService_renderCellQueries_PromQL(t *testing.T) {
+	var queries []cloudhub.Query
+	s := newCellQueriesService(&queries)
+	dash, _ := s.Store.Dashboards(context.Background()).Get(context.Background(), 1)
+
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	got, err := s.renderCellQueries(context.Background(), dash.Templates, []cloudhub.DashboardQuery{
+		{
+			Command: `rate(node_cpu_seconds_total{instance=":host:"}[:interval:])`,
+			Source:  "/cloudhub/v1/sources/2",
+			Type:    "promql",
+		},
+	}, cellQueriesRequest{Lower: "now() - 1h"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []renderedQuery{
+		{
+			Query:  `rate(node_cpu_seconds_total{instance="server02"}[10s])`,
+			Type:   "promql",
+			Source: "2",
+			Start:  "2020-01-01T11:00:00Z",
+			End:    "2020-01-01T12:00:00Z",
+			Step:   "10s",
+		},
+	}
+	if !gocmp.Equal(got.Queries, want) {
+		t.Errorf("renderCellQueries() = %s", gocmp.Diff(got.Queries, want))
+	}
+}
+
+func TestService_ExecuteDashboardCell_Policies(t *testing.T) {
+	editor := &cloudhub.User{ID: 8, Roles: []cloudhub.Role{{Organization: "1", Name: roles.EditorRoleName}}}
+
+	tests := []struct {
+		name   string
+		source string // source restricted to the user 7
+		body   string
+	}{
+		{name: "Source of the queries", source: "1", body: ""},
+		{name: "Source of the templates", source: "2", body: `{"source":"2"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var queries []cloudhub.Query
+			s := newCellQueriesService(&queries)
+			s.Store.(*mocks.Store).PoliciesStore = policiesDataStore([]cloudhub.Policy{
+				{Resource: cloudhub.PolicySource, ResourceID: tt.source, UserID: 7, Permission: cloudhub.PermissionRead},
+			}).PoliciesStore
+
+			r := httptest.NewRequest("POST", "http://any.url", strings.NewReader(tt.body))
+			ctx := httprouter.WithParams(authorizerContext(editor, roles.EditorRoleName, nil), httprouter.Params{
+				{Key: "id", Value: "1"},
+				{Key: "cid", Value: "cell"},
+			})
+			w := httptest.NewRecorder()
+			s.ExecuteDashboardCell(w, r.WithContext(ctx))
+			if w.Code != http.StatusForbidden {
+				t.Errorf("ExecuteDashboardCell() = %d %s, want %d", w.Code, w.Body.String(), http.StatusForbidden)
+			}
+			if len(queries) != 0 {
+				t.Errorf("ExecuteDashboardCell() queried %v", queries)
+			}
+		})
+	}
+}
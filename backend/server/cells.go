@@ -169,7 +169,7 @@ func HasCorrectQueryType(c *cloudhub.DashboardCell) error {
 		if c.Queries[i].Type == "" {
 			c.Queries[i].Type = "influxql"
 		}
-		if c.Queries[i].Type != "flux" && c.Queries[i].Type != "influxql" {
+		if !oneOf(c.Queries[i].Type, "flux", "influxql", "promql") {
 			return cloudhub.ErrInvalidCellQueryType
 		}
 	}
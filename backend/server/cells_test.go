@@ -1146,6 +1146,16 @@ func TestHasCorrectQueryType(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "A promql query type",
+			c: &cloudhub.DashboardCell{
+				Queries: []cloudhub.DashboardQuery{
+					{
+						Type: "promql",
+					},
+				},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
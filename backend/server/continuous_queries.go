@@ -0,0 +1,313 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/influx"
+)
+
+type cqLinks struct {
+	Self string `json:"self"` // Self link mapping to this resource
+}
+
+type cqResponse struct {
+	Name  string  `json:"name"`  // a unique string identifier for the continuous query within its database
+	Query string  `json:"query"` // the CREATE CONTINUOUS QUERY statement
+	Links cqLinks `json:"links"` // Links are URI locations related to the continuous query
+}
+
+// newCQResponse creates the response for the /cqs endpoints
+func newCQResponse(srcID int, db string, cq cloudhub.ContinuousQuery) cqResponse {
+	base := "/cloudhub/v1/sources"
+	return cqResponse{
+		Name:  cq.Name,
+		Query: cq.Query,
+		Links: cqLinks{
+			Self: fmt.Sprintf("%s/%d/dbs/%s/cqs/%s", base, srcID, db, cq.Name),
+		},
+	}
+}
+
+type cqsResponse struct {
+	ContinuousQueries []cqResponse `json:"continuousQueries"`
+}
+
+// cqBuilder builds a continuous query that downsamples a query config of
+// the data explorer into a retention policy.
+type cqBuilder struct {
+	QueryConfig cloudhub.QueryConfig `json:"queryConfig"`
+	influx.ContinuousQueryTarget
+}
+
+// cqRequest is a continuous query posted either as a CREATE CONTINUOUS
+// QUERY statement or as a builder.
+type cqRequest struct {
+	Name    string     `json:"name,omitempty"`    // Name defaults to the name of the statement
+	Query   string     `json:"query,omitempty"`   // Query is the CREATE CONTINUOUS QUERY statement
+	Builder *cqBuilder `json:"builder,omitempty"` // Builder creates the statement when there is no query
+}
+
+// ContinuousQueries lists continuous queries within a database
+func (s *Service) ContinuousQueries(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	srcID, err := paramID("id", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return
+	}
+
+	src, err := s.Store.Sources(ctx).Get(ctx, srcID)
+	if err != nil {
+		notFound(w, srcID, s.Logger)
+		return
+	}
+
+	dbsvc := s.Databases
+	if err = dbsvc.Connect(ctx, &src); err != nil {
+		msg := fmt.Sprintf("Unable to connect to source %d: %v", srcID, err)
+		Error(w, http.StatusBadRequest, msg, s.Logger)
+		return
+	}
+
+	db := httprouter.GetParamFromContext(ctx, "db")
+	cqs, err := dbsvc.AllCQ(ctx, db)
+	if err != nil {
+		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+		return
+	}
+
+	res := cqsResponse{
+		ContinuousQueries: make([]cqResponse, len(cqs)),
+	}
+	for i, cq := range cqs {
+		res.ContinuousQueries[i] = newCQResponse(srcID, db, cq)
+	}
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+// ContinuousQueryID returns a continuous query of a database
+func (s *Service) ContinuousQueryID(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	srcID, err := paramID("id", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return
+	}
+
+	src, err := s.Store.Sources(ctx).Get(ctx, srcID)
+	if err != nil {
+		notFound(w, srcID, s.Logger)
+		return
+	}
+
+	dbsvc := s.Databases
+	if err = dbsvc.Connect(ctx, &src); err != nil {
+		msg := fmt.Sprintf("Unable to connect to source %d: %v", srcID, err)
+		Error(w, http.StatusBadRequest, msg, s.Logger)
+		return
+	}
+
+	db := httprouter.GetParamFromContext(ctx, "db")
+	name := httprouter.GetParamFromContext(ctx, "cq")
+	cqs, err := dbsvc.AllCQ(ctx, db)
+	if err != nil {
+		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+		return
+	}
+	for _, cq := range cqs {
+		if cq.Name == name {
+			encodeJSON(w, http.StatusOK, newCQResponse(srcID, db, cq), s.Logger)
+			return
+		}
+	}
+	notFound(w, name, s.Logger)
+}
+
+// NewContinuousQuery creates a continuous query for a database. With the
+// dryRun parameter the statement is validated, or built, and returned
+// without being created.
+func (s *Service) NewContinuousQuery(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	srcID, err := paramID("id", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return
+	}
+
+	src, err := s.Store.Sources(ctx).Get(ctx, srcID)
+	if err != nil {
+		notFound(w, srcID, s.Logger)
+		return
+	}
+
+	dbsvc := s.Databases
+	if err = dbsvc.Connect(ctx, &src); err != nil {
+		msg := fmt.Sprintf("Unable to connect to source %d: %v", srcID, err)
+		Error(w, http.StatusBadRequest, msg, s.Logger)
+		return
+	}
+
+	var req cqRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+
+	db := httprouter.GetParamFromContext(ctx, "db")
+	posted, err := s.continuousQuery(r, &src, db, &req)
+	if err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+	if r.URL.Query().Get("dryRun") == "true" {
+		encodeJSON(w, http.StatusOK, newCQResponse(srcID, db, *posted), s.Logger)
+		return
+	}
+
+	cq, err := dbsvc.CreateCQ(ctx, db, posted)
+	if err != nil {
+		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+		return
+	}
+	res := newCQResponse(srcID, db, *cq)
+	location(w, res.Links.Self)
+	encodeJSON(w, http.StatusCreated, res, s.Logger)
+}
+
+// UpdateContinuousQuery replaces a continuous query of a database. The
+// name of the replacement defaults to the name of the replaced one.
+func (s *Service) UpdateContinuousQuery(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	srcID, err := paramID("id", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return
+	}
+
+	src, err := s.Store.Sources(ctx).Get(ctx, srcID)
+	if err != nil {
+		notFound(w, srcID, s.Logger)
+		return
+	}
+
+	dbsvc := s.Databases
+	if err = dbsvc.Connect(ctx, &src); err != nil {
+		msg := fmt.Sprintf("Unable to connect to source %d: %v", srcID, err)
+		Error(w, http.StatusBadRequest, msg, s.Logger)
+		return
+	}
+
+	var req cqRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+
+	db := httprouter.GetParamFromContext(ctx, "db")
+	name := httprouter.GetParamFromContext(ctx, "cq")
+	if req.Name == "" && req.Builder != nil {
+		req.Name = name
+	}
+	posted, err := s.continuousQuery(r, &src, db, &req)
+	if err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+
+	cq, err := dbsvc.UpdateCQ(ctx, db, name, posted)
+	if err != nil {
+		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+		return
+	}
+	encodeJSON(w, http.StatusOK, newCQResponse(srcID, db, *cq), s.Logger)
+}
+
+// DropContinuousQuery removes a continuous query from a database
+func (s *Service) DropContinuousQuery(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	srcID, err := paramID("id", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return
+	}
+
+	src, err := s.Store.Sources(ctx).Get(ctx, srcID)
+	if err != nil {
+		notFound(w, srcID, s.Logger)
+		return
+	}
+
+	dbsvc := s.Databases
+	if err = dbsvc.Connect(ctx, &src); err != nil {
+		msg := fmt.Sprintf("Unable to connect to source %d: %v", srcID, err)
+		Error(w, http.StatusBadRequest, msg, s.Logger)
+		return
+	}
+
+	db := httprouter.GetParamFromContext(ctx, "db")
+	name := httprouter.GetParamFromContext(ctx, "cq")
+	if err := dbsvc.DropCQ(ctx, db, name); err != nil {
+		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// continuousQuery builds the statement of a builder, with the default
+// retention policy of the source when the query config has none, and
+// validates it.
+func (s *Service) continuousQuery(r *http.Request, src *cloudhub.Source, db string, req *cqRequest) (*cloudhub.ContinuousQuery, error) {
+	if req.Builder != nil {
+		if req.Query != "" {
+			return nil, fmt.Errorf("query and builder cannot both be set")
+		}
+		qc := req.Builder.QueryConfig
+		if err := ValidateQueryConfig(&qc); err != nil {
+			return nil, err
+		}
+		if qc.Database == "" {
+			qc.Database = db
+		}
+		if err := s.DefaultRP(r.Context(), &qc, src); err != nil {
+			return nil, err
+		}
+		query, err := influx.BuildContinuousQuery(req.Name, db, &qc, req.Builder.ContinuousQueryTarget)
+		if err != nil {
+			return nil, err
+		}
+		req.Query = query
+	}
+	return ValidContinuousQueryRequest(db, req)
+}
+
+// ValidContinuousQueryRequest checks that the statement of a continuous
+// query parses as a CREATE CONTINUOUS QUERY on db, and names the
+// continuous query after it.
+func ValidContinuousQueryRequest(db string, req *cqRequest) (*cloudhub.ContinuousQuery, error) {
+	query := strings.TrimSpace(req.Query)
+	if query == "" {
+		return nil, fmt.Errorf("query or builder is required")
+	}
+	stmt, err := influx.ParseContinuousQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if stmt.Database != db {
+		return nil, fmt.Errorf("continuous query is on database %s, not %s", stmt.Database, db)
+	}
+	if req.Name != "" && req.Name != stmt.Name {
+		return nil, fmt.Errorf("name %s does not match the continuous query %s", req.Name, stmt.Name)
+	}
+	return &cloudhub.ContinuousQuery{Name: stmt.Name, Query: query}, nil
+}
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+)
+
+func cqService(created *cloudhub.ContinuousQuery) *Service {
+	cqs := []cloudhub.ContinuousQuery{
+		{Name: "cq_1h", Query: `CREATE CONTINUOUS QUERY cq_1h ON telegraf BEGIN SELECT mean(usage) INTO telegraf.rp_1y.cpu FROM telegraf.autogen.cpu GROUP BY time(1h) END`},
+	}
+	return &Service{
+		Store: &mocks.Store{
+			SourcesStore: &mocks.SourcesStore{
+				GetF: func(ctx context.Context, ID int) (cloudhub.Source, error) {
+					return cloudhub.Source{ID: ID}, nil
+				},
+			},
+		},
+		Databases: &mocks.Databases{
+			ConnectF: func(context.Context, *cloudhub.Source) error {
+				return nil
+			},
+			AllRPF: func(context.Context, string) ([]cloudhub.RetentionPolicy, error) {
+				return []cloudhub.RetentionPolicy{{Name: "rp_1y"}, {Name: "autogen", Default: true}}, nil
+			},
+			AllCQF: func(context.Context, string) ([]cloudhub.ContinuousQuery, error) {
+				return cqs, nil
+			},
+			CreateCQF: func(ctx context.Context, db string, cq *cloudhub.ContinuousQuery) (*cloudhub.ContinuousQuery, error) {
+				*created = *cq
+				return cq, nil
+			},
+			UpdateCQF: func(ctx context.Context, db, name string, cq *cloudhub.ContinuousQuery) (*cloudhub.ContinuousQuery, error) {
+				*created = *cq
+				return cq, nil
+			},
+		},
+		Logger: log.New(log.DebugLevel),
+	}
+}
+
+func TestService_ContinuousQueries(t *testing.T) {
+	var created cloudhub.ContinuousQuery
+	s := cqService(&created)
+
+	tests := []struct {
+		name    string
+		cq      string
+		handler func(http.ResponseWriter, *http.Request)
+		status  int
+		body    string
+	}{
+		{
+			name:    "All continuous queries of a database",
+			handler: s.ContinuousQueries,
+			status:  http.StatusOK,
+			body: `{"continuousQueries":[{"name":"cq_1h","query":"CREATE CONTINUOUS QUERY cq_1h ON telegraf BEGIN SELECT mean(usage) INTO telegraf.rp_1y.cpu FROM telegraf.autogen.cpu GROUP BY time(1h) END","links":{"self":"/cloudhub/v1/sources/1/dbs/telegraf/cqs/cq_1h"}}]}
+`,
+		},
+		{
+			name:    "A continuous query",
+			cq:      "cq_1h",
+			handler: s.ContinuousQueryID,
+			status:  http.StatusOK,
+			body: `{"name":"cq_1h","query":"CREATE CONTINUOUS QUERY cq_1h ON telegraf BEGIN SELECT mean(usage) INTO telegraf.rp_1y.cpu FROM telegraf.autogen.cpu GROUP BY time(1h) END","links":{"self":"/cloudhub/v1/sources/1/dbs/telegraf/cqs/cq_1h"}}
+`,
+		},
+		{
+			name:    "A missing continuous query",
+			cq:      "cq_1d",
+			handler: s.ContinuousQueryID,
+			status:  http.StatusNotFound,
+			body:    `{"code":404,"message":"ID cq_1d not found"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "http://any.url", nil)
+			r = r.WithContext(httprouter.WithParams(context.Background(), httprouter.Params{
+				{Key: "id", Value: "1"},
+				{Key: "db", Value: "telegraf"},
+				{Key: "cq", Value: tt.cq},
+			}))
+			tt.handler(w, r)
+
+			resp := w.Result()
+			body, _ := ioutil.ReadAll(resp.Body)
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if string(body) != tt.body {
+				t.Errorf("body =\n%s\nwant\n%s", body, tt.body)
+			}
+		})
+	}
+}
+
+func TestService_NewContinuousQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		body     string
+		status   int
+		location string
+		want     cloudhub.ContinuousQuery
+	}{
+		{
+			name:     "Statement",
+			body:     `{"query":"CREATE CONTINUOUS QUERY cq_1h ON telegraf BEGIN SELECT mean(usage) INTO rp_1y.cpu FROM cpu GROUP BY time(1h), * END"}`,
+			status:   http.StatusCreated,
+			location: "/cloudhub/v1/sources/1/dbs/telegraf/cqs/cq_1h",
+			want: cloudhub.ContinuousQuery{
+				Name:  "cq_1h",
+				Query: "CREATE CONTINUOUS QUERY cq_1h ON telegraf BEGIN SELECT mean(usage) INTO rp_1y.cpu FROM cpu GROUP BY time(1h), * END",
+			},
+		},
+		{
+			name:     "Builder with the default retention policy",
+			body:     `{"name":"mem_1h","builder":{"queryConfig":{"measurement":"mem","fields":[{"value":"max","type":"func","args":[{"value":"used","type":"field"}]}],"tags":{},"groupBy":{"time":"1h","tags":["host"]}},"rp":"rp_1y"}}`,
+			status:   http.StatusCreated,
+			location: "/cloudhub/v1/sources/1/dbs/telegraf/cqs/mem_1h",
+			want: cloudhub.ContinuousQuery{
+				Name:  "mem_1h",
+				Query: "CREATE CONTINUOUS QUERY mem_1h ON telegraf BEGIN SELECT max(used) AS max_used INTO telegraf.rp_1y.mem FROM telegraf.autogen.mem GROUP BY time(1h), host END",
+			},
+		},
+		{
+			name:   "Dry run of a builder is not created",
+			query:  "?dryRun=true",
+			body:   `{"name":"mem_1h","builder":{"queryConfig":{"measurement":"mem","fields":[{"value":"max","type":"func","args":[{"value":"used","type":"field"}]}],"tags":{},"groupBy":{"time":"1h","tags":[]}},"rp":"rp_1y"}}`,
+			status: http.StatusOK,
+		},
+		{
+			name:   "Statement on another database",
+			body:   `{"query":"CREATE CONTINUOUS QUERY cq_1h ON _internal BEGIN SELECT mean(usage) INTO rp_1y.cpu FROM cpu GROUP BY time(1h) END"}`,
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "Not a continuous query",
+			body:   `{"query":"DROP DATABASE telegraf"}`,
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "Name of another continuous query",
+			body:   `{"name":"cq_1d","query":"CREATE CONTINUOUS QUERY cq_1h ON telegraf BEGIN SELECT mean(usage) INTO rp_1y.cpu FROM cpu GROUP BY time(1h) END"}`,
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "Builder without aggregates",
+			body:   `{"name":"mem_1h","builder":{"queryConfig":{"measurement":"mem","fields":[{"value":"used","type":"field"}],"tags":{},"groupBy":{"time":"1h","tags":[]}},"rp":"rp_1y"}}`,
+			status: http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created cloudhub.ContinuousQuery
+			s := cqService(&created)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "http://any.url/"+tt.query, bytes.NewReader([]byte(tt.body)))
+			r = r.WithContext(httprouter.WithParams(context.Background(), httprouter.Params{
+				{Key: "id", Value: "1"},
+				{Key: "db", Value: "telegraf"},
+			}))
+			s.NewContinuousQuery(w, r)
+
+			resp := w.Result()
+			body, _ := ioutil.ReadAll(resp.Body)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("NewContinuousQuery() status = %d, want %d: %s", resp.StatusCode, tt.status, body)
+			}
+			if loc := resp.Header.Get("Location"); loc != tt.location {
+				t.Errorf("NewContinuousQuery() location = %q, want %q", loc, tt.location)
+			}
+			if created != tt.want {
+				t.Errorf("NewContinuousQuery() created %+v, want %+v", created, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_UpdateContinuousQuery(t *testing.T) {
+	var updated cloudhub.ContinuousQuery
+	s := cqService(&updated)
+
+	w := httptest.NewRecorder()
+	body := `{"builder":{"queryConfig":{"measurement":"cpu","fields":[{"value":"mean","type":"func","args":[{"value":"usage","type":"field"}]}],"tags":{},"groupBy":{"time":"2h","tags":[]}},"rp":"rp_1y","resampleFor":"4h"}}`
+	r := httptest.NewRequest("PUT", "http://any.url", bytes.NewReader([]byte(body)))
+	r = r.WithContext(httprouter.WithParams(context.Background(), httprouter.Params{
+		{Key: "id", Value: "1"},
+		{Key: "db", Value: "telegraf"},
+		{Key: "cq", Value: "cq_1h"},
+	}))
+	s.UpdateContinuousQuery(w, r)
+
+	if resp := w.Result(); resp.StatusCode != http.StatusOK {
+		t.Fatalf("UpdateContinuousQuery() status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	want := cloudhub.ContinuousQuery{
+		Name:  "cq_1h",
+		Query: "CREATE CONTINUOUS QUERY cq_1h ON telegraf RESAMPLE FOR 4h BEGIN SELECT mean(usage) AS mean_usage INTO telegraf.rp_1y.cpu FROM telegraf.autogen.cpu GROUP BY time(2h) END",
+	}
+	if updated != want {
+		t.Errorf("UpdateContinuousQuery() = %+v, want %+v", updated, want)
+	}
+}
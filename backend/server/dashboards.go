@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	cloudhub "github.com/snetsystems/cloudhub/backend"
 )
@@ -55,12 +56,21 @@ func (s *Service) Dashboards(w http.ResponseWriter, r *http.Request) {
 		Error(w, http.StatusInternalServerError, "Error loading dashboards", s.Logger)
 		return
 	}
+	permissions, err := s.authorizer().Permissions(ctx, cloudhub.PolicyDashboard)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, "Error loading policies of dashboards", s.Logger)
+		return
+	}
 
 	res := getDashboardsResponse{
 		Dashboards: []*dashboardResponse{},
 	}
 
 	for _, dashboard := range dashboards {
+		// Only the dashboards that the user may read are listed
+		if permissions(strconv.Itoa(int(dashboard.ID))) == "" {
+			continue
+		}
 		res.Dashboards = append(res.Dashboards, newDashboardResponse(dashboard))
 	}
 	encodeJSON(w, http.StatusOK, res, s.Logger)
@@ -136,6 +146,10 @@ func (s *Service) RemoveDashboard(w http.ResponseWriter, r *http.Request) {
 		unknownErrorWithMessage(w, err, s.Logger)
 		return
 	}
+	if err := s.removePolicies(ctx, cloudhub.PolicyDashboard, strconv.Itoa(id)); err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -21,6 +21,10 @@ type dbLinks struct {
 	Self         string `json:"self"`              // Self link mapping to this resource
 	RPs          string `json:"retentionPolicies"` // URL for retention policies for this database
 	Measurements string `json:"measurements"`      // URL for measurements for this database
+	CQs          string `json:"continuousQueries"` // URL for continuous queries for this database
+	TagKeys      string `json:"tagKeys"`           // URL for tag keys for this database
+	FieldKeys    string `json:"fieldKeys"`         // URL for field keys for this database
+	Cardinality  string `json:"cardinality"`       // URL for series cardinality for this database
 }
 
 type dbResponse struct {
@@ -42,6 +46,10 @@ func newDBResponse(srcID int, db string, rps []rpResponse) dbResponse {
 			Self:         fmt.Sprintf("%s/%d/dbs/%s", base, srcID, db),
 			RPs:          fmt.Sprintf("%s/%d/dbs/%s/rps", base, srcID, db),
 			Measurements: fmt.Sprintf("%s/%d/dbs/%s/measurements?limit=100&offset=0", base, srcID, db),
+			CQs:          fmt.Sprintf("%s/%d/dbs/%s/cqs", base, srcID, db),
+			TagKeys:      fmt.Sprintf("%s/%d/dbs/%s/tags", base, srcID, db),
+			FieldKeys:    fmt.Sprintf("%s/%d/dbs/%s/fields", base, srcID, db),
+			Cardinality:  fmt.Sprintf("%s/%d/dbs/%s/cardinality", base, srcID, db),
 		},
 	}
 }
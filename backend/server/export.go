@@ -0,0 +1,211 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/export"
+	"github.com/snetsystems/cloudhub/backend/influx"
+)
+
+// exportChunkSize is the number of points InfluxDB sends per chunk of the
+// results of an export, and the most rows of Flux results held at once
+const exportChunkSize = 10000
+
+type exportRequest struct {
+	Query  string `json:"query"`            // Query is the InfluxQL or Flux to export the results of
+	DB     string `json:"db,omitempty"`     // DB is the database of an InfluxQL query
+	RP     string `json:"rp,omitempty"`     // RP is the retention policy of an InfluxQL query
+	Type   string `json:"type,omitempty"`   // Type is the language of the query, influxql by default or flux
+	Format string `json:"format,omitempty"` // Format is csv by default, jsonl or parquet
+}
+
+func (r *exportRequest) Valid() error {
+	if r.Query == "" {
+		return fmt.Errorf("query field required")
+	}
+	if r.Type == "" {
+		r.Type = "influxql"
+	}
+	if r.Type != "influxql" && r.Type != "flux" {
+		return fmt.Errorf("invalid query type %q; must be influxql or flux", r.Type)
+	}
+	if r.Format == "" {
+		r.Format = export.CSV
+	}
+	if r.Format != export.CSV && r.Format != export.JSONLines && r.Format != export.Parquet {
+		return fmt.Errorf("invalid format %q; must be csv, jsonl or parquet", r.Format)
+	}
+	return nil
+}
+
+// ExportQuery runs an InfluxQL or Flux query and streams its results as a
+// CSV, JSON lines or Parquet file
+func (s *Service) ExportQuery(w http.ResponseWriter, r *http.Request) {
+	id, err := paramID("id", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return
+	}
+
+	var req exportRequest
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+	if err = req.Valid(); err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	src, err := s.Store.Sources(ctx).Get(ctx, id)
+	if err != nil {
+		notFound(w, id, s.Logger)
+		return
+	}
+	if src.Type == cloudhub.Prometheus {
+		Error(w, http.StatusBadRequest, "Exports are not supported by Prometheus sources", s.Logger)
+		return
+	}
+	// Exports read results, and must not change the databases of the source
+	if req.Type != "flux" {
+		if err := influx.ReadOnly(req.Query); err != nil {
+			Error(w, http.StatusBadRequest, fmt.Sprintf("Exports only run SELECT and SHOW statements: %v", err), s.Logger)
+			return
+		}
+	}
+
+	// Only InfluxQL queries are checked against the cost limits
+	user, org := queryGuardKeys(ctx)
+	var release func()
+	if req.Type == "flux" {
+		release, err = s.QueryGuard.AcquireQuota(user, org)
+	} else {
+		release, err = s.QueryGuard.Acquire(user, org, req.Query)
+	}
+	if err != nil {
+		s.queryGuardError(w, err)
+		return
+	}
+	defer release()
+
+	cli := &influx.Client{
+		Logger: s.Logger,
+	}
+	if err = cli.Connect(ctx, &src); err != nil {
+		msg := fmt.Sprintf("Unable to connect to source %d: %v", id, err)
+		Error(w, http.StatusBadRequest, msg, s.Logger)
+		return
+	}
+
+	if req.Type == "flux" {
+		s.exportFlux(w, r, cli, req)
+		return
+	}
+	s.exportInfluxQL(w, r, cli, req)
+}
+
+func (s *Service) exportInfluxQL(w http.ResponseWriter, r *http.Request, cli *influx.Client, req exportRequest) {
+	ctx := r.Context()
+	chunks, err := cli.QueryChunks(ctx, cloudhub.Query{
+		Command: req.Query,
+		DB:      req.DB,
+		RP:      req.RP,
+	}, exportChunkSize)
+	if err != nil {
+		s.exportError(w, err)
+		return
+	}
+	defer chunks.Close()
+
+	// Errors of the query are answered until the first results are written
+	series, err := chunks.Next()
+	if err != nil && err != io.EOF {
+		s.exportError(w, err)
+		return
+	}
+
+	ew := startExport(w, req.Format)
+	for err == nil {
+		if err = ew.Write(export.SeriesTable(series)); err != nil {
+			break
+		}
+		flushExport(w)
+		series, err = chunks.Next()
+	}
+	if err == io.EOF {
+		err = ew.Close()
+	}
+	s.endExport(err)
+}
+
+func (s *Service) exportFlux(w http.ResponseWriter, r *http.Request, cli *influx.Client, req exportRequest) {
+	body, err := cli.QueryFlux(r.Context(), req.Query)
+	if err != nil {
+		s.exportError(w, err)
+		return
+	}
+	defer body.Close()
+
+	var ew export.Writer
+	err = export.FluxTables(body, exportChunkSize, func(t export.Table) error {
+		if ew == nil {
+			ew = startExport(w, req.Format)
+		}
+		if err := ew.Write(t); err != nil {
+			return err
+		}
+		flushExport(w)
+		return nil
+	})
+	if ew == nil {
+		// Errors of the query are answered until the first results are written
+		if err != nil {
+			s.exportError(w, err)
+			return
+		}
+		ew = startExport(w, req.Format)
+	}
+	if err == nil {
+		err = ew.Close()
+	}
+	s.endExport(err)
+}
+
+// startExport writes the headers of the export file. The format is valid.
+func startExport(w http.ResponseWriter, format string) export.Writer {
+	ew, _ := export.NewWriter(format, w)
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="export.%s"`, format))
+	w.WriteHeader(http.StatusOK)
+	return ew
+}
+
+// exportError answers a query that failed before any results were written
+func (s *Service) exportError(w http.ResponseWriter, err error) {
+	if err == cloudhub.ErrUpstreamTimeout {
+		Error(w, http.StatusRequestTimeout, "Timeout waiting for Influx response", s.Logger)
+		return
+	}
+	Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+}
+
+// endExport aborts the response of an export that failed after its first
+// results were written, so that clients do not take the file as complete
+func (s *Service) endExport(err error) {
+	if err == nil {
+		return
+	}
+	s.Logger.WithField("component", "export").Error("Export failed: ", err)
+	panic(http.ErrAbortHandler)
+}
+
+func flushExport(w http.ResponseWriter) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bouk/httprouter"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+)
+
+func TestService_ExportQuery(t *testing.T) {
+	influxdb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/query":
+			if strings.HasPrefix(r.URL.Query().Get("q"), "DROP") {
+				t.Errorf("export query is not read only: %s", r.URL.Query().Get("q"))
+			}
+			if r.URL.Query().Get("chunked") != "true" {
+				t.Errorf("export query is not chunked: %s", r.URL.RawQuery)
+			}
+			if r.URL.Query().Get("q") == "SELECT bad FROM cpu" {
+				w.Write([]byte(`{"results":[{"statement_id":0,"error":"bad query"}]}` + "\n"))
+				return
+			}
+			w.Write([]byte(`{"results":[{"statement_id":0,"series":[{"name":"cpu","tags":{"host":"a"},"columns":["time","usage"],"values":[[1000,1.5]]}],"partial":true}]}` + "\n"))
+			w.Write([]byte(`{"results":[{"statement_id":0,"series":[{"name":"cpu","tags":{"host":"a"},"columns":["time","usage"],"values":[[2000,2]]}]}]}` + "\n"))
+		case "/api/v2/query":
+			w.Header().Set("Content-Type", "text/csv")
+			w.Write([]byte("#datatype,string,long,double\n#group,false,false,false\n#default,_result,,\n,result,table,_value\n,,0,3.5\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer influxdb.Close()
+
+	sources := &mocks.SourcesStore{
+		GetF: func(ctx context.Context, ID int) (cloudhub.Source, error) {
+			if ID == 2 {
+				return cloudhub.Source{ID: 2, Type: cloudhub.Prometheus, URL: influxdb.URL}, nil
+			}
+			return cloudhub.Source{ID: ID, URL: influxdb.URL}, nil
+		},
+	}
+
+	tests := []struct {
+		name        string
+		id          string
+		body        string
+		status      int
+		contentType string
+		want        string
+	}{
+		{
+			name:        "InfluxQL results as CSV",
+			id:          "1",
+			body:        `{"query":"SELECT usage FROM cpu GROUP BY host","db":"telegraf"}`,
+			status:      http.StatusOK,
+			contentType: "text/csv; charset=utf-8",
+			want:        "name,host,time,usage\ncpu,a,1970-01-01T00:00:01Z,1.5\ncpu,a,1970-01-01T00:00:02Z,2\n",
+		},
+		{
+			name:        "InfluxQL results as JSON lines",
+			id:          "1",
+			body:        `{"query":"SELECT usage FROM cpu GROUP BY host","db":"telegraf","format":"jsonl"}`,
+			status:      http.StatusOK,
+			contentType: "application/x-ndjson",
+			want:        `{"name":"cpu","host":"a","time":"1970-01-01T00:00:01Z","usage":1.5}` + "\n" + `{"name":"cpu","host":"a","time":"1970-01-01T00:00:02Z","usage":2}` + "\n",
+		},
+		{
+			name:        "Flux results as CSV",
+			id:          "1",
+			body:        `{"query":"from(bucket: \"telegraf\")","type":"flux"}`,
+			status:      http.StatusOK,
+			contentType: "text/csv; charset=utf-8",
+			want:        "result,table,_value\n_result,0,3.5\n",
+		},
+		{
+			name:   "Errors of queries before results",
+			id:     "1",
+			body:   `{"query":"SELECT bad FROM cpu","db":"telegraf"}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "Statements other than SELECT and SHOW",
+			id:     "1",
+			body:   `{"query":"DROP DATABASE telegraf","db":"telegraf"}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "Unknown format",
+			id:     "1",
+			body:   `{"query":"SELECT usage FROM cpu","format":"xlsx"}`,
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "Prometheus source",
+			id:     "2",
+			body:   `{"query":"up"}`,
+			status: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{
+				Store: &mocks.Store{
+					SourcesStore: sources,
+				},
+				Logger: log.New(log.DebugLevel),
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "http://any.url", strings.NewReader(tt.body))
+			r = r.WithContext(httprouter.WithParams(context.Background(), httprouter.Params{
+				{Key: "id", Value: tt.id},
+			}))
+			s.ExportQuery(w, r)
+
+			resp := w.Result()
+			body, _ := ioutil.ReadAll(resp.Body)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("ExportQuery() status = %d, want %d: %s", resp.StatusCode, tt.status, body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			if got := resp.Header.Get("Content-Type"); got != tt.contentType {
+				t.Errorf("ExportQuery() Content-Type = %s, want %s", got, tt.contentType)
+			}
+			if got := string(body); got != tt.want {
+				t.Errorf("ExportQuery() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
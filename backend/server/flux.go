@@ -16,6 +16,7 @@ import (
 
 	// _ "github.com/influxdata/flux/builtin"
 	"github.com/influxdata/flux/complete"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
 	"github.com/snetsystems/cloudhub/backend/influx"
 )
 
@@ -176,6 +177,14 @@ func (s *Service) ProxyFlux(w http.ResponseWriter, r *http.Request) {
 		Error(w, http.StatusUnprocessableEntity, msg, s.Logger)
 		return
 	}
+	// The API of InfluxDB 2.x is scoped to the organization of the source
+	if src.Type == cloudhub.InfluxDBv2 {
+		params := u.Query()
+		if params.Get("org") == "" && params.Get("orgID") == "" {
+			params.Set("org", src.InfluxOrg)
+			u.RawQuery = params.Encode()
+		}
+	}
 
 	director := func(req *http.Request) {
 		// Set the Host header of the original Flux URL
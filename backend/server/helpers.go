@@ -6,6 +6,8 @@ import (
 	"bufio"
 	"net"
 	"errors"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
 )
 
 func location(w http.ResponseWriter, self string) {
@@ -30,8 +32,9 @@ func version(version string, h http.Handler) http.Handler {
 	return http.HandlerFunc(fn)
 }
 
-// logout chooses the correct provider logout route and redirects to it
-func logout(nextURL, basepath string, routes AuthRoutes) http.HandlerFunc {
+// logout revokes the session of the principal, then chooses the correct
+// provider logout route and redirects to it
+func logout(nextURL, basepath string, routes AuthRoutes, store DataStore, logger cloudhub.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		principal, err := getPrincipal(ctx)
@@ -39,6 +42,14 @@ func logout(nextURL, basepath string, routes AuthRoutes) http.HandlerFunc {
 			http.Redirect(w, r, path.Join(basepath, nextURL), http.StatusTemporaryRedirect)
 			return
 		}
+		if principal.SessionID != "" {
+			serverCtx := serverContext(ctx)
+			if err := store.Sessions(serverCtx).Delete(serverCtx, cloudhub.Session{ID: principal.SessionID}); err != nil {
+				logger.
+					WithField("component", "auth").
+					Error("Unable to revoke session ", principal.SessionID, ": ", err.Error())
+			}
+		}
 		route, ok := routes.Lookup(principal.Issuer)
 		if !ok {
 			http.Redirect(w, r, path.Join(basepath, nextURL), http.StatusTemporaryRedirect)
@@ -0,0 +1,259 @@
+package server
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/influx"
+)
+
+const (
+	// importBatchSize is the number of lines written to InfluxDB at once
+	importBatchSize = 5000
+	// importQueue is the number of batches waiting to be written before the
+	// reading of the upload waits for InfluxDB
+	importQueue = 2
+	// maxImportErrors is the number of errors of lines an import report lists
+	maxImportErrors = 1000
+)
+
+// importError is the reason lines of an import were not written. Lines of
+// a failed write are Line to LastLine.
+type importError struct {
+	Line     int    `json:"line"`
+	LastLine int    `json:"lastLine,omitempty"`
+	Error    string `json:"error"`
+}
+
+type importReport struct {
+	Lines    int           `json:"lines"`           // Lines is the number of lines read
+	Written  int           `json:"written"`         // Written is the number of points written
+	Rejected int           `json:"rejected"`        // Rejected is the number of invalid lines
+	Failed   int           `json:"failed"`          // Failed is the number of valid lines InfluxDB did not write
+	Errors   []importError `json:"errors"`          // Errors of the first maxImportErrors rejected lines and failed writes
+	Error    string        `json:"error,omitempty"` // Error is the reason the import stopped before the end of the upload
+}
+
+func (r *importReport) addError(e importError) {
+	if len(r.Errors) < maxImportErrors {
+		r.Errors = append(r.Errors, e)
+	}
+}
+
+type importBatch struct {
+	first, last int
+	count       int
+	lines       strings.Builder
+}
+
+// Import writes an upload of line protocol or CSV, gzipped or not, to a
+// database and retention policy of a source in batches. Every line is
+// validated; the report lists the lines that were not written.
+func (s *Service) Import(w http.ResponseWriter, r *http.Request) {
+	id, err := paramID("id", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return
+	}
+
+	params := r.URL.Query()
+	db, rp := params.Get("db"), params.Get("rp")
+	if db == "" {
+		invalidData(w, fmt.Errorf("db parameter required"), s.Logger)
+		return
+	}
+	precision, err := influx.ImportPrecision(params.Get("precision"))
+	if err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+	format := params.Get("format")
+	if format == "" {
+		format = "lp"
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+			format = "csv"
+		}
+	}
+	if format != "lp" && format != "csv" {
+		invalidData(w, fmt.Errorf("invalid format %s; must be lp or csv", format), s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	src, err := s.Store.Sources(ctx).Get(ctx, id)
+	if err != nil {
+		notFound(w, id, s.Logger)
+		return
+	}
+	if src.Type == cloudhub.Prometheus {
+		Error(w, http.StatusBadRequest, "Writes are not supported by Prometheus sources", s.Logger)
+		return
+	}
+
+	cli := &influx.Client{
+		Logger: s.Logger,
+	}
+	if err = cli.Connect(ctx, &src); err != nil {
+		msg := fmt.Sprintf("Unable to connect to source %d: %v", id, err)
+		Error(w, http.StatusBadRequest, msg, s.Logger)
+		return
+	}
+	if src.Type == cloudhub.InfluxDBv2 {
+		if _, err := influx.V2Precision(precision); err != nil {
+			invalidData(w, err, s.Logger)
+			return
+		}
+	}
+
+	body, err := importBody(r)
+	if err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+	defer body.Close()
+
+	var lines influx.LineReader
+	if format == "csv" {
+		var tags []string
+		if t := params.Get("tags"); t != "" {
+			tags = strings.Split(t, ",")
+		}
+		lines, err = influx.NewCSVReader(body, influx.CSVOptions{
+			Measurement: params.Get("measurement"),
+			Tags:        tags,
+			Precision:   precision,
+		})
+		if err != nil {
+			invalidData(w, err, s.Logger)
+			return
+		}
+	} else {
+		lines = influx.NewLineProtocolReader(body)
+	}
+
+	report := s.importLines(ctx, cli, lines, db, rp, precision)
+	if report.Error != "" {
+		encodeJSON(w, http.StatusBadRequest, report, s.Logger)
+		return
+	}
+	encodeJSON(w, http.StatusOK, report, s.Logger)
+}
+
+// importBody is the upload of an import, uncompressed if it is gzipped
+func importBody(r *http.Request) (io.ReadCloser, error) {
+	br := bufio.NewReader(r.Body)
+	magic, _ := br.Peek(2)
+	if r.Header.Get("Content-Encoding") != "gzip" && string(magic) != "\x1f\x8b" {
+		return ioutil.NopCloser(br), nil
+	}
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gzip upload: %v", err)
+	}
+	return gz, nil
+}
+
+// importLines validates lines and writes the valid ones in batches. The
+// reading of lines waits while importQueue batches wait to be written, so
+// that large uploads are not held in memory. Imports stop at the first
+// failed write; lines read after it are neither written nor failed.
+func (s *Service) importLines(ctx context.Context, cli *influx.Client, lines influx.LineReader, db, rp, precision string) importReport {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var report importReport
+	batches := make(chan *importBatch, importQueue)
+	written := make(chan importReport)
+	go func() {
+		var wr importReport
+		for batch := range batches {
+			if wr.Error != "" {
+				continue
+			}
+			if err := cli.WriteLines(ctx, db, rp, precision, batch.lines.String()); err != nil {
+				wr.Failed += batch.count
+				wr.Error = err.Error()
+				wr.addError(importError{
+					Line:     batch.first,
+					LastLine: batch.last,
+					Error:    err.Error(),
+				})
+				cancel()
+				continue
+			}
+			wr.Written += batch.count
+		}
+		written <- wr
+	}()
+
+	batch := &importBatch{}
+	send := func() bool {
+		if batch.count == 0 {
+			return true
+		}
+		select {
+		case batches <- batch:
+			batch = &importBatch{}
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	for ctx.Err() == nil {
+		line, err := lines.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			report.Error = fmt.Sprintf("reading upload: %v", err)
+			break
+		}
+		report.Lines++
+		if line.Err == nil {
+			line.Err = influx.ValidateLine(line.Text, precision)
+		}
+		if line.Err != nil {
+			report.Rejected++
+			report.addError(importError{Line: line.Number, Error: line.Err.Error()})
+			continue
+		}
+
+		if batch.count == 0 {
+			batch.first = line.Number
+		}
+		batch.last = line.Number
+		batch.count++
+		batch.lines.WriteString(line.Text)
+		batch.lines.WriteByte('\n')
+		if batch.count >= importBatchSize && !send() {
+			break
+		}
+	}
+	send()
+	close(batches)
+
+	wr := <-written
+	report.Written = wr.Written
+	report.Failed = wr.Failed
+	for _, e := range wr.Errors {
+		report.addError(e)
+	}
+	if wr.Error != "" {
+		report.Error = wr.Error
+	}
+	if report.Error == "" && ctx.Err() != nil {
+		report.Error = fmt.Sprintf("import canceled: %v", ctx.Err())
+	}
+	if report.Errors == nil {
+		report.Errors = []importError{}
+	}
+	return report
+}
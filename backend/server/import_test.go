@@ -0,0 +1,173 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bouk/httprouter"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+)
+
+func TestService_Import(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		writes []string
+		params []string
+	)
+	influxdb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/write" {
+			http.NotFound(w, r)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.URL.Query().Get("db") == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"database not found: \"missing\""}`))
+			return
+		}
+		mu.Lock()
+		writes = append(writes, string(body))
+		params = append(params, r.URL.RawQuery)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer influxdb.Close()
+
+	gzipped := func(s string) []byte {
+		var b bytes.Buffer
+		gz := gzip.NewWriter(&b)
+		gz.Write([]byte(s))
+		gz.Close()
+		return b.Bytes()
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		body       []byte
+		status     int
+		report     importReport
+		wantWrites []string
+		wantParams string
+	}{
+		{
+			name:   "Line protocol with invalid lines",
+			query:  "db=telegraf&rp=autogen&precision=s",
+			body:   []byte("cpu usage=1 1546300800\ncpu usage=\n\nmem used=2i\n"),
+			status: http.StatusOK,
+			report: importReport{
+				Lines:    3,
+				Written:  2,
+				Rejected: 1,
+				Errors:   []importError{{Line: 2}},
+			},
+			wantWrites: []string{"cpu usage=1 1546300800\nmem used=2i\n"},
+			wantParams: "db=telegraf&precision=s&rp=autogen",
+		},
+		{
+			name:   "Gzipped CSV",
+			query:  "db=telegraf&format=csv&tags=host&precision=ms",
+			body:   gzipped("name,host,time,usage\ncpu,a,1000,1.5\n"),
+			status: http.StatusOK,
+			report: importReport{
+				Lines:   1,
+				Written: 1,
+				Errors:  []importError{},
+			},
+			wantWrites: []string{"cpu,host=a usage=1.5 1000\n"},
+			wantParams: "db=telegraf&precision=ms&rp=",
+		},
+		{
+			name:   "Failed write",
+			query:  "db=missing",
+			body:   []byte("cpu usage=1\n"),
+			status: http.StatusBadRequest,
+			report: importReport{
+				Lines:  1,
+				Failed: 1,
+				Errors: []importError{{Line: 1, LastLine: 1}},
+			},
+		},
+		{
+			name:   "No database",
+			query:  "precision=s",
+			body:   []byte("cpu usage=1\n"),
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "Invalid precision",
+			query:  "db=telegraf&precision=d",
+			body:   []byte("cpu usage=1\n"),
+			status: http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writes, params = nil, nil
+			s := &Service{
+				Store: &mocks.Store{
+					SourcesStore: &mocks.SourcesStore{
+						GetF: func(ctx context.Context, ID int) (cloudhub.Source, error) {
+							return cloudhub.Source{ID: ID, URL: influxdb.URL}, nil
+						},
+					},
+				},
+				Logger: log.New(log.DebugLevel),
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "http://any.url/?"+tt.query, bytes.NewReader(tt.body))
+			r = r.WithContext(httprouter.WithParams(context.Background(), httprouter.Params{
+				{Key: "id", Value: "1"},
+			}))
+			s.Import(w, r)
+
+			resp := w.Result()
+			body, _ := ioutil.ReadAll(resp.Body)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("Import() status = %d, want %d: %s", resp.StatusCode, tt.status, body)
+			}
+			if tt.status == http.StatusUnprocessableEntity {
+				return
+			}
+
+			var report importReport
+			if err := json.Unmarshal(body, &report); err != nil {
+				t.Fatalf("Import() report %s: %v", body, err)
+			}
+			if report.Lines != tt.report.Lines || report.Written != tt.report.Written ||
+				report.Rejected != tt.report.Rejected || report.Failed != tt.report.Failed {
+				t.Errorf("Import() report = %+v, want %+v", report, tt.report)
+			}
+			if len(report.Errors) != len(tt.report.Errors) {
+				t.Fatalf("Import() errors = %+v, want %+v", report.Errors, tt.report.Errors)
+			}
+			for i, e := range tt.report.Errors {
+				got := report.Errors[i]
+				if got.Line != e.Line || got.LastLine != e.LastLine || got.Error == "" {
+					t.Errorf("Import() error %d = %+v, want lines %d to %d", i, got, e.Line, e.LastLine)
+				}
+			}
+			if (report.Error != "") != (tt.status != http.StatusOK) {
+				t.Errorf("Import() report error = %q", report.Error)
+			}
+			if strings.Join(writes, "|") != strings.Join(tt.wantWrites, "|") {
+				t.Errorf("Import() writes = %q, want %q", writes, tt.wantWrites)
+			}
+			if tt.wantParams != "" && (len(params) != 1 || params[0] != tt.wantParams) {
+				t.Errorf("Import() write parameters = %q, want %q", params, tt.wantParams)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
@@ -53,6 +54,19 @@ func (s *Service) Influx(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Statements other than SELECT and SHOW change the databases of the source
+	if src.Type != cloudhub.Prometheus && influx.ReadOnly(req.Command) != nil {
+		admin, err := s.authorizer().DatabaseAdmin(ctx, id)
+		if err != nil {
+			unknownErrorWithMessage(w, err, s.Logger)
+			return
+		}
+		if !admin {
+			Error(w, http.StatusForbidden, "User is not authorized to administer the databases of the source", s.Logger)
+			return
+		}
+	}
+
 	ts, err := s.TimeSeries(src)
 	if err != nil {
 		msg := fmt.Sprintf("Unable to connect to source %d: %v", id, err)
@@ -66,7 +80,22 @@ func (s *Service) Influx(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response, err := ts.Query(ctx, req)
+	// Cached results cost InfluxDB nothing, so only queries sent to it are
+	// checked against the guard
+	user, org := queryGuardKeys(ctx)
+	results, cached, err := s.QueryCache.Query(ctx, id, req, func() (cloudhub.Response, error) {
+		release, err := s.QueryGuard.Acquire(user, org, req.Command)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		return ts.Query(ctx, req)
+	})
+	w.Header().Set("X-CloudHub-Cache", cached)
+	if _, ok := err.(*queryLimitError); ok {
+		s.queryGuardError(w, err)
+		return
+	}
 	if err != nil {
 		if err == cloudhub.ErrUpstreamTimeout {
 			msg := "Timeout waiting for Influx response"
@@ -89,12 +118,47 @@ func (s *Service) Influx(w http.ResponseWriter, r *http.Request) {
 	}
 
 	res := postInfluxResponse{
-		Results: response,
+		Results: results,
 		UUID:    uniqueID,
 	}
 	encodeJSON(w, http.StatusOK, res, s.Logger)
 }
 
+// InfluxCache returns the use of the query cache of a source
+func (s *Service) InfluxCache(w http.ResponseWriter, r *http.Request) {
+	id, err := paramID("id", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	if _, err := s.Store.Sources(ctx).Get(ctx, id); err != nil {
+		notFound(w, id, s.Logger)
+		return
+	}
+
+	encodeJSON(w, http.StatusOK, s.QueryCache.Stats(id), s.Logger)
+}
+
+// PurgeInfluxCache drops the cached query results of a source
+func (s *Service) PurgeInfluxCache(w http.ResponseWriter, r *http.Request) {
+	id, err := paramID("id", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	if _, err := s.Store.Sources(ctx).Get(ctx, id); err != nil {
+		notFound(w, id, s.Logger)
+		return
+	}
+
+	s.QueryCache.Purge(id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (s *Service) Write(w http.ResponseWriter, r *http.Request) {
 	id, err := paramID("id", r)
 	if err != nil {
@@ -109,6 +173,11 @@ func (s *Service) Write(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if src.Type == cloudhub.Prometheus {
+		Error(w, http.StatusBadRequest, "Writes are not supported by Prometheus sources", s.Logger)
+		return
+	}
+
 	u, err := url.Parse(src.URL)
 	if err != nil {
 		msg := fmt.Sprintf("Error parsing source url: %v", err)
@@ -117,6 +186,12 @@ func (s *Service) Write(w http.ResponseWriter, r *http.Request) {
 	}
 	u.Path = "/write"
 	u.RawQuery = r.URL.RawQuery
+	if src.Type == cloudhub.InfluxDBv2 {
+		if u.Path, u.RawQuery, err = s.bucketWrite(ctx, src, r.URL.Query()); err != nil {
+			invalidData(w, err, s.Logger)
+			return
+		}
+	}
 
 	director := func(req *http.Request) {
 		// Set the Host header of the original source URL
@@ -153,3 +228,29 @@ func (s *Service) Write(w http.ResponseWriter, r *http.Request) {
 
 	proxy.ServeHTTP(w, r)
 }
+
+// bucketWrite converts the parameters of a write to a database and retention
+// policy into a write to their InfluxDB 2.x bucket
+func (s *Service) bucketWrite(ctx context.Context, src cloudhub.Source, params url.Values) (string, string, error) {
+	cli := &influx.Client{
+		Logger: s.Logger,
+	}
+	if err := cli.Connect(ctx, &src); err != nil {
+		return "", "", err
+	}
+	bucketID, err := cli.Bucket(ctx, params.Get("db"), params.Get("rp"))
+	if err != nil {
+		return "", "", err
+	}
+
+	bucket := url.Values{
+		"org":    {src.InfluxOrg},
+		"bucket": {bucketID},
+	}
+	precision, err := influx.V2Precision(params.Get("precision"))
+	if err != nil {
+		return "", "", err
+	}
+	bucket.Set("precision", precision)
+	return "/api/v2/write", bucket.Encode(), nil
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -11,7 +12,10 @@ import (
 	"github.com/bouk/httprouter"
 
 	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/influx"
+	"github.com/snetsystems/cloudhub/backend/log"
 	"github.com/snetsystems/cloudhub/backend/mocks"
+	"github.com/snetsystems/cloudhub/backend/roles"
 )
 
 func TestService_Influx(t *testing.T) {
@@ -115,3 +119,140 @@ func TestService_Influx(t *testing.T) {
 
 	}
 }
+
+func TestService_Influx_DatabaseAdmin(t *testing.T) {
+	viewer := &cloudhub.User{ID: 7, Roles: []cloudhub.Role{{Organization: "1", Name: roles.ViewerRoleName}}}
+	editor := &cloudhub.User{ID: 8, Roles: []cloudhub.Role{{Organization: "1", Name: roles.EditorRoleName}}}
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		query      string
+		wantStatus int
+	}{
+		{
+			name:       "Viewer selects",
+			ctx:        authorizerContext(viewer, roles.ViewerRoleName, nil),
+			query:      `SELECT * FROM cpu`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Viewer drops a database",
+			ctx:        authorizerContext(viewer, roles.ViewerRoleName, nil),
+			query:      `DROP DATABASE telegraf`,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Viewer drops a database after a select",
+			ctx:        authorizerContext(viewer, roles.ViewerRoleName, nil),
+			query:      `SELECT * FROM cpu; DROP DATABASE telegraf`,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Editor drops a database",
+			ctx:        authorizerContext(editor, roles.EditorRoleName, nil),
+			query:      `DROP DATABASE telegraf`,
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := policiesDataStore(nil)
+			store.SourcesStore = &mocks.SourcesStore{
+				GetF: func(ctx context.Context, ID int) (cloudhub.Source, error) {
+					return cloudhub.Source{ID: ID, URL: "http://any.url"}, nil
+				},
+			}
+			h := &Service{
+				Store: store,
+				TimeSeriesClient: &mocks.TimeSeries{
+					ConnectF: func(ctx context.Context, src *cloudhub.Source) error {
+						return nil
+					},
+					QueryF: func(ctx context.Context, query cloudhub.Query) (cloudhub.Response, error) {
+						return mocks.NewResponse(`{"results":[]}`, nil), nil
+					},
+				},
+				Logger: log.New(log.DebugLevel),
+			}
+
+			body, _ := json.Marshal(cloudhub.Query{Command: tt.query})
+			r := httptest.NewRequest("POST", "http://any.url", bytes.NewReader(body))
+			r = r.WithContext(httprouter.WithParams(tt.ctx, httprouter.Params{{Key: "id", Value: "1"}}))
+			w := httptest.NewRecorder()
+			h.Influx(w, r)
+
+			if got := w.Result().StatusCode; got != tt.wantStatus {
+				t.Errorf("Influx() status = %d, want %d", got, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestService_InfluxCache(t *testing.T) {
+	queries := 0
+	h := &Service{
+		Store: &mocks.Store{
+			SourcesStore: &mocks.SourcesStore{
+				GetF: func(ctx context.Context, ID int) (cloudhub.Source, error) {
+					return cloudhub.Source{
+						ID:  ID,
+						URL: "http://any.url",
+					}, nil
+				},
+			},
+		},
+		TimeSeriesClient: &mocks.TimeSeries{
+			ConnectF: func(ctx context.Context, src *cloudhub.Source) error {
+				return nil
+			},
+			QueryF: func(ctx context.Context, query cloudhub.Query) (cloudhub.Response, error) {
+				queries++
+				return mocks.NewResponse(`[{"statement_id":0}]`, nil), nil
+			},
+		},
+		QueryCache: influx.NewQueryCache(1024),
+		Logger:     log.New(log.DebugLevel),
+	}
+
+	request := func(method string, handler http.HandlerFunc, body string) *http.Response {
+		r := httptest.NewRequest(method, "http://any.url", bytes.NewReader([]byte(body)))
+		r = r.WithContext(httprouter.WithParams(context.Background(), httprouter.Params{
+			{
+				Key:   "id",
+				Value: "1",
+			},
+		}))
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Result()
+	}
+
+	query := `{"db":"telegraf","uuid":"bob","query":"SELECT mean(\"usage_user\") FROM cpu WHERE time > now() - 1h"}`
+	for i, want := range []string{influx.CacheMiss, influx.CacheHit} {
+		resp := request("POST", h.Influx, query)
+		body, _ := ioutil.ReadAll(resp.Body)
+		if got := resp.Header.Get("X-CloudHub-Cache"); got != want {
+			t.Errorf("Influx() request %d cache = %q, want %q", i, got, want)
+		}
+		if string(body) != `{"results":[{"statement_id":0}],"uuid":"bob"}`+"\n" {
+			t.Errorf("Influx() request %d = %s", i, body)
+		}
+	}
+	if queries != 1 {
+		t.Errorf("Influx() queried the source %d times, want 1", queries)
+	}
+
+	resp := request("GET", h.InfluxCache, "")
+	body, _ := ioutil.ReadAll(resp.Body)
+	if want := `{"hits":1,"misses":1,"shared":0,"bypassed":0,"evictions":0,"entries":1,"bytes":20,"maxBytes":1024}` + "\n"; string(body) != want {
+		t.Errorf("InfluxCache() = %s, want %s", body, want)
+	}
+
+	if resp := request("DELETE", h.PurgeInfluxCache, ""); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("PurgeInfluxCache() = %d, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+	if stats := h.QueryCache.Stats(1); stats.Entries != 0 {
+		t.Errorf("PurgeInfluxCache() left %+v", stats)
+	}
+}
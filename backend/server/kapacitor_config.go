@@ -0,0 +1,348 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/bouk/httprouter"
+	kapa "github.com/snetsystems/cloudhub/backend/kapacitor"
+)
+
+// kapacitorClient loads the kapacitor of the request scoped to its source
+func (s *Service) kapacitorClient(w http.ResponseWriter, r *http.Request) (*kapa.Client, string, bool) {
+	id, err := paramID("kid", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return nil, "", false
+	}
+
+	srcID, err := paramID("id", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return nil, "", false
+	}
+
+	ctx := r.Context()
+	srv, err := s.Store.Servers(ctx).Get(ctx, id)
+	if err != nil || srv.SrcID != srcID {
+		notFound(w, id, s.Logger)
+		return nil, "", false
+	}
+
+	c := kapa.NewClient(srv.URL, srv.Username, srv.Password, srv.InsecureSkipVerify)
+	return c, fmt.Sprintf("/cloudhub/v1/sources/%d/kapacitors/%d", srv.SrcID, srv.ID), true
+}
+
+// kapacitorConfigError reports errors of CloudHub validation as invalid data
+// and unknown sections or handlers as not found
+func (s *Service) kapacitorConfigError(w http.ResponseWriter, err error) {
+	switch err {
+	case kapa.ErrConfigNotFound, kapa.ErrTopicHandlerNotFound:
+		Error(w, http.StatusNotFound, err.Error(), s.Logger)
+		return
+	}
+	if _, ok := err.(kapa.InvalidError); ok {
+		invalidData(w, err, s.Logger)
+		return
+	}
+	Error(w, http.StatusInternalServerError, err.Error(), s.Logger)
+}
+
+type kapacitorConfigLinks struct {
+	Self string `json:"self"`
+}
+
+type kapacitorConfigResponse struct {
+	Sections map[string][]kapa.ServiceConfig `json:"sections"`
+	Links    kapacitorConfigLinks            `json:"links"`
+}
+
+// KapacitorConfig returns every service configuration of the kapacitor with
+// secrets redacted
+func (s *Service) KapacitorConfig(w http.ResponseWriter, r *http.Request) {
+	c, self, ok := s.kapacitorClient(w, r)
+	if !ok {
+		return
+	}
+
+	sections, err := c.Config(r.Context())
+	if err != nil {
+		s.kapacitorConfigError(w, err)
+		return
+	}
+
+	res := kapacitorConfigResponse{
+		Sections: sections,
+		Links: kapacitorConfigLinks{
+			Self: self + "/config",
+		},
+	}
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+type kapacitorConfigSectionLinks struct {
+	Self string `json:"self"`
+	Test string `json:"test"`
+}
+
+type kapacitorConfigSectionResponse struct {
+	Section  string                      `json:"section"`
+	Elements []kapa.ServiceConfig        `json:"elements"`
+	Links    kapacitorConfigSectionLinks `json:"links"`
+}
+
+func newKapacitorConfigSectionResponse(self, section string, elements []kapa.ServiceConfig) kapacitorConfigSectionResponse {
+	href := fmt.Sprintf("%s/config/%s", self, url.PathEscape(section))
+	return kapacitorConfigSectionResponse{
+		Section:  section,
+		Elements: elements,
+		Links: kapacitorConfigSectionLinks{
+			Self: href,
+			Test: href + "/test",
+		},
+	}
+}
+
+// KapacitorConfigSection returns the elements of one service configuration
+// section of the kapacitor
+func (s *Service) KapacitorConfigSection(w http.ResponseWriter, r *http.Request) {
+	c, self, ok := s.kapacitorClient(w, r)
+	if !ok {
+		return
+	}
+
+	section := httprouter.GetParamFromContext(r.Context(), "section")
+	elements, err := c.ConfigSection(r.Context(), section)
+	if err != nil {
+		s.kapacitorConfigError(w, err)
+		return
+	}
+
+	encodeJSON(w, http.StatusOK, newKapacitorConfigSectionResponse(self, section, elements), s.Logger)
+}
+
+// UpdateKapacitorConfigSection sets or deletes options of one element of a
+// service configuration section. Options are validated against the current
+// configuration before they reach kapacitor.
+func (s *Service) UpdateKapacitorConfigSection(w http.ResponseWriter, r *http.Request) {
+	c, self, ok := s.kapacitorClient(w, r)
+	if !ok {
+		return
+	}
+
+	var req kapa.ConfigUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+
+	section := httprouter.GetParamFromContext(r.Context(), "section")
+	cfg, err := c.UpdateConfig(r.Context(), section, req)
+	if err != nil {
+		s.kapacitorConfigError(w, err)
+		return
+	}
+
+	encodeJSON(w, http.StatusOK, newKapacitorConfigSectionResponse(self, section, []kapa.ServiceConfig{*cfg}), s.Logger)
+}
+
+type serviceTestRequest struct {
+	Options map[string]interface{} `json:"options"`
+}
+
+// KapacitorConfigSectionTest asks kapacitor to test the service of a
+// configuration section
+func (s *Service) KapacitorConfigSectionTest(w http.ResponseWriter, r *http.Request) {
+	c, _, ok := s.kapacitorClient(w, r)
+	if !ok {
+		return
+	}
+
+	var req serviceTestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+
+	section := httprouter.GetParamFromContext(r.Context(), "section")
+	res, err := c.TestService(r.Context(), section, req.Options)
+	if err != nil {
+		s.kapacitorConfigError(w, err)
+		return
+	}
+
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+type topicLinks struct {
+	Handlers string `json:"handlers"`
+}
+
+type topicResponse struct {
+	kapa.Topic
+	Links topicLinks `json:"links"`
+}
+
+type topicsResponse struct {
+	Topics []topicResponse `json:"topics"`
+}
+
+// KapacitorTopics lists the alert topics of the kapacitor
+func (s *Service) KapacitorTopics(w http.ResponseWriter, r *http.Request) {
+	c, self, ok := s.kapacitorClient(w, r)
+	if !ok {
+		return
+	}
+
+	topics, err := c.Topics(r.Context())
+	if err != nil {
+		s.kapacitorConfigError(w, err)
+		return
+	}
+
+	res := topicsResponse{
+		Topics: make([]topicResponse, len(topics)),
+	}
+	for i, t := range topics {
+		res.Topics[i] = topicResponse{
+			Topic: t,
+			Links: topicLinks{
+				Handlers: fmt.Sprintf("%s/topics/%s/handlers", self, url.PathEscape(t.ID)),
+			},
+		}
+	}
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+type topicHandlerLinks struct {
+	Self string `json:"self"`
+}
+
+type topicHandlerResponse struct {
+	kapa.TopicHandler
+	Links topicHandlerLinks `json:"links"`
+}
+
+func newTopicHandlerResponse(self, topic string, h kapa.TopicHandler) topicHandlerResponse {
+	return topicHandlerResponse{
+		TopicHandler: h,
+		Links: topicHandlerLinks{
+			Self: fmt.Sprintf("%s/topics/%s/handlers/%s", self, url.PathEscape(topic), url.PathEscape(h.ID)),
+		},
+	}
+}
+
+type topicHandlersResponse struct {
+	Topic    string                 `json:"topic"`
+	Handlers []topicHandlerResponse `json:"handlers"`
+}
+
+// KapacitorTopicHandlers lists the handlers of an alert topic with secrets redacted
+func (s *Service) KapacitorTopicHandlers(w http.ResponseWriter, r *http.Request) {
+	c, self, ok := s.kapacitorClient(w, r)
+	if !ok {
+		return
+	}
+
+	topic := httprouter.GetParamFromContext(r.Context(), "topic")
+	handlers, err := c.TopicHandlers(r.Context(), topic)
+	if err != nil {
+		s.kapacitorConfigError(w, err)
+		return
+	}
+
+	res := topicHandlersResponse{
+		Topic:    topic,
+		Handlers: make([]topicHandlerResponse, len(handlers)),
+	}
+	for i, h := range handlers {
+		res.Handlers[i] = newTopicHandlerResponse(self, topic, h)
+	}
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+// KapacitorTopicHandlerID returns one handler of an alert topic
+func (s *Service) KapacitorTopicHandlerID(w http.ResponseWriter, r *http.Request) {
+	c, self, ok := s.kapacitorClient(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	topic := httprouter.GetParamFromContext(ctx, "topic")
+	h, err := c.TopicHandler(ctx, topic, httprouter.GetParamFromContext(ctx, "hid"))
+	if err != nil {
+		s.kapacitorConfigError(w, err)
+		return
+	}
+
+	encodeJSON(w, http.StatusOK, newTopicHandlerResponse(self, topic, *h), s.Logger)
+}
+
+// NewKapacitorTopicHandler adds a handler to an alert topic
+func (s *Service) NewKapacitorTopicHandler(w http.ResponseWriter, r *http.Request) {
+	c, self, ok := s.kapacitorClient(w, r)
+	if !ok {
+		return
+	}
+
+	var req kapa.TopicHandler
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+
+	topic := httprouter.GetParamFromContext(r.Context(), "topic")
+	h, err := c.CreateTopicHandler(r.Context(), topic, req)
+	if err != nil {
+		s.kapacitorConfigError(w, err)
+		return
+	}
+
+	res := newTopicHandlerResponse(self, topic, *h)
+	location(w, res.Links.Self)
+	encodeJSON(w, http.StatusCreated, res, s.Logger)
+}
+
+// ReplaceKapacitorTopicHandler replaces a handler of an alert topic. Redacted
+// options sent back as true keep their current secret.
+func (s *Service) ReplaceKapacitorTopicHandler(w http.ResponseWriter, r *http.Request) {
+	c, self, ok := s.kapacitorClient(w, r)
+	if !ok {
+		return
+	}
+
+	var req kapa.TopicHandler
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	topic := httprouter.GetParamFromContext(ctx, "topic")
+	h, err := c.ReplaceTopicHandler(ctx, topic, httprouter.GetParamFromContext(ctx, "hid"), req)
+	if err != nil {
+		s.kapacitorConfigError(w, err)
+		return
+	}
+
+	encodeJSON(w, http.StatusOK, newTopicHandlerResponse(self, topic, *h), s.Logger)
+}
+
+// RemoveKapacitorTopicHandler deletes a handler of an alert topic
+func (s *Service) RemoveKapacitorTopicHandler(w http.ResponseWriter, r *http.Request) {
+	c, _, ok := s.kapacitorClient(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	if err := c.DeleteTopicHandler(ctx, httprouter.GetParamFromContext(ctx, "topic"), httprouter.GetParamFromContext(ctx, "hid")); err != nil {
+		s.kapacitorConfigError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
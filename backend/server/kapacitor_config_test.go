@@ -0,0 +1,112 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+	"github.com/snetsystems/cloudhub/backend/server"
+)
+
+func TestService_KapacitorTopicHandlers(t *testing.T) {
+	kapaSrv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/kapacitor/v1/alerts/topics/cpu/handlers" {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		res := map[string]interface{}{
+			"topic": "cpu",
+			"handlers": []map[string]interface{}{
+				{
+					"id":   "ops",
+					"kind": "slack",
+					"options": map[string]interface{}{
+						"channel": "#ops",
+					},
+				},
+				{
+					"id":   "pager",
+					"kind": "pagerduty2",
+					"options": map[string]interface{}{
+						"routing-key": "abc123",
+					},
+				},
+			},
+		}
+		if err := json.NewEncoder(rw).Encode(res); err != nil {
+			t.Error("Failed to encode JSON. err:", err)
+		}
+	}))
+	defer kapaSrv.Close()
+
+	svc := &server.Service{
+		Store: &mocks.Store{
+			ServersStore: &mocks.ServersStore{
+				GetF: func(ctx context.Context, ID int) (cloudhub.Server, error) {
+					return cloudhub.Server{
+						ID:    ID,
+						SrcID: 1,
+						URL:   kapaSrv.URL,
+					}, nil
+				},
+			},
+		},
+		Logger: &mocks.TestLogger{},
+	}
+
+	req := httptest.NewRequest("GET", "/cloudhub/v1/sources/1/kapacitors/2/topics/cpu/handlers", nil)
+	req = req.WithContext(httprouter.WithParams(context.Background(), httprouter.Params{
+		{
+			Key:   "id",
+			Value: "1",
+		},
+		{
+			Key:   "kid",
+			Value: "2",
+		},
+		{
+			Key:   "topic",
+			Value: "cpu",
+		},
+	}))
+	rr := httptest.NewRecorder()
+
+	svc.KapacitorTopicHandlers(rr, req)
+
+	resp := rr.Result()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("KapacitorTopicHandlers() status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	var res struct {
+		Handlers []struct {
+			ID       string                 `json:"id"`
+			Options  map[string]interface{} `json:"options"`
+			Redacted []string               `json:"redacted"`
+			Links    struct {
+				Self string `json:"self"`
+			} `json:"links"`
+		} `json:"handlers"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Handlers) != 2 {
+		t.Fatalf("KapacitorTopicHandlers() returned %d handlers, want 2", len(res.Handlers))
+	}
+	if got := res.Handlers[0].Options["channel"]; got != "#ops" {
+		t.Errorf("KapacitorTopicHandlers() channel = %v, want #ops", got)
+	}
+	pager := res.Handlers[1]
+	if pager.Options["routing-key"] != true || len(pager.Redacted) != 1 {
+		t.Errorf("KapacitorTopicHandlers() did not redact the routing key: %+v", pager)
+	}
+	if pager.Links.Self != "/cloudhub/v1/sources/1/kapacitors/2/topics/cpu/handlers/pager" {
+		t.Errorf("KapacitorTopicHandlers() self link = %s", pager.Links.Self)
+	}
+}
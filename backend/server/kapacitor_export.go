@@ -0,0 +1,127 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	kapa "github.com/snetsystems/cloudhub/backend/kapacitor"
+)
+
+type kapacitorExportResponse struct {
+	Rules []cloudhub.AlertRule `json:"rules"`
+}
+
+// KapacitorExport returns every task managed by CloudHub as an alert rule
+// with its TICKscript, ready to be imported into another kapacitor
+func (s *Service) KapacitorExport(w http.ResponseWriter, r *http.Request) {
+	c, _, ok := s.kapacitorClient(w, r)
+	if !ok {
+		return
+	}
+
+	rules, err := c.Export(r.Context())
+	if err != nil {
+		Error(w, http.StatusInternalServerError, err.Error(), s.Logger)
+		return
+	}
+
+	encodeJSON(w, http.StatusOK, kapacitorExportResponse{Rules: rules}, s.Logger)
+}
+
+type kapacitorImportRequest struct {
+	Rules     []cloudhub.AlertRule `json:"rules"`
+	Overwrite bool                 `json:"overwrite"` // Overwrite replaces tasks that exist with a different definition
+}
+
+// Valid checks that every rule to import is identified
+func (k *kapacitorImportRequest) Valid() error {
+	if len(k.Rules) == 0 {
+		return fmt.Errorf("at least one rule is required")
+	}
+	for _, rule := range k.Rules {
+		if rule.ID == "" {
+			return fmt.Errorf("rule id required")
+		}
+	}
+	return nil
+}
+
+type kapacitorImportResponse struct {
+	Results []kapa.ImportResult `json:"results"`
+}
+
+// KapacitorImport creates exported alert rules as tasks of the kapacitor
+// keeping their IDs. Every rule reports its own result.
+func (s *Service) KapacitorImport(w http.ResponseWriter, r *http.Request) {
+	c, _, ok := s.kapacitorClient(w, r)
+	if !ok {
+		return
+	}
+
+	var req kapacitorImportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+	if err := req.Valid(); err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+
+	results, err := c.Import(r.Context(), req.Rules, req.Overwrite)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, err.Error(), s.Logger)
+		return
+	}
+
+	encodeJSON(w, http.StatusOK, kapacitorImportResponse{Results: results}, s.Logger)
+}
+
+type kapacitorMirrorRequest struct {
+	SrcID  int  `json:"srcId,string"`  // SrcID is the source of the standby kapacitor
+	KapaID int  `json:"kapaId,string"` // KapaID is the standby kapacitor
+	Prune  bool `json:"prune"`         // Prune deletes the CloudHub tasks found only on the standby
+}
+
+// KapacitorMirror makes the CloudHub tasks of a standby kapacitor the same as
+// the tasks of the kapacitor of the request. CloudHub tasks found only on the
+// standby are deleted when the request prunes them.
+func (s *Service) KapacitorMirror(w http.ResponseWriter, r *http.Request) {
+	c, _, ok := s.kapacitorClient(w, r)
+	if !ok {
+		return
+	}
+
+	var req kapacitorMirrorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	// The standby may belong to another source than the one of the route
+	if err := s.writableSource(ctx, req.SrcID); err != nil {
+		Error(w, http.StatusForbidden, err.Error(), s.Logger)
+		return
+	}
+	srv, err := s.Store.Servers(ctx).Get(ctx, req.KapaID)
+	if err != nil || srv.SrcID != req.SrcID {
+		invalidData(w, fmt.Errorf("standby kapacitor %d of source %d not found", req.KapaID, req.SrcID), s.Logger)
+		return
+	}
+	if srv.URL == c.URL {
+		invalidData(w, fmt.Errorf("a kapacitor cannot mirror itself"), s.Logger)
+		return
+	}
+
+	standby := kapa.NewClient(srv.URL, srv.Username, srv.Password, srv.InsecureSkipVerify)
+	results, err := c.Mirror(ctx, standby, req.Prune)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, err.Error(), s.Logger)
+		return
+	}
+
+	encodeJSON(w, http.StatusOK, kapacitorImportResponse{Results: results}, s.Logger)
+}
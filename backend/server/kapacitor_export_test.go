@@ -0,0 +1,157 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+	"github.com/snetsystems/cloudhub/backend/organizations"
+	"github.com/snetsystems/cloudhub/backend/roles"
+	"github.com/snetsystems/cloudhub/backend/server"
+)
+
+func TestService_KapacitorExport(t *testing.T) {
+	kapaSrv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		tasks := []map[string]interface{}{}
+		for _, id := range []string{"cpu_alert", "cloudhub-v1-abc"} {
+			tasks = append(tasks, map[string]interface{}{
+				"id":     id,
+				"script": "stream\n\t|from()\n\t\t.measurement('cpu')\n",
+				"status": "disabled",
+				"type":   "stream",
+				"dbrps": []map[string]string{
+					{
+						"db": "telegraf",
+						"rp": "autogen",
+					},
+				},
+				"link": map[string]interface{}{
+					"rel":  "self",
+					"href": "/kapacitor/v1/tasks/" + id,
+				},
+			})
+		}
+		if offset >= len(tasks) {
+			tasks = tasks[:0]
+		}
+		if err := json.NewEncoder(rw).Encode(map[string]interface{}{"tasks": tasks}); err != nil {
+			t.Error("Failed to encode JSON. err:", err)
+		}
+	}))
+	defer kapaSrv.Close()
+
+	svc := &server.Service{
+		Store: &mocks.Store{
+			ServersStore: &mocks.ServersStore{
+				GetF: func(ctx context.Context, ID int) (cloudhub.Server, error) {
+					return cloudhub.Server{
+						ID:    ID,
+						SrcID: 1,
+						URL:   kapaSrv.URL,
+					}, nil
+				},
+			},
+		},
+		Logger: &mocks.TestLogger{},
+	}
+
+	req := httptest.NewRequest("GET", "/cloudhub/v1/sources/1/kapacitors/1/export", nil)
+	req = req.WithContext(httprouter.WithParams(context.Background(), httprouter.Params{
+		{
+			Key:   "id",
+			Value: "1",
+		},
+		{
+			Key:   "kid",
+			Value: "1",
+		},
+	}))
+	rr := httptest.NewRecorder()
+
+	svc.KapacitorExport(rr, req)
+
+	resp := rr.Result()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("KapacitorExport() status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	var res struct {
+		Rules []cloudhub.AlertRule `json:"rules"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Rules) != 1 || res.Rules[0].ID != "cloudhub-v1-abc" {
+		t.Fatalf("KapacitorExport() returned %+v, want only cloudhub-v1-abc", res.Rules)
+	}
+	rule := res.Rules[0]
+	if rule.TICKScript == "" || rule.Status != "disabled" || len(rule.DBRPs) != 1 {
+		t.Errorf("KapacitorExport() rule = %+v", rule)
+	}
+}
+
+func TestService_KapacitorMirror_Policies(t *testing.T) {
+	kapaSrv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		t.Errorf("KapacitorMirror() requested %s %s of a kapacitor", r.Method, r.URL.Path)
+	}))
+	defer kapaSrv.Close()
+
+	svc := &server.Service{
+		Store: &mocks.Store{
+			// The source 2 of the standby is only written by the user 7
+			PoliciesStore: &mocks.PoliciesStore{
+				AllF: func(ctx context.Context) ([]cloudhub.Policy, error) {
+					return []cloudhub.Policy{
+						{Resource: cloudhub.PolicySource, ResourceID: "2", UserID: 7, Permission: cloudhub.PermissionWrite},
+					}, nil
+				},
+			},
+			ServersStore: &mocks.ServersStore{
+				GetF: func(ctx context.Context, ID int) (cloudhub.Server, error) {
+					return cloudhub.Server{
+						ID:    ID,
+						SrcID: ID,
+						URL:   kapaSrv.URL + "/" + strconv.Itoa(ID),
+					}, nil
+				},
+			},
+		},
+		Logger: &mocks.TestLogger{},
+	}
+
+	editor := &cloudhub.User{ID: 8, Roles: []cloudhub.Role{{Organization: "1", Name: roles.EditorRoleName}}}
+	ctx := context.WithValue(context.Background(), organizations.ContextKey, "1")
+	ctx = context.WithValue(ctx, server.UserContextKey, editor)
+	ctx = context.WithValue(ctx, roles.ContextKey, roles.EditorRoleName)
+	ctx = httprouter.WithParams(ctx, httprouter.Params{
+		{
+			Key:   "id",
+			Value: "1",
+		},
+		{
+			Key:   "kid",
+			Value: "1",
+		},
+	})
+
+	req := httptest.NewRequest("POST", "/cloudhub/v1/sources/1/kapacitors/1/mirror", strings.NewReader(`{"srcId": "2", "kapaId": "2", "prune": true}`))
+	rr := httptest.NewRecorder()
+	svc.KapacitorMirror(rr, req.WithContext(ctx))
+
+	if got := rr.Result().StatusCode; got != http.StatusForbidden {
+		t.Errorf("KapacitorMirror() status = %d, want %d", got, http.StatusForbidden)
+	}
+}
@@ -42,11 +42,17 @@ func (p *postKapacitorRequest) Valid(defaultOrgID string) error {
 }
 
 type kapaLinks struct {
-	Proxy string `json:"proxy"` // URL location of proxy endpoint for this source
-	Self  string `json:"self"`  // Self link mapping to this resource
-	Rules string `json:"rules"` // Rules link for defining roles alerts for kapacitor
-	Tasks string `json:"tasks"` // Tasks link to define a task against the proxy
-	Ping  string `json:"ping"`  // Ping path to kapacitor
+	Proxy     string `json:"proxy"`     // URL location of proxy endpoint for this source
+	Self      string `json:"self"`      // Self link mapping to this resource
+	Rules     string `json:"rules"`     // Rules link for defining roles alerts for kapacitor
+	Tasks     string `json:"tasks"`     // Tasks link to define a task against the proxy
+	Ping      string `json:"ping"`      // Ping path to kapacitor
+	Adoptions string `json:"adoptions"` // Adoptions link to analyse and adopt tasks not created by CloudHub
+	Config    string `json:"config"`    // Config link to the service configuration of kapacitor
+	Topics    string `json:"topics"`    // Topics link to the alert topics and their handlers
+	Export    string `json:"export"`    // Export link to the CloudHub tasks as alert rules
+	Import    string `json:"import"`    // Import link to create exported alert rules
+	Mirror    string `json:"mirror"`    // Mirror link to copy the CloudHub tasks to a standby kapacitor
 }
 
 type kapacitor struct {
@@ -124,11 +130,17 @@ func newKapacitor(srv cloudhub.Server) kapacitor {
 		Active:             srv.Active,
 		InsecureSkipVerify: srv.InsecureSkipVerify,
 		Links: kapaLinks{
-			Self:  fmt.Sprintf("%s/%d/kapacitors/%d", httpAPISrcs, srv.SrcID, srv.ID),
-			Proxy: fmt.Sprintf("%s/%d/kapacitors/%d/proxy", httpAPISrcs, srv.SrcID, srv.ID),
-			Rules: fmt.Sprintf("%s/%d/kapacitors/%d/rules", httpAPISrcs, srv.SrcID, srv.ID),
-			Tasks: fmt.Sprintf("%s/%d/kapacitors/%d/proxy?path=/kapacitor/v1/tasks", httpAPISrcs, srv.SrcID, srv.ID),
-			Ping:  fmt.Sprintf("%s/%d/kapacitors/%d/proxy?path=/kapacitor/v1/ping", httpAPISrcs, srv.SrcID, srv.ID),
+			Self:      fmt.Sprintf("%s/%d/kapacitors/%d", httpAPISrcs, srv.SrcID, srv.ID),
+			Proxy:     fmt.Sprintf("%s/%d/kapacitors/%d/proxy", httpAPISrcs, srv.SrcID, srv.ID),
+			Rules:     fmt.Sprintf("%s/%d/kapacitors/%d/rules", httpAPISrcs, srv.SrcID, srv.ID),
+			Tasks:     fmt.Sprintf("%s/%d/kapacitors/%d/proxy?path=/kapacitor/v1/tasks", httpAPISrcs, srv.SrcID, srv.ID),
+			Ping:      fmt.Sprintf("%s/%d/kapacitors/%d/proxy?path=/kapacitor/v1/ping", httpAPISrcs, srv.SrcID, srv.ID),
+			Adoptions: fmt.Sprintf("%s/%d/kapacitors/%d/adoptions", httpAPISrcs, srv.SrcID, srv.ID),
+			Config:    fmt.Sprintf("%s/%d/kapacitors/%d/config", httpAPISrcs, srv.SrcID, srv.ID),
+			Topics:    fmt.Sprintf("%s/%d/kapacitors/%d/topics", httpAPISrcs, srv.SrcID, srv.ID),
+			Export:    fmt.Sprintf("%s/%d/kapacitors/%d/export", httpAPISrcs, srv.SrcID, srv.ID),
+			Import:    fmt.Sprintf("%s/%d/kapacitors/%d/import", httpAPISrcs, srv.SrcID, srv.ID),
+			Mirror:    fmt.Sprintf("%s/%d/kapacitors/%d/mirror", httpAPISrcs, srv.SrcID, srv.ID),
 		},
 	}
 }
@@ -529,6 +541,12 @@ func newAlertResponse(task *kapa.Task, srcID, kapaID int) *alertResponse {
 
 // ValidRuleRequest checks if the requested rule change is valid
 func ValidRuleRequest(rule cloudhub.AlertRule) error {
+	if kapa.IsComposite(rule) {
+		if err := kapa.ValidComposite(rule); err != nil {
+			return fmt.Errorf("invalid alert rule: %v", err)
+		}
+		return nil
+	}
 	if rule.Query == nil {
 		return fmt.Errorf("invalid alert rule: no query defined")
 	}
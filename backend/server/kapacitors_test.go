@@ -76,6 +76,58 @@ func TestValidRuleRequest(t *testing.T) {
 			rule:    cloudhub.AlertRule{},
 			wantErr: true,
 		},
+		{
+			name: "Composite without condition",
+			rule: cloudhub.AlertRule{
+				Name:  "cpu and load",
+				Every: "1m",
+				Queries: []cloudhub.AlertQuery{
+					{
+						Name: "cpu",
+						Query: &cloudhub.QueryConfig{
+							Database:        "telegraf",
+							RetentionPolicy: "autogen",
+							Measurement:     "cpu",
+						},
+					},
+					{
+						Name: "load",
+						Query: &cloudhub.QueryConfig{
+							Database:        "telegraf",
+							RetentionPolicy: "autogen",
+							Measurement:     "system",
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Composite",
+			rule: cloudhub.AlertRule{
+				Name:      "cpu and load",
+				Every:     "1m",
+				Condition: `"cpu.value" > 90 AND "load.value" > 2`,
+				Queries: []cloudhub.AlertQuery{
+					{
+						Name: "cpu",
+						Query: &cloudhub.QueryConfig{
+							Database:        "telegraf",
+							RetentionPolicy: "autogen",
+							Measurement:     "cpu",
+						},
+					},
+					{
+						Name: "load",
+						Query: &cloudhub.QueryConfig{
+							Database:        "telegraf",
+							RetentionPolicy: "autogen",
+							Measurement:     "system",
+						},
+					},
+				},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
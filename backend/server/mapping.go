@@ -13,14 +13,22 @@ import (
 )
 
 func (s *Service) mapPrincipalToSuperAdmin(p oauth2.Principal) bool {
-	if p.Issuer != "auth0" {
+	var superAdminGroup string
+	switch p.Issuer {
+	case "auth0":
+		superAdminGroup = s.SuperAdminProviderGroups.auth0
+	case "ldap":
+		superAdminGroup = s.SuperAdminProviderGroups.ldap
+	case "saml":
+		superAdminGroup = s.SuperAdminProviderGroups.saml
+	default:
 		return false
 	}
 
 	groups := strings.Split(p.Group, ",")
 	superAdmin := false
 	for _, group := range groups {
-		if group != "" && group == s.SuperAdminProviderGroups.auth0 {
+		if group != "" && group == superAdminGroup {
 			superAdmin = true
 			break
 		}
@@ -28,7 +36,22 @@ func (s *Service) mapPrincipalToSuperAdmin(p oauth2.Principal) bool {
 	return superAdmin
 }
 
+// mapPrincipalToRoles returns the roles of the mappings that apply to a
+// principal, keeping the highest role in each organization. Roles of the
+// mappings of specific groups are marked as mapped.
 func (s *Service) mapPrincipalToRoles(ctx context.Context, p oauth2.Principal) ([]cloudhub.Role, error) {
+	return s.mapPrincipal(ctx, p, false)
+}
+
+// mapPrincipalToGroupRoles returns the roles of the mappings of specific
+// groups that apply to a principal, which are re-evaluated on every login.
+// Wildcard mappings only grant roles to new users, so that removing users
+// from an organization lasts.
+func (s *Service) mapPrincipalToGroupRoles(ctx context.Context, p oauth2.Principal) ([]cloudhub.Role, error) {
+	return s.mapPrincipal(ctx, p, true)
+}
+
+func (s *Service) mapPrincipal(ctx context.Context, p oauth2.Principal, onlyGroups bool) ([]cloudhub.Role, error) {
 	mappings, err := s.Store.Mappings(ctx).All(ctx)
 	if err != nil {
 		return nil, err
@@ -36,24 +59,114 @@ func (s *Service) mapPrincipalToRoles(ctx context.Context, p oauth2.Principal) (
 	roles := []cloudhub.Role{}
 MappingsLoop:
 	for _, mapping := range mappings {
+		mapped := mapping.ProviderOrganization != cloudhub.MappingWildcard
+		if onlyGroups && !mapped {
+			continue
+		}
 		if applyMapping(mapping, p) {
 			org, err := s.Store.Organizations(ctx).Get(ctx, cloudhub.OrganizationQuery{ID: &mapping.Organization})
 			if err != nil {
 				continue MappingsLoop
 			}
 
-			for _, role := range roles {
-				if role.Organization == org.ID {
+			role := cloudhub.Role{Organization: org.ID, Name: mapping.Role, Mapped: mapped}
+			if role.Name == "" {
+				role.Name = org.DefaultRole
+			}
+			for i := range roles {
+				if roles[i].Organization == org.ID {
+					if roleRanks[role.Name] > roleRanks[roles[i].Name] {
+						roles[i] = role
+					}
 					continue MappingsLoop
 				}
 			}
-			roles = append(roles, cloudhub.Role{Organization: org.ID, Name: org.DefaultRole})
+			roles = append(roles, role)
 		}
 	}
 
 	return roles, nil
 }
 
+// MapRoles replaces the roles of the user of a principal logging in that were
+// mapped from its groups by the roles mapped from its current groups. Users
+// logging in for the first time are created with their roles by Me.
+func (s *Service) MapRoles(ctx context.Context, p oauth2.Principal) error {
+	serverCtx := serverContext(ctx)
+	scheme, err := getScheme(ctx)
+	if err != nil {
+		return err
+	}
+	usr, err := s.Store.Users(serverCtx).Get(serverCtx, cloudhub.UserQuery{
+		Name:     &p.Subject,
+		Provider: &p.Issuer,
+		Scheme:   &scheme,
+	})
+	if err == cloudhub.ErrUserNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if usr.Deactivated {
+		return nil
+	}
+
+	// Groups provisioned through SCIM add to the groups of the login
+	if s.provisioned(usr) {
+		groups, err := s.Store.Groups(serverCtx).All(serverCtx)
+		if err != nil {
+			return err
+		}
+		if names := groupNames(groups, usr.ID); len(names) > 0 {
+			p.Group = strings.Trim(p.Group+","+strings.Join(names, ","), ",")
+		}
+	}
+	mapped, err := s.mapPrincipalToGroupRoles(serverCtx, p)
+	if err != nil {
+		return err
+	}
+	roles, changed := remapRoles(usr.Roles, mapped)
+	if !changed {
+		return nil
+	}
+	usr.Roles = roles
+	return s.Store.Users(serverCtx).Update(serverCtx, usr)
+}
+
+// remapRoles replaces the mapped roles of a user by the roles mapped from
+// its groups, keeping the roles given explicitly to the user. It returns
+// whether the roles changed.
+func remapRoles(current, mapped []cloudhub.Role) ([]cloudhub.Role, bool) {
+	explicit := map[string]bool{}
+	roles := []cloudhub.Role{}
+	for _, role := range current {
+		if !role.Mapped {
+			explicit[role.Organization] = true
+			roles = append(roles, role)
+		}
+	}
+	for _, role := range mapped {
+		if !explicit[role.Organization] {
+			roles = append(roles, role)
+		}
+	}
+
+	if len(roles) != len(current) {
+		return roles, true
+	}
+	previous := map[string]cloudhub.Role{}
+	for _, role := range current {
+		previous[role.Organization] = role
+	}
+	for _, role := range roles {
+		if p, ok := previous[role.Organization]; !ok || p.Name != role.Name || p.Mapped != role.Mapped {
+			return roles, true
+		}
+	}
+	return current, false
+}
+
 func applyMapping(m cloudhub.Mapping, p oauth2.Principal) bool {
 	switch m.Provider {
 	case cloudhub.MappingWildcard, p.Issuer:
@@ -99,6 +212,9 @@ func (m *mappingsRequest) Valid() error {
 	if m.ProviderOrganization == "" {
 		return fmt.Errorf("mapping must specify group")
 	}
+	if _, ok := roleRanks[m.Role]; m.Role != "" && !ok {
+		return fmt.Errorf("Unknown role %s. Valid roles are 'member', 'viewer', 'editor' and 'admin'", m.Role)
+	}
 
 	return nil
 }
@@ -177,6 +293,7 @@ func (s *Service) NewMapping(w http.ResponseWriter, r *http.Request) {
 		Scheme:               req.Scheme,
 		Provider:             req.Provider,
 		ProviderOrganization: req.ProviderOrganization,
+		Role:                 req.Role,
 	}
 
 	m, err := s.Store.Mappings(ctx).Add(ctx, mapping)
@@ -217,6 +334,7 @@ func (s *Service) UpdateMapping(w http.ResponseWriter, r *http.Request) {
 		Scheme:               req.Scheme,
 		Provider:             req.Provider,
 		ProviderOrganization: req.ProviderOrganization,
+		Role:                 req.Role,
 	}
 
 	err := s.Store.Mappings(ctx).Update(ctx, mapping)
@@ -6,12 +6,14 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"net/http/httptest"
+	"reflect"
 	"testing"
 
 	"github.com/bouk/httprouter"
 	cloudhub "github.com/snetsystems/cloudhub/backend"
 	"github.com/snetsystems/cloudhub/backend/log"
 	"github.com/snetsystems/cloudhub/backend/mocks"
+	"github.com/snetsystems/cloudhub/backend/oauth2"
 	"github.com/snetsystems/cloudhub/backend/roles"
 )
 
@@ -140,6 +142,56 @@ func TestMappings_Add(t *testing.T) {
 				body:        `{"links":{"self":"/cloudhub/v1/mappings/0"},"id":"0","organizationId":"0","provider":"*","scheme":"*","providerOrganization":"*"}`,
 			},
 		},
+		{
+			name: "create new mapping with a role",
+			fields: fields{
+				OrganizationsStore: &mocks.OrganizationsStore{
+					GetF: func(ctx context.Context, q cloudhub.OrganizationQuery) (*cloudhub.Organization, error) {
+						return &cloudhub.Organization{
+							ID:          "0",
+							Name:        "The Gnarly Default",
+							DefaultRole: roles.ViewerRoleName,
+						}, nil
+					},
+				},
+				MappingsStore: &mocks.MappingsStore{
+					AddF: func(ctx context.Context, m *cloudhub.Mapping) (*cloudhub.Mapping, error) {
+						m.ID = "0"
+						return m, nil
+					},
+				},
+			},
+			args: args{
+				mapping: &cloudhub.Mapping{
+					Organization:         "0",
+					Provider:             "generic",
+					Scheme:               "oauth2",
+					ProviderOrganization: "sre",
+					Role:                 roles.EditorRoleName,
+				},
+			},
+			wants: wants{
+				statusCode:  201,
+				contentType: "application/json",
+				body:        `{"links":{"self":"/cloudhub/v1/mappings/0"},"id":"0","organizationId":"0","provider":"generic","scheme":"oauth2","providerOrganization":"sre","role":"editor"}`,
+			},
+		},
+		{
+			name: "create new mapping with an unknown role",
+			args: args{
+				mapping: &cloudhub.Mapping{
+					Organization:         "0",
+					Provider:             "generic",
+					Scheme:               "oauth2",
+					ProviderOrganization: "sre",
+					Role:                 "owner",
+				},
+			},
+			wants: wants{
+				statusCode:  422,
+				contentType: "application/json",
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -358,3 +410,103 @@ func TestMappings_Remove(t *testing.T) {
 		})
 	}
 }
+
+func TestService_MapRoles(t *testing.T) {
+	var updated *cloudhub.User
+	s := &Service{
+		Store: &mocks.Store{
+			MappingsStore: &mocks.MappingsStore{
+				AllF: func(ctx context.Context) ([]cloudhub.Mapping, error) {
+					return []cloudhub.Mapping{
+						{
+							Organization:         "0",
+							Provider:             "generic",
+							Scheme:               "oauth2",
+							ProviderOrganization: "sre",
+							Role:                 roles.EditorRoleName,
+						},
+						{
+							Organization:         "1",
+							Provider:             "generic",
+							Scheme:               "oauth2",
+							ProviderOrganization: "sre",
+						},
+						{
+							Organization:         "1",
+							Provider:             "generic",
+							Scheme:               "oauth2",
+							ProviderOrganization: "sre",
+							Role:                 roles.AdminRoleName,
+						},
+						{
+							Organization:         "2",
+							Provider:             "generic",
+							Scheme:               "oauth2",
+							ProviderOrganization: "dba",
+							Role:                 roles.EditorRoleName,
+						},
+						{
+							Organization:         "3",
+							Provider:             cloudhub.MappingWildcard,
+							Scheme:               cloudhub.MappingWildcard,
+							ProviderOrganization: cloudhub.MappingWildcard,
+						},
+					}, nil
+				},
+			},
+			OrganizationsStore: &mocks.OrganizationsStore{
+				GetF: func(ctx context.Context, q cloudhub.OrganizationQuery) (*cloudhub.Organization, error) {
+					return &cloudhub.Organization{
+						ID:          *q.ID,
+						Name:        "Org " + *q.ID,
+						DefaultRole: roles.MemberRoleName,
+					}, nil
+				},
+			},
+			UsersStore: &mocks.UsersStore{
+				GetF: func(ctx context.Context, q cloudhub.UserQuery) (*cloudhub.User, error) {
+					if *q.Name != "me" {
+						return nil, cloudhub.ErrUserNotFound
+					}
+					return &cloudhub.User{
+						Name:     "me",
+						Provider: "generic",
+						Scheme:   "oauth2",
+						Roles: []cloudhub.Role{
+							{Organization: "0", Name: roles.ViewerRoleName},
+							{Organization: "1", Name: roles.MemberRoleName, Mapped: true},
+							{Organization: "2", Name: roles.ViewerRoleName, Mapped: true},
+						},
+					}, nil
+				},
+				UpdateF: func(ctx context.Context, u *cloudhub.User) error {
+					updated = u
+					return nil
+				},
+			},
+		},
+		Logger: log.New(log.DebugLevel),
+	}
+
+	// Roles given explicitly are kept, and mapped roles follow the groups
+	err := s.MapRoles(context.Background(), oauth2.Principal{Subject: "me", Issuer: "generic", Group: "sre,developers"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []cloudhub.Role{
+		{Organization: "0", Name: roles.ViewerRoleName},
+		{Organization: "1", Name: roles.AdminRoleName, Mapped: true},
+	}
+	if updated == nil || !reflect.DeepEqual(updated.Roles, want) {
+		t.Errorf("MapRoles() updated the user to %+v, want roles %+v", updated, want)
+	}
+
+	// Users are created with their roles on their first request
+	updated = nil
+	if err := s.MapRoles(context.Background(), oauth2.Principal{Subject: "new", Issuer: "generic", Group: "sre"}); err != nil {
+		t.Fatal(err)
+	}
+	if updated != nil {
+		t.Errorf("MapRoles() of a new user updated %+v", updated)
+	}
+}
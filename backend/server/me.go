@@ -235,6 +235,11 @@ func (s *Service) Me(w http.ResponseWriter, r *http.Request) {
 
 	// user exists
 	if usr != nil {
+		if usr.Deactivated {
+			Error(w, http.StatusForbidden, "User is deactivated", s.Logger)
+			return
+		}
+
 		superAdmin := s.mapPrincipalToSuperAdmin(p)
 		if superAdmin && !usr.SuperAdmin {
 			usr.SuperAdmin = superAdmin
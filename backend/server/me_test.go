@@ -727,6 +727,81 @@ func TestService_Me(t *testing.T) {
 			wantContentType: "application/json",
 			wantBody:        `{"name":"secret","roles":[{"name":"member","organization":"0"}],"provider":"auth0","scheme":"oauth2","superAdmin":true,"links":{"self":"/cloudhub/v1/organizations/0/users/0"},"organizations":[{"id":"0","name":"The Bad Place","defaultRole":"member"}],"currentOrganization":{"id":"0","name":"The Bad Place","defaultRole":"member"}}`,
 		},
+		{
+			name: "new user - CloudHub is private, user is in ldap superadmin and mapped groups",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: httptest.NewRequest("GET", "http://example.com/foo", nil),
+			},
+			fields: fields{
+				UseAuth: true,
+				SuperAdminProviderGroups: superAdminProviderGroups{
+					ldap: "cloudhub-admins",
+				},
+				Logger: log.New(log.DebugLevel),
+				ConfigStore: mocks.ConfigStore{
+					Config: &cloudhub.Config{
+						Auth: cloudhub.AuthConfig{
+							SuperAdminNewUsers: false,
+						},
+					},
+				},
+				MappingsStore: &mocks.MappingsStore{
+					AllF: func(ctx context.Context) ([]cloudhub.Mapping, error) {
+						return []cloudhub.Mapping{
+							{
+								Organization:         "0",
+								Provider:             "ldap",
+								Scheme:               cloudhub.MappingWildcard,
+								ProviderOrganization: "developers",
+							},
+						}, nil
+					},
+				},
+				OrganizationsStore: &mocks.OrganizationsStore{
+					GetF: func(ctx context.Context, q cloudhub.OrganizationQuery) (*cloudhub.Organization, error) {
+						return &cloudhub.Organization{
+							ID:          "0",
+							Name:        "The Bad Place",
+							DefaultRole: roles.MemberRoleName,
+						}, nil
+					},
+					DefaultOrganizationF: func(ctx context.Context) (*cloudhub.Organization, error) {
+						return &cloudhub.Organization{
+							ID:          "0",
+							Name:        "The Bad Place",
+							DefaultRole: roles.MemberRoleName,
+						}, nil
+					},
+				},
+				UsersStore: &mocks.UsersStore{
+					NumF: func(ctx context.Context) (int, error) {
+						// This function gets to verify that there is at least one first user
+						return 1, nil
+					},
+					GetF: func(ctx context.Context, q cloudhub.UserQuery) (*cloudhub.User, error) {
+						if q.Name == nil || q.Provider == nil || q.Scheme == nil {
+							return nil, fmt.Errorf("Invalid user query: missing Name, Provider, and/or Scheme")
+						}
+						return nil, cloudhub.ErrUserNotFound
+					},
+					AddF: func(ctx context.Context, u *cloudhub.User) (*cloudhub.User, error) {
+						return u, nil
+					},
+					UpdateF: func(ctx context.Context, u *cloudhub.User) error {
+						return nil
+					},
+				},
+			},
+			principal: oauth2.Principal{
+				Subject: "secret",
+				Issuer:  "ldap",
+				Group:   "developers,cloudhub-admins",
+			},
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/json",
+			wantBody:        `{"name":"secret","roles":[{"name":"member","organization":"0","mapped":true}],"provider":"ldap","scheme":"oauth2","superAdmin":true,"links":{"self":"/cloudhub/v1/organizations/0/users/0"},"organizations":[{"id":"0","name":"The Bad Place","defaultRole":"member"}],"currentOrganization":{"id":"0","name":"The Bad Place","defaultRole":"member"}}`,
+		},
 		{
 			name: "new user - CloudHub is private, user is not in auth0 superadmin group",
 			args: args{
@@ -1430,6 +1505,11 @@ func TestService_UpdateMe(t *testing.T) {
 			Store: &Store{
 				UsersStore:         tt.fields.UsersStore,
 				OrganizationsStore: tt.fields.OrganizationsStore,
+				MappingsStore: &mocks.MappingsStore{
+					AllF: func(ctx context.Context) ([]cloudhub.Mapping, error) {
+						return []cloudhub.Mapping{}, nil
+					},
+				},
 			},
 			Logger:  tt.fields.Logger,
 			UseAuth: tt.fields.UseAuth,
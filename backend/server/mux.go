@@ -28,6 +28,7 @@ type MuxOpts struct {
 	Basepath      string               // URL path prefix under which all cloudhub routes will be mounted
 	UseAuth       bool                 // UseAuth turns on Github OAuth and JWT
 	Auth          oauth2.Authenticator // Auth is used to authenticate and authorize
+	TwoFactor     *oauth2.TwoFactor    // TwoFactor is the second step of the logins of users with a second factor
 	ProviderFuncs []func(func(oauth2.Provider, oauth2.Mux))
 	StatusFeedURL string            // JSON Feed URL for the client Status page News Feed
 	CustomLinks   []CustomLink		// Any custom external links for client's User menu
@@ -35,6 +36,7 @@ type MuxOpts struct {
 	DisableGZip   bool              // Optionally disable gzip.
 	AddonURLs     map[string]string // URLs for using in Addon Features, as passed in via CLI/ENV
 	AddonTokens   map[string]string // Tokens to access to Addon Features API, as passed in via CLI/ENV
+	SCIMToken     string            // SCIMToken is the bearer token of the identity provider using the SCIM provisioning API
 }
 
 // NewMux attaches all the route handlers; handler returned servers cloudhub.
@@ -86,8 +88,7 @@ func NewMux(opts MuxOpts, service Service) http.Handler {
 			next,
 		)
 	}
-	_ = EnsureMember
-	
+
 	EnsureViewer := func(next http.HandlerFunc) http.HandlerFunc {
 		return AuthorizedUser(
 			service.Store,
@@ -141,6 +142,29 @@ func NewMux(opts MuxOpts, service Service) http.Handler {
 		)
 	}
 
+	authorizer := &Authorizer{
+		Store:  service.Store,
+		Logger: opts.Logger,
+	}
+
+	// Dashboards, sources and capabilities are authorized by the policies of
+	// the organization, or by the roles where there are none
+	ensureDashboard := func(permission string, next http.HandlerFunc) http.HandlerFunc {
+		return EnsureMember(authorizer.EnsureResource(cloudhub.PolicyDashboard, "id", permission, next))
+	}
+
+	ensureSource := func(permission string, next http.HandlerFunc) http.HandlerFunc {
+		return EnsureMember(authorizer.EnsureResource(cloudhub.PolicySource, "id", permission, next))
+	}
+
+	ensureCapability := func(capability string, next http.HandlerFunc) http.HandlerFunc {
+		return EnsureMember(authorizer.EnsureCapability(capability, next))
+	}
+
+	ensureDatabaseAdmin := func(next http.HandlerFunc) http.HandlerFunc {
+		return ensureSource(cloudhub.PermissionWrite, authorizer.EnsureCapability(cloudhub.CapabilityDatabaseAdmin, next))
+	}
+
 	if opts.PprofEnabled {
 		// add profiling routes
 		router.GET("/debug/pprof/:thing", http.DefaultServeMux.ServeHTTP)
@@ -151,7 +175,7 @@ func NewMux(opts MuxOpts, service Service) http.Handler {
 	router.GET("/docs", Redoc("/swagger.json"))
 
 	// websocket
-	router.GET("/cloudhub/v1/WebTerminalHandler", EnsureAdmin(service.WebTerminalHandler))
+	router.GET("/cloudhub/v1/WebTerminalHandler", ensureCapability(cloudhub.CapabilityTerminal, service.WebTerminalHandler))
 
 	/* Health */
 	router.GET("/ping", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
@@ -173,13 +197,13 @@ func NewMux(opts MuxOpts, service Service) http.Handler {
 	router.DELETE("/cloudhub/v1/mappings/:id", EnsureSuperAdmin(service.RemoveMapping))
 
 	// Sources
-	router.GET("/cloudhub/v1/sources", EnsureViewer(service.Sources))
+	router.GET("/cloudhub/v1/sources", EnsureMember(service.Sources))
 	router.POST("/cloudhub/v1/sources", EnsureEditor(service.NewSource))
 
-	router.GET("/cloudhub/v1/sources/:id", EnsureViewer(service.SourcesID))
-	router.PATCH("/cloudhub/v1/sources/:id", EnsureEditor(service.UpdateSource))
-	router.DELETE("/cloudhub/v1/sources/:id", EnsureEditor(service.RemoveSource))
-	router.GET("/cloudhub/v1/sources/:id/health", EnsureViewer(service.SourceHealth))
+	router.GET("/cloudhub/v1/sources/:id", ensureSource(cloudhub.PermissionRead, service.SourcesID))
+	router.PATCH("/cloudhub/v1/sources/:id", ensureSource(cloudhub.PermissionWrite, service.UpdateSource))
+	router.DELETE("/cloudhub/v1/sources/:id", ensureSource(cloudhub.PermissionWrite, service.RemoveSource))
+	router.GET("/cloudhub/v1/sources/:id/health", ensureSource(cloudhub.PermissionRead, service.SourceHealth))
 
 	// Flux
 	router.GET("/cloudhub/v1/flux", EnsureViewer(service.Flux))
@@ -188,15 +212,23 @@ func NewMux(opts MuxOpts, service Service) http.Handler {
 	router.GET("/cloudhub/v1/flux/suggestions/:name", EnsureViewer(service.FluxSuggestion))
 
 	// Source Proxy to Influx; Has gzip compression around the handler
-	influx := gziphandler.GzipHandler(EnsureViewer(service.Influx))
+	influx := gziphandler.GzipHandler(ensureSource(cloudhub.PermissionRead, service.Influx))
 	router.Handler("POST", "/cloudhub/v1/sources/:id/proxy", influx)
 
+	// Export of the results of queries as files
+	router.POST("/cloudhub/v1/sources/:id/proxy/export", ensureSource(cloudhub.PermissionRead, service.ExportQuery))
+
+	// Use of the cache of query results of the Influx proxy
+	router.GET("/cloudhub/v1/sources/:id/proxy/cache", ensureSource(cloudhub.PermissionRead, service.InfluxCache))
+	router.DELETE("/cloudhub/v1/sources/:id/proxy/cache", ensureSource(cloudhub.PermissionWrite, service.PurgeInfluxCache))
+
 	// Source Proxy to Influx's flux endpoint; compression because the responses from
 	// flux could be large.
-	router.POST("/cloudhub/v1/sources/:id/proxy/flux", EnsureViewer(service.ProxyFlux))
+	router.POST("/cloudhub/v1/sources/:id/proxy/flux", ensureSource(cloudhub.PermissionRead, service.ProxyFlux))
 
 	// Write proxies line protocol write requests to InfluxDB
-	router.POST("/cloudhub/v1/sources/:id/write", EnsureViewer(service.Write))
+	router.POST("/cloudhub/v1/sources/:id/write", ensureSource(cloudhub.PermissionWrite, service.Write))
+	router.POST("/cloudhub/v1/sources/:id/import", ensureSource(cloudhub.PermissionWrite, service.Import))
 
 	// Queries is used to analyze a specific queries and does not create any
 	// resources. It's a POST because Queries are POSTed to InfluxDB, but this
@@ -204,72 +236,96 @@ func NewMux(opts MuxOpts, service Service) http.Handler {
 	//
 	// Admins should ensure that the InfluxDB source as the proper permissions
 	// intended for CloudHub Users with the Viewer Role type.
-	router.POST("/cloudhub/v1/sources/:id/queries", EnsureViewer(service.Queries))
+	router.POST("/cloudhub/v1/sources/:id/queries", ensureSource(cloudhub.PermissionRead, service.Queries))
+	router.POST("/cloudhub/v1/sources/:id/queries/flux", ensureSource(cloudhub.PermissionRead, service.TranslateFlux))
 
 	// Annotations are user-defined events associated with this source
-	router.GET("/cloudhub/v1/sources/:id/annotations", EnsureViewer(service.Annotations))
-	router.POST("/cloudhub/v1/sources/:id/annotations", EnsureEditor(service.NewAnnotation))
-	router.GET("/cloudhub/v1/sources/:id/annotations/:aid", EnsureViewer(service.Annotation))
-	router.DELETE("/cloudhub/v1/sources/:id/annotations/:aid", EnsureEditor(service.RemoveAnnotation))
-	router.PATCH("/cloudhub/v1/sources/:id/annotations/:aid", EnsureEditor(service.UpdateAnnotation))
+	router.GET("/cloudhub/v1/sources/:id/annotations", ensureSource(cloudhub.PermissionRead, service.Annotations))
+	router.POST("/cloudhub/v1/sources/:id/annotations", ensureSource(cloudhub.PermissionWrite, service.NewAnnotation))
+	router.GET("/cloudhub/v1/sources/:id/annotations/:aid", ensureSource(cloudhub.PermissionRead, service.Annotation))
+	router.DELETE("/cloudhub/v1/sources/:id/annotations/:aid", ensureSource(cloudhub.PermissionWrite, service.RemoveAnnotation))
+	router.PATCH("/cloudhub/v1/sources/:id/annotations/:aid", ensureSource(cloudhub.PermissionWrite, service.UpdateAnnotation))
 
 	// All possible permissions for users in this source
-	router.GET("/cloudhub/v1/sources/:id/permissions", EnsureViewer(service.Permissions))
+	router.GET("/cloudhub/v1/sources/:id/permissions", ensureSource(cloudhub.PermissionRead, service.Permissions))
 
 	// Users associated with the data source
-	router.GET("/cloudhub/v1/sources/:id/users", EnsureAdmin(service.SourceUsers))
-	router.POST("/cloudhub/v1/sources/:id/users", EnsureAdmin(service.NewSourceUser))
+	router.GET("/cloudhub/v1/sources/:id/users", ensureSource(cloudhub.PermissionAdmin, service.SourceUsers))
+	router.POST("/cloudhub/v1/sources/:id/users", ensureSource(cloudhub.PermissionAdmin, service.NewSourceUser))
 
-	router.GET("/cloudhub/v1/sources/:id/users/:uid", EnsureAdmin(service.SourceUserID))
-	router.DELETE("/cloudhub/v1/sources/:id/users/:uid", EnsureAdmin(service.RemoveSourceUser))
-	router.PATCH("/cloudhub/v1/sources/:id/users/:uid", EnsureAdmin(service.UpdateSourceUser))
+	router.GET("/cloudhub/v1/sources/:id/users/:uid", ensureSource(cloudhub.PermissionAdmin, service.SourceUserID))
+	router.DELETE("/cloudhub/v1/sources/:id/users/:uid", ensureSource(cloudhub.PermissionAdmin, service.RemoveSourceUser))
+	router.PATCH("/cloudhub/v1/sources/:id/users/:uid", ensureSource(cloudhub.PermissionAdmin, service.UpdateSourceUser))
 
 	// Roles associated with the data source
-	router.GET("/cloudhub/v1/sources/:id/roles", EnsureViewer(service.SourceRoles))
-	router.POST("/cloudhub/v1/sources/:id/roles", EnsureEditor(service.NewSourceRole))
+	router.GET("/cloudhub/v1/sources/:id/roles", ensureSource(cloudhub.PermissionRead, service.SourceRoles))
+	router.POST("/cloudhub/v1/sources/:id/roles", ensureSource(cloudhub.PermissionWrite, service.NewSourceRole))
 
-	router.GET("/cloudhub/v1/sources/:id/roles/:rid", EnsureViewer(service.SourceRoleID))
-	router.DELETE("/cloudhub/v1/sources/:id/roles/:rid", EnsureEditor(service.RemoveSourceRole))
-	router.PATCH("/cloudhub/v1/sources/:id/roles/:rid", EnsureEditor(service.UpdateSourceRole))
+	router.GET("/cloudhub/v1/sources/:id/roles/:rid", ensureSource(cloudhub.PermissionRead, service.SourceRoleID))
+	router.DELETE("/cloudhub/v1/sources/:id/roles/:rid", ensureSource(cloudhub.PermissionWrite, service.RemoveSourceRole))
+	router.PATCH("/cloudhub/v1/sources/:id/roles/:rid", ensureSource(cloudhub.PermissionWrite, service.UpdateSourceRole))
 
 	// Services are resources that cloudhub proxies to
-	router.GET("/cloudhub/v1/sources/:id/services", EnsureViewer(service.Services))
-	router.POST("/cloudhub/v1/sources/:id/services", EnsureEditor(service.NewService))
-	router.GET("/cloudhub/v1/sources/:id/services/:kid", EnsureViewer(service.ServiceID))
-	router.PATCH("/cloudhub/v1/sources/:id/services/:kid", EnsureEditor(service.UpdateService))
-	router.DELETE("/cloudhub/v1/sources/:id/services/:kid", EnsureEditor(service.RemoveService))
+	router.GET("/cloudhub/v1/sources/:id/services", ensureSource(cloudhub.PermissionRead, service.Services))
+	router.POST("/cloudhub/v1/sources/:id/services", ensureSource(cloudhub.PermissionWrite, service.NewService))
+	router.GET("/cloudhub/v1/sources/:id/services/:kid", ensureSource(cloudhub.PermissionRead, service.ServiceID))
+	router.PATCH("/cloudhub/v1/sources/:id/services/:kid", ensureSource(cloudhub.PermissionWrite, service.UpdateService))
+	router.DELETE("/cloudhub/v1/sources/:id/services/:kid", ensureSource(cloudhub.PermissionWrite, service.RemoveService))
 
 	// Service Proxy
-	router.GET("/cloudhub/v1/sources/:id/services/:kid/proxy", EnsureViewer(service.ProxyGet))
-	router.POST("/cloudhub/v1/sources/:id/services/:kid/proxy", EnsureEditor(service.ProxyPost))
-	router.PATCH("/cloudhub/v1/sources/:id/services/:kid/proxy", EnsureEditor(service.ProxyPatch))
-	router.DELETE("/cloudhub/v1/sources/:id/services/:kid/proxy", EnsureEditor(service.ProxyDelete))
+	router.GET("/cloudhub/v1/sources/:id/services/:kid/proxy", ensureSource(cloudhub.PermissionRead, service.ProxyGet))
+	router.POST("/cloudhub/v1/sources/:id/services/:kid/proxy", ensureSource(cloudhub.PermissionWrite, service.ProxyPost))
+	router.PATCH("/cloudhub/v1/sources/:id/services/:kid/proxy", ensureSource(cloudhub.PermissionWrite, service.ProxyPatch))
+	router.DELETE("/cloudhub/v1/sources/:id/services/:kid/proxy", ensureSource(cloudhub.PermissionWrite, service.ProxyDelete))
 
 	// Salt Proxy
-	router.POST("/cloudhub/v1/proxy/salt", EnsureViewer(service.SaltProxyPost))
+	router.POST("/cloudhub/v1/proxy/salt", ensureCapability(cloudhub.CapabilitySalt, service.SaltProxyPost))
 
 	// Kapacitor
-	router.GET("/cloudhub/v1/sources/:id/kapacitors", EnsureViewer(service.Kapacitors))
-	router.POST("/cloudhub/v1/sources/:id/kapacitors", EnsureEditor(service.NewKapacitor))
+	router.GET("/cloudhub/v1/sources/:id/kapacitors", ensureSource(cloudhub.PermissionRead, service.Kapacitors))
+	router.POST("/cloudhub/v1/sources/:id/kapacitors", ensureSource(cloudhub.PermissionWrite, service.NewKapacitor))
 
-	router.GET("/cloudhub/v1/sources/:id/kapacitors/:kid", EnsureViewer(service.KapacitorsID))
-	router.PATCH("/cloudhub/v1/sources/:id/kapacitors/:kid", EnsureEditor(service.UpdateKapacitor))
-	router.DELETE("/cloudhub/v1/sources/:id/kapacitors/:kid", EnsureEditor(service.RemoveKapacitor))
+	router.GET("/cloudhub/v1/sources/:id/kapacitors/:kid", ensureSource(cloudhub.PermissionRead, service.KapacitorsID))
+	router.PATCH("/cloudhub/v1/sources/:id/kapacitors/:kid", ensureSource(cloudhub.PermissionWrite, service.UpdateKapacitor))
+	router.DELETE("/cloudhub/v1/sources/:id/kapacitors/:kid", ensureSource(cloudhub.PermissionWrite, service.RemoveKapacitor))
 
 	// Kapacitor rules
-	router.GET("/cloudhub/v1/sources/:id/kapacitors/:kid/rules", EnsureViewer(service.KapacitorRulesGet))
-	router.POST("/cloudhub/v1/sources/:id/kapacitors/:kid/rules", EnsureEditor(service.KapacitorRulesPost))
-
-	router.GET("/cloudhub/v1/sources/:id/kapacitors/:kid/rules/:tid", EnsureViewer(service.KapacitorRulesID))
-	router.PUT("/cloudhub/v1/sources/:id/kapacitors/:kid/rules/:tid", EnsureEditor(service.KapacitorRulesPut))
-	router.PATCH("/cloudhub/v1/sources/:id/kapacitors/:kid/rules/:tid", EnsureEditor(service.KapacitorRulesStatus))
-	router.DELETE("/cloudhub/v1/sources/:id/kapacitors/:kid/rules/:tid", EnsureEditor(service.KapacitorRulesDelete))
+	router.GET("/cloudhub/v1/sources/:id/kapacitors/:kid/rules", ensureSource(cloudhub.PermissionRead, service.KapacitorRulesGet))
+	router.POST("/cloudhub/v1/sources/:id/kapacitors/:kid/rules", ensureSource(cloudhub.PermissionWrite, service.KapacitorRulesPost))
+
+	router.GET("/cloudhub/v1/sources/:id/kapacitors/:kid/rules/:tid", ensureSource(cloudhub.PermissionRead, service.KapacitorRulesID))
+	router.PUT("/cloudhub/v1/sources/:id/kapacitors/:kid/rules/:tid", ensureSource(cloudhub.PermissionWrite, service.KapacitorRulesPut))
+	router.PATCH("/cloudhub/v1/sources/:id/kapacitors/:kid/rules/:tid", ensureSource(cloudhub.PermissionWrite, service.KapacitorRulesStatus))
+	router.DELETE("/cloudhub/v1/sources/:id/kapacitors/:kid/rules/:tid", ensureSource(cloudhub.PermissionWrite, service.KapacitorRulesDelete))
+
+	// Kapacitor tasks not created by CloudHub
+	router.GET("/cloudhub/v1/sources/:id/kapacitors/:kid/adoptions", ensureSource(cloudhub.PermissionRead, service.KapacitorAdoptionsGet))
+	router.POST("/cloudhub/v1/sources/:id/kapacitors/:kid/adoptions", ensureSource(cloudhub.PermissionWrite, service.KapacitorAdoptionsPost))
+
+	// Kapacitor export, import and mirroring of CloudHub tasks
+	router.GET("/cloudhub/v1/sources/:id/kapacitors/:kid/export", ensureSource(cloudhub.PermissionRead, service.KapacitorExport))
+	router.POST("/cloudhub/v1/sources/:id/kapacitors/:kid/import", ensureSource(cloudhub.PermissionWrite, service.KapacitorImport))
+	router.POST("/cloudhub/v1/sources/:id/kapacitors/:kid/mirror", ensureSource(cloudhub.PermissionWrite, service.KapacitorMirror))
+
+	// Kapacitor service configuration
+	router.GET("/cloudhub/v1/sources/:id/kapacitors/:kid/config", ensureSource(cloudhub.PermissionRead, service.KapacitorConfig))
+	router.GET("/cloudhub/v1/sources/:id/kapacitors/:kid/config/:section", ensureSource(cloudhub.PermissionRead, service.KapacitorConfigSection))
+	router.PATCH("/cloudhub/v1/sources/:id/kapacitors/:kid/config/:section", ensureSource(cloudhub.PermissionWrite, service.UpdateKapacitorConfigSection))
+	router.POST("/cloudhub/v1/sources/:id/kapacitors/:kid/config/:section/test", ensureSource(cloudhub.PermissionWrite, service.KapacitorConfigSectionTest))
+
+	// Kapacitor alert topic handlers
+	router.GET("/cloudhub/v1/sources/:id/kapacitors/:kid/topics", ensureSource(cloudhub.PermissionRead, service.KapacitorTopics))
+	router.GET("/cloudhub/v1/sources/:id/kapacitors/:kid/topics/:topic/handlers", ensureSource(cloudhub.PermissionRead, service.KapacitorTopicHandlers))
+	router.POST("/cloudhub/v1/sources/:id/kapacitors/:kid/topics/:topic/handlers", ensureSource(cloudhub.PermissionWrite, service.NewKapacitorTopicHandler))
+	router.GET("/cloudhub/v1/sources/:id/kapacitors/:kid/topics/:topic/handlers/:hid", ensureSource(cloudhub.PermissionRead, service.KapacitorTopicHandlerID))
+	router.PUT("/cloudhub/v1/sources/:id/kapacitors/:kid/topics/:topic/handlers/:hid", ensureSource(cloudhub.PermissionWrite, service.ReplaceKapacitorTopicHandler))
+	router.DELETE("/cloudhub/v1/sources/:id/kapacitors/:kid/topics/:topic/handlers/:hid", ensureSource(cloudhub.PermissionWrite, service.RemoveKapacitorTopicHandler))
 
 	// Kapacitor Proxy
-	router.GET("/cloudhub/v1/sources/:id/kapacitors/:kid/proxy", EnsureViewer(service.ProxyGet))
-	router.POST("/cloudhub/v1/sources/:id/kapacitors/:kid/proxy", EnsureEditor(service.ProxyPost))
-	router.PATCH("/cloudhub/v1/sources/:id/kapacitors/:kid/proxy", EnsureEditor(service.ProxyPatch))
-	router.DELETE("/cloudhub/v1/sources/:id/kapacitors/:kid/proxy", EnsureEditor(service.ProxyDelete))
+	router.GET("/cloudhub/v1/sources/:id/kapacitors/:kid/proxy", ensureSource(cloudhub.PermissionRead, service.ProxyGet))
+	router.POST("/cloudhub/v1/sources/:id/kapacitors/:kid/proxy", ensureSource(cloudhub.PermissionWrite, service.ProxyPost))
+	router.PATCH("/cloudhub/v1/sources/:id/kapacitors/:kid/proxy", ensureSource(cloudhub.PermissionWrite, service.ProxyPatch))
+	router.DELETE("/cloudhub/v1/sources/:id/kapacitors/:kid/proxy", ensureSource(cloudhub.PermissionWrite, service.ProxyDelete))
 
 	// Layouts
 	router.GET("/cloudhub/v1/layouts", EnsureViewer(service.Layouts))
@@ -285,6 +341,25 @@ func NewMux(opts MuxOpts, service Service) http.Handler {
 	// Set current cloudhub organization the user is logged into
 	router.PUT("/cloudhub/v1/me", service.UpdateMe(opts.Auth))
 
+	// Change the password of the current local user
+	router.PUT("/cloudhub/v1/me/password", service.UpdateMePassword)
+
+	// Two-factor authentication of the current user
+	router.GET("/cloudhub/v1/me/2fa", service.MeTwoFactor)
+	router.POST("/cloudhub/v1/me/2fa", service.NewMeTwoFactor)
+	router.PUT("/cloudhub/v1/me/2fa", service.UpdateMeTwoFactor)
+	router.DELETE("/cloudhub/v1/me/2fa", service.RemoveMeTwoFactor)
+	router.POST("/cloudhub/v1/me/2fa/backup_codes", service.NewMeBackupCodes)
+
+	// Personal API tokens of the current user
+	router.GET("/cloudhub/v1/me/tokens", service.MeAPITokens)
+	router.POST("/cloudhub/v1/me/tokens", service.NewMeAPIToken)
+	router.DELETE("/cloudhub/v1/me/tokens/:id", service.RemoveMeAPIToken)
+
+	// Sessions of the current user
+	router.GET("/cloudhub/v1/me/sessions", service.MeSessions)
+	router.DELETE("/cloudhub/v1/me/sessions/:id", service.RemoveMeSession)
+
 	// TODO: what to do about admin's being able to set superadmin
 	router.GET("/cloudhub/v1/organizations/:oid/users", EnsureAdmin(ensureOrgMatches(service.Users)))
 	router.POST("/cloudhub/v1/organizations/:oid/users", EnsureAdmin(ensureOrgMatches(service.NewUser)))
@@ -292,6 +367,13 @@ func NewMux(opts MuxOpts, service Service) http.Handler {
 	router.GET("/cloudhub/v1/organizations/:oid/users/:id", EnsureAdmin(ensureOrgMatches(service.UserID)))
 	router.DELETE("/cloudhub/v1/organizations/:oid/users/:id", EnsureAdmin(ensureOrgMatches(service.RemoveUser)))
 	router.PATCH("/cloudhub/v1/organizations/:oid/users/:id", EnsureAdmin(ensureOrgMatches(service.UpdateUser)))
+	router.PUT("/cloudhub/v1/organizations/:oid/users/:id/password", EnsureAdmin(ensureOrgMatches(service.ResetUserPassword)))
+	router.DELETE("/cloudhub/v1/organizations/:oid/users/:id/2fa", EnsureAdmin(ensureOrgMatches(service.ResetUserTwoFactor)))
+
+	// API tokens of the service accounts of an organization
+	router.GET("/cloudhub/v1/organizations/:oid/users/:id/tokens", EnsureAdmin(ensureOrgMatches(service.ServiceAccountTokens)))
+	router.POST("/cloudhub/v1/organizations/:oid/users/:id/tokens", EnsureAdmin(ensureOrgMatches(service.NewServiceAccountToken)))
+	router.DELETE("/cloudhub/v1/organizations/:oid/users/:id/tokens/:tid", EnsureAdmin(ensureOrgMatches(service.RemoveServiceAccountToken)))
 
 	router.GET("/cloudhub/v1/users", EnsureSuperAdmin(rawStoreAccess(service.Users)))
 	router.POST("/cloudhub/v1/users", EnsureSuperAdmin(rawStoreAccess(service.NewUser)))
@@ -299,47 +381,79 @@ func NewMux(opts MuxOpts, service Service) http.Handler {
 	router.GET("/cloudhub/v1/users/:id", EnsureSuperAdmin(rawStoreAccess(service.UserID)))
 	router.DELETE("/cloudhub/v1/users/:id", EnsureSuperAdmin(rawStoreAccess(service.RemoveUser)))
 	router.PATCH("/cloudhub/v1/users/:id", EnsureSuperAdmin(rawStoreAccess(service.UpdateUser)))
+	router.PUT("/cloudhub/v1/users/:id/password", EnsureSuperAdmin(rawStoreAccess(service.ResetUserPassword)))
+	router.DELETE("/cloudhub/v1/users/:id/2fa", EnsureSuperAdmin(rawStoreAccess(service.ResetUserTwoFactor)))
+
+	// Sessions of all users
+	router.GET("/cloudhub/v1/sessions", EnsureSuperAdmin(rawStoreAccess(service.Sessions)))
+	router.DELETE("/cloudhub/v1/sessions/:id", EnsureSuperAdmin(rawStoreAccess(service.RemoveSession)))
+
+	// Policies of the dashboards, sources and capabilities of the organization
+	router.GET("/cloudhub/v1/policies", EnsureMember(service.Policies))
+	router.POST("/cloudhub/v1/policies", EnsureMember(service.NewPolicy))
+
+	router.GET("/cloudhub/v1/policies/:id", EnsureMember(service.PolicyID))
+	router.PUT("/cloudhub/v1/policies/:id", EnsureMember(service.ReplacePolicy))
+	router.DELETE("/cloudhub/v1/policies/:id", EnsureMember(service.RemovePolicy))
 
 	// Dashboards
-	router.GET("/cloudhub/v1/dashboards", EnsureViewer(service.Dashboards))
+	router.GET("/cloudhub/v1/dashboards", EnsureMember(service.Dashboards))
 	router.POST("/cloudhub/v1/dashboards", EnsureEditor(service.NewDashboard))
 
-	router.GET("/cloudhub/v1/dashboards/:id", EnsureViewer(service.DashboardID))
-	router.DELETE("/cloudhub/v1/dashboards/:id", EnsureEditor(service.RemoveDashboard))
-	router.PUT("/cloudhub/v1/dashboards/:id", EnsureEditor(service.ReplaceDashboard))
-	router.PATCH("/cloudhub/v1/dashboards/:id", EnsureEditor(service.UpdateDashboard))
+	router.GET("/cloudhub/v1/dashboards/:id", ensureDashboard(cloudhub.PermissionRead, service.DashboardID))
+	router.DELETE("/cloudhub/v1/dashboards/:id", ensureDashboard(cloudhub.PermissionWrite, service.RemoveDashboard))
+	router.PUT("/cloudhub/v1/dashboards/:id", ensureDashboard(cloudhub.PermissionWrite, service.ReplaceDashboard))
+	router.PATCH("/cloudhub/v1/dashboards/:id", ensureDashboard(cloudhub.PermissionWrite, service.UpdateDashboard))
 
 	// Dashboard Cells
-	router.GET("/cloudhub/v1/dashboards/:id/cells", EnsureViewer(service.DashboardCells))
-	router.POST("/cloudhub/v1/dashboards/:id/cells", EnsureEditor(service.NewDashboardCell))
+	router.GET("/cloudhub/v1/dashboards/:id/cells", ensureDashboard(cloudhub.PermissionRead, service.DashboardCells))
+	router.POST("/cloudhub/v1/dashboards/:id/cells", ensureDashboard(cloudhub.PermissionWrite, service.NewDashboardCell))
+
+	router.GET("/cloudhub/v1/dashboards/:id/cells/:cid", ensureDashboard(cloudhub.PermissionRead, service.DashboardCellID))
+	router.DELETE("/cloudhub/v1/dashboards/:id/cells/:cid", ensureDashboard(cloudhub.PermissionWrite, service.RemoveDashboardCell))
+	router.PUT("/cloudhub/v1/dashboards/:id/cells/:cid", ensureDashboard(cloudhub.PermissionWrite, service.ReplaceDashboardCell))
 
-	router.GET("/cloudhub/v1/dashboards/:id/cells/:cid", EnsureViewer(service.DashboardCellID))
-	router.DELETE("/cloudhub/v1/dashboards/:id/cells/:cid", EnsureEditor(service.RemoveDashboardCell))
-	router.PUT("/cloudhub/v1/dashboards/:id/cells/:cid", EnsureEditor(service.ReplaceDashboardCell))
+	// Render the templates of the queries of a cell and run them on the server
+	router.POST("/cloudhub/v1/dashboards/:id/cells/:cid/render", ensureDashboard(cloudhub.PermissionRead, service.DashboardCellQueries))
+	router.POST("/cloudhub/v1/dashboards/:id/cells/:cid/execute", ensureDashboard(cloudhub.PermissionRead, service.ExecuteDashboardCell))
 
 	// Dashboard Templates
-	router.GET("/cloudhub/v1/dashboards/:id/templates", EnsureViewer(service.Templates))
-	router.POST("/cloudhub/v1/dashboards/:id/templates", EnsureEditor(service.NewTemplate))
+	router.GET("/cloudhub/v1/dashboards/:id/templates", ensureDashboard(cloudhub.PermissionRead, service.Templates))
+	router.POST("/cloudhub/v1/dashboards/:id/templates", ensureDashboard(cloudhub.PermissionWrite, service.NewTemplate))
 
-	router.GET("/cloudhub/v1/dashboards/:id/templates/:tid", EnsureViewer(service.TemplateID))
-	router.DELETE("/cloudhub/v1/dashboards/:id/templates/:tid", EnsureEditor(service.RemoveTemplate))
-	router.PUT("/cloudhub/v1/dashboards/:id/templates/:tid", EnsureEditor(service.ReplaceTemplate))
+	router.GET("/cloudhub/v1/dashboards/:id/templates/:tid", ensureDashboard(cloudhub.PermissionRead, service.TemplateID))
+	router.DELETE("/cloudhub/v1/dashboards/:id/templates/:tid", ensureDashboard(cloudhub.PermissionWrite, service.RemoveTemplate))
+	router.PUT("/cloudhub/v1/dashboards/:id/templates/:tid", ensureDashboard(cloudhub.PermissionWrite, service.ReplaceTemplate))
 
 	// Databases
-	router.GET("/cloudhub/v1/sources/:id/dbs", EnsureViewer(service.GetDatabases))
-	router.POST("/cloudhub/v1/sources/:id/dbs", EnsureEditor(service.NewDatabase))
+	router.GET("/cloudhub/v1/sources/:id/dbs", ensureSource(cloudhub.PermissionRead, service.GetDatabases))
+	router.POST("/cloudhub/v1/sources/:id/dbs", ensureDatabaseAdmin(service.NewDatabase))
 
-	router.DELETE("/cloudhub/v1/sources/:id/dbs/:db", EnsureEditor(service.DropDatabase))
+	router.DELETE("/cloudhub/v1/sources/:id/dbs/:db", ensureDatabaseAdmin(service.DropDatabase))
 
 	// Retention Policies
-	router.GET("/cloudhub/v1/sources/:id/dbs/:db/rps", EnsureViewer(service.RetentionPolicies))
-	router.POST("/cloudhub/v1/sources/:id/dbs/:db/rps", EnsureEditor(service.NewRetentionPolicy))
+	router.GET("/cloudhub/v1/sources/:id/dbs/:db/rps", ensureSource(cloudhub.PermissionRead, service.RetentionPolicies))
+	router.POST("/cloudhub/v1/sources/:id/dbs/:db/rps", ensureDatabaseAdmin(service.NewRetentionPolicy))
 
-	router.PUT("/cloudhub/v1/sources/:id/dbs/:db/rps/:rp", EnsureEditor(service.UpdateRetentionPolicy))
-	router.DELETE("/cloudhub/v1/sources/:id/dbs/:db/rps/:rp", EnsureEditor(service.DropRetentionPolicy))
+	router.PUT("/cloudhub/v1/sources/:id/dbs/:db/rps/:rp", ensureDatabaseAdmin(service.UpdateRetentionPolicy))
+	router.DELETE("/cloudhub/v1/sources/:id/dbs/:db/rps/:rp", ensureDatabaseAdmin(service.DropRetentionPolicy))
 
 	// Measurements
-	router.GET("/cloudhub/v1/sources/:id/dbs/:db/measurements", EnsureViewer(service.Measurements))
+	router.GET("/cloudhub/v1/sources/:id/dbs/:db/measurements", ensureSource(cloudhub.PermissionRead, service.Measurements))
+
+	// Schema
+	router.GET("/cloudhub/v1/sources/:id/dbs/:db/tags", ensureSource(cloudhub.PermissionRead, service.TagKeys))
+	router.GET("/cloudhub/v1/sources/:id/dbs/:db/tags/:key/values", ensureSource(cloudhub.PermissionRead, service.TagValues))
+	router.GET("/cloudhub/v1/sources/:id/dbs/:db/fields", ensureSource(cloudhub.PermissionRead, service.FieldKeys))
+	router.GET("/cloudhub/v1/sources/:id/dbs/:db/cardinality", ensureSource(cloudhub.PermissionRead, service.Cardinality))
+
+	// Continuous Queries
+	router.GET("/cloudhub/v1/sources/:id/dbs/:db/cqs", ensureSource(cloudhub.PermissionRead, service.ContinuousQueries))
+	router.POST("/cloudhub/v1/sources/:id/dbs/:db/cqs", ensureDatabaseAdmin(service.NewContinuousQuery))
+
+	router.GET("/cloudhub/v1/sources/:id/dbs/:db/cqs/:cq", ensureSource(cloudhub.PermissionRead, service.ContinuousQueryID))
+	router.PUT("/cloudhub/v1/sources/:id/dbs/:db/cqs/:cq", ensureDatabaseAdmin(service.UpdateContinuousQuery))
+	router.DELETE("/cloudhub/v1/sources/:id/dbs/:db/cqs/:cq", ensureDatabaseAdmin(service.DropContinuousQuery))
 
 	// Global application config for CloudHub
 	router.GET("/cloudhub/v1/config", EnsureSuperAdmin(service.Config))
@@ -353,6 +467,17 @@ func NewMux(opts MuxOpts, service Service) http.Handler {
 
 	router.GET("/cloudhub/v1/env", EnsureViewer(service.Environment))
 
+	// Alert rule templates
+	router.GET("/cloudhub/v1/alert_templates", EnsureViewer(service.AlertTemplates))
+	router.POST("/cloudhub/v1/alert_templates", EnsureEditor(service.NewAlertTemplate))
+
+	router.GET("/cloudhub/v1/alert_templates/:id", EnsureViewer(service.AlertTemplateID))
+	router.DELETE("/cloudhub/v1/alert_templates/:id", EnsureEditor(service.RemoveAlertTemplate))
+	router.PUT("/cloudhub/v1/alert_templates/:id", EnsureEditor(service.ReplaceAlertTemplate))
+
+	router.POST("/cloudhub/v1/alert_templates/:id/apply", EnsureEditor(service.ApplyAlertTemplate))
+	router.POST("/cloudhub/v1/alert_templates/:id/sync", EnsureEditor(service.SyncAlertTemplate))
+
 	// vspheres
 	router.GET("/cloudhub/v1/vspheres", EnsureViewer(service.Vspheres))
 	router.GET("/cloudhub/v1/vspheres/:id", EnsureViewer(service.VsphereID))
@@ -363,6 +488,28 @@ func NewMux(opts MuxOpts, service Service) http.Handler {
 	// Validates go templates for the js client
 	router.POST("/cloudhub/v1/validate_text_templates", EnsureViewer(service.ValidateTextTemplate))
 	
+	// SCIM 2.0 provisioning of users and groups by the identity provider
+	if opts.UseAuth && opts.SCIMToken != "" {
+		ensureSCIM := func(next http.HandlerFunc) http.HandlerFunc {
+			return AuthorizedSCIM(opts.SCIMToken, opts.Logger, next)
+		}
+		router.GET("/scim/v2/Users", ensureSCIM(service.SCIMUsers))
+		router.POST("/scim/v2/Users", ensureSCIM(service.NewSCIMUser))
+
+		router.GET("/scim/v2/Users/:id", ensureSCIM(service.SCIMUserID))
+		router.PUT("/scim/v2/Users/:id", ensureSCIM(service.ReplaceSCIMUser))
+		router.PATCH("/scim/v2/Users/:id", ensureSCIM(service.PatchSCIMUser))
+		router.DELETE("/scim/v2/Users/:id", ensureSCIM(service.RemoveSCIMUser))
+
+		router.GET("/scim/v2/Groups", ensureSCIM(service.SCIMGroups))
+		router.POST("/scim/v2/Groups", ensureSCIM(service.NewSCIMGroup))
+
+		router.GET("/scim/v2/Groups/:id", ensureSCIM(service.SCIMGroupID))
+		router.PUT("/scim/v2/Groups/:id", ensureSCIM(service.ReplaceSCIMGroup))
+		router.PATCH("/scim/v2/Groups/:id", ensureSCIM(service.PatchSCIMGroup))
+		router.DELETE("/scim/v2/Groups/:id", ensureSCIM(service.RemoveSCIMGroup))
+	}
+
 	allRoutes := &AllRoutes{
 		Logger:      opts.Logger,
 		StatusFeed:  opts.StatusFeedURL,
@@ -384,11 +531,11 @@ func NewMux(opts MuxOpts, service Service) http.Handler {
 	if opts.UseAuth {
 		// Encapsulate the router with OAuth2
 		var auth http.Handler
-		auth, allRoutes.AuthRoutes = AuthAPI(opts, router)
+		auth, allRoutes.AuthRoutes = AuthAPI(opts, service.Store, router)
 		allRoutes.LogoutLink = path.Join(opts.Basepath, "/oauth/logout")
 
 		// Create middleware that redirects to the appropriate provider logout
-		router.GET("/oauth/logout", logout("/", opts.Basepath, allRoutes.AuthRoutes))
+		router.GET("/oauth/logout", logout("/", opts.Basepath, allRoutes.AuthRoutes, service.Store, opts.Logger))
 		out = Logger(opts.Logger, FlushingHandler(auth))
 	} else {
 		out = Logger(opts.Logger, FlushingHandler(router))
@@ -398,7 +545,7 @@ func NewMux(opts MuxOpts, service Service) http.Handler {
 }
 
 // AuthAPI adds the OAuth routes if auth is enabled.
-func AuthAPI(opts MuxOpts, router cloudhub.Router) (http.Handler, AuthRoutes) {
+func AuthAPI(opts MuxOpts, store DataStore, router cloudhub.Router) (http.Handler, AuthRoutes) {
 	routes := AuthRoutes{}
 	for _, pf := range opts.ProviderFuncs {
 		pf(func(p oauth2.Provider, m oauth2.Mux) {
@@ -411,6 +558,15 @@ func AuthAPI(opts MuxOpts, router cloudhub.Router) (http.Handler, AuthRoutes) {
 			router.Handler("GET", loginPath, m.Login())
 			router.Handler("GET", logoutPath, m.Logout())
 			router.Handler("GET", callbackPath, m.Callback())
+			if _, ok := p.(oauth2.CredentialsProvider); ok {
+				// The login form of credentials posts to the callback
+				router.Handler("POST", callbackPath, m.Callback())
+			}
+			if mm, ok := m.(oauth2.MetadataMux); ok {
+				// The identity provider posts its responses to the callback
+				router.Handler("POST", callbackPath, m.Callback())
+				router.Handler("GET", path.Join("/oauth", urlName, "metadata"), mm.Metadata())
+			}
 			routes = append(routes, AuthRoute{
 				Name:  p.Name(),
 				Label: strings.Title(p.Name()),
@@ -425,12 +581,20 @@ func AuthAPI(opts MuxOpts, router cloudhub.Router) (http.Handler, AuthRoutes) {
 		})
 	}
 
+	if opts.TwoFactor != nil {
+		// The second step of logins pending their second factor
+		router.Handler("GET", "/oauth/2fa", opts.TwoFactor.Form())
+		router.Handler("POST", "/oauth/2fa", opts.TwoFactor.Verify())
+	}
+
 	rootPath := path.Join(opts.Basepath, "/cloudhub/v1")
 	logoutPath := path.Join(opts.Basepath, "/oauth/logout")
 
-	tokenMiddleware := AuthorizedToken(opts.Auth, opts.Logger, router)
+	tokenMiddleware := AuthorizedToken(opts.Auth, store, opts.Logger, router)
 	// Wrap the API with token validation middleware.
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Sessions authorized during the request record its client
+		r = r.WithContext(oauth2.WithClient(r.Context(), r))
 		cleanPath := path.Clean(r.URL.Path) // compare ignoring path garbage, trailing slashes, etc.
 		if (strings.HasPrefix(cleanPath, rootPath) && len(cleanPath) > len(rootPath)) || cleanPath == logoutPath {
 			tokenMiddleware.ServeHTTP(w, r)
@@ -13,8 +13,9 @@ import (
 )
 
 type organizationRequest struct {
-	Name        string `json:"name"`
-	DefaultRole string `json:"defaultRole"`
+	Name             string `json:"name"`
+	DefaultRole      string `json:"defaultRole"`
+	RequireTwoFactor *bool  `json:"requireTwoFactor,omitempty"`
 }
 
 func (r *organizationRequest) ValidCreate() error {
@@ -26,7 +27,7 @@ func (r *organizationRequest) ValidCreate() error {
 }
 
 func (r *organizationRequest) ValidUpdate() error {
-	if r.Name == "" && r.DefaultRole == "" {
+	if r.Name == "" && r.DefaultRole == "" && r.RequireTwoFactor == nil {
 		return fmt.Errorf("No fields to update")
 	}
 
@@ -117,6 +118,9 @@ func (s *Service) NewOrganization(w http.ResponseWriter, r *http.Request) {
 		Name:        req.Name,
 		DefaultRole: req.DefaultRole,
 	}
+	if req.RequireTwoFactor != nil {
+		org.RequireTwoFactor = *req.RequireTwoFactor
+	}
 
 	res, err := s.Store.Organizations(ctx).Add(ctx, org)
 	if err != nil {
@@ -202,6 +206,10 @@ func (s *Service) UpdateOrganization(w http.ResponseWriter, r *http.Request) {
 		org.DefaultRole = req.DefaultRole
 	}
 
+	if req.RequireTwoFactor != nil {
+		org.RequireTwoFactor = *req.RequireTwoFactor
+	}
+
 	err = s.Store.Organizations(ctx).Update(ctx, org)
 	if err != nil {
 		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
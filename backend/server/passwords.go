@@ -0,0 +1,130 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/oauth2"
+)
+
+type passwordRequest struct {
+	CurrentPassword string `json:"currentPassword,omitempty"`
+	Password        string `json:"password"`
+}
+
+// ResetUserPassword sets a new password of a local user, which also lifts
+// its lockout. Admins of an organization may only reset the passwords of
+// users of their organization alone; SuperAdmins may reset any.
+func (s *Service) ResetUserPassword(w http.ResponseWriter, r *http.Request) {
+	var req passwordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	idStr := httprouter.GetParamFromContext(ctx, "id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		Error(w, http.StatusBadRequest, fmt.Sprintf("invalid user id: %s", err.Error()), s.Logger)
+		return
+	}
+
+	// The user must be visible to the requester, but is checked and updated
+	// with all of its roles
+	if _, err := s.Store.Users(ctx).Get(ctx, cloudhub.UserQuery{ID: &id}); err != nil {
+		Error(w, http.StatusNotFound, err.Error(), s.Logger)
+		return
+	}
+	serverCtx := serverContext(ctx)
+	u, err := s.Store.Users(serverCtx).Get(serverCtx, cloudhub.UserQuery{ID: &id})
+	if err != nil {
+		Error(w, http.StatusNotFound, err.Error(), s.Logger)
+		return
+	}
+
+	if u.Provider != oauth2.LocalProvider {
+		invalidData(w, fmt.Errorf("Password is only supported for %s users", oauth2.LocalProvider), s.Logger)
+		return
+	}
+	if !hasSuperAdminContext(ctx) && (u.SuperAdmin || len(u.Roles) > 1) {
+		Error(w, http.StatusForbidden, "only SuperAdmins may reset the password of a SuperAdmin or of a user of other organizations", s.Logger)
+		return
+	}
+
+	if err := s.PasswordPolicy.SetPassword(u, req.Password); err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+	if err := s.Store.Users(serverCtx).Update(serverCtx, u); err != nil {
+		Error(w, http.StatusInternalServerError, err.Error(), s.Logger)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UpdateMePassword changes the password of the current local user, who
+// must provide its current password. Its other sessions are revoked.
+func (s *Service) UpdateMePassword(w http.ResponseWriter, r *http.Request) {
+	var req passwordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	p, err := getValidPrincipal(ctx)
+	if err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+	if p.Issuer != oauth2.LocalProvider {
+		invalidData(w, fmt.Errorf("Password is only supported for %s users", oauth2.LocalProvider), s.Logger)
+		return
+	}
+	scheme, err := getScheme(ctx)
+	if err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+
+	serverCtx := serverContext(ctx)
+	u, err := s.Store.Users(serverCtx).Get(serverCtx, cloudhub.UserQuery{
+		Name:     &p.Subject,
+		Provider: &p.Issuer,
+		Scheme:   &scheme,
+	})
+	if err != nil {
+		Error(w, http.StatusNotFound, err.Error(), s.Logger)
+		return
+	}
+
+	// Wrong current passwords count toward the lockout, as failed logins do
+	if err := s.Local.Verify(serverCtx, u, req.CurrentPassword); err == oauth2.ErrAuthentication {
+		Error(w, http.StatusForbidden, "current password is invalid", s.Logger)
+		return
+	} else if err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+	if err := s.PasswordPolicy.SetPassword(u, req.Password); err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+	if err := s.Store.Users(serverCtx).Update(serverCtx, u); err != nil {
+		Error(w, http.StatusInternalServerError, err.Error(), s.Logger)
+		return
+	}
+	// Sessions logged in with the previous password are logged out
+	if err := s.revokeSessions(ctx, u, "", p.SessionID); err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,301 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+	"github.com/snetsystems/cloudhub/backend/oauth2"
+)
+
+func localUser(t *testing.T, id uint64, password string) *cloudhub.User {
+	u := &cloudhub.User{
+		ID:       id,
+		Name:     fmt.Sprintf("user%d", id),
+		Provider: oauth2.LocalProvider,
+		Scheme:   "oauth2",
+		Roles:    []cloudhub.Role{{Organization: "1", Name: "viewer"}},
+	}
+	if err := (oauth2.PasswordPolicy{}).SetPassword(u, password); err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestService_ResetUserPassword(t *testing.T) {
+	locked := localUser(t, 1, "old password")
+	locked.FailedLogins = 2
+	locked.LockedUntil = time.Now().Add(time.Hour)
+	superAdmin := localUser(t, 2, "old password")
+	superAdmin.SuperAdmin = true
+	github := &cloudhub.User{ID: 3, Name: "octocat", Provider: "github", Scheme: "oauth2"}
+
+	tests := []struct {
+		name       string
+		id         string
+		body       string
+		requester  *cloudhub.User
+		wantStatus int
+	}{
+		{
+			name:       "Admin resets the password of a locked out user",
+			id:         "1",
+			body:       `{"password": "new password"}`,
+			requester:  &cloudhub.User{ID: 9, Name: "admin"},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "Password violates the policy",
+			id:         "1",
+			body:       `{"password": "short"}`,
+			requester:  &cloudhub.User{ID: 9, Name: "admin"},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Admin resets the password of a SuperAdmin",
+			id:         "2",
+			body:       `{"password": "new password"}`,
+			requester:  &cloudhub.User{ID: 9, Name: "admin"},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "SuperAdmin resets the password of a SuperAdmin",
+			id:         "2",
+			body:       `{"password": "new password"}`,
+			requester:  &cloudhub.User{ID: 9, Name: "admin", SuperAdmin: true},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "User of another provider",
+			id:         "3",
+			body:       `{"password": "new password"}`,
+			requester:  &cloudhub.User{ID: 9, Name: "admin", SuperAdmin: true},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Unknown user",
+			id:         "4",
+			body:       `{"password": "new password"}`,
+			requester:  &cloudhub.User{ID: 9, Name: "admin", SuperAdmin: true},
+			wantStatus: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var updated *cloudhub.User
+			s := &Service{
+				Store: &mocks.Store{
+					UsersStore: &mocks.UsersStore{
+						GetF: func(ctx context.Context, q cloudhub.UserQuery) (*cloudhub.User, error) {
+							for _, u := range []*cloudhub.User{locked, superAdmin, github} {
+								if u.ID == *q.ID {
+									cp := *u
+									return &cp, nil
+								}
+							}
+							return nil, cloudhub.ErrUserNotFound
+						},
+						UpdateF: func(ctx context.Context, u *cloudhub.User) error {
+							updated = u
+							return nil
+						},
+					},
+				},
+				Logger:         log.New(log.DebugLevel),
+				PasswordPolicy: oauth2.PasswordPolicy{MinLength: 8},
+			}
+
+			r := httptest.NewRequest("PUT", "http://any.url", strings.NewReader(tt.body))
+			ctx := httprouter.WithParams(context.Background(), httprouter.Params{{Key: "id", Value: tt.id}})
+			ctx = context.WithValue(ctx, UserContextKey, tt.requester)
+			w := httptest.NewRecorder()
+			s.ResetUserPassword(w, r.WithContext(ctx))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("ResetUserPassword() = %v, want %v: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusNoContent {
+				if updated != nil {
+					t.Errorf("ResetUserPassword() updated the user")
+				}
+				return
+			}
+			if !oauth2.CheckPassword(updated, "new password") {
+				t.Errorf("ResetUserPassword() did not set the password")
+			}
+			if updated.FailedLogins != 0 || !updated.LockedUntil.IsZero() {
+				t.Errorf("ResetUserPassword() did not lift the lockout: %+v", updated)
+			}
+		})
+	}
+}
+
+func TestService_UpdateMePassword(t *testing.T) {
+	me := localUser(t, 1, "old password")
+
+	tests := []struct {
+		name       string
+		body       string
+		principal  oauth2.Principal
+		wantStatus int
+	}{
+		{
+			name:       "Change the password",
+			body:       `{"currentPassword": "old password", "password": "new password"}`,
+			principal:  oauth2.Principal{Subject: "user1", Issuer: "local"},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "Wrong current password",
+			body:       `{"currentPassword": "wrong", "password": "new password"}`,
+			principal:  oauth2.Principal{Subject: "user1", Issuer: "local"},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Password violates the policy",
+			body:       `{"currentPassword": "old password", "password": "short"}`,
+			principal:  oauth2.Principal{Subject: "user1", Issuer: "local"},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "User of another provider",
+			body:       `{"currentPassword": "old password", "password": "new password"}`,
+			principal:  oauth2.Principal{Subject: "user1", Issuer: "github"},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var updated *cloudhub.User
+			users := &mocks.UsersStore{
+				GetF: func(ctx context.Context, q cloudhub.UserQuery) (*cloudhub.User, error) {
+					if *q.Name == me.Name && *q.Provider == me.Provider {
+						cp := *me
+						return &cp, nil
+					}
+					return nil, cloudhub.ErrUserNotFound
+				},
+				UpdateF: func(ctx context.Context, u *cloudhub.User) error {
+					updated = u
+					return nil
+				},
+			}
+			s := &Service{
+				Store: &mocks.Store{
+					UsersStore: users,
+					SessionsStore: &mocks.SessionsStore{
+						AllF: func(ctx context.Context) ([]cloudhub.Session, error) {
+							return nil, nil
+						},
+					},
+				},
+				Logger:         log.New(log.DebugLevel),
+				PasswordPolicy: oauth2.PasswordPolicy{MinLength: 8},
+				Local:          &oauth2.Local{Users: users, Logger: log.New(log.DebugLevel)},
+			}
+
+			r := httptest.NewRequest("PUT", "http://any.url", strings.NewReader(tt.body))
+			ctx := context.WithValue(context.Background(), oauth2.PrincipalKey, tt.principal)
+			w := httptest.NewRecorder()
+			s.UpdateMePassword(w, r.WithContext(ctx))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("UpdateMePassword() = %v, want %v: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus == http.StatusNoContent && !oauth2.CheckPassword(updated, "new password") {
+				t.Errorf("UpdateMePassword() did not set the password")
+			}
+		})
+	}
+}
+
+func TestService_UpdateMePassword_Lockout(t *testing.T) {
+	me := localUser(t, 1, "old password")
+	users := &mocks.UsersStore{
+		GetF: func(ctx context.Context, q cloudhub.UserQuery) (*cloudhub.User, error) {
+			cp := *me
+			return &cp, nil
+		},
+		UpdateF: func(ctx context.Context, u *cloudhub.User) error {
+			*me = *u
+			return nil
+		},
+	}
+	s := &Service{
+		Store:          &mocks.Store{UsersStore: users},
+		Logger:         log.New(log.DebugLevel),
+		PasswordPolicy: oauth2.PasswordPolicy{MinLength: 8},
+		Local:          &oauth2.Local{Users: users, MaxAttempts: 2, LockoutDuration: time.Hour, Logger: log.New(log.DebugLevel)},
+	}
+
+	// The second wrong current password locks the user out, which then
+	// refuses the right one
+	for _, current := range []string{"wrong", "wrong", "old password"} {
+		r := httptest.NewRequest("PUT", "http://any.url", strings.NewReader(`{"currentPassword": "`+current+`", "password": "new password"}`))
+		ctx := context.WithValue(context.Background(), oauth2.PrincipalKey, oauth2.Principal{Subject: "user1", Issuer: "local"})
+		w := httptest.NewRecorder()
+		s.UpdateMePassword(w, r.WithContext(ctx))
+
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("UpdateMePassword() with %q = %v, want %v", current, w.Code, http.StatusForbidden)
+		}
+	}
+	if me.LockedUntil.IsZero() || !oauth2.CheckPassword(me, "old password") {
+		t.Errorf("UpdateMePassword() did not lock the user out: %+v", me)
+	}
+}
+
+func TestService_UpdateMePassword_RevokesSessions(t *testing.T) {
+	me := localUser(t, 1, "old password")
+	users := &mocks.UsersStore{
+		GetF: func(ctx context.Context, q cloudhub.UserQuery) (*cloudhub.User, error) {
+			cp := *me
+			return &cp, nil
+		},
+		UpdateF: func(ctx context.Context, u *cloudhub.User) error {
+			return nil
+		},
+	}
+	var revoked []string
+	s := &Service{
+		Store: &mocks.Store{
+			UsersStore: users,
+			SessionsStore: &mocks.SessionsStore{
+				AllF: func(ctx context.Context) ([]cloudhub.Session, error) {
+					return []cloudhub.Session{
+						{ID: "current", Subject: "user1", Provider: "local"},
+						{ID: "other", Subject: "user1", Provider: "local"},
+						{ID: "someone", Subject: "user2", Provider: "local"},
+					}, nil
+				},
+				DeleteF: func(ctx context.Context, session cloudhub.Session) error {
+					revoked = append(revoked, session.ID)
+					return nil
+				},
+			},
+		},
+		Logger:         log.New(log.DebugLevel),
+		PasswordPolicy: oauth2.PasswordPolicy{MinLength: 8},
+		Local:          &oauth2.Local{Users: users, Logger: log.New(log.DebugLevel)},
+	}
+
+	r := httptest.NewRequest("PUT", "http://any.url", strings.NewReader(`{"currentPassword": "old password", "password": "new password"}`))
+	ctx := context.WithValue(context.Background(), oauth2.PrincipalKey, oauth2.Principal{Subject: "user1", Issuer: "local", SessionID: "current"})
+	w := httptest.NewRecorder()
+	s.UpdateMePassword(w, r.WithContext(ctx))
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("UpdateMePassword() = %v, want %v: %s", w.Code, http.StatusNoContent, w.Body.String())
+	}
+	if len(revoked) != 1 || revoked[0] != "other" {
+		t.Errorf("UpdateMePassword() revoked %v, want only the other session of the user", revoked)
+	}
+}
@@ -0,0 +1,320 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/roles"
+)
+
+type policyRequest struct {
+	Resource   string `json:"resource"`
+	ResourceID string `json:"resourceId"`
+	UserID     uint64 `json:"userId,string,omitempty"`
+	Role       string `json:"role,omitempty"`
+	Permission string `json:"permission,omitempty"`
+}
+
+// Valid checks the kind of the resource, the grantee and the permission of
+// the policy
+func (r *policyRequest) Valid() error {
+	if r.ResourceID == "" {
+		return fmt.Errorf("resourceId required")
+	}
+	switch r.Resource {
+	case cloudhub.PolicyDashboard, cloudhub.PolicySource:
+		id, err := strconv.Atoi(r.ResourceID)
+		if err != nil {
+			return fmt.Errorf("invalid %s id %s", r.Resource, r.ResourceID)
+		}
+		r.ResourceID = strconv.Itoa(id)
+		if _, ok := permissionRanks[r.Permission]; !ok {
+			return fmt.Errorf("Unknown permission %s. Valid permissions are 'read', 'write' and 'admin'", r.Permission)
+		}
+	case cloudhub.PolicyCapability:
+		if _, ok := capabilityRoles[r.ResourceID]; !ok {
+			return fmt.Errorf("Unknown capability %s. Valid capabilities are 'terminal', 'salt' and 'database-admin'", r.ResourceID)
+		}
+		if r.Permission != "" {
+			return fmt.Errorf("policies of capabilities have no permission")
+		}
+	default:
+		return fmt.Errorf("Unknown resource %s. Valid resources are 'dashboard', 'source' and 'capability'", r.Resource)
+	}
+
+	if (r.UserID == 0) == (r.Role == "") {
+		return fmt.Errorf("policy must grant either a userId or a role")
+	}
+	if _, ok := roleRanks[r.Role]; r.Role != "" && !ok {
+		return fmt.Errorf("Unknown role %s. Valid roles are 'member', 'viewer', 'editor' and 'admin'", r.Role)
+	}
+	return nil
+}
+
+type policyResponse struct {
+	cloudhub.Policy
+	Links selfLinks `json:"links"`
+}
+
+func newPolicyResponse(p cloudhub.Policy) *policyResponse {
+	return &policyResponse{
+		Policy: p,
+		Links: selfLinks{
+			Self: fmt.Sprintf("/cloudhub/v1/policies/%s", p.ID),
+		},
+	}
+}
+
+type policiesResponse struct {
+	Links    selfLinks         `json:"links"`
+	Policies []*policyResponse `json:"policies"`
+}
+
+// policyManager returns whether the current user may manage the policies
+// of resources: admins of the organization manage all of them, and users
+// with the admin permission on a dashboard or source manage its policies.
+func (s *Service) policyManager(ctx context.Context) (func(resource, id string) bool, error) {
+	dashboards, err := s.authorizer().Permissions(ctx, cloudhub.PolicyDashboard)
+	if err != nil {
+		return nil, err
+	}
+	sources, err := s.authorizer().Permissions(ctx, cloudhub.PolicySource)
+	if err != nil {
+		return nil, err
+	}
+	role, ok := requester(ctx)
+	admin := !ok || role == roles.AdminRoleName
+
+	return func(resource, id string) bool {
+		switch resource {
+		case cloudhub.PolicyDashboard:
+			return dashboards(id) == cloudhub.PermissionAdmin
+		case cloudhub.PolicySource:
+			return sources(id) == cloudhub.PermissionAdmin
+		}
+		return admin
+	}, nil
+}
+
+// validPolicyTargets checks that the resource and the user of a policy are
+// in the organization
+func (s *Service) validPolicyTargets(ctx context.Context, req *policyRequest) error {
+	switch req.Resource {
+	case cloudhub.PolicyDashboard:
+		id, _ := strconv.Atoi(req.ResourceID)
+		if _, err := s.Store.Dashboards(ctx).Get(ctx, cloudhub.DashboardID(id)); err != nil {
+			return fmt.Errorf("dashboard %s not found", req.ResourceID)
+		}
+	case cloudhub.PolicySource:
+		id, _ := strconv.Atoi(req.ResourceID)
+		if _, err := s.Store.Sources(ctx).Get(ctx, id); err != nil {
+			return fmt.Errorf("source %s not found", req.ResourceID)
+		}
+	}
+	if req.UserID != 0 {
+		if _, err := s.Store.Users(ctx).Get(ctx, cloudhub.UserQuery{ID: &req.UserID}); err != nil {
+			return fmt.Errorf("user %d is not in the organization", req.UserID)
+		}
+	}
+	return nil
+}
+
+// Policies returns the policies of the organization that the current user
+// may manage, optionally of the resource given by the resource and
+// resourceId query parameters
+func (s *Service) Policies(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	all, err := s.Store.Policies(ctx).All(ctx)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, "Error loading policies", s.Logger)
+		return
+	}
+	manages, err := s.policyManager(ctx)
+	if err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+
+	resource := r.URL.Query().Get("resource")
+	resourceID := r.URL.Query().Get("resourceId")
+	res := &policiesResponse{
+		Links:    selfLinks{Self: "/cloudhub/v1/policies"},
+		Policies: []*policyResponse{},
+	}
+	for _, p := range all {
+		if (resource != "" && p.Resource != resource) || (resourceID != "" && p.ResourceID != resourceID) {
+			continue
+		}
+		if manages(p.Resource, p.ResourceID) {
+			res.Policies = append(res.Policies, newPolicyResponse(p))
+		}
+	}
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+// PolicyID returns a single policy
+func (s *Service) PolicyID(w http.ResponseWriter, r *http.Request) {
+	id, err := paramStr("id", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	p, err := s.Store.Policies(ctx).Get(ctx, id)
+	if err != nil {
+		notFound(w, id, s.Logger)
+		return
+	}
+	if !s.managesPolicy(w, ctx, p.Resource, p.ResourceID) {
+		return
+	}
+
+	encodeJSON(w, http.StatusOK, newPolicyResponse(p), s.Logger)
+}
+
+// managesPolicy ensures that the current user may manage the policies of a
+// resource
+func (s *Service) managesPolicy(w http.ResponseWriter, ctx context.Context, resource, id string) bool {
+	manages, err := s.policyManager(ctx)
+	if err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return false
+	}
+	if !manages(resource, id) {
+		Error(w, http.StatusForbidden, "User is not authorized", s.Logger)
+		return false
+	}
+	return true
+}
+
+// NewPolicy adds a policy to the organization
+func (s *Service) NewPolicy(w http.ResponseWriter, r *http.Request) {
+	var req policyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+	if err := req.Valid(); err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	if !s.managesPolicy(w, ctx, req.Resource, req.ResourceID) {
+		return
+	}
+	if err := s.validPolicyTargets(ctx, &req); err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+
+	p, err := s.Store.Policies(ctx).Add(ctx, cloudhub.Policy{
+		Resource:   req.Resource,
+		ResourceID: req.ResourceID,
+		UserID:     req.UserID,
+		Role:       req.Role,
+		Permission: req.Permission,
+	})
+	if err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+
+	res := newPolicyResponse(p)
+	location(w, res.Links.Self)
+	encodeJSON(w, http.StatusCreated, res, s.Logger)
+}
+
+// ReplacePolicy replaces the resource, grantee and permission of a policy
+func (s *Service) ReplacePolicy(w http.ResponseWriter, r *http.Request) {
+	id, err := paramStr("id", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return
+	}
+
+	var req policyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+	if err := req.Valid(); err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	p, err := s.Store.Policies(ctx).Get(ctx, id)
+	if err != nil {
+		notFound(w, id, s.Logger)
+		return
+	}
+	// The user must manage the policies of both the old and the new resource
+	if !s.managesPolicy(w, ctx, p.Resource, p.ResourceID) || !s.managesPolicy(w, ctx, req.Resource, req.ResourceID) {
+		return
+	}
+	if err := s.validPolicyTargets(ctx, &req); err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+
+	p.Resource = req.Resource
+	p.ResourceID = req.ResourceID
+	p.UserID = req.UserID
+	p.Role = req.Role
+	p.Permission = req.Permission
+	if err := s.Store.Policies(ctx).Update(ctx, p); err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+
+	encodeJSON(w, http.StatusOK, newPolicyResponse(p), s.Logger)
+}
+
+// RemovePolicy deletes a policy. Once a resource has no policies left, the
+// roles decide its permissions again.
+func (s *Service) RemovePolicy(w http.ResponseWriter, r *http.Request) {
+	id, err := paramStr("id", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	p, err := s.Store.Policies(ctx).Get(ctx, id)
+	if err != nil {
+		notFound(w, id, s.Logger)
+		return
+	}
+	if !s.managesPolicy(w, ctx, p.Resource, p.ResourceID) {
+		return
+	}
+
+	if err := s.Store.Policies(ctx).Delete(ctx, p); err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// removePolicies deletes the policies of a resource that was deleted
+func (s *Service) removePolicies(ctx context.Context, resource, id string) error {
+	policies, err := s.Store.Policies(ctx).All(ctx)
+	if err != nil {
+		return err
+	}
+	for _, p := range policies {
+		if p.Resource == resource && p.ResourceID == id {
+			if err := s.Store.Policies(ctx).Delete(ctx, p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+	"github.com/snetsystems/cloudhub/backend/roles"
+)
+
+func TestService_NewPolicy(t *testing.T) {
+	member := &cloudhub.User{ID: 7, Roles: []cloudhub.Role{{Organization: "1", Name: roles.MemberRoleName}}}
+	editor := &cloudhub.User{ID: 8, Roles: []cloudhub.Role{{Organization: "1", Name: roles.EditorRoleName}}}
+	admin := &cloudhub.User{ID: 9, Roles: []cloudhub.Role{{Organization: "1", Name: roles.AdminRoleName}}}
+
+	tests := []struct {
+		name       string
+		body       string
+		user       *cloudhub.User
+		role       string
+		wantStatus int
+	}{
+		{
+			name:       "Admin grants a capability to a role",
+			body:       `{"resource": "capability", "resourceId": "terminal", "role": "editor"}`,
+			user:       admin,
+			role:       roles.AdminRoleName,
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "Editor grants a capability",
+			body:       `{"resource": "capability", "resourceId": "terminal", "userId": "8"}`,
+			user:       editor,
+			role:       roles.EditorRoleName,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Editor grants a dashboard without policies",
+			body:       `{"resource": "dashboard", "resourceId": "1", "userId": "7", "permission": "read"}`,
+			user:       editor,
+			role:       roles.EditorRoleName,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Member administering a dashboard grants it",
+			body:       `{"resource": "dashboard", "resourceId": "3", "userId": "8", "permission": "write"}`,
+			user:       member,
+			role:       roles.MemberRoleName,
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "Policy of a user outside of the organization",
+			body:       `{"resource": "source", "resourceId": "1", "userId": "1337", "permission": "read"}`,
+			user:       admin,
+			role:       roles.AdminRoleName,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Policy of a missing dashboard",
+			body:       `{"resource": "dashboard", "resourceId": "1337", "role": "viewer", "permission": "read"}`,
+			user:       admin,
+			role:       roles.AdminRoleName,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Policy with both a user and a role",
+			body:       `{"resource": "source", "resourceId": "1", "userId": "7", "role": "viewer", "permission": "read"}`,
+			user:       admin,
+			role:       roles.AdminRoleName,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Policy of a capability with a permission",
+			body:       `{"resource": "capability", "resourceId": "salt", "role": "viewer", "permission": "read"}`,
+			user:       admin,
+			role:       roles.AdminRoleName,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Policy with an unknown permission",
+			body:       `{"resource": "source", "resourceId": "1", "role": "viewer", "permission": "drop"}`,
+			user:       admin,
+			role:       roles.AdminRoleName,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var added []cloudhub.Policy
+			store := policiesDataStore([]cloudhub.Policy{
+				{ID: "1", Resource: cloudhub.PolicyDashboard, ResourceID: "3", UserID: 7, Permission: cloudhub.PermissionAdmin},
+			})
+			store.PoliciesStore.(*mocks.PoliciesStore).AddF = func(ctx context.Context, p cloudhub.Policy) (cloudhub.Policy, error) {
+				p.ID = "2"
+				added = append(added, p)
+				return p, nil
+			}
+			store.DashboardsStore = &mocks.DashboardsStore{
+				GetF: func(ctx context.Context, id cloudhub.DashboardID) (cloudhub.Dashboard, error) {
+					if id > 3 {
+						return cloudhub.Dashboard{}, cloudhub.ErrDashboardNotFound
+					}
+					return cloudhub.Dashboard{ID: id}, nil
+				},
+			}
+			store.SourcesStore = &mocks.SourcesStore{
+				GetF: func(ctx context.Context, id int) (cloudhub.Source, error) {
+					return cloudhub.Source{ID: id}, nil
+				},
+			}
+			store.UsersStore = &mocks.UsersStore{
+				GetF: func(ctx context.Context, q cloudhub.UserQuery) (*cloudhub.User, error) {
+					if *q.ID > 9 {
+						return nil, cloudhub.ErrUserNotFound
+					}
+					return &cloudhub.User{ID: *q.ID}, nil
+				},
+			}
+			s := &Service{
+				Store:  store,
+				Logger: log.New(log.DebugLevel),
+			}
+
+			r := httptest.NewRequest("POST", "http://any.url/cloudhub/v1/policies", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			s.NewPolicy(w, r.WithContext(authorizerContext(tt.user, tt.role, nil)))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("NewPolicy() = %v, want %v: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if (tt.wantStatus == http.StatusCreated) != (len(added) == 1) {
+				t.Errorf("NewPolicy() added %v", added)
+			}
+		})
+	}
+}
+
+func TestService_Dashboards_Policies(t *testing.T) {
+	store := policiesDataStore([]cloudhub.Policy{
+		{Resource: cloudhub.PolicyDashboard, ResourceID: "2", UserID: 7, Permission: cloudhub.PermissionRead},
+	})
+	store.DashboardsStore = &mocks.DashboardsStore{
+		AllF: func(ctx context.Context) ([]cloudhub.Dashboard, error) {
+			return []cloudhub.Dashboard{{ID: 1}, {ID: 2}}, nil
+		},
+	}
+	s := &Service{
+		Store:  store,
+		Logger: log.New(log.DebugLevel),
+	}
+
+	tests := []struct {
+		name string
+		user *cloudhub.User
+		role string
+		want int
+	}{
+		{name: "Viewer lists the dashboards without policies", user: &cloudhub.User{ID: 8}, role: roles.ViewerRoleName, want: 1},
+		{name: "Member lists the dashboards granted", user: &cloudhub.User{ID: 7}, role: roles.MemberRoleName, want: 1},
+		{name: "Admin lists all dashboards", user: &cloudhub.User{ID: 9}, role: roles.AdminRoleName, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "http://any.url/cloudhub/v1/dashboards", nil)
+			w := httptest.NewRecorder()
+			s.Dashboards(w, r.WithContext(authorizerContext(tt.user, tt.role, nil)))
+			if w.Code != http.StatusOK {
+				t.Fatalf("Dashboards() = %v: %s", w.Code, w.Body.String())
+			}
+			if got := strings.Count(w.Body.String(), `"self":"/cloudhub/v1/dashboards/`); got != tt.want {
+				t.Errorf("Dashboards() listed %d dashboards, want %d: %s", got, tt.want, w.Body.String())
+			}
+		})
+	}
+}
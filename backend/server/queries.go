@@ -132,3 +132,76 @@ func (s *Service) DefaultRP(ctx context.Context, qc *cloudhub.QueryConfig, src *
 
 	return nil
 }
+
+// FluxTranslationRequest is an InfluxQL SELECT statement to translate to Flux
+type FluxTranslationRequest struct {
+	Query string              `json:"query"`
+	DB    string              `json:"db,omitempty"`    // DB of measurements without a database
+	RP    string              `json:"rp,omitempty"`    // RP of measurements without a retention policy
+	Shift *cloudhub.TimeShift `json:"shift,omitempty"` // Shift moves the time range of the query back
+}
+
+// TranslateFlux translates an InfluxQL SELECT statement to a Flux script of
+// the buckets of the source
+func (s *Service) TranslateFlux(w http.ResponseWriter, r *http.Request) {
+	srcID, err := paramID("id", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return
+	}
+
+	var req FluxTranslationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	src, err := s.Store.Sources(ctx).Get(ctx, srcID)
+	if err != nil {
+		notFound(w, srcID, s.Logger)
+		return
+	}
+	if src.Type == cloudhub.Prometheus {
+		Error(w, http.StatusBadRequest, "Prometheus sources have no Flux", s.Logger)
+		return
+	}
+
+	stmt, err := queries.ParseSelect(req.Query)
+	if err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+
+	opts := queries.FluxOptions{
+		DB: req.DB,
+		RP: req.RP,
+	}
+	if req.Shift != nil {
+		opts.Shift = req.Shift.Quantity + req.Shift.Unit
+	}
+	// InfluxDB 2.x buckets of databases and retention policies are mapped
+	if src.Type == cloudhub.InfluxDBv2 {
+		cli := &influx.Client{
+			Logger: s.Logger,
+		}
+		if err := cli.Connect(ctx, &src); err != nil {
+			Error(w, http.StatusBadRequest, fmt.Sprintf("Unable to connect to source: %v", err), s.Logger)
+			return
+		}
+		opts.From = func(db, rp string) (string, error) {
+			bucketID, err := cli.Bucket(ctx, db, rp)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("bucketID: %q", bucketID), nil
+		}
+	}
+
+	res, err := stmt.ToFlux(opts)
+	if err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
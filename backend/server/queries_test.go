@@ -3,12 +3,14 @@ package server
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/bouk/httprouter"
 	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/influx/queries"
 	"github.com/snetsystems/cloudhub/backend/mocks"
 )
 
@@ -109,3 +111,69 @@ func TestService_Queries(t *testing.T) {
 		})
 	}
 }
+
+func TestService_TranslateFlux(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		want   string
+	}{
+		{
+			name:   "Translates a SELECT statement",
+			body:   `{"query":"SELECT max(\"used\") FROM mem WHERE time > now() - 1h GROUP BY time(1m)","db":"telegraf","rp":"autogen","shift":{"label":"1d","unit":"d","quantity":"1"}}`,
+			status: http.StatusOK,
+			want: `from(bucket: "telegraf/autogen")
+  |> range(start: -25h, stop: -1d)
+  |> filter(fn: (r) => r._measurement == "mem")
+  |> filter(fn: (r) => r._field == "used")
+  |> group(columns: ["_measurement", "_field"])
+  |> aggregateWindow(every: 1m, fn: max, createEmpty: true)
+  |> timeShift(duration: 1d)
+`,
+		},
+		{
+			name:   "Statements other than SELECT",
+			body:   `{"query":"SHOW DATABASES"}`,
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "Statements Flux cannot express",
+			body:   `{"query":"SELECT used / total FROM mem","db":"telegraf"}`,
+			status: http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/queries/flux", bytes.NewReader([]byte(tt.body)))
+			r = r.WithContext(httprouter.WithParams(context.Background(), httprouter.Params{
+				{Key: "id", Value: "1"},
+			}))
+			w := httptest.NewRecorder()
+			s := &Service{
+				Store: &mocks.Store{
+					SourcesStore: &mocks.SourcesStore{
+						GetF: func(ctx context.Context, ID int) (cloudhub.Source, error) {
+							return cloudhub.Source{ID: ID}, nil
+						},
+					},
+				},
+				Logger: &mocks.TestLogger{},
+			}
+			s.TranslateFlux(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("TranslateFlux() status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.want == "" {
+				return
+			}
+			var got queries.FluxTranslation
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("TranslateFlux() response %s: %v", w.Body.String(), err)
+			}
+			if got.Flux != tt.want || got.Approximate {
+				t.Errorf("TranslateFlux() =\n%s\nwant\n%s", got.Flux, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/snetsystems/cloudhub/backend/influx"
+)
+
+// QueryGuard keeps users and organizations from overloading InfluxDB through
+// the Influx proxy. Queries are checked against the cost limits, then against
+// the number of queries running and sent per minute by the user and by the
+// organization. Zero values do not limit; a nil QueryGuard accepts every query.
+type QueryGuard struct {
+	Limits          influx.QueryLimits
+	UserConcurrency int // UserConcurrency is the number of queries a user may run at once
+	OrgConcurrency  int // OrgConcurrency is the number of queries an organization may run at once
+	UserRate        int // UserRate is the number of queries a user may send per minute
+	OrgRate         int // OrgRate is the number of queries an organization may send per minute
+	Now             func() time.Time
+
+	mu    sync.Mutex
+	users map[string]*queryQuota
+	orgs  map[string]*queryQuota
+}
+
+// queryQuota counts the running queries of a user or organization and keeps
+// a token bucket of the queries it may send
+type queryQuota struct {
+	running int
+	tokens  float64
+	last    time.Time
+}
+
+// refill fills the bucket of rate tokens per minute since the last query
+func (q *queryQuota) refill(now time.Time, rate int) {
+	if q.last.IsZero() {
+		q.tokens = float64(rate)
+	} else {
+		q.tokens = math.Min(float64(rate), q.tokens+now.Sub(q.last).Minutes()*float64(rate))
+	}
+	q.last = now
+}
+
+// queryLimitError is a query refused by a QueryGuard
+type queryLimitError struct {
+	status     int
+	msg        string
+	retryAfter time.Duration
+}
+
+func (e *queryLimitError) Error() string {
+	return e.msg
+}
+
+// Acquire checks an InfluxQL query of a user of an organization against the
+// guard. Either may be empty when authentication is off. The returned release
+// must be called once the query is done.
+func (g *QueryGuard) Acquire(user, org, query string) (release func(), err error) {
+	if g == nil {
+		return func() {}, nil
+	}
+
+	if err := g.Limits.Check(query, g.now()); err != nil {
+		return nil, &queryLimitError{
+			status: http.StatusUnprocessableEntity,
+			msg:    err.Error(),
+		}
+	}
+	return g.AcquireQuota(user, org)
+}
+
+// AcquireQuota checks a query of a user of an organization against the
+// running and per minute queries only, for languages the cost limits do not
+// apply to, such as Flux and PromQL. The returned release must be called
+// once the query is done.
+func (g *QueryGuard) AcquireQuota(user, org string) (release func(), err error) {
+	if g == nil {
+		return func() {}, nil
+	}
+
+	now := g.now()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.users == nil {
+		g.users = map[string]*queryQuota{}
+		g.orgs = map[string]*queryQuota{}
+	}
+
+	checks := []struct {
+		quotas      map[string]*queryQuota
+		key         string
+		concurrency int
+		rate        int
+		who         string
+	}{
+		{g.users, user, g.UserConcurrency, g.UserRate, "you have"},
+		{g.orgs, org, g.OrgConcurrency, g.OrgRate, "your organization has"},
+	}
+
+	// Nothing is taken unless both the user and the organization may query
+	var taken []*queryQuota
+	var rated []*queryQuota
+	for _, c := range checks {
+		if c.key == "" || (c.concurrency <= 0 && c.rate <= 0) {
+			continue
+		}
+		q, ok := c.quotas[c.key]
+		if !ok {
+			q = &queryQuota{}
+			c.quotas[c.key] = q
+		}
+
+		if c.concurrency > 0 {
+			if q.running >= c.concurrency {
+				return nil, &queryLimitError{
+					status:     http.StatusTooManyRequests,
+					msg:        fmt.Sprintf("%s %d queries running, the most allowed at once; retry when one is done", c.who, q.running),
+					retryAfter: time.Second,
+				}
+			}
+			taken = append(taken, q)
+		}
+		if c.rate > 0 {
+			q.refill(now, c.rate)
+			if q.tokens < 1 {
+				wait := time.Duration((1 - q.tokens) / float64(c.rate) * float64(time.Minute))
+				return nil, &queryLimitError{
+					status:     http.StatusTooManyRequests,
+					msg:        fmt.Sprintf("%s sent more than %d queries in the last minute; retry in %s", c.who, c.rate, wait.Round(time.Second)),
+					retryAfter: wait,
+				}
+			}
+			rated = append(rated, q)
+		}
+	}
+
+	for _, q := range rated {
+		q.tokens--
+	}
+	for _, q := range taken {
+		q.running++
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			g.mu.Lock()
+			for _, q := range taken {
+				q.running--
+			}
+			g.mu.Unlock()
+		})
+	}, nil
+}
+
+func (g *QueryGuard) now() time.Time {
+	if g.Now != nil {
+		return g.Now()
+	}
+	return time.Now()
+}
+
+// queryGuardError writes the refusal of a query by the QueryGuard
+func (s *Service) queryGuardError(w http.ResponseWriter, err error) {
+	qe, ok := err.(*queryLimitError)
+	if !ok {
+		Error(w, http.StatusInternalServerError, err.Error(), s.Logger)
+		return
+	}
+	if qe.retryAfter > 0 {
+		secs := int(math.Ceil(qe.retryAfter.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(secs))
+	}
+	Error(w, qe.status, qe.msg, s.Logger)
+}
+
+// queryGuardKeys identify the user and organization of a query for the
+// QueryGuard; they are empty without authentication
+func queryGuardKeys(ctx context.Context) (user, org string) {
+	if u, ok := hasUserContext(ctx); ok {
+		user = strconv.FormatUint(u.ID, 10)
+	}
+	org, _ = hasOrganizationContext(ctx)
+	return user, org
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bouk/httprouter"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/influx"
+	"github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+)
+
+const guardedQuery = `SELECT mean("usage_user") FROM "cpu" WHERE time > now() - 1h GROUP BY time(1m)`
+
+func TestQueryGuard_Concurrency(t *testing.T) {
+	g := &QueryGuard{
+		UserConcurrency: 1,
+		OrgConcurrency:  2,
+	}
+
+	release, err := g.Acquire("1", "default", guardedQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Acquire("1", "default", guardedQuery); err == nil || !strings.Contains(err.Error(), "you have 1 queries running") {
+		t.Errorf("QueryGuard.Acquire() second query of user = %v, want user concurrency error", err)
+	}
+	if _, err := g.Acquire("2", "default", guardedQuery); err != nil {
+		t.Errorf("QueryGuard.Acquire() query of another user = %v", err)
+	}
+	if _, err := g.Acquire("3", "default", guardedQuery); err == nil || !strings.Contains(err.Error(), "your organization has 2 queries running") {
+		t.Errorf("QueryGuard.Acquire() third query of organization = %v, want organization concurrency error", err)
+	}
+
+	release()
+	release()
+	if _, err := g.Acquire("1", "other", guardedQuery); err != nil {
+		t.Errorf("QueryGuard.Acquire() after release = %v", err)
+	}
+}
+
+func TestQueryGuard_Rate(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	g := &QueryGuard{
+		UserRate: 2,
+		OrgRate:  3,
+		Now:      func() time.Time { return now },
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := g.Acquire("1", "default", guardedQuery); err != nil {
+			t.Fatalf("QueryGuard.Acquire() query %d = %v", i, err)
+		}
+	}
+	_, err := g.Acquire("1", "default", guardedQuery)
+	qe, ok := err.(*queryLimitError)
+	if !ok || qe.status != http.StatusTooManyRequests || qe.retryAfter != 30*time.Second {
+		t.Fatalf("QueryGuard.Acquire() over user rate = %#v", err)
+	}
+
+	if _, err := g.Acquire("2", "default", guardedQuery); err != nil {
+		t.Errorf("QueryGuard.Acquire() query of another user = %v", err)
+	}
+	if _, err := g.Acquire("3", "default", guardedQuery); err == nil || !strings.Contains(err.Error(), "your organization has sent more than 3 queries") {
+		t.Errorf("QueryGuard.Acquire() over organization rate = %v", err)
+	}
+
+	// A query per 30s is given back
+	now = now.Add(30 * time.Second)
+	if _, err := g.Acquire("1", "other", guardedQuery); err != nil {
+		t.Errorf("QueryGuard.Acquire() after refill = %v", err)
+	}
+}
+
+func TestQueryGuard_AcquireQuota(t *testing.T) {
+	g := &QueryGuard{
+		Limits:          influx.QueryLimits{RequireTimeBounds: true},
+		UserConcurrency: 1,
+	}
+
+	// Flux and PromQL queries are not checked against the cost limits, but
+	// count against the running queries of InfluxQL ones
+	release, err := g.AcquireQuota("1", "default")
+	if err != nil {
+		t.Fatalf("QueryGuard.AcquireQuota() = %v", err)
+	}
+	if _, err := g.Acquire("1", "default", guardedQuery); err == nil || !strings.Contains(err.Error(), "you have 1 queries running") {
+		t.Errorf("QueryGuard.Acquire() while a Flux query runs = %v, want user concurrency error", err)
+	}
+	release()
+	if _, err := g.AcquireQuota("1", "default"); err != nil {
+		t.Errorf("QueryGuard.AcquireQuota() after release = %v", err)
+	}
+
+	var none *QueryGuard
+	if _, err := none.AcquireQuota("1", "default"); err != nil {
+		t.Errorf("nil QueryGuard.AcquireQuota() = %v", err)
+	}
+}
+
+func TestService_InfluxGuard(t *testing.T) {
+	h := &Service{
+		Store: &mocks.Store{
+			SourcesStore: &mocks.SourcesStore{
+				GetF: func(ctx context.Context, ID int) (cloudhub.Source, error) {
+					return cloudhub.Source{ID: ID}, nil
+				},
+			},
+		},
+		TimeSeriesClient: &mocks.TimeSeries{
+			ConnectF: func(ctx context.Context, src *cloudhub.Source) error {
+				return nil
+			},
+			QueryF: func(ctx context.Context, query cloudhub.Query) (cloudhub.Response, error) {
+				return mocks.NewResponse(`[]`, nil), nil
+			},
+		},
+		QueryGuard: &QueryGuard{
+			Limits: influx.QueryLimits{
+				RequireTimeBounds: true,
+			},
+			UserRate: 1,
+		},
+		QueryCache: influx.NewQueryCache(1024),
+		Logger:     log.New(log.DebugLevel),
+	}
+
+	post := func(query string) *http.Response {
+		body := `{"db":"telegraf","query":` + query + `}`
+		r := httptest.NewRequest("POST", "http://any.url", bytes.NewReader([]byte(body)))
+		ctx := httprouter.WithParams(context.Background(), httprouter.Params{
+			{
+				Key:   "id",
+				Value: "1",
+			},
+		})
+		ctx = context.WithValue(ctx, UserContextKey, &cloudhub.User{ID: 1})
+		w := httptest.NewRecorder()
+		h.Influx(w, r.WithContext(ctx))
+		return w.Result()
+	}
+
+	resp := post(`"SELECT \"usage_user\" FROM \"cpu\""`)
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusUnprocessableEntity || !strings.Contains(string(body), "a lower time bound is required") {
+		t.Errorf("Influx() without time bounds = %d %s", resp.StatusCode, body)
+	}
+
+	if resp := post(`"SELECT \"usage_user\" FROM \"cpu\" WHERE time > now() - 1h"`); resp.StatusCode != http.StatusOK {
+		t.Errorf("Influx() = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	// Cached results are not counted against the guard
+	resp = post(`"SELECT \"usage_user\" FROM \"cpu\" WHERE time > now() - 1h"`)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-CloudHub-Cache") != influx.CacheHit {
+		t.Errorf("Influx() of a cached query = %d, cache %q", resp.StatusCode, resp.Header.Get("X-CloudHub-Cache"))
+	}
+	resp = post(`"SELECT \"usage_user\" FROM \"cpu\" WHERE time > now() - 2h"`)
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("Influx() over rate = %d, Retry-After %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+}
@@ -50,6 +50,8 @@ type getRoutesResponse struct {
 	Addons             []getAddonLinksResponse            `json:"addons"`
 	Vspheres           string                             `json:"vspheres"`       // Location of the vspheres endpoint
 	ValidTextTemplates string                             `json:"validateTextTemplates"` // Location of the valid text templates endpoint
+	AlertTemplates     string                             `json:"alertTemplates"`        // Location of the alert rule templates endpoint
+	Policies           string                             `json:"policies"`              // Location of the policies endpoint
 }
 
 // AllRoutes is a handler that returns all links to resources in CloudHub server, as well as
@@ -109,6 +111,8 @@ func (a *AllRoutes) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		Addons: make([]getAddonLinksResponse, len(a.AddonURLs)),
 		Vspheres:    "/cloudhub/v1/vspheres",
 		ValidTextTemplates: "/cloudhub/v1/validate_text_templates",
+		AlertTemplates:     "/cloudhub/v1/alert_templates",
+		Policies:           "/cloudhub/v1/policies",
 	}
 
 	// The JSON response will have no field present for the LogoutLink if there is no logout link.
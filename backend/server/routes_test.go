@@ -30,7 +30,7 @@ func TestAllRoutes(t *testing.T) {
 	if err := json.Unmarshal(body, &routes); err != nil {
 		t.Error("TestAllRoutes not able to unmarshal JSON response")
 	}
-	want := `{"protoboards":"/cloudhub/v1/protoboards","orgConfig":{"self":"/cloudhub/v1/org_config","logViewer":"/cloudhub/v1/org_config/logviewer"},"layouts":"/cloudhub/v1/layouts","users":"/cloudhub/v1/organizations/default/users","allUsers":"/cloudhub/v1/users","organizations":"/cloudhub/v1/organizations","mappings":"/cloudhub/v1/mappings","sources":"/cloudhub/v1/sources","me":"/cloudhub/v1/me","environment":"/cloudhub/v1/env","dashboards":"/cloudhub/v1/dashboards","config":{"self":"/cloudhub/v1/config","auth":"/cloudhub/v1/config/auth"},"auth":[],"external":{"statusFeed":""},"flux":{"ast":"/cloudhub/v1/flux/ast","self":"/cloudhub/v1/flux","suggestions":"/cloudhub/v1/flux/suggestions"},"validateTextTemplates":"/cloudhub/v1/validate_text_templates","addons":[],"vspheres":"/cloudhub/v1/vspheres"}`
+	want := `{"protoboards":"/cloudhub/v1/protoboards","orgConfig":{"self":"/cloudhub/v1/org_config","logViewer":"/cloudhub/v1/org_config/logviewer"},"layouts":"/cloudhub/v1/layouts","users":"/cloudhub/v1/organizations/default/users","allUsers":"/cloudhub/v1/users","organizations":"/cloudhub/v1/organizations","mappings":"/cloudhub/v1/mappings","sources":"/cloudhub/v1/sources","me":"/cloudhub/v1/me","environment":"/cloudhub/v1/env","dashboards":"/cloudhub/v1/dashboards","config":{"self":"/cloudhub/v1/config","auth":"/cloudhub/v1/config/auth"},"auth":[],"external":{"statusFeed":""},"flux":{"ast":"/cloudhub/v1/flux/ast","self":"/cloudhub/v1/flux","suggestions":"/cloudhub/v1/flux/suggestions"},"validateTextTemplates":"/cloudhub/v1/validate_text_templates","addons":[],"vspheres":"/cloudhub/v1/vspheres","alertTemplates":"/cloudhub/v1/alert_templates","policies":"/cloudhub/v1/policies"}`
 
 	eq, err := jsonEqual(want, string(body))
 	if err != nil {
@@ -72,7 +72,7 @@ func TestAllRoutesWithAuth(t *testing.T) {
 	if err := json.Unmarshal(body, &routes); err != nil {
 		t.Error("TestAllRoutesWithAuth not able to unmarshal JSON response")
 	}
-	want := `{"protoboards":"/cloudhub/v1/protoboards","orgConfig":{"self":"/cloudhub/v1/org_config","logViewer":"/cloudhub/v1/org_config/logviewer"},"layouts":"/cloudhub/v1/layouts","users":"/cloudhub/v1/organizations/default/users","allUsers":"/cloudhub/v1/users","organizations":"/cloudhub/v1/organizations","mappings":"/cloudhub/v1/mappings","sources":"/cloudhub/v1/sources","me":"/cloudhub/v1/me","environment":"/cloudhub/v1/env","dashboards":"/cloudhub/v1/dashboards","config":{"self":"/cloudhub/v1/config","auth":"/cloudhub/v1/config/auth"},"auth":[{"name":"github","label":"GitHub","login":"/oauth/github/login","logout":"/oauth/github/logout","callback":"/oauth/github/callback"}],"logout":"/oauth/logout","external":{"statusFeed":""},"flux":{"ast":"/cloudhub/v1/flux/ast","self":"/cloudhub/v1/flux","suggestions":"/cloudhub/v1/flux/suggestions"},,"validateTextTemplates":"/cloudhub/v1/validate_text_templates","addons":[],"vspheres":"/cloudhub/v1/vspheres"}`
+	want := `{"protoboards":"/cloudhub/v1/protoboards","orgConfig":{"self":"/cloudhub/v1/org_config","logViewer":"/cloudhub/v1/org_config/logviewer"},"layouts":"/cloudhub/v1/layouts","users":"/cloudhub/v1/organizations/default/users","allUsers":"/cloudhub/v1/users","organizations":"/cloudhub/v1/organizations","mappings":"/cloudhub/v1/mappings","sources":"/cloudhub/v1/sources","me":"/cloudhub/v1/me","environment":"/cloudhub/v1/env","dashboards":"/cloudhub/v1/dashboards","config":{"self":"/cloudhub/v1/config","auth":"/cloudhub/v1/config/auth"},"auth":[{"name":"github","label":"GitHub","login":"/oauth/github/login","logout":"/oauth/github/logout","callback":"/oauth/github/callback"}],"logout":"/oauth/logout","external":{"statusFeed":""},"flux":{"ast":"/cloudhub/v1/flux/ast","self":"/cloudhub/v1/flux","suggestions":"/cloudhub/v1/flux/suggestions"},"validateTextTemplates":"/cloudhub/v1/validate_text_templates","addons":[],"vspheres":"/cloudhub/v1/vspheres","alertTemplates":"/cloudhub/v1/alert_templates","policies":"/cloudhub/v1/policies"}`
 
 	eq, err := jsonEqual(want, string(body))
 	if err != nil {
@@ -112,7 +112,7 @@ func TestAllRoutesWithExternalLinks(t *testing.T) {
 	if err := json.Unmarshal(body, &routes); err != nil {
 		t.Error("TestAllRoutesWithExternalLinks not able to unmarshal JSON response")
 	}
-	want := `{"protoboards":"/cloudhub/v1/protoboards","orgConfig":{"self":"/cloudhub/v1/org_config","logViewer":"/cloudhub/v1/org_config/logviewer"},"layouts":"/cloudhub/v1/layouts","users":"/cloudhub/v1/organizations/default/users","allUsers":"/cloudhub/v1/users","organizations":"/cloudhub/v1/organizations","mappings":"/cloudhub/v1/mappings","sources":"/cloudhub/v1/sources","me":"/cloudhub/v1/me","environment":"/cloudhub/v1/env","dashboards":"/cloudhub/v1/dashboards","config":{"self":"/cloudhub/v1/config","auth":"/cloudhub/v1/config/auth"},"auth":[],"external":{"statusFeed":"http://pineapple.life/feed.json","custom":[{"name":"cubeapple","url":"https://cube.apple"}]},"flux":{"ast":"/cloudhub/v1/flux/ast","self":"/cloudhub/v1/flux","suggestions":"/cloudhub/v1/flux/suggestions"},"validateTextTemplates":"/cloudhub/v1/validate_text_templates","addons":[],"vspheres":"/cloudhub/v1/vspheres"}`
+	want := `{"protoboards":"/cloudhub/v1/protoboards","orgConfig":{"self":"/cloudhub/v1/org_config","logViewer":"/cloudhub/v1/org_config/logviewer"},"layouts":"/cloudhub/v1/layouts","users":"/cloudhub/v1/organizations/default/users","allUsers":"/cloudhub/v1/users","organizations":"/cloudhub/v1/organizations","mappings":"/cloudhub/v1/mappings","sources":"/cloudhub/v1/sources","me":"/cloudhub/v1/me","environment":"/cloudhub/v1/env","dashboards":"/cloudhub/v1/dashboards","config":{"self":"/cloudhub/v1/config","auth":"/cloudhub/v1/config/auth"},"auth":[],"external":{"statusFeed":"http://pineapple.life/feed.json","custom":[{"name":"cubeapple","url":"https://cube.apple"}]},"flux":{"ast":"/cloudhub/v1/flux/ast","self":"/cloudhub/v1/flux","suggestions":"/cloudhub/v1/flux/suggestions"},"validateTextTemplates":"/cloudhub/v1/validate_text_templates","addons":[],"vspheres":"/cloudhub/v1/vspheres","alertTemplates":"/cloudhub/v1/alert_templates","policies":"/cloudhub/v1/policies"}`
 	eq, err := jsonEqual(want, string(body))
 	if err != nil {
 		t.Fatalf("error decoding json: %v", err)
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// defaultTagValuesLimit is the number of tag values returned without a limit
+const defaultTagValuesLimit = 100
+
+type tagKeysResponse struct {
+	TagKeys []cloudhub.TagKey `json:"tagKeys"` // tag keys of the measurements of a database
+}
+
+type tagValuesResponse struct {
+	Key    string   `json:"key"`    // the tag key of the values
+	Values []string `json:"values"` // sorted values of the tag key
+}
+
+type fieldKeysResponse struct {
+	FieldKeys []cloudhub.FieldKey `json:"fieldKeys"` // field keys and types of the measurements of a database
+}
+
+// TagKeys lists the tag keys of the measurements of a database, or of the
+// measurement parameter
+func (s *Service) TagKeys(w http.ResponseWriter, r *http.Request) {
+	dbsvc, db, q, ok := s.schemaDatabases(w, r)
+	if !ok {
+		return
+	}
+
+	keys, err := dbsvc.GetTagKeys(r.Context(), db, q)
+	if err != nil {
+		Error(w, http.StatusBadRequest, fmt.Sprintf("Unable to get tag keys: %v", err), s.Logger)
+		return
+	}
+	encodeJSON(w, http.StatusOK, tagKeysResponse{TagKeys: keys}, s.Logger)
+}
+
+// TagValues lists the values of a tag key starting with the prefix
+// parameter, up to the limit parameter
+func (s *Service) TagValues(w http.ResponseWriter, r *http.Request) {
+	q := cloudhub.SchemaQuery{
+		Prefix: r.URL.Query().Get("prefix"),
+		Limit:  defaultTagValuesLimit,
+	}
+	if limit := r.URL.Query().Get(limitQuery); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l <= 0 {
+			invalidData(w, fmt.Errorf("limit must be a positive integer"), s.Logger)
+			return
+		}
+		q.Limit = l
+	}
+
+	dbsvc, db, schema, ok := s.schemaDatabases(w, r)
+	if !ok {
+		return
+	}
+	q.RetentionPolicy, q.Measurement = schema.RetentionPolicy, schema.Measurement
+
+	key := httprouter.GetParamFromContext(r.Context(), "key")
+	values, err := dbsvc.GetTagValues(r.Context(), db, key, q)
+	if err != nil {
+		Error(w, http.StatusBadRequest, fmt.Sprintf("Unable to get values of tag %s: %v", key, err), s.Logger)
+		return
+	}
+	encodeJSON(w, http.StatusOK, tagValuesResponse{Key: key, Values: values}, s.Logger)
+}
+
+// FieldKeys lists the field keys and types of the measurements of a
+// database, or of the measurement parameter
+func (s *Service) FieldKeys(w http.ResponseWriter, r *http.Request) {
+	dbsvc, db, q, ok := s.schemaDatabases(w, r)
+	if !ok {
+		return
+	}
+
+	keys, err := dbsvc.GetFieldKeys(r.Context(), db, q)
+	if err != nil {
+		Error(w, http.StatusBadRequest, fmt.Sprintf("Unable to get field keys: %v", err), s.Logger)
+		return
+	}
+	encodeJSON(w, http.StatusOK, fieldKeysResponse{FieldKeys: keys}, s.Logger)
+}
+
+// Cardinality counts the series of a database and of each of its
+// measurements, or of the measurement parameter
+func (s *Service) Cardinality(w http.ResponseWriter, r *http.Request) {
+	dbsvc, db, q, ok := s.schemaDatabases(w, r)
+	if !ok {
+		return
+	}
+
+	card, err := dbsvc.GetCardinality(r.Context(), db, q)
+	if err != nil {
+		Error(w, http.StatusBadRequest, fmt.Sprintf("Unable to get series cardinality: %v", err), s.Logger)
+		return
+	}
+	encodeJSON(w, http.StatusOK, card, s.Logger)
+}
+
+// schemaDatabases connects to the source of a schema request and returns
+// the database and the rp and measurement parameters. Errors are written to
+// w.
+func (s *Service) schemaDatabases(w http.ResponseWriter, r *http.Request) (cloudhub.Databases, string, cloudhub.SchemaQuery, bool) {
+	ctx := r.Context()
+
+	srcID, err := paramID("id", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return nil, "", cloudhub.SchemaQuery{}, false
+	}
+
+	src, err := s.Store.Sources(ctx).Get(ctx, srcID)
+	if err != nil {
+		notFound(w, srcID, s.Logger)
+		return nil, "", cloudhub.SchemaQuery{}, false
+	}
+
+	dbsvc := s.Databases
+	if err = dbsvc.Connect(ctx, &src); err != nil {
+		msg := fmt.Sprintf("Unable to connect to source %d: %v", srcID, err)
+		Error(w, http.StatusBadRequest, msg, s.Logger)
+		return nil, "", cloudhub.SchemaQuery{}, false
+	}
+
+	params := r.URL.Query()
+	q := cloudhub.SchemaQuery{
+		RetentionPolicy: params.Get("rp"),
+		Measurement:     params.Get("measurement"),
+	}
+	if q.RetentionPolicy != "" && q.Measurement == "" {
+		invalidData(w, fmt.Errorf("rp requires a measurement"), s.Logger)
+		return nil, "", cloudhub.SchemaQuery{}, false
+	}
+	return dbsvc, httprouter.GetParamFromContext(ctx, "db"), q, true
+}
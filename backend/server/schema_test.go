@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+)
+
+func TestService_Schema(t *testing.T) {
+	var got cloudhub.SchemaQuery
+	s := &Service{
+		Store: &mocks.Store{
+			SourcesStore: &mocks.SourcesStore{
+				GetF: func(ctx context.Context, ID int) (cloudhub.Source, error) {
+					return cloudhub.Source{ID: ID}, nil
+				},
+			},
+		},
+		Databases: &mocks.Databases{
+			ConnectF: func(context.Context, *cloudhub.Source) error {
+				return nil
+			},
+			GetTagKeysF: func(ctx context.Context, db string, q cloudhub.SchemaQuery) ([]cloudhub.TagKey, error) {
+				got = q
+				return []cloudhub.TagKey{{Measurement: "cpu", Key: "host"}}, nil
+			},
+			GetTagValuesF: func(ctx context.Context, db, key string, q cloudhub.SchemaQuery) ([]string, error) {
+				got = q
+				return []string{"web-1", "web-2"}, nil
+			},
+			GetFieldKeysF: func(ctx context.Context, db string, q cloudhub.SchemaQuery) ([]cloudhub.FieldKey, error) {
+				got = q
+				return []cloudhub.FieldKey{{Measurement: "cpu", Key: "usage_user", Type: "float"}}, nil
+			},
+			GetCardinalityF: func(ctx context.Context, db string, q cloudhub.SchemaQuery) (*cloudhub.Cardinality, error) {
+				got = q
+				return &cloudhub.Cardinality{
+					Series:       12,
+					Measurements: []cloudhub.MeasurementCardinality{{Measurement: "cpu", Series: 12}},
+				}, nil
+			},
+		},
+		Logger: log.New(log.DebugLevel),
+	}
+
+	tests := []struct {
+		name    string
+		handler func(http.ResponseWriter, *http.Request)
+		query   string
+		status  int
+		body    string
+		want    cloudhub.SchemaQuery
+	}{
+		{
+			name:    "Tag keys of a measurement",
+			handler: s.TagKeys,
+			query:   "?rp=autogen&measurement=cpu",
+			status:  http.StatusOK,
+			body: `{"tagKeys":[{"measurement":"cpu","key":"host"}]}
+`,
+			want: cloudhub.SchemaQuery{RetentionPolicy: "autogen", Measurement: "cpu"},
+		},
+		{
+			name:    "Tag values with a prefix",
+			handler: s.TagValues,
+			query:   "?prefix=web&limit=10",
+			status:  http.StatusOK,
+			body: `{"key":"host","values":["web-1","web-2"]}
+`,
+			want: cloudhub.SchemaQuery{Prefix: "web", Limit: 10},
+		},
+		{
+			name:    "Tag values with the default limit",
+			handler: s.TagValues,
+			status:  http.StatusOK,
+			body: `{"key":"host","values":["web-1","web-2"]}
+`,
+			want: cloudhub.SchemaQuery{Limit: defaultTagValuesLimit},
+		},
+		{
+			name:    "Tag values with an invalid limit",
+			handler: s.TagValues,
+			query:   "?limit=-1",
+			status:  http.StatusUnprocessableEntity,
+			body:    `{"code":422,"message":"limit must be a positive integer"}`,
+		},
+		{
+			name:    "Field keys",
+			handler: s.FieldKeys,
+			status:  http.StatusOK,
+			body: `{"fieldKeys":[{"measurement":"cpu","key":"usage_user","type":"float"}]}
+`,
+		},
+		{
+			name:    "Cardinality",
+			handler: s.Cardinality,
+			status:  http.StatusOK,
+			body: `{"series":12,"measurements":[{"measurement":"cpu","series":12}]}
+`,
+		},
+		{
+			name:    "Retention policy without a measurement",
+			handler: s.Cardinality,
+			query:   "?rp=autogen",
+			status:  http.StatusUnprocessableEntity,
+			body:    `{"code":422,"message":"rp requires a measurement"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = cloudhub.SchemaQuery{}
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "http://any.url/"+tt.query, nil)
+			r = r.WithContext(httprouter.WithParams(context.Background(), httprouter.Params{
+				{Key: "id", Value: "1"},
+				{Key: "db", Value: "telegraf"},
+				{Key: "key", Value: "host"},
+			}))
+			tt.handler(w, r)
+
+			resp := w.Result()
+			body, _ := ioutil.ReadAll(resp.Body)
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if string(body) != tt.body {
+				t.Errorf("body =\n%s\nwant\n%s", body, tt.body)
+			}
+			if got != tt.want {
+				t.Errorf("schema query = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,895 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/oauth2"
+)
+
+const (
+	// SCIMType is the mimetype of the requests and responses of the SCIM 2.0
+	// provisioning API
+	SCIMType = "application/scim+json"
+
+	scimUserSchema  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimGroupSchema = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimListSchema  = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimErrorSchema = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+// AuthorizedSCIM ensures that a request of the SCIM provisioning API has the
+// bearer token of the identity provider. The identity provider manages the
+// users of the SCIM provider and the groups of the whole server, so the
+// next handler has raw access to the DataStore.
+func AuthorizedSCIM(token string, logger cloudhub.Logger, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bearer, ok := bearerToken(r)
+		// Compare the hashes so that the length of the token does not leak
+		if !ok || subtle.ConstantTimeCompare([]byte(hashAPITokenSecret(bearer)), []byte(hashAPITokenSecret(token))) != 1 {
+			logger.
+				WithField("component", "scim").
+				WithField("remote_addr", r.RemoteAddr).
+				WithField("method", r.Method).
+				WithField("url", r.URL).
+				Error("Invalid SCIM token")
+			scimError(w, http.StatusUnauthorized, "", "Invalid SCIM token", logger)
+			return
+		}
+		next(w, r.WithContext(serverContext(r.Context())))
+	}
+}
+
+type scimErrorResponse struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	SCIMType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
+
+// scimError writes a SCIM error of a scimType such as invalidValue or
+// uniqueness
+func scimError(w http.ResponseWriter, code int, scimType, detail string, logger cloudhub.Logger) {
+	logger.
+		WithField("component", "scim").
+		WithField("http_status ", code).
+		Error("Error message ", detail)
+	encodeSCIM(w, code, scimErrorResponse{
+		Schemas:  []string{scimErrorSchema},
+		Status:   strconv.Itoa(code),
+		SCIMType: scimType,
+		Detail:   detail,
+	}, logger)
+}
+
+func encodeSCIM(w http.ResponseWriter, status int, v interface{}, logger cloudhub.Logger) {
+	w.Header().Set("Content-Type", SCIMType)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		unknownErrorWithMessage(w, err, logger)
+	}
+}
+
+type scimMeta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location"`
+}
+
+type scimMember struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+}
+
+type scimUser struct {
+	Schemas  []string     `json:"schemas"`
+	ID       string       `json:"id,omitempty"`
+	UserName string       `json:"userName"`
+	Active   *bool        `json:"active,omitempty"`
+	Groups   []scimMember `json:"groups,omitempty"`
+	Meta     *scimMeta    `json:"meta,omitempty"`
+}
+
+func newSCIMUser(u *cloudhub.User, groups []cloudhub.Group) *scimUser {
+	id := strconv.FormatUint(u.ID, 10)
+	active := !u.Deactivated
+	res := &scimUser{
+		Schemas:  []string{scimUserSchema},
+		ID:       id,
+		UserName: u.Name,
+		Active:   &active,
+		Groups:   []scimMember{},
+		Meta: &scimMeta{
+			ResourceType: "User",
+			Location:     fmt.Sprintf("/scim/v2/Users/%s", id),
+		},
+	}
+	for _, g := range groups {
+		if hasMember(g, u.ID) {
+			res.Groups = append(res.Groups, scimMember{Value: g.ID, Display: g.DisplayName})
+		}
+	}
+	return res
+}
+
+type scimGroup struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id,omitempty"`
+	ExternalID  string       `json:"externalId,omitempty"`
+	DisplayName string       `json:"displayName"`
+	Members     []scimMember `json:"members"`
+	Meta        *scimMeta    `json:"meta,omitempty"`
+}
+
+func newSCIMGroup(g cloudhub.Group) *scimGroup {
+	res := &scimGroup{
+		Schemas:     []string{scimGroupSchema},
+		ID:          g.ID,
+		ExternalID:  g.ExternalID,
+		DisplayName: g.DisplayName,
+		Members:     []scimMember{},
+		Meta: &scimMeta{
+			ResourceType: "Group",
+			Location:     fmt.Sprintf("/scim/v2/Groups/%s", g.ID),
+		},
+	}
+	for _, id := range g.Members {
+		res.Members = append(res.Members, scimMember{Value: strconv.FormatUint(id, 10)})
+	}
+	return res
+}
+
+type scimListResponse struct {
+	Schemas      []string      `json:"schemas"`
+	TotalResults int           `json:"totalResults"`
+	StartIndex   int           `json:"startIndex"`
+	ItemsPerPage int           `json:"itemsPerPage"`
+	Resources    []interface{} `json:"Resources"`
+}
+
+// scimPage returns the resources of the page given by the startIndex and
+// count query parameters of a SCIM list request
+func scimPage(r *http.Request, resources []interface{}) scimListResponse {
+	start, err := strconv.Atoi(r.URL.Query().Get("startIndex"))
+	if err != nil || start < 1 {
+		start = 1
+	}
+	count, err := strconv.Atoi(r.URL.Query().Get("count"))
+	if err != nil || count < 0 {
+		count = len(resources)
+	}
+
+	page := []interface{}{}
+	if start-1 < len(resources) {
+		end := start - 1 + count
+		if end > len(resources) {
+			end = len(resources)
+		}
+		page = resources[start-1 : end]
+	}
+	return scimListResponse{
+		Schemas:      []string{scimListSchema},
+		TotalResults: len(resources),
+		StartIndex:   start,
+		ItemsPerPage: len(page),
+		Resources:    page,
+	}
+}
+
+// scimFilter parses the filter of a SCIM list request. Identity providers
+// look resources up with `attribute eq "value"`, the only filter supported.
+func scimFilter(r *http.Request, attributes ...string) (string, string, error) {
+	filter := strings.TrimSpace(r.URL.Query().Get("filter"))
+	if filter == "" {
+		return "", "", nil
+	}
+	parts := strings.SplitN(filter, " ", 3)
+	if len(parts) != 3 || !strings.EqualFold(parts[1], "eq") {
+		return "", "", fmt.Errorf("unsupported filter %s; only eq filters are supported", filter)
+	}
+	value, err := strconv.Unquote(parts[2])
+	if err != nil {
+		return "", "", fmt.Errorf("invalid value of filter %s", filter)
+	}
+	for _, attribute := range attributes {
+		if strings.EqualFold(parts[0], attribute) {
+			return attribute, value, nil
+		}
+	}
+	return "", "", fmt.Errorf("unsupported filter attribute %s", parts[0])
+}
+
+type scimPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []scimPatchOperation `json:"Operations"`
+}
+
+type scimPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// attributes returns the values of the attributes of a patch operation,
+// which are either given by its path or are the members of its value
+func (op scimPatchOperation) attributes() (map[string]json.RawMessage, error) {
+	if op.Path != "" {
+		return map[string]json.RawMessage{strings.ToLower(op.Path): op.Value}, nil
+	}
+	values := map[string]json.RawMessage{}
+	if err := json.Unmarshal(op.Value, &values); err != nil {
+		return nil, fmt.Errorf("value of an operation without path must be an object")
+	}
+	attributes := map[string]json.RawMessage{}
+	for k, v := range values {
+		attributes[strings.ToLower(k)] = v
+	}
+	return attributes, nil
+}
+
+// scimBool decodes a boolean, which some identity providers send as a string
+func scimBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		return false, fmt.Errorf("invalid boolean %s", value)
+	}
+	return strconv.ParseBool(strings.ToLower(s))
+}
+
+func hasMember(g cloudhub.Group, id uint64) bool {
+	for _, member := range g.Members {
+		if member == id {
+			return true
+		}
+	}
+	return false
+}
+
+// groupNames returns the names of the groups of a user
+func groupNames(groups []cloudhub.Group, id uint64) []string {
+	names := []string{}
+	for _, g := range groups {
+		if hasMember(g, id) {
+			names = append(names, g.DisplayName)
+		}
+	}
+	return names
+}
+
+// provisioned returns whether a user is managed by the SCIM provisioning API
+func (s *Service) provisioned(u *cloudhub.User) bool {
+	return s.SCIMProvider != "" && u.Provider == s.SCIMProvider && !u.ServiceAccount
+}
+
+// provisionedUser returns the provisioned user of the id route parameter
+func (s *Service) provisionedUser(ctx context.Context) (*cloudhub.User, error) {
+	id, err := strconv.ParseUint(httprouter.GetParamFromContext(ctx, "id"), 10, 64)
+	if err != nil {
+		return nil, cloudhub.ErrUserNotFound
+	}
+	u, err := s.Store.Users(ctx).Get(ctx, cloudhub.UserQuery{ID: &id})
+	if err != nil {
+		return nil, err
+	}
+	if !s.provisioned(u) {
+		return nil, cloudhub.ErrUserNotFound
+	}
+	return u, nil
+}
+
+// userNameTaken returns whether a user of the SCIM provider has a name
+func (s *Service) userNameTaken(ctx context.Context, name string) (bool, error) {
+	scheme, _ := getScheme(ctx)
+	_, err := s.Store.Users(ctx).Get(ctx, cloudhub.UserQuery{
+		Name:     &name,
+		Provider: &s.SCIMProvider,
+		Scheme:   &scheme,
+	})
+	if err == cloudhub.ErrUserNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// remapProvisionedUsers re-evaluates the roles mapped from the groups of
+// users whose groups changed
+func (s *Service) remapProvisionedUsers(ctx context.Context, ids ...uint64) error {
+	groups, err := s.Store.Groups(ctx).All(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range ids {
+		u, err := s.Store.Users(ctx).Get(ctx, cloudhub.UserQuery{ID: &ids[i]})
+		if err == cloudhub.ErrUserNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		mapped, err := s.mapPrincipalToGroupRoles(ctx, oauth2.Principal{
+			Subject: u.Name,
+			Issuer:  u.Provider,
+			Group:   strings.Join(groupNames(groups, u.ID), ","),
+		})
+		if err != nil {
+			return err
+		}
+		if roles, ok := remapRoles(u.Roles, mapped); ok {
+			u.Roles = roles
+			if err := s.Store.Users(ctx).Update(ctx, u); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SCIMUsers returns the provisioned users, optionally filtered by userName
+func (s *Service) SCIMUsers(w http.ResponseWriter, r *http.Request) {
+	attribute, value, err := scimFilter(r, "userName")
+	if err != nil {
+		scimError(w, http.StatusBadRequest, "invalidFilter", err.Error(), s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	users, err := s.Store.Users(ctx).All(ctx)
+	if err != nil {
+		scimError(w, http.StatusInternalServerError, "", "Error loading users", s.Logger)
+		return
+	}
+	groups, err := s.Store.Groups(ctx).All(ctx)
+	if err != nil {
+		scimError(w, http.StatusInternalServerError, "", "Error loading groups", s.Logger)
+		return
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].ID < users[j].ID
+	})
+	resources := []interface{}{}
+	for i := range users {
+		if !s.provisioned(&users[i]) || (attribute != "" && users[i].Name != value) {
+			continue
+		}
+		resources = append(resources, newSCIMUser(&users[i], groups))
+	}
+	encodeSCIM(w, http.StatusOK, scimPage(r, resources), s.Logger)
+}
+
+// SCIMUserID returns a provisioned user
+func (s *Service) SCIMUserID(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	u, err := s.provisionedUser(ctx)
+	if err != nil {
+		scimError(w, http.StatusNotFound, "", "User not found", s.Logger)
+		return
+	}
+	groups, err := s.Store.Groups(ctx).All(ctx)
+	if err != nil {
+		scimError(w, http.StatusInternalServerError, "", "Error loading groups", s.Logger)
+		return
+	}
+
+	encodeSCIM(w, http.StatusOK, newSCIMUser(u, groups), s.Logger)
+}
+
+// NewSCIMUser provisions a user of the SCIM provider before its first login.
+// It has the roles of the wildcard mappings, like users created at their
+// first login, and the roles of the groups it is added to later on.
+func (s *Service) NewSCIMUser(w http.ResponseWriter, r *http.Request) {
+	var req scimUser
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		scimError(w, http.StatusBadRequest, "invalidSyntax", "Unparsable JSON", s.Logger)
+		return
+	}
+	if req.UserName == "" {
+		scimError(w, http.StatusBadRequest, "invalidValue", "userName required", s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	if taken, err := s.userNameTaken(ctx, req.UserName); err != nil {
+		scimError(w, http.StatusInternalServerError, "", err.Error(), s.Logger)
+		return
+	} else if taken {
+		scimError(w, http.StatusConflict, "uniqueness", fmt.Sprintf("User %s already exists", req.UserName), s.Logger)
+		return
+	}
+
+	roles, err := s.mapPrincipalToRoles(ctx, oauth2.Principal{Subject: req.UserName, Issuer: s.SCIMProvider})
+	if err != nil {
+		scimError(w, http.StatusInternalServerError, "", err.Error(), s.Logger)
+		return
+	}
+	scheme, _ := getScheme(ctx)
+	user := &cloudhub.User{
+		Name:        req.UserName,
+		Provider:    s.SCIMProvider,
+		Scheme:      scheme,
+		Roles:       roles,
+		SuperAdmin:  s.newUsersAreSuperAdmin(),
+		Deactivated: req.Active != nil && !*req.Active,
+	}
+	// If the user is a superadmin, give them a role in the default organization
+	if user.SuperAdmin {
+		defaultOrg, err := s.Store.Organizations(ctx).DefaultOrganization(ctx)
+		if err != nil {
+			scimError(w, http.StatusInternalServerError, "", err.Error(), s.Logger)
+			return
+		}
+		if !hasRoleInDefaultOrganization(user, defaultOrg.ID) {
+			user.Roles = append(user.Roles, cloudhub.Role{
+				Name:         defaultOrg.DefaultRole,
+				Organization: defaultOrg.ID,
+			})
+		}
+	}
+
+	u, err := s.Store.Users(ctx).Add(ctx, user)
+	if err != nil {
+		scimError(w, http.StatusInternalServerError, "", fmt.Sprintf("error storing user %s: %v", user.Name, err), s.Logger)
+		return
+	}
+
+	res := newSCIMUser(u, nil)
+	location(w, res.Meta.Location)
+	encodeSCIM(w, http.StatusCreated, res, s.Logger)
+}
+
+// ReplaceSCIMUser replaces the userName and the active status of a
+// provisioned user
+func (s *Service) ReplaceSCIMUser(w http.ResponseWriter, r *http.Request) {
+	var req scimUser
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		scimError(w, http.StatusBadRequest, "invalidSyntax", "Unparsable JSON", s.Logger)
+		return
+	}
+	if req.UserName == "" {
+		scimError(w, http.StatusBadRequest, "invalidValue", "userName required", s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	u, err := s.provisionedUser(ctx)
+	if err != nil {
+		scimError(w, http.StatusNotFound, "", "User not found", s.Logger)
+		return
+	}
+	if !s.renameSCIMUser(w, ctx, u, req.UserName) {
+		return
+	}
+	u.Deactivated = req.Active != nil && !*req.Active
+
+	s.updateSCIMUser(w, ctx, u)
+}
+
+// PatchSCIMUser replaces the userName or the active status of a provisioned
+// user. Identity providers deactivate users by patching active to false.
+// Other attributes are not stored by CloudHub and are ignored.
+func (s *Service) PatchSCIMUser(w http.ResponseWriter, r *http.Request) {
+	var req scimPatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		scimError(w, http.StatusBadRequest, "invalidSyntax", "Unparsable JSON", s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	u, err := s.provisionedUser(ctx)
+	if err != nil {
+		scimError(w, http.StatusNotFound, "", "User not found", s.Logger)
+		return
+	}
+
+	for _, op := range req.Operations {
+		if o := strings.ToLower(op.Op); o != "replace" && o != "add" {
+			scimError(w, http.StatusBadRequest, "invalidValue", fmt.Sprintf("unsupported operation %s of users", op.Op), s.Logger)
+			return
+		}
+		attributes, err := op.attributes()
+		if err != nil {
+			scimError(w, http.StatusBadRequest, "invalidValue", err.Error(), s.Logger)
+			return
+		}
+		for attribute, value := range attributes {
+			switch attribute {
+			case "active":
+				active, err := scimBool(value)
+				if err != nil {
+					scimError(w, http.StatusBadRequest, "invalidValue", err.Error(), s.Logger)
+					return
+				}
+				u.Deactivated = !active
+			case "username":
+				var name string
+				if err := json.Unmarshal(value, &name); err != nil || name == "" {
+					scimError(w, http.StatusBadRequest, "invalidValue", "userName must be a string", s.Logger)
+					return
+				}
+				if !s.renameSCIMUser(w, ctx, u, name) {
+					return
+				}
+			}
+		}
+	}
+
+	s.updateSCIMUser(w, ctx, u)
+}
+
+// renameSCIMUser renames a provisioned user unless another user has the name
+func (s *Service) renameSCIMUser(w http.ResponseWriter, ctx context.Context, u *cloudhub.User, name string) bool {
+	if name == u.Name {
+		return true
+	}
+	if taken, err := s.userNameTaken(ctx, name); err != nil {
+		scimError(w, http.StatusInternalServerError, "", err.Error(), s.Logger)
+		return false
+	} else if taken {
+		scimError(w, http.StatusConflict, "uniqueness", fmt.Sprintf("User %s already exists", name), s.Logger)
+		return false
+	}
+	u.Name = name
+	return true
+}
+
+func (s *Service) updateSCIMUser(w http.ResponseWriter, ctx context.Context, u *cloudhub.User) {
+	if err := s.Store.Users(ctx).Update(ctx, u); err != nil {
+		scimError(w, http.StatusInternalServerError, "", err.Error(), s.Logger)
+		return
+	}
+	// Deactivated users are logged out
+	if u.Deactivated {
+		if err := s.revokeSessions(ctx, u, "", ""); err != nil {
+			scimError(w, http.StatusInternalServerError, "", err.Error(), s.Logger)
+			return
+		}
+	}
+	groups, err := s.Store.Groups(ctx).All(ctx)
+	if err != nil {
+		scimError(w, http.StatusInternalServerError, "", "Error loading groups", s.Logger)
+		return
+	}
+
+	encodeSCIM(w, http.StatusOK, newSCIMUser(u, groups), s.Logger)
+}
+
+// RemoveSCIMUser deletes a provisioned user and its group memberships
+func (s *Service) RemoveSCIMUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	u, err := s.provisionedUser(ctx)
+	if err != nil {
+		scimError(w, http.StatusNotFound, "", "User not found", s.Logger)
+		return
+	}
+
+	groups, err := s.Store.Groups(ctx).All(ctx)
+	if err != nil {
+		scimError(w, http.StatusInternalServerError, "", "Error loading groups", s.Logger)
+		return
+	}
+	for _, g := range groups {
+		if !hasMember(g, u.ID) {
+			continue
+		}
+		members := []uint64{}
+		for _, id := range g.Members {
+			if id != u.ID {
+				members = append(members, id)
+			}
+		}
+		g.Members = members
+		if err := s.Store.Groups(ctx).Update(ctx, g); err != nil {
+			scimError(w, http.StatusInternalServerError, "", err.Error(), s.Logger)
+			return
+		}
+	}
+	if err := s.Store.Users(ctx).Delete(ctx, u); err != nil {
+		scimError(w, http.StatusInternalServerError, "", err.Error(), s.Logger)
+		return
+	}
+	if err := s.revokeSessions(ctx, u, "", ""); err != nil {
+		scimError(w, http.StatusInternalServerError, "", err.Error(), s.Logger)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SCIMGroups returns the provisioned groups, optionally filtered by
+// displayName or externalId
+func (s *Service) SCIMGroups(w http.ResponseWriter, r *http.Request) {
+	attribute, value, err := scimFilter(r, "displayName", "externalId")
+	if err != nil {
+		scimError(w, http.StatusBadRequest, "invalidFilter", err.Error(), s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	groups, err := s.Store.Groups(ctx).All(ctx)
+	if err != nil {
+		scimError(w, http.StatusInternalServerError, "", "Error loading groups", s.Logger)
+		return
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		a, _ := strconv.ParseUint(groups[i].ID, 10, 64)
+		b, _ := strconv.ParseUint(groups[j].ID, 10, 64)
+		return a < b
+	})
+	resources := []interface{}{}
+	for _, g := range groups {
+		if (attribute == "displayName" && g.DisplayName != value) || (attribute == "externalId" && g.ExternalID != value) {
+			continue
+		}
+		resources = append(resources, newSCIMGroup(g))
+	}
+	encodeSCIM(w, http.StatusOK, scimPage(r, resources), s.Logger)
+}
+
+// SCIMGroupID returns a provisioned group
+func (s *Service) SCIMGroupID(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	g, err := s.Store.Groups(ctx).Get(ctx, httprouter.GetParamFromContext(ctx, "id"))
+	if err != nil {
+		scimError(w, http.StatusNotFound, "", "Group not found", s.Logger)
+		return
+	}
+
+	encodeSCIM(w, http.StatusOK, newSCIMGroup(g), s.Logger)
+}
+
+// NewSCIMGroup provisions a group. Its members have the roles of the
+// mappings of its displayName.
+func (s *Service) NewSCIMGroup(w http.ResponseWriter, r *http.Request) {
+	var req scimGroup
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		scimError(w, http.StatusBadRequest, "invalidSyntax", "Unparsable JSON", s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	g := cloudhub.Group{
+		DisplayName: req.DisplayName,
+		ExternalID:  req.ExternalID,
+	}
+	var err error
+	if g.Members, err = s.scimMembers(ctx, req.Members); err != nil {
+		scimError(w, http.StatusBadRequest, "invalidValue", err.Error(), s.Logger)
+		return
+	}
+	if !s.validSCIMGroup(w, ctx, g) {
+		return
+	}
+
+	if g, err = s.Store.Groups(ctx).Add(ctx, g); err != nil {
+		scimError(w, http.StatusInternalServerError, "", err.Error(), s.Logger)
+		return
+	}
+	if err := s.remapProvisionedUsers(ctx, g.Members...); err != nil {
+		scimError(w, http.StatusInternalServerError, "", err.Error(), s.Logger)
+		return
+	}
+
+	res := newSCIMGroup(g)
+	location(w, res.Meta.Location)
+	encodeSCIM(w, http.StatusCreated, res, s.Logger)
+}
+
+// ReplaceSCIMGroup replaces the displayName and the members of a group
+func (s *Service) ReplaceSCIMGroup(w http.ResponseWriter, r *http.Request) {
+	var req scimGroup
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		scimError(w, http.StatusBadRequest, "invalidSyntax", "Unparsable JSON", s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	previous, err := s.Store.Groups(ctx).Get(ctx, httprouter.GetParamFromContext(ctx, "id"))
+	if err != nil {
+		scimError(w, http.StatusNotFound, "", "Group not found", s.Logger)
+		return
+	}
+	g := previous
+	g.DisplayName = req.DisplayName
+	g.ExternalID = req.ExternalID
+	if g.Members, err = s.scimMembers(ctx, req.Members); err != nil {
+		scimError(w, http.StatusBadRequest, "invalidValue", err.Error(), s.Logger)
+		return
+	}
+
+	s.updateSCIMGroup(w, ctx, previous, g)
+}
+
+// PatchSCIMGroup adds, removes or replaces the members of a group, or
+// replaces its displayName
+func (s *Service) PatchSCIMGroup(w http.ResponseWriter, r *http.Request) {
+	var req scimPatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		scimError(w, http.StatusBadRequest, "invalidSyntax", "Unparsable JSON", s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	previous, err := s.Store.Groups(ctx).Get(ctx, httprouter.GetParamFromContext(ctx, "id"))
+	if err != nil {
+		scimError(w, http.StatusNotFound, "", "Group not found", s.Logger)
+		return
+	}
+	g := previous
+	g.Members = append([]uint64{}, previous.Members...)
+	for _, op := range req.Operations {
+		if err := s.patchSCIMGroup(ctx, &g, op); err != nil {
+			scimError(w, http.StatusBadRequest, "invalidValue", err.Error(), s.Logger)
+			return
+		}
+	}
+
+	s.updateSCIMGroup(w, ctx, previous, g)
+}
+
+// patchSCIMGroup applies a patch operation to a group
+func (s *Service) patchSCIMGroup(ctx context.Context, g *cloudhub.Group, op scimPatchOperation) error {
+	o := strings.ToLower(op.Op)
+	// Members are removed one by one with a filter, as in members[value eq "2"]
+	if o == "remove" && strings.HasPrefix(strings.ToLower(op.Path), "members[") {
+		filter := strings.TrimSuffix(op.Path[len("members["):], "]")
+		parts := strings.SplitN(filter, " ", 3)
+		if len(parts) != 3 || !strings.EqualFold(parts[0], "value") || !strings.EqualFold(parts[1], "eq") {
+			return fmt.Errorf("unsupported path %s", op.Path)
+		}
+		value, err := strconv.Unquote(parts[2])
+		if err != nil {
+			return fmt.Errorf("unsupported path %s", op.Path)
+		}
+		op.Value, _ = json.Marshal([]scimMember{{Value: value}})
+		op.Path = "members"
+	}
+	if o == "remove" && strings.EqualFold(op.Path, "members") && len(op.Value) == 0 {
+		g.Members = []uint64{}
+		return nil
+	}
+
+	attributes, err := op.attributes()
+	if err != nil {
+		return err
+	}
+	for attribute, value := range attributes {
+		switch attribute {
+		case "displayname":
+			if o == "remove" || json.Unmarshal(value, &g.DisplayName) != nil {
+				return fmt.Errorf("displayName must be a string")
+			}
+		case "externalid":
+			if o == "remove" {
+				g.ExternalID = ""
+			} else if json.Unmarshal(value, &g.ExternalID) != nil {
+				return fmt.Errorf("externalId must be a string")
+			}
+		case "members":
+			var members []scimMember
+			if err := json.Unmarshal(value, &members); err != nil {
+				return fmt.Errorf("members must be a list of members")
+			}
+			ids, err := s.scimMembers(ctx, members)
+			if err != nil {
+				return err
+			}
+			switch o {
+			case "add":
+				for _, id := range ids {
+					if !hasMember(*g, id) {
+						g.Members = append(g.Members, id)
+					}
+				}
+			case "remove":
+				kept := []uint64{}
+				for _, member := range g.Members {
+					if !hasMember(cloudhub.Group{Members: ids}, member) {
+						kept = append(kept, member)
+					}
+				}
+				g.Members = kept
+			case "replace":
+				g.Members = ids
+			default:
+				return fmt.Errorf("unsupported operation %s of groups", op.Op)
+			}
+		default:
+			return fmt.Errorf("unsupported attribute %s of groups", attribute)
+		}
+	}
+	return nil
+}
+
+// scimMembers returns the IDs of the provisioned users of members
+func (s *Service) scimMembers(ctx context.Context, members []scimMember) ([]uint64, error) {
+	ids := []uint64{}
+	for _, m := range members {
+		id, err := strconv.ParseUint(m.Value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("member %s is not a user", m.Value)
+		}
+		u, err := s.Store.Users(ctx).Get(ctx, cloudhub.UserQuery{ID: &id})
+		if err != nil || !s.provisioned(u) {
+			return nil, fmt.Errorf("member %s is not a user", m.Value)
+		}
+		if !hasMember(cloudhub.Group{Members: ids}, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// validSCIMGroup ensures that the displayName of a group can be matched by
+// mappings and is unique
+func (s *Service) validSCIMGroup(w http.ResponseWriter, ctx context.Context, g cloudhub.Group) bool {
+	// The groups of users are joined with commas when they are mapped
+	if g.DisplayName == "" || strings.Contains(g.DisplayName, ",") {
+		scimError(w, http.StatusBadRequest, "invalidValue", "displayName is required and may not contain commas", s.Logger)
+		return false
+	}
+	groups, err := s.Store.Groups(ctx).All(ctx)
+	if err != nil {
+		scimError(w, http.StatusInternalServerError, "", "Error loading groups", s.Logger)
+		return false
+	}
+	for _, other := range groups {
+		if other.ID != g.ID && other.DisplayName == g.DisplayName {
+			scimError(w, http.StatusConflict, "uniqueness", fmt.Sprintf("Group %s already exists", g.DisplayName), s.Logger)
+			return false
+		}
+	}
+	return true
+}
+
+// updateSCIMGroup stores a group and re-evaluates the roles of its former
+// and current members
+func (s *Service) updateSCIMGroup(w http.ResponseWriter, ctx context.Context, previous, g cloudhub.Group) {
+	if !s.validSCIMGroup(w, ctx, g) {
+		return
+	}
+	if err := s.Store.Groups(ctx).Update(ctx, g); err != nil {
+		scimError(w, http.StatusInternalServerError, "", err.Error(), s.Logger)
+		return
+	}
+	if err := s.remapProvisionedUsers(ctx, append(previous.Members, g.Members...)...); err != nil {
+		scimError(w, http.StatusInternalServerError, "", err.Error(), s.Logger)
+		return
+	}
+
+	encodeSCIM(w, http.StatusOK, newSCIMGroup(g), s.Logger)
+}
+
+// RemoveSCIMGroup deletes a group, so that its members lose the roles of its
+// mappings
+func (s *Service) RemoveSCIMGroup(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	g, err := s.Store.Groups(ctx).Get(ctx, httprouter.GetParamFromContext(ctx, "id"))
+	if err != nil {
+		scimError(w, http.StatusNotFound, "", "Group not found", s.Logger)
+		return
+	}
+
+	if err := s.Store.Groups(ctx).Delete(ctx, g); err != nil {
+		scimError(w, http.StatusInternalServerError, "", err.Error(), s.Logger)
+		return
+	}
+	if err := s.remapProvisionedUsers(ctx, g.Members...); err != nil {
+		scimError(w, http.StatusInternalServerError, "", err.Error(), s.Logger)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -28,8 +28,11 @@ import (
 	"github.com/snetsystems/cloudhub/backend/kv"
 	"github.com/snetsystems/cloudhub/backend/kv/bolt"
 	"github.com/snetsystems/cloudhub/backend/kv/etcd"
+	"github.com/snetsystems/cloudhub/backend/ldap"
 	clog "github.com/snetsystems/cloudhub/backend/log"
 	"github.com/snetsystems/cloudhub/backend/oauth2"
+	"github.com/snetsystems/cloudhub/backend/roles"
+	"github.com/snetsystems/cloudhub/backend/saml"
 	client "github.com/influxdata/usage-client/v1"
 	flags "github.com/jessevdk/go-flags"
 )
@@ -65,6 +68,20 @@ type Server struct {
 	AddonURLs   map[string]string `short:"u" long:"addon-url" description:"Support addon is [salt, swan, oncue]. API URLs to be used to the client for a request to addon API servers. Multiple URL can be added by using multiple of the same flag with different 'name:url' values, or as an environment variable with comma-separated 'name:url' values. E.g. via flags: '--addon-url=salt:{url} --addon-url=swan:{url}'. E.g. via environment variable: 'export ADDON_URL=salt:{url},swan:{url}'" env:"ADDON_URL" env-delim:","`
 	AddonTokens map[string]string `short:"k" long:"addon-tokens" description:"Support addon is [salt, swan]. API tokens to be used to the client for a request to addon API servers. Multiple tokens can be added by using multiple of the same flag with different 'name:token' values, or as an environment variable with comma-separated 'name:token' values. E.g. via flags: '--addon-tokens=salt:{token} --addon-tokens=swan:{token}'. E.g. via environment variable: 'export ADDON_TOKENS=salt:{token},swan:{token}'" env:"ADDON_TOKENS" env-delim:","`
 
+	QueryCacheSize   int64         `long:"query-cache-size" description:"Bytes of InfluxDB query results cached for each source. 0 disables the cache." default:"67108864" env:"QUERY_CACHE_SIZE"`
+	QueryCacheMaxTTL time.Duration `long:"query-cache-max-ttl" description:"Longest time InfluxDB query results are cached (e.g. '5m')" default:"5m" env:"QUERY_CACHE_MAX_TTL"`
+	SchemaCacheTTL   time.Duration `long:"schema-cache-ttl" description:"Time results of InfluxDB schema queries, such as tag values, are cached (e.g. '30s'). 0 disables their cache." default:"30s" env:"SCHEMA_CACHE_TTL"`
+
+	QueryMaxDuration       time.Duration `long:"query-max-duration" description:"Longest time range of an InfluxDB query (e.g. '720h'). 0 does not limit." env:"QUERY_MAX_DURATION"`
+	QueryRequireTimeBounds bool          `long:"query-require-time-bounds" description:"Reject InfluxDB queries without a lower time bound (e.g. 'WHERE time > now() - 1h')" env:"QUERY_REQUIRE_TIME_BOUNDS"`
+	QueryMaxWildcardSeries int           `long:"query-max-wildcard-series" description:"Largest SLIMIT of an InfluxDB query with GROUP BY *, which must set one. 0 does not limit." env:"QUERY_MAX_WILDCARD_SERIES"`
+	QueryMaxPoints         int64         `long:"query-max-points" description:"Largest estimate of the points returned by an InfluxDB query. 0 does not limit." env:"QUERY_MAX_POINTS"`
+	QueryRawInterval       time.Duration `long:"query-raw-interval" description:"Expected interval of stored points used to estimate the points of raw InfluxDB queries" default:"10s" env:"QUERY_RAW_INTERVAL"`
+	QueryUserConcurrency   int           `long:"query-user-concurrency" description:"Number of InfluxDB queries a user may run at once. 0 does not limit." env:"QUERY_USER_CONCURRENCY"`
+	QueryOrgConcurrency    int           `long:"query-org-concurrency" description:"Number of InfluxDB queries an organization may run at once. 0 does not limit." env:"QUERY_ORG_CONCURRENCY"`
+	QueryUserRate          int           `long:"query-user-rate" description:"Number of InfluxDB queries a user may send per minute. 0 does not limit." env:"QUERY_USER_RATE"`
+	QueryOrgRate           int           `long:"query-org-rate" description:"Number of InfluxDB queries an organization may send per minute. 0 does not limit." env:"QUERY_ORG_RATE"`
+
 	Develop         bool          `short:"d" long:"develop" description:"Run server in develop mode."`
 	BoltPath        string        `short:"b" long:"bolt-path" description:"Full path to boltDB file (e.g. './cloudhub-v1.db')" env:"BOLT_PATH" default:"cloudhub-v1.db"`
 	CannedPath      string        `short:"c" long:"canned-path" description:"Path to directory of pre-canned application layouts (/usr/share/cloudhub/canned)" env:"CANNED_PATH" default:"canned"`
@@ -104,6 +121,8 @@ type Server struct {
 	GenericTokenURL     string   `long:"generic-token-url" description:"OAuth 2.0 provider's token endpoint URL" env:"GENERIC_TOKEN_URL"`
 	GenericAPIURL       string   `long:"generic-api-url" description:"URL that returns OpenID UserInfo compatible information." env:"GENERIC_API_URL"`
 	GenericAPIKey       string   `long:"generic-api-key" description:"JSON lookup key into OpenID UserInfo. (Azure should be userPrincipalName)" default:"email" env:"GENERIC_API_KEY"`
+	GenericGroupsClaim  string   `long:"generic-groups-claim" description:"Dot separated path of the id_token or UserInfo claim listing the groups of users, matched by mappings (example groups)" env:"GENERIC_GROUPS_CLAIM"`
+	GenericRolesClaim   string   `long:"generic-roles-claim" description:"Dot separated path of the id_token or UserInfo claim listing the roles of users, matched by mappings (example realm_access.roles)" env:"GENERIC_ROLES_CLAIM"`
 	GenericInsecure     bool           `long:"generic-insecure" description:"Whether or not to verify auth-url's tls certificates." env:"GENERIC_INSECURE"`
 	GenericRootCA       flags.Filename `long:"generic-root-ca" description:"File location of root ca cert for generic oauth tls verification." env:"GENERIC_ROOT_CA"`
 
@@ -113,6 +132,40 @@ type Server struct {
 	Auth0Organizations []string `long:"auth0-organizations" description:"Auth0 organizations permitted to access CloudHub (env comma separated)" env:"AUTH0_ORGS" env-delim:","`
 	Auth0SuperAdminOrg string   `long:"auth0-superadmin-org" description:"Auth0 organization from which users are automatically granted SuperAdmin status" env:"AUTH0_SUPERADMIN_ORG"`
 
+	LDAPURL               string         `long:"ldap-url" description:"URL of the LDAP or Active Directory server for LDAP authentication (ldap://host:389 or ldaps://host:636)" env:"LDAP_URL"`
+	LDAPStartTLS          bool           `long:"ldap-start-tls" description:"Upgrade the ldap:// connection to TLS with StartTLS" env:"LDAP_START_TLS"`
+	LDAPInsecure          bool           `long:"ldap-insecure" description:"Whether or not to verify the TLS certificates of the LDAP server" env:"LDAP_INSECURE"`
+	LDAPRootCA            flags.Filename `long:"ldap-root-ca" description:"File location of root ca cert for LDAP tls verification" env:"LDAP_ROOT_CA"`
+	LDAPBindDN            string         `long:"ldap-bind-dn" description:"DN searching users and groups. Empty searches anonymously." env:"LDAP_BIND_DN"`
+	LDAPBindPassword      string         `long:"ldap-bind-password" description:"Password of the LDAP bind DN" env:"LDAP_BIND_PASSWORD"`
+	LDAPUserBaseDN        string         `long:"ldap-user-base-dn" description:"Base DN of the LDAP users (e.g. 'ou=people,dc=example,dc=com')" env:"LDAP_USER_BASE_DN"`
+	LDAPUserFilter        string         `long:"ldap-user-filter" description:"Filter of the LDAP user of a username, which replaces %s (Active Directory should be '(sAMAccountName=%s)')" default:"(uid=%s)" env:"LDAP_USER_FILTER"`
+	LDAPNameAttribute     string         `long:"ldap-name-attribute" description:"Attribute of the LDAP user used as the CloudHub user name (e.g. 'mail'). Empty uses the username." env:"LDAP_NAME_ATTRIBUTE"`
+	LDAPMemberOfAttribute string         `long:"ldap-memberof-attribute" description:"Attribute of the LDAP user listing the DNs of its groups (Active Directory should be 'memberOf')" env:"LDAP_MEMBEROF_ATTRIBUTE"`
+	LDAPGroupBaseDN       string         `long:"ldap-group-base-dn" description:"Base DN of the LDAP groups searched for the groups of a user. Empty does not search groups." env:"LDAP_GROUP_BASE_DN"`
+	LDAPGroupFilter       string         `long:"ldap-group-filter" description:"Filter of the LDAP groups of a user DN, which replaces %s" default:"(member=%s)" env:"LDAP_GROUP_FILTER"`
+	LDAPGroupAttribute    string         `long:"ldap-group-attribute" description:"Attribute of the LDAP groups used as their name in mappings" default:"cn" env:"LDAP_GROUP_ATTRIBUTE"`
+	LDAPSuperAdminGroup   string         `long:"ldap-superadmin-group" description:"LDAP group from which users are automatically granted SuperAdmin status" env:"LDAP_SUPERADMIN_GROUP"`
+
+	SAMLIDPMetadata     flags.Filename `long:"saml-idp-metadata" description:"File location of the SAML metadata of the identity provider for SAML 2.0 single sign-on" env:"SAML_IDP_METADATA"`
+	SAMLEntityID        string         `long:"saml-entity-id" description:"Entity ID of CloudHub at the SAML identity provider. Empty uses the URL of its metadata, <public-url>/oauth/saml/metadata." env:"SAML_ENTITY_ID"`
+	SAMLEmailAttribute  string         `long:"saml-email-attribute" description:"SAML attribute used as the CloudHub user name (e.g. 'email'). Empty uses the NameID of the assertion." env:"SAML_EMAIL_ATTRIBUTE"`
+	SAMLGroupsAttribute string         `long:"saml-groups-attribute" description:"SAML attribute of the groups of a user, which mappings of the saml provider match" default:"groups" env:"SAML_GROUPS_ATTRIBUTE"`
+	SAMLSuperAdminGroup string         `long:"saml-superadmin-group" description:"SAML group from which users are automatically granted SuperAdmin status" env:"SAML_SUPERADMIN_GROUP"`
+
+	LocalAuth                bool          `long:"local-auth" description:"Enable authentication of users with a password stored by CloudHub" env:"LOCAL_AUTH"`
+	LocalAdmin               string        `long:"local-admin" description:"Name of the local SuperAdmin created at startup if it does not exist" default:"admin" env:"LOCAL_ADMIN"`
+	LocalAdminPassword       string        `long:"local-admin-password" description:"Initial password of the local SuperAdmin. Empty does not create it." env:"LOCAL_ADMIN_PASSWORD"`
+	PasswordMinLength        int           `long:"password-min-length" description:"Minimum length of the passwords of local users" default:"8" env:"PASSWORD_MIN_LENGTH"`
+	PasswordRequireMixedCase bool          `long:"password-require-mixed-case" description:"Require upper and lower case letters in the passwords of local users" env:"PASSWORD_REQUIRE_MIXED_CASE"`
+	PasswordRequireDigit     bool          `long:"password-require-digit" description:"Require a digit in the passwords of local users" env:"PASSWORD_REQUIRE_DIGIT"`
+	PasswordRequireSymbol    bool          `long:"password-require-symbol" description:"Require a symbol in the passwords of local users" env:"PASSWORD_REQUIRE_SYMBOL"`
+	LoginMaxAttempts         int           `long:"login-max-attempts" description:"Consecutive failed logins of a local user, or wrong two-factor codes of any user, after which the user is locked out. 0 disables the lockout." default:"5" env:"LOGIN_MAX_ATTEMPTS"`
+	LoginLockoutDuration     time.Duration `long:"login-lockout-duration" description:"Duration for which a user is locked out after failed logins or wrong two-factor codes" default:"15m" env:"LOGIN_LOCKOUT_DURATION"`
+
+	SCIMToken    string `long:"scim-token" description:"Bearer token of the identity provider provisioning users and groups with the SCIM 2.0 API at /scim/v2. Empty disables the API." env:"SCIM_TOKEN"`
+	SCIMProvider string `long:"scim-provider" description:"Provider with which the users provisioned through SCIM log in (e.g. 'generic', 'saml' or 'ldap'), which mappings of the provisioned groups match" env:"SCIM_PROVIDER"`
+
 	StatusFeedURL          string            `long:"status-feed-url" description:"URL of a JSON Feed to display as a News Feed on the client Status page." default:"https://www.snetgroup.info/" env:"STATUS_FEED_URL"`
 	CustomLinks            map[string]string `long:"custom-link" description:"Custom link to be added to the client User menu. Multiple links can be added by using multiple of the same flag with different 'name:url' values, or as an environment variable with comma-separated 'name:url' values. E.g. via flags: '--custom-link=snetsystems:https://www.snetsystems.com --custom-link=CloudHub:https://github.com/snetsystems/cloudhub'. E.g. via environment variable: 'export CUSTOM_LINKS=snetsystems:https://www.snetsystems.com,CloudHub:https://github.com/snetsystems/cloudhub'" env:"CUSTOM_LINKS" env-delim:","`
 	TelegrafSystemInterval time.Duration     `long:"telegraf-system-interval" default:"1m" description:"Duration used in the GROUP BY time interval for the hosts list" env:"TELEGRAF_SYSTEM_INTERVAL"`
@@ -166,7 +219,7 @@ func (s *Server) UseGoogle() error {
 
 	if s.TokenSecret != "" && s.GoogleClientID != "" && s.GoogleClientSecret != "" && s.PublicURL != "" {
 		return nil
-	} else if s.GoogleClientID == "" && s.GoogleClientSecret == "" && s.PublicURL == "" {
+	} else if s.GoogleClientID == "" && s.GoogleClientSecret == "" {
 		return errNoAuth
 	}
 
@@ -238,6 +291,66 @@ func (s *Server) UseAuth0() error {
 	return nil
 }
 
+// UseLDAP validates the CLI parameters to enable LDAP support
+func (s *Server) UseLDAP() error {
+	errMsg := []string{}
+
+	if s.TokenSecret != "" && s.LDAPURL != "" && s.LDAPUserBaseDN != "" {
+		return nil
+	} else if s.LDAPURL == "" && s.LDAPUserBaseDN == "" {
+		return errNoAuth
+	}
+
+	if s.TokenSecret == "" {
+		errMsg = append(errMsg, "token secret")
+	}
+	if s.LDAPURL == "" {
+		errMsg = append(errMsg, "url")
+	}
+	if s.LDAPUserBaseDN == "" {
+		errMsg = append(errMsg, "user base dn")
+	}
+	if errMsg != nil {
+		return fmt.Errorf("missing LDAP setting[s]: %s", strings.Join(errMsg, ", "))
+	}
+
+	return nil
+}
+
+// UseSAML validates the CLI parameters to enable SAML support
+func (s *Server) UseSAML() error {
+	errMsg := []string{}
+
+	if s.TokenSecret != "" && s.PublicURL != "" && s.SAMLIDPMetadata != "" {
+		return nil
+	} else if s.SAMLIDPMetadata == "" {
+		return errNoAuth
+	}
+
+	if s.TokenSecret == "" {
+		errMsg = append(errMsg, "token secret")
+	}
+	if s.PublicURL == "" {
+		errMsg = append(errMsg, "public url")
+	}
+	if errMsg != nil {
+		return fmt.Errorf("missing SAML setting[s]: %s", strings.Join(errMsg, ", "))
+	}
+
+	return nil
+}
+
+// UseLocal validates the CLI parameters to enable local authentication
+func (s *Server) UseLocal() error {
+	if !s.LocalAuth {
+		return errNoAuth
+	}
+	if s.TokenSecret == "" {
+		return fmt.Errorf("missing local auth setting[s]: token secret")
+	}
+	return nil
+}
+
 // UseGenericOAuth2 validates the CLI parameters to enable generic oauth support
 func (s *Server) UseGenericOAuth2() error {
 	errMsg := []string{}
@@ -357,6 +470,8 @@ func (s *Server) genericOAuth(logger cloudhub.Logger, auth oauth2.Authenticator)
 		TokenURL:       s.GenericTokenURL,
 		APIURL:         s.GenericAPIURL,
 		APIKey:         s.GenericAPIKey,
+		GroupsClaim:    s.GenericGroupsClaim,
+		RolesClaim:     s.GenericRolesClaim,
 		Logger:         logger,
 	}
 	jwt := oauth2.NewJWT(s.TokenSecret, s.JwksURL)
@@ -385,6 +500,130 @@ func (s *Server) auth0OAuth(logger cloudhub.Logger, auth oauth2.Authenticator) (
 	return &auth0, genMux, s.UseAuth0
 }
 
+func (s *Server) ldapAuth(logger cloudhub.Logger, auth oauth2.Authenticator) (oauth2.Provider, oauth2.Mux, func() error) {
+	config := &ldap.Config{
+		URL:               s.LDAPURL,
+		StartTLS:          s.LDAPStartTLS,
+		BindDN:            s.LDAPBindDN,
+		BindPassword:      s.LDAPBindPassword,
+		UserBaseDN:        s.LDAPUserBaseDN,
+		UserFilter:        s.LDAPUserFilter,
+		NameAttribute:     s.LDAPNameAttribute,
+		MemberOfAttribute: s.LDAPMemberOfAttribute,
+		GroupBaseDN:       s.LDAPGroupBaseDN,
+		GroupFilter:       s.LDAPGroupFilter,
+		GroupAttribute:    s.LDAPGroupAttribute,
+	}
+	provider := oauth2.LDAP{
+		Directory: config,
+		Logger:    logger,
+	}
+	jwt := oauth2.NewJWT(s.TokenSecret, s.JwksURL)
+	ldapMux := oauth2.NewCredentialsMux(&provider, auth, jwt, s.Basepath, logger)
+
+	certs, err := getCerts(string(s.LDAPRootCA))
+	if err != nil {
+		logger.Error("Error reading LDAP root CA: err:", err)
+		return &provider, ldapMux, func() error { return fmt.Errorf("failed to read LDAP root CA: %s", err.Error()) }
+	}
+	config.TLSConfig = &tls.Config{
+		InsecureSkipVerify: s.LDAPInsecure,
+		RootCAs:            certs,
+	}
+	return &provider, ldapMux, s.UseLDAP
+}
+
+func (s *Server) samlAuth(logger cloudhub.Logger, auth oauth2.Authenticator) (oauth2.Provider, oauth2.Mux, func() error) {
+	sp := &saml.ServiceProvider{EntityID: s.SAMLEntityID}
+	provider := oauth2.SAML{
+		SP:              sp,
+		EmailAttribute:  s.SAMLEmailAttribute,
+		GroupsAttribute: s.SAMLGroupsAttribute,
+		Logger:          logger,
+	}
+	jwt := oauth2.NewJWT(s.TokenSecret, s.JwksURL)
+	samlMux := oauth2.NewSAMLMux(&provider, auth, jwt, s.Basepath, logger)
+	if s.SAMLIDPMetadata == "" {
+		return &provider, samlMux, s.UseSAML
+	}
+
+	publicURL, err := url.Parse(s.PublicURL)
+	if err != nil {
+		logger.Error("Error parsing public URL: err:", err)
+		return &provider, samlMux, func() error { return fmt.Errorf("failed to parse public URL: %s", err.Error()) }
+	}
+	publicURL.Path = path.Join(s.Basepath, "oauth", "saml", "callback")
+	sp.ACSURL = publicURL.String()
+	if sp.EntityID == "" {
+		publicURL.Path = path.Join(s.Basepath, "oauth", "saml", "metadata")
+		sp.EntityID = publicURL.String()
+	}
+
+	md, err := ioutil.ReadFile(string(s.SAMLIDPMetadata))
+	if err == nil {
+		var idp *saml.IdentityProvider
+		if idp, err = saml.ParseIDPMetadata(md); err == nil {
+			sp.IDPEntityID = idp.EntityID
+			sp.IDPSSOURL = idp.SSOURL
+			sp.IDPCertificates = idp.Certificates
+		}
+	}
+	if err != nil {
+		logger.Error("Error reading SAML IdP metadata: err:", err)
+		return &provider, samlMux, func() error { return fmt.Errorf("failed to read SAML IdP metadata: %s", err.Error()) }
+	}
+	return &provider, samlMux, s.UseSAML
+}
+
+func (s *Server) localAuth(logger cloudhub.Logger, auth oauth2.Authenticator, provider *oauth2.Local) (oauth2.Provider, oauth2.Mux, func() error) {
+	jwt := oauth2.NewJWT(s.TokenSecret, s.JwksURL)
+	localMux := oauth2.NewCredentialsMux(provider, auth, jwt, s.Basepath, logger)
+	return provider, localMux, s.UseLocal
+}
+
+func (s *Server) passwordPolicy() oauth2.PasswordPolicy {
+	return oauth2.PasswordPolicy{
+		MinLength:        s.PasswordMinLength,
+		RequireMixedCase: s.PasswordRequireMixedCase,
+		RequireDigit:     s.PasswordRequireDigit,
+		RequireSymbol:    s.PasswordRequireSymbol,
+	}
+}
+
+// addLocalAdmin creates the local SuperAdmin with its initial password,
+// unless it exists
+func (s *Server) addLocalAdmin(ctx context.Context, service Service) error {
+	ctx = serverContext(ctx)
+	provider, scheme := oauth2.LocalProvider, "oauth2"
+	_, err := service.Store.Users(ctx).Get(ctx, cloudhub.UserQuery{
+		Name:     &s.LocalAdmin,
+		Provider: &provider,
+		Scheme:   &scheme,
+	})
+	if err != cloudhub.ErrUserNotFound {
+		return err
+	}
+
+	org, err := service.Store.Organizations(ctx).DefaultOrganization(ctx)
+	if err != nil {
+		return err
+	}
+	admin := &cloudhub.User{
+		Name:       s.LocalAdmin,
+		Provider:   provider,
+		Scheme:     scheme,
+		SuperAdmin: true,
+		Roles: []cloudhub.Role{
+			{Organization: org.ID, Name: roles.AdminRoleName},
+		},
+	}
+	if err := service.PasswordPolicy.SetPassword(admin, s.LocalAdminPassword); err != nil {
+		return fmt.Errorf("invalid local admin password: %v", err)
+	}
+	_, err = service.Store.Users(ctx).Add(ctx, admin)
+	return err
+}
+
 func (s *Server) genericRedirectURL() string {
 	if s.PublicURL == "" {
 		return ""
@@ -404,6 +643,29 @@ func (s *Server) genericRedirectURL() string {
 	return publicURL.String()
 }
 
+// newQueryGuard creates the guard of the Influx proxy; nil when no limit is set
+func (s *Server) newQueryGuard() *QueryGuard {
+	g := &QueryGuard{
+		Limits: influx.QueryLimits{
+			MaxDuration:       s.QueryMaxDuration,
+			RequireTimeBounds: s.QueryRequireTimeBounds,
+			MaxWildcardSeries: s.QueryMaxWildcardSeries,
+			MaxPoints:         s.QueryMaxPoints,
+			RawInterval:       s.QueryRawInterval,
+		},
+		UserConcurrency: s.QueryUserConcurrency,
+		OrgConcurrency:  s.QueryOrgConcurrency,
+		UserRate:        s.QueryUserRate,
+		OrgRate:         s.QueryOrgRate,
+	}
+	limits := g.Limits
+	limits.RawInterval = 0
+	if limits == (influx.QueryLimits{}) && g.UserConcurrency <= 0 && g.OrgConcurrency <= 0 && g.UserRate <= 0 && g.OrgRate <= 0 {
+		return nil
+	}
+	return g
+}
+
 func (s *Server) useAuth() bool {
 	useAuths := []func() error{
 		s.UseGithub,
@@ -411,6 +673,9 @@ func (s *Server) useAuth() bool {
 		s.UseHeroku,
 		s.UseGenericOAuth2,
 		s.UseAuth0,
+		s.UseLDAP,
+		s.UseSAML,
+		s.UseLocal,
 	}
 
 	var err error
@@ -437,6 +702,9 @@ func (s *Server) validateAuth() error {
 		s.UseHeroku,
 		s.UseGenericOAuth2,
 		s.UseAuth0,
+		s.UseLDAP,
+		s.UseSAML,
+		s.UseLocal,
 	}
 
 	var errs []string
@@ -450,6 +718,10 @@ func (s *Server) validateAuth() error {
 		errs = append(errs, "token secret without oauth config is invalid")
 	}
 
+	if s.SCIMToken != "" && s.SCIMProvider == "" {
+		errs = append(errs, "scim token requires the scim provider of the provisioned users")
+	}
+
 	if len(errs) == 0 {
 		return nil
 	}
@@ -582,10 +854,44 @@ func (s *Server) Serve(ctx context.Context) {
 	service := openService(ctx, db, s.newBuilders(logger), logger, s.useAuth(), s.AddonURLs)
 	service.SuperAdminProviderGroups = superAdminProviderGroups{
 		auth0: s.Auth0SuperAdminOrg,
+		ldap:  s.LDAPSuperAdminGroup,
+		saml:  s.SAMLSuperAdminGroup,
+	}
+	service.PasswordPolicy = s.passwordPolicy()
+	service.SCIMProvider = s.SCIMProvider
+	service.SecondFactor = &oauth2.TOTP{
+		Users:           service.Store.Users(serverContext(ctx)),
+		MaxAttempts:     s.LoginMaxAttempts,
+		LockoutDuration: s.LoginLockoutDuration,
+		Logger:          logger,
+	}
+	// Logins and password changes share the lockout of local users
+	service.Local = &oauth2.Local{
+		Users:           service.Store.Users(serverContext(ctx)),
+		MaxAttempts:     s.LoginMaxAttempts,
+		LockoutDuration: s.LoginLockoutDuration,
+		Logger:          logger,
+	}
+	if s.LocalAuth && s.LocalAdminPassword != "" {
+		if err := s.addLocalAdmin(ctx, service); err != nil {
+			logger.
+				WithField("component", "server").
+				WithField("provider", oauth2.LocalProvider).
+				Error("Unable to create the local admin: ", err)
+			return
+		}
 	}
 	service.Env = cloudhub.Environment{
 		TelegrafSystemInterval: s.TelegrafSystemInterval,
 	}
+	if s.QueryCacheSize > 0 {
+		service.QueryCache = influx.NewQueryCache(s.QueryCacheSize)
+		service.QueryCache.MaxTTL = s.QueryCacheMaxTTL
+		service.QueryCache.SchemaTTL = s.SchemaCacheTTL
+		// Schema queries of the database endpoints share the cache of each source
+		service.Databases = &influx.Client{Logger: logger, Cache: service.QueryCache}
+	}
+	service.QueryGuard = s.newQueryGuard()
 
 	if !validBasepath(s.Basepath) {
 		err := fmt.Errorf("Invalid basepath, must follow format \"/mybasepath\"")
@@ -619,18 +925,28 @@ func (s *Server) Serve(ctx context.Context) {
 		},
 	}
 
-	auth := oauth2.NewCookieJWT(s.TokenSecret, s.AuthDuration)
+	// Every login is recorded as a session, which can be listed and revoked
+	cookie := oauth2.NewCookieJWT(s.TokenSecret, s.AuthDuration)
+	auth := oauth2.NewSessions(cookie, service.Store.Sessions(serverContext(ctx)), s.AuthDuration, logger)
+	// Roles mapped from the groups of users follow their groups on every login
+	mapped := oauth2.NewRoleMapping(auth, &service)
+	// Logins of users with a second factor are only authorized once it is verified
+	twoFactor := oauth2.NewTwoFactor(s.TokenSecret, mapped, service.SecondFactor, s.Basepath, logger)
 	providerFuncs := []func(func(oauth2.Provider, oauth2.Mux)){
-		provide(s.githubOAuth(logger, auth)),
-		provide(s.googleOAuth(logger, auth)),
-		provide(s.herokuOAuth(logger, auth)),
-		provide(s.genericOAuth(logger, auth)),
-		provide(s.auth0OAuth(logger, auth)),
+		provide(s.githubOAuth(logger, twoFactor)),
+		provide(s.googleOAuth(logger, twoFactor)),
+		provide(s.herokuOAuth(logger, twoFactor)),
+		provide(s.genericOAuth(logger, twoFactor)),
+		provide(s.auth0OAuth(logger, twoFactor)),
+		provide(s.ldapAuth(logger, twoFactor)),
+		provide(s.samlAuth(logger, twoFactor)),
+		provide(s.localAuth(logger, twoFactor, service.Local)),
 	}
 
 	handler := NewMux(MuxOpts{
 		Develop:       s.Develop,
 		Auth:          auth,
+		TwoFactor:     twoFactor,
 		Logger:        logger,
 		UseAuth:       s.useAuth(),
 		ProviderFuncs: providerFuncs,
@@ -641,6 +957,7 @@ func (s *Server) Serve(ctx context.Context) {
 		DisableGZip:   s.DisableGZip,
 		AddonURLs:     s.AddonURLs,
 		AddonTokens:   s.AddonTokens,
+		SCIMToken:     s.SCIMToken,
 	}, service)
 
 	// Add CloudHub's version header to all requests
@@ -766,6 +1083,11 @@ func openService(ctx context.Context, db kv.Store, builder builders, logger clou
 			MappingsStore:           svc.MappingsStore(),
 			OrganizationConfigStore: svc.OrganizationConfigStore(),
 			VspheresStore:           svc.VspheresStore(),
+			AlertTemplatesStore:     svc.AlertTemplatesStore(),
+			APITokensStore:          svc.APITokensStore(),
+			PoliciesStore:           svc.PoliciesStore(),
+			GroupsStore:             svc.GroupsStore(),
+			SessionsStore:           svc.SessionsStore(),
 		},
 		Logger:                   logger,
 		UseAuth:                  useAuth,
@@ -143,6 +143,54 @@ func TestValidAuth(t *testing.T) {
 			},
 			err: "missing Google oauth setting[s]: token secret, client secret, public url",
 		},
+		{
+			desc: "test valid ldap config",
+			s: &Server{
+				LDAPURL:        "ldaps://ad.example.com",
+				LDAPUserBaseDN: "dc=example,dc=com",
+				TokenSecret:    "abc123",
+			},
+			err: "<nil>",
+		},
+		{
+			desc: "test invalid ldap config (no token or user base dn)",
+			s: &Server{
+				LDAPURL: "ldaps://ad.example.com",
+			},
+			err: "missing LDAP setting[s]: token secret, user base dn",
+		},
+		{
+			desc: "test valid saml config",
+			s: &Server{
+				SAMLIDPMetadata: "idp.xml",
+				PublicURL:       "https://cloudhub.example.com",
+				TokenSecret:     "abc123",
+			},
+			err: "<nil>",
+		},
+		{
+			desc: "test invalid saml config (no public url)",
+			s: &Server{
+				SAMLIDPMetadata: "idp.xml",
+				TokenSecret:     "abc123",
+			},
+			err: "missing SAML setting[s]: public url",
+		},
+		{
+			desc: "test valid local auth config",
+			s: &Server{
+				LocalAuth:   true,
+				TokenSecret: "abc123",
+			},
+			err: "<nil>",
+		},
+		{
+			desc: "test invalid local auth config (no token)",
+			s: &Server{
+				LocalAuth: true,
+			},
+			err: "missing local auth setting[s]: token secret",
+		},
 		{
 			desc: "test invalid config (only token)",
 			s: &Server{
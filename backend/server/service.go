@@ -5,6 +5,8 @@ import (
 
 	cloudhub "github.com/snetsystems/cloudhub/backend"
 	"github.com/snetsystems/cloudhub/backend/influx"
+	"github.com/snetsystems/cloudhub/backend/oauth2"
+	"github.com/snetsystems/cloudhub/backend/prometheus"
 )
 
 // Service handles REST calls to the persistence
@@ -17,10 +19,18 @@ type Service struct {
 	Env                      cloudhub.Environment
 	Databases                cloudhub.Databases
 	AddonURLs                map[string]string
+	QueryCache               *influx.QueryCache
+	QueryGuard               *QueryGuard
+	PasswordPolicy           oauth2.PasswordPolicy
+	SecondFactor             oauth2.SecondFactor
+	Local                    *oauth2.Local // Local checks the passwords of local users toward their lockout
+	SCIMProvider             string        // SCIMProvider is the provider of the users provisioned through SCIM
 }
 
 type superAdminProviderGroups struct {
 	auth0 string
+	ldap  string
+	saml  string
 }
 
 // TimeSeriesClient returns the correct client for a time series database.
@@ -37,6 +47,9 @@ type ErrorMessage struct {
 
 // TimeSeries returns a new client connected to a time series database
 func (s *Service) TimeSeries(src cloudhub.Source) (cloudhub.TimeSeries, error) {
+	if src.Type == cloudhub.Prometheus {
+		return (&PrometheusClient{}).New(src, s.Logger)
+	}
 	return s.TimeSeriesClient.New(src, s.Logger)
 }
 
@@ -54,3 +67,18 @@ func (c *InfluxClient) New(src cloudhub.Source, logger cloudhub.Logger) (cloudhu
 
 	return client, nil
 }
+
+// PrometheusClient returns a new client to connect to Prometheus
+type PrometheusClient struct{}
+
+// New creates a client to connect to Prometheus
+func (c *PrometheusClient) New(src cloudhub.Source, logger cloudhub.Logger) (cloudhub.TimeSeries, error) {
+	client := &prometheus.Client{
+		Logger: logger,
+	}
+	if err := client.Connect(context.TODO(), &src); err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
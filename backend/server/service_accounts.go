@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// ServiceAccountProvider is the provider of service accounts. No provider
+// logs in as it, so service accounts only authenticate with API tokens.
+const ServiceAccountProvider = "serviceaccount"
+
+// validServiceAccount checks a request to create or update a service
+// account of the organization org, and sets its owner on the user
+func (s *Service) validServiceAccount(ctx context.Context, req userRequest, org string, u *cloudhub.User) error {
+	if org == "" {
+		return fmt.Errorf("service accounts are managed within an organization")
+	}
+	if req.SuperAdmin {
+		return fmt.Errorf("service accounts cannot be SuperAdmins")
+	}
+	if req.Password != "" {
+		return fmt.Errorf("service accounts cannot have a password")
+	}
+	if len(u.Roles) != 1 || u.Roles[0].Organization != org {
+		return fmt.Errorf("service accounts have exactly one role in organization %s", org)
+	}
+
+	owner := req.Owner
+	if owner == 0 {
+		owner = u.Owner
+	}
+	if owner == 0 {
+		ctxUser, ok := hasUserContext(ctx)
+		if !ok {
+			return fmt.Errorf("owner required on service account request body")
+		}
+		owner = ctxUser.ID
+	}
+
+	serverCtx := serverContext(ctx)
+	o, err := s.Store.Users(serverCtx).Get(serverCtx, cloudhub.UserQuery{ID: &owner})
+	if err != nil {
+		return fmt.Errorf("owner %d: %v", owner, err)
+	}
+	if o.ServiceAccount {
+		return fmt.Errorf("owner %d is a service account", owner)
+	}
+	if !o.SuperAdmin && !hasRoleInOrganization(o, org) {
+		return fmt.Errorf("owner %d is not a member of organization %s", owner, org)
+	}
+
+	u.Owner = owner
+	return nil
+}
+
+func hasRoleInOrganization(u *cloudhub.User, org string) bool {
+	for _, r := range u.Roles {
+		if r.Organization == org {
+			return true
+		}
+	}
+	return false
+}
+
+// serviceAccount returns the service account of a request to the
+// organization users API
+func (s *Service) serviceAccount(ctx context.Context) (*cloudhub.User, error) {
+	idStr := httprouter.GetParamFromContext(ctx, "id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user id: %s", err.Error())
+	}
+	u, err := s.Store.Users(ctx).Get(ctx, cloudhub.UserQuery{ID: &id})
+	if err != nil {
+		return nil, err
+	}
+	if !u.ServiceAccount {
+		return nil, fmt.Errorf("user %d is not a service account", id)
+	}
+	return u, nil
+}
+
+func serviceAccountTokensPath(ctx context.Context, u *cloudhub.User) string {
+	return fmt.Sprintf("/cloudhub/v1/organizations/%s/users/%d/tokens", httprouter.GetParamFromContext(ctx, "oid"), u.ID)
+}
+
+// ServiceAccountTokens lists the API tokens of a service account
+func (s *Service) ServiceAccountTokens(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	u, err := s.serviceAccount(ctx)
+	if err != nil {
+		Error(w, http.StatusNotFound, err.Error(), s.Logger)
+		return
+	}
+
+	s.apiTokens(w, ctx, u, serviceAccountTokensPath(ctx, u))
+}
+
+// NewServiceAccountToken creates an API token of a service account in its
+// organization
+func (s *Service) NewServiceAccountToken(w http.ResponseWriter, r *http.Request) {
+	var req apiTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	u, err := s.serviceAccount(ctx)
+	if err != nil {
+		Error(w, http.StatusNotFound, err.Error(), s.Logger)
+		return
+	}
+	org := httprouter.GetParamFromContext(ctx, "oid")
+	if req.Organization != "" && req.Organization != org {
+		invalidData(w, fmt.Errorf("service accounts only have API tokens of organization %s", org), s.Logger)
+		return
+	}
+	req.Organization = org
+
+	s.newAPIToken(w, ctx, u, req, serviceAccountTokensPath(ctx, u))
+}
+
+// RemoveServiceAccountToken revokes an API token of a service account
+func (s *Service) RemoveServiceAccountToken(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	u, err := s.serviceAccount(ctx)
+	if err != nil {
+		Error(w, http.StatusNotFound, err.Error(), s.Logger)
+		return
+	}
+
+	s.removeAPIToken(w, ctx, u, httprouter.GetParamFromContext(ctx, "tid"))
+}
+
+// removeServiceAccount deletes a service account and revokes its API tokens
+func (s *Service) removeServiceAccount(ctx context.Context, u *cloudhub.User) error {
+	serverCtx := serverContext(ctx)
+	tokens, err := s.Store.APITokens(serverCtx).All(serverCtx)
+	if err != nil {
+		return err
+	}
+	for _, t := range tokens {
+		if t.UserID != u.ID {
+			continue
+		}
+		if err := s.Store.APITokens(serverCtx).Delete(serverCtx, t); err != nil {
+			return err
+		}
+	}
+	return s.Store.Users(serverCtx).Delete(serverCtx, u)
+}
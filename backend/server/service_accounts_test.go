@@ -0,0 +1,198 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+	"github.com/snetsystems/cloudhub/backend/roles"
+)
+
+// serviceAccountsStore returns a DataStore of users by ID and of API tokens
+func serviceAccountsStore(users map[uint64]*cloudhub.User, tokens map[string]cloudhub.APIToken) *mocks.Store {
+	store := apiTokensStore(&cloudhub.User{}, tokens)
+	store.UsersStore = &mocks.UsersStore{
+		AddF: func(ctx context.Context, u *cloudhub.User) (*cloudhub.User, error) {
+			u.ID = uint64(len(users) + 1)
+			users[u.ID] = u
+			return u, nil
+		},
+		DeleteF: func(ctx context.Context, u *cloudhub.User) error {
+			delete(users, u.ID)
+			return nil
+		},
+		GetF: func(ctx context.Context, q cloudhub.UserQuery) (*cloudhub.User, error) {
+			u, ok := users[*q.ID]
+			if !ok {
+				return nil, cloudhub.ErrUserNotFound
+			}
+			cp := *u
+			return &cp, nil
+		},
+	}
+	store.ConfigStore = &mocks.ConfigStore{
+		Config: &cloudhub.Config{
+			Auth: cloudhub.AuthConfig{SuperAdminNewUsers: true},
+		},
+	}
+	return store
+}
+
+func TestService_NewUser_ServiceAccount(t *testing.T) {
+	admin := &cloudhub.User{ID: 1, Name: "admin", Provider: "github", Scheme: "oauth2", Roles: []cloudhub.Role{{Organization: "1", Name: roles.AdminRoleName}}}
+	outsider := &cloudhub.User{ID: 2, Name: "outsider", Provider: "github", Scheme: "oauth2", Roles: []cloudhub.Role{{Organization: "0", Name: roles.AdminRoleName}}}
+
+	tests := []struct {
+		name       string
+		req        userRequest
+		wantStatus int
+		wantOwner  uint64
+	}{
+		{
+			name: "Service account owned by the admin creating it",
+			req: userRequest{
+				Name:           "provisioner",
+				ServiceAccount: true,
+				Roles:          []cloudhub.Role{{Organization: "1", Name: roles.EditorRoleName}},
+			},
+			wantStatus: http.StatusCreated,
+			wantOwner:  1,
+		},
+		{
+			name: "Service account with an owner outside of the organization",
+			req: userRequest{
+				Name:           "provisioner",
+				ServiceAccount: true,
+				Owner:          2,
+				Roles:          []cloudhub.Role{{Organization: "1", Name: roles.EditorRoleName}},
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "Service account with a role in another organization",
+			req: userRequest{
+				Name:           "provisioner",
+				ServiceAccount: true,
+				Roles:          []cloudhub.Role{{Organization: "0", Name: roles.EditorRoleName}},
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "Service account as a SuperAdmin",
+			req: userRequest{
+				Name:           "provisioner",
+				ServiceAccount: true,
+				SuperAdmin:     true,
+				Roles:          []cloudhub.Role{{Organization: "1", Name: roles.EditorRoleName}},
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "Person with the provider of service accounts",
+			req: userRequest{
+				Name:     "provisioner",
+				Provider: ServiceAccountProvider,
+				Scheme:   "oauth2",
+				Roles:    []cloudhub.Role{{Organization: "1", Name: roles.EditorRoleName}},
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := map[uint64]*cloudhub.User{1: admin, 2: outsider}
+			s := &Service{
+				Store:  serviceAccountsStore(users, map[string]cloudhub.APIToken{}),
+				Logger: log.New(log.DebugLevel),
+			}
+
+			b, _ := json.Marshal(tt.req)
+			r := httptest.NewRequest("POST", "http://any.url", bytes.NewReader(b))
+			ctx := httprouter.WithParams(context.Background(), httprouter.Params{{Key: "oid", Value: "1"}})
+			ctx = context.WithValue(ctx, UserContextKey, admin)
+			w := httptest.NewRecorder()
+			s.NewUser(w, r.WithContext(ctx))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("NewUser() = %v, want %v: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusCreated {
+				return
+			}
+			u := users[3]
+			if !u.ServiceAccount || u.SuperAdmin || u.Provider != ServiceAccountProvider || u.Owner != tt.wantOwner {
+				t.Errorf("NewUser() created %+v", u)
+			}
+		})
+	}
+}
+
+func TestService_ServiceAccountTokens(t *testing.T) {
+	users := map[uint64]*cloudhub.User{
+		1: {ID: 1, Name: "admin", Provider: "github", Scheme: "oauth2", Roles: []cloudhub.Role{{Organization: "1", Name: roles.AdminRoleName}}},
+		2: {ID: 2, Name: "provisioner", Provider: ServiceAccountProvider, Scheme: "oauth2", Roles: []cloudhub.Role{{Organization: "1", Name: roles.EditorRoleName}}, ServiceAccount: true, Owner: 1},
+	}
+	tokens := map[string]cloudhub.APIToken{}
+	s := &Service{
+		Store:  serviceAccountsStore(users, tokens),
+		Logger: log.New(log.DebugLevel),
+	}
+	expiresAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	newToken := func(id, role string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "http://any.url", bytes.NewBufferString(`{"name": "salt", "role": "`+role+`", "expiresAt": "`+expiresAt+`"}`))
+		ctx := httprouter.WithParams(context.Background(), httprouter.Params{{Key: "oid", Value: "1"}, {Key: "id", Value: id}})
+		w := httptest.NewRecorder()
+		s.NewServiceAccountToken(w, r.WithContext(ctx))
+		return w
+	}
+
+	if w := newToken("1", roles.ViewerRoleName); w.Code != http.StatusNotFound {
+		t.Errorf("NewServiceAccountToken() of a person = %v, want %v", w.Code, http.StatusNotFound)
+	}
+	if w := newToken("2", roles.AdminRoleName); w.Code != http.StatusForbidden {
+		t.Errorf("NewServiceAccountToken() beyond its role = %v, want %v", w.Code, http.StatusForbidden)
+	}
+	w := newToken("2", roles.EditorRoleName)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("NewServiceAccountToken() = %v, want %v: %s", w.Code, http.StatusCreated, w.Body.String())
+	}
+	var res apiTokenResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if want := "/cloudhub/v1/organizations/1/users/2/tokens/1"; res.Links.Self != want {
+		t.Errorf("NewServiceAccountToken() link = %s, want %s", res.Links.Self, want)
+	}
+
+	_, p, err := validAPIToken(context.Background(), s.Store, res.Token, time.Now())
+	if err != nil {
+		t.Fatalf("validAPIToken() error = %v", err)
+	}
+	if p.Subject != "provisioner" || p.Issuer != ServiceAccountProvider || p.Organization != "1" {
+		t.Errorf("validAPIToken() principal = %+v", p)
+	}
+
+	// Removing the service account revokes its tokens
+	r := httptest.NewRequest("DELETE", "http://any.url", nil)
+	ctx := httprouter.WithParams(context.Background(), httprouter.Params{{Key: "oid", Value: "1"}, {Key: "id", Value: "2"}})
+	w = httptest.NewRecorder()
+	s.RemoveUser(w, r.WithContext(ctx))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("RemoveUser() = %v, want %v", w.Code, http.StatusNoContent)
+	}
+	if _, ok := users[2]; ok {
+		t.Errorf("RemoveUser() did not remove the service account")
+	}
+	if len(tokens) != 0 {
+		t.Errorf("RemoveUser() did not revoke the API tokens of the service account")
+	}
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/oauth2"
+)
+
+type sessionResponse struct {
+	cloudhub.Session
+	Current bool      `json:"current"` // Current is true for the session of the request
+	Links   selfLinks `json:"links"`
+}
+
+func newSessionResponse(session cloudhub.Session, current, base string) *sessionResponse {
+	return &sessionResponse{
+		Session: session,
+		Current: current != "" && session.ID == current,
+		Links: selfLinks{
+			Self: fmt.Sprintf("%s/%s", base, session.ID),
+		},
+	}
+}
+
+type sessionsResponse struct {
+	Links    selfLinks          `json:"links"`
+	Sessions []*sessionResponse `json:"sessions"`
+}
+
+// sessions responds with the active sessions for which owns returns true
+func (s *Service) sessions(w http.ResponseWriter, ctx context.Context, owns func(cloudhub.Session) bool, base string) {
+	serverCtx := serverContext(ctx)
+	all, err := s.Store.Sessions(serverCtx).All(serverCtx)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, err.Error(), s.Logger)
+		return
+	}
+
+	var current string
+	if p, err := getPrincipal(ctx); err == nil {
+		current = p.SessionID
+	}
+
+	now := time.Now()
+	res := &sessionsResponse{
+		Links:    selfLinks{Self: base},
+		Sessions: []*sessionResponse{},
+	}
+	for _, session := range all {
+		if owns(session) && !oauth2.SessionExpired(session, now) {
+			res.Sessions = append(res.Sessions, newSessionResponse(session, current, base))
+		}
+	}
+	sort.Slice(res.Sessions, func(i, j int) bool {
+		return res.Sessions[i].CreatedAt.Before(res.Sessions[j].CreatedAt)
+	})
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+// removeSession revokes a session for which owns returns true
+func (s *Service) removeSession(w http.ResponseWriter, ctx context.Context, owns func(cloudhub.Session) bool, id string) {
+	serverCtx := serverContext(ctx)
+	session, err := s.Store.Sessions(serverCtx).Get(serverCtx, id)
+	if err != nil || !owns(session) {
+		notFound(w, id, s.Logger)
+		return
+	}
+	if err := s.Store.Sessions(serverCtx).Delete(serverCtx, session); err != nil {
+		Error(w, http.StatusInternalServerError, err.Error(), s.Logger)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revokeSessions revokes the sessions of a user but the session except, only
+// those logged into org unless it is empty
+func (s *Service) revokeSessions(ctx context.Context, u *cloudhub.User, org, except string) error {
+	serverCtx := serverContext(ctx)
+	sessions, err := s.Store.Sessions(serverCtx).All(serverCtx)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if !sessionOf(u)(session) || (org != "" && session.Organization != org) || session.ID == except {
+			continue
+		}
+		if err := s.Store.Sessions(serverCtx).Delete(serverCtx, session); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sessionOf returns whether a session belongs to a user
+func sessionOf(u *cloudhub.User) func(cloudhub.Session) bool {
+	return func(session cloudhub.Session) bool {
+		return session.Subject == u.Name && session.Provider == u.Provider
+	}
+}
+
+// MeSessions lists the active sessions of the current user
+func (s *Service) MeSessions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	u, _, err := s.currentUser(ctx)
+	if err != nil {
+		Error(w, http.StatusForbidden, err.Error(), s.Logger)
+		return
+	}
+
+	s.sessions(w, ctx, sessionOf(u), "/cloudhub/v1/me/sessions")
+}
+
+// RemoveMeSession revokes a session of the current user, such as one of a
+// lost device
+func (s *Service) RemoveMeSession(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	u, _, err := s.currentUser(ctx)
+	if err != nil {
+		Error(w, http.StatusForbidden, err.Error(), s.Logger)
+		return
+	}
+
+	s.removeSession(w, ctx, sessionOf(u), httprouter.GetParamFromContext(ctx, "id"))
+}
+
+// Sessions lists the active sessions of all users, or of the user with the
+// ID of the user query parameter
+func (s *Service) Sessions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	owns := func(cloudhub.Session) bool { return true }
+	if uid := r.URL.Query().Get("user"); uid != "" {
+		id, err := strconv.ParseUint(uid, 10, 64)
+		if err != nil {
+			Error(w, http.StatusBadRequest, fmt.Sprintf("invalid user id: %s", err.Error()), s.Logger)
+			return
+		}
+		u, err := s.Store.Users(ctx).Get(ctx, cloudhub.UserQuery{ID: &id})
+		if err != nil {
+			Error(w, http.StatusNotFound, err.Error(), s.Logger)
+			return
+		}
+		owns = sessionOf(u)
+	}
+
+	s.sessions(w, ctx, owns, "/cloudhub/v1/sessions")
+}
+
+// RemoveSession revokes any session
+func (s *Service) RemoveSession(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	owns := func(cloudhub.Session) bool { return true }
+	s.removeSession(w, ctx, owns, httprouter.GetParamFromContext(ctx, "id"))
+}
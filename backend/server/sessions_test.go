@@ -0,0 +1,157 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+	"github.com/snetsystems/cloudhub/backend/oauth2"
+	"github.com/snetsystems/cloudhub/backend/organizations"
+)
+
+// sessionsService returns a Service of the user marty, with an in-memory
+// store of sessions
+func sessionsService(sessions map[string]cloudhub.Session) *Service {
+	return &Service{
+		Store: &mocks.Store{
+			SessionsStore: &mocks.SessionsStore{
+				AllF: func(ctx context.Context) ([]cloudhub.Session, error) {
+					all := []cloudhub.Session{}
+					for _, session := range sessions {
+						all = append(all, session)
+					}
+					return all, nil
+				},
+				DeleteF: func(ctx context.Context, session cloudhub.Session) error {
+					delete(sessions, session.ID)
+					return nil
+				},
+				GetF: func(ctx context.Context, id string) (cloudhub.Session, error) {
+					session, ok := sessions[id]
+					if !ok {
+						return cloudhub.Session{}, cloudhub.ErrSessionNotFound
+					}
+					return session, nil
+				},
+			},
+			UsersStore: &mocks.UsersStore{
+				GetF: func(ctx context.Context, q cloudhub.UserQuery) (*cloudhub.User, error) {
+					return &cloudhub.User{ID: 1, Name: "marty", Provider: "github", Scheme: "oauth2"}, nil
+				},
+				DeleteF: func(ctx context.Context, u *cloudhub.User) error {
+					return nil
+				},
+			},
+		},
+		Logger: log.New(log.DebugLevel),
+	}
+}
+
+// sessionsRequest returns a request of the session 1 of marty
+func sessionsRequest(method, id string) *http.Request {
+	r := httptest.NewRequest(method, "http://any.url/cloudhub/v1/me/sessions", nil)
+	ctx := httprouter.WithParams(context.Background(), httprouter.Params{{Key: "id", Value: id}})
+	ctx = context.WithValue(ctx, oauth2.PrincipalKey, oauth2.Principal{
+		Subject:   "marty",
+		Issuer:    "github",
+		SessionID: "1",
+	})
+	return r.WithContext(ctx)
+}
+
+func TestService_MeSessions(t *testing.T) {
+	now := time.Now().UTC()
+	sessions := map[string]cloudhub.Session{
+		"1": {ID: "1", Subject: "marty", Provider: "github", CreatedAt: now.Add(-time.Hour), LastSeenAt: now},
+		"2": {ID: "2", Subject: "marty", Provider: "github", CreatedAt: now, LastSeenAt: now, UserAgent: "curl/8.0"},
+		"3": {ID: "3", Subject: "marty", Provider: "github", CreatedAt: now.Add(-2 * time.Hour), LastSeenAt: now.Add(-time.Hour)},
+		"4": {ID: "4", Subject: "biff", Provider: "github", CreatedAt: now, LastSeenAt: now},
+	}
+	s := sessionsService(sessions)
+
+	w := httptest.NewRecorder()
+	s.MeSessions(w, sessionsRequest("GET", ""))
+	if w.Code != http.StatusOK {
+		t.Fatalf("MeSessions() = %v: %s", w.Code, w.Body.String())
+	}
+	body := w.Body.String()
+	// The expired session 3 and the session 4 of another user are not listed
+	if got := strings.Count(body, `"self":"/cloudhub/v1/me/sessions/`); got != 2 {
+		t.Errorf("MeSessions() listed %d sessions, want 2: %s", got, body)
+	}
+	if !strings.Contains(body, `"id":"1","subject":"marty"`) || strings.Index(body, `"id":"1"`) > strings.Index(body, `"id":"2"`) {
+		t.Errorf("MeSessions() = %s, want the sessions 1 and 2 by creation", body)
+	}
+	if got := strings.Count(body, `"current":true`); got != 1 {
+		t.Errorf("MeSessions() marked %d sessions as current, want 1: %s", got, body)
+	}
+}
+
+func TestService_RemoveMeSession(t *testing.T) {
+	sessions := map[string]cloudhub.Session{
+		"2": {ID: "2", Subject: "marty", Provider: "github"},
+		"4": {ID: "4", Subject: "biff", Provider: "github"},
+	}
+	s := sessionsService(sessions)
+
+	tests := []struct {
+		name       string
+		id         string
+		wantStatus int
+	}{
+		{name: "Session of another user", id: "4", wantStatus: http.StatusNotFound},
+		{name: "Missing session", id: "1337", wantStatus: http.StatusNotFound},
+		{name: "Session of the user", id: "2", wantStatus: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		s.RemoveMeSession(w, sessionsRequest("DELETE", tt.id))
+		if w.Code != tt.wantStatus {
+			t.Errorf("%q. RemoveMeSession() = %v, want %v", tt.name, w.Code, tt.wantStatus)
+		}
+	}
+	if _, ok := sessions["4"]; !ok {
+		t.Error("RemoveMeSession() revoked a session of another user")
+	}
+	if _, ok := sessions["2"]; ok {
+		t.Error("RemoveMeSession() did not revoke the session")
+	}
+}
+
+func TestService_RemoveUser_Sessions(t *testing.T) {
+	sessions := map[string]cloudhub.Session{
+		"1": {ID: "1", Subject: "marty", Provider: "github", Organization: "1"},
+		"2": {ID: "2", Subject: "marty", Provider: "github", Organization: "2"},
+		"3": {ID: "3", Subject: "biff", Provider: "github", Organization: "1"},
+	}
+	s := sessionsService(sessions)
+
+	// Removing a user from an organization logs it out of the organization
+	r := sessionsRequest("DELETE", "1")
+	r = r.WithContext(context.WithValue(r.Context(), organizations.ContextKey, "1"))
+	w := httptest.NewRecorder()
+	s.RemoveUser(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("RemoveUser() = %v: %s", w.Code, w.Body.String())
+	}
+	if _, ok := sessions["1"]; ok || len(sessions) != 2 {
+		t.Errorf("RemoveUser() from an organization left the sessions %v", sessions)
+	}
+
+	// A SuperAdmin removing a user logs it out entirely
+	w = httptest.NewRecorder()
+	s.RemoveUser(w, r.WithContext(serverContext(r.Context())))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("RemoveUser() = %v: %s", w.Code, w.Body.String())
+	}
+	if _, ok := sessions["3"]; !ok || len(sessions) != 1 {
+		t.Errorf("RemoveUser() of a SuperAdmin left the sessions %v", sessions)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/snetsystems/cloudhub/backend/enterprise"
@@ -15,6 +16,7 @@ import (
 	"github.com/bouk/httprouter"
 	cloudhub "github.com/snetsystems/cloudhub/backend"
 	"github.com/snetsystems/cloudhub/backend/influx"
+	"github.com/snetsystems/cloudhub/backend/prometheus"
 )
 
 type sourceLinks struct {
@@ -66,6 +68,8 @@ func sourceAuthenticationMethod(ctx context.Context, src cloudhub.Source) authen
 		return authenticationResponse{ID: src.ID, AuthenticationMethod: "basic"}
 	} else if src.SharedSecret != "" {
 		return authenticationResponse{ID: src.ID, AuthenticationMethod: "shared"}
+	} else if src.Token != "" {
+		return authenticationResponse{ID: src.ID, AuthenticationMethod: "token"}
 	}
 
 	return authenticationResponse{ID: src.ID, AuthenticationMethod: "unknown"}
@@ -79,6 +83,14 @@ var (
 )
 
 func hasFlux(ctx context.Context, src cloudhub.Source) (bool, error) {
+	// Flux is the query language of InfluxDB 2.x
+	if src.Type == cloudhub.InfluxDBv2 {
+		return true, nil
+	}
+	if src.Type == cloudhub.Prometheus {
+		return false, nil
+	}
+
 	url, err := url.ParseRequestURI(src.URL)
 	if err != nil {
 		return false, err
@@ -101,9 +113,10 @@ func newSourceResponse(ctx context.Context, src cloudhub.Source) sourceResponse
 
 	authMethod := sourceAuthenticationMethod(ctx, src)
 
-	// Omit the password and shared secret on response
+	// Omit the password, shared secret and token on response
 	src.Password = ""
 	src.SharedSecret = ""
+	src.Token = ""
 
 	httpAPISrcs := "/cloudhub/v1/sources"
 	res := sourceResponse{
@@ -178,6 +191,10 @@ func (s *Service) NewSource(w http.ResponseWriter, r *http.Request) {
 		Error(w, http.StatusBadRequest, "Error contacting source", s.Logger)
 		return
 	}
+	if dbType == cloudhub.InfluxDBv2 && src.Type != cloudhub.InfluxDBv2 {
+		invalidData(w, fmt.Errorf("source is InfluxDB 2.x; type %s with an influxOrg and token required", cloudhub.InfluxDBv2), s.Logger)
+		return
+	}
 
 	src.Type = dbType
 	if src, err = s.Store.Sources(ctx).Add(ctx, src); err != nil {
@@ -192,6 +209,20 @@ func (s *Service) NewSource(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Service) tsdbVersion(ctx context.Context, src *cloudhub.Source) (string, error) {
+	if src.Type == cloudhub.Prometheus {
+		cli := &prometheus.Client{
+			Logger: s.Logger,
+		}
+		if err := cli.Connect(ctx, src); err != nil {
+			return "", err
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+
+		return cli.Version(ctx)
+	}
+
 	cli := &influx.Client{
 		Logger: s.Logger,
 	}
@@ -207,6 +238,20 @@ func (s *Service) tsdbVersion(ctx context.Context, src *cloudhub.Source) (string
 }
 
 func (s *Service) tsdbType(ctx context.Context, src *cloudhub.Source) (string, error) {
+	if src.Type == cloudhub.Prometheus {
+		cli := &prometheus.Client{
+			Logger: s.Logger,
+		}
+		if err := cli.Connect(ctx, src); err != nil {
+			return "", err
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+
+		return cloudhub.Prometheus, cli.Ping(ctx)
+	}
+
 	cli := &influx.Client{
 		Logger: s.Logger,
 	}
@@ -233,11 +278,23 @@ func (s *Service) Sources(w http.ResponseWriter, r *http.Request) {
 		Sources: make([]sourceResponse, 0),
 	}
 
-	srcs, err := s.Store.Sources(ctx).All(ctx)
+	all, err := s.Store.Sources(ctx).All(ctx)
 	if err != nil {
 		Error(w, http.StatusInternalServerError, "Error loading sources", s.Logger)
 		return
 	}
+	permissions, err := s.authorizer().Permissions(ctx, cloudhub.PolicySource)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, "Error loading policies of sources", s.Logger)
+		return
+	}
+	// Only the sources that the user may read are listed
+	srcs := all[:0]
+	for _, src := range all {
+		if permissions(strconv.Itoa(src.ID)) != "" {
+			srcs = append(srcs, src)
+		}
+	}
 
 	sourceCh := make(chan sourceResponse, len(srcs))
 	for _, src := range srcs {
@@ -303,12 +360,19 @@ func (s *Service) RemoveSource(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.QueryCache.Purge(id)
+
 	// Remove all the associated kapacitors for this source
 	if err = s.removeSrcsKapa(ctx, id); err != nil {
 		unknownErrorWithMessage(w, err, s.Logger)
 		return
 	}
 
+	if err = s.removePolicies(ctx, cloudhub.PolicySource, strconv.Itoa(id)); err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -420,6 +484,12 @@ func (s *Service) UpdateSource(w http.ResponseWriter, r *http.Request) {
 	if req.Telegraf != "" {
 		src.Telegraf = req.Telegraf
 	}
+	if req.InfluxOrg != "" {
+		src.InfluxOrg = req.InfluxOrg
+	}
+	if req.Token != "" {
+		src.Token = req.Token
+	}
 	src.DefaultRP = req.DefaultRP
 
 	defaultOrg, err := s.Store.Organizations(ctx).DefaultOrganization(ctx)
@@ -445,6 +515,10 @@ func (s *Service) UpdateSource(w http.ResponseWriter, r *http.Request) {
 		Error(w, http.StatusBadRequest, "Error contacting source", s.Logger)
 		return
 	}
+	if dbType == cloudhub.InfluxDBv2 && src.Type != cloudhub.InfluxDBv2 {
+		invalidData(w, fmt.Errorf("source is InfluxDB 2.x; type %s with an influxOrg and token required", cloudhub.InfluxDBv2), s.Logger)
+		return
+	}
 	src.Type = dbType
 
 	if err := s.Store.Sources(ctx).Update(ctx, src); err != nil {
@@ -452,6 +526,8 @@ func (s *Service) UpdateSource(w http.ResponseWriter, r *http.Request) {
 		Error(w, http.StatusInternalServerError, msg, s.Logger)
 		return
 	}
+	// Results of the old database must not outlive the change
+	s.QueryCache.Purge(id)
 	encodeJSON(w, http.StatusOK, newSourceResponse(context.Background(), src), s.Logger)
 }
 
@@ -464,12 +540,21 @@ func ValidSourceRequest(s *cloudhub.Source, defaultOrgID string) error {
 	if s.URL == "" {
 		return fmt.Errorf("url required")
 	}
-	// Type must be influx or influx-enterprise
+	// Type must be influx, influx-enterprise, influx-relay, influx-v2 or prometheus
 	if s.Type != "" {
-		if s.Type != cloudhub.InfluxDB && s.Type != cloudhub.InfluxEnterprise && s.Type != cloudhub.InfluxRelay {
+		if s.Type != cloudhub.InfluxDB && s.Type != cloudhub.InfluxEnterprise && s.Type != cloudhub.InfluxRelay && s.Type != cloudhub.InfluxDBv2 && s.Type != cloudhub.Prometheus {
 			return fmt.Errorf("invalid source type %s", s.Type)
 		}
 	}
+	// InfluxDB 2.x authenticates with a token of an organization
+	if s.Type == cloudhub.InfluxDBv2 {
+		if s.InfluxOrg == "" {
+			return fmt.Errorf("influxOrg required for %s sources", cloudhub.InfluxDBv2)
+		}
+		if s.Token == "" {
+			return fmt.Errorf("token required for %s sources", cloudhub.InfluxDBv2)
+		}
+	}
 
 	if s.Organization == "" {
 		s.Organization = defaultOrgID
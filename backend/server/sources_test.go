@@ -116,6 +116,63 @@ func Test_ValidSourceRequest(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "influx v2 without token",
+			args: args{
+				source: &cloudhub.Source{
+					ID:           1,
+					Name:         "I'm a really great source",
+					Type:         cloudhub.InfluxDBv2,
+					URL:          "http://www.any.url.com",
+					InfluxOrg:    "snet",
+					Organization: "0",
+				},
+			},
+			wants: wants{
+				err: fmt.Errorf("token required for influx-v2 sources"),
+			},
+		},
+		{
+			name: "influx v2 without org",
+			args: args{
+				source: &cloudhub.Source{
+					ID:           1,
+					Name:         "I'm a really great source",
+					Type:         cloudhub.InfluxDBv2,
+					URL:          "http://www.any.url.com",
+					Token:        "secret",
+					Organization: "0",
+				},
+			},
+			wants: wants{
+				err: fmt.Errorf("influxOrg required for influx-v2 sources"),
+			},
+		},
+		{
+			name: "influx v2",
+			args: args{
+				source: &cloudhub.Source{
+					ID:           1,
+					Name:         "I'm a really great source",
+					Type:         cloudhub.InfluxDBv2,
+					URL:          "http://www.any.url.com",
+					InfluxOrg:    "snet",
+					Token:        "secret",
+					Organization: "0",
+				},
+			},
+			wants: wants{
+				source: &cloudhub.Source{
+					ID:           1,
+					Name:         "I'm a really great source",
+					Type:         cloudhub.InfluxDBv2,
+					URL:          "http://www.any.url.com",
+					InfluxOrg:    "snet",
+					Token:        "secret",
+					Organization: "0",
+				},
+			},
+		},
 		{
 			name: "bad url",
 			args: args{
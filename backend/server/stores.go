@@ -94,6 +94,11 @@ type DataStore interface {
 	Config(ctx context.Context) cloudhub.ConfigStore
 	OrganizationConfig(ctx context.Context) cloudhub.OrganizationConfigStore
 	Vspheres(ctx context.Context) cloudhub.VspheresStore
+	AlertTemplates(ctx context.Context) cloudhub.AlertTemplatesStore
+	APITokens(ctx context.Context) cloudhub.APITokensStore
+	Policies(ctx context.Context) cloudhub.PoliciesStore
+	Groups(ctx context.Context) cloudhub.GroupsStore
+	Sessions(ctx context.Context) cloudhub.SessionsStore
 }
 
 // ensure that Store implements a DataStore
@@ -112,6 +117,11 @@ type Store struct {
 	ConfigStore             cloudhub.ConfigStore
 	OrganizationConfigStore cloudhub.OrganizationConfigStore
 	VspheresStore           cloudhub.VspheresStore
+	AlertTemplatesStore     cloudhub.AlertTemplatesStore
+	APITokensStore          cloudhub.APITokensStore
+	PoliciesStore           cloudhub.PoliciesStore
+	GroupsStore             cloudhub.GroupsStore
+	SessionsStore           cloudhub.SessionsStore
 }
 
 // Sources returns a noop.SourcesStore if the context has no organization specified
@@ -238,4 +248,62 @@ func (s *Store) Vspheres(ctx context.Context) cloudhub.VspheresStore {
 	}
 
 	return &noop.VspheresStore{}
-}
\ No newline at end of file
+}
+
+// AlertTemplates returns a noop.AlertTemplatesStore if the context has no organization specified
+// and an organization.AlertTemplatesStore otherwise.
+func (s *Store) AlertTemplates(ctx context.Context) cloudhub.AlertTemplatesStore {
+	if isServer := hasServerContext(ctx); isServer {
+		return s.AlertTemplatesStore
+	}
+	if org, ok := hasOrganizationContext(ctx); ok {
+		return organizations.NewAlertTemplatesStore(s.AlertTemplatesStore, org)
+	}
+
+	return &noop.AlertTemplatesStore{}
+}
+
+// APITokens returns a noop.APITokensStore unless the server context is
+// specified; API tokens are scoped to users rather than organizations.
+func (s *Store) APITokens(ctx context.Context) cloudhub.APITokensStore {
+	if isServer := hasServerContext(ctx); isServer {
+		return s.APITokensStore
+	}
+
+	return &noop.APITokensStore{}
+}
+
+// Policies returns a noop.PoliciesStore if the context has no organization specified
+// and an organization.PoliciesStore otherwise.
+func (s *Store) Policies(ctx context.Context) cloudhub.PoliciesStore {
+	if isServer := hasServerContext(ctx); isServer {
+		return s.PoliciesStore
+	}
+	if org, ok := hasOrganizationContext(ctx); ok {
+		return organizations.NewPoliciesStore(s.PoliciesStore, org)
+	}
+
+	return &noop.PoliciesStore{}
+}
+
+// Groups returns the underlying GroupsStore of provisioned groups, which are
+// not scoped to organizations.
+func (s *Store) Groups(ctx context.Context) cloudhub.GroupsStore {
+	if isServer := hasServerContext(ctx); isServer {
+		return s.GroupsStore
+	}
+	if isSuperAdmin := hasSuperAdminContext(ctx); isSuperAdmin {
+		return s.GroupsStore
+	}
+	return &noop.GroupsStore{}
+}
+
+// Sessions returns a noop.SessionsStore unless the server context is
+// specified; sessions are scoped to users rather than organizations.
+func (s *Store) Sessions(ctx context.Context) cloudhub.SessionsStore {
+	if isServer := hasServerContext(ctx); isServer {
+		return s.SessionsStore
+	}
+
+	return &noop.SessionsStore{}
+}
@@ -0,0 +1,290 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/oauth2"
+	"github.com/snetsystems/cloudhub/backend/totp"
+)
+
+const (
+	// twoFactorIssuer names CloudHub in authenticator apps
+	twoFactorIssuer = "CloudHub"
+
+	errTwoFactorRequired = "Two-factor authentication is required for admins of this organization. Enroll it at /cloudhub/v1/me/2fa"
+)
+
+type twoFactorRequest struct {
+	Code string `json:"code"`
+}
+
+type twoFactorResponse struct {
+	Enabled              bool      `json:"enabled"`
+	Pending              bool      `json:"pending,omitempty"`
+	BackupCodesRemaining int       `json:"backupCodesRemaining"`
+	Secret               string    `json:"secret,omitempty"`      // Secret is only returned when enrollment starts
+	URL                  string    `json:"url,omitempty"`         // URL is the otpauth URL of Secret
+	BackupCodes          []string  `json:"backupCodes,omitempty"` // BackupCodes are only returned when generated
+	Links                selfLinks `json:"links"`
+}
+
+func newTwoFactorResponse(u *cloudhub.User) *twoFactorResponse {
+	return &twoFactorResponse{
+		Enabled:              u.TOTPEnabled,
+		Pending:              !u.TOTPEnabled && u.TOTPSecret != "",
+		BackupCodesRemaining: len(u.BackupCodes),
+		Links:                selfLinks{Self: "/cloudhub/v1/me/2fa"},
+	}
+}
+
+// meForTwoFactor returns the current user of a request managing its second
+// factor, which API tokens may not do
+func (s *Service) meForTwoFactor(w http.ResponseWriter, ctx context.Context) (*cloudhub.User, oauth2.Principal, bool) {
+	if _, ok := hasAPITokenContext(ctx); ok {
+		Error(w, http.StatusForbidden, "API tokens cannot manage two-factor authentication", s.Logger)
+		return nil, oauth2.Principal{}, false
+	}
+	u, p, err := s.currentUser(ctx)
+	if err != nil {
+		Error(w, http.StatusForbidden, err.Error(), s.Logger)
+		return nil, p, false
+	}
+	if u.ServiceAccount {
+		Error(w, http.StatusForbidden, "service accounts cannot have two-factor authentication", s.Logger)
+		return nil, p, false
+	}
+	return u, p, true
+}
+
+// verifyMeTwoFactor checks a code of the enrolled second factor of the
+// current user, which counts toward its lockout
+func (s *Service) verifyMeTwoFactor(w http.ResponseWriter, ctx context.Context, p oauth2.Principal, code string) bool {
+	serverCtx := serverContext(ctx)
+	if err := s.SecondFactor.Verify(serverCtx, p, code); err != nil {
+		Error(w, http.StatusForbidden, "two-factor code is invalid", s.Logger)
+		return false
+	}
+	return true
+}
+
+// MeTwoFactor returns the state of the second factor of the current user
+func (s *Service) MeTwoFactor(w http.ResponseWriter, r *http.Request) {
+	u, _, ok := s.meForTwoFactor(w, r.Context())
+	if !ok {
+		return
+	}
+	encodeJSON(w, http.StatusOK, newTwoFactorResponse(u), s.Logger)
+}
+
+// NewMeTwoFactor starts the enrollment of a TOTP authenticator app by the
+// current user. The secret is pending until confirmed with a code of the
+// app by UpdateMeTwoFactor.
+func (s *Service) NewMeTwoFactor(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	u, _, ok := s.meForTwoFactor(w, ctx)
+	if !ok {
+		return
+	}
+	if u.TOTPEnabled {
+		Error(w, http.StatusConflict, "two-factor authentication is already enabled", s.Logger)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+	u.TOTPSecret = secret
+	serverCtx := serverContext(ctx)
+	if err := s.Store.Users(serverCtx).Update(serverCtx, u); err != nil {
+		Error(w, http.StatusInternalServerError, err.Error(), s.Logger)
+		return
+	}
+
+	res := newTwoFactorResponse(u)
+	res.Secret = secret
+	res.URL = totp.URL(twoFactorIssuer, u.Name, secret)
+	encodeJSON(w, http.StatusCreated, res, s.Logger)
+}
+
+// UpdateMeTwoFactor confirms the pending enrollment of the current user with
+// a code of its authenticator app, which enables the second factor and
+// returns the backup codes
+func (s *Service) UpdateMeTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req twoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	u, _, ok := s.meForTwoFactor(w, ctx)
+	if !ok {
+		return
+	}
+	if u.TOTPEnabled {
+		Error(w, http.StatusConflict, "two-factor authentication is already enabled", s.Logger)
+		return
+	}
+	if u.TOTPSecret == "" {
+		invalidData(w, fmt.Errorf("no pending two-factor enrollment; POST /cloudhub/v1/me/2fa first"), s.Logger)
+		return
+	}
+
+	counter, valid := totp.Validate(u.TOTPSecret, req.Code, time.Now())
+	if !valid {
+		Error(w, http.StatusForbidden, "two-factor code is invalid", s.Logger)
+		return
+	}
+
+	codes, err := oauth2.NewBackupCodes(u)
+	if err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+	u.TOTPEnabled = true
+	u.TOTPCounter = counter
+	u.FailedCodes = 0
+	serverCtx := serverContext(ctx)
+	if err := s.Store.Users(serverCtx).Update(serverCtx, u); err != nil {
+		Error(w, http.StatusInternalServerError, err.Error(), s.Logger)
+		return
+	}
+
+	res := newTwoFactorResponse(u)
+	res.BackupCodes = codes
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+// RemoveMeTwoFactor disables the second factor of the current user, which
+// must provide a code of it
+func (s *Service) RemoveMeTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req twoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	u, p, ok := s.meForTwoFactor(w, ctx)
+	if !ok {
+		return
+	}
+	if u.TOTPEnabled && !s.verifyMeTwoFactor(w, ctx, p, req.Code) {
+		return
+	}
+
+	serverCtx := serverContext(ctx)
+	// Verify consumed the code on the stored user
+	u, err := s.Store.Users(serverCtx).Get(serverCtx, cloudhub.UserQuery{ID: &u.ID})
+	if err != nil {
+		Error(w, http.StatusInternalServerError, err.Error(), s.Logger)
+		return
+	}
+	clearTwoFactor(u)
+	if err := s.Store.Users(serverCtx).Update(serverCtx, u); err != nil {
+		Error(w, http.StatusInternalServerError, err.Error(), s.Logger)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// NewMeBackupCodes replaces the backup codes of the current user, which
+// must provide a code of its second factor
+func (s *Service) NewMeBackupCodes(w http.ResponseWriter, r *http.Request) {
+	var req twoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	u, p, ok := s.meForTwoFactor(w, ctx)
+	if !ok {
+		return
+	}
+	if !u.TOTPEnabled {
+		invalidData(w, fmt.Errorf("two-factor authentication is not enabled"), s.Logger)
+		return
+	}
+	if !s.verifyMeTwoFactor(w, ctx, p, req.Code) {
+		return
+	}
+
+	serverCtx := serverContext(ctx)
+	u, err := s.Store.Users(serverCtx).Get(serverCtx, cloudhub.UserQuery{ID: &u.ID})
+	if err != nil {
+		Error(w, http.StatusInternalServerError, err.Error(), s.Logger)
+		return
+	}
+	codes, err := oauth2.NewBackupCodes(u)
+	if err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+	if err := s.Store.Users(serverCtx).Update(serverCtx, u); err != nil {
+		Error(w, http.StatusInternalServerError, err.Error(), s.Logger)
+		return
+	}
+
+	res := newTwoFactorResponse(u)
+	res.BackupCodes = codes
+	encodeJSON(w, http.StatusCreated, res, s.Logger)
+}
+
+// ResetUserTwoFactor disables the second factor of a user who lost it, so
+// that the user logs in with its provider alone and may enroll again. As
+// with passwords, admins of an organization may only reset users of their
+// organization alone; SuperAdmins may reset any.
+func (s *Service) ResetUserTwoFactor(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	idStr := httprouter.GetParamFromContext(ctx, "id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		Error(w, http.StatusBadRequest, fmt.Sprintf("invalid user id: %s", err.Error()), s.Logger)
+		return
+	}
+
+	// The user must be visible to the requester, but is checked and updated
+	// with all of its roles
+	if _, err := s.Store.Users(ctx).Get(ctx, cloudhub.UserQuery{ID: &id}); err != nil {
+		Error(w, http.StatusNotFound, err.Error(), s.Logger)
+		return
+	}
+	serverCtx := serverContext(ctx)
+	u, err := s.Store.Users(serverCtx).Get(serverCtx, cloudhub.UserQuery{ID: &id})
+	if err != nil {
+		Error(w, http.StatusNotFound, err.Error(), s.Logger)
+		return
+	}
+
+	if !hasSuperAdminContext(ctx) && (u.SuperAdmin || len(u.Roles) > 1) {
+		Error(w, http.StatusForbidden, "only SuperAdmins may reset the two-factor authentication of a SuperAdmin or of a user of other organizations", s.Logger)
+		return
+	}
+
+	clearTwoFactor(u)
+	if err := s.Store.Users(serverCtx).Update(serverCtx, u); err != nil {
+		Error(w, http.StatusInternalServerError, err.Error(), s.Logger)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func clearTwoFactor(u *cloudhub.User) {
+	u.TOTPSecret = ""
+	u.TOTPEnabled = false
+	u.TOTPCounter = 0
+	u.BackupCodes = nil
+	u.FailedCodes = 0
+}
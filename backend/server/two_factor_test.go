@@ -0,0 +1,191 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+	"github.com/snetsystems/cloudhub/backend/oauth2"
+	"github.com/snetsystems/cloudhub/backend/roles"
+	"github.com/snetsystems/cloudhub/backend/totp"
+)
+
+// twoFactorStore returns a DataStore of a single user that keeps its updates
+func twoFactorStore(u *cloudhub.User) *mocks.Store {
+	store := apiTokensStore(u, map[string]cloudhub.APIToken{})
+	get := store.UsersStore.(*mocks.UsersStore).GetF
+	store.UsersStore = &mocks.UsersStore{
+		GetF: func(ctx context.Context, q cloudhub.UserQuery) (*cloudhub.User, error) {
+			if q.Name != nil && *q.Name != u.Name {
+				return nil, cloudhub.ErrUserNotFound
+			}
+			return get(ctx, q)
+		},
+		UpdateF: func(ctx context.Context, v *cloudhub.User) error {
+			*u = *v
+			return nil
+		},
+	}
+	return store
+}
+
+func TestService_MeTwoFactor_Enrollment(t *testing.T) {
+	u := &cloudhub.User{
+		ID:       1,
+		Name:     "billietta",
+		Provider: "github",
+		Scheme:   "oauth2",
+		Roles:    []cloudhub.Role{{Organization: "1", Name: roles.AdminRoleName}},
+	}
+	store := twoFactorStore(u)
+	s := &Service{
+		Store:        store,
+		SecondFactor: &oauth2.TOTP{Users: store.UsersStore, Logger: log.New(log.DebugLevel)},
+		Logger:       log.New(log.DebugLevel),
+	}
+	ctx := context.WithValue(context.Background(), oauth2.PrincipalKey, oauth2.Principal{
+		Subject:      "billietta",
+		Issuer:       "github",
+		Organization: "1",
+	})
+	do := func(h http.HandlerFunc, method, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "http://any.url/cloudhub/v1/me/2fa", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		h(w, r.WithContext(ctx))
+		return w
+	}
+
+	w := do(s.NewMeTwoFactor, "POST", "")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("NewMeTwoFactor() = %v: %s", w.Code, w.Body.String())
+	}
+	var res twoFactorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Secret == "" || res.Secret != u.TOTPSecret || !res.Pending || res.Enabled {
+		t.Fatalf("NewMeTwoFactor() = %+v", res)
+	}
+
+	if w := do(s.UpdateMeTwoFactor, "PUT", `{"code": "000000"}`); w.Code != http.StatusForbidden {
+		t.Errorf("UpdateMeTwoFactor() of a wrong code = %v, want %v", w.Code, http.StatusForbidden)
+	}
+	code, _ := totp.CodeAt(res.Secret, totp.Counter(time.Now()))
+	w = do(s.UpdateMeTwoFactor, "PUT", `{"code": "`+code+`"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("UpdateMeTwoFactor() = %v: %s", w.Code, w.Body.String())
+	}
+	res = twoFactorResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if !res.Enabled || len(res.BackupCodes) != oauth2.BackupCodeCount || !u.TOTPEnabled {
+		t.Fatalf("UpdateMeTwoFactor() = %+v", res)
+	}
+
+	if w := do(s.NewMeTwoFactor, "POST", ""); w.Code != http.StatusConflict {
+		t.Errorf("NewMeTwoFactor() of an enabled user = %v, want %v", w.Code, http.StatusConflict)
+	}
+
+	// The code used to enroll cannot disable the second factor again
+	if w := do(s.RemoveMeTwoFactor, "DELETE", `{"code": "`+code+`"}`); w.Code != http.StatusForbidden {
+		t.Errorf("RemoveMeTwoFactor() of a used code = %v, want %v", w.Code, http.StatusForbidden)
+	}
+	if w := do(s.RemoveMeTwoFactor, "DELETE", `{"code": "`+res.BackupCodes[0]+`"}`); w.Code != http.StatusNoContent {
+		t.Fatalf("RemoveMeTwoFactor() = %v: %s", w.Code, w.Body.String())
+	}
+	if u.TOTPEnabled || u.TOTPSecret != "" || len(u.BackupCodes) != 0 {
+		t.Errorf("RemoveMeTwoFactor() left %+v", u)
+	}
+}
+
+func TestService_NewMeTwoFactor_APIToken(t *testing.T) {
+	u := &cloudhub.User{ID: 1, Name: "billietta", Provider: "github", Scheme: "oauth2"}
+	s := &Service{
+		Store:  twoFactorStore(u),
+		Logger: log.New(log.DebugLevel),
+	}
+	ctx := context.WithValue(context.Background(), oauth2.PrincipalKey, oauth2.Principal{
+		Subject: "billietta",
+		Issuer:  "github",
+	})
+	ctx = context.WithValue(ctx, APITokenContextKey, cloudhub.APIToken{ID: "9"})
+	r := httptest.NewRequest("POST", "http://any.url/cloudhub/v1/me/2fa", nil)
+	w := httptest.NewRecorder()
+	s.NewMeTwoFactor(w, r.WithContext(ctx))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("NewMeTwoFactor() with an API token = %v, want %v", w.Code, http.StatusForbidden)
+	}
+	if u.TOTPSecret != "" {
+		t.Errorf("NewMeTwoFactor() with an API token stored a secret")
+	}
+}
+
+func TestAuthorizedUser_RequireTwoFactor(t *testing.T) {
+	tests := []struct {
+		name       string
+		user       *cloudhub.User
+		role       string
+		wantStatus int
+	}{
+		{
+			name:       "Admin without a second factor",
+			user:       &cloudhub.User{ID: 1, Name: "billietta", Provider: "github", Scheme: "oauth2", Roles: []cloudhub.Role{{Organization: "1", Name: roles.AdminRoleName}}},
+			role:       roles.ViewerRoleName,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Admin with a second factor",
+			user:       &cloudhub.User{ID: 1, Name: "billietta", Provider: "github", Scheme: "oauth2", TOTPEnabled: true, Roles: []cloudhub.Role{{Organization: "1", Name: roles.AdminRoleName}}},
+			role:       roles.AdminRoleName,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Editor without a second factor",
+			user:       &cloudhub.User{ID: 1, Name: "billietta", Provider: "github", Scheme: "oauth2", Roles: []cloudhub.Role{{Organization: "1", Name: roles.EditorRoleName}}},
+			role:       roles.EditorRoleName,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "SuperAdmin without a second factor",
+			user:       &cloudhub.User{ID: 1, Name: "billietta", Provider: "github", Scheme: "oauth2", SuperAdmin: true},
+			role:       roles.ViewerRoleName,
+			wantStatus: http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}
+			store := apiTokensStore(tt.user, map[string]cloudhub.APIToken{})
+			store.OrganizationsStore = &mocks.OrganizationsStore{
+				DefaultOrganizationF: func(ctx context.Context) (*cloudhub.Organization, error) {
+					return &cloudhub.Organization{ID: "0"}, nil
+				},
+				GetF: func(ctx context.Context, q cloudhub.OrganizationQuery) (*cloudhub.Organization, error) {
+					return &cloudhub.Organization{ID: *q.ID, RequireTwoFactor: *q.ID == "1"}, nil
+				},
+			}
+
+			r := httptest.NewRequest("GET", "http://any.url", nil)
+			ctx := context.WithValue(r.Context(), oauth2.PrincipalKey, oauth2.Principal{
+				Subject:      "billietta",
+				Issuer:       "github",
+				Organization: "1",
+			})
+			w := httptest.NewRecorder()
+			AuthorizedUser(store, true, tt.role, log.New(log.DebugLevel), next)(w, r.WithContext(ctx))
+			if w.Code != tt.wantStatus {
+				t.Errorf("AuthorizedUser() = %v, want %v: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
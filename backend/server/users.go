@@ -10,6 +10,7 @@ import (
 
 	"github.com/bouk/httprouter"
 	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/oauth2"
 	"github.com/snetsystems/cloudhub/backend/roles"
 )
 
@@ -20,9 +21,22 @@ type userRequest struct {
 	Scheme     string          `json:"scheme"`
 	SuperAdmin bool            `json:"superAdmin"`
 	Roles      []cloudhub.Role `json:"roles"`
+	Password   string          `json:"password,omitempty"`
+	// ServiceAccount creates a non-human user, owned by Owner
+	ServiceAccount bool   `json:"serviceAccount,omitempty"`
+	Owner          uint64 `json:"owner,string,omitempty"`
 }
 
 func (r *userRequest) ValidCreate() error {
+	if r.ServiceAccount {
+		if r.Provider != "" && r.Provider != ServiceAccountProvider {
+			return fmt.Errorf("Provider of a service account must be %s", ServiceAccountProvider)
+		}
+		r.Provider = ServiceAccountProvider
+		r.Scheme = "oauth2"
+	} else if r.Provider == ServiceAccountProvider {
+		return fmt.Errorf("Provider %s is reserved for service accounts", ServiceAccountProvider)
+	}
 	if r.Name == "" {
 		return fmt.Errorf("Name required on CloudHub User request body")
 	}
@@ -70,13 +84,16 @@ func (r *userRequest) ValidRoles() error {
 }
 
 type userResponse struct {
-	Links      selfLinks       `json:"links"`
-	ID         uint64          `json:"id,string"`
-	Name       string          `json:"name"`
-	Provider   string          `json:"provider"`
-	Scheme     string          `json:"scheme"`
-	SuperAdmin bool            `json:"superAdmin"`
-	Roles      []cloudhub.Role `json:"roles"`
+	Links          selfLinks       `json:"links"`
+	ID             uint64          `json:"id,string"`
+	Name           string          `json:"name"`
+	Provider       string          `json:"provider"`
+	Scheme         string          `json:"scheme"`
+	SuperAdmin     bool            `json:"superAdmin"`
+	Roles          []cloudhub.Role `json:"roles"`
+	ServiceAccount bool            `json:"serviceAccount,omitempty"`
+	Owner          uint64          `json:"owner,string,omitempty"`
+	Deactivated    bool            `json:"deactivated,omitempty"`
 }
 
 func newUserResponse(u *cloudhub.User, org string) *userResponse {
@@ -93,12 +110,15 @@ func newUserResponse(u *cloudhub.User, org string) *userResponse {
 		selfLink = fmt.Sprintf("/cloudhub/v1/users/%d", u.ID)
 	}
 	return &userResponse{
-		ID:         u.ID,
-		Name:       u.Name,
-		Provider:   u.Provider,
-		Scheme:     u.Scheme,
-		Roles:      u.Roles,
-		SuperAdmin: u.SuperAdmin,
+		ID:             u.ID,
+		Name:           u.Name,
+		Provider:       u.Provider,
+		Scheme:         u.Scheme,
+		Roles:          u.Roles,
+		SuperAdmin:     u.SuperAdmin,
+		ServiceAccount: u.ServiceAccount,
+		Owner:          u.Owner,
+		Deactivated:    u.Deactivated,
 		Links: selfLinks{
 			Self: selfLink,
 		},
@@ -183,13 +203,30 @@ func (s *Service) NewUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	user := &cloudhub.User{
-		Name:     req.Name,
-		Provider: req.Provider,
-		Scheme:   req.Scheme,
-		Roles:    req.Roles,
+		Name:           req.Name,
+		Provider:       req.Provider,
+		Scheme:         req.Scheme,
+		Roles:          req.Roles,
+		ServiceAccount: req.ServiceAccount,
 	}
 
-	if cfg.Auth.SuperAdminNewUsers {
+	orgID := httprouter.GetParamFromContext(ctx, "oid")
+	if req.ServiceAccount {
+		if err := s.validServiceAccount(ctx, req, orgID, user); err != nil {
+			invalidData(w, err, s.Logger)
+			return
+		}
+	} else if req.Provider == oauth2.LocalProvider {
+		if err := s.PasswordPolicy.SetPassword(user, req.Password); err != nil {
+			invalidData(w, err, s.Logger)
+			return
+		}
+	} else if req.Password != "" {
+		invalidData(w, fmt.Errorf("Password is only supported for %s users", oauth2.LocalProvider), s.Logger)
+		return
+	}
+
+	if cfg.Auth.SuperAdminNewUsers && !req.ServiceAccount {
 		req.SuperAdmin = true
 	}
 
@@ -204,7 +241,6 @@ func (s *Service) NewUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	orgID := httprouter.GetParamFromContext(ctx, "oid")
 	cu := newUserResponse(res, orgID)
 	location(w, cu.Links.Self)
 	encodeJSON(w, http.StatusCreated, cu, s.Logger)
@@ -225,10 +261,30 @@ func (s *Service) RemoveUser(w http.ResponseWriter, r *http.Request) {
 		Error(w, http.StatusNotFound, err.Error(), s.Logger)
 		return
 	}
+	// A service account belongs to its organization alone, so it is removed
+	// entirely along with its API tokens
+	if u.ServiceAccount {
+		if err := s.removeServiceAccount(ctx, u); err != nil {
+			Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
 	if err := s.Store.Users(ctx).Delete(ctx, u); err != nil {
 		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
 		return
 	}
+	// A user removed from an organization is logged out of it, and a user
+	// removed by a SuperAdmin is logged out entirely
+	var org string
+	if !hasServerContext(ctx) {
+		org, _ = hasOrganizationContext(ctx)
+	}
+	if err := s.revokeSessions(ctx, u, org, ""); err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -311,6 +367,16 @@ func (s *Service) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if u.ServiceAccount {
+		if err := s.validServiceAccount(ctx, req, httprouter.GetParamFromContext(ctx, "oid"), u); err != nil {
+			invalidData(w, err, s.Logger)
+			return
+		}
+	} else if req.Owner != 0 {
+		invalidData(w, fmt.Errorf("Only service accounts have an owner"), s.Logger)
+		return
+	}
+
 	err = s.Store.Users(ctx).Update(ctx, u)
 	if err != nil {
 		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
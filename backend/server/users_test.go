@@ -694,6 +694,11 @@ func TestService_RemoveUser(t *testing.T) {
 			s := &Service{
 				Store: &mocks.Store{
 					UsersStore: tt.fields.UsersStore,
+					SessionsStore: &mocks.SessionsStore{
+						AllF: func(ctx context.Context) ([]cloudhub.Session, error) {
+							return []cloudhub.Session{}, nil
+						},
+					},
 				},
 				Logger: tt.fields.Logger,
 			}
@@ -0,0 +1,87 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// secret is the key of the test vectors of RFC 6238 appendix B,
+// "12345678901234567890", in base32
+const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeAt(t *testing.T) {
+	// The 8 digit codes of RFC 6238 truncated to 6 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+		{unix: 20000000000, want: "353130"},
+	}
+	for _, tt := range tests {
+		got, err := CodeAt(secret, Counter(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("CodeAt(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+
+	if _, err := CodeAt("not base32!", 1); err == nil {
+		t.Error("CodeAt() expected an error for an invalid secret")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	tests := []struct {
+		name string
+		code string
+		at   time.Time
+		ok   bool
+	}{
+		{name: "Current code", code: "050471", at: now, ok: true},
+		{name: "Code with spaces", code: "050 471", at: now, ok: true},
+		{name: "Code of the previous step", code: "050471", at: now.Add(Period), ok: true},
+		{name: "Code of two steps ago", code: "050471", at: now.Add(2 * Period), ok: false},
+		{name: "Wrong code", code: "123456", at: now, ok: false},
+		{name: "Short code", code: "05047", at: now, ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter, ok := Validate(secret, tt.code, tt.at)
+			if ok != tt.ok {
+				t.Fatalf("Validate() = %v, want %v", ok, tt.ok)
+			}
+			if ok && counter != Counter(now) {
+				t.Errorf("Validate() counter = %d, want %d", counter, Counter(now))
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	s, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s) != 32 {
+		t.Errorf("GenerateSecret() = %s, want 32 base32 characters", s)
+	}
+	if _, err := CodeAt(s, 1); err != nil {
+		t.Errorf("CodeAt() of a generated secret error = %v", err)
+	}
+}
+
+func TestURL(t *testing.T) {
+	got := URL("CloudHub", "alice", secret)
+	if !strings.HasPrefix(got, "otpauth://totp/CloudHub:alice?") || !strings.Contains(got, "secret="+secret) || !strings.Contains(got, "issuer=CloudHub") {
+		t.Errorf("URL() = %s", got)
+	}
+}